@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+// chainTestExcerpt bounds the characters of the answer printed by the test command.
+const chainTestExcerpt = 200
+
+// chainTestOptions holds the flags of the test command.
+type chainTestOptions struct {
+	listener string
+	models   []string
+	prompt   string
+	path     string
+}
+
+// chainTestReport is the outcome of a test request.
+type chainTestReport struct {
+	Attempts []hydra.Attempt
+	Status   int // Status returned to the client, 0 without a response
+	Answer   string
+	Err      error
+	Elapsed  time.Duration
+}
+
+func newTestCmd() *cobra.Command {
+	var opts chainTestOptions
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a test request through a listener or model chain and show each attempt",
+		Run: func(_ *cobra.Command, _ []string) {
+			runChainTest(opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.listener, "listener", "", "listener name (default is the first)")
+	cmd.Flags().StringSliceVar(&opts.models, "models", nil, "model IDs to try, not a listener")
+	cmd.Flags().StringVarP(&opts.prompt, "prompt", "p", "Reply with the word OK.", "prompt to send")
+	cmd.Flags().StringVar(&opts.path, "path", "", "request path (default is the API type's)")
+	return cmd
+}
+
+func runChainTest(opts chainTestOptions) {
+	cfg, err := hydra.LoadConfig()
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+	l, err := chainTestListener(cfg, opts)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	path := opts.path
+	if path == "" {
+		path = l.DefaultPath()
+	}
+	if path == "" {
+		logger.Fatalf("--path is required for %s models", l.ConfigType)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	retry := cfg.ListenerRetry(l)
+	transport := hydra.NewRetryTransport(nil, cfg.Providers, retry, cfg.Log, logger)
+	transport.Reload(l, cfg.Providers, retry)
+	report, err := sendChainTest(ctx, transport, l.ConfigType, path, opts.prompt)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if err := writeChainTestReport(os.Stdout, report); err != nil {
+		logger.Fatalf("failed to write report: %v", err)
+	}
+	if report.Err != nil || report.Status >= 400 {
+		os.Exit(1)
+	}
+}
+
+// chainTestListener returns the listener named by the options, or a listener
+// serving only the given models in order.
+func chainTestListener(cfg *hydra.Config, opts chainTestOptions) (*hydra.Listener, error) {
+	if len(opts.models) == 0 {
+		if len(cfg.Listeners) == 0 {
+			return nil, errors.New("no listeners configured")
+		}
+		return selectListener(cfg, opts.listener)
+	}
+	if opts.listener != "" {
+		return nil, errors.New("--listener and --models are mutually exclusive")
+	}
+
+	l := &hydra.Listener{Name: "test"}
+	for _, id := range opts.models {
+		m, ok := cfg.Models[id]
+		if !ok {
+			return nil, fmt.Errorf("model %q not found", id)
+		}
+		if l.ConfigType == "" {
+			l.ConfigType = m.Type
+		}
+		m.ID = id
+		l.ResolvedModels = append(l.ResolvedModels, m)
+	}
+	return l, nil
+}
+
+// sendChainTest sends a single-turn request with prompt through transport and
+// records every upstream attempt it makes.
+func sendChainTest(
+	ctx context.Context,
+	transport *hydra.RetryTransport,
+	listenerType, path, prompt string,
+) (chainTestReport, error) {
+	var report chainTestReport
+	body, err := evalRequestBody(EvalCase{Prompt: prompt}, listenerType)
+	if err != nil {
+		return report, err
+	}
+	ctx = hydra.WithAttemptObserver(ctx, func(a hydra.Attempt) {
+		report.Attempts = append(report.Attempts, a)
+	})
+
+	start := time.Now()
+	report.Answer, report.Status, report.Err = sendTestRequest(
+		ctx,
+		transport,
+		path,
+		body,
+		listenerType,
+	)
+	report.Elapsed = time.Since(start)
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+	return report, nil
+}
+
+// sendTestRequest sends one request through transport and returns the
+// answer text and status.
+func sendTestRequest(
+	ctx context.Context,
+	transport *hydra.RetryTransport,
+	path string,
+	body []byte,
+	listenerType string,
+) (string, int, error) {
+	req, err := newEvalRequest(ctx, path, body)
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	if resp.StatusCode >= 400 {
+		return string(respBody), resp.StatusCode, nil
+	}
+	return extractAnswer(respBody, listenerType), resp.StatusCode, nil
+}
+
+// writeChainTestReport prints each attempt with its latency, the model that
+// answered, and an excerpt of the answer.
+func writeChainTestReport(w io.Writer, r chainTestReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "#\tMODEL\tPROVIDER\tSTATUS\tLATENCY\tRESULT")
+	var answered *hydra.Attempt
+	for i, a := range r.Attempts {
+		status := "-"
+		if a.Status != 0 {
+			status = fmt.Sprint(a.Status)
+		}
+		result := "answered"
+		switch {
+		case a.Answered:
+			answered = &r.Attempts[i]
+		case a.Err != nil:
+			result = "failed: " + a.Err.Error()
+		case a.Class != "":
+			result = "failed: " + a.Class
+		default:
+			result = "failed"
+		}
+		_, _ = fmt.Fprintf(
+			tw,
+			"%d\t%s\t%s\t%s\t%s\t%s\n",
+			i+1,
+			a.ModelID,
+			a.Provider,
+			status,
+			a.Latency.Round(time.Millisecond),
+			result,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	elapsed := r.Elapsed.Round(time.Millisecond)
+	switch {
+	case r.Err != nil:
+		_, _ = fmt.Fprintf(w, "\nNo answer after %s: %v\n", elapsed, r.Err)
+	case answered == nil || r.Status >= 400:
+		_, _ = fmt.Fprintf(w, "\nRequest failed with status %d after %s\n", r.Status, elapsed)
+	default:
+		_, _ = fmt.Fprintf(
+			w,
+			"\nAnswered by %s (%s) with status %d in %s\n",
+			answered.Provider,
+			answered.ModelID,
+			r.Status,
+			elapsed,
+		)
+	}
+	if excerpt := excerpt(r.Answer, chainTestExcerpt); excerpt != "" {
+		_, _ = fmt.Fprintf(w, "Response: %s\n", excerpt)
+	}
+	return nil
+}
+
+// excerpt returns text on one line, cut to at most n characters.
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n]) + "…"
+	}
+	return text
+}
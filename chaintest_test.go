@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fang2hou/hydrallm/hydra"
+)
+
+func TestNewTestCmd(t *testing.T) {
+	cmd := newTestCmd()
+	if cmd.Use != "test" {
+		t.Errorf("expected Use 'test', got %q", cmd.Use)
+	}
+	for _, name := range []string{"listener", "models", "prompt", "path"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("expected --%s flag", name)
+		}
+	}
+}
+
+func TestChainTestListener(t *testing.T) {
+	cfg := &hydra.Config{
+		Models: map[string]hydra.Model{
+			"primary":  {Provider: "mock", Type: "anthropic"},
+			"fallback": {Provider: "mock", Type: "anthropic"},
+		},
+		Listeners: []hydra.Listener{{Name: "main", ConfigType: "openai"}},
+	}
+
+	l, err := chainTestListener(cfg, chainTestOptions{models: []string{"fallback", "primary"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.ConfigType != "anthropic" || len(l.ResolvedModels) != 2 ||
+		l.ResolvedModels[0].ID != "fallback" {
+		t.Errorf("unexpected listener: %+v", l)
+	}
+
+	l, err = chainTestListener(cfg, chainTestOptions{})
+	if err != nil || l.Name != "main" {
+		t.Errorf("expected first listener, got %+v, %v", l, err)
+	}
+
+	for name, opts := range map[string]chainTestOptions{
+		"unknown model": {models: []string{"missing"}},
+		"both":          {listener: "main", models: []string{"primary"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := chainTestListener(cfg, opts); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSendChainTest(t *testing.T) {
+	mock, err := hydra.NewMockServer(
+		[]hydra.MockScenario{{Name: "down", Model: "^chaintest-primary$", Status: 503}},
+		log.New(io.Discard),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	parsed, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	providers := map[string]hydra.Provider{
+		"chaintest-mock": {URL: ts.URL, ParsedURL: parsed},
+	}
+	retry := hydra.RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	model := func(name string) hydra.Model {
+		return hydra.Model{
+			ID:       name,
+			Provider: "chaintest-mock",
+			Model:    name,
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	l := &hydra.Listener{
+		Name:           "chaintest",
+		ConfigType:     "openai",
+		ResolvedModels: []hydra.Model{model("chaintest-primary"), model("chaintest-fallback")},
+	}
+	transport := hydra.NewRetryTransport(
+		nil,
+		providers,
+		retry,
+		hydra.LogConfig{},
+		log.New(io.Discard),
+	)
+	transport.Reload(l, providers, retry)
+
+	report, err := sendChainTest(
+		context.Background(),
+		transport,
+		"openai",
+		"/v1/chat/completions",
+		"Reply with OK.",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Err != nil || report.Status != http.StatusOK || report.Answer == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(report.Attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %+v", report.Attempts)
+	}
+	if a := report.Attempts[0]; a.ModelID != "chaintest-primary" || a.Status != 503 ||
+		a.Answered {
+		t.Errorf("unexpected first attempt: %+v", a)
+	}
+	if a := report.Attempts[1]; a.ModelID != "chaintest-fallback" || !a.Answered {
+		t.Errorf("unexpected second attempt: %+v", a)
+	}
+
+	var buf bytes.Buffer
+	if err := writeChainTestReport(&buf, report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"chaintest-primary",
+		"failed: server_error",
+		"Answered by chaintest-mock (chaintest-fallback) with status 200",
+		"Response: ",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestWriteChainTestReportFailure(t *testing.T) {
+	report := chainTestReport{
+		Attempts: []hydra.Attempt{
+			{ModelID: "primary", Provider: "p", Err: errors.New("connection refused")},
+		},
+		Err: errors.New("all models failed"),
+	}
+	var buf bytes.Buffer
+	if err := writeChainTestReport(&buf, report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"failed: connection refused", "No answer after"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := excerpt("  one\ntwo  ", 10); got != "one two" {
+		t.Errorf("expected joined text, got %q", got)
+	}
+	if got := excerpt("héllo world", 5); got != "héllo…" {
+		t.Errorf("expected cut text, got %q", got)
+	}
+}
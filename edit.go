@@ -29,7 +29,11 @@ func runEdit(_ *cobra.Command, _ []string) {
 		if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
 			logger.Fatalf("failed to create config directory: %v", err)
 		}
-		if err := os.WriteFile(configPath, []byte(defaultConfigTemplate), 0o644); err != nil {
+		template := defaultConfigTemplate
+		if profile != "" && cfgFile == "" {
+			template = profileTemplate(template)
+		}
+		if err := os.WriteFile(configPath, []byte(template), 0o644); err != nil {
 			logger.Fatalf("failed to create default config: %v", err)
 		}
 	}
@@ -72,9 +76,8 @@ func getConfigPath() string {
 	if cfgFile != "" {
 		return cfgFile
 	}
-	home, err := os.UserHomeDir()
-	if err != nil {
-		logger.Fatalf("failed to get home directory: %v", err)
+	if profile != "" {
+		return profileConfigPath(profile)
 	}
-	return filepath.Join(home, ".config", "hydrallm", "config.toml")
+	return filepath.Join(configDir(), "config.toml")
 }
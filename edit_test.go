@@ -33,6 +33,17 @@ func TestGetConfigPath(t *testing.T) {
 			t.Errorf("expected %q, got %q", expected, got)
 		}
 	})
+
+	t.Run("profile config path", func(t *testing.T) {
+		cfgFile = ""
+		profile = "work"
+		defer func() { profile = "" }()
+		_ = os.Setenv("HOME", "/dummy/home")
+		expected := filepath.Join("/dummy/home", ".config", "hydrallm", "profiles", "work.toml")
+		if got := getConfigPath(); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
 }
 
 func TestNewEditCmd(t *testing.T) {
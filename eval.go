@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// evalOptions holds the flags of the eval command.
+type evalOptions struct {
+	suite    string
+	listener string
+}
+
+// EvalSuite is a set of prompts with expected-answer checks.
+type EvalSuite struct {
+	Listener string     `yaml:"listener"` // Defaults to the first listener
+	Path     string     `yaml:"path"`     // Defaults to the listener type's path
+	Cases    []EvalCase `yaml:"cases"`
+}
+
+// EvalCase is one prompt and the checks its answer must pass.
+// Request, when set, is sent as the request body instead of a body built from Prompt.
+type EvalCase struct {
+	Name    string         `yaml:"name"`
+	Prompt  string         `yaml:"prompt"`
+	Request map[string]any `yaml:"request"`
+	Expect  EvalExpect     `yaml:"expect"`
+
+	re *regexp.Regexp
+}
+
+// EvalExpect lists the checks applied to an answer. All set checks must pass.
+type EvalExpect struct {
+	Contains string `yaml:"contains"`
+	Regex    string `yaml:"regex"`
+	JSON     bool   `yaml:"json"` // Answer must be valid JSON
+}
+
+// evalResult summarizes the results of one model.
+type evalResult struct {
+	Model   string
+	Passed  int
+	Failed  int
+	Errors  int
+	Latency time.Duration // Total latency of answered cases
+}
+
+func newEvalCmd() *cobra.Command {
+	var opts evalOptions
+	cmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Run a prompt suite against each model of a listener's fallback chain",
+		Run: func(_ *cobra.Command, _ []string) {
+			runEval(opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.suite, "suite", "s", "", "YAML file with the prompts and checks")
+	cmd.Flags().StringVar(&opts.listener, "listener", "", "listener name (overrides the suite)")
+	_ = cmd.MarkFlagRequired("suite")
+	return cmd
+}
+
+func runEval(opts evalOptions) {
+	cfg, err := hydra.LoadConfig()
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+
+	suite, err := loadEvalSuite(opts.suite)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if opts.listener != "" {
+		suite.Listener = opts.listener
+	}
+
+	l, err := selectListener(cfg, suite.Listener)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if suite.Path == "" {
+		suite.Path = l.DefaultPath()
+	}
+	if suite.Path == "" {
+		logger.Fatalf("listener %q: path is required in the suite for %s listeners", l.Name, l.ConfigType)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("running eval", "listener", l.Name, "cases", len(suite.Cases))
+	results := make([]evalResult, 0, len(l.ResolvedModels))
+	for _, m := range l.ResolvedModels {
+		result, err := evalModel(ctx, cfg, l, m, suite, logger)
+		if err != nil {
+			logger.Fatalf("eval failed: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	if err := writeEvalReport(os.Stdout, results); err != nil {
+		logger.Fatalf("failed to write report: %v", err)
+	}
+}
+
+// loadEvalSuite reads and validates a suite file.
+func loadEvalSuite(path string) (*EvalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+	var suite EvalSuite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse suite: %w", err)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, errors.New("suite has no cases")
+	}
+
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		if c.Prompt == "" && c.Request == nil {
+			return nil, fmt.Errorf("%s: prompt or request is required", c.Name)
+		}
+		if c.Expect.Regex != "" {
+			c.re, err = regexp.Compile(c.Expect.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid regex: %w", c.Name, err)
+			}
+		}
+	}
+	return &suite, nil
+}
+
+// evalModel runs every case against a single model, without retries or fallback.
+func evalModel(
+	ctx context.Context,
+	cfg *hydra.Config,
+	l *hydra.Listener,
+	m hydra.Model,
+	suite *EvalSuite,
+	logger *log.Logger,
+) (evalResult, error) {
+	m.Attempts = 1
+	retry := cfg.ListenerRetry(l)
+	retry.MaxCycles = 1
+	transport := hydra.NewRetryTransport([]hydra.Model{m}, cfg.Providers, retry, cfg.Log, logger)
+
+	result := evalResult{Model: m.ID}
+	for _, c := range suite.Cases {
+		body, err := evalRequestBody(c, l.ConfigType)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", c.Name, err)
+		}
+
+		start := time.Now()
+		answer, err := sendEvalRequest(ctx, transport, suite.Path, body, l.ConfigType)
+		latency := time.Since(start)
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if err != nil {
+			result.Errors++
+			logger.Warn("eval request failed", "model", m.ID, "case", c.Name, "error", err)
+			continue
+		}
+		result.Latency += latency
+
+		if reason := checkEvalAnswer(c, answer); reason != "" {
+			result.Failed++
+			logger.Info("eval case failed", "model", m.ID, "case", c.Name, "reason", reason)
+			continue
+		}
+		result.Passed++
+	}
+	return result, nil
+}
+
+// evalRequestBody returns the case's request body, building a single-turn
+// request in the listener's API format from the prompt when none is given.
+func evalRequestBody(c EvalCase, listenerType string) ([]byte, error) {
+	if c.Request != nil {
+		return json.Marshal(c.Request)
+	}
+	if listenerType == "gemini" {
+		return json.Marshal(map[string]any{
+			"contents": []map[string]any{
+				{"role": "user", "parts": []map[string]string{{"text": c.Prompt}}},
+			},
+		})
+	}
+	req := map[string]any{
+		"messages": []map[string]any{{"role": "user", "content": c.Prompt}},
+	}
+	if listenerType == "anthropic" || listenerType == "bedrock" {
+		req["max_tokens"] = 1024
+	}
+	if listenerType == "bedrock" {
+		req["anthropic_version"] = "bedrock-2023-05-31"
+	}
+	return json.Marshal(req)
+}
+
+// sendEvalRequest sends one request through transport and returns the answer text.
+func sendEvalRequest(
+	ctx context.Context,
+	transport http.RoundTripper,
+	path string,
+	body []byte,
+	listenerType string,
+) (string, error) {
+	req, err := newEvalRequest(ctx, path, body)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return extractAnswer(respBody, listenerType), nil
+}
+
+// newEvalRequest returns a JSON POST request of body to path, to be sent
+// through a transport rather than a listener.
+func newEvalRequest(ctx context.Context, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		"http://hydrallm-eval"+path,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// extractAnswer returns the generated text of a response in the listener's
+// API format. Unknown formats are returned as-is.
+func extractAnswer(body []byte, listenerType string) string {
+	switch listenerType {
+	case "openai":
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if json.Unmarshal(body, &resp) == nil && len(resp.Choices) > 0 {
+			return resp.Choices[0].Message.Content
+		}
+	case "anthropic", "bedrock":
+		var resp struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		}
+		if json.Unmarshal(body, &resp) == nil && len(resp.Content) > 0 {
+			var b strings.Builder
+			for _, block := range resp.Content {
+				if block.Type == "text" {
+					b.WriteString(block.Text)
+				}
+			}
+			return b.String()
+		}
+	case "gemini":
+		var resp struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text    string `json:"text"`
+						Thought bool   `json:"thought"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+		}
+		if json.Unmarshal(body, &resp) == nil && len(resp.Candidates) > 0 {
+			var b strings.Builder
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if !part.Thought {
+					b.WriteString(part.Text)
+				}
+			}
+			return b.String()
+		}
+	}
+	return string(body)
+}
+
+// checkEvalAnswer returns why an answer fails the case's checks, or an empty
+// string when it passes.
+func checkEvalAnswer(c EvalCase, answer string) string {
+	if c.Expect.Contains != "" && !strings.Contains(answer, c.Expect.Contains) {
+		return fmt.Sprintf("answer does not contain %q", c.Expect.Contains)
+	}
+	if c.re != nil && !c.re.MatchString(answer) {
+		return fmt.Sprintf("answer does not match %q", c.Expect.Regex)
+	}
+	if c.Expect.JSON && !json.Valid([]byte(strings.TrimSpace(answer))) {
+		return "answer is not valid JSON"
+	}
+	return ""
+}
+
+// writeEvalReport prints per-model pass rates and mean latency.
+func writeEvalReport(w io.Writer, results []evalResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "MODEL\tPASSED\tFAILED\tERRORS\tPASS RATE\tMEAN LATENCY")
+	for _, r := range results {
+		total := r.Passed + r.Failed + r.Errors
+		var rate float64
+		if total > 0 {
+			rate = 100 * float64(r.Passed) / float64(total)
+		}
+		var mean time.Duration
+		if answered := r.Passed + r.Failed; answered > 0 {
+			mean = (r.Latency / time.Duration(answered)).Round(time.Millisecond)
+		}
+		_, _ = fmt.Fprintf(
+			tw,
+			"%s\t%d\t%d\t%d\t%.1f%%\t%s\n",
+			r.Model,
+			r.Passed,
+			r.Failed,
+			r.Errors,
+			rate,
+			mean,
+		)
+	}
+	return tw.Flush()
+}
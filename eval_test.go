@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/fang2hou/hydrallm/hydra"
+)
+
+func TestNewEvalCmd(t *testing.T) {
+	cmd := newEvalCmd()
+	if cmd.Use != "eval" {
+		t.Errorf("expected Use 'eval', got %q", cmd.Use)
+	}
+	if cmd.Flags().Lookup("suite") == nil {
+		t.Error("expected --suite flag")
+	}
+}
+
+func TestLoadEvalSuite(t *testing.T) {
+	t.Run("valid suite", func(t *testing.T) {
+		suite, err := loadEvalSuite(writeTempSuite(t, `
+listener: main
+cases:
+  - name: capital
+    prompt: What is the capital of France?
+    expect:
+      contains: Paris
+  - request:
+      messages: [{role: user, content: hi}]
+    expect:
+      regex: "(?i)hello"
+`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if suite.Listener != "main" || len(suite.Cases) != 2 {
+			t.Fatalf("unexpected suite: %+v", suite)
+		}
+		if suite.Cases[1].Name != "case 2" || suite.Cases[1].re == nil {
+			t.Errorf("expected default name and compiled regex, got %+v", suite.Cases[1])
+		}
+	})
+
+	for name, content := range map[string]string{
+		"no cases":      "cases: []",
+		"no prompt":     "cases:\n  - name: empty",
+		"invalid regex": "cases:\n  - prompt: hi\n    expect:\n      regex: '('",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadEvalSuite(writeTempSuite(t, content)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestCheckEvalAnswer(t *testing.T) {
+	suite, err := loadEvalSuite(writeTempSuite(t, `
+cases:
+  - prompt: p
+    expect: {contains: Paris, regex: "^The"}
+  - prompt: p
+    expect: {json: true}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reason := checkEvalAnswer(suite.Cases[0], "The capital is Paris."); reason != "" {
+		t.Errorf("expected pass, got %q", reason)
+	}
+	if reason := checkEvalAnswer(suite.Cases[0], "It is Paris."); reason == "" {
+		t.Error("expected regex failure")
+	}
+	if reason := checkEvalAnswer(suite.Cases[1], ` {"a":1} `); reason != "" {
+		t.Errorf("expected pass, got %q", reason)
+	}
+	if reason := checkEvalAnswer(suite.Cases[1], "not json"); reason == "" {
+		t.Error("expected JSON failure")
+	}
+}
+
+func writeTempSuite(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write suite: %v", err)
+	}
+	return path
+}
+
+func TestExtractAnswer(t *testing.T) {
+	openai := `{"choices":[{"message":{"role":"assistant","content":"Paris"}}]}`
+	if got := extractAnswer([]byte(openai), "openai"); got != "Paris" {
+		t.Errorf("expected Paris, got %q", got)
+	}
+	anthropic := `{"content":[{"type":"text","text":"Par"},{"type":"text","text":"is"}]}`
+	if got := extractAnswer([]byte(anthropic), "anthropic"); got != "Paris" {
+		t.Errorf("expected Paris, got %q", got)
+	}
+	gemini := `{"candidates":[{"content":{"parts":[{"text":"hmm","thought":true},{"text":"Paris"}]}}]}`
+	if got := extractAnswer([]byte(gemini), "gemini"); got != "Paris" {
+		t.Errorf("expected Paris, got %q", got)
+	}
+	if got := extractAnswer([]byte("raw"), "template"); got != "raw" {
+		t.Errorf("expected raw body, got %q", got)
+	}
+}
+
+func TestEvalModel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		answer := "Paris"
+		if req.Model == "weak" {
+			answer = "London"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"` + answer + `"}}]}`))
+	}))
+	defer ts.Close()
+
+	parsed, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &hydra.Config{
+		Retry: hydra.RetryConfig{MaxCycles: 3, DefaultTimeout: time.Second},
+		Providers: map[string]hydra.Provider{
+			"mock": {URL: ts.URL, ParsedURL: parsed},
+		},
+	}
+	l := &hydra.Listener{Name: "main", ConfigType: "openai"}
+	suite := &EvalSuite{
+		Path: "/v1/chat/completions",
+		Cases: []EvalCase{
+			{Name: "capital", Prompt: "capital of France?", Expect: EvalExpect{Contains: "Paris"}},
+		},
+	}
+
+	model := func(name string) hydra.Model {
+		return hydra.Model{
+			ID:       name,
+			Provider: "mock",
+			Model:    name,
+			Type:     "openai",
+			Timeout:  time.Second,
+		}
+	}
+	strong, weak := model("strong"), model("weak")
+
+	var results []evalResult
+	for _, m := range []hydra.Model{strong, weak} {
+		r, err := evalModel(context.Background(), cfg, l, m, suite, log.New(io.Discard))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results = append(results, r)
+	}
+
+	if results[0].Passed != 1 || results[0].Failed != 0 {
+		t.Errorf("expected strong model to pass, got %+v", results[0])
+	}
+	if results[1].Passed != 0 || results[1].Failed != 1 {
+		t.Errorf("expected weak model to fail, got %+v", results[1])
+	}
+
+	var buf bytes.Buffer
+	if err := writeEvalReport(&buf, results); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"MODEL", "strong", "100.0%", "weak", "0.0%"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+// eventsOptions holds the flags of the events command.
+type eventsOptions struct {
+	provider string
+	kind     string
+	since    time.Duration
+	limit    int
+}
+
+func newEventsCmd() *cobra.Command {
+	var opts eventsOptions
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show recent failover events of a running instance",
+		Run: func(_ *cobra.Command, _ []string) {
+			runEvents(opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.provider, "provider", "", "only events of this provider")
+	cmd.Flags().StringVar(&opts.kind, "kind", "", "only fallback, saturated, evicted, or recovered")
+	cmd.Flags().DurationVar(&opts.since, "since", 0, "only events within this duration")
+	cmd.Flags().IntVar(&opts.limit, "limit", 50, "show at most this many of the newest events")
+	return cmd
+}
+
+func runEvents(opts eventsOptions) {
+	cfg, err := hydra.LoadConfig()
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Admin.Port == 0 {
+		logger.Fatal("events are served by the admin API, which needs admin.port")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	events, err := fetchEvents(ctx, "http://"+cfg.Admin.Address(), opts)
+	if err != nil {
+		logger.Fatalf("failed to fetch events: %v", err)
+	}
+	if err := writeEventTimeline(os.Stdout, events); err != nil {
+		logger.Fatalf("failed to write events: %v", err)
+	}
+}
+
+// fetchEvents requests the failover events matching opts from the admin API
+// at base.
+func fetchEvents(
+	ctx context.Context,
+	base string,
+	opts eventsOptions,
+) ([]hydra.FailoverEvent, error) {
+	query := url.Values{}
+	if opts.provider != "" {
+		query.Set("provider", opts.provider)
+	}
+	if opts.kind != "" {
+		query.Set("kind", opts.kind)
+	}
+	if opts.since > 0 {
+		query.Set("since", opts.since.String())
+	}
+	if opts.limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.limit))
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		base+"/events?"+query.Encode(),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("admin API returned %s: %s", resp.Status, body)
+	}
+
+	var out struct {
+		Events []hydra.FailoverEvent `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Events, nil
+}
+
+// writeEventTimeline prints one line per event, oldest first.
+func writeEventTimeline(w io.Writer, events []hydra.FailoverEvent) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TIME\tKIND\tPROVIDER\tMODEL\tLISTENER\tSKIPPED\tCAUSE")
+	for _, e := range events {
+		skipped := "-"
+		if e.SkippedMS > 0 {
+			skipped = (time.Duration(e.SkippedMS) * time.Millisecond).String()
+		}
+		_, _ = fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format(time.DateTime),
+			e.Kind,
+			e.Provider,
+			cmp.Or(e.Model, "-"),
+			cmp.Or(e.Listener, "-"),
+			skipped,
+			e.Cause,
+		)
+	}
+	return tw.Flush()
+}
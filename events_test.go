@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+)
+
+func TestNewEventsCmd(t *testing.T) {
+	cmd := newEventsCmd()
+	if cmd.Use != "events" {
+		t.Errorf("expected Use 'events', got %q", cmd.Use)
+	}
+	for _, name := range []string{"provider", "kind", "since", "limit"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("expected --%s flag", name)
+		}
+	}
+}
+
+func TestFetchEvents(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		_, _ = w.Write([]byte(`{"events":[{"kind":"evicted","provider":"openai"}]}`))
+	}))
+	defer ts.Close()
+
+	opts := eventsOptions{provider: "openai", since: time.Hour, limit: 10}
+	events, err := fetchEvents(context.Background(), ts.URL, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Kind != hydra.EventEvicted {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if query != "limit=10&provider=openai&since=1h0m0s" {
+		t.Errorf("unexpected query %q", query)
+	}
+}
+
+func TestWriteEventTimeline(t *testing.T) {
+	events := []hydra.FailoverEvent{
+		{
+			Time:      time.Now(),
+			Kind:      hydra.EventSaturated,
+			Provider:  "anthropic",
+			Cause:     "rate_limited",
+			SkippedMS: 30000,
+		},
+		{
+			Time:     time.Now(),
+			Kind:     hydra.EventFallback,
+			Provider: "openai",
+			Model:    "gpt",
+			Listener: "main",
+		},
+	}
+
+	var out bytes.Buffer
+	if err := writeEventTimeline(&out, events); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "30s") || !strings.Contains(out.String(), "rate_limited") {
+		t.Errorf("unexpected timeline:\n%s", out.String())
+	}
+}
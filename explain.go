@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+// explainOptions holds the flags of the explain command.
+type explainOptions struct {
+	listener string
+	body     string
+	path     string
+	headers  []string
+}
+
+func newExplainCmd() *cobra.Command {
+	var opts explainOptions
+	cmd := &cobra.Command{
+		Use:   "explain",
+		Short: "Show the upstream requests a listener would make for a request, without sending it",
+		Run: func(_ *cobra.Command, _ []string) {
+			runExplain(opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.listener, "listener", "", "listener name (default is the first)")
+	cmd.Flags().StringVar(&opts.body, "body", "-", "request body file, - for stdin")
+	cmd.Flags().StringVar(&opts.path, "path", "", "request path (default is the API type's)")
+	cmd.Flags().StringArrayVarP(&opts.headers, "header", "H", nil, "request header, Name: value")
+	return cmd
+}
+
+func runExplain(opts explainOptions) {
+	cfg, err := hydra.LoadConfig()
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+	if len(cfg.Listeners) == 0 {
+		logger.Fatal("no listeners configured")
+	}
+	l, err := selectListener(cfg, opts.listener)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	path := opts.path
+	if path == "" {
+		path = l.DefaultPath()
+	}
+	if path == "" {
+		logger.Fatalf("--path is required for %s listeners", l.ConfigType)
+	}
+
+	var body []byte
+	if opts.body == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(opts.body)
+	}
+	if err != nil {
+		logger.Fatalf("failed to read body: %v", err)
+	}
+	req, err := newExplainRequest(path, body, opts.headers)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	retry := cfg.ListenerRetry(l)
+	transport := hydra.NewRetryTransport(nil, cfg.Providers, retry, cfg.Log, logger)
+	transport.Reload(l, cfg.Providers, retry)
+	e, err := transport.Explain(req)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if err := writeExplanation(os.Stdout, e); err != nil {
+		logger.Fatalf("failed to write explanation: %v", err)
+	}
+}
+
+// newExplainRequest builds the client request to explain, with headers given
+// as "Name: value".
+func newExplainRequest(path string, body []byte, headers []string) (*http.Request, error) {
+	req, err := newEvalRequest(context.Background(), path, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name: value", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return req, nil
+}
+
+// writeExplanation prints the route taken and each upstream request in the
+// order the models would be tried.
+func writeExplanation(w io.Writer, e *hydra.Explanation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "listener %s\n", e.Listener)
+	if e.Rule != "" {
+		fmt.Fprintf(&b, "route rule %s\n", e.Rule)
+	}
+	if e.Variant != "" {
+		fmt.Fprintf(&b, "experiment variant %s\n", e.Variant)
+	}
+	switch {
+	case e.Rejected != 0:
+		fmt.Fprintf(&b, "rejected with status %d, no upstream request\n", e.Rejected)
+	case len(e.Refused) > 0:
+		fmt.Fprintf(
+			&b,
+			"rejected with status 400, no model may be sent tools: %s\n",
+			strings.Join(e.Refused, ", "),
+		)
+	case len(e.Attempts) == 0:
+		b.WriteString("no model serves the request\n")
+	}
+
+	for i, a := range e.Attempts {
+		fmt.Fprintf(
+			&b,
+			"\n%d. %s (provider %s, attempts %d)\n",
+			i+1,
+			a.Model,
+			a.Provider,
+			a.Attempts,
+		)
+		if a.Err != nil {
+			fmt.Fprintf(&b, "   error: %v\n", a.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "   %s %s\n", a.Method, a.URL)
+		fmt.Fprintf(&b, "   auth: %s\n", a.Auth)
+		for _, name := range slices.Sorted(maps.Keys(a.Header)) {
+			for _, value := range a.Header[name] {
+				fmt.Fprintf(&b, "   %s: %s\n", name, value)
+			}
+		}
+		body := bytes.TrimSpace(a.Body)
+		var indented bytes.Buffer
+		if json.Indent(&indented, body, "   ", "  ") == nil {
+			body = indented.Bytes()
+		}
+		fmt.Fprintf(&b, "   %s\n", body)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
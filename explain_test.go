@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fang2hou/hydrallm/hydra"
+)
+
+func TestNewExplainCmd(t *testing.T) {
+	cmd := newExplainCmd()
+	if cmd.Use != "explain" {
+		t.Errorf("expected Use 'explain', got %q", cmd.Use)
+	}
+	for _, name := range []string{"listener", "body", "path", "header"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("expected --%s flag", name)
+		}
+	}
+}
+
+func TestNewExplainRequest(t *testing.T) {
+	req, err := newExplainRequest("/v1/messages", []byte(`{}`), []string{"X-Team: infra"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.URL.Path != "/v1/messages" || req.Header.Get("X-Team") != "infra" {
+		t.Errorf("unexpected request: %s %v", req.URL.Path, req.Header)
+	}
+	if _, err := newExplainRequest("/v1/messages", nil, []string{"X-Team"}); err == nil {
+		t.Error("expected error for a header without a value")
+	}
+}
+
+func TestWriteExplanation(t *testing.T) {
+	e := &hydra.Explanation{
+		Listener: "main",
+		Rule:     "batch-jobs",
+		Attempts: []hydra.ExplainedAttempt{
+			{
+				Model:    "gpt",
+				Provider: "openai",
+				Attempts: 2,
+				Method:   "POST",
+				URL:      "https://api.openai.com/v1/chat/completions",
+				Auth:     "api_key as Authorization: Bearer",
+				Header:   http.Header{"Authorization": {"xxxxx"}},
+				Body:     []byte(`{"model":"gpt-4o"}`),
+			},
+			{Model: "broken", Provider: "missing", Err: errors.New(`provider "missing" not found`)},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := writeExplanation(&out, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"route rule batch-jobs",
+		"1. gpt (provider openai, attempts 2)",
+		"POST https://api.openai.com/v1/chat/completions",
+		"Authorization: xxxxx",
+		`"model": "gpt-4o"`,
+		`error: provider "missing" not found`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in explanation:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	rejected := &hydra.Explanation{Listener: "main", Rejected: http.StatusForbidden}
+	if err := writeExplanation(&out, rejected); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "rejected with status 403") {
+		t.Errorf("unexpected explanation of a rejection:\n%s", out.String())
+	}
+}
@@ -0,0 +1,231 @@
+package hydra
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log formats for the process log.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// requestIDHeader carries the request ID to upstreams and back to clients.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDContextKey holds the request ID in a request context.
+type requestIDContextKey struct{}
+
+// accessRecordContextKey holds the *accessRecord of a request in its context.
+type accessRecordContextKey struct{}
+
+// requestID returns the ID assigned to the request, or empty if none.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random 32 character hex request ID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// accessRecord collects what the transport did for a request, for the access
+// log line written when the request completes.
+type accessRecord struct {
+	mu        sync.Mutex
+	provider  string
+	model     string
+	attempts  int
+	upstream  time.Duration
+	streaming bool
+	variant   string
+}
+
+// set records the model that served the request. Safe to call on a nil record.
+func (r *accessRecord) set(
+	model Model,
+	attempts int,
+	upstream time.Duration,
+	streaming bool,
+	variant string,
+) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.provider = model.Provider
+	r.model = model.Model
+	r.attempts = attempts
+	r.upstream = upstream
+	r.streaming = streaming
+	r.variant = variant
+}
+
+// recordAccess stores the outcome of a request in its access record.
+// Continuations are part of the request they continue and are not recorded.
+func recordAccess(
+	ctx context.Context,
+	model Model,
+	attempts int,
+	upstream time.Duration,
+	streaming bool,
+) {
+	if ctx.Value(continuationContextKey{}) != nil {
+		return
+	}
+	record, _ := ctx.Value(accessRecordContextKey{}).(*accessRecord)
+	record.set(model, attempts, upstream, streaming, experimentVariant(ctx))
+}
+
+// accessEntry is one line of the access log.
+type accessEntry struct {
+	Time              time.Time `json:"time"`
+	RequestID         string    `json:"request_id"`
+	Listener          string    `json:"listener"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	Status            int       `json:"status"`
+	Provider          string    `json:"provider,omitempty"`
+	Model             string    `json:"model,omitempty"`
+	Attempts          int       `json:"attempts"`
+	Streaming         bool      `json:"streaming"`
+	Variant           string    `json:"variant,omitempty"` // Experiment variant
+	LatencyMs         int64     `json:"latency_ms"`
+	UpstreamLatencyMs int64     `json:"upstream_latency_ms"`
+}
+
+// accessLog writes JSON access log lines. A nil accessLog writes nothing.
+type accessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// openAccessLog opens the access log at path for appending. An empty path
+// disables the access log and "-" writes to standard output.
+func openAccessLog(path string) (*accessLog, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		return &accessLog{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %w", err)
+	}
+	return &accessLog{w: f}, nil
+}
+
+// write appends an entry as one JSON line.
+func (a *accessLog) write(entry accessEntry) {
+	if a == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		logger.Warn("failed to write access log", "error", err)
+	}
+}
+
+// wrap assigns every request served by h an ID and logs it once complete,
+// counting it in the live traffic of the admin UI.
+// A valid X-Request-ID from the client is kept; otherwise a new ID is
+// generated. The ID is sent upstream and echoed in the response.
+func (a *accessLog) wrap(listener string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// Client IDs follow the rules for conversation IDs
+		id := r.Header.Get(requestIDHeader)
+		if !isValidConversationID(id) {
+			id = newRequestID()
+		}
+		record := &accessRecord{}
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		ctx = context.WithValue(ctx, accessRecordContextKey{}, record)
+		r = r.Clone(ctx)
+		r.Header.Set(requestIDHeader, id)
+
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK, requestID: id}
+		h.ServeHTTP(sw, r)
+
+		record.mu.Lock()
+		defer record.mu.Unlock()
+		liveRequests.record(LiveRequest{
+			Time:     time.Now(),
+			Listener: listener,
+			Path:     r.URL.Path,
+			Status:   sw.status,
+			Provider: record.provider,
+			Model:    record.model,
+			Attempts: record.attempts,
+		})
+		a.write(accessEntry{
+			Time:              start.UTC(),
+			RequestID:         id,
+			Listener:          listener,
+			Method:            r.Method,
+			Path:              r.URL.Path,
+			Status:            sw.status,
+			Provider:          record.provider,
+			Model:             record.model,
+			Attempts:          record.attempts,
+			Streaming:         record.streaming,
+			Variant:           record.variant,
+			LatencyMs:         time.Since(start).Milliseconds(),
+			UpstreamLatencyMs: record.upstream.Milliseconds(),
+		})
+	})
+}
+
+// statusResponseWriter records the status code sent to the client and sets
+// the request ID header, replacing any request ID copied from the upstream.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	requestID   string
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+		w.Header().Set(requestIDHeader, w.requestID)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush flushes the underlying writer so streams are not delayed.
+func (w *statusResponseWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,136 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestAccessLogWrap(t *testing.T) {
+	var out bytes.Buffer
+	access := &accessLog{w: &out}
+	var gotID string
+	handler := access.wrap("main", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get(requestIDHeader)
+		recordAccess(
+			r.Context(),
+			Model{Provider: "p1", Model: "gpt-4o"},
+			2,
+			150*time.Millisecond,
+			true,
+		)
+		// A request ID from the upstream is replaced
+		w.Header().Set(requestIDHeader, "upstream-id")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name     string
+		clientID string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"client id kept", "trace-123", true},
+		{"invalid client id replaced", "bad id/..", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.clientID != "" {
+				req.Header.Set(requestIDHeader, tt.clientID)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(requestIDHeader)
+			if id != gotID || id == "upstream-id" {
+				t.Errorf("expected echoed ID %q to match upstream ID %q", id, gotID)
+			}
+			if tt.keep != (id == tt.clientID) {
+				t.Errorf("unexpected request ID %q for client ID %q", id, tt.clientID)
+			}
+
+			var entry accessEntry
+			if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+				t.Fatalf("invalid access log line %q: %v", out.String(), err)
+			}
+			if entry.RequestID != id || entry.Listener != "main" || entry.Status != http.StatusTeapot ||
+				entry.Provider != "p1" || entry.Model != "gpt-4o" || entry.Attempts != 2 ||
+				!entry.Streaming || entry.UpstreamLatencyMs != 150 {
+				t.Errorf("unexpected access log entry: %+v", entry)
+			}
+		})
+	}
+}
+
+func TestAccessLogWrap_Disabled(t *testing.T) {
+	var access *accessLog
+	handler := access.wrap("main", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if len(rec.Header().Get(requestIDHeader)) != 32 {
+		t.Errorf("expected a generated request ID, got %q", rec.Header().Get(requestIDHeader))
+	}
+}
+
+func TestTransport_RoundTrip_RecordsAccess(t *testing.T) {
+	var gotID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get(requestIDHeader)
+		if r.Header.Get("Authorization") == "Bearer bad" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{ID: "m1", Provider: "bad", Model: "a", Type: "openai", Attempts: 1, Timeout: time.Second},
+		{ID: "m2", Provider: "good", Model: "b", Type: "openai", Attempts: 1, Timeout: time.Second},
+	}
+	providers := map[string]Provider{
+		"bad":  {URL: ts.URL, APIKey: "bad", ParsedURL: mustParseURL(ts.URL)},
+		"good": {URL: ts.URL, APIKey: "good", ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	record := &accessRecord{}
+	ctx := context.WithValue(context.Background(), accessRecordContextKey{}, record)
+	req, _ := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"x"}`)),
+	)
+	req.Header.Set(requestIDHeader, "trace-1")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if gotID != "trace-1" {
+		t.Errorf("expected request ID sent upstream, got %q", gotID)
+	}
+	if record.provider != "good" || record.model != "b" || record.attempts != 2 ||
+		record.streaming {
+		t.Errorf("unexpected access record: %+v", record)
+	}
+}
@@ -0,0 +1,139 @@
+package hydra
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// modelStatsSaveInterval is how often model statistics are written to the
+// state file.
+const modelStatsSaveInterval = 10 * time.Second
+
+// adaptiveMinAttempts is the number of attempts before the adaptive strategy
+// ranks a model by its statistics.
+const adaptiveMinAttempts = 3
+
+// adaptiveMinSuccessRate bounds the latency penalty of a model that keeps
+// failing, so it still ranks by its latency among other failing models.
+const adaptiveMinSuccessRate = 0.05
+
+// hasAdaptiveRouting reports whether any listener of cfg uses the adaptive
+// strategy, whose statistics are kept across restarts.
+func hasAdaptiveRouting(cfg *Config) bool {
+	return slices.ContainsFunc(cfg.Listeners, func(l Listener) bool {
+		return l.Strategy == strategyAdaptive
+	})
+}
+
+// adaptiveOrder orders models for the adaptive strategy. Models with fewer
+// than adaptiveMinAttempts recorded attempts lead in configured order so they
+// get measured; the others follow by their expected latency per success, the
+// moving average latency divided by the moving average success rate.
+func adaptiveOrder(models []Model) []Model {
+	var unmeasured, ranked []Model
+	cost := make(map[string]float64, len(models))
+	for _, m := range models {
+		h := modelHealth.get(m.ID)
+		if h.Attempts < adaptiveMinAttempts {
+			unmeasured = append(unmeasured, m)
+			continue
+		}
+		cost[m.ID] = h.LatencyMS / max(1-h.ErrorRate, adaptiveMinSuccessRate)
+		ranked = append(ranked, m)
+	}
+	slices.SortStableFunc(ranked, func(a, b Model) int {
+		return cmp.Compare(cost[a.ID], cost[b.ID])
+	})
+	return append(unmeasured, ranked...)
+}
+
+// open loads the statistics saved in the state file at path, which need not
+// exist, and saves to it from then on.
+func (h *healthTracker) open(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read model stats: %w", err)
+	}
+	models := make(map[string]ModelHealth)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &models); err != nil {
+			return fmt.Errorf("failed to parse model stats %s: %w", path, err)
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Attempts made before the state was loaded count as well
+	for id, m := range h.models {
+		models[id] = m
+	}
+	h.models = models
+	h.path = path
+	return nil
+}
+
+// save writes the statistics to the state file if they changed. The file is
+// replaced atomically.
+func (h *healthTracker) save() error {
+	h.mu.Lock()
+	if h.path == "" || !h.dirty {
+		h.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(h.models, "", "  ")
+	path := h.path
+	h.dirty = false
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".model-stats-*")
+	if err != nil {
+		return fmt.Errorf("failed to save model stats: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save model stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save model stats: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save model stats: %w", err)
+	}
+	return nil
+}
+
+// persist saves the statistics every interval until done is closed, and once
+// more before returning.
+func (h *healthTracker) persist(
+	done <-chan struct{},
+	interval time.Duration,
+	logger *log.Logger,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			if err := h.save(); err != nil {
+				logger.Warn("failed to save model stats", "error", err)
+			}
+			return
+		}
+		if err := h.save(); err != nil {
+			logger.Warn("failed to save model stats", "error", err)
+		}
+	}
+}
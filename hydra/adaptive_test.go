@@ -0,0 +1,93 @@
+package hydra
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOrderModelsAdaptive(t *testing.T) {
+	modelHealth = newHealthTracker()
+	t.Cleanup(func() { modelHealth = newHealthTracker() })
+
+	for range adaptiveMinAttempts {
+		modelHealth.recordSuccess("fast", 200, 100*time.Millisecond)
+		modelHealth.recordSuccess("slow", 200, 400*time.Millisecond)
+		modelHealth.recordFailure("flaky", 503, "overloaded")
+		modelHealth.recordSuccess("flaky", 200, 50*time.Millisecond)
+	}
+	modelHealth.recordSuccess("new", 200, time.Second)
+	models := []Model{{ID: "slow"}, {ID: "flaky"}, {ID: "fast"}, {ID: "new"}}
+
+	// flaky is fastest but fails about half its attempts
+	got := modelIDs(orderModels(strategyAdaptive, models, 0))
+	if !slices.Equal(got, []string{"new", "fast", "flaky", "slow"}) {
+		t.Errorf("expected [new fast flaky slow], got %v", got)
+	}
+
+	for range 10 {
+		modelHealth.recordFailure("fast", 0, "timeout")
+	}
+	got = modelIDs(orderModels(strategyAdaptive, models, 0))
+	if got[len(got)-1] != "fast" {
+		t.Errorf("expected a failing model to move last, got %v", got)
+	}
+}
+
+func TestHealthTracker_ErrorRate(t *testing.T) {
+	h := newHealthTracker()
+	h.recordFailure("m", 500, "boom")
+	if got := h.get("m").ErrorRate; got != 1 {
+		t.Errorf("expected the first sample to set the error rate, got %v", got)
+	}
+	h.recordSuccess("m", 200, time.Millisecond)
+	if got := h.get("m").ErrorRate; got != 1-latencySmoothing {
+		t.Errorf("expected a smoothed error rate, got %v", got)
+	}
+}
+
+func TestHealthTracker_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model_stats.json")
+
+	tracker := newHealthTracker()
+	if err := tracker.open(path); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	tracker.recordSuccess("m1", 200, 120*time.Millisecond)
+	tracker.recordFailure("m1", 503, "overloaded")
+	if err := tracker.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	restarted := newHealthTracker()
+	restarted.recordSuccess("m2", 200, time.Millisecond)
+	if err := restarted.open(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if m := restarted.get("m1"); m.Attempts != 2 || m.LatencyMS != 120 || m.ErrorRate == 0 {
+		t.Errorf("expected saved stats after restart, got %+v", m)
+	}
+	if restarted.get("m2").Attempts != 1 {
+		t.Error("expected stats recorded before loading to be kept")
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newHealthTracker().open(path); err == nil {
+		t.Error("expected an error for a corrupt state file")
+	}
+}
+
+func TestHasAdaptiveRouting(t *testing.T) {
+	cfg := &Config{Listeners: []Listener{{Strategy: strategyPriority}}}
+	if hasAdaptiveRouting(cfg) {
+		t.Error("expected no adaptive routing")
+	}
+	cfg.Listeners = append(cfg.Listeners, Listener{Strategy: strategyAdaptive})
+	if !hasAdaptiveRouting(cfg) {
+		t.Error("expected adaptive routing")
+	}
+}
@@ -0,0 +1,239 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// serverReady reports whether all listeners are serving and shutdown has not begun.
+var serverReady atomic.Bool
+
+// secretConfigKeys are config keys whose literal values are redacted on /config.
+// Environment variable references ("$NAME") are shown as-is. Credentials in
+// URLs, such as the password of a redis_url, are redacted under any key.
+// Strings expanded from ${VAR} references are shown as written.
+var secretConfigKeys = map[string]bool{
+	"api_key":               true,
+	"aws_access_key_id":     true,
+	"aws_secret_access_key": true,
+	"aws_session_token":     true,
+	"key":                   true,
+}
+
+// newAdminHandler returns the handler for the admin HTTP API.
+// config returns the configuration currently in effect.
+func newAdminHandler(config func() *Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	mux.HandleFunc("GET /readyz", handleReadyz)
+	mux.HandleFunc("GET /metrics", handleMetrics)
+	mux.HandleFunc("GET /status/quota", handleQuotaStatus)
+	mux.HandleFunc("GET /usage", handleUsage)
+	mux.HandleFunc("GET /config", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, redactConfig(config()))
+	})
+	mux.HandleFunc("GET /providers", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"providers": providerStatus(config())})
+	})
+	mux.HandleFunc("GET /events", handleEvents)
+	mux.HandleFunc("GET /drain", handleDrainStatus)
+	mux.HandleFunc("POST /drain", handleDrain)
+	mux.HandleFunc("POST /drain/{listener}", handleDrain)
+	mux.HandleFunc("GET /transcripts/{listener}", handleTranscripts(config))
+	mux.HandleFunc("GET /transcripts/{listener}/{id}", handleTranscripts(config))
+	mux.HandleFunc("DELETE /transcripts/{listener}/{id}", handleTranscripts(config))
+	mux.HandleFunc("GET /broadcast/{listener}", handleBroadcast(config))
+	mux.HandleFunc("GET /broadcast/{listener}/{id}", handleBroadcast(config))
+	mux.HandleFunc("GET /ui", handleUI)
+	mux.HandleFunc("GET /ui/snapshot", handleUISnapshot(config))
+	mux.HandleFunc("GET /ui/stream", handleUIStream(config))
+	return mux
+}
+
+// handleHealthz reports that the process is alive.
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the listeners accept traffic. Draining any
+// listener makes the instance not ready.
+func handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	if !serverReady.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+	if draining := listenerDrains.drainingListeners(); len(draining) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"status":    "draining",
+			"listeners": draining,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// handleDrain drains the listener named in the path, or all listeners.
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	names := listenerDrains.listeners()
+	if name := r.PathValue("listener"); name != "" {
+		names = []string{name}
+	}
+	for _, name := range names {
+		if _, err := listenerDrains.drain(name, logger); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errListenerNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"listeners": listenerDrains.status()})
+}
+
+// handleDrainStatus serves the drain state of every listener.
+func handleDrainStatus(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"listeners": listenerDrains.status()})
+}
+
+// handleMetrics serves metrics in the Prometheus text exposition format.
+func handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WriteText(w); err != nil {
+		logger.Warn("failed to write metrics", "error", err)
+	}
+}
+
+// handleQuotaStatus serves the latest provider quota state as JSON.
+func handleQuotaStatus(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"providers": providerQuotas.snapshot()})
+}
+
+// ProviderStatus is the live state of a provider and its configured models.
+type ProviderStatus struct {
+	URL         string                 `json:"url"`
+	Quota       *ProviderQuota         `json:"quota,omitempty"`
+	HealthCheck *ProviderCheckState    `json:"health_check,omitempty"`
+	Models      map[string]ModelStatus `json:"models"`
+}
+
+// ModelStatus is the live health of a configured model.
+type ModelStatus struct {
+	Model string `json:"model"`
+	Type  string `json:"type"`
+	State string `json:"state"` // ok, failing, saturated, unknown
+	ModelHealth
+}
+
+// providerStatus combines the configured providers and models with their
+// recorded quota and health.
+func providerStatus(cfg *Config) map[string]ProviderStatus {
+	now := time.Now()
+	quotas := providerQuotas.snapshot()
+	checks := providerChecks.snapshot()
+
+	status := make(map[string]ProviderStatus, len(cfg.Providers))
+	for name, p := range cfg.Providers {
+		ps := ProviderStatus{URL: p.URL, Models: make(map[string]ModelStatus)}
+		if q, ok := quotas[name]; ok {
+			ps.Quota = &q
+		}
+		if c, ok := checks[name]; ok {
+			ps.HealthCheck = &c
+		}
+		status[name] = ps
+	}
+	for id, m := range cfg.Models {
+		ps, ok := status[m.Provider]
+		if !ok {
+			continue
+		}
+		health := modelHealth.get(id)
+		ps.Models[id] = ModelStatus{
+			Model:       m.Model,
+			Type:        m.Type,
+			State:       healthState(health, quotas[m.Provider], now),
+			ModelHealth: health,
+		}
+	}
+	return status
+}
+
+// redactConfig renders cfg with its config file key names and secrets redacted.
+func redactConfig(cfg *Config) any {
+	return redactValue(reflect.ValueOf(*cfg), "", cfg.envWritten)
+}
+
+// redactValue converts v into JSON-friendly values keyed by mapstructure tags.
+// Fields without a tag or tagged "-" are runtime state and are omitted.
+// written maps expanded strings to their form in the config file.
+func redactValue(v reflect.Value, key string, written map[string]string) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		for i := range v.NumField() {
+			tag := v.Type().Field(i).Tag.Get("mapstructure")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			out[tag] = redactValue(v.Field(i), tag, written)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = redactValue(iter.Value(), "", written)
+		}
+		return out
+	case reflect.Slice:
+		out := make([]any, v.Len())
+		for i := range v.Len() {
+			out[i] = redactValue(v.Index(i), key, written)
+		}
+		return out
+	case reflect.String:
+		s := v.String()
+		if w, ok := written[s]; ok {
+			s = w
+		}
+		if secretConfigKeys[key] && s != "" && s != "-" && !strings.HasPrefix(s, "$") {
+			return "REDACTED"
+		}
+		return redactURL(s)
+	default:
+		return v.Interface()
+	}
+}
+
+// redactURL hides the user info of a URL, which holds credentials such as a
+// Redis password or a proxy login. Other strings are returned unchanged.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil || u.Host == "" {
+		return s
+	}
+	u.User = url.User("REDACTED")
+	return u.String()
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logger.Warn("failed to write JSON response", "error", err)
+	}
+}
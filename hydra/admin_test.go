@@ -0,0 +1,230 @@
+package hydra
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAdminConfig returns a minimal config for admin handler tests.
+func testAdminConfig() *Config {
+	return &Config{
+		Providers: map[string]Provider{
+			"admin-openai": {URL: "https://api.openai.com/v1", APIKey: "sk-secret"},
+			"admin-env":    {URL: "https://api.example.com", APIKey: "$EXAMPLE_KEY"},
+		},
+		Models: map[string]Model{
+			"admin-gpt": {Provider: "admin-openai", Model: "gpt-5", Type: "openai"},
+		},
+		Listeners: []Listener{
+			{
+				Name:        "main",
+				Port:        8080,
+				ReadTimeout: time.Minute,
+				Models:      []string{"admin-gpt"},
+				APIKeys:     []APIKey{{Name: "alice", Key: "proxy-secret"}},
+				Cache: CacheConfig{
+					Backend:  "redis",
+					RedisURL: "redis://:redis-secret@localhost:6379/0",
+				},
+				ConfigType: "openai",
+			},
+		},
+	}
+}
+
+func TestAdminHandler_Metrics(t *testing.T) {
+	metrics.Counter("hydrallm_test_admin_total", "Test counter.").Inc()
+
+	rec := httptest.NewRecorder()
+	newAdminHandler(testAdminConfig).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "hydrallm_test_admin_total 1") {
+		t.Errorf("expected test counter in output, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestAdminHandler_QuotaStatus(t *testing.T) {
+	h := http.Header{}
+	h.Set("anthropic-ratelimit-requests-remaining", "42")
+	providerQuotas.observe("test-admin-provider", h)
+
+	rec := httptest.NewRecorder()
+	newAdminHandler(testAdminConfig).ServeHTTP(rec, httptest.NewRequest("GET", "/status/quota", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Providers map[string]ProviderQuota `json:"providers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	q, ok := body.Providers["test-admin-provider"]
+	if !ok || q.Requests == nil || q.Requests.Remaining != 42 {
+		t.Errorf("unexpected quota status: %+v", body.Providers)
+	}
+}
+
+func TestAdminHandler_MethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newAdminHandler(testAdminConfig).ServeHTTP(rec, httptest.NewRequest("POST", "/metrics", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestAdminHandler_Health(t *testing.T) {
+	h := newAdminHandler(testAdminConfig)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected healthz 200, got %d", rec.Code)
+	}
+
+	serverReady.Store(false)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readyz 503 before start, got %d", rec.Code)
+	}
+
+	serverReady.Store(true)
+	t.Cleanup(func() { serverReady.Store(false) })
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected readyz 200 when serving, got %d", rec.Code)
+	}
+}
+
+func TestAdminHandler_Config(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newAdminHandler(testAdminConfig).ServeHTTP(rec, httptest.NewRequest("GET", "/config", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	out := rec.Body.String()
+	for _, secret := range []string{"sk-secret", "proxy-secret", "redis-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted, got:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{
+		`"$EXAMPLE_KEY"`,
+		`"read_timeout": "1m0s"`,
+		`"REDACTED"`,
+		`"redis://REDACTED@localhost:6379/0"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+	// Runtime state is not part of the config file
+	if strings.Contains(out, "ConfigType") || strings.Contains(out, "resolved") {
+		t.Errorf("expected runtime fields to be omitted, got:\n%s", out)
+	}
+}
+
+func TestAdminHandler_Config_ExpandedEnv(t *testing.T) {
+	t.Setenv("HYDRA_TEST_TOKEN", "env-secret")
+	cfg := testAdminConfig()
+	cfg.Listeners[0].Headers.Set = map[string]string{"Authorization": "Bearer ${HYDRA_TEST_TOKEN}"}
+	cfg.Listeners = append(cfg.Listeners, Listener{Name: "inherited", Extends: "main", Port: 8081})
+	if err := expandConfigEnv(cfg, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := resolveListenerInheritance(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	newAdminHandler(func() *Config { return cfg }).
+		ServeHTTP(rec, httptest.NewRequest("GET", "/config", nil))
+
+	out := rec.Body.String()
+	if strings.Contains(out, "env-secret") {
+		t.Errorf("expected the expanded header to be redacted, got:\n%s", out)
+	}
+	if n := strings.Count(out, `"Bearer ${HYDRA_TEST_TOKEN}"`); n != 2 {
+		t.Errorf("expected the header as written on both listeners, got %d in:\n%s", n, out)
+	}
+}
+
+func TestAdminHandler_Providers(t *testing.T) {
+	modelHealth.recordFailure("admin-gpt", http.StatusBadGateway, "Bad Gateway")
+
+	rec := httptest.NewRecorder()
+	newAdminHandler(testAdminConfig).ServeHTTP(rec, httptest.NewRequest("GET", "/providers", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Providers map[string]ProviderStatus `json:"providers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	m, ok := body.Providers["admin-openai"].Models["admin-gpt"]
+	if !ok {
+		t.Fatalf("expected admin-gpt status, got %+v", body.Providers)
+	}
+	if m.State != "failing" || m.LastStatus != http.StatusBadGateway || m.LastError != "Bad Gateway" {
+		t.Errorf("unexpected model status: %+v", m)
+	}
+	if len(body.Providers["admin-env"].Models) != 0 {
+		t.Errorf("expected no models for admin-env, got %+v", body.Providers["admin-env"].Models)
+	}
+}
+
+func TestAdminHandler_Drain(t *testing.T) {
+	listenerDrains.track(map[string][]*http.Server{"admin-drain": {{}}})
+	serverReady.Store(true)
+	t.Cleanup(func() {
+		listenerDrains.track(map[string][]*http.Server{})
+		serverReady.Store(false)
+	})
+	h := newAdminHandler(testAdminConfig)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/drain/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown listener, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/drain/admin-drain", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/drain", nil))
+	var body struct {
+		Listeners map[string]ListenerDrainStatus `json:"listeners"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !body.Listeners["admin-drain"].Draining {
+		t.Errorf("expected listener to be draining, got %+v", body.Listeners)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable ||
+		!strings.Contains(rec.Body.String(), "draining") {
+		t.Errorf("expected readyz 503 while draining, got %d: %s", rec.Code, rec.Body)
+	}
+}
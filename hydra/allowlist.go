@@ -0,0 +1,106 @@
+package hydra
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// defaultAllowedMethods are the methods accepted by an allowlist without methods.
+var defaultAllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// defaultAllowedPaths are the path prefixes of each listener type's API surface.
+var defaultAllowedPaths = map[string][]string{
+	"openai": {
+		"/v1/chat/completions",
+		"/v1/completions",
+		"/v1/embeddings",
+		"/v1/responses",
+		"/v1/models",
+	},
+	"template":  {"/v1/chat/completions", "/v1/completions", "/v1/models"},
+	"anthropic": {"/v1/messages", "/v1/models"},
+	"bedrock":   {"/model"},
+	"gemini":    {"/v1beta/models", "/v1/models"},
+	"ollama":    {"/api/chat", "/api/generate", "/api/embed", "/api/tags", "/api/show"},
+}
+
+var allowlistRejectsCounter = metrics.Counter(
+	"hydrallm_allowlist_rejects_total",
+	"Requests rejected by a listener allowlist, by listener.",
+)
+
+// AllowlistConfig restricts the requests a listener serves. Setting methods
+// or paths enables it; enabled alone uses the listener type's defaults.
+type AllowlistConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Methods []string `mapstructure:"methods"` // Default: GET, HEAD, POST
+	Paths   []string `mapstructure:"paths"`   // Path prefixes, default per listener type
+}
+
+// active reports whether the allowlist restricts requests.
+func (a AllowlistConfig) active() bool {
+	return a.Enabled || len(a.Methods) > 0 || len(a.Paths) > 0
+}
+
+// allowedPaths returns the configured path prefixes, or the defaults for the
+// listener type.
+func (a AllowlistConfig) allowedPaths(listenerType string) []string {
+	if len(a.Paths) > 0 {
+		return a.Paths
+	}
+	return defaultAllowedPaths[listenerType]
+}
+
+// allows reports whether a request method and path are allowed. A prefix
+// matches the path itself and everything below it.
+func (a AllowlistConfig) allows(listenerType, method, path string) bool {
+	methods := a.Methods
+	if len(methods) == 0 {
+		methods = defaultAllowedMethods
+	}
+	if !slices.ContainsFunc(methods, func(m string) bool { return strings.EqualFold(m, method) }) {
+		return false
+	}
+	for _, prefix := range a.allowedPaths(listenerType) {
+		prefix = strings.TrimRight(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") ||
+			strings.HasPrefix(path, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// newAllowlistMiddleware rejects requests outside the listener's allowlist
+// with 404, so they never reach a provider.
+func newAllowlistMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if !l.Allowlist.active() {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.Allowlist.allows(l.ConfigType, r.Method, r.URL.Path) {
+				allowlistRejectsCounter.Inc("listener", l.Name)
+				logger.Debug(
+					"request not in allowlist",
+					"listener",
+					l.Name,
+					"method",
+					r.Method,
+					"path",
+					r.URL.Path,
+				)
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
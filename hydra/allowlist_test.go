@@ -0,0 +1,67 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestAllowlistAllows(t *testing.T) {
+	on := AllowlistConfig{Enabled: true}
+	chat := AllowlistConfig{Paths: []string{"/v1/chat/"}}
+	post := AllowlistConfig{Methods: []string{"post"}}
+	tests := []struct {
+		name         string
+		allowlist    AllowlistConfig
+		listenerType string
+		method       string
+		path         string
+		expected     bool
+	}{
+		{"openai default", on, "openai", "POST", "/v1/chat/completions", true},
+		{"openai model", on, "openai", "GET", "/v1/models/gpt-4o", true},
+		{"openai other path", on, "openai", "POST", "/admin", false},
+		{"prefix is a path", on, "openai", "GET", "/v1/modelsx", false},
+		{"method not allowed", on, "openai", "DELETE", "/v1/models", false},
+		{"anthropic subpath", on, "anthropic", "POST", "/v1/messages/count_tokens", true},
+		{"bedrock invoke", on, "bedrock", "POST", "/model/claude/invoke", true},
+		{"gemini action", on, "gemini", "POST", "/v1beta/models/gemini:generateContent", true},
+		{"custom paths", chat, "openai", "POST", "/v1/chat/completions", true},
+		{"paths replace defaults", chat, "openai", "GET", "/v1/models", false},
+		{"custom methods", post, "openai", "POST", "/v1/embeddings", true},
+		{"methods replace defaults", post, "openai", "GET", "/v1/models", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.allowlist.allows(tt.listenerType, tt.method, tt.path); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAllowlistMiddleware(t *testing.T) {
+	if newAllowlistMiddleware(&Listener{}, nil, log.New(io.Discard)) != nil {
+		t.Fatal("expected no middleware without an allowlist")
+	}
+
+	l := &Listener{Name: "l1", ConfigType: "openai", Allowlist: AllowlistConfig{Enabled: true}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := newAllowlistMiddleware(l, nil, log.New(io.Discard))(next)
+
+	for path, expected := range map[string]int{
+		"/v1/chat/completions": http.StatusNoContent,
+		"/.env":                http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// authAmbient makes a provider authenticate with the credentials of the cloud
+// instance HydraLLM runs on.
+const authAmbient = "ambient"
+
+// Clouds detected by ambient auth.
+const (
+	cloudAWS   = "aws"
+	cloudAzure = "azure"
+	cloudGCP   = "gcp"
+)
+
+const (
+	ambientProbeTimeout = 2 * time.Second
+	// ambientRetryDelay is how long a failed detection is remembered.
+	ambientRetryDelay = time.Minute
+	// ambientRefreshMargin renews credentials this long before they expire.
+	ambientRefreshMargin = 5 * time.Minute
+	// azureCognitiveResource is the resource of Azure OpenAI access tokens.
+	azureCognitiveResource = "https://cognitiveservices.azure.com"
+)
+
+// metadataEndpoints are the base URLs of the instance metadata services.
+var metadataEndpoints = struct {
+	aws, azure, gcp string
+}{
+	aws:   "http://169.254.169.254",
+	azure: "http://169.254.169.254",
+	gcp:   "http://metadata.google.internal",
+}
+
+// ambientAuth detects the cloud once and caches the credentials it issues.
+var ambientAuth = newAmbientCredentials()
+
+// cloudCredentials are the credentials issued by a cloud's metadata service.
+type cloudCredentials struct {
+	cloud     string
+	token     string // Bearer token on Azure and GCP
+	aws       aws.Credentials
+	awsRegion string
+	expiry    time.Time
+}
+
+// ambientCredentials holds the detected cloud and its current credentials.
+type ambientCredentials struct {
+	client *http.Client
+
+	mu         sync.Mutex
+	creds      cloudCredentials
+	detectErr  error
+	detectedAt time.Time
+}
+
+func newAmbientCredentials() *ambientCredentials {
+	return &ambientCredentials{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// metadataRequest sends a request to a metadata service.
+func (a *ambientCredentials) metadataRequest(
+	ctx context.Context,
+	method, url string,
+	header http.Header,
+) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: status %d", method, url, resp.StatusCode)
+	}
+	// GCE echoes the flavor header, which tells it apart from other servers
+	if header.Get("Metadata-Flavor") != "" &&
+		resp.Header.Get("Metadata-Flavor") != header.Get("Metadata-Flavor") {
+		return nil, fmt.Errorf("%s is not a GCE metadata server", url)
+	}
+	return body, nil
+}
+
+// awsMetadataToken returns an IMDSv2 session token.
+func (a *ambientCredentials) awsMetadataToken(ctx context.Context) (string, error) {
+	token, err := a.metadataRequest(
+		ctx,
+		http.MethodPut,
+		metadataEndpoints.aws+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"21600"}},
+	)
+	return string(token), err
+}
+
+// detect probes every metadata service at once and returns the cloud whose
+// service answered, preferring GCP, then Azure, then AWS.
+func (a *ambientCredentials) detect(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ambientProbeTimeout)
+	defer cancel()
+
+	probes := map[string]func() error{
+		cloudGCP: func() error {
+			_, err := a.metadataRequest(
+				ctx,
+				http.MethodGet,
+				metadataEndpoints.gcp+"/computeMetadata/v1/",
+				http.Header{"Metadata-Flavor": {"Google"}},
+			)
+			return err
+		},
+		cloudAzure: func() error {
+			_, err := a.metadataRequest(
+				ctx,
+				http.MethodGet,
+				metadataEndpoints.azure+"/metadata/instance?api-version=2021-02-01",
+				http.Header{"Metadata": {"true"}},
+			)
+			return err
+		},
+		cloudAWS: func() error {
+			_, err := a.awsMetadataToken(ctx)
+			return err
+		},
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	found := make(map[string]bool, len(probes))
+	for cloud, probe := range probes {
+		wg.Go(func() {
+			if probe() == nil {
+				mu.Lock()
+				found[cloud] = true
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, cloud := range []string{cloudGCP, cloudAzure, cloudAWS} {
+		if found[cloud] {
+			return cloud, nil
+		}
+	}
+	return "", errors.New("ambient auth: no cloud metadata service found")
+}
+
+// current returns the credentials of the detected cloud, refreshing them when
+// they are about to expire. Failed detection is retried after ambientRetryDelay.
+func (a *ambientCredentials) current(ctx context.Context) (cloudCredentials, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.creds.cloud == "" {
+		if a.detectErr != nil && time.Since(a.detectedAt) < ambientRetryDelay {
+			return cloudCredentials{}, a.detectErr
+		}
+		a.creds.cloud, a.detectErr = a.detect(ctx)
+		a.detectedAt = time.Now()
+		if a.detectErr != nil {
+			return cloudCredentials{}, a.detectErr
+		}
+		logger.Info("ambient auth detected cloud", "cloud", a.creds.cloud)
+	}
+
+	if time.Now().Add(ambientRefreshMargin).Before(a.creds.expiry) {
+		return a.creds, nil
+	}
+	var err error
+	switch a.creds.cloud {
+	case cloudGCP:
+		err = a.refreshGCP(ctx)
+	case cloudAzure:
+		err = a.refreshAzure(ctx)
+	case cloudAWS:
+		err = a.refreshAWS(ctx)
+	}
+	if err != nil {
+		return cloudCredentials{}, fmt.Errorf("ambient auth (%s): %w", a.creds.cloud, err)
+	}
+	return a.creds, nil
+}
+
+// refreshGCP fetches an access token of the instance's default service account.
+func (a *ambientCredentials) refreshGCP(ctx context.Context) error {
+	body, err := a.metadataRequest(
+		ctx,
+		http.MethodGet,
+		metadataEndpoints.gcp+"/computeMetadata/v1/instance/service-accounts/default/token",
+		http.Header{"Metadata-Flavor": {"Google"}},
+	)
+	if err != nil {
+		return err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return errors.New("token response has no access_token")
+	}
+	a.creds.token = token.AccessToken
+	a.creds.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return nil
+}
+
+// refreshAzure fetches a managed identity token for Azure OpenAI.
+func (a *ambientCredentials) refreshAzure(ctx context.Context) error {
+	body, err := a.metadataRequest(
+		ctx,
+		http.MethodGet,
+		metadataEndpoints.azure+"/metadata/identity/oauth2/token?api-version=2018-02-01&resource="+
+			azureCognitiveResource,
+		http.Header{"Metadata": {"true"}},
+	)
+	if err != nil {
+		return err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   int64  `json:"expires_on,string"` // Unix seconds
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return errors.New("token response has no access_token")
+	}
+	a.creds.token = token.AccessToken
+	a.creds.expiry = time.Unix(token.ExpiresOn, 0)
+	return nil
+}
+
+// refreshAWS fetches the credentials of the instance's IAM role and its region.
+func (a *ambientCredentials) refreshAWS(ctx context.Context) error {
+	creds, region, err := a.instanceRoleCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	a.creds.aws = creds
+	a.creds.awsRegion = region
+	a.creds.expiry = creds.Expires
+	return nil
+}
+
+// instanceRoleCredentials returns the credentials of the EC2 instance's IAM
+// role from IMDSv2, and the instance's region.
+func (a *ambientCredentials) instanceRoleCredentials(
+	ctx context.Context,
+) (aws.Credentials, string, error) {
+	session, err := a.awsMetadataToken(ctx)
+	if err != nil {
+		return aws.Credentials{}, "", err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {session}}
+	base := metadataEndpoints.aws + "/latest/meta-data/"
+
+	roles, err := a.metadataRequest(
+		ctx,
+		http.MethodGet,
+		base+"iam/security-credentials/",
+		header,
+	)
+	if err != nil {
+		return aws.Credentials{}, "", err
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return aws.Credentials{}, "", errors.New("instance has no IAM role")
+	}
+	body, err := a.metadataRequest(ctx, http.MethodGet, base+"iam/security-credentials/"+role, header)
+	if err != nil {
+		return aws.Credentials{}, "", err
+	}
+	var creds struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(body, &creds); err != nil || creds.AccessKeyID == "" {
+		return aws.Credentials{}, "", errors.New("credentials response has no AccessKeyId")
+	}
+	region, err := a.metadataRequest(ctx, http.MethodGet, base+"placement/region", header)
+	if err != nil {
+		return aws.Credentials{}, "", err
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Source:          "ambient",
+		CanExpire:       true,
+		Expires:         creds.Expiration,
+	}, strings.TrimSpace(string(region)), nil
+}
+
+// setAmbientAuth authenticates req with the detected cloud's credentials:
+// SigV4 for Bedrock on AWS, and a bearer token on Azure and GCP.
+func setAmbientAuth(req *http.Request, modelType string, provider Provider) error {
+	creds, err := ambientAuth.current(req.Context())
+	if err != nil {
+		return err
+	}
+
+	if creds.cloud == cloudAWS {
+		if modelType != "bedrock" {
+			return fmt.Errorf("ambient AWS credentials can only sign bedrock requests, not %s", modelType)
+		}
+		region := provider.GetAWSRegion()
+		if region == "" {
+			region = creds.awsRegion
+		}
+		return signBedrockRequest(req, creds.aws, region)
+	}
+
+	req.Header.Del("x-api-key")
+	req.Header.Del("x-goog-api-key")
+	req.Header.Set("Authorization", "Bearer "+creds.token)
+	if modelType == "anthropic" {
+		req.Header.Set("anthropic-version", provider.anthropicVersion())
+	}
+	return nil
+}
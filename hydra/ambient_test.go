@@ -0,0 +1,154 @@
+package hydra
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMetadataServer emulates the metadata service of one cloud.
+func fakeMetadataServer(t *testing.T, cloud string) *httptest.Server {
+	t.Helper()
+	expires := time.Now().Add(time.Hour)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case cloud == cloudGCP && r.Header.Get("Metadata-Flavor") == "Google":
+			w.Header().Set("Metadata-Flavor", "Google")
+			if strings.HasSuffix(r.URL.Path, "/service-accounts/default/token") {
+				_, _ = w.Write([]byte(`{"access_token":"gcp-token","expires_in":3600}`))
+			}
+		case cloud == cloudAzure && r.Header.Get("Metadata") == "true":
+			if r.URL.Path == "/metadata/identity/oauth2/token" {
+				if r.URL.Query().Get("resource") != azureCognitiveResource {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(
+					`{"access_token":"azure-token","expires_on":"` +
+						strconv.FormatInt(expires.Unix(), 10) + `"}`,
+				))
+			}
+		case cloud == cloudAWS && r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			_, _ = w.Write([]byte("imds-session"))
+		case cloud == cloudAWS && r.Header.Get("X-Aws-Ec2-Metadata-Token") == "imds-session":
+			switch r.URL.Path {
+			case "/latest/meta-data/iam/security-credentials/":
+				_, _ = w.Write([]byte("bedrock-role\n"))
+			case "/latest/meta-data/iam/security-credentials/bedrock-role":
+				_, _ = w.Write([]byte(`{"AccessKeyId":"AKIDAMBIENT","SecretAccessKey":"secret",` +
+					`"Token":"session","Expiration":"` + expires.UTC().Format(time.RFC3339) + `"}`))
+			case "/latest/meta-data/placement/region":
+				_, _ = w.Write([]byte("us-west-2"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// useMetadataServer points every metadata endpoint at srv and resets the
+// ambient credentials for the duration of the test.
+func useMetadataServer(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	endpoints, auth := metadataEndpoints, ambientAuth
+	metadataEndpoints.aws = srv.URL
+	metadataEndpoints.azure = srv.URL
+	metadataEndpoints.gcp = srv.URL
+	ambientAuth = newAmbientCredentials()
+	t.Cleanup(func() { metadataEndpoints, ambientAuth = endpoints, auth })
+}
+
+func TestSetAmbientAuth(t *testing.T) {
+	tests := []struct {
+		cloud     string
+		modelType string
+		check     func(t *testing.T, req *http.Request)
+	}{
+		{
+			cloud:     cloudGCP,
+			modelType: "gemini",
+			check: func(t *testing.T, req *http.Request) {
+				if got := req.Header.Get("Authorization"); got != "Bearer gcp-token" {
+					t.Errorf("Authorization = %q, want Bearer gcp-token", got)
+				}
+				if req.Header.Get("x-goog-api-key") != "" {
+					t.Error("x-goog-api-key should be removed")
+				}
+			},
+		},
+		{
+			cloud:     cloudAzure,
+			modelType: "openai",
+			check: func(t *testing.T, req *http.Request) {
+				if got := req.Header.Get("Authorization"); got != "Bearer azure-token" {
+					t.Errorf("Authorization = %q, want Bearer azure-token", got)
+				}
+			},
+		},
+		{
+			cloud:     cloudAWS,
+			modelType: "bedrock",
+			check: func(t *testing.T, req *http.Request) {
+				auth := req.Header.Get("Authorization")
+				if !strings.Contains(auth, "Credential=AKIDAMBIENT/") ||
+					!strings.Contains(auth, "/us-west-2/bedrock/") {
+					t.Errorf("Authorization = %q, want SigV4 with ambient credentials", auth)
+				}
+				if got := req.Header.Get("X-Amz-Security-Token"); got != "session" {
+					t.Errorf("X-Amz-Security-Token = %q, want session", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cloud, func(t *testing.T) {
+			useMetadataServer(t, fakeMetadataServer(t, tt.cloud))
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				"https://upstream.example/v1/chat",
+				bytes.NewReader([]byte(`{}`)),
+			)
+			req.Header.Set("x-goog-api-key", "stale")
+			if err := setAmbientAuth(req, tt.modelType, Provider{}); err != nil {
+				t.Fatalf("setAmbientAuth() error = %v", err)
+			}
+			tt.check(t, req)
+			if got := ambientAuth.creds.cloud; got != tt.cloud {
+				t.Errorf("detected cloud = %q, want %q", got, tt.cloud)
+			}
+		})
+	}
+}
+
+func TestSetAmbientAuthErrors(t *testing.T) {
+	t.Run("aws signs only bedrock", func(t *testing.T) {
+		useMetadataServer(t, fakeMetadataServer(t, cloudAWS))
+		req, _ := http.NewRequest(http.MethodPost, "https://upstream.example/v1/chat", nil)
+		if err := setAmbientAuth(req, "openai", Provider{}); err == nil {
+			t.Error("expected an error for openai models on AWS")
+		}
+	})
+
+	t.Run("no cloud", func(t *testing.T) {
+		useMetadataServer(t, fakeMetadataServer(t, ""))
+		req, _ := http.NewRequest(http.MethodPost, "https://upstream.example/v1/chat", nil)
+		if err := setAmbientAuth(req, "openai", Provider{}); err == nil {
+			t.Fatal("expected an error without a metadata service")
+		}
+		// The failed detection is remembered
+		detectedAt := ambientAuth.detectedAt
+		_ = setAmbientAuth(req, "openai", Provider{})
+		if !ambientAuth.detectedAt.Equal(detectedAt) {
+			t.Error("detection should not be retried immediately")
+		}
+	})
+}
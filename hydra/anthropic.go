@@ -0,0 +1,43 @@
+package hydra
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultAnthropicVersion is the anthropic-version sent when none is configured.
+const defaultAnthropicVersion = "2023-06-01"
+
+// anthropicVersion returns the anthropic-version of a provider.
+func (p Provider) anthropicVersion() string {
+	return cmp.Or(p.AnthropicVersion, defaultAnthropicVersion)
+}
+
+// setAnthropicHeaders sets the anthropic-version of an Anthropic model and
+// adds its configured betas to the anthropic-beta header, keeping the betas
+// the client sent.
+func setAnthropicHeaders(req *http.Request, model Model, provider Provider) {
+	req.Header.Set("anthropic-version", cmp.Or(model.AnthropicVersion, provider.anthropicVersion()))
+
+	var betas []string
+	for _, value := range req.Header.Values("anthropic-beta") {
+		betas = append(betas, strings.Split(value, ",")...)
+	}
+	betas = append(betas, provider.AnthropicBeta...)
+	betas = append(betas, model.AnthropicBeta...)
+
+	merged := make([]string, 0, len(betas))
+	for _, beta := range betas {
+		beta = strings.TrimSpace(beta)
+		if beta != "" && !slices.Contains(merged, beta) {
+			merged = append(merged, beta)
+		}
+	}
+	if len(merged) == 0 {
+		req.Header.Del("anthropic-beta")
+		return
+	}
+	req.Header.Set("anthropic-beta", strings.Join(merged, ","))
+}
@@ -0,0 +1,67 @@
+package hydra
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetAnthropicHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientBetas []string
+		provider    Provider
+		model       Model
+		wantVersion string
+		wantBeta    string
+	}{
+		{
+			name:        "defaults",
+			wantVersion: "2023-06-01",
+		},
+		{
+			name:        "client betas pass through",
+			clientBetas: []string{"prompt-caching-2024-07-31", "context-1m-2025-08-07"},
+			wantVersion: "2023-06-01",
+			wantBeta:    "prompt-caching-2024-07-31,context-1m-2025-08-07",
+		},
+		{
+			name:        "configured betas merged without duplicates",
+			clientBetas: []string{"prompt-caching-2024-07-31, token-efficient-tools-2025-02-19"},
+			provider: Provider{
+				AnthropicVersion: "2024-01-01",
+				AnthropicBeta:    []string{"prompt-caching-2024-07-31"},
+			},
+			model:       Model{AnthropicBeta: []string{"context-1m-2025-08-07"}},
+			wantVersion: "2024-01-01",
+			wantBeta: "prompt-caching-2024-07-31,token-efficient-tools-2025-02-19," +
+				"context-1m-2025-08-07",
+		},
+		{
+			name:        "model version overrides provider",
+			provider:    Provider{AnthropicVersion: "2024-01-01"},
+			model:       Model{AnthropicVersion: "2025-01-01"},
+			wantVersion: "2025-01-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://api.anthropic.com/v1/messages", nil)
+			req.Header.Set("anthropic-version", "2099-01-01")
+			for _, beta := range tt.clientBetas {
+				req.Header.Add("anthropic-beta", beta)
+			}
+			setAnthropicHeaders(req, tt.model, tt.provider)
+
+			if got := req.Header.Get("anthropic-version"); got != tt.wantVersion {
+				t.Errorf("anthropic-version = %q, want %q", got, tt.wantVersion)
+			}
+			if got := req.Header.Values("anthropic-beta"); len(got) > 1 {
+				t.Errorf("expected a single anthropic-beta header, got %q", got)
+			}
+			if got := req.Header.Get("anthropic-beta"); got != tt.wantBeta {
+				t.Errorf("anthropic-beta = %q, want %q", got, tt.wantBeta)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package hydra
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// deprecatedAPIVersions are provider API versions known to be deprecated or
+// retired, by the config key that sets them.
+var deprecatedAPIVersions = map[string][]string{
+	// Replaced by 2023-06-01, which changed streaming events
+	"anthropic_version": {"2023-01-01"},
+	// Retired Azure OpenAI versions
+	"api_version": {
+		"2022-12-01",
+		"2023-03-15-preview",
+		"2023-06-01-preview",
+		"2023-07-01-preview",
+		"2023-08-01-preview",
+		"2023-09-01-preview",
+		"2023-10-01-preview",
+		"2023-12-01-preview",
+		"2024-02-15-preview",
+		"2024-03-01-preview",
+	},
+}
+
+// setAPIVersion pins the api-version query parameter of openai requests to
+// the provider's api_version, as Azure OpenAI requires.
+func setAPIVersion(req *http.Request, modelType string, provider Provider) {
+	if provider.APIVersion == "" || modelType != "openai" {
+		return
+	}
+	query := req.URL.Query()
+	query.Set("api-version", provider.APIVersion)
+	req.URL.RawQuery = query.Encode()
+}
+
+// deprecatedVersionWarnings describes every configured API version known to
+// be deprecated, in provider and then model name order.
+func (c *Config) deprecatedVersionWarnings() []string {
+	var warnings []string
+	check := func(entity, name, key, version string) {
+		if slices.Contains(deprecatedAPIVersions[key], version) {
+			warnings = append(
+				warnings,
+				fmt.Sprintf("%s %q: %s %q is deprecated", entity, name, key, version),
+			)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Providers)) {
+		p := c.Providers[name]
+		check("provider", name, "anthropic_version", p.AnthropicVersion)
+		check("provider", name, "api_version", p.APIVersion)
+	}
+	for _, id := range slices.Sorted(maps.Keys(c.Models)) {
+		check("model", id, "anthropic_version", c.Models[id].AnthropicVersion)
+	}
+	return warnings
+}
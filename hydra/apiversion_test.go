@@ -0,0 +1,79 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestTransport_RoundTrip_APIVersion(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Query().Get("api-version"))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	providers := map[string]Provider{
+		"azure":     {URL: ts.URL, ParsedURL: mustParseURL(ts.URL), APIVersion: "2024-10-21"},
+		"anthropic": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL), APIVersion: "2024-10-21"},
+	}
+	send := func(model Model, path string) {
+		t.Helper()
+		model.Attempts, model.Timeout = 1, time.Second
+		transport := NewRetryTransport(
+			[]Model{model},
+			providers,
+			RetryConfig{MaxCycles: 1},
+			LogConfig{},
+			log.New(io.Discard),
+		)
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original"+path,
+			bytes.NewReader([]byte(`{"messages":[]}`)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	// The provider's version replaces the client's
+	send(Model{ID: "a", Provider: "azure", Model: "gpt-4o", Type: "openai"},
+		"/v1/chat/completions?api-version=2023-05-15")
+	// Only openai requests carry the parameter
+	send(Model{ID: "c", Provider: "anthropic", Model: "claude", Type: "anthropic"}, "/v1/messages")
+
+	if !slices.Equal(got, []string{"2024-10-21", ""}) {
+		t.Errorf("unexpected api-version parameters %q", got)
+	}
+}
+
+func TestConfig_DeprecatedVersionWarnings(t *testing.T) {
+	cfg := &Config{
+		Providers: map[string]Provider{
+			"anthropic": {AnthropicVersion: "2023-06-01"},
+			"azure":     {APIVersion: "2023-03-15-preview"},
+		},
+		Models: map[string]Model{
+			"claude": {Provider: "anthropic", AnthropicVersion: "2023-01-01"},
+		},
+	}
+	want := []string{
+		`provider "azure": api_version "2023-03-15-preview" is deprecated`,
+		`model "claude": anthropic_version "2023-01-01" is deprecated`,
+	}
+	if got := cfg.deprecatedVersionWarnings(); !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,278 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Model assert on_failure actions.
+const (
+	assertRetry    = "retry"    // Once more on the model with a corrective system message
+	assertFallback = "fallback" // On to the next model
+)
+
+// Assertion checks, as reported in logs and metrics.
+const (
+	assertCheckJSON     = "json"
+	assertCheckPattern  = "pattern"
+	assertCheckLanguage = "language"
+)
+
+// errAssertionFailed marks a successful response whose text fails the model's
+// assertions.
+var errAssertionFailed = errors.New("response failed assertions")
+
+var assertionsCounter = metrics.Counter(
+	"hydrallm_assertions_total",
+	"Checks of model assertions on generated text, by model, check, and result.",
+)
+
+// languageNames names the languages of promptLanguages in corrective messages.
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"th": "Thai",
+	"zh": "Chinese",
+}
+
+// AssertConfig checks the text of a model's non-streaming responses. A
+// response failing a check is sent once more to the model with a corrective
+// system message, or the request falls back to the next model.
+type AssertConfig struct {
+	JSON      bool   `mapstructure:"json"`       // Text must be a JSON document
+	Pattern   string `mapstructure:"pattern"`    // Regular expression the text must match
+	Language  string `mapstructure:"language"`   // Language code the text must be in
+	OnFailure string `mapstructure:"on_failure"` // retry (default) or fallback
+	Nudge     string `mapstructure:"nudge"`      // Replaces the corrective message
+
+	Parsed *regexp.Regexp `mapstructure:"-"`
+}
+
+// enabled reports whether any check is set.
+func (c AssertConfig) enabled() bool {
+	return c.JSON || c.Pattern != "" || c.Language != ""
+}
+
+// validate checks the action and language, and compiles the pattern.
+func (c *AssertConfig) validate() error {
+	switch c.OnFailure {
+	case "", assertRetry, assertFallback:
+	default:
+		return fmt.Errorf(
+			"invalid assert on_failure %q (must be %s or %s)",
+			c.OnFailure,
+			assertRetry,
+			assertFallback,
+		)
+	}
+	if c.Language != "" && !slices.Contains(promptLanguages, c.Language) {
+		return fmt.Errorf(
+			"unsupported assert language %q (supported: %s)",
+			c.Language,
+			strings.Join(promptLanguages, ", "),
+		)
+	}
+	if c.Pattern != "" {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid assert pattern %q: %w", c.Pattern, err)
+		}
+		c.Parsed = re
+	}
+	if !c.enabled() && (c.OnFailure != "" || c.Nudge != "") {
+		return errors.New("assert on_failure and nudge require a check")
+	}
+	return nil
+}
+
+// check returns the checks text fails, in a fixed order. Text whose language
+// cannot be told, such as numbers or code, passes the language check.
+func (c AssertConfig) check(text string) []string {
+	var failed []string
+	if c.JSON && !json.Valid([]byte(strings.TrimSpace(text))) {
+		failed = append(failed, assertCheckJSON)
+	}
+	if c.Parsed != nil && !c.Parsed.MatchString(text) {
+		failed = append(failed, assertCheckPattern)
+	}
+	if c.Language != "" {
+		if lang := detectLanguage(text); lang != "" && lang != c.Language {
+			failed = append(failed, assertCheckLanguage)
+		}
+	}
+	return failed
+}
+
+// nudge returns the corrective system message for the failed checks.
+func (c AssertConfig) nudge(failed []string) string {
+	if c.Nudge != "" {
+		return c.Nudge
+	}
+	parts := []string{"Your previous reply did not meet the required format."}
+	for _, check := range failed {
+		switch check {
+		case assertCheckJSON:
+			parts = append(parts, "Reply with valid JSON only, without any other text.")
+		case assertCheckPattern:
+			parts = append(parts, "Reply with text matching the regular expression "+
+				strconv.Quote(c.Pattern)+".")
+		case assertCheckLanguage:
+			parts = append(parts, "Reply in "+languageNames[c.Language]+".")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// responseTexts returns the generated texts of an OpenAI, Anthropic, or
+// Gemini response body: one per choice or candidate, and all text blocks of
+// an Anthropic message as one.
+func responseTexts(body []byte) []string {
+	var texts []string
+	gjson.GetBytes(body, "choices").ForEach(func(_, choice gjson.Result) bool {
+		for _, field := range []string{"message.content", "text"} {
+			if v := choice.Get(field); v.Type == gjson.String {
+				texts = append(texts, v.String())
+			}
+		}
+		return true
+	})
+	var blocks []string
+	gjson.GetBytes(body, "content").ForEach(func(_, block gjson.Result) bool {
+		if block.Get("type").String() == "text" {
+			blocks = append(blocks, block.Get("text").String())
+		}
+		return true
+	})
+	if len(blocks) > 0 {
+		texts = append(texts, strings.Join(blocks, ""))
+	}
+	gjson.GetBytes(body, "candidates").ForEach(func(_, candidate gjson.Result) bool {
+		var parts []string
+		candidate.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+			if text := part.Get("text"); text.Type == gjson.String {
+				parts = append(parts, text.String())
+			}
+			return true
+		})
+		if len(parts) > 0 {
+			texts = append(texts, strings.Join(parts, ""))
+		}
+		return true
+	})
+	return texts
+}
+
+// checkAssertions applies the model's assertions to the texts of a
+// successful non-streaming response, whose body is kept for the client.
+// Every outcome is logged and counted. It returns the failed checks, with an
+// error wrapping errAssertionFailed. Responses without text, such as tool
+// calls, pass.
+func (t *RetryTransport) checkAssertions(
+	model Model,
+	resp *http.Response,
+	nudged bool,
+) ([]string, error) {
+	if resp.StatusCode >= 300 || resp.Header.Get("Content-Encoding") != "" {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	texts := responseTexts(body)
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	var failed []string
+	for _, text := range texts {
+		for _, check := range model.Assert.check(text) {
+			if !slices.Contains(failed, check) {
+				failed = append(failed, check)
+			}
+		}
+	}
+	for _, check := range []string{assertCheckJSON, assertCheckPattern, assertCheckLanguage} {
+		switch {
+		case slices.Contains(failed, check):
+			assertionsCounter.Inc("model", model.ID, "check", check, "result", "failed")
+		case check == assertCheckJSON && model.Assert.JSON,
+			check == assertCheckPattern && model.Assert.Parsed != nil,
+			check == assertCheckLanguage && model.Assert.Language != "":
+			assertionsCounter.Inc("model", model.ID, "check", check, "result", "passed")
+		}
+	}
+
+	if len(failed) == 0 {
+		t.logger.Info("response passed assertions", "model", model.ID, "nudged", nudged)
+		return nil, nil
+	}
+	t.logger.Info(
+		"response failed assertions",
+		"model",
+		model.ID,
+		"checks",
+		failed,
+		"nudged",
+		nudged,
+	)
+	return failed, fmt.Errorf("%w: %s", errAssertionFailed, strings.Join(failed, ", "))
+}
+
+// withNudge adds a corrective system message to a request body in the format
+// of its path: a trailing system message for OpenAI chat, the system prompt of
+// Anthropic messages, or the system instruction of Gemini. Other bodies are
+// returned unchanged.
+func withNudge(path string, body []byte, nudge string) ([]byte, error) {
+	path = strings.TrimRight(path, "/")
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return sjson.SetBytes(body, "messages.-1", map[string]string{
+			"role":    "system",
+			"content": nudge,
+		})
+	case strings.HasSuffix(path, "/messages"):
+		system := gjson.GetBytes(body, "system")
+		switch {
+		case system.IsArray():
+			return sjson.SetBytes(body, "system.-1", map[string]string{
+				"type": "text",
+				"text": nudge,
+			})
+		case system.String() != "":
+			return sjson.SetBytes(body, "system", system.String()+"\n\n"+nudge)
+		}
+		return sjson.SetBytes(body, "system", nudge)
+	case strings.HasSuffix(path, ":generateContent"):
+		field := "systemInstruction"
+		if gjson.GetBytes(body, "system_instruction").Exists() {
+			field = "system_instruction"
+		}
+		return sjson.SetBytes(body, field+".parts.-1", map[string]string{"text": nudge})
+	}
+	return body, nil
+}
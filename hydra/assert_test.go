@@ -0,0 +1,218 @@
+package hydra
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestAssertConfig_Check(t *testing.T) {
+	c := AssertConfig{
+		JSON:     true,
+		Pattern:  `"answer"`,
+		Language: "en",
+		Parsed:   regexp.MustCompile(`"answer"`),
+	}
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{`{"answer": "the sky is blue and this is why"}`, nil},
+		{"  {\"answer\": 42}\n", nil},
+		{"Sure! Here is the JSON: {\"answer\": 42}", []string{"json"}},
+		{`{"result": 42}`, []string{"pattern"}},
+		{`{"answer": "der Himmel ist blau und das ist nicht schwer"}`, []string{"language"}},
+		{"```json\n{}\n```", []string{"json", "pattern"}},
+	}
+	for _, tt := range tests {
+		if got := c.check(tt.text); !slices.Equal(got, tt.expected) {
+			t.Errorf("check(%q) = %v, want %v", tt.text, got, tt.expected)
+		}
+	}
+
+	nudge := c.nudge([]string{"json", "language"})
+	if !strings.Contains(nudge, "valid JSON") || !strings.Contains(nudge, "Reply in English.") {
+		t.Errorf("expected the nudge to name the failed checks, got %q", nudge)
+	}
+	c.Nudge = "Answer with the JSON object only."
+	if got := c.nudge([]string{"json"}); got != c.Nudge {
+		t.Errorf("expected the configured nudge, got %q", got)
+	}
+}
+
+func TestResponseTexts(t *testing.T) {
+	tests := map[string]struct {
+		body     string
+		expected []string
+	}{
+		"openai": {
+			`{"choices":[{"message":{"content":"a"}},{"message":{"content":"b"}}]}`,
+			[]string{"a", "b"},
+		},
+		"openai tool call": {
+			`{"choices":[{"message":{"content":null,"tool_calls":[{"id":"c"}]}}]}`,
+			nil,
+		},
+		"anthropic": {
+			`{"content":[{"type":"text","text":"a"},{"type":"tool_use"},{"type":"text","text":"b"}]}`,
+			[]string{"ab"},
+		},
+		"gemini": {
+			`{"candidates":[{"content":{"parts":[{"text":"a"},{"text":"b"}]}}]}`,
+			[]string{"ab"},
+		},
+	}
+	for name, tt := range tests {
+		if got := responseTexts([]byte(tt.body)); !slices.Equal(got, tt.expected) {
+			t.Errorf("%s: expected %q, got %q", name, tt.expected, got)
+		}
+	}
+}
+
+func TestWithNudge(t *testing.T) {
+	tests := []struct {
+		path     string
+		body     string
+		field    string
+		expected string
+	}{
+		{
+			"/v1/chat/completions",
+			`{"messages":[{"role":"user","content":"hi"}]}`,
+			"messages.1",
+			`{"content":"fix it","role":"system"}`,
+		},
+		{"/v1/messages", `{"messages":[]}`, "system", `"fix it"`},
+		{"/v1/messages", `{"system":"be brief"}`, "system", `"be brief\n\nfix it"`},
+		{
+			"/v1/messages",
+			`{"system":[{"type":"text","text":"be brief"}]}`,
+			"system.1",
+			`{"text":"fix it","type":"text"}`,
+		},
+		{
+			"/v1beta/models/gemini-2.5-pro:generateContent",
+			`{"contents":[]}`,
+			"systemInstruction.parts.0",
+			`{"text":"fix it"}`,
+		},
+	}
+	for _, tt := range tests {
+		out, err := withNudge(tt.path, []byte(tt.body), "fix it")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.path, err)
+		}
+		if got := gjson.GetBytes(out, tt.field).Raw; got != tt.expected {
+			t.Errorf("%s %s: expected %s, got %s", tt.path, tt.body, tt.expected, got)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_Assertions(t *testing.T) {
+	var nudges []string
+	chatty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if nudge := gjson.GetBytes(b, `messages.#(role=="system").content`); nudge.Exists() {
+			nudges = append(nudges, nudge.String())
+			if strings.Contains(string(b), "obey") {
+				_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"{\"ok\":true}"}}]}`))
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"Sure! {\"ok\":true}"}}]}`))
+	}))
+	defer chatty.Close()
+
+	strict := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"{\"from\":\"strict\"}"}}]}`))
+	}))
+	defer strict.Close()
+
+	providers := map[string]Provider{
+		"chatty": {URL: chatty.URL, ParsedURL: mustParseURL(chatty.URL)},
+		"strict": {URL: strict.URL, ParsedURL: mustParseURL(strict.URL)},
+	}
+	roundTrip := func(t *testing.T, content string, a AssertConfig) (string, error) {
+		t.Helper()
+		nudges = nil
+		models := []Model{
+			{
+				ID:       "assert-chatty",
+				Provider: "chatty",
+				Model:    "m",
+				Type:     "openai",
+				Attempts: 2,
+				Timeout:  time.Second,
+				Assert:   a,
+			},
+			{
+				ID:       "assert-strict",
+				Provider: "strict",
+				Model:    "m",
+				Type:     "openai",
+				Attempts: 1,
+				Timeout:  time.Second,
+			},
+		}
+		retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+		transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+		body := `{"model":"m","messages":[{"role":"user","content":"` + content + `"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			bytes.NewBufferString(body))
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		return gjson.GetBytes(b, "choices.0.message.content").String(), nil
+	}
+
+	t.Run("nudged retry passes", func(t *testing.T) {
+		failed := metrics.value("hydrallm_assertions_total",
+			"model", "assert-chatty", "check", "json", "result", "failed")
+		got, err := roundTrip(t, "hi", AssertConfig{JSON: true, Nudge: "obey"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != `{"ok":true}` || !slices.Equal(nudges, []string{"obey"}) {
+			t.Errorf("expected the nudged answer, got %q after nudges %q", got, nudges)
+		}
+		if n := metrics.value("hydrallm_assertions_total",
+			"model", "assert-chatty", "check", "json", "result", "failed") - failed; n != 1 {
+			t.Errorf("expected one failed check counted, got %v", n)
+		}
+	})
+
+	t.Run("failed nudge falls back", func(t *testing.T) {
+		got, err := roundTrip(t, "hi", AssertConfig{JSON: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != `{"from":"strict"}` || len(nudges) != 1 ||
+			!strings.Contains(nudges[0], "valid JSON") {
+			t.Errorf("expected one nudge, then the next model, got %q after nudges %q",
+				got, nudges)
+		}
+	})
+
+	t.Run("fallback without retry", func(t *testing.T) {
+		got, err := roundTrip(t, "hi", AssertConfig{JSON: true, OnFailure: assertFallback})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != `{"from":"strict"}` || len(nudges) != 0 {
+			t.Errorf("expected the next model without a nudge, got %q after nudges %q",
+				got, nudges)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// APIKey is a client credential accepted by a listener.
+type APIKey struct {
+	Name  string   `mapstructure:"name"` // Identifies the client in logs
+	Key   string   `mapstructure:"key"`
+	Tags  []string `mapstructure:"tags"`  // Matched by [[routes]] key_tags
+	Quota KeyQuota `mapstructure:"quota"` // Daily request, token, and spend limits
+}
+
+// GetKey resolves the key, supporting environment variable expansion.
+func (k *APIKey) GetKey() string {
+	return resolveEnvOrValue(k.Key)
+}
+
+type apiKeyNameContextKey struct{}
+
+// apiKeyName returns the name of the API key that authenticated the request,
+// or an empty string when the listener does not require authentication.
+func apiKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameContextKey{}).(string)
+	return name
+}
+
+// resolveAPIKeys combines a listener's inline keys with the keys in its keys file.
+func resolveAPIKeys(l *Listener) ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(l.APIKeys))
+	for _, k := range l.APIKeys {
+		keys = append(keys, APIKey{Name: k.Name, Key: k.GetKey(), Tags: k.Tags, Quota: k.Quota})
+	}
+	if l.APIKeysFile != "" {
+		fileKeys, err := readAPIKeysFile(l.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	names := make(map[string]struct{}, len(keys))
+	values := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		if k.Name == "" {
+			return nil, errors.New("api key name is required")
+		}
+		if k.Key == "" {
+			return nil, fmt.Errorf("api key %q: key is required", k.Name)
+		}
+		if k.Quota.RequestsPerDay < 0 || k.Quota.TokensPerDay < 0 || k.Quota.USDPerDay < 0 {
+			return nil, fmt.Errorf("api key %q: quota limits must not be negative", k.Name)
+		}
+		if _, dup := names[k.Name]; dup {
+			return nil, fmt.Errorf("duplicate api key name %q", k.Name)
+		}
+		if _, dup := values[k.Key]; dup {
+			return nil, fmt.Errorf("api key %q: key already used by another entry", k.Name)
+		}
+		names[k.Name] = struct{}{}
+		values[k.Key] = struct{}{}
+	}
+	return keys, nil
+}
+
+// readAPIKeysFile reads "name:key" lines from a keys file.
+// Blank lines and lines starting with # are ignored.
+func readAPIKeysFile(path string) ([]APIKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open api keys file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var keys []APIKey
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, key, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("api keys file line %d: expected name:key", lineNum)
+		}
+		keys = append(keys, APIKey{Name: strings.TrimSpace(name), Key: strings.TrimSpace(key)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read api keys file: %w", err)
+	}
+	return keys, nil
+}
+
+// newAuthMiddleware rejects requests without one of the listener's API keys.
+// Clients present the key as a Bearer token or in x-api-key. The credential is
+// removed before proxying so it never reaches the upstream.
+func newAuthMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if len(l.ResolvedAPIKeys) == 0 {
+		return nil
+	}
+	keys := l.ResolvedAPIKeys
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, ok := matchAPIKey(keys, requestAPIKey(r))
+			if !ok {
+				logger.Warn("unauthorized request", "listener", l.Name, "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			r = r.Clone(context.WithValue(r.Context(), apiKeyNameContextKey{}, name))
+			r.Header.Del("Authorization")
+			r.Header.Del("x-api-key")
+			logger.Debug("authenticated request", "listener", l.Name, "key", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestAPIKey extracts the client credential from a Bearer token or x-api-key.
+func requestAPIKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("x-api-key")
+}
+
+// matchAPIKey returns the name of the key equal to presented.
+// Every key is compared in constant time.
+func matchAPIKey(keys []APIKey, presented string) (string, bool) {
+	if presented == "" {
+		return "", false
+	}
+	var name string
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(presented)) == 1 {
+			name = k.Name
+		}
+	}
+	return name, name != ""
+}
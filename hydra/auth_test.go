@@ -0,0 +1,135 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestResolveAPIKeys(t *testing.T) {
+	t.Setenv("HYDRALLM_TEST_PROXY_KEY", "env-key")
+
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# team keys\n\nbob: file-key\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+
+	t.Run("inline and file keys", func(t *testing.T) {
+		l := &Listener{
+			APIKeys: []APIKey{
+				{Name: "alice", Key: "$HYDRALLM_TEST_PROXY_KEY", Tags: []string{"batch"}},
+			},
+			APIKeysFile: path,
+		}
+		keys, err := resolveAPIKeys(l)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []APIKey{
+			{Name: "alice", Key: "env-key", Tags: []string{"batch"}},
+			{Name: "bob", Key: "file-key"},
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("expected %v, got %v", want, keys)
+		}
+	})
+
+	tests := []struct {
+		name string
+		keys []APIKey
+		file string
+	}{
+		{"missing name", []APIKey{{Key: "k"}}, ""},
+		{"missing key", []APIKey{{Name: "a"}}, ""},
+		{"duplicate name", []APIKey{{Name: "a", Key: "k1"}, {Name: "a", Key: "k2"}}, ""},
+		{"duplicate key", []APIKey{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}, ""},
+		{
+			"negative quota",
+			[]APIKey{{Name: "a", Key: "k", Quota: KeyQuota{TokensPerDay: -1}}},
+			"",
+		},
+		{"missing file", nil, filepath.Join(t.TempDir(), "nope")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := resolveAPIKeys(&Listener{APIKeys: tt.keys, APIKeysFile: tt.file}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReadAPIKeysFile_InvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("no-separator\n"), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+	if _, err := readAPIKeysFile(path); err == nil {
+		t.Error("expected error for line without name:key")
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	l := &Listener{
+		Name:            "main",
+		ResolvedAPIKeys: []APIKey{{Name: "alice", Key: "secret-a"}, {Name: "bob", Key: "secret-b"}},
+	}
+	mw := newAuthMiddleware(l, &Config{}, log.New(io.Discard))
+	if mw == nil {
+		t.Fatal("expected auth middleware")
+	}
+
+	var gotName, gotAuth, gotAPIKey string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotName = apiKeyName(r.Context())
+		gotAuth = r.Header.Get("Authorization")
+		gotAPIKey = r.Header.Get("x-api-key")
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+		wantName string
+	}{
+		{"bearer token", "Authorization", "Bearer secret-a", http.StatusOK, "alice"},
+		{"x-api-key", "x-api-key", "secret-b", http.StatusOK, "bob"},
+		{"wrong key", "Authorization", "Bearer nope", http.StatusUnauthorized, ""},
+		{"no key", "", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotName, gotAuth, gotAPIKey = "", "", ""
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if gotName != tt.wantName {
+				t.Errorf("expected key name %q, got %q", tt.wantName, gotName)
+			}
+			if gotAuth != "" || gotAPIKey != "" {
+				t.Error("expected client credentials to be removed before proxying")
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_NoKeys(t *testing.T) {
+	if mw := newAuthMiddleware(&Listener{}, &Config{}, log.New(io.Discard)); mw != nil {
+		t.Error("expected no middleware for a listener without api keys")
+	}
+}
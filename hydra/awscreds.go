@@ -0,0 +1,422 @@
+package hydra
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// awsDefaultRegion is used when no region is configured anywhere.
+const awsDefaultRegion = "us-east-1"
+
+// awsRoleSessionName names the sessions of assumed roles in CloudTrail.
+const awsRoleSessionName = "hydrallm"
+
+// awsEndpoints are the AWS endpoints credentials are fetched from.
+var awsEndpoints = struct {
+	sts       string // Regional STS endpoint, %s is the region
+	container string // ECS task credentials endpoint
+}{
+	sts:       "https://sts.%s.amazonaws.com",
+	container: "http://169.254.170.2",
+}
+
+// awsCredentials caches the credential sources of bedrock providers.
+var awsCredentials = newAWSCredentialStore()
+
+// awsCredentialSource resolves and caches the credentials of one provider
+// configuration. A failed lookup is remembered for ambientRetryDelay so
+// requests are not held up by probing for credentials that are not there.
+type awsCredentialSource struct {
+	creds  *aws.CredentialsCache
+	region string
+
+	mu       sync.Mutex
+	err      error
+	failedAt time.Time
+}
+
+type awsCredentialStore struct {
+	mu      sync.Mutex
+	sources map[string]*awsCredentialSource // Keyed by credential settings
+}
+
+func newAWSCredentialStore() *awsCredentialStore {
+	return &awsCredentialStore{sources: make(map[string]*awsCredentialSource)}
+}
+
+// retrieve returns the credentials and region to sign requests to a provider
+// with. Static keys are used when configured, else the default credential
+// chain: environment variables, the shared config files, web identity (IRSA),
+// ECS task credentials, and the EC2 instance role. With assume_role_arn
+// those credentials assume the role, which is renewed before it expires.
+func (s *awsCredentialStore) retrieve(
+	ctx context.Context,
+	provider Provider,
+) (aws.Credentials, string, error) {
+	key := strings.Join([]string{
+		provider.GetAWSAccessKeyID(),
+		provider.GetAWSSecretAccessKey(),
+		provider.GetAWSSessionToken(),
+		provider.AWSProfile,
+		provider.AssumeRoleARN,
+		provider.AssumeRoleExternalID,
+		provider.GetAWSRegion(),
+	}, "\x00")
+
+	s.mu.Lock()
+	source, ok := s.sources[key]
+	if !ok {
+		source = newAWSCredentialSource(provider)
+		s.sources[key] = source
+	}
+	s.mu.Unlock()
+
+	source.mu.Lock()
+	if source.err != nil && time.Since(source.failedAt) < ambientRetryDelay {
+		err := source.err
+		source.mu.Unlock()
+		return aws.Credentials{}, "", err
+	}
+	source.mu.Unlock()
+
+	creds, err := source.creds.Retrieve(ctx)
+	if err != nil {
+		source.mu.Lock()
+		source.err, source.failedAt = err, time.Now()
+		source.mu.Unlock()
+		return aws.Credentials{}, "", err
+	}
+	return creds, source.region, nil
+}
+
+func newAWSCredentialSource(provider Provider) *awsCredentialSource {
+	profile := cmp.Or(provider.AWSProfile, os.Getenv("AWS_PROFILE"), "default")
+	region := cmp.Or(
+		provider.GetAWSRegion(),
+		os.Getenv("AWS_REGION"),
+		os.Getenv("AWS_DEFAULT_REGION"),
+		sharedProfile(profile)["region"],
+		awsDefaultRegion,
+	)
+
+	var base aws.CredentialsProvider = awsCredentialChain{provider: provider, profile: profile}
+	if provider.AssumeRoleARN != "" {
+		base = assumeRoleProvider{
+			base:       aws.NewCredentialsCache(base),
+			roleARN:    provider.AssumeRoleARN,
+			externalID: provider.AssumeRoleExternalID,
+			region:     region,
+		}
+	}
+	return &awsCredentialSource{
+		creds: aws.NewCredentialsCache(base, func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = ambientRefreshMargin
+		}),
+		region: region,
+	}
+}
+
+// awsCredentialChain looks up the credentials of a provider in the order of
+// the AWS SDK default chain.
+type awsCredentialChain struct {
+	provider Provider
+	profile  string
+}
+
+func (c awsCredentialChain) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	if id := c.provider.GetAWSAccessKeyID(); id != "" {
+		return aws.Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: c.provider.GetAWSSecretAccessKey(),
+			SessionToken:    c.provider.GetAWSSessionToken(),
+			Source:          "config",
+		}, nil
+	}
+
+	// An explicitly configured profile wins over the environment, as in the SDK
+	if c.provider.AWSProfile == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		return aws.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Source:          "environment",
+		}, nil
+	}
+
+	profile := sharedProfile(c.profile)
+	if profile["aws_access_key_id"] != "" {
+		return aws.Credentials{
+			AccessKeyID:     profile["aws_access_key_id"],
+			SecretAccessKey: profile["aws_secret_access_key"],
+			SessionToken:    profile["aws_session_token"],
+			Source:          "profile " + c.profile,
+		}, nil
+	}
+	if c.provider.AWSProfile != "" {
+		return aws.Credentials{}, fmt.Errorf("aws profile %q has no access keys", c.profile)
+	}
+
+	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); tokenFile != "" {
+		return webIdentityCredentials(ctx, tokenFile, os.Getenv("AWS_ROLE_ARN"))
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" ||
+		os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return containerCredentials(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ambientProbeTimeout)
+	defer cancel()
+	creds, _, err := ambientAuth.instanceRoleCredentials(ctx)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf(
+			"no AWS credentials in the environment, shared files, or instance metadata: %w",
+			err,
+		)
+	}
+	return creds, nil
+}
+
+// sharedProfile returns the settings of a profile from the shared credentials
+// and config files, the credentials file taking precedence.
+func sharedProfile(name string) map[string]string {
+	home, _ := os.UserHomeDir()
+	// The config file prefixes profile sections other than the default
+	section := name
+	if name != "default" {
+		section = "profile " + name
+	}
+	settings := readINISection(
+		cmp.Or(os.Getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config")),
+		section,
+	)
+	maps.Copy(settings, readINISection(
+		cmp.Or(
+			os.Getenv("AWS_SHARED_CREDENTIALS_FILE"),
+			filepath.Join(home, ".aws", "credentials"),
+		),
+		name,
+	))
+	return settings
+}
+
+// readINISection returns the key = value pairs of one section of an INI
+// file. Missing files and sections have no settings.
+func readINISection(path, section string) map[string]string {
+	settings := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return settings
+	}
+	defer func() { _ = f.Close() }()
+
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "["); ok {
+			inSection = strings.TrimSpace(strings.TrimSuffix(name, "]")) == section
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && inSection {
+			settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+// containerCredentials fetches ECS task role credentials.
+func containerCredentials(ctx context.Context) (aws.Credentials, error) {
+	target := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		target = awsEndpoints.container + uri
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("failed to read container token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := ambientAuth.client.Do(req)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return aws.Credentials{}, fmt.Errorf("container credentials: status %d", resp.StatusCode)
+	}
+	var creds struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil || creds.AccessKeyID == "" {
+		return aws.Credentials{}, errors.New("container credentials response has no AccessKeyId")
+	}
+	return aws.Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Source:          "container",
+		CanExpire:       true,
+		Expires:         creds.Expiration,
+	}, nil
+}
+
+// webIdentityCredentials exchanges the web identity token of an EKS service
+// account (IRSA) for credentials of its role.
+func webIdentityCredentials(
+	ctx context.Context,
+	tokenFile, roleARN string,
+) (aws.Credentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+	region := cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), awsDefaultRegion)
+	return callSTS(ctx, region, nil, url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {awsRoleSessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	})
+}
+
+// assumeRoleProvider assumes a role with the credentials of base.
+type assumeRoleProvider struct {
+	base       aws.CredentialsProvider
+	roleARN    string
+	externalID string
+	region     string
+}
+
+func (p assumeRoleProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	base, err := p.base.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"RoleArn":         {p.roleARN},
+		"RoleSessionName": {awsRoleSessionName},
+	}
+	if p.externalID != "" {
+		form.Set("ExternalId", p.externalID)
+	}
+	return callSTS(ctx, p.region, &base, form)
+}
+
+// callSTS calls an STS action returning role credentials. The call is signed
+// with creds unless they are nil.
+func callSTS(
+	ctx context.Context,
+	region string,
+	creds *aws.Credentials,
+	form url.Values,
+) (aws.Credentials, error) {
+	action := form.Get("Action")
+	form.Set("Version", "2011-06-15")
+	body := form.Encode()
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf(awsEndpoints.sts, region),
+		strings.NewReader(body),
+	)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if creds != nil {
+		hash := sha256.Sum256([]byte(body))
+		err := v4.NewSigner().
+			SignHTTP(ctx, *creds, req, hex.EncodeToString(hash[:]), "sts", region, time.Now())
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+	}
+
+	resp, err := ambientAuth.client.Do(req)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("sts %s: %w", action, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("sts %s: %w", action, err)
+	}
+
+	var out struct {
+		Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+		Role        stsCredentials `xml:"AssumeRoleResult>Credentials"`
+		WebIdentity stsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	_ = xml.Unmarshal(data, &out)
+	if resp.StatusCode != http.StatusOK {
+		return aws.Credentials{}, fmt.Errorf(
+			"sts %s: status %d: %s %s",
+			action,
+			resp.StatusCode,
+			out.Error.Code,
+			out.Error.Message,
+		)
+	}
+	result := out.Role
+	if result.AccessKeyID == "" {
+		result = out.WebIdentity
+	}
+	if result.AccessKeyID == "" {
+		return aws.Credentials{}, fmt.Errorf("sts %s: response has no credentials", action)
+	}
+	return aws.Credentials{
+		AccessKeyID:     result.AccessKeyID,
+		SecretAccessKey: result.SecretAccessKey,
+		SessionToken:    result.SessionToken,
+		Source:          "sts " + action,
+		CanExpire:       true,
+		Expires:         result.Expiration,
+	}, nil
+}
+
+// stsCredentials are the role credentials in an STS response.
+type stsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
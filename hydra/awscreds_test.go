@@ -0,0 +1,211 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// isolateAWS clears the AWS environment, points the shared files into a
+// temporary directory, and serves instance metadata from a server without
+// an AWS role, for the duration of the test.
+func isolateAWS(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, env := range []string{
+		"AWS_ACCESS_KEY_ID",
+		"AWS_SECRET_ACCESS_KEY",
+		"AWS_SESSION_TOKEN",
+		"AWS_PROFILE",
+		"AWS_REGION",
+		"AWS_DEFAULT_REGION",
+		"AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_ROLE_ARN",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	useMetadataServer(t, fakeMetadataServer(t, cloudGCP))
+
+	store, endpoints := awsCredentials, awsEndpoints
+	awsCredentials = newAWSCredentialStore()
+	t.Cleanup(func() { awsCredentials, awsEndpoints = store, endpoints })
+	return dir
+}
+
+// fakeSTSServer answers STS actions with credentials named after the action
+// and counts the calls.
+func fakeSTSServer(t *testing.T, check func(r *http.Request)) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_ = r.ParseForm()
+		check(r)
+		action := r.Form.Get("Action")
+		expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		_, _ = w.Write([]byte(`<` + action + `Response><` + action + `Result><Credentials>` +
+			`<AccessKeyId>AKID` + strings.ToUpper(action) + `</AccessKeyId>` +
+			`<SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>` +
+			`<Expiration>` + expires + `</Expiration>` +
+			`</Credentials></` + action + `Result></` + action + `Response>`))
+	}))
+	t.Cleanup(srv.Close)
+	awsEndpoints.sts = srv.URL + "/%s"
+	return &calls
+}
+
+func TestAWSCredentials_Chain(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("static keys", func(t *testing.T) {
+		isolateAWS(t)
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+		creds, region, err := awsCredentials.retrieve(ctx, Provider{
+			AWSAccessKeyID:     "AKIDSTATIC",
+			AWSSecretAccessKey: "secret",
+			AWSRegion:          "eu-west-1",
+		})
+		if err != nil || creds.AccessKeyID != "AKIDSTATIC" || region != "eu-west-1" {
+			t.Errorf("got %q in %q, %v; want static keys", creds.AccessKeyID, region, err)
+		}
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		isolateAWS(t)
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_REGION", "ap-northeast-1")
+		creds, region, err := awsCredentials.retrieve(ctx, Provider{})
+		if err != nil || creds.AccessKeyID != "AKIDENV" || region != "ap-northeast-1" {
+			t.Errorf("got %q in %q, %v; want environment keys", creds.AccessKeyID, region, err)
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		dir := isolateAWS(t)
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+		writeFile(t, filepath.Join(dir, "credentials"),
+			"[default]\naws_access_key_id = AKIDDEFAULT\n\n"+
+				"[bedrock]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = secret\n")
+		writeFile(t, filepath.Join(dir, "config"), "[profile bedrock]\nregion = us-west-2\n")
+
+		creds, region, err := awsCredentials.retrieve(ctx, Provider{AWSProfile: "bedrock"})
+		if err != nil || creds.AccessKeyID != "AKIDPROFILE" || region != "us-west-2" {
+			t.Errorf("got %q in %q, %v; want profile keys", creds.AccessKeyID, region, err)
+		}
+		if _, _, err := awsCredentials.retrieve(ctx, Provider{AWSProfile: "missing"}); err == nil {
+			t.Error("expected error for a profile without keys")
+		}
+	})
+
+	t.Run("instance role", func(t *testing.T) {
+		isolateAWS(t)
+		useMetadataServer(t, fakeMetadataServer(t, cloudAWS))
+		creds, region, err := awsCredentials.retrieve(ctx, Provider{})
+		if err != nil || creds.AccessKeyID != "AKIDAMBIENT" || region != awsDefaultRegion {
+			t.Errorf("got %q in %q, %v; want instance role", creds.AccessKeyID, region, err)
+		}
+	})
+
+	t.Run("web identity", func(t *testing.T) {
+		dir := isolateAWS(t)
+		tokenFile := filepath.Join(dir, "token")
+		writeFile(t, tokenFile, "jwt\n")
+		t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+		t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/pod")
+		fakeSTSServer(t, func(r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				t.Error("expected unsigned AssumeRoleWithWebIdentity call")
+			}
+			if r.Form.Get("WebIdentityToken") != "jwt" ||
+				!strings.HasSuffix(r.Form.Get("RoleArn"), "/pod") {
+				t.Errorf("unexpected web identity form %v", r.Form)
+			}
+		})
+		creds, _, err := awsCredentials.retrieve(ctx, Provider{})
+		if err != nil || creds.AccessKeyID != "AKIDASSUMEROLEWITHWEBIDENTITY" {
+			t.Errorf("got %q, %v; want web identity credentials", creds.AccessKeyID, err)
+		}
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		isolateAWS(t)
+		var probes atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probes.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer srv.Close()
+		metadataEndpoints.aws = srv.URL
+
+		for range 2 {
+			if _, _, err := awsCredentials.retrieve(ctx, Provider{}); err == nil {
+				t.Fatal("expected error without credentials")
+			}
+		}
+		if got := probes.Load(); got != 1 {
+			t.Errorf("expected the failed lookup to be remembered, got %d probes", got)
+		}
+	})
+}
+
+func TestAWSCredentials_AssumeRole(t *testing.T) {
+	isolateAWS(t)
+	calls := fakeSTSServer(t, func(r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=AKIDBASE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-central-1/sts/") {
+			t.Errorf("expected STS call signed with base keys, got %q",
+				r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/eu-central-1" {
+			t.Errorf("expected regional STS endpoint, got %s", r.URL.Path)
+		}
+		if r.Form.Get("Action") != "AssumeRole" || r.Form.Get("ExternalId") != "tenant" {
+			t.Errorf("unexpected assume role form %v", r.Form)
+		}
+	})
+
+	provider := Provider{
+		AWSRegion:            "eu-central-1",
+		AWSAccessKeyID:       "AKIDBASE",
+		AWSSecretAccessKey:   "secret",
+		AssumeRoleARN:        "arn:aws:iam::123456789012:role/bedrock",
+		AssumeRoleExternalID: "tenant",
+	}
+	for range 2 {
+		creds, _, err := awsCredentials.retrieve(context.Background(), provider)
+		if err != nil || creds.AccessKeyID != "AKIDASSUMEROLE" || creds.SessionToken != "token" {
+			t.Fatalf("got %+v, %v; want assumed role credentials", creds, err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected assumed credentials to be cached, got %d STS calls", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://bedrock/model/m/invoke", nil)
+	(&RetryTransport{logger: log.New(io.Discard)}).signAWSRequest(req, provider)
+	if !strings.Contains(req.Header.Get("Authorization"), "Credential=AKIDASSUMEROLE/") {
+		t.Errorf("expected request signed with the assumed role, got %q",
+			req.Header.Get("Authorization"))
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
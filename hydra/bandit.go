@@ -0,0 +1,100 @@
+package hydra
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+)
+
+// Bandit decisions: how the model leading a request was chosen.
+const (
+	banditUnmeasured = "unmeasured" // Too few attempts to be scored
+	banditExplore    = "explore"    // Random pick from the exploration budget
+	banditExploit    = "exploit"    // Best score
+)
+
+// BanditConfig tunes the experimental bandit strategy. Each request is led by
+// the model with the best score, or by a random other model for an
+// exploration share of requests. When no weight is set, success_weight 1,
+// latency_weight 0.5, and cost_weight 0.25 are used.
+type BanditConfig struct {
+	Exploration   float64 `mapstructure:"exploration"`    // Share of requests exploring, default 0.1
+	MinAttempts   int64   `mapstructure:"min_attempts"`   // Attempts before scoring, default 5
+	SuccessWeight float64 `mapstructure:"success_weight"` // Reward for the success rate
+	LatencyWeight float64 `mapstructure:"latency_weight"` // Penalty for relative latency
+	CostWeight    float64 `mapstructure:"cost_weight"`    // Penalty for relative price
+}
+
+// banditDecision describes the choice of a request's leading model for logs.
+type banditDecision struct {
+	Model  string
+	Reason string
+	Score  float64
+}
+
+// banditOrder orders models for the bandit strategy. Models with fewer than
+// min_attempts recorded attempts lead in configured order so they get
+// measured; the others follow by descending score. With probability
+// exploration, a random model other than the best one leads instead.
+func banditOrder(cfg BanditConfig, models []Model) ([]Model, banditDecision) {
+	var unmeasured, scored []Model
+	for _, m := range models {
+		if modelHealth.get(m.ID).Attempts < cfg.MinAttempts {
+			unmeasured = append(unmeasured, m)
+		} else {
+			scored = append(scored, m)
+		}
+	}
+
+	scores := banditScores(cfg, scored)
+	slices.SortStableFunc(scored, func(a, b Model) int {
+		return cmp.Compare(scores[b.ID], scores[a.ID])
+	})
+	ordered := append(unmeasured, scored...)
+	if len(ordered) == 0 {
+		return ordered, banditDecision{}
+	}
+	if len(unmeasured) > 0 {
+		return ordered, banditDecision{Model: ordered[0].ID, Reason: banditUnmeasured}
+	}
+
+	reason := banditExploit
+	if len(ordered) > 1 && rand.Float64() < cfg.Exploration {
+		pick := 1 + rand.IntN(len(ordered)-1)
+		lead := ordered[pick]
+		ordered = append([]Model{lead}, slices.Delete(ordered, pick, pick+1)...)
+		reason = banditExplore
+	}
+	return ordered, banditDecision{
+		Model:  ordered[0].ID,
+		Reason: reason,
+		Score:  scores[ordered[0].ID],
+	}
+}
+
+// banditScores scores models by weighted success rate minus their latency
+// and price relative to the slowest and most expensive of them.
+func banditScores(cfg BanditConfig, models []Model) map[string]float64 {
+	var maxLatency, maxPrice float64
+	for _, m := range models {
+		maxLatency = max(maxLatency, modelHealth.get(m.ID).LatencyMS)
+		maxPrice = max(maxPrice, m.Price.InputPer1K+m.Price.OutputPer1K)
+	}
+
+	scores := make(map[string]float64, len(models))
+	for _, m := range models {
+		h := modelHealth.get(m.ID)
+		var success, latency, price float64
+		if h.Attempts > 0 {
+			success = float64(h.Attempts-h.Failures) / float64(h.Attempts)
+		}
+		if maxLatency > 0 {
+			latency = h.LatencyMS / maxLatency
+		}
+		if maxPrice > 0 {
+			price = (m.Price.InputPer1K + m.Price.OutputPer1K) / maxPrice
+		}
+		scores[m.ID] = cfg.SuccessWeight*success - cfg.LatencyWeight*latency - cfg.CostWeight*price
+	}
+	return scores
+}
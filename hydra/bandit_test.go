@@ -0,0 +1,66 @@
+package hydra
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBanditOrder(t *testing.T) {
+	modelHealth = newHealthTracker()
+	t.Cleanup(func() { modelHealth = newHealthTracker() })
+
+	for range 4 {
+		modelHealth.recordSuccess("reliable", 200, 100*time.Millisecond)
+		modelHealth.recordSuccess("cheap", 200, 100*time.Millisecond)
+		modelHealth.recordFailure("flaky", 503, "unavailable")
+	}
+	modelHealth.recordSuccess("new", 200, time.Second)
+	models := []Model{
+		{ID: "flaky"},
+		{ID: "reliable", Price: ModelPrice{InputPer1K: 1}},
+		{ID: "new"},
+		{ID: "cheap"},
+	}
+	cfg := BanditConfig{MinAttempts: 2, SuccessWeight: 1, CostWeight: 0.5}
+
+	t.Run("unmeasured models lead", func(t *testing.T) {
+		got, decision := banditOrder(cfg, models)
+		want := []string{"new", "cheap", "reliable", "flaky"}
+		if !slices.Equal(modelIDs(got), want) {
+			t.Errorf("expected %v, got %v", want, modelIDs(got))
+		}
+		if decision.Model != "new" || decision.Reason != banditUnmeasured {
+			t.Errorf("unexpected decision %+v", decision)
+		}
+	})
+
+	measured := slices.DeleteFunc(slices.Clone(models), func(m Model) bool {
+		return m.ID == "new"
+	})
+
+	t.Run("exploit best score", func(t *testing.T) {
+		got, decision := banditOrder(cfg, measured)
+		want := []string{"cheap", "reliable", "flaky"}
+		if !slices.Equal(modelIDs(got), want) {
+			t.Errorf("expected %v, got %v", want, modelIDs(got))
+		}
+		if decision.Model != "cheap" || decision.Reason != banditExploit || decision.Score != 1 {
+			t.Errorf("unexpected decision %+v", decision)
+		}
+	})
+
+	t.Run("explore other models", func(t *testing.T) {
+		explore := cfg
+		explore.Exploration = 1
+		for range 20 {
+			got, decision := banditOrder(explore, measured)
+			if len(got) != 3 || got[0].ID == "cheap" || decision.Reason != banditExplore {
+				t.Fatalf("expected a model other than the best to lead, got %v", modelIDs(got))
+			}
+			if decision.Model != got[0].ID {
+				t.Errorf("expected decision for %s, got %+v", got[0].ID, decision)
+			}
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package hydra
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"regexp"
+)
+
+// bedrockModelSegment matches the model of a Bedrock invoke path.
+var bedrockModelSegment = regexp.MustCompile(`/model/[^/]+/`)
+
+// bedrockMaxFrame bounds the size of one event stream message.
+const bedrockMaxFrame = 16 * 1024 * 1024
+
+// bedrockModelPath replaces the model of a native Bedrock request path.
+func bedrockModelPath(path, model string) string {
+	return bedrockModelSegment.ReplaceAllLiteralString(path, "/model/"+model+"/")
+}
+
+// bedrockInvokePath returns the invoke path of a model below basePath.
+func bedrockInvokePath(basePath, model string, isStreaming bool) string {
+	method := "/invoke"
+	if isStreaming {
+		method = "/invoke-with-response-stream"
+	}
+	return basePath + "/model/" + model + method
+}
+
+// bedrockStreamBody is a Bedrock event stream decoded to Anthropic SSE.
+type bedrockStreamBody struct {
+	*io.PipeReader
+	upstream io.Closer
+}
+
+func (b bedrockStreamBody) Close() error {
+	_ = b.PipeReader.Close()
+	return b.upstream.Close()
+}
+
+// newBedrockStreamBody decodes an invoke-with-response-stream body, which
+// carries each Anthropic event base64 encoded in an AWS event stream message,
+// into the Anthropic SSE stream it wraps.
+func newBedrockStreamBody(upstream io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer func() { _ = upstream.Close() }()
+		pw.CloseWithError(decodeBedrockStream(upstream, pw))
+	}()
+	return bedrockStreamBody{PipeReader: pr, upstream: upstream}
+}
+
+// decodeBedrockStream writes the events of a Bedrock event stream as SSE.
+// Exception messages become Anthropic error events.
+func decodeBedrockStream(r io.Reader, w io.Writer) error {
+	for {
+		headers, payload, err := readEventStreamMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var event []byte
+		if headers[":message-type"] == "exception" {
+			var exc struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(payload, &exc)
+			event, err = json.Marshal(map[string]any{
+				"type": "error",
+				"error": map[string]string{
+					"type":    headers[":exception-type"],
+					"message": exc.Message,
+				},
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			var chunk struct {
+				Bytes string `json:"bytes"`
+			}
+			if err := json.Unmarshal(payload, &chunk); err != nil || chunk.Bytes == "" {
+				continue
+			}
+			event, err = base64.StdEncoding.DecodeString(chunk.Bytes)
+			if err != nil {
+				return fmt.Errorf("invalid bedrock stream chunk: %w", err)
+			}
+		}
+
+		var typed struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(event, &typed)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event); err != nil {
+			return err
+		}
+	}
+}
+
+// readEventStreamMessage reads one message of the AWS event stream encoding:
+// a prelude of total and header lengths with its CRC, the headers, the
+// payload, and a CRC of the whole message. Only string headers are returned.
+func readEventStreamMessage(r io.Reader) (map[string]string, []byte, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r, prelude[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, fmt.Errorf("truncated bedrock stream message: %w", err)
+		}
+		return nil, nil, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, nil, errors.New("bedrock stream prelude checksum mismatch")
+	}
+	if total > bedrockMaxFrame || uint64(headersLen)+16 > uint64(total) {
+		return nil, nil, fmt.Errorf("invalid bedrock stream message length %d", total)
+	}
+
+	msg := make([]byte, total)
+	copy(msg, prelude[:])
+	if _, err := io.ReadFull(r, msg[12:]); err != nil {
+		return nil, nil, fmt.Errorf("truncated bedrock stream message: %w", err)
+	}
+	if crc32.ChecksumIEEE(msg[:total-4]) != binary.BigEndian.Uint32(msg[total-4:]) {
+		return nil, nil, errors.New("bedrock stream message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(msg[12 : 12+headersLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, msg[12+headersLen : total-4], nil
+}
+
+// eventStreamHeaderSizes is the value size of fixed-width header types,
+// indexed by type.
+var eventStreamHeaderSizes = [...]int{0, 0, 1, 2, 4, 8, -1, -1, 8, 16}
+
+// parseEventStreamHeaders returns the string headers of an event stream message.
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	errInvalid := errors.New("invalid bedrock stream message headers")
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 2+nameLen {
+			return nil, errInvalid
+		}
+		name := string(b[1 : 1+nameLen])
+		typ := int(b[1+nameLen])
+		b = b[2+nameLen:]
+		if typ >= len(eventStreamHeaderSizes) {
+			return nil, errInvalid
+		}
+
+		size := eventStreamHeaderSizes[typ]
+		if size < 0 {
+			// Byte array and string values are length prefixed
+			if len(b) < 2 {
+				return nil, errInvalid
+			}
+			size = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+			if len(b) < size {
+				return nil, errInvalid
+			}
+			if typ == 7 {
+				headers[name] = string(b[:size])
+			}
+		} else if len(b) < size {
+			return nil, errInvalid
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
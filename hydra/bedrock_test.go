@@ -0,0 +1,231 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// encodeEventStreamMessage encodes an event stream message with string headers.
+func encodeEventStreamMessage(headers map[string]string, payload []byte) []byte {
+	var hb bytes.Buffer
+	for name, value := range headers {
+		hb.WriteByte(byte(len(name)))
+		hb.WriteString(name)
+		hb.WriteByte(7)
+		_ = binary.Write(&hb, binary.BigEndian, uint16(len(value)))
+		hb.WriteString(value)
+	}
+
+	total := 16 + hb.Len() + len(payload)
+	msg := make([]byte, 12, total)
+	binary.BigEndian.PutUint32(msg[0:4], uint32(total))
+	binary.BigEndian.PutUint32(msg[4:8], uint32(hb.Len()))
+	binary.BigEndian.PutUint32(msg[8:12], crc32.ChecksumIEEE(msg[:8]))
+	msg = append(msg, hb.Bytes()...)
+	msg = append(msg, payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+// bedrockStreamFixture encodes the events of anthropicStreamFixture as a
+// Bedrock invoke-with-response-stream body.
+func bedrockStreamFixture() []byte {
+	var out []byte
+	for line := range strings.Lines(anthropicStreamFixture) {
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+		payload := `{"bytes":"` + base64.StdEncoding.EncodeToString([]byte(data)) + `"}`
+		out = append(out, encodeEventStreamMessage(map[string]string{
+			":event-type":   "chunk",
+			":message-type": "event",
+		}, []byte(payload))...)
+	}
+	return out
+}
+
+func TestBedrockModelPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		model string
+		want  string
+	}{
+		{"/model/claude/invoke", "anthropic.claude-v2", "/model/anthropic.claude-v2/invoke"},
+		{
+			"/model/claude/invoke-with-response-stream",
+			"anthropic.claude-v2",
+			"/model/anthropic.claude-v2/invoke-with-response-stream",
+		},
+		{"/other", "m", "/other"},
+	}
+	for _, tt := range tests {
+		if got := bedrockModelPath(tt.path, tt.model); got != tt.want {
+			t.Errorf("bedrockModelPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeBedrockStream(t *testing.T) {
+	t.Run("events", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := decodeBedrockStream(bytes.NewReader(bedrockStreamFixture()), &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(out.String(), "event: message_start\ndata: {\"type\":\"message_start\"") {
+			t.Errorf("expected message_start event first, got %s", out.String())
+		}
+		if !strings.Contains(out.String(), `"text":"Hel"`) {
+			t.Errorf("expected decoded text delta, got %s", out.String())
+		}
+	})
+
+	t.Run("exception", func(t *testing.T) {
+		msg := encodeEventStreamMessage(map[string]string{
+			":message-type":   "exception",
+			":exception-type": "throttlingException",
+		}, []byte(`{"message":"slow down"}`))
+		var out bytes.Buffer
+		if err := decodeBedrockStream(bytes.NewReader(msg), &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "event: error\ndata: {\"error\":{\"message\":\"slow down\"," +
+			"\"type\":\"throttlingException\"},\"type\":\"error\"}\n\n"
+		if out.String() != want {
+			t.Errorf("got %q, want %q", out.String(), want)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		msg := bedrockStreamFixture()
+		msg[len(msg)-1] ^= 0xff
+		if err := decodeBedrockStream(bytes.NewReader(msg), io.Discard); err == nil {
+			t.Error("expected checksum error")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		msg := bedrockStreamFixture()
+		if err := decodeBedrockStream(bytes.NewReader(msg[:20]), io.Discard); err == nil {
+			t.Error("expected truncation error")
+		}
+	})
+}
+
+func TestTransport_RoundTrip_TranslatesBedrockStream(t *testing.T) {
+	var gotPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		_, _ = w.Write(bedrockStreamFixture())
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "bedrock-stream",
+			Provider: "bedrock-stream",
+			Model:    "anthropic.claude-v2",
+			Type:     "bedrock",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"bedrock-stream": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"stream":true,"messages":[{"role":"user","content":"hello"}]}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if gotPath != "/model/anthropic.claude-v2/invoke-with-response-stream" {
+		t.Errorf("unexpected upstream path %s", gotPath)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %s", ct)
+	}
+	if !strings.Contains(string(body), `"content":"Hel"`) {
+		t.Errorf("expected translated text delta, got %s", body)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("expected [DONE] terminator, got %s", body)
+	}
+}
+
+func TestTransport_RoundTrip_BedrockNativeUsesConfiguredModel(t *testing.T) {
+	var gotPath, gotBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		_, _ = w.Write([]byte(`{"id":"msg_1"}`))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "bedrock-native",
+			Provider: "bedrock-native",
+			Model:    "anthropic.claude-v2",
+			Type:     "bedrock",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"bedrock-native": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	reqBody := `{"anthropic_version":"bedrock-2023-05-31","max_tokens":10,"messages":[]}`
+	req, _ := http.NewRequest(
+		"POST",
+		"http://original/model/claude/invoke",
+		strings.NewReader(reqBody),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if gotPath != "/model/anthropic.claude-v2/invoke" {
+		t.Errorf("unexpected upstream path %s", gotPath)
+	}
+	if gotBody != reqBody {
+		t.Errorf("expected body forwarded unchanged, got %s", gotBody)
+	}
+}
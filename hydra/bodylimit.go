@@ -0,0 +1,72 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxBodySize is the default max_body_size of a listener.
+const defaultMaxBodySize = 100 * 1024 * 1024
+
+// maxBodySize returns the request body limit of a listener.
+func (l *Listener) maxBodySize() int64 {
+	if l.MaxBodySize > 0 {
+		return l.MaxBodySize
+	}
+	return defaultMaxBodySize
+}
+
+// limitBody answers requests declaring a body over the listener's
+// max_body_size with 413, and makes reading past the limit fail for bodies of
+// unknown length.
+func limitBody(l *Listener, next http.Handler) http.Handler {
+	limit := l.maxBodySize()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			writeBodyTooLarge(w, limit)
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether err comes from reading a body past its limit.
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// writeBodyReadError answers a request whose body failed to read: 413 when it
+// exceeds the listener's max_body_size, else 400.
+func writeBodyReadError(w http.ResponseWriter, l *Listener, err error) {
+	if isBodyTooLarge(err) {
+		writeBodyTooLarge(w, l.maxBodySize())
+		return
+	}
+	http.Error(w, "failed to read request body", http.StatusBadRequest)
+}
+
+// writeBodyTooLarge answers with 413 and a JSON error naming the limit.
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = w.Write(bodyTooLargeError(limit))
+}
+
+// bodyTooLargeError returns the JSON error body of a request over limit.
+func bodyTooLargeError(limit int64) []byte {
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"type":    "invalid_request_error",
+			"code":    "request_too_large",
+			"message": fmt.Sprintf("request body exceeds the limit of %d bytes", limit),
+			"limit":   limit,
+		},
+	})
+	return body
+}
@@ -0,0 +1,110 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestLimitBody(t *testing.T) {
+	l := &Listener{Name: "body-limit", MaxBodySize: 10}
+	var got string
+	h := limitBody(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyReadError(w, l, err)
+			return
+		}
+		got = string(body)
+	}))
+
+	tests := []struct {
+		name   string
+		body   string
+		length int64 // -1 for a body of unknown length
+		status int
+	}{
+		{"within limit", "0123456789", 10, http.StatusOK},
+		{"declared over limit", "0123456789a", 11, http.StatusRequestEntityTooLarge},
+		{"chunked over limit", "0123456789a", -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			body := strings.NewReader(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", body)
+			req.ContentLength = tt.length
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK {
+				if got != tt.body {
+					t.Errorf("expected body %q, got %q", tt.body, got)
+				}
+				return
+			}
+			code := gjson.Get(rec.Body.String(), "error.code").String()
+			if code != "request_too_large" {
+				t.Errorf("expected request_too_large error, got %s", rec.Body.String())
+			}
+			if limit := gjson.Get(rec.Body.String(), "error.limit").Int(); limit != 10 {
+				t.Errorf("expected limit 10, got %d", limit)
+			}
+		})
+	}
+}
+
+func TestTransport_RoundTrip_BodyTooLarge(t *testing.T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	providers := map[string]Provider{
+		"body-limit": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+	}
+	l := &Listener{
+		Name:        "body-limit",
+		MaxBodySize: 16,
+		ResolvedModels: []Model{
+			{
+				ID:       "m",
+				Provider: "body-limit",
+				Model:    "m",
+				Type:     "openai",
+				Attempts: 1,
+				Timeout:  time.Second,
+			},
+		},
+	}
+	transport := newListenerTransport(l, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+
+	for body, status := range map[string]int{
+		`{"model":"m"}`:                     http.StatusOK,
+		`{"model":"m","messages":["long"]}`: http.StatusRequestEntityTooLarge,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: expected %d, got %d", body, status, resp.StatusCode)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected only the request within the limit upstream, got %d calls", calls)
+	}
+}
@@ -0,0 +1,364 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// broadcastObserverBuffer is the number of events queued for an observer
+// before further events are dropped for it.
+const broadcastObserverBuffer = 256
+
+// broadcastKeepAlive is how often an idle observer stream gets a comment, so
+// proxies keep it open and it ends soon after shutdown begins.
+const broadcastKeepAlive = 15 * time.Second
+
+// Broadcast event types.
+const (
+	BroadcastRequest = "request" // A request of the session arrived
+	BroadcastData    = "data"    // Part of its response was written to the client
+	BroadcastEnd     = "end"     // Its response is complete
+)
+
+// broadcasts holds the broadcast sessions of all listeners.
+var broadcasts = newBroadcastHub()
+
+var broadcastDroppedCounter = metrics.Counter(
+	"hydrallm_broadcast_dropped_total",
+	"Broadcast events dropped for observers too slow to keep up, by listener.",
+)
+
+// BroadcastConfig configures broadcast sessions for a listener, whose
+// responses are delivered both to the client and to observers attached
+// through the admin API. Sessions are disabled unless enabled is set.
+type BroadcastConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Header  string `mapstructure:"header"` // Header carrying the session ID
+}
+
+// BroadcastEvent is part of an exchange of a broadcast session, as sent to
+// its observers.
+type BroadcastEvent struct {
+	Time      time.Time       `json:"time"`
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id,omitempty"`
+	Path      string          `json:"path,omitempty"`
+	Model     string          `json:"model,omitempty"` // Requested model
+	Request   json.RawMessage `json:"request,omitempty"`
+	Data      string          `json:"data,omitempty"` // Response bytes as written
+	Status    int             `json:"status,omitempty"`
+	Duration  float64         `json:"duration_seconds,omitempty"`
+}
+
+// BroadcastSession describes a session with observers or requests in flight.
+type BroadcastSession struct {
+	ID        string `json:"id"`
+	Observers int    `json:"observers"`
+	Active    int    `json:"active"` // Requests in flight
+}
+
+// broadcastKey names a session of a listener.
+type broadcastKey struct {
+	listener string
+	id       string
+}
+
+type broadcastSession struct {
+	observers map[chan BroadcastEvent]struct{}
+	active    int
+}
+
+// broadcastHub fans the events of each session out to its observers.
+type broadcastHub struct {
+	mu       sync.Mutex
+	sessions map[broadcastKey]*broadcastSession
+}
+
+func newBroadcastHub() *broadcastHub {
+	return &broadcastHub{sessions: make(map[broadcastKey]*broadcastSession)}
+}
+
+// session returns the session of key, creating it. Callers hold h.mu.
+func (h *broadcastHub) session(key broadcastKey) *broadcastSession {
+	s, ok := h.sessions[key]
+	if !ok {
+		s = &broadcastSession{observers: make(map[chan BroadcastEvent]struct{})}
+		h.sessions[key] = s
+	}
+	return s
+}
+
+// release forgets the session of key once it is unused. Callers hold h.mu.
+func (h *broadcastHub) release(key broadcastKey, s *broadcastSession) {
+	if len(s.observers) == 0 && s.active == 0 {
+		delete(h.sessions, key)
+	}
+}
+
+// subscribe attaches an observer to a session, which may not have started
+// yet. The returned function detaches it.
+func (h *broadcastHub) subscribe(listener, id string) (<-chan BroadcastEvent, func()) {
+	key := broadcastKey{listener, id}
+	ch := make(chan BroadcastEvent, broadcastObserverBuffer)
+	h.mu.Lock()
+	h.session(key).observers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if s, ok := h.sessions[key]; ok {
+			delete(s.observers, ch)
+			h.release(key, s)
+		}
+	}
+}
+
+// begin marks a request of a session in flight until the returned function
+// is called.
+func (h *broadcastHub) begin(listener, id string) func() {
+	key := broadcastKey{listener, id}
+	h.mu.Lock()
+	h.session(key).active++
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if s, ok := h.sessions[key]; ok {
+			s.active--
+			h.release(key, s)
+		}
+	}
+}
+
+// publish sends an event to the observers of a session without waiting on
+// them, and returns the number of observers it was dropped for.
+func (h *broadcastHub) publish(listener, id string, e BroadcastEvent) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[broadcastKey{listener, id}]
+	if !ok {
+		return 0
+	}
+	dropped := 0
+	for ch := range s.observers {
+		select {
+		case ch <- e:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// list returns the sessions of a listener, sorted by ID.
+func (h *broadcastHub) list(listener string) []BroadcastSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sessions := []BroadcastSession{}
+	for key, s := range h.sessions {
+		if key.listener == listener {
+			sessions = append(sessions, BroadcastSession{
+				ID:        key.id,
+				Observers: len(s.observers),
+				Active:    s.active,
+			})
+		}
+	}
+	slices.SortFunc(sessions, func(a, b BroadcastSession) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return sessions
+}
+
+// newBroadcastMiddleware delivers each exchange that carries a session ID to
+// the observers of that session as it happens: the request, each write of
+// the response, and its end.
+func newBroadcastMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if !l.Broadcast.Enabled {
+		return nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(l.Broadcast.Header)
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !isValidConversationID(id) {
+				logger.Debug("ignoring invalid broadcast session ID", "listener", l.Name, "id", id)
+				next.ServeHTTP(w, r)
+				return
+			}
+			end := broadcasts.begin(l.Name, id)
+			defer end()
+
+			var reqBody []byte
+			if r.Body != nil {
+				var err error
+				reqBody, err = io.ReadAll(io.LimitReader(r.Body, corpusMaxCapture))
+				if err != nil {
+					writeBodyReadError(w, l, err)
+					return
+				}
+				// Larger bodies are forwarded in full, only their start is broadcast
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+			}
+
+			rid := requestID(r.Context())
+			publish := func(e BroadcastEvent) {
+				e.Time, e.RequestID = time.Now().UTC(), rid
+				if dropped := broadcasts.publish(l.Name, id, e); dropped > 0 {
+					broadcastDroppedCounter.Add(float64(dropped), "listener", l.Name)
+				}
+			}
+			start := time.Now()
+			publish(BroadcastEvent{
+				Type:    BroadcastRequest,
+				Path:    r.URL.Path,
+				Model:   requestedModel(reqBody),
+				Request: transcriptBody(reqBody),
+			})
+			bw := &broadcastResponseWriter{
+				ResponseWriter: w,
+				status:         http.StatusOK,
+				publish:        publish,
+			}
+			next.ServeHTTP(bw, r)
+			publish(BroadcastEvent{
+				Type:     BroadcastEnd,
+				Status:   bw.status,
+				Duration: time.Since(start).Seconds(),
+			})
+		})
+	}
+}
+
+// broadcastResponseWriter publishes each write of the response body while
+// passing it through. Bodies the upstream encoded are not published.
+type broadcastResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	publish     func(BroadcastEvent)
+}
+
+func (w *broadcastResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *broadcastResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	if n > 0 && w.Header().Get("Content-Encoding") == "" {
+		w.publish(BroadcastEvent{Type: BroadcastData, Data: string(p[:n])})
+	}
+	return n, err
+}
+
+// Flush flushes the underlying writer so streams are not delayed.
+func (w *broadcastResponseWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// broadcastListener reports whether the named listener has broadcast sessions.
+func broadcastListener(cfg *Config, name string) bool {
+	for _, l := range cfg.Listeners {
+		if l.Name == name && l.Broadcast.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// handleBroadcast serves the admin broadcast API for the listener named in
+// the path: listing its sessions, or attaching to one as an observer. An
+// observer gets the session's events as server-sent events until it
+// disconnects.
+func handleBroadcast(config func() *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		listener := r.PathValue("listener")
+		if !broadcastListener(config(), listener) {
+			writeJSON(w, http.StatusNotFound, map[string]string{
+				"error": "listener has no broadcast sessions enabled",
+			})
+			return
+		}
+
+		id := r.PathValue("id")
+		if id == "" {
+			writeJSON(w, http.StatusOK, map[string]any{"sessions": broadcasts.list(listener)})
+			return
+		}
+		if !isValidConversationID(id) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid session ID"})
+			return
+		}
+
+		events, detach := broadcasts.subscribe(listener, id)
+		defer detach()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(broadcastKeepAlive)
+		defer ticker.Stop()
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				// Shutdown waits for open requests, so streams end once it begins
+				if !serverReady.Load() {
+					return
+				}
+				_, err = io.WriteString(w, ": keep-alive\n\n")
+			case e := <-events:
+				var data []byte
+				if data, err = json.Marshal(e); err == nil {
+					_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+				}
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// validateBroadcast checks a listener's broadcast settings.
+func validateBroadcast(l *Listener) error {
+	if l.Broadcast.Enabled && !slices.Contains(l.ResolvedMiddleware, "broadcast") {
+		return errors.New("broadcast is enabled but the broadcast middleware is not enabled")
+	}
+	return nil
+}
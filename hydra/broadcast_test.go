@@ -0,0 +1,159 @@
+package hydra
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestBroadcastMiddleware(t *testing.T) {
+	l := &Listener{
+		Name:      "broadcast-main",
+		Broadcast: BroadcastConfig{Enabled: true, Header: "X-Broadcast-Session"},
+	}
+	mw := newBroadcastMiddleware(l, &Config{}, log.New(io.Discard))
+	if mw == nil {
+		t.Fatal("expected broadcast middleware")
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: one\n\n"))
+		_, _ = w.Write([]byte("data: two\n\n"))
+	}))
+
+	events, detach := broadcasts.subscribe(l.Name, "run-1")
+	defer detach()
+	others, detachOthers := broadcasts.subscribe(l.Name, "run-2")
+	defer detachOthers()
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt","stream":true}`),
+	)
+	req.Header.Set("X-Broadcast-Session", "run-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != "data: one\n\ndata: two\n\n" {
+		t.Errorf("expected the client to get the whole response, got %q", rec.Body.String())
+	}
+
+	var got []BroadcastEvent
+	for range 4 {
+		got = append(got, <-events)
+	}
+	if got[0].Type != BroadcastRequest || got[0].Model != "gpt" ||
+		string(got[0].Request) != `{"model":"gpt","stream":true}` {
+		t.Errorf("unexpected request event: %+v", got[0])
+	}
+	if got[1].Data != "data: one\n\n" || got[2].Data != "data: two\n\n" {
+		t.Errorf("unexpected data events: %+v %+v", got[1], got[2])
+	}
+	if got[3].Type != BroadcastEnd || got[3].Status != http.StatusOK {
+		t.Errorf("unexpected end event: %+v", got[3])
+	}
+	if len(others) != 0 {
+		t.Errorf("expected no events for another session, got %d", len(others))
+	}
+}
+
+func TestBroadcastMiddleware_Disabled(t *testing.T) {
+	if newBroadcastMiddleware(&Listener{}, &Config{}, log.New(io.Discard)) != nil {
+		t.Error("expected no middleware without broadcast enabled")
+	}
+}
+
+func TestValidateBroadcast(t *testing.T) {
+	l := &Listener{Broadcast: BroadcastConfig{Enabled: true}}
+	if err := validateBroadcast(l); err == nil {
+		t.Error("expected error without the broadcast middleware")
+	}
+	l.ResolvedMiddleware = defaultMiddlewareOrder
+	if err := validateBroadcast(l); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBroadcastHub(t *testing.T) {
+	hub := newBroadcastHub()
+	events, detach := hub.subscribe("main", "run-1")
+	end := hub.begin("main", "run-2")
+
+	sessions := hub.list("main")
+	if len(sessions) != 2 || sessions[0].ID != "run-1" || sessions[0].Observers != 1 ||
+		sessions[1].Active != 1 {
+		t.Errorf("unexpected sessions: %+v", sessions)
+	}
+
+	// A slow observer never holds up the client
+	for range broadcastObserverBuffer {
+		hub.publish("main", "run-1", BroadcastEvent{Type: BroadcastData})
+	}
+	if dropped := hub.publish("main", "run-1", BroadcastEvent{}); dropped != 1 {
+		t.Errorf("expected the event dropped for a full observer, got %d", dropped)
+	}
+	if len(events) != broadcastObserverBuffer {
+		t.Errorf("expected %d queued events, got %d", broadcastObserverBuffer, len(events))
+	}
+
+	detach()
+	end()
+	if sessions := hub.list("main"); len(sessions) != 0 {
+		t.Errorf("expected unused sessions to be forgotten, got %+v", sessions)
+	}
+}
+
+func TestAdminHandler_Broadcast(t *testing.T) {
+	cfg := testAdminConfig()
+	cfg.Listeners[0].Name = "broadcast-admin"
+	cfg.Listeners[0].Broadcast = BroadcastConfig{Enabled: true}
+	srv := httptest.NewServer(newAdminHandler(func() *Config { return cfg }))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/broadcast/other")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a listener without broadcast, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/broadcast/broadcast-admin/run-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	resp2, err := http.Get(srv.URL + "/broadcast/broadcast-admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var list struct {
+		Sessions []BroadcastSession `json:"sessions"`
+	}
+	err = json.NewDecoder(resp2.Body).Decode(&list)
+	_ = resp2.Body.Close()
+	if err != nil || len(list.Sessions) != 1 || list.Sessions[0].Observers != 1 {
+		t.Errorf("expected the observed session, got %+v (%v)", list.Sessions, err)
+	}
+
+	broadcasts.publish("broadcast-admin", "run-1", BroadcastEvent{Type: BroadcastData, Data: "hi"})
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 || lines[0] != "event: data" || !strings.Contains(lines[1], `"data":"hi"`) {
+		t.Errorf("unexpected event: %q", lines)
+	}
+}
@@ -0,0 +1,355 @@
+package hydra
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Cache backends.
+const (
+	cacheBackendMemory = "memory"
+	cacheBackendRedis  = "redis"
+)
+
+// cacheRedisTimeout bounds each Redis command so a slow cache never stalls requests.
+const cacheRedisTimeout = 500 * time.Millisecond
+
+// cacheablePaths are the endpoint suffixes whose non-streaming responses are cached.
+var cacheablePaths = []string{
+	"/chat/completions",
+	"/completions",
+	"/embeddings",
+	"/messages",
+	"/invoke",
+}
+
+var cacheRequestsCounter = metrics.Counter(
+	"hydrallm_cache_requests_total",
+	"Cacheable requests by listener and result (hit, miss, bypass).",
+)
+
+// CacheConfig configures response caching for a listener.
+// Caching is disabled when no backend is set.
+type CacheConfig struct {
+	Backend      string        `mapstructure:"backend"`       // memory or redis
+	MaxEntries   int           `mapstructure:"max_entries"`   // Memory backend size, default 1000
+	TTL          time.Duration `mapstructure:"ttl"`           // Entry lifetime, default 1h
+	RedisURL     string        `mapstructure:"redis_url"`     // redis://[user:password@]host[:port][/db]
+	BypassHeader string        `mapstructure:"bypass_header"` // Skips the cache when set on a request
+}
+
+// cacheStore stores cached responses by key.
+type cacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// cachedResponse is a stored upstream response.
+type cachedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// newCacheMiddleware serves repeated non-streaming completion and embedding
+// requests from the listener's cache.
+func newCacheMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if l.Cache.Backend == "" {
+		return nil
+	}
+	store, err := newCacheStore(l.Cache)
+	if err != nil {
+		// Settings are checked during validation, so this is not expected
+		logger.Error("cache disabled", "listener", l.Name, "error", err)
+		return nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || !isCacheablePath(r.URL.Path) || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Header.Get(l.Cache.BypassHeader) != "" {
+				cacheRequestsCounter.Inc("listener", l.Name, "result", "bypass")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, corpusMaxCapture))
+			if err != nil {
+				writeBodyReadError(w, l, err)
+				return
+			}
+			// Oversized bodies are passed through in full but not cached
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+			r, scope := cacheScope(l, r, body)
+			key, ok := cacheKey(body, append([]string{l.Name, r.URL.Path}, scope...)...)
+			if !ok || len(body) >= corpusMaxCapture || isStreamingRequest(r, body) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if cached, found := lookupCache(store, key, logger); found {
+				cacheRequestsCounter.Inc("listener", l.Name, "result", "hit")
+				w.Header().Set("Content-Type", cached.ContentType)
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(cached.Status)
+				_, _ = w.Write(cached.Body)
+				return
+			}
+			cacheRequestsCounter.Inc("listener", l.Name, "result", "miss")
+
+			w.Header().Set("X-Cache", "MISS")
+			cw := &captureResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+
+			// Only complete, successful, unencoded responses are reused
+			encoding := cw.Header().Get("Content-Encoding")
+			if cw.status != http.StatusOK || (encoding != "" && encoding != "identity") ||
+				cw.body.Len() >= corpusMaxCapture {
+				return
+			}
+			entry, err := json.Marshal(cachedResponse{
+				Status:      cw.status,
+				ContentType: cw.Header().Get("Content-Type"),
+				Body:        cw.body.Bytes(),
+			})
+			if err == nil {
+				err = store.Set(key, entry, l.Cache.TTL)
+			}
+			if err != nil {
+				logger.Warn("failed to store cached response", "listener", l.Name, "error", err)
+			}
+		})
+	}
+}
+
+// validateCache checks a listener's cache settings.
+func validateCache(l *Listener) error {
+	c := l.Cache
+	switch c.Backend {
+	case "":
+		return nil
+	case cacheBackendMemory:
+	case cacheBackendRedis:
+		if c.RedisURL == "" {
+			return errors.New("cache: redis_url is required for the redis backend")
+		}
+		if _, err := newRedisClient(c.RedisURL, cacheRedisTimeout); err != nil {
+			return fmt.Errorf("cache: %w", err)
+		}
+	default:
+		return fmt.Errorf("cache: unsupported backend %q (supported: memory, redis)", c.Backend)
+	}
+
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("cache: max_entries must not be negative, got %d", c.MaxEntries)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("cache: ttl must not be negative, got %s", c.TTL)
+	}
+	if !slices.Contains(l.ResolvedMiddleware, "cache") {
+		return errors.New("cache is configured but the cache middleware is not enabled")
+	}
+	return nil
+}
+
+// newCacheStore creates the backend configured for a listener.
+func newCacheStore(cfg CacheConfig) (cacheStore, error) {
+	switch cfg.Backend {
+	case cacheBackendMemory:
+		return newMemoryCache(cfg.MaxEntries), nil
+	case cacheBackendRedis:
+		client, err := newRedisClient(cfg.RedisURL, cacheRedisTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &redisCache{client: client}, nil
+	default:
+		return nil, errors.New("unsupported cache backend " + cfg.Backend)
+	}
+}
+
+// lookupCache returns the cached response for key. Backend errors count as
+// misses so an unavailable cache never fails requests.
+func lookupCache(store cacheStore, key string, logger *log.Logger) (cachedResponse, bool) {
+	var cached cachedResponse
+	entry, found, err := store.Get(key)
+	if err != nil {
+		logger.Warn("failed to read cached response", "error", err)
+		return cached, false
+	}
+	if !found || json.Unmarshal(entry, &cached) != nil {
+		return cached, false
+	}
+	return cached, true
+}
+
+func isCacheablePath(path string) bool {
+	for _, suffix := range cacheablePaths {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheScope returns what decides the response to a request besides its path
+// and body: the client's API key, the routing rule the request matches, and
+// its experiment variant. The variant is drawn here and kept in the request
+// context, so the request is served by the variant it is cached under.
+func cacheScope(l *Listener, r *http.Request, body []byte) (*http.Request, []string) {
+	// Listeners without authentication separate clients by their credential
+	client := apiKeyName(r.Context())
+	if client == "" {
+		client = requestAPIKey(r)
+	}
+	var rule, variant string
+	if matched := l.matchRule(r, body); matched != nil {
+		rule = matched.Name
+	}
+	if len(l.Experiment.Models) > 0 {
+		variant = drawVariant(l.Experiment)
+		r = r.WithContext(context.WithValue(r.Context(), experimentVariantContextKey{}, variant))
+	}
+	return r, []string{client, rule, variant}
+}
+
+// cacheKey hashes the scope of a request, such as its listener and path, and
+// its normalized JSON body, so requests that differ only in key order or
+// whitespace share an entry. It reports false when the body is not JSON.
+func cacheKey(body []byte, scope ...string) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return "", false
+	}
+	// Maps marshal with sorted keys
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	for _, s := range scope {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// memoryCache is an in-process LRU cache with per-entry expiry.
+type memoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // Front is most recently used
+	entries    map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryCache(maxEntries int) *memoryCache {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*memoryCacheEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// redisCache stores entries in Redis, shared by every hydrallm instance using it.
+type redisCache struct {
+	client *redisClient
+}
+
+// redisCachePrefix namespaces cache keys in a shared Redis database.
+const redisCachePrefix = "hydrallm:cache:"
+
+func (c *redisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := c.client.do("GET", redisCachePrefix+key)
+	if errors.Is(err, errRedisNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	return value, ok, nil
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := c.client.do(
+		"SET",
+		redisCachePrefix+key,
+		string(value),
+		"PX",
+		strconv.FormatInt(ttl.Milliseconds(), 10),
+	)
+	return err
+}
@@ -0,0 +1,206 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestCacheKey(t *testing.T) {
+	a, ok := cacheKey([]byte(`{"model":"m","temperature":0.5}`), "l1", "/v1/chat/completions")
+	if !ok {
+		t.Fatal("expected JSON body to produce a key")
+	}
+	b, _ := cacheKey([]byte(`{ "temperature": 0.5, "model": "m" }`), "l1", "/v1/chat/completions")
+	if a != b {
+		t.Error("expected key order and whitespace to be ignored")
+	}
+
+	for _, other := range []struct{ listener, path, body string }{
+		{"l2", "/v1/chat/completions", `{"model":"m","temperature":0.5}`},
+		{"l1", "/v1/embeddings", `{"model":"m","temperature":0.5}`},
+		{"l1", "/v1/chat/completions", `{"model":"m","temperature":0.50001}`},
+	} {
+		if k, _ := cacheKey([]byte(other.body), other.listener, other.path); k == a {
+			t.Errorf("expected a different key for %+v", other)
+		}
+	}
+
+	if _, ok := cacheKey([]byte("not json"), "l1", "/v1/chat/completions"); ok {
+		t.Error("expected no key for a non-JSON body")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := newMemoryCache(2)
+	_ = c.Set("a", []byte("1"), time.Minute)
+	_ = c.Set("b", []byte("2"), time.Minute)
+	_, _, _ = c.Get("a") // a is now most recently used
+	_ = c.Set("c", []byte("3"), time.Minute)
+
+	if _, found, _ := c.Get("b"); found {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if v, found, _ := c.Get("a"); !found || string(v) != "1" {
+		t.Errorf("expected a=1, got %q (found %v)", v, found)
+	}
+
+	_ = c.Set("expired", []byte("x"), -time.Second)
+	if _, found, _ := c.Get("expired"); found {
+		t.Error("expected expired entry to be missing")
+	}
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	})
+	l := &Listener{
+		Name: "cache-test",
+		Cache: CacheConfig{
+			Backend:      cacheBackendMemory,
+			MaxEntries:   10,
+			TTL:          time.Minute,
+			BypassHeader: "X-Cache-Bypass",
+		},
+	}
+	handler := newCacheMiddleware(l, nil, log.New(io.Discard))(next)
+
+	send := func(body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(`{"model":"m"}`, nil); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected first request to miss, got %q", rec.Header().Get("X-Cache"))
+	}
+	rec := send(`{"model":"m"}`, nil)
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != `{"choices":[]}` ||
+		rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected cached response, got %v %q", rec.Header(), rec.Body.String())
+	}
+	if got := upstreamCalls.Load(); got != 1 {
+		t.Errorf("expected 1 upstream call after a hit, got %d", got)
+	}
+
+	send(`{"model":"m"}`, http.Header{"X-Cache-Bypass": {"1"}})
+	send(`{"model":"m","stream":true}`, nil)
+	send(`{"model":"m","stream":true}`, nil)
+	if got := upstreamCalls.Load(); got != 4 {
+		t.Errorf("expected bypassed and streaming requests to reach upstream, got %d calls", got)
+	}
+	if got := metrics.value(
+		"hydrallm_cache_requests_total",
+		"listener",
+		"cache-test",
+		"result",
+		"hit",
+	); got != 1 {
+		t.Errorf("expected 1 cache hit metric, got %v", got)
+	}
+}
+
+func TestCacheMiddleware_Scope(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	var variants []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		variants = append(variants, experimentVariant(r.Context()))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	})
+	l := &Listener{
+		Name:       "cache-scope",
+		Cache:      CacheConfig{Backend: cacheBackendMemory, MaxEntries: 10, TTL: time.Minute},
+		Experiment: ExperimentConfig{Models: []string{"m2"}, Percent: 0},
+	}
+	handler := newCacheMiddleware(l, nil, log.New(io.Discard))(next)
+	send := func(key string) string {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			strings.NewReader(`{"model":"m"}`))
+		req = req.WithContext(context.WithValue(req.Context(), apiKeyNameContextKey{}, key))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Cache")
+	}
+
+	got := []string{send("alice"), send("bob"), send("alice")}
+	if !slices.Equal(got, []string{"MISS", "MISS", "HIT"}) {
+		t.Errorf("expected each key to have its own entry, got %v", got)
+	}
+	if got := upstreamCalls.Load(); got != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", got)
+	}
+	if !slices.Equal(variants, []string{variantControl, variantControl}) {
+		t.Errorf("expected the cached variant passed upstream, got %v", variants)
+	}
+}
+
+func TestCacheMiddleware_ErrorsNotCached(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstreamCalls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	l := &Listener{
+		Name:  "cache-errors",
+		Cache: CacheConfig{Backend: cacheBackendMemory, MaxEntries: 10, TTL: time.Minute},
+	}
+	handler := newCacheMiddleware(l, nil, log.New(io.Discard))(next)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{}`))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if got := upstreamCalls.Load(); got != 2 {
+		t.Errorf("expected error responses not to be cached, got %d upstream calls", got)
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   CacheConfig
+		wantErr bool
+	}{
+		{"disabled", CacheConfig{}, false},
+		{"memory", CacheConfig{Backend: "memory"}, false},
+		{"redis", CacheConfig{Backend: "redis", RedisURL: "redis://localhost:6379/1"}, false},
+		{"redis without url", CacheConfig{Backend: "redis"}, true},
+		{"redis invalid url", CacheConfig{Backend: "redis", RedisURL: "http://localhost"}, true},
+		{"unknown backend", CacheConfig{Backend: "disk"}, true},
+		{"negative ttl", CacheConfig{Backend: "memory", TTL: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Listener{Cache: tt.cache, ResolvedMiddleware: defaultMiddlewareOrder}
+			if err := validateCache(l); (err != nil) != tt.wantErr {
+				t.Errorf("validateCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("middleware disabled", func(t *testing.T) {
+		l := &Listener{Cache: CacheConfig{Backend: "memory"}, ResolvedMiddleware: []string{"recover"}}
+		if err := validateCache(l); err == nil {
+			t.Error("expected error when the cache middleware is not enabled")
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package hydra
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	defaultCatalogCheckTimeout = 30 * time.Second // Per catalog fetch
+	catalogMaxPages            = 20               // Catalog pages per fetch
+	catalogMaxBody             = 8 << 20          // Bytes read per catalog page
+)
+
+// Catalog states of a configured model.
+const (
+	catalogListed     = "listed"
+	catalogDeprecated = "deprecated"
+	catalogMissing    = "missing"
+)
+
+// catalogDeprecationFields are catalog entry fields that mark a model as
+// deprecated or scheduled for shutdown when set.
+var catalogDeprecationFields = []string{
+	"deprecated",
+	"deprecation_date",
+	"deprecated_at",
+	"expiration_date",
+	"shutdown_date",
+	"retirement_date",
+}
+
+// modelCatalogs holds the catalog state of models checked in the background.
+var modelCatalogs = newCatalogTracker()
+
+var (
+	modelMissingGauge = metrics.Gauge(
+		"hydrallm_model_missing_upstream",
+		"Whether the model is absent from its provider's model catalog (1) or listed (0).",
+	)
+	modelDeprecatedGauge = metrics.Gauge(
+		"hydrallm_model_deprecated_upstream",
+		"Whether the provider's model catalog marks the model as deprecated (1) or not (0).",
+	)
+)
+
+// CatalogCheckConfig configures periodic checks of the models served by a
+// provider against its model catalog. Checks are disabled unless an interval
+// is set.
+type CatalogCheckConfig struct {
+	Path     string        `mapstructure:"path"`     // Default: model list
+	Interval time.Duration `mapstructure:"interval"` // Time between checks
+	Timeout  time.Duration `mapstructure:"timeout"`  // Per check, default 30s
+}
+
+// catalogEntry is a model listed in a provider catalog.
+type catalogEntry struct {
+	Deprecated bool
+}
+
+type catalogTracker struct {
+	mu     sync.Mutex
+	states map[string]catalogModelState // By model ID
+}
+
+type catalogModelState struct {
+	provider string
+	state    string
+}
+
+func newCatalogTracker() *catalogTracker {
+	return &catalogTracker{states: make(map[string]catalogModelState)}
+}
+
+// record sets the catalog state of a model and reports whether it changed.
+// The first state of a model counts as a change unless it is listed.
+func (c *catalogTracker) record(model Model, state string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, seen := c.states[model.ID]
+	c.states[model.ID] = catalogModelState{provider: model.Provider, state: state}
+	missing, deprecated := 0.0, 0.0
+	switch state {
+	case catalogMissing:
+		missing = 1
+	case catalogDeprecated:
+		deprecated = 1
+	}
+	modelMissingGauge.Set(missing, "model", model.ID, "provider", model.Provider)
+	modelDeprecatedGauge.Set(deprecated, "model", model.ID, "provider", model.Provider)
+	if !seen {
+		return state != catalogListed
+	}
+	return previous.state != state
+}
+
+// forget drops the state of models that are no longer checked.
+func (c *catalogTracker) forget(keep func(id string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, s := range c.states {
+		if !keep(id) {
+			delete(c.states, id)
+			modelMissingGauge.Set(0, "model", id, "provider", s.provider)
+			modelDeprecatedGauge.Set(0, "model", id, "provider", s.provider)
+		}
+	}
+}
+
+// catalogState returns the state of a model name in a catalog. Names without
+// an exact entry are listed when an entry extends them with a version suffix,
+// such as a date, since aliases like claude-sonnet-4-5 are not catalog entries
+// themselves.
+func catalogState(catalog map[string]catalogEntry, name string) string {
+	if entry, ok := catalog[name]; ok {
+		if entry.Deprecated {
+			return catalogDeprecated
+		}
+		return catalogListed
+	}
+	state := catalogMissing
+	for id, entry := range catalog {
+		version, ok := strings.CutPrefix(id, name+"-")
+		if !ok || !isVersionSuffix(version) {
+			continue
+		}
+		if !entry.Deprecated {
+			return catalogListed
+		}
+		state = catalogDeprecated
+	}
+	return state
+}
+
+// isVersionSuffix reports whether s is a version that a model alias leaves
+// out: three or more digits, possibly separated by dashes, as in 20250929,
+// 2024-08-06, or 002.
+func isVersionSuffix(s string) bool {
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r != '-':
+			return false
+		}
+	}
+	return digits >= 3
+}
+
+// parseCatalogPage adds the entries of one model list page to catalog. Gemini
+// names lose their models/ prefix. It returns the Anthropic cursor of the next
+// page, if any.
+func parseCatalogPage(body []byte, catalog map[string]catalogEntry) (string, error) {
+	if !gjson.ValidBytes(body) {
+		return "", fmt.Errorf("invalid model list")
+	}
+	list := gjson.GetBytes(body, "data")
+	if !list.IsArray() {
+		list = gjson.GetBytes(body, "models")
+	}
+	if !list.IsArray() {
+		return "", fmt.Errorf("model list has no data or models array")
+	}
+	for _, m := range list.Array() {
+		id := cmp.Or(m.Get("id").String(), m.Get("name").String())
+		if id == "" {
+			continue
+		}
+		deprecated := slices.ContainsFunc(catalogDeprecationFields, func(field string) bool {
+			v := m.Get(field)
+			return v.Exists() && v.Type != gjson.Null && v.Type != gjson.False && v.String() != ""
+		})
+		catalog[strings.TrimPrefix(id, "models/")] = catalogEntry{Deprecated: deprecated}
+	}
+	if gjson.GetBytes(body, "has_more").Bool() {
+		return gjson.GetBytes(body, "last_id").String(), nil
+	}
+	return "", nil
+}
+
+// fetchCatalog requests the model catalog of a provider, following Anthropic
+// pagination and Gemini page tokens.
+func (t *RetryTransport) fetchCatalog(
+	ctx context.Context,
+	provider Provider,
+	modelType string,
+	path string,
+) (map[string]catalogEntry, error) {
+	base := strings.TrimRight(provider.ParsedURL.String(), "/")
+	target := base + "/" + strings.TrimLeft(cmp.Or(path, "/models"), "/")
+
+	catalog := make(map[string]catalogEntry)
+	query := url.Values{}
+	for range catalogMaxPages {
+		u := target
+		if len(query) > 0 {
+			u += "?" + query.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Host = cmp.Or(provider.HostHeader, req.Host)
+		if err := t.setAuthHeaders(req, modelType, provider); err != nil {
+			return nil, err
+		}
+		resp, err := t.clientFor(provider).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, catalogMaxBody))
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("model list returned %s", resp.Status)
+		}
+
+		cursor, err := parseCatalogPage(body, catalog)
+		if err != nil {
+			return nil, err
+		}
+		token := gjson.GetBytes(body, "nextPageToken").String()
+		switch {
+		case cursor != "":
+			query = url.Values{"limit": {"1000"}, "after_id": {cursor}}
+		case token != "":
+			query = url.Values{"pageToken": {token}}
+		default:
+			return catalog, nil
+		}
+	}
+	return catalog, nil
+}
+
+// checkCatalog compares the models of a provider with its catalog, logging
+// models that went missing, became deprecated, or were listed again.
+func (t *RetryTransport) checkCatalog(
+	ctx context.Context,
+	name string,
+	provider Provider,
+	models []Model,
+	logger *log.Logger,
+) error {
+	if len(models) == 0 {
+		return nil
+	}
+	catalog, err := t.fetchCatalog(ctx, provider, models[0].Type, provider.CatalogCheck.Path)
+	if err != nil {
+		return err
+	}
+	for _, m := range models {
+		state := catalogState(catalog, m.Model)
+		if !modelCatalogs.record(m, state) {
+			continue
+		}
+		switch state {
+		case catalogMissing:
+			logger.Warn(
+				"model is not in its provider's catalog",
+				"model",
+				m.ID,
+				"upstream_model",
+				m.Model,
+				"provider",
+				name,
+			)
+		case catalogDeprecated:
+			logger.Warn(
+				"model is deprecated by its provider",
+				"model",
+				m.ID,
+				"upstream_model",
+				m.Model,
+				"provider",
+				name,
+			)
+		default:
+			logger.Info("model is listed by its provider again", "model", m.ID, "provider", name)
+		}
+	}
+	return nil
+}
+
+// catalogModels returns the models of a provider that its catalog can list:
+// those of OpenAI, Anthropic, and Gemini type, in ID order.
+func catalogModels(cfg *Config, provider string) []Model {
+	var models []Model
+	for _, m := range cfg.Models {
+		if m.Provider == provider && m.Model != "" &&
+			(m.Type == "openai" || m.Type == "anthropic" || m.Type == "gemini") {
+			models = append(models, m)
+		}
+	}
+	slices.SortFunc(models, func(a, b Model) int { return strings.Compare(a.ID, b.ID) })
+	return models
+}
+
+// runCatalogChecks checks the models of every provider with a catalog_check
+// interval until ctx is done. The config is read on every tick, so reloads
+// take effect.
+func runCatalogChecks(ctx context.Context, config func() *Config, logger *log.Logger) {
+	cfg := config()
+	transport := NewRetryTransport(nil, cfg.Providers, cfg.Retry, cfg.Log, logger)
+	next := make(map[string]time.Time)
+	var running sync.Map // Providers with a check in flight
+
+	ticker := time.NewTicker(healthCheckTick)
+	defer ticker.Stop()
+	for {
+		cfg = config()
+		modelCatalogs.forget(func(id string) bool {
+			m, ok := cfg.Models[id]
+			return ok && cfg.Providers[m.Provider].CatalogCheck.Interval > 0
+		})
+
+		now := time.Now()
+		for name, p := range cfg.Providers {
+			cc := p.CatalogCheck
+			if cc.Interval <= 0 || now.Before(next[name]) {
+				continue
+			}
+			if _, busy := running.LoadOrStore(name, true); busy {
+				continue
+			}
+			next[name] = now.Add(cc.Interval)
+
+			go func() {
+				defer running.Delete(name)
+				checkCtx, cancel := context.WithTimeout(
+					ctx,
+					cmp.Or(cc.Timeout, defaultCatalogCheckTimeout),
+				)
+				err := transport.checkCatalog(checkCtx, name, p, catalogModels(cfg, name), logger)
+				cancel()
+				if err != nil && ctx.Err() == nil {
+					logger.Debug("catalog check failed", "provider", name, "error", err)
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
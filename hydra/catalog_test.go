@@ -0,0 +1,166 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestCatalogState(t *testing.T) {
+	catalog := map[string]catalogEntry{
+		"gpt-5":                      {},
+		"gpt-4":                      {Deprecated: true},
+		"gpt-4o-2024-08-06":          {},
+		"claude-sonnet-4-5-20250929": {},
+		"claude-3-opus-20240229":     {Deprecated: true},
+	}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"gpt-5", catalogListed},
+		{"gpt-4o", catalogListed},
+		{"gpt-4", catalogDeprecated},
+		{"claude-sonnet-4-5", catalogListed},
+		{"claude-3-opus", catalogDeprecated},
+		{"gpt-3.5-turbo", catalogMissing},
+		{"gpt", catalogMissing},
+	}
+	for _, tt := range tests {
+		if got := catalogState(catalog, tt.name); got != tt.expected {
+			t.Errorf("catalogState(%q) = %s, want %s", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestParseCatalogPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		cursor string
+		ids    []string
+	}{
+		{"openai", `{"object":"list","data":[{"id":"gpt-5"}]}`, "", []string{"gpt-5"}},
+		{
+			"anthropic",
+			`{"data":[{"id":"claude-a"},{"id":"claude-b"}],"has_more":true,"last_id":"claude-b"}`,
+			"claude-b",
+			[]string{"claude-a", "claude-b"},
+		},
+		{
+			"gemini",
+			`{"models":[{"name":"models/gemini-2.5-pro"}],"nextPageToken":"t"}`,
+			"",
+			[]string{"gemini-2.5-pro"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := make(map[string]catalogEntry)
+			cursor, err := parseCatalogPage([]byte(tt.body), catalog)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cursor != tt.cursor || len(catalog) != len(tt.ids) {
+				t.Errorf("expected %v with cursor %q, got %v with %q",
+					tt.ids, tt.cursor, catalog, cursor)
+			}
+			for _, id := range tt.ids {
+				if _, ok := catalog[id]; !ok {
+					t.Errorf("expected %s in the catalog", id)
+				}
+			}
+		})
+	}
+
+	catalog := make(map[string]catalogEntry)
+	body := `{"data":[{"id":"a","deprecated":false},{"id":"b","deprecation_date":"2026-01-01"}]}`
+	if _, err := parseCatalogPage([]byte(body), catalog); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if catalog["a"].Deprecated || !catalog["b"].Deprecated {
+		t.Errorf("expected only b deprecated, got %v", catalog)
+	}
+	if _, err := parseCatalogPage([]byte(`{"error":"nope"}`), catalog); err == nil {
+		t.Error("expected an error for a body without a model list")
+	}
+}
+
+func TestCheckCatalog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("after_id") == "" {
+			_, _ = w.Write([]byte(
+				`{"data":[{"id":"claude-a-20250101"}],"has_more":true,"last_id":"claude-a-20250101"}`,
+			))
+			return
+		}
+		_, _ = w.Write([]byte(
+			`{"data":[{"id":"claude-b","deprecated":true}],"has_more":false}`,
+		))
+	}))
+	defer ts.Close()
+
+	provider := Provider{URL: ts.URL, ParsedURL: mustParseURL(ts.URL), APIKey: "test-key"}
+	models := []Model{
+		{ID: "catalog-a", Provider: "catalog-test", Model: "claude-a", Type: "anthropic"},
+		{ID: "catalog-b", Provider: "catalog-test", Model: "claude-b", Type: "anthropic"},
+		{ID: "catalog-c", Provider: "catalog-test", Model: "claude-c", Type: "anthropic"},
+	}
+	defer modelCatalogs.forget(func(string) bool { return false })
+
+	transport := NewRetryTransport(nil, nil, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+	err := transport.checkCatalog(
+		context.Background(),
+		"catalog-test",
+		provider,
+		models,
+		log.New(io.Discard),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		model      string
+		missing    float64
+		deprecated float64
+	}{
+		{"catalog-a", 0, 0},
+		{"catalog-b", 0, 1},
+		{"catalog-c", 1, 0},
+	} {
+		labels := []string{"model", tt.model, "provider", "catalog-test"}
+		missing := metrics.value("hydrallm_model_missing_upstream", labels...)
+		deprecated := metrics.value("hydrallm_model_deprecated_upstream", labels...)
+		if missing != tt.missing || deprecated != tt.deprecated {
+			t.Errorf("%s: expected missing=%v deprecated=%v, got %v and %v",
+				tt.model, tt.missing, tt.deprecated, missing, deprecated)
+		}
+	}
+
+	// A model listed again is a change; a repeated state is not
+	if !modelCatalogs.record(models[2], catalogListed) {
+		t.Error("expected a listed model to be a change")
+	}
+	if modelCatalogs.record(models[2], catalogListed) {
+		t.Error("expected an unchanged state not to be a change")
+	}
+
+	provider.APIKey = "wrong"
+	if err := transport.checkCatalog(
+		context.Background(),
+		"catalog-test",
+		provider,
+		models,
+		log.New(io.Discard),
+	); err == nil {
+		t.Error("expected an error for a rejected catalog request")
+	}
+}
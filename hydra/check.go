@@ -0,0 +1,121 @@
+package hydra
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ProviderCheck is the result of probing one provider.
+type ProviderCheck struct {
+	Provider string
+	Type     string
+	OK       bool
+	Detail   string
+}
+
+// CheckProviders probes every provider used by a model, in name order.
+func CheckProviders(ctx context.Context, cfg *Config, timeout time.Duration) []ProviderCheck {
+	types := providerTypes(cfg)
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	transport := NewRetryTransport(nil, cfg.Providers, cfg.Retry, cfg.Log, logger)
+	checks := make([]ProviderCheck, 0, len(names))
+	for _, name := range names {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		checks = append(
+			checks,
+			transport.probeProvider(probeCtx, name, cfg.Providers[name], types[name], ""),
+		)
+		cancel()
+	}
+	return checks
+}
+
+// providerTypes returns the API type of every provider used by a model,
+// taken from the first of its models by ID.
+func providerTypes(cfg *Config) map[string]string {
+	types := make(map[string]string, len(cfg.Providers))
+	ids := make([]string, 0, len(cfg.Models))
+	for id := range cfg.Models {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		m := cfg.Models[id]
+		if _, ok := types[m.Provider]; !ok {
+			types[m.Provider] = m.Type
+		}
+	}
+	return types
+}
+
+// probeProvider checks that a provider is reachable and accepts its
+// credentials by requesting path, by default its model list. Bedrock and
+// template providers have no model list, so without a path only reachability
+// is checked for them.
+func (t *RetryTransport) probeProvider(
+	ctx context.Context,
+	name string,
+	provider Provider,
+	modelType string,
+	path string,
+) ProviderCheck {
+	check := ProviderCheck{Provider: name, Type: modelType}
+	base := strings.TrimRight(provider.ParsedURL.String(), "/")
+
+	method, target := http.MethodGet, base+"/models"
+	authenticated := true
+	switch {
+	case path != "":
+		target = base + "/" + strings.TrimLeft(path, "/")
+	case modelType == "ollama":
+		target = base + "/api/tags"
+	case modelType == "bedrock" || modelType == "template":
+		method, target = http.MethodHead, base
+		authenticated = false
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	req.Host = cmp.Or(provider.HostHeader, req.Host)
+	if authenticated {
+		if err := t.setAuthHeaders(req, modelType, provider); err != nil {
+			check.Detail = err.Error()
+			return check
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.clientFor(provider).Do(req)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+
+	latency := time.Since(start).Round(time.Millisecond)
+	switch {
+	case authenticated && (resp.StatusCode == http.StatusUnauthorized ||
+		resp.StatusCode == http.StatusForbidden):
+		check.Detail = fmt.Sprintf("credentials rejected (%s)", resp.Status)
+	case resp.StatusCode >= 500:
+		check.Detail = fmt.Sprintf("server error (%s)", resp.Status)
+	default:
+		check.OK = true
+		check.Detail = fmt.Sprintf("%s in %s", resp.Status, latency)
+	}
+	return check
+}
@@ -0,0 +1,69 @@
+package hydra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckProviders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path != "/v1/models":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") == "Bearer good" || r.Header.Get("x-api-key") == "good":
+			_, _ = w.Write([]byte(`{"data":[]}`))
+		case r.Header.Get("Authorization") == "Bearer down":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := &Config{
+		Providers: map[string]Provider{
+			"anthropic": {URL: ts.URL + "/v1", APIKey: "good"},
+			"bad_key":   {URL: ts.URL + "/v1", APIKey: "bad"},
+			"down":      {URL: ts.URL + "/v1", APIKey: "down"},
+			"openai":    {URL: ts.URL + "/v1/", APIKey: "good"},
+			"template":  {URL: ts.URL},
+			"unused":    {URL: "http://127.0.0.1:1"},
+		},
+		Models: map[string]Model{
+			"a": {Provider: "anthropic", Model: "claude", Type: "anthropic"},
+			"b": {Provider: "bad_key", Model: "gpt", Type: "openai"},
+			"d": {Provider: "down", Model: "gpt", Type: "openai"},
+			"o": {Provider: "openai", Model: "gpt", Type: "openai"},
+			"t": {Provider: "template", Model: "x", Type: "template", Template: "{}"},
+		},
+		Listeners: []Listener{{Name: "l1", Port: 8080, Models: []string{"o"}}},
+		Retry:     RetryConfig{DefaultTimeout: time.Second},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	checks := CheckProviders(t.Context(), cfg, time.Second)
+	want := map[string]bool{
+		"anthropic": true,
+		"bad_key":   false,
+		"down":      false,
+		"openai":    true,
+		"template":  true,
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("expected %d checks, got %+v", len(want), checks)
+	}
+	for i, c := range checks {
+		if i > 0 && checks[i-1].Provider > c.Provider {
+			t.Errorf("expected checks in name order, got %+v", checks)
+		}
+		if c.OK != want[c.Provider] {
+			t.Errorf("%s: expected ok=%v, got %+v", c.Provider, want[c.Provider], c)
+		}
+	}
+}
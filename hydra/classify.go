@@ -0,0 +1,282 @@
+package hydra
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// classifyPeekSize bounds how much of an error body is read for classification.
+const classifyPeekSize = 4 * 1024
+
+// quotaExhaustedCooldown is how long a provider that reported an exhausted
+// account quota is skipped, unless it asked for longer.
+const quotaExhaustedCooldown = 5 * time.Minute
+
+// Error classes of upstream error responses, exposed in metrics and failure
+// summaries.
+const (
+	errorClassRateLimited    = "rate_limited"
+	errorClassOverloaded     = "overloaded"
+	errorClassQuotaExhausted = "quota_exhausted"
+	errorClassContextLength  = "context_length"
+	errorClassInvalidRequest = "invalid_request"
+	errorClassAuth           = "auth"
+	errorClassNotFound       = "not_found"
+	errorClassTimeout        = "timeout"
+	errorClassServer         = "server_error"
+	errorClassClient         = "client_error"
+)
+
+// retryHintPattern matches the delay suggested in rate limit error messages,
+// e.g. OpenAI's "Please try again in 1.5s."
+var retryHintPattern = regexp.MustCompile(
+	`(?i)try again in ((?:\d+(?:\.\d+)?(?:ms|s|m|h))+)`,
+)
+
+var upstreamErrorsCounter = metrics.Counter(
+	"hydrallm_upstream_errors_total",
+	"Upstream error responses, by provider, error class, and action.",
+)
+
+// errorAction is what the retry loop does after an upstream error response.
+type errorAction int
+
+const (
+	actionAbort    errorAction = iota // Return the response to the client
+	actionRetry                       // Retry the same model, then fall back
+	actionFallback                    // Skip the remaining attempts of this model
+)
+
+func (a errorAction) String() string {
+	switch a {
+	case actionRetry:
+		return "retry"
+	case actionFallback:
+		return "fallback"
+	default:
+		return "abort"
+	}
+}
+
+// upstreamError holds the vendor error identifiers found in an error response.
+type upstreamError struct {
+	Type    string // Anthropic and OpenAI error type, Bedrock exception name
+	Code    string // OpenAI error code
+	Message string
+}
+
+// upstreamFailure is the classification of an upstream error response.
+type upstreamFailure struct {
+	Action     errorAction
+	Class      string
+	RetryAfter time.Duration // Delay suggested by the error message, zero without one
+}
+
+// classifyResponse decides how to handle an error response from a model of
+// the given type and classifies the error. Vendor error identifiers take
+// precedence over the status code. The response body is left intact.
+func classifyResponse(modelType string, resp *http.Response) upstreamFailure {
+	upErr := parseUpstreamError(resp)
+	return upstreamFailure{
+		Action:     errorActionOf(modelType, upErr, resp.StatusCode),
+		Class:      errorClassOf(modelType, upErr, resp.StatusCode),
+		RetryAfter: retryHint(upErr.Message),
+	}
+}
+
+// errorActionOf applies the vendor rules of a model type, then the generic
+// rule of retrying 429 and 5xx and returning other errors to the client.
+func errorActionOf(modelType string, upErr upstreamError, status int) errorAction {
+	switch modelType {
+	case "anthropic":
+		switch {
+		case status == 529, upErr.Type == "overloaded_error":
+			return actionRetry
+		case upErr.Type == "rate_limit_error":
+			return actionRetry
+		}
+	case "openai":
+		switch {
+		case upErr.Code == "insufficient_quota", upErr.Type == "insufficient_quota":
+			// Out of credit; no amount of retrying will help
+			return actionFallback
+		case upErr.Code == "rate_limit_exceeded":
+			return actionRetry
+		case status == http.StatusConflict:
+			return actionRetry
+		}
+	case "bedrock":
+		switch upErr.Type {
+		case "ThrottlingException", "ModelNotReadyException", "ModelTimeoutException",
+			"ServiceUnavailableException":
+			return actionRetry
+		case "ServiceQuotaExceededException":
+			return actionFallback
+		case "ValidationException", "AccessDeniedException", "ResourceNotFoundException":
+			return actionAbort
+		}
+	}
+
+	if isRetryable(status) {
+		return actionRetry
+	}
+	return actionAbort
+}
+
+// errorClassOf classifies an error response by its vendor error identifiers,
+// falling back to its status code.
+func errorClassOf(modelType string, upErr upstreamError, status int) string {
+	switch modelType {
+	case "anthropic":
+		switch upErr.Type {
+		case "rate_limit_error":
+			return errorClassRateLimited
+		case "overloaded_error":
+			return errorClassOverloaded
+		case "authentication_error", "permission_error":
+			return errorClassAuth
+		case "not_found_error":
+			return errorClassNotFound
+		case "invalid_request_error", "request_too_large":
+			if strings.HasPrefix(upErr.Message, "prompt is too long") {
+				return errorClassContextLength
+			}
+			return errorClassInvalidRequest
+		case "api_error":
+			return errorClassServer
+		}
+	case "openai":
+		switch {
+		case upErr.Code == "insufficient_quota", upErr.Type == "insufficient_quota":
+			return errorClassQuotaExhausted
+		case upErr.Code == "rate_limit_exceeded":
+			return errorClassRateLimited
+		case upErr.Code == "context_length_exceeded":
+			return errorClassContextLength
+		case upErr.Code == "invalid_api_key":
+			return errorClassAuth
+		case upErr.Code == "model_not_found":
+			return errorClassNotFound
+		case upErr.Type == "server_error":
+			return errorClassServer
+		}
+	case "bedrock":
+		switch upErr.Type {
+		case "ThrottlingException":
+			return errorClassRateLimited
+		case "ServiceUnavailableException", "ModelNotReadyException":
+			return errorClassOverloaded
+		case "ServiceQuotaExceededException":
+			return errorClassQuotaExhausted
+		case "ModelTimeoutException":
+			return errorClassTimeout
+		case "ValidationException":
+			if strings.Contains(strings.ToLower(upErr.Message), "too long") {
+				return errorClassContextLength
+			}
+			return errorClassInvalidRequest
+		case "AccessDeniedException", "UnrecognizedClientException":
+			return errorClassAuth
+		case "ResourceNotFoundException":
+			return errorClassNotFound
+		case "InternalServerException", "ModelErrorException":
+			return errorClassServer
+		}
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return errorClassRateLimited
+	case status == 529, status == http.StatusServiceUnavailable:
+		return errorClassOverloaded
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return errorClassTimeout
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return errorClassAuth
+	case status == http.StatusNotFound:
+		return errorClassNotFound
+	case status == http.StatusBadRequest, status == http.StatusRequestEntityTooLarge,
+		status == http.StatusUnprocessableEntity:
+		return errorClassInvalidRequest
+	case status >= 500:
+		return errorClassServer
+	default:
+		return errorClassClient
+	}
+}
+
+// retryHint returns the delay suggested by an error message, or zero.
+func retryHint(message string) time.Duration {
+	m := retryHintPattern.FindStringSubmatch(message)
+	if m == nil {
+		return 0
+	}
+	d, err := time.ParseDuration(m[1])
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// parseUpstreamError extracts vendor error identifiers from a response.
+// Bedrock names the exception in the x-amzn-ErrorType header, and Anthropic and
+// OpenAI in an "error" object of the body.
+func parseUpstreamError(resp *http.Response) upstreamError {
+	var payload struct {
+		Type    string `json:"__type"`  // Bedrock, when the header is missing
+		Message string `json:"message"` // Bedrock
+		Error   struct {
+			Type    string `json:"type"`
+			Code    any    `json:"code"` // OpenAI sends strings, some compatible APIs numbers
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(peekErrorBody(resp), &payload)
+
+	upErr := upstreamError{Message: cmp.Or(payload.Error.Message, payload.Message)}
+	if errType := resp.Header.Get("X-Amzn-Errortype"); errType != "" {
+		// e.g. "ThrottlingException:http://internal.amazon.com/coral/..."
+		upErr.Type, _, _ = strings.Cut(errType, ":")
+		return upErr
+	}
+	upErr.Type = payload.Error.Type
+	if code, ok := payload.Error.Code.(string); ok {
+		upErr.Code = code
+	}
+	if upErr.Type == "" && payload.Type != "" {
+		_, upErr.Type, _ = strings.Cut(payload.Type, "#")
+		if upErr.Type == "" {
+			upErr.Type = payload.Type
+		}
+	}
+	return upErr
+}
+
+// peekErrorBody returns up to classifyPeekSize bytes of the decoded response
+// body, restoring the body so it can still be read in full.
+func peekErrorBody(resp *http.Response) []byte {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, classifyPeekSize))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(raw), resp.Body), resp.Body}
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return raw
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = gz.Close() }()
+	// A truncated body still yields its decoded prefix
+	decoded, _ := io.ReadAll(io.LimitReader(gz, classifyPeekSize))
+	return decoded
+}
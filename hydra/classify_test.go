@@ -0,0 +1,208 @@
+package hydra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		modelType string
+		status    int
+		header    http.Header
+		body      string
+		expected  errorAction
+		class     string
+	}{
+		{
+			name:      "anthropic overloaded 529",
+			modelType: "anthropic",
+			status:    529,
+			body:      `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			expected:  actionRetry,
+			class:     errorClassOverloaded,
+		},
+		{
+			name:      "anthropic invalid request",
+			modelType: "anthropic",
+			status:    400,
+			body:      `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`,
+			expected:  actionAbort,
+			class:     errorClassInvalidRequest,
+		},
+		{
+			name:      "openai insufficient quota",
+			modelType: "openai",
+			status:    429,
+			body:      `{"error":{"type":"insufficient_quota","code":"insufficient_quota"}}`,
+			expected:  actionFallback,
+			class:     errorClassQuotaExhausted,
+		},
+		{
+			name:      "openai rate limit",
+			modelType: "openai",
+			status:    429,
+			body:      `{"error":{"type":"requests","code":"rate_limit_exceeded"}}`,
+			expected:  actionRetry,
+			class:     errorClassRateLimited,
+		},
+		{
+			name:      "openai conflict",
+			modelType: "openai",
+			status:    409,
+			body:      `{"error":{"message":"The server had an error processing your request."}}`,
+			expected:  actionRetry,
+			class:     errorClassClient,
+		},
+		{
+			name:      "openai numeric code",
+			modelType: "openai",
+			status:    400,
+			body:      `{"error":{"code":400,"message":"bad"}}`,
+			expected:  actionAbort,
+			class:     errorClassInvalidRequest,
+		},
+		{
+			name:      "bedrock throttling header on 400",
+			modelType: "bedrock",
+			status:    400,
+			header: http.Header{
+				"X-Amzn-Errortype": {"ThrottlingException:http://internal.amazon.com/coral/"},
+			},
+			expected: actionRetry,
+			class:    errorClassRateLimited,
+		},
+		{
+			name:      "bedrock service quota in body",
+			modelType: "bedrock",
+			status:    429,
+			body:      `{"__type":"com.amazon.coral#ServiceQuotaExceededException","message":"quota"}`,
+			expected:  actionFallback,
+			class:     errorClassQuotaExhausted,
+		},
+		{
+			name:      "bedrock validation",
+			modelType: "bedrock",
+			status:    400,
+			header:    http.Header{"X-Amzn-Errortype": {"ValidationException"}},
+			expected:  actionAbort,
+			class:     errorClassInvalidRequest,
+		},
+		{
+			name:      "openai context length",
+			modelType: "openai",
+			status:    400,
+			body:      `{"error":{"type":"invalid_request_error","code":"context_length_exceeded"}}`,
+			expected:  actionAbort,
+			class:     errorClassContextLength,
+		},
+		{
+			name:      "anthropic prompt too long",
+			modelType: "anthropic",
+			status:    400,
+			body: `{"type":"error","error":{"type":"invalid_request_error",` +
+				`"message":"prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			expected: actionAbort,
+			class:    errorClassContextLength,
+		},
+		{
+			name:      "bedrock model timeout",
+			modelType: "bedrock",
+			status:    408,
+			header:    http.Header{"X-Amzn-Errortype": {"ModelTimeoutException"}},
+			expected:  actionRetry,
+			class:     errorClassTimeout,
+		},
+		{
+			name:      "generic server error",
+			modelType: "template",
+			status:    502,
+			body:      `Bad Gateway`,
+			expected:  actionRetry,
+			class:     errorClassServer,
+		},
+		{
+			name:      "generic client error",
+			modelType: "template",
+			status:    404,
+			expected:  actionAbort,
+			class:     errorClassNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			got := classifyResponse(tt.modelType, resp)
+			if got.Action != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got.Action)
+			}
+			if got.Class != tt.class {
+				t.Errorf("expected class %q, got %q", tt.class, got.Class)
+			}
+
+			// The body must still be readable in full
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.body {
+				t.Errorf("expected body %q to be preserved, got %q", tt.body, body)
+			}
+		})
+	}
+}
+
+func TestPeekErrorBodyGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(`{"error":{"code":"insufficient_quota"}}`))
+	_ = gz.Close()
+	compressed := buf.Bytes()
+
+	resp := &http.Response{
+		StatusCode: 429,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(bytes.NewReader(compressed)),
+	}
+	if got := classifyResponse("openai", resp); got.Action != actionFallback {
+		t.Errorf("expected fallback for gzipped body, got %s", got.Action)
+	}
+	rest, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(rest, compressed) {
+		t.Error("expected compressed body to be preserved")
+	}
+}
+
+func TestClassifyResponse_RetryHint(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{},
+		Body: io.NopCloser(strings.NewReader(`{"error":{"code":"rate_limit_exceeded",` +
+			`"message":"Rate limit reached for gpt-4o. Please try again in 1.5s."}}`)),
+	}
+	if got := classifyResponse("openai", resp); got.RetryAfter != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s hint, got %v", got.RetryAfter)
+	}
+
+	for message, want := range map[string]time.Duration{
+		"Please try again in 20ms.":  20 * time.Millisecond,
+		"Please try again in 1m30s.": 90 * time.Second,
+		"Please retry later.":        0,
+	} {
+		if got := retryHint(message); got != want {
+			t.Errorf("retryHint(%q) = %v, want %v", message, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package hydra
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"br", false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	largeJSON := `{"content":"` + strings.Repeat("a", 4*gzipMinSize) + `"}`
+	mw := newGzipMiddleware(&Listener{}, &Config{}, log.New(io.Discard))
+
+	serve := func(contentType, body, acceptEncoding string) *httptest.ResponseRecorder {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write([]byte(body))
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("compresses json", func(t *testing.T) {
+		rec := serve("application/json", largeJSON, "gzip")
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("expected gzip encoding, got %q", got)
+		}
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(body) != largeJSON {
+			t.Error("decompressed body does not match")
+		}
+	})
+
+	t.Run("client without gzip", func(t *testing.T) {
+		rec := serve("application/json", largeJSON, "")
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no encoding, got %q", got)
+		}
+		if rec.Body.String() != largeJSON {
+			t.Error("expected body passed through")
+		}
+	})
+
+	t.Run("never compresses sse", func(t *testing.T) {
+		rec := serve("text/event-stream", "data: "+largeJSON+"\n\n", "gzip")
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no encoding for SSE, got %q", got)
+		}
+	})
+}
+
+func TestShouldGzip(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   bool
+	}{
+		{"json", 200, http.Header{"Content-Type": {"application/json"}}, true},
+		{
+			"json with charset",
+			200,
+			http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+			true,
+		},
+		{"error json", 429, http.Header{"Content-Type": {"application/json"}}, true},
+		{"no content", 204, http.Header{"Content-Type": {"application/json"}}, false},
+		{
+			"already encoded",
+			200,
+			http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+			false,
+		},
+		{
+			"small body",
+			200,
+			http.Header{"Content-Type": {"application/json"}, "Content-Length": {"20"}},
+			false,
+		},
+		{"plain text", 200, http.Header{"Content-Type": {"text/plain"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldGzip(tt.status, tt.header); got != tt.want {
+				t.Errorf("shouldGzip() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
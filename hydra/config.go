@@ -0,0 +1,1581 @@
+package hydra
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Config holds the application configuration.
+type Config struct {
+	Log        LogConfig           `mapstructure:"log"`
+	Retry      RetryConfig         `mapstructure:"retry"`
+	Middleware []string            `mapstructure:"middleware"` // Global middleware order
+	Server     ServerConfig        `mapstructure:"server"`
+	Admin      AdminConfig         `mapstructure:"admin"`
+	Providers  map[string]Provider `mapstructure:"providers"`
+	Models     map[string]Model    `mapstructure:"models"`
+	Listeners  []Listener          `mapstructure:"listeners"`
+	Routes     []RoutingRule       `mapstructure:"routes"`     // Rules evaluated per request
+	Geo        GeoConfig           `mapstructure:"geo"`        // Client regions matched by routes
+	StateDir   string              `mapstructure:"state_dir"`  // Base of relative log and data paths
+	Strict     bool                `mapstructure:"strict"`     // Reject unknown keys
+	StrictEnv  bool                `mapstructure:"strict_env"` // Reject unset ${VAR} references
+
+	RetryPolicies map[string]RetryConfig `mapstructure:"retry_policies"` // Named retry settings
+
+	envWritten map[string]string // Strings as written, by their ${VAR} expansion
+}
+
+// LogConfig holds logging configuration.
+type LogConfig struct {
+	Level            string `mapstructure:"level"`
+	IncludeErrorBody bool   `mapstructure:"include_error_body"`
+	Format           string `mapstructure:"format"`     // text or json
+	AccessLog        string `mapstructure:"access_log"` // JSON access log path, "-" for stdout
+	UsageLog         string `mapstructure:"usage_log"`  // JSON usage log path, "-" for stdout
+}
+
+// RetryConfig holds retry-related configuration.
+type RetryConfig struct {
+	MaxCycles          int           `mapstructure:"max_cycles"`
+	DefaultTimeout     time.Duration `mapstructure:"default_timeout"`
+	DefaultInterval    time.Duration `mapstructure:"default_interval"`
+	ExponentialBackoff bool          `mapstructure:"exponential_backoff"`
+	MaxRetryAfter      time.Duration `mapstructure:"max_retry_after"`     // Cap for upstream Retry-After
+	StreamBufferBytes  int           `mapstructure:"stream_buffer_bytes"` // Held until first SSE event
+	TotalTimeout       time.Duration `mapstructure:"total_timeout"`       // Budget per request, 0 for none
+}
+
+// ServerConfig holds process-wide server settings.
+type ServerConfig struct {
+	ShutdownTimeout     time.Duration `mapstructure:"shutdown_timeout"`      // Graceful shutdown limit
+	DrainRequestTimeout time.Duration `mapstructure:"drain_request_timeout"` // Per-request drain cutoff
+	QuotaState          string        `mapstructure:"quota_state"`           // API key quota usage file
+	ModelStats          string        `mapstructure:"model_stats"`           // Adaptive routing statistics file
+	MaxBufferedBytes    int64         `mapstructure:"max_buffered_bytes"`    // Request bytes in flight, 0 for no limit
+	MaxUpstreamConns    int           `mapstructure:"max_upstream_conns"`    // Open upstream connections, 0 for no limit
+}
+
+// AdminConfig holds the admin HTTP API configuration.
+// The admin API is disabled when no port is set.
+type AdminConfig struct {
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+}
+
+// Provider represents an upstream API provider.
+type Provider struct {
+	URL                   string             `mapstructure:"url"`
+	ProxyURL              string             `mapstructure:"proxy_url"`      // http, https, or socks5 proxy
+	DNSOverHTTPS          string             `mapstructure:"dns_over_https"` // DoH resolver URL
+	HostHeader            string             `mapstructure:"host_header"`    // Host and TLS name sent upstream
+	APIVersion            string             `mapstructure:"api_version"`    // api-version of openai requests
+	APIKey                string             `mapstructure:"api_key"`
+	Auth                  string             `mapstructure:"auth"` // "ambient" for cloud credentials
+	StripVersionPrefix    bool               `mapstructure:"strip_version_prefix"`
+	Interval              time.Duration      `mapstructure:"interval"`
+	RateLimit             RateLimit          `mapstructure:"rate_limit"`    // Local request and token limits
+	HealthCheck           HealthCheckConfig  `mapstructure:"health_check"`  // Periodic probes
+	CatalogCheck          CatalogCheckConfig `mapstructure:"catalog_check"` // Model retirement checks
+	Signing               SigningConfig      `mapstructure:"signing"`       // HMAC request signing
+	AWSRegion             string             `mapstructure:"aws_region"`
+	AWSAccessKeyID        string             `mapstructure:"aws_access_key_id"`
+	AWSSecretAccessKey    string             `mapstructure:"aws_secret_access_key"`
+	AWSSessionToken       string             `mapstructure:"aws_session_token"`
+	AWSProfile            string             `mapstructure:"aws_profile"`             // Shared config profile
+	AssumeRoleARN         string             `mapstructure:"assume_role_arn"`         // Role assumed via STS
+	AssumeRoleExternalID  string             `mapstructure:"assume_role_external_id"` // For cross-account roles
+	GoogleCredentialsFile string             `mapstructure:"google_credentials_file"`
+	AnthropicVersion      string             `mapstructure:"anthropic_version"`    // Default 2023-06-01
+	AnthropicBeta         []string           `mapstructure:"anthropic_beta"`       // Added to anthropic-beta
+	ContentErrors         []string           `mapstructure:"content_errors"`       // Errors in 200 bodies
+	EmbeddingBatchSize    int                `mapstructure:"embedding_batch_size"` // Inputs per request
+	Headers               HeaderPolicy       `mapstructure:"headers"`              // Client header rules
+	ParsedURL             *url.URL           `mapstructure:"-"`
+	ParsedProxyURL        *url.URL           `mapstructure:"-"`
+	ParsedDNSOverHTTPS    *url.URL           `mapstructure:"-"`
+
+	ParsedContentErrors []contentErrorMatcher `mapstructure:"-"`
+}
+
+// Model represents a model configuration with retry settings.
+type Model struct {
+	ID       string        // Global unique ID (map key)
+	Provider string        `mapstructure:"provider"`
+	Model    string        `mapstructure:"model"`
+	Type     string        `mapstructure:"type"`
+	Attempts int           `mapstructure:"attempts"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Interval time.Duration `mapstructure:"interval"`
+	Template string        `mapstructure:"template"` // Body template for template models
+	Weight   int           `mapstructure:"weight"`   // Share of traffic for weighted routing
+	Price    ModelPrice    `mapstructure:"price"`    // For estimated cost in usage totals
+
+	AnthropicVersion string   `mapstructure:"anthropic_version"` // Overrides the provider's
+	AnthropicBeta    []string `mapstructure:"anthropic_beta"`    // Added to the provider's
+
+	KeepAlive string `mapstructure:"keep_alive"` // How long Ollama keeps the model loaded
+	NumCtx    int    `mapstructure:"num_ctx"`    // Ollama context window in tokens
+
+	Stop   []string     `mapstructure:"stop"`   // Stop sequences added to requests
+	Output OutputConfig `mapstructure:"output"` // Normalization of generated text
+	Assert AssertConfig `mapstructure:"assert"` // Checks of generated text
+	Tools  ToolPolicy   `mapstructure:"tools"`  // Tools the model may be sent
+	Params []ModelParam `mapstructure:"params"` // Request body fields set for the model
+
+	RetryPolicy string `mapstructure:"retry_policy"` // Sets an unset timeout and interval
+
+	FirstByteTimeout time.Duration `mapstructure:"first_byte_timeout"` // Until the response starts
+
+	ParsedTemplate *template.Template `mapstructure:"-"`
+}
+
+// Listener represents a local listening configuration.
+type Listener struct {
+	Name         string        `mapstructure:"name"`
+	Extends      string        `mapstructure:"extends"` // Base listener name to inherit from
+	Type         string        `mapstructure:"type"`    // Client-facing API type
+	Host         string        `mapstructure:"host"`
+	Port         int           `mapstructure:"port"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	Binds        []Bind        `mapstructure:"binds"`    // Additional bind addresses
+	Models       []string      `mapstructure:"models"`   // Model IDs
+	Strategy     string        `mapstructure:"strategy"` // Model routing strategy
+	Bandit       BanditConfig  `mapstructure:"bandit"`   // Tuning of the bandit strategy
+	Routes       []Route       `mapstructure:"routes"`   // Chains selected by requested model
+
+	EmbeddingModels []string `mapstructure:"embedding_models"` // Model IDs for embeddings
+
+	PromptRoutes []PromptRoute    `mapstructure:"prompt_routes"` // Chains selected by prompt
+	Experiment   ExperimentConfig `mapstructure:"experiment"`    // A/B split of the models
+
+	RetryPolicy string `mapstructure:"retry_policy"` // Replaces [retry] for the listener
+
+	Dispatch   string   `mapstructure:"dispatch"`    // chain or passthrough
+	DenyModels []string `mapstructure:"deny_models"` // Requested names passthrough never serves
+
+	Middleware        []string `mapstructure:"middleware"`         // Overrides global order
+	DisableMiddleware []string `mapstructure:"disable_middleware"` // Stages to skip
+
+	RateLimitHeaders bool   `mapstructure:"rate_limit_headers"` // Aggregate upstream rate limits
+	ExposeMetadata   bool   `mapstructure:"expose_metadata"`    // X-Hydrallm-* attempt headers
+	LogAttempts      string `mapstructure:"log_attempts"`       // all, failures, or final
+	StreamRepair     string `mapstructure:"stream_repair"`      // off, error, or continue
+	StreamHeartbeats string `mapstructure:"stream_heartbeats"`  // pass or drop
+
+	StreamPacing StreamPacingConfig `mapstructure:"stream_pacing"` // Smoothing of event bursts
+
+	HedgeDelay time.Duration `mapstructure:"hedge_delay"` // Race the next model after, 0 disables
+	SLO        SLOConfig     `mapstructure:"slo"`         // Latency objectives
+	Priority   string        `mapstructure:"priority"`    // interactive or batch
+
+	UnavailableModels string `mapstructure:"unavailable_models"` // off, omit, or annotate
+	ModelList         string `mapstructure:"model_list"`         // upstream, local, or merged
+	ProbeStatus       int    `mapstructure:"probe_status"`       // 405 or 200 for probes
+	ErrorDetail       string `mapstructure:"error_detail"`       // off, summary, or attempts
+
+	MaxBodySize     int64         `mapstructure:"max_body_size"`    // Larger request bodies get 413
+	ResponseTimeout time.Duration `mapstructure:"response_timeout"` // Until the response starts, 0 for none
+
+	AutoContinue AutoContinueConfig `mapstructure:"auto_continue"` // Continue truncated responses
+	SlimBody     SlimBodyConfig     `mapstructure:"slim_body"`     // Shrink bodies rejected as too large
+	Headers      HeaderPolicy       `mapstructure:"headers"`       // Client header rules
+
+	APIKeys     []APIKey `mapstructure:"api_keys"`      // Client keys accepted by the listener
+	APIKeysFile string   `mapstructure:"api_keys_file"` // File of name:key lines
+
+	Corpus CorpusConfig `mapstructure:"corpus"` // Prompt/response recording
+	Cache  CacheConfig  `mapstructure:"cache"`  // Response caching
+
+	Transcripts TranscriptConfig `mapstructure:"transcripts"` // Conversation storage
+	Broadcast   BroadcastConfig  `mapstructure:"broadcast"`   // Responses sent to observers
+	Allowlist   AllowlistConfig  `mapstructure:"allowlist"`   // Accepted methods and paths
+	Filter      FilterConfig     `mapstructure:"filter"`      // Request filtering rules
+
+	// Resolved at runtime
+	ResolvedModels       []Model               `mapstructure:"-"`
+	ResolvedRoutes       map[string][]Model    `mapstructure:"-"` // Route chains by requested model
+	ResolvedEmbeddings   []Model               `mapstructure:"-"` // Chain of embeddings requests
+	ResolvedPromptRoutes []resolvedPromptRoute `mapstructure:"-"` // Prompt routes in order
+	ResolvedRules        []resolvedRule        `mapstructure:"-"` // [[routes]] rules in order
+	ResolvedExperiment   []Model               `mapstructure:"-"` // Experiment candidate chain
+	ResolvedMiddleware   []string              `mapstructure:"-"` // Ordered middleware pipeline
+	ResolvedAPIKeys      []APIKey              `mapstructure:"-"` // Inline and file keys combined
+	ConfigType           string                `mapstructure:"-"` // Unified API type for this listener
+}
+
+// Bind represents an additional host/port pair a listener accepts connections on.
+type Bind struct {
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+}
+
+// Addresses returns every host:port the listener binds to, primary address first.
+func (l *Listener) Addresses() []string {
+	addrs := make([]string, 0, len(l.Binds)+1)
+	addrs = append(addrs, net.JoinHostPort(l.Host, strconv.Itoa(l.Port)))
+	for _, b := range l.Binds {
+		addrs = append(addrs, net.JoinHostPort(b.Host, strconv.Itoa(b.Port)))
+	}
+	return addrs
+}
+
+// LocalURL returns a base URL for reaching the listener from this host.
+// Wildcard hosts are replaced with the matching loopback address.
+func (l *Listener) LocalURL() string {
+	host := l.Host
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(l.Port))
+}
+
+// DefaultPath returns the default request path for the listener's API type.
+// It returns an empty string when the API type has no single default path.
+func (l *Listener) DefaultPath() string {
+	switch l.ConfigType {
+	case "openai", "template":
+		return "/v1/chat/completions"
+	case "anthropic":
+		return "/v1/messages"
+	case "ollama":
+		return "/api/chat"
+	default:
+		return ""
+	}
+}
+
+// GetURL resolves the URL, supporting environment variable expansion.
+func (p *Provider) GetURL() string {
+	return resolveEnvOrValue(p.URL)
+}
+
+// GetAPIKey resolves the API key, supporting environment variable expansion.
+func (p *Provider) GetAPIKey() string {
+	return resolveEnvOrValue(p.APIKey)
+}
+
+// GetInterval returns the model's interval, or the provider's interval if not set.
+func (m *Model) GetInterval(provider Provider, defaultInterval time.Duration) time.Duration {
+	if m.Interval > 0 {
+		return m.Interval
+	}
+	if provider.Interval > 0 {
+		return provider.Interval
+	}
+	return defaultInterval
+}
+
+// GetAWSRegion returns the AWS region, falling back to environment variables.
+func (p *Provider) GetAWSRegion() string {
+	return resolveEnvOrValue(p.AWSRegion)
+}
+
+// GetAWSAccessKeyID returns the AWS access key ID, falling back to environment variables.
+func (p *Provider) GetAWSAccessKeyID() string {
+	return resolveEnvOrValue(p.AWSAccessKeyID)
+}
+
+// GetAWSSecretAccessKey returns the AWS secret access key, falling back to environment variables.
+func (p *Provider) GetAWSSecretAccessKey() string {
+	return resolveEnvOrValue(p.AWSSecretAccessKey)
+}
+
+// GetGoogleCredentialsFile returns the service account key file path,
+// supporting environment variable expansion.
+func (p *Provider) GetGoogleCredentialsFile() string {
+	return resolveEnvOrValue(p.GoogleCredentialsFile)
+}
+
+// GetAWSSessionToken returns the AWS session token, falling back to environment variables.
+func (p *Provider) GetAWSSessionToken() string {
+	return resolveEnvOrValue(p.AWSSessionToken)
+}
+
+// resolveEnvOrValue returns the environment variable value if the input starts with $,
+// otherwise returns the input as-is.
+func resolveEnvOrValue(v string) string {
+	if v == "" {
+		return ""
+	}
+	if len(v) > 1 && v[0] == '$' {
+		if envVal := os.Getenv(v[1:]); envVal != "" {
+			return envVal
+		}
+	}
+	return v
+}
+
+// LoadConfig reads and validates the configuration from viper. Errors about
+// the config file are placed in it as ConfigErrors.
+func LoadConfig() (*Config, error) {
+	var cfg Config
+	positions := loadConfigPositions(viper.ConfigFileUsed())
+	if err := viper.Unmarshal(&cfg, strictDecoding(viper.GetBool("strict"))); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", positions.locateUnusedKeys(err))
+	}
+	if err := expandConfigEnv(&cfg, cfg.StrictEnv, positions); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	if err := resolveListenerInheritance(&cfg); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", positions.locate(&cfg, err))
+	}
+
+	applyDefaults(&cfg)
+
+	// Set log level and format early so validation logs are visible
+	logger.SetLevel(parseLogLevel(cfg.Log.Level))
+	logger.SetFormatter(parseLogFormat(cfg.Log.Format))
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", positions.locate(&cfg, err))
+	}
+	for _, warning := range cfg.deprecatedVersionWarnings() {
+		logger.Warn(warning)
+	}
+
+	return &cfg, nil
+}
+
+// Prepare readies a config built in code the way LoadConfig readies a config
+// file: it expands ${VAR} references, resolves listener inheritance, applies
+// defaults, and validates the config, resolving model chains and parsing
+// provider URLs.
+func (c *Config) Prepare() error {
+	if err := expandConfigEnv(c, c.StrictEnv, nil); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	if err := resolveListenerInheritance(c); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	applyDefaults(c)
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	return nil
+}
+
+// resolveListenerInheritance fills unset listener fields from the listener named
+// in extends. Name, port and binds are never inherited. Must run before
+// applyDefaults so inherited values are not shadowed by defaults.
+func resolveListenerInheritance(c *Config) error {
+	byName := make(map[string]int, len(c.Listeners))
+	for i, l := range c.Listeners {
+		if l.Name != "" {
+			byName[l.Name] = i
+		}
+	}
+
+	resolved := make(map[int]bool, len(c.Listeners))
+	var resolve func(i int, visiting map[int]bool) error
+	resolve = func(i int, visiting map[int]bool) error {
+		l := &c.Listeners[i]
+		if resolved[i] || l.Extends == "" {
+			return nil
+		}
+		if visiting[i] {
+			return fmt.Errorf("listener %q: circular extends", l.Name)
+		}
+		visiting[i] = true
+
+		baseIdx, ok := byName[l.Extends]
+		if !ok {
+			return fmt.Errorf("listener %q: extends unknown listener %q", l.Name, l.Extends)
+		}
+		if err := resolve(baseIdx, visiting); err != nil {
+			return err
+		}
+		inheritListener(l, &c.Listeners[baseIdx])
+		resolved[i] = true
+		return nil
+	}
+
+	for i := range c.Listeners {
+		if err := resolve(i, map[int]bool{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inheritListener copies unset fields of l from base.
+func inheritListener(l, base *Listener) {
+	if l.Host == "" {
+		l.Host = base.Host
+	}
+	if l.ReadTimeout == 0 {
+		l.ReadTimeout = base.ReadTimeout
+	}
+	if l.WriteTimeout == 0 {
+		l.WriteTimeout = base.WriteTimeout
+	}
+	if l.Type == "" {
+		l.Type = base.Type
+	}
+	if len(l.Models) == 0 {
+		l.Models = base.Models
+	}
+	if len(l.EmbeddingModels) == 0 {
+		l.EmbeddingModels = base.EmbeddingModels
+	}
+	if l.Strategy == "" {
+		l.Strategy = base.Strategy
+	}
+	if l.Bandit == (BanditConfig{}) {
+		l.Bandit = base.Bandit
+	}
+	if len(l.Routes) == 0 {
+		l.Routes = base.Routes
+	}
+	if len(l.PromptRoutes) == 0 {
+		l.PromptRoutes = base.PromptRoutes
+	}
+	if len(l.Experiment.Models) == 0 {
+		l.Experiment = base.Experiment
+	}
+	if l.LogAttempts == "" {
+		l.LogAttempts = base.LogAttempts
+	}
+	if l.Cache.Backend == "" {
+		l.Cache = base.Cache
+	}
+	if l.Transcripts.Dir == "" {
+		l.Transcripts = base.Transcripts
+	}
+	if !l.Broadcast.Enabled {
+		l.Broadcast = base.Broadcast
+	}
+	if l.StreamRepair == "" {
+		l.StreamRepair = base.StreamRepair
+	}
+	if l.StreamHeartbeats == "" {
+		l.StreamHeartbeats = base.StreamHeartbeats
+	}
+	if !l.StreamPacing.enabled() {
+		l.StreamPacing = base.StreamPacing
+	}
+	if l.HedgeDelay == 0 {
+		l.HedgeDelay = base.HedgeDelay
+	}
+	if !l.SLO.enabled() {
+		l.SLO = base.SLO
+	}
+	if l.Priority == "" {
+		l.Priority = base.Priority
+	}
+	if l.Dispatch == "" {
+		l.Dispatch = base.Dispatch
+	}
+	if l.RetryPolicy == "" {
+		l.RetryPolicy = base.RetryPolicy
+	}
+	if len(l.DenyModels) == 0 {
+		l.DenyModels = base.DenyModels
+	}
+	if l.UnavailableModels == "" {
+		l.UnavailableModels = base.UnavailableModels
+	}
+	if l.ModelList == "" {
+		l.ModelList = base.ModelList
+	}
+	if l.ProbeStatus == 0 {
+		l.ProbeStatus = base.ProbeStatus
+	}
+	if l.ErrorDetail == "" {
+		l.ErrorDetail = base.ErrorDetail
+	}
+	if l.MaxBodySize == 0 {
+		l.MaxBodySize = base.MaxBodySize
+	}
+	if l.ResponseTimeout == 0 {
+		l.ResponseTimeout = base.ResponseTimeout
+	}
+	if !l.Allowlist.active() {
+		l.Allowlist = base.Allowlist
+	}
+	if !l.Filter.active() {
+		l.Filter = base.Filter
+	}
+	if l.AutoContinue.MaxContinuations == 0 {
+		l.AutoContinue = base.AutoContinue
+	}
+	if !l.SlimBody.enabled() {
+		l.SlimBody = base.SlimBody
+	}
+	if !l.Headers.enabled() {
+		l.Headers = base.Headers
+	}
+	if len(l.Middleware) == 0 {
+		l.Middleware = base.Middleware
+	}
+	if len(l.DisableMiddleware) == 0 {
+		l.DisableMiddleware = base.DisableMiddleware
+	}
+	if len(l.APIKeys) == 0 {
+		l.APIKeys = base.APIKeys
+	}
+	if l.APIKeysFile == "" {
+		l.APIKeysFile = base.APIKeysFile
+	}
+	if l.Corpus.Path == "" {
+		l.Corpus = base.Corpus
+	}
+	if !l.RateLimitHeaders {
+		l.RateLimitHeaders = base.RateLimitHeaders
+	}
+	if !l.ExposeMetadata {
+		l.ExposeMetadata = base.ExposeMetadata
+	}
+}
+
+// applyDefaults sets default values for unset configuration fields.
+func applyDefaults(c *Config) {
+	if c.Log.Format == "" {
+		c.Log.Format = logFormatText
+	}
+	if c.Log.Level == "" {
+		c.Log.Level = "info"
+	}
+	c.Retry.applyDefaults()
+	for name, p := range c.RetryPolicies {
+		p.applyDefaults()
+		c.RetryPolicies[name] = p
+	}
+	if c.Server.ShutdownTimeout == 0 {
+		c.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if c.Server.QuotaState == "" {
+		c.Server.QuotaState = "key_quotas.json"
+	}
+	if c.Server.ModelStats == "" {
+		c.Server.ModelStats = "model_stats.json"
+	}
+	if c.Admin.Host == "" {
+		c.Admin.Host = "127.0.0.1"
+	}
+
+	// Apply listener defaults
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		if l.Host == "" {
+			l.Host = "127.0.0.1"
+		}
+		if l.ReadTimeout == 0 {
+			l.ReadTimeout = time.Minute
+		}
+		if l.WriteTimeout == 0 {
+			l.WriteTimeout = 10 * time.Minute
+		}
+		if l.Strategy == "" {
+			l.Strategy = strategyPriority
+		}
+		if b := &l.Bandit; l.Strategy == strategyBandit {
+			if b.Exploration == 0 {
+				b.Exploration = 0.1
+			}
+			if b.MinAttempts == 0 {
+				b.MinAttempts = 5
+			}
+			if b.SuccessWeight == 0 && b.LatencyWeight == 0 && b.CostWeight == 0 {
+				b.SuccessWeight, b.LatencyWeight, b.CostWeight = 1, 0.5, 0.25
+			}
+		}
+		if l.LogAttempts == "" {
+			l.LogAttempts = logAttemptsAll
+		}
+		if l.StreamRepair == "" {
+			l.StreamRepair = streamRepairOff
+		}
+		if l.StreamHeartbeats == "" {
+			l.StreamHeartbeats = streamHeartbeatsPass
+		}
+		if l.Dispatch == "" {
+			l.Dispatch = dispatchChain
+		}
+		if l.UnavailableModels == "" {
+			l.UnavailableModels = unavailableModelsOff
+		}
+		if l.ProbeStatus == 0 {
+			l.ProbeStatus = http.StatusMethodNotAllowed
+		}
+		if l.ErrorDetail == "" {
+			l.ErrorDetail = errorDetailOff
+		}
+		if l.MaxBodySize == 0 {
+			l.MaxBodySize = defaultMaxBodySize
+		}
+		if l.Corpus.SampleRate == 0 {
+			l.Corpus.SampleRate = 1
+		}
+		if l.Corpus.MaxFiles == 0 {
+			l.Corpus.MaxFiles = 5
+		}
+		l.Filter.applyDefaults()
+		if l.Cache.MaxEntries == 0 {
+			l.Cache.MaxEntries = 1000
+		}
+		if l.Cache.TTL == 0 {
+			l.Cache.TTL = time.Hour
+		}
+		if l.Cache.BypassHeader == "" {
+			l.Cache.BypassHeader = "X-Cache-Bypass"
+		}
+		if l.Transcripts.Header == "" {
+			l.Transcripts.Header = "X-Conversation-ID"
+		}
+		if l.Broadcast.Header == "" {
+			l.Broadcast.Header = "X-Broadcast-Session"
+		}
+		if l.Priority == "" {
+			l.Priority = priorityInteractive
+		}
+		if l.SLO.Objective == 0 {
+			l.SLO.Objective = 0.95
+		}
+		if l.SLO.Window == 0 {
+			l.SLO.Window = time.Hour
+		}
+		for j := range l.Binds {
+			b := &l.Binds[j]
+			if b.Host == "" {
+				b.Host = l.Host
+			}
+			if b.Port == 0 {
+				b.Port = l.Port
+			}
+		}
+	}
+	c.resolveStatePaths()
+}
+
+// applyDefaults fills the unset settings of [retry] or a retry policy.
+func (r *RetryConfig) applyDefaults() {
+	if r.MaxCycles == 0 {
+		r.MaxCycles = 10
+	}
+	if r.DefaultTimeout == 0 {
+		r.DefaultTimeout = 30 * time.Second
+	}
+	if r.DefaultInterval == 0 {
+		r.DefaultInterval = 100 * time.Millisecond
+	}
+	if r.MaxRetryAfter == 0 {
+		r.MaxRetryAfter = time.Minute
+	}
+	if r.StreamBufferBytes == 0 {
+		r.StreamBufferBytes = 64 * 1024
+	}
+}
+
+// ListenerRetry returns the retry settings of a listener: its retry policy,
+// or [retry] without one.
+func (c *Config) ListenerRetry(l *Listener) RetryConfig {
+	if p, ok := c.RetryPolicies[l.RetryPolicy]; ok && l.RetryPolicy != "" {
+		return p
+	}
+	return c.Retry
+}
+
+// resolveStatePaths makes the relative paths of the files HydraLLM writes
+// relative to state_dir, so configs sharing a working directory keep their
+// logs, corpora, and transcripts apart.
+func (c *Config) resolveStatePaths() {
+	resolve := func(path string) string {
+		if c.StateDir == "" || path == "" || path == "-" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(c.StateDir, path)
+	}
+	c.Log.AccessLog = resolve(c.Log.AccessLog)
+	c.Log.UsageLog = resolve(c.Log.UsageLog)
+	c.Server.QuotaState = resolve(c.Server.QuotaState)
+	c.Server.ModelStats = resolve(c.Server.ModelStats)
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		l.Corpus.Path = resolve(l.Corpus.Path)
+		l.Transcripts.Dir = resolve(l.Transcripts.Dir)
+	}
+}
+
+// validate checks the configuration for errors and parses derived fields.
+func (c *Config) validate() error {
+	if c.Log.Format != "" && c.Log.Format != logFormatText && c.Log.Format != logFormatJSON {
+		return fmt.Errorf("unsupported log format %q (supported: text, json)", c.Log.Format)
+	}
+	if c.Retry.TotalTimeout < 0 {
+		return fmt.Errorf("retry total_timeout must not be negative, got %s", c.Retry.TotalTimeout)
+	}
+	for name, p := range c.RetryPolicies {
+		if p.TotalTimeout < 0 {
+			return fmt.Errorf(
+				"retry policy %q: total_timeout must not be negative, got %s",
+				name,
+				p.TotalTimeout,
+			)
+		}
+	}
+
+	// Validate providers
+	if len(c.Providers) == 0 {
+		return errors.New("at least one provider must be configured")
+	}
+
+	// Parse and validate provider URLs
+	for name, p := range c.Providers {
+		resolvedURL := p.GetURL()
+		parsedURL, err := url.Parse(resolvedURL)
+		if err != nil {
+			return fmt.Errorf("invalid URL for provider %q: %w", name, err)
+		}
+		if parsedURL.Scheme == "" || parsedURL.Host == "" {
+			return fmt.Errorf(
+				"invalid URL for provider %q: must include scheme and host, got %q",
+				name,
+				resolvedURL,
+			)
+		}
+
+		scheme := strings.ToLower(parsedURL.Scheme)
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf(
+				"invalid URL for provider %q: unsupported scheme %q (supported: http, https)",
+				name,
+				parsedURL.Scheme,
+			)
+		}
+
+		if p.ProxyURL != "" {
+			proxyURL, err := url.Parse(resolveEnvOrValue(p.ProxyURL))
+			if err != nil {
+				return fmt.Errorf("invalid proxy_url for provider %q: %w", name, err)
+			}
+			switch strings.ToLower(proxyURL.Scheme) {
+			case "http", "https", "socks5", "socks5h":
+			default:
+				return fmt.Errorf(
+					"invalid proxy_url for provider %q: unsupported scheme %q (supported: http, https, socks5, socks5h)",
+					name,
+					proxyURL.Scheme,
+				)
+			}
+			if proxyURL.Host == "" {
+				return fmt.Errorf("invalid proxy_url for provider %q: host is required", name)
+			}
+			p.ParsedProxyURL = proxyURL
+		}
+
+		if p.DNSOverHTTPS != "" {
+			dohURL, err := url.Parse(resolveEnvOrValue(p.DNSOverHTTPS))
+			if err != nil {
+				return fmt.Errorf("invalid dns_over_https for provider %q: %w", name, err)
+			}
+			if !strings.EqualFold(dohURL.Scheme, "https") {
+				return fmt.Errorf(
+					"invalid dns_over_https for provider %q: unsupported scheme %q (supported: https)",
+					name,
+					dohURL.Scheme,
+				)
+			}
+			if dohURL.Host == "" {
+				return fmt.Errorf("invalid dns_over_https for provider %q: host is required", name)
+			}
+			p.ParsedDNSOverHTTPS = dohURL
+		}
+
+		if p.HostHeader != "" {
+			if u, err := url.Parse("//" + p.HostHeader); err != nil || u.Host != p.HostHeader ||
+				u.Hostname() == "" {
+				return fmt.Errorf("provider %q: invalid host_header %q", name, p.HostHeader)
+			}
+		}
+
+		if p.Auth != "" && p.Auth != authAmbient {
+			return fmt.Errorf("provider %q: unsupported auth %q (supported: ambient)", name, p.Auth)
+		}
+
+		if p.RateLimit.RequestsPerMinute < 0 || p.RateLimit.TokensPerMinute < 0 ||
+			p.RateLimit.MaxWait < 0 || p.RateLimit.MaxConcurrency < 0 {
+			return fmt.Errorf("provider %q: rate_limit values must not be negative", name)
+		}
+		if hc := p.HealthCheck; hc.Interval < 0 || hc.Timeout < 0 || hc.FailureThreshold < 0 {
+			return fmt.Errorf("provider %q: health_check values must not be negative", name)
+		}
+		if cc := p.CatalogCheck; cc.Interval < 0 || cc.Timeout < 0 {
+			return fmt.Errorf("provider %q: catalog_check values must not be negative", name)
+		}
+		if err := p.Signing.validate(); err != nil {
+			return fmt.Errorf("provider %q: %w", name, err)
+		}
+		if err := p.Headers.validate(); err != nil {
+			return fmt.Errorf("provider %q: headers: %w", name, err)
+		}
+		if p.EmbeddingBatchSize < 0 {
+			return fmt.Errorf(
+				"provider %q: embedding_batch_size must not be negative, got %d",
+				name,
+				p.EmbeddingBatchSize,
+			)
+		}
+		contentErrors, err := parseContentErrors(p.ContentErrors)
+		if err != nil {
+			return fmt.Errorf("provider %q: %w", name, err)
+		}
+		p.ParsedContentErrors = contentErrors
+
+		// Normalize path by removing trailing slashes
+		parsedURL.Path = strings.TrimRight(parsedURL.Path, "/")
+		p.ParsedURL = parsedURL
+		c.Providers[name] = p
+	}
+
+	// Validate models
+	if len(c.Models) == 0 {
+		return errors.New("at least one model must be configured")
+	}
+
+	for id, m := range c.Models {
+		m.ID = id
+
+		if m.Provider == "" {
+			return fmt.Errorf("model %q: provider is required", id)
+		}
+		provider, ok := c.Providers[m.Provider]
+		if !ok {
+			return fmt.Errorf("model %q: provider %q not found", id, m.Provider)
+		}
+		if m.Model == "" {
+			return fmt.Errorf("model %q: model is required", id)
+		}
+		if m.Type == "" {
+			return fmt.Errorf("model %q: type is required", id)
+		}
+		if !isSupportedModelType(m.Type) {
+			return fmt.Errorf(
+				"model %q: unsupported type %q (supported: openai, anthropic, bedrock, gemini, ollama, template)",
+				id,
+				m.Type,
+			)
+		}
+		if m.Attempts <= 0 {
+			m.Attempts = 1
+		}
+		if m.Weight < 0 {
+			return fmt.Errorf("model %q: weight must not be negative, got %d", id, m.Weight)
+		}
+		if m.Weight == 0 {
+			m.Weight = 1
+		}
+		if m.Price.InputPer1K < 0 || m.Price.OutputPer1K < 0 {
+			return fmt.Errorf("model %q: price must not be negative", id)
+		}
+		if m.FirstByteTimeout < 0 {
+			return fmt.Errorf(
+				"model %q: first_byte_timeout must not be negative, got %s",
+				id,
+				m.FirstByteTimeout,
+			)
+		}
+		if m.RetryPolicy != "" {
+			policy, ok := c.RetryPolicies[m.RetryPolicy]
+			if !ok {
+				return fmt.Errorf("model %q: retry_policy %q not found", id, m.RetryPolicy)
+			}
+			m.Timeout = cmp.Or(m.Timeout, policy.DefaultTimeout)
+			m.Interval = cmp.Or(m.Interval, policy.DefaultInterval)
+		}
+		if m.Timeout == 0 {
+			m.Timeout = c.Retry.DefaultTimeout
+		}
+
+		if m.Type == "template" {
+			if m.Template == "" {
+				return fmt.Errorf("model %q: template is required for template models", id)
+			}
+			tmpl, err := parseBodyTemplate(id, m.Template)
+			if err != nil {
+				return fmt.Errorf("model %q: invalid template: %w", id, err)
+			}
+			m.ParsedTemplate = tmpl
+		}
+
+		if len(m.Stop) > 0 && (m.Type == "bedrock" || m.Type == "template") {
+			return fmt.Errorf("model %q: stop is not supported for %s models", id, m.Type)
+		}
+		if (m.KeepAlive != "" || m.NumCtx != 0) && m.Type != "ollama" {
+			return fmt.Errorf(
+				"model %q: keep_alive and num_ctx are only supported for ollama models",
+				id,
+			)
+		}
+		if _, err := time.ParseDuration(m.KeepAlive); m.KeepAlive != "" && err != nil {
+			return fmt.Errorf("model %q: invalid keep_alive %q", id, m.KeepAlive)
+		}
+		if m.NumCtx < 0 {
+			return fmt.Errorf("model %q: num_ctx must not be negative", id)
+		}
+		if !isSupportedToolPolicy(m.Tools.Mode) {
+			return fmt.Errorf(
+				"model %q: unsupported tools mode %q (supported: strip, reject)",
+				id,
+				m.Tools.Mode,
+			)
+		}
+		if m.Tools.Mode == "" && (len(m.Tools.Allow) > 0 || len(m.Tools.Deny) > 0) {
+			return fmt.Errorf("model %q: tools allow and deny require a tools mode", id)
+		}
+		for i := range m.Params {
+			if err := m.Params[i].validate(); err != nil {
+				return fmt.Errorf("model %q: %w", id, err)
+			}
+		}
+		if slices.Contains(m.Output.TrimPrefixes, "") {
+			return fmt.Errorf("model %q: output trim_prefixes must not be empty", id)
+		}
+		for i, r := range m.Output.Replace {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil || r.Pattern == "" {
+				return fmt.Errorf("model %q: invalid output replace pattern %q", id, r.Pattern)
+			}
+			m.Output.Replace[i].Parsed = re
+		}
+		if err := m.Assert.validate(); err != nil {
+			return fmt.Errorf("model %q: %w", id, err)
+		}
+
+		// Validate bedrock provider credentials
+		if m.Type == "bedrock" {
+			if err := validateBedrockCredentials(m.Provider, provider); err != nil {
+				return fmt.Errorf("model %q: %w", id, err)
+			}
+		}
+		if m.Type == "gemini" {
+			if path := provider.GetGoogleCredentialsFile(); path != "" {
+				if _, err := loadGoogleServiceAccount(path); err != nil {
+					return fmt.Errorf("model %q: provider %q: %w", id, m.Provider, err)
+				}
+			}
+		}
+
+		c.Models[id] = m
+	}
+
+	// Validate listeners
+	if len(c.Listeners) == 0 {
+		return errors.New("at least one listener must be configured")
+	}
+
+	if err := c.Geo.resolve(); err != nil {
+		return err
+	}
+	for i, r := range c.Routes {
+		name := cmp.Or(r.Name, fmt.Sprintf("routes[%d]", i))
+		if _, err := compileRule(r); err != nil {
+			return fmt.Errorf("route %q: %w", name, err)
+		}
+		for _, region := range r.Regions {
+			// Viper lowercases the keys of [geo.regions]
+			if _, ok := c.Geo.regions[strings.ToLower(region)]; !ok {
+				return fmt.Errorf("route %q: region %q not defined in [geo]", name, region)
+			}
+		}
+		for _, listener := range r.Listeners {
+			if FindListener(c, listener) == nil {
+				return fmt.Errorf("route %q: listener %q not found", name, listener)
+			}
+		}
+	}
+
+	listenerNames := make(map[string]struct{}, len(c.Listeners))
+	listenerAddrs := make(map[string]string, len(c.Listeners))
+	corpusPaths := make(map[string]string)
+
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+
+		if l.Name == "" {
+			return fmt.Errorf("listener %d: name is required", i)
+		}
+		if _, exists := listenerNames[l.Name]; exists {
+			return fmt.Errorf("listener %q: duplicate name", l.Name)
+		}
+		listenerNames[l.Name] = struct{}{}
+
+		if l.Port == 0 {
+			return fmt.Errorf("listener %q: port is required", l.Name)
+		}
+		if _, ok := c.RetryPolicies[l.RetryPolicy]; l.RetryPolicy != "" && !ok {
+			return fmt.Errorf("listener %q: retry_policy %q not found", l.Name, l.RetryPolicy)
+		}
+		if l.Port < 1 || l.Port > 65535 {
+			return fmt.Errorf(
+				"listener %q: port must be between 1 and 65535, got %d",
+				l.Name,
+				l.Port,
+			)
+		}
+
+		for _, b := range l.Binds {
+			if b.Port < 1 || b.Port > 65535 {
+				return fmt.Errorf(
+					"listener %q: bind port must be between 1 and 65535, got %d",
+					l.Name,
+					b.Port,
+				)
+			}
+		}
+
+		for _, listenerAddr := range l.Addresses() {
+			if existingName, exists := listenerAddrs[listenerAddr]; exists {
+				return fmt.Errorf(
+					"listener %q: duplicate listen address %q (already used by listener %q)",
+					l.Name,
+					listenerAddr,
+					existingName,
+				)
+			}
+			listenerAddrs[listenerAddr] = l.Name
+		}
+
+		if len(l.Models) == 0 {
+			return fmt.Errorf("listener %q: must reference at least one model", l.Name)
+		}
+
+		if l.Strategy != "" && !isSupportedStrategy(l.Strategy) {
+			return fmt.Errorf(
+				"listener %q: unsupported strategy %q "+
+					"(supported: priority, round_robin, weighted, least_latency, bandit, adaptive)",
+				l.Name,
+				l.Strategy,
+			)
+		}
+
+		if b := l.Bandit; b.Exploration < 0 || b.Exploration > 1 {
+			return fmt.Errorf("listener %q: bandit exploration must be between 0 and 1", l.Name)
+		}
+		if b := l.Bandit; b.MinAttempts < 0 ||
+			b.SuccessWeight < 0 || b.LatencyWeight < 0 || b.CostWeight < 0 {
+			return fmt.Errorf(
+				"listener %q: bandit min_attempts and weights must not be negative",
+				l.Name,
+			)
+		}
+
+		if l.LogAttempts != "" && !isSupportedLogAttempts(l.LogAttempts) {
+			return fmt.Errorf(
+				"listener %q: unsupported log_attempts %q (supported: all, failures, final)",
+				l.Name,
+				l.LogAttempts,
+			)
+		}
+
+		if l.StreamRepair != "" && !isSupportedStreamRepair(l.StreamRepair) {
+			return fmt.Errorf(
+				"listener %q: unsupported stream_repair %q (supported: off, error, continue)",
+				l.Name,
+				l.StreamRepair,
+			)
+		}
+		if l.StreamHeartbeats != "" && !isSupportedStreamHeartbeats(l.StreamHeartbeats) {
+			return fmt.Errorf(
+				"listener %q: unsupported stream_heartbeats %q (supported: pass, drop)",
+				l.Name,
+				l.StreamHeartbeats,
+			)
+		}
+		if l.StreamPacing.Interval < 0 || l.StreamPacing.MaxLag < 0 {
+			return fmt.Errorf("listener %q: stream_pacing durations must not be negative", l.Name)
+		}
+
+		if l.HedgeDelay < 0 {
+			return fmt.Errorf("listener %q: hedge_delay must not be negative", l.Name)
+		}
+
+		if l.Priority != "" && !isSupportedPriority(l.Priority) {
+			return fmt.Errorf(
+				"listener %q: unsupported priority %q (supported: interactive, batch)",
+				l.Name,
+				l.Priority,
+			)
+		}
+
+		if l.SLO.Latency < 0 || l.SLO.TTFT < 0 {
+			return fmt.Errorf("listener %q: slo targets must not be negative", l.Name)
+		}
+		if l.SLO.Objective < 0 || l.SLO.Objective >= 1 {
+			return fmt.Errorf("listener %q: slo objective must be between 0 and 1", l.Name)
+		}
+		if l.SLO.Window < 0 || (l.SLO.Window > 0 && l.SLO.Window < time.Minute) {
+			return fmt.Errorf("listener %q: slo window must be at least 1m", l.Name)
+		}
+
+		if l.Dispatch != "" && !isSupportedDispatch(l.Dispatch) {
+			return fmt.Errorf(
+				"listener %q: unsupported dispatch %q (supported: chain, passthrough)",
+				l.Name,
+				l.Dispatch,
+			)
+		}
+		if l.Dispatch == dispatchPassthrough &&
+			(len(l.PromptRoutes) > 0 || len(l.Experiment.Models) > 0) {
+			return fmt.Errorf(
+				"listener %q: passthrough dispatch excludes prompt_routes and experiment",
+				l.Name,
+			)
+		}
+		if len(l.DenyModels) > 0 && l.Dispatch != dispatchPassthrough {
+			return fmt.Errorf("listener %q: deny_models requires passthrough dispatch", l.Name)
+		}
+		for _, pattern := range l.DenyModels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("listener %q: invalid deny_models pattern %q", l.Name, pattern)
+			}
+		}
+
+		if l.UnavailableModels != "" && !isSupportedUnavailableModels(l.UnavailableModels) {
+			return fmt.Errorf(
+				"listener %q: unsupported unavailable_models %q (supported: off, omit, annotate)",
+				l.Name,
+				l.UnavailableModels,
+			)
+		}
+
+		if l.ModelList != "" && !isSupportedModelList(l.ModelList) {
+			return fmt.Errorf(
+				"listener %q: unsupported model_list %q (supported: upstream, local, merged)",
+				l.Name,
+				l.ModelList,
+			)
+		}
+
+		if l.ErrorDetail != "" && !isSupportedErrorDetail(l.ErrorDetail) {
+			return fmt.Errorf(
+				"listener %q: unsupported error_detail %q (supported: off, summary, attempts)",
+				l.Name,
+				l.ErrorDetail,
+			)
+		}
+		if l.MaxBodySize < 0 {
+			return fmt.Errorf(
+				"listener %q: max_body_size must not be negative, got %d",
+				l.Name,
+				l.MaxBodySize,
+			)
+		}
+		if l.ResponseTimeout < 0 {
+			return fmt.Errorf(
+				"listener %q: response_timeout must not be negative, got %s",
+				l.Name,
+				l.ResponseTimeout,
+			)
+		}
+
+		if l.ProbeStatus != 0 && l.ProbeStatus != http.StatusOK &&
+			l.ProbeStatus != http.StatusMethodNotAllowed {
+			return fmt.Errorf(
+				"listener %q: unsupported probe_status %d (supported: 200, 405)",
+				l.Name,
+				l.ProbeStatus,
+			)
+		}
+
+		for _, prefix := range l.Allowlist.Paths {
+			if !strings.HasPrefix(prefix, "/") {
+				return fmt.Errorf(
+					"listener %q: allowlist path %q must start with /",
+					l.Name,
+					prefix,
+				)
+			}
+		}
+
+		if err := l.Filter.validate(); err != nil {
+			return fmt.Errorf("listener %q: %w", l.Name, err)
+		}
+
+		if l.AutoContinue.MaxContinuations < 0 || l.AutoContinue.MaxOutputTokens < 0 {
+			return fmt.Errorf("listener %q: auto_continue limits must not be negative", l.Name)
+		}
+		if l.SlimBody.KeepMessages < 0 {
+			return fmt.Errorf("listener %q: slim_body keep_messages must not be negative", l.Name)
+		}
+		if err := l.Headers.validate(); err != nil {
+			return fmt.Errorf("listener %q: headers: %w", l.Name, err)
+		}
+
+		if l.Type != "" && !isSupportedModelType(l.Type) {
+			return fmt.Errorf("listener %q: unsupported type %q", l.Name, l.Type)
+		}
+
+		// Resolve models and validate type consistency
+		l.ResolvedModels = make([]Model, 0, len(l.Models))
+		listenerType := l.Type
+
+		for _, modelID := range l.Models {
+			m, ok := c.Models[modelID]
+			if !ok {
+				return fmt.Errorf("listener %q: model %q not found", l.Name, modelID)
+			}
+
+			if listenerType == "" {
+				listenerType = m.Type
+			} else if m.Type != listenerType && !canTranslate(listenerType, m.Type) {
+				return fmt.Errorf(
+					"listener %q: mixed model types are not allowed (expected %q, got %q from model %q)",
+					l.Name,
+					listenerType,
+					m.Type,
+					modelID,
+				)
+			}
+
+			l.ResolvedModels = append(l.ResolvedModels, m)
+		}
+
+		l.ConfigType = listenerType
+		if l.ModelList == "" {
+			// Anthropic clients such as Claude Code list models on startup
+			l.ModelList = modelListUpstream
+			if listenerType == "anthropic" {
+				l.ModelList = modelListLocal
+			}
+		}
+		if l.ModelList == modelListMerged && listenerType != "openai" {
+			return fmt.Errorf("listener %q: model_list merged requires an openai listener", l.Name)
+		}
+
+		// Resolve routes against the listener type
+		l.ResolvedRoutes = make(map[string][]Model, len(l.Routes))
+		for _, r := range l.Routes {
+			if r.Model == "" {
+				return fmt.Errorf("listener %q: route model is required", l.Name)
+			}
+			if _, exists := l.ResolvedRoutes[r.Model]; exists {
+				return fmt.Errorf("listener %q: duplicate route for model %q", l.Name, r.Model)
+			}
+			if len(r.Models) == 0 {
+				return fmt.Errorf(
+					"listener %q: route %q must reference at least one model",
+					l.Name,
+					r.Model,
+				)
+			}
+
+			chain, err := c.resolveChain(r.Models, listenerType)
+			if err != nil {
+				return fmt.Errorf("listener %q: route %q: %w", l.Name, r.Model, err)
+			}
+			l.ResolvedRoutes[r.Model] = chain
+		}
+		if len(l.EmbeddingModels) > 0 {
+			chain, err := c.resolveChain(l.EmbeddingModels, listenerType)
+			if err != nil {
+				return fmt.Errorf("listener %q: embedding_models: %w", l.Name, err)
+			}
+			l.ResolvedEmbeddings = chain
+		}
+
+		l.ResolvedPromptRoutes = make([]resolvedPromptRoute, 0, len(l.PromptRoutes))
+		for i, r := range l.PromptRoutes {
+			name := cmp.Or(r.Name, fmt.Sprintf("prompt_routes[%d]", i))
+			if r.Class != "" && r.Class != promptClassCode && r.Class != promptClassProse {
+				return fmt.Errorf(
+					"listener %q: prompt route %q: unsupported class %q (supported: code, prose)",
+					l.Name,
+					name,
+					r.Class,
+				)
+			}
+			if r.MinChars < 0 || r.MaxChars < 0 || (r.MaxChars > 0 && r.MaxChars < r.MinChars) {
+				return fmt.Errorf("listener %q: prompt route %q: invalid length range", l.Name, name)
+			}
+			for _, lang := range slices.Concat(r.Languages, r.ExcludeLanguages) {
+				if !slices.Contains(promptLanguages, lang) {
+					return fmt.Errorf(
+						"listener %q: prompt route %q: unsupported language %q (supported: %s)",
+						l.Name,
+						name,
+						lang,
+						strings.Join(promptLanguages, ", "),
+					)
+				}
+			}
+			if len(r.Models) == 0 {
+				return fmt.Errorf(
+					"listener %q: prompt route %q must reference at least one model",
+					l.Name,
+					name,
+				)
+			}
+			chain, err := c.resolveChain(r.Models, listenerType)
+			if err != nil {
+				return fmt.Errorf("listener %q: prompt route %q: %w", l.Name, name, err)
+			}
+			// The listener's models stay as fallbacks after the route's own
+			for _, m := range l.ResolvedModels {
+				if !slices.ContainsFunc(chain, func(c Model) bool { return c.ID == m.ID }) {
+					chain = append(chain, m)
+				}
+			}
+			r.Name = name
+			l.ResolvedPromptRoutes = append(
+				l.ResolvedPromptRoutes,
+				resolvedPromptRoute{PromptRoute: r, chain: chain},
+			)
+		}
+
+		rules, err := c.resolveRules(l)
+		if err != nil {
+			return err
+		}
+		l.ResolvedRules = rules
+
+		if len(l.Experiment.Models) > 0 {
+			if l.Experiment.Percent < 0 || l.Experiment.Percent > 100 {
+				return fmt.Errorf(
+					"listener %q: experiment percent must be between 0 and 100, got %d",
+					l.Name,
+					l.Experiment.Percent,
+				)
+			}
+			chain, err := c.resolveChain(l.Experiment.Models, listenerType)
+			if err != nil {
+				return fmt.Errorf("listener %q: experiment: %w", l.Name, err)
+			}
+			l.ResolvedExperiment = chain
+		}
+
+		middleware, err := resolveMiddleware(c.Middleware, l)
+		if err != nil {
+			return fmt.Errorf("listener %q: %w", l.Name, err)
+		}
+		l.ResolvedMiddleware = middleware
+
+		apiKeys, err := resolveAPIKeys(l)
+		if err != nil {
+			return fmt.Errorf("listener %q: %w", l.Name, err)
+		}
+		if len(apiKeys) > 0 && !slices.Contains(l.ResolvedMiddleware, "auth") {
+			return fmt.Errorf(
+				"listener %q: api keys are configured but the auth middleware is not enabled",
+				l.Name,
+			)
+		}
+		l.ResolvedAPIKeys = apiKeys
+		if slices.ContainsFunc(apiKeys, func(k APIKey) bool { return k.Quota.enabled() }) &&
+			!slices.Contains(l.ResolvedMiddleware, "quota") {
+			return fmt.Errorf(
+				"listener %q: api key quotas are configured "+
+					"but the quota middleware is not enabled",
+				l.Name,
+			)
+		}
+		if l.Allowlist.active() && !slices.Contains(l.ResolvedMiddleware, "allowlist") {
+			return fmt.Errorf(
+				"listener %q: allowlist is configured but the allowlist middleware is not enabled",
+				l.Name,
+			)
+		}
+		if l.Filter.active() && !slices.Contains(l.ResolvedMiddleware, "filter") {
+			return fmt.Errorf(
+				"listener %q: filter is configured but the filter middleware is not enabled",
+				l.Name,
+			)
+		}
+
+		if l.Corpus.Path != "" {
+			if l.Corpus.SampleRate < 0 || l.Corpus.SampleRate > 1 {
+				return fmt.Errorf(
+					"listener %q: corpus sample_rate must be between 0 and 1, got %g",
+					l.Name,
+					l.Corpus.SampleRate,
+				)
+			}
+			if existingName, exists := corpusPaths[l.Corpus.Path]; exists {
+				return fmt.Errorf(
+					"listener %q: corpus path %q already used by listener %q",
+					l.Name,
+					l.Corpus.Path,
+					existingName,
+				)
+			}
+			corpusPaths[l.Corpus.Path] = l.Name
+			if l.Corpus.MaxBytes < 0 || l.Corpus.MaxFiles < 0 {
+				return fmt.Errorf(
+					"listener %q: corpus max_bytes and max_files must not be negative",
+					l.Name,
+				)
+			}
+			for _, pattern := range l.Corpus.Redact {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return fmt.Errorf(
+						"listener %q: invalid corpus redact pattern %q: %w",
+						l.Name,
+						pattern,
+						err,
+					)
+				}
+			}
+			if !slices.Contains(l.ResolvedMiddleware, "corpus") {
+				return fmt.Errorf(
+					"listener %q: corpus is configured but the corpus middleware is not enabled",
+					l.Name,
+				)
+			}
+		}
+
+		if err := validateCache(l); err != nil {
+			return fmt.Errorf("listener %q: %w", l.Name, err)
+		}
+		if err := validateTranscripts(l); err != nil {
+			return fmt.Errorf("listener %q: %w", l.Name, err)
+		}
+		if err := validateBroadcast(l); err != nil {
+			return fmt.Errorf("listener %q: %w", l.Name, err)
+		}
+	}
+
+	if c.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf(
+			"server: shutdown_timeout must not be negative, got %s",
+			c.Server.ShutdownTimeout,
+		)
+	}
+	if c.Server.DrainRequestTimeout < 0 {
+		return fmt.Errorf(
+			"server: drain_request_timeout must not be negative, got %s",
+			c.Server.DrainRequestTimeout,
+		)
+	}
+	if c.Server.MaxBufferedBytes < 0 {
+		return fmt.Errorf(
+			"server: max_buffered_bytes must not be negative, got %d",
+			c.Server.MaxBufferedBytes,
+		)
+	}
+	if c.Server.MaxUpstreamConns < 0 {
+		return fmt.Errorf(
+			"server: max_upstream_conns must not be negative, got %d",
+			c.Server.MaxUpstreamConns,
+		)
+	}
+
+	if c.Admin.Port != 0 {
+		if c.Admin.Port < 1 || c.Admin.Port > 65535 {
+			return fmt.Errorf("admin: port must be between 1 and 65535, got %d", c.Admin.Port)
+		}
+		adminAddr := c.Admin.Address()
+		if existingName, exists := listenerAddrs[adminAddr]; exists {
+			return fmt.Errorf(
+				"admin: listen address %q already used by listener %q",
+				adminAddr,
+				existingName,
+			)
+		}
+	}
+
+	return nil
+}
+
+// resolveChain looks up the models of a route chain and checks that each can
+// serve a listener of listenerType.
+func (c *Config) resolveChain(ids []string, listenerType string) ([]Model, error) {
+	chain := make([]Model, 0, len(ids))
+	for _, modelID := range ids {
+		m, ok := c.Models[modelID]
+		if !ok {
+			return nil, fmt.Errorf("model %q not found", modelID)
+		}
+		if m.Type != listenerType && !canTranslate(listenerType, m.Type) {
+			return nil, fmt.Errorf(
+				"model %q has type %q, expected %q",
+				modelID,
+				m.Type,
+				listenerType,
+			)
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
+
+// Address returns the admin API host:port.
+func (a *AdminConfig) Address() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+func isSupportedModelType(modelType string) bool {
+	switch modelType {
+	case "openai", "anthropic", "bedrock", "gemini", "ollama", "template":
+		return true
+	default:
+		return false
+	}
+}
+
+// validateBedrockCredentials validates AWS credentials for bedrock providers.
+// For long-term credentials: aws_access_key_id + aws_secret_access_key are required.
+// For temporary credentials: aws_session_token is additionally required.
+// Without static keys the AWS default credential chain is used.
+func validateBedrockCredentials(providerName string, p Provider) error {
+	hasAccessKeyID := p.AWSAccessKeyID != ""
+	hasSecretAccessKey := p.AWSSecretAccessKey != ""
+	hasSessionToken := p.AWSSessionToken != ""
+
+	// access_key_id and secret_access_key must be configured together
+	if hasAccessKeyID != hasSecretAccessKey {
+		return fmt.Errorf(
+			"provider %q: bedrock requires both aws_access_key_id and aws_secret_access_key to be configured together",
+			providerName,
+		)
+	}
+
+	// session_token requires access_key_id and secret_access_key
+	if hasSessionToken && !hasAccessKeyID {
+		return fmt.Errorf(
+			"provider %q: bedrock aws_session_token requires aws_access_key_id and aws_secret_access_key",
+			providerName,
+		)
+	}
+
+	if p.AWSProfile != "" && hasAccessKeyID {
+		return fmt.Errorf(
+			"provider %q: bedrock aws_profile cannot be combined with aws_access_key_id",
+			providerName,
+		)
+	}
+	if p.AssumeRoleARN != "" && !strings.HasPrefix(p.AssumeRoleARN, "arn:") {
+		return fmt.Errorf(
+			"provider %q: assume_role_arn %q is not a role ARN",
+			providerName,
+			p.AssumeRoleARN,
+		)
+	}
+	if p.AssumeRoleExternalID != "" && p.AssumeRoleARN == "" {
+		return fmt.Errorf(
+			"provider %q: assume_role_external_id requires assume_role_arn",
+			providerName,
+		)
+	}
+
+	return nil
+}
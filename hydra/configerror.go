@@ -0,0 +1,290 @@
+package hydra
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+var (
+	// configEntityPattern finds the entity a validation error is about.
+	configEntityPattern = regexp.MustCompile(`\b(provider|model|listener|route|retry policy) (?:"([^"]*)"|(\d+))`)
+	// configKeyPattern finds words of an error message that may name a key.
+	configKeyPattern = regexp.MustCompile(`[a-z][a-z0-9_]*`)
+	// unusedKeysPattern matches a line of a strict decoding error.
+	unusedKeysPattern = regexp.MustCompile(`'([^']*)' has invalid keys: (.+)`)
+	// configPathIndex matches the map keys and slice indexes of a decoder path.
+	configPathIndex = regexp.MustCompile(`\[([^\]]*)\]`)
+)
+
+// ConfigError is a config problem placed in the config file: the config path
+// it concerns and, when the file is TOML, the line of that path.
+type ConfigError struct {
+	File string // Config file, empty when not read from one
+	Line int    // 1-based, 0 when not found
+	Path string // Such as providers.openai.rate_limit or listeners.1
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	var parts []string
+	switch {
+	case e.File != "" && e.Line > 0:
+		parts = append(parts, e.File+":"+strconv.Itoa(e.Line))
+	case e.File != "":
+		parts = append(parts, e.File)
+	}
+	if e.Path != "" {
+		parts = append(parts, e.Path)
+	}
+	return strings.Join(append(parts, e.Err.Error()), ": ")
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// strictDecoding makes unmarshaling fail on keys no option matches.
+func strictDecoding(strict bool) func(*mapstructure.DecoderConfig) {
+	return func(dc *mapstructure.DecoderConfig) {
+		dc.ErrorUnused = strict
+	}
+}
+
+// configPositions maps the config paths of a TOML file to their lines. Paths
+// are lowercase and dot separated, with array tables numbered from 0. A config
+// merged from several files numbers array tables across them, in merge order.
+type configPositions struct {
+	file   string
+	lines  map[string]int
+	files  map[string]string // File of each path, when merged from several
+	arrays map[string]int    // Current index of each array table
+	source string            // File being indexed
+}
+
+// loadConfigPositions indexes the config file at path, or the files merged
+// from it. Files that are not TOML are named in errors without lines.
+func loadConfigPositions(path string) *configPositions {
+	p := &configPositions{file: path, lines: make(map[string]int)}
+	if files, err := configFiles(path); err == nil && len(files) > 1 {
+		p.files = make(map[string]string)
+		for _, file := range files {
+			if data, err := os.ReadFile(file); err == nil {
+				p.source = file
+				p.index(string(data))
+			}
+		}
+		return p
+	}
+	if path == "" || !strings.EqualFold(filepath.Ext(path), ".toml") {
+		return p
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p
+	}
+	p.index(string(data))
+	return p
+}
+
+// index records the line of every table and key in a TOML document.
+func (p *configPositions) index(data string) {
+	if p.arrays == nil {
+		p.arrays = make(map[string]int)
+	}
+	arrays := p.arrays // Array table path -> current index
+	var table []string
+	multiline := false
+	for i, raw := range strings.Split(data, "\n") {
+		line := strings.TrimSpace(raw)
+		if n := strings.Count(line, `"""`) + strings.Count(line, "'''"); n%2 == 1 {
+			// The opening line of a multiline string still holds its key
+			multiline = !multiline
+			if !multiline {
+				continue
+			}
+		} else if multiline {
+			continue
+		}
+
+		switch {
+		case line == "" || line[0] == '#':
+		case strings.HasPrefix(line, "[["):
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "[["), "]]")
+			path := resolveArrayTables(splitConfigKey(name), arrays)
+			key := strings.Join(path, ".")
+			n, seen := arrays[key]
+			if seen {
+				n++
+			}
+			arrays[key] = n
+			table = append(path, strconv.Itoa(n))
+			p.set(table, i+1)
+		case line[0] == '[':
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "["), "]")
+			table = resolveArrayTables(splitConfigKey(name), arrays)
+			p.set(table, i+1)
+		default:
+			name, _, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			p.set(append(append([]string{}, table...), splitConfigKey(name)...), i+1)
+		}
+	}
+}
+
+// set records the line of a path in the file being indexed.
+func (p *configPositions) set(path []string, line int) {
+	key := strings.Join(path, ".")
+	p.lines[key] = line
+	if p.files != nil {
+		p.files[key] = p.source
+	}
+}
+
+// fileOf returns the file a path was found in.
+func (p *configPositions) fileOf(path string) string {
+	if file, ok := p.files[path]; ok {
+		return file
+	}
+	return p.file
+}
+
+// resolveArrayTables inserts the current index after each array table that a
+// table path passes through.
+func resolveArrayTables(segments []string, arrays map[string]int) []string {
+	var out []string
+	for i, s := range segments {
+		out = append(out, s)
+		if i == len(segments)-1 {
+			break
+		}
+		if n, ok := arrays[strings.Join(out, ".")]; ok {
+			out = append(out, strconv.Itoa(n))
+		}
+	}
+	return out
+}
+
+// splitConfigKey splits a dotted TOML key, which may quote its parts, into
+// lowercase segments, matching the keys viper hands to the decoder.
+func splitConfigKey(key string) []string {
+	var segments []string
+	var b strings.Builder
+	var quote rune
+	for _, r := range strings.TrimSpace(key) {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			segments = append(segments, strings.ToLower(strings.TrimSpace(b.String())))
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(segments, strings.ToLower(strings.TrimSpace(b.String())))
+}
+
+// find returns the deepest known part of path and its line.
+func (p *configPositions) find(path []string) (string, int) {
+	for n := len(path); n > 0; n-- {
+		key := strings.Join(path[:n], ".")
+		if line, ok := p.lines[key]; ok {
+			return key, line
+		}
+	}
+	return strings.Join(path, "."), 0
+}
+
+// locate places a validation error of cfg in the config file. The section
+// follows from the provider, model, listener, or route the error names, and
+// the line is that of the first key the message mentions, or of the section.
+func (p *configPositions) locate(cfg *Config, err error) error {
+	if p == nil || p.file == "" {
+		return err
+	}
+	msg := err.Error()
+	m := configEntityPattern.FindStringSubmatchIndex(msg)
+	if m == nil {
+		return &ConfigError{File: p.file, Err: err}
+	}
+	kind, name, index := msg[m[2]:m[3]], "", ""
+	if m[4] >= 0 {
+		name = msg[m[4]:m[5]]
+	} else {
+		index = msg[m[6]:m[7]]
+	}
+
+	var section []string
+	switch kind {
+	case "provider":
+		section = []string{"providers", strings.ToLower(name)}
+	case "model":
+		section = []string{"models", strings.ToLower(name)}
+	case "listener":
+		for i, l := range cfg.Listeners {
+			if index == "" && l.Name == name {
+				index = strconv.Itoa(i)
+				break
+			}
+		}
+		section = []string{"listeners", index}
+	case "retry policy":
+		section = []string{"retry_policies", strings.ToLower(name)}
+	case "route":
+		for i, r := range cfg.Routes {
+			if r.Name == name || name == fmt.Sprintf("routes[%d]", i) {
+				index = strconv.Itoa(i)
+				break
+			}
+		}
+		section = []string{"routes", index}
+	}
+
+	path, line := p.find(section)
+	for _, word := range configKeyPattern.FindAllString(msg[m[1]:], -1) {
+		if l, ok := p.lines[path+"."+word]; ok {
+			path, line = path+"."+word, l
+			break
+		}
+	}
+	file := p.file
+	if line > 0 {
+		file = p.fileOf(path)
+	}
+	return &ConfigError{File: file, Line: line, Path: path, Err: err}
+}
+
+// locateUnusedKeys turns a strict decoding error into one ConfigError per
+// unknown key. Other decoding errors are returned as they are.
+func (p *configPositions) locateUnusedKeys(err error) error {
+	var errs []error
+	for _, m := range unusedKeysPattern.FindAllStringSubmatch(err.Error(), -1) {
+		section := configPathIndex.ReplaceAllString(m[1], ".$1")
+		for key := range strings.SplitSeq(m[2], ", ") {
+			path := strings.TrimPrefix(section+"."+key, ".")
+			ce := &ConfigError{Path: path, Err: fmt.Errorf("unknown key %q", key)}
+			if p != nil {
+				ce.File = p.fileOf(strings.ToLower(path))
+				ce.Line = p.lines[strings.ToLower(path)]
+			}
+			errs = append(errs, ce)
+		}
+	}
+	if len(errs) == 0 {
+		return err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,168 @@
+package hydra
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const configErrorFixture = `# Example config
+[log]
+level = "info"
+
+[providers.openai]
+url = "https://api.openai.com"
+api-key = "$OPENAI_API_KEY"
+
+[providers.openai.rate_limit]
+rpm = 60
+
+[models.gpt]
+provider = "openai"
+model = "gpt-4o"
+system_prompt = """
+port = 1
+"""
+timeout = "-1s"
+
+[[listeners]]
+name = "main"
+port = 8080
+models = ["gpt"]
+
+[[listeners]]
+name = "backup"
+port = 8081
+models = ["gpt"]
+prot = 1
+
+[[listeners.routes]]
+model = "gpt"
+
+[retry_policies.slow]
+total_timeout = "-1s"
+`
+
+func TestConfigPositions_Index(t *testing.T) {
+	p := &configPositions{file: "config.toml", lines: make(map[string]int)}
+	p.index(configErrorFixture)
+
+	tests := []struct {
+		path string
+		line int
+	}{
+		{"log.level", 3},
+		{"providers.openai", 5},
+		{"providers.openai.api-key", 7},
+		{"providers.openai.rate_limit.rpm", 10},
+		{"models.gpt.system_prompt", 15},
+		{"models.gpt.timeout", 18},
+		{"listeners.0", 20},
+		{"listeners.0.port", 22},
+		{"listeners.1.prot", 29},
+		{"listeners.1.routes.0.model", 32},
+	}
+	for _, tt := range tests {
+		if got := p.lines[tt.path]; got != tt.line {
+			t.Errorf("expected %s on line %d, got %d", tt.path, tt.line, got)
+		}
+	}
+	if _, ok := p.lines["models.gpt.port"]; ok {
+		t.Error("expected keys inside a multiline string to be skipped")
+	}
+}
+
+func TestConfigPositions_Locate(t *testing.T) {
+	p := &configPositions{file: "config.toml", lines: make(map[string]int)}
+	p.index(configErrorFixture)
+	cfg := &Config{Listeners: []Listener{{Name: "main"}, {Name: "backup"}}}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "model key",
+			err:  errors.New(`model "gpt": timeout must not be negative`),
+			want: `config.toml:18: models.gpt.timeout: model "gpt": timeout must not be negative`,
+		},
+		{
+			name: "listener by name",
+			err:  errors.New(`listener "backup": port 8081 is already used`),
+			want: `config.toml:27: listeners.1.port: listener "backup": port 8081 is already used`,
+		},
+		{
+			name: "listener by index",
+			err:  errors.New(`listener 0: name is required`),
+			want: `config.toml:21: listeners.0.name: listener 0: name is required`,
+		},
+		{
+			name: "retry policy",
+			err:  errors.New(`retry policy "slow": total_timeout must not be negative`),
+			want: `config.toml:35: retry_policies.slow.total_timeout: ` +
+				`retry policy "slow": total_timeout must not be negative`,
+		},
+		{
+			name: "section only",
+			err:  errors.New(`provider "openai": unsupported auth`),
+			want: `config.toml:5: providers.openai: provider "openai": unsupported auth`,
+		},
+		{
+			name: "no section",
+			err:  errors.New("at least one listener must be configured"),
+			want: `config.toml: at least one listener must be configured`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.locate(cfg, tt.err)
+			if got.Error() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got.Error())
+			}
+			if !errors.Is(got, tt.err) {
+				t.Error("expected the located error to wrap the original")
+			}
+		})
+	}
+
+	var none *configPositions
+	if err := errors.New("x"); none.locate(cfg, err) != err {
+		t.Error("expected errors left alone without a config file")
+	}
+}
+
+func TestLoadConfig_Strict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(configErrorFixture), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("strict", true)
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("expected unknown keys to be rejected")
+	}
+	for _, want := range []string{
+		path + `:7: providers.openai.api-key: unknown key "api-key"`,
+		path + `:10: providers.openai.rate_limit.rpm: unknown key "rpm"`,
+		path + `:29: listeners.1.prot: unknown key "prot"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got:\n%v", want, err)
+		}
+	}
+	var ce *ConfigError
+	if !errors.As(err, &ce) {
+		t.Errorf("expected a ConfigError, got %T", err)
+	}
+}
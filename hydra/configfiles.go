@@ -0,0 +1,271 @@
+package hydra
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/viper"
+)
+
+// configIncludeKey lists the files and directories merged into a config file.
+const configIncludeKey = "include"
+
+// ReadConfig reads the config viper is set up with: a config file, the files
+// it includes, or every TOML file of a config directory. Files are merged by
+// the rules of mergeConfigTables.
+func ReadConfig() error {
+	path := viper.ConfigFileUsed()
+	if info, err := os.Stat(path); path == "" || err != nil || !info.IsDir() {
+		if err := viper.ReadInConfig(); err != nil {
+			return err
+		}
+		if !viper.IsSet(configIncludeKey) {
+			return nil
+		}
+		path = viper.ConfigFileUsed()
+		if !strings.EqualFold(filepath.Ext(path), ".toml") {
+			return fmt.Errorf("%s: include is only supported in TOML config files", path)
+		}
+	}
+
+	files, err := configFiles(path)
+	if err != nil {
+		return err
+	}
+	merged, err := mergeConfigFiles(files)
+	if err != nil {
+		return err
+	}
+	data, err := toml.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to merge config files: %w", err)
+	}
+	viper.SetConfigType("toml")
+	return viper.ReadConfig(bytes.NewReader(data))
+}
+
+// configFiles returns the files a config is merged from, in merge order: the
+// TOML files of a directory, or a config file followed by the files it
+// includes. A config file including nothing is returned alone.
+func configFiles(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if info.IsDir() {
+		return configDirFiles(path)
+	}
+
+	files := []string{path}
+	if !strings.EqualFold(filepath.Ext(path), ".toml") {
+		return files, nil
+	}
+	table, err := readConfigTable(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := table[configIncludeKey]
+	if !ok {
+		return files, nil
+	}
+	entries, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: include must be an array of paths", path)
+	}
+	for _, entry := range entries {
+		include, ok := entry.(string)
+		if !ok || include == "" {
+			return nil, fmt.Errorf("%s: include must be an array of paths", path)
+		}
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		matches, err := includedFiles(include)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %q: %w", path, entry, err)
+		}
+		for _, m := range matches {
+			if !slices.Contains(files, m) {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// includedFiles expands an include entry: a directory, a glob pattern, or a
+// file.
+func includedFiles(include string) ([]string, error) {
+	if strings.ContainsAny(include, "*?[") {
+		matches, err := filepath.Glob(include)
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(matches)
+		return matches, nil
+	}
+	info, err := os.Stat(include)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return configDirFiles(include)
+	}
+	return []string{include}, nil
+}
+
+// configDirFiles returns the TOML files in dir and its subdirectories,
+// ordered by path so merges are the same on every host. Hidden files and
+// directories are skipped, such as editor swap files.
+func configDirFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".toml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("config directory %s has no .toml files", dir)
+	}
+	return files, nil
+}
+
+// readConfigTable decodes a TOML file.
+func readConfigTable(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	table := make(map[string]any)
+	if err := toml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return table, nil
+}
+
+// mergeConfigFiles merges TOML files in order. Only the first may include
+// others.
+func mergeConfigFiles(files []string) (map[string]any, error) {
+	merged := make(map[string]any)
+	setBy := make(map[string]string)
+	for i, file := range files {
+		table, err := readConfigTable(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := table[configIncludeKey]; ok && i > 0 {
+			return nil, fmt.Errorf("%s: include is only read from the main config file", file)
+		}
+		delete(table, configIncludeKey)
+		if err := mergeConfigTables(merged, table, "", file, setBy); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// mergeConfigTables merges the table src, read from file, into dst. Tables
+// merge key by key and arrays of tables are appended in file order; any
+// other key set by two files is an error, so no file silently overrides
+// another. Keys compare case-insensitively, as viper lowercases them. setBy
+// records the file that set each key or table.
+func mergeConfigTables(
+	dst, src map[string]any,
+	prefix, file string,
+	setBy map[string]string,
+) error {
+	// Sorted, so the same conflict is reported every time
+	for _, name := range slices.Sorted(maps.Keys(src)) {
+		key, value := strings.ToLower(name), src[name]
+		path := strings.TrimPrefix(prefix+"."+key, ".")
+		existing, ok := dst[key]
+		if !ok {
+			dst[key] = lowerConfigKeys(value)
+			setBy[path] = file
+			continue
+		}
+
+		dstTable, dstIsTable := existing.(map[string]any)
+		srcTable, srcIsTable := value.(map[string]any)
+		if dstIsTable && srcIsTable {
+			if err := mergeConfigTables(dstTable, srcTable, path, file, setBy); err != nil {
+				return err
+			}
+			continue
+		}
+		dstArray, dstIsArray := existing.([]any)
+		srcArray, srcIsArray := value.([]any)
+		if dstIsArray && srcIsArray && isTableArray(dstArray) && isTableArray(srcArray) {
+			dst[key] = append(dstArray, srcArray...)
+			continue
+		}
+		origin := configOrigin(setBy, path)
+		if origin == file {
+			// Keys differing only in case, which viper would merge
+			return fmt.Errorf("%s: %s is set twice", file, path)
+		}
+		return fmt.Errorf("%s is set in both %s and %s", path, origin, file)
+	}
+	return nil
+}
+
+// configOrigin returns the file that set path, or the table holding it.
+func configOrigin(setBy map[string]string, path string) string {
+	for {
+		if file, ok := setBy[path]; ok {
+			return file
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return ""
+		}
+		path = path[:i]
+	}
+}
+
+// isTableArray reports whether every element of a is a table.
+func isTableArray(a []any) bool {
+	for _, v := range a {
+		if _, ok := v.(map[string]any); !ok {
+			return false
+		}
+	}
+	return len(a) > 0
+}
+
+// lowerConfigKeys lowercases the keys of v and its nested tables, so later
+// files merge into them case-insensitively. Arrays are left as they are.
+func lowerConfigKeys(v any) any {
+	table, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	lowered := make(map[string]any, len(table))
+	for key, value := range table {
+		lowered[strings.ToLower(key)] = lowerConfigKeys(value)
+	}
+	return lowered
+}
@@ -0,0 +1,203 @@
+package hydra
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// writeConfigFiles writes files, keyed by path relative to dir.
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var configDirFixture = map[string]string{
+	"providers.toml": `
+[providers.openai]
+url = "https://api.openai.com/v1"
+api_key = "sk-test"
+`,
+	"models.toml": `
+[models.gpt]
+provider = "openai"
+model = "gpt-5"
+type = "openai"
+`,
+	"listeners/main.toml": `
+[[listeners]]
+name = "main"
+port = 8080
+models = ["gpt"]
+`,
+	"listeners/backup.toml": `
+[[listeners]]
+name = "backup"
+port = 8081
+models = ["gpt"]
+`,
+	"listeners/.main.toml.swp": "not toml",
+	".git/config.toml":         "not = [toml",
+}
+
+func TestConfigFiles_Directory(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, configDirFixture)
+
+	files, err := configFiles(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	want := []string{
+		"listeners/backup.toml",
+		"listeners/main.toml",
+		"models.toml",
+		"providers.toml",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("expected files %v, got %v", want, names)
+	}
+
+	if _, err := configFiles(t.TempDir()); err == nil {
+		t.Error("expected error for a directory without TOML files")
+	}
+}
+
+func TestConfigFiles_Include(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.toml":            `include = ["conf.d", "extra/*.toml", "conf.d/b.toml"]`,
+		"conf.d/b.toml":          "",
+		"conf.d/a.toml":          "",
+		"extra/one.toml":         "",
+		"extra/ignored.toml.bak": "",
+	})
+
+	files, err := configFiles(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "config.toml"),
+		filepath.Join(dir, "conf.d", "a.toml"),
+		filepath.Join(dir, "conf.d", "b.toml"),
+		filepath.Join(dir, "extra", "one.toml"),
+	}
+	if !slices.Equal(files, want) {
+		t.Errorf("expected files %v, got %v", want, files)
+	}
+
+	writeConfigFiles(t, dir, map[string]string{"config.toml": `include = ["missing"]`})
+	if _, err := configFiles(filepath.Join(dir, "config.toml")); err == nil {
+		t.Error("expected error for a missing include")
+	}
+}
+
+func TestMergeConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"a.toml": `
+[log]
+level = "debug"
+
+[providers.openai]
+url = "https://api.openai.com/v1"
+
+[[listeners]]
+name = "a"
+`,
+		"b.toml": `
+[Log]
+format = "json"
+
+[providers.anthropic]
+url = "https://api.anthropic.com"
+
+[[listeners]]
+name = "b"
+`,
+		"conflict.toml": `
+[providers.openai]
+url = "https://example.com/v1"
+`,
+		"include.toml": `include = ["a.toml"]`,
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	merged, err := mergeConfigFiles([]string{path("a.toml"), path("b.toml")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log, _ := merged["log"].(map[string]any)
+	if log["level"] != "debug" || log["format"] != "json" {
+		t.Errorf("expected tables merged key by key, got %v", merged["log"])
+	}
+	if providers, _ := merged["providers"].(map[string]any); len(providers) != 2 {
+		t.Errorf("expected both providers, got %v", merged["providers"])
+	}
+	listeners, _ := merged["listeners"].([]any)
+	if len(listeners) != 2 || listeners[1].(map[string]any)["name"] != "b" {
+		t.Errorf("expected listeners appended in file order, got %v", listeners)
+	}
+
+	_, err = mergeConfigFiles([]string{path("a.toml"), path("conflict.toml")})
+	if err == nil || !strings.Contains(err.Error(), "providers.openai.url is set in both "+
+		path("a.toml")+" and "+path("conflict.toml")) {
+		t.Errorf("expected a conflict naming both files, got %v", err)
+	}
+	if _, err := mergeConfigFiles([]string{path("a.toml"), path("include.toml")}); err == nil {
+		t.Error("expected error for include outside the main config file")
+	}
+}
+
+func TestReadConfig_Directory(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, configDirFixture)
+	t.Cleanup(viper.Reset)
+	viper.SetConfigFile(dir)
+	if err := ReadConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Listeners) != 2 || cfg.Listeners[0].Name != "backup" ||
+		cfg.Providers["openai"].APIKey != "sk-test" {
+		t.Errorf("expected the merged config, got %+v", cfg)
+	}
+
+	// Errors name the file and line of the merged key
+	writeConfigFiles(t, dir, map[string]string{"listeners/main.toml": `
+[[listeners]]
+name = "main"
+port = 8080
+models = ["missing"]
+`})
+	if err := ReadConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = LoadConfig()
+	want := filepath.Join(dir, "listeners", "main.toml") + ":2: listeners.1"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error at %s, got %v", want, err)
+	}
+}
@@ -0,0 +1,164 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// contentErrorDetailLimit bounds the error detail kept from a response body.
+const contentErrorDetailLimit = 200
+
+// errContentError marks a successful response whose body reports an error.
+var errContentError = errors.New("response body reported an error")
+
+var contentErrorsCounter = metrics.Counter(
+	"hydrallm_content_errors_total",
+	"Successful responses whose body reported an error, by provider.",
+)
+
+// defaultContentErrors are the content_errors matchers of each model type,
+// used when a provider sets none.
+var defaultContentErrors = map[string][]contentErrorMatcher{
+	"openai":    mustParseContentErrors("error", "object=error"),
+	"template":  mustParseContentErrors("error"),
+	"anthropic": mustParseContentErrors("error"),
+	"gemini":    mustParseContentErrors("error"),
+	"ollama":    mustParseContentErrors("error"),
+}
+
+// contentErrorMatcher matches a value in a JSON response body. Without an
+// operator it matches when the path holds anything but null or false.
+type contentErrorMatcher struct {
+	path  []string // Object keys, or indexes into arrays
+	op    string   // "", "=", or "!="
+	value string
+}
+
+// parseContentError parses a matcher such as "error", "object=error", or
+// "base_resp.status_code!=0".
+func parseContentError(s string) (contentErrorMatcher, error) {
+	var m contentErrorMatcher
+	path := s
+	if p, v, ok := strings.Cut(s, "!="); ok {
+		path, m.op, m.value = p, "!=", v
+	} else if p, v, ok := strings.Cut(s, "="); ok {
+		path, m.op, m.value = p, "=", v
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return m, fmt.Errorf("invalid content error matcher %q: path is empty", s)
+	}
+	m.path = strings.Split(path, ".")
+	if slices.Contains(m.path, "") {
+		return m, fmt.Errorf("invalid content error matcher %q: empty path segment", s)
+	}
+	return m, nil
+}
+
+// parseContentErrors parses a provider's content_errors. A single "-"
+// disables detection and yields an empty, non-nil list.
+func parseContentErrors(matchers []string) ([]contentErrorMatcher, error) {
+	if len(matchers) == 0 {
+		return nil, nil
+	}
+	parsed := make([]contentErrorMatcher, 0, len(matchers))
+	if len(matchers) == 1 && matchers[0] == "-" {
+		return parsed, nil
+	}
+	for _, s := range matchers {
+		m, err := parseContentError(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, m)
+	}
+	return parsed, nil
+}
+
+func mustParseContentErrors(matchers ...string) []contentErrorMatcher {
+	parsed, err := parseContentErrors(matchers)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// lookup returns the value at the matcher's path in doc.
+func (m contentErrorMatcher) lookup(doc any) (any, bool) {
+	for _, key := range m.path {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// match reports whether doc matches, with the matched value as detail.
+func (m contentErrorMatcher) match(doc any) (string, bool) {
+	v, ok := m.lookup(doc)
+	if !ok {
+		return "", false
+	}
+	s, isString := v.(string)
+	if !isString {
+		raw, _ := json.Marshal(v)
+		s = string(raw)
+	}
+	switch m.op {
+	case "=":
+		ok = s == m.value
+	case "!=":
+		ok = s != m.value
+	default:
+		ok = v != nil && v != false
+	}
+	return s, ok
+}
+
+// contentErrorMatchers returns the provider's content_errors, or the defaults
+// of the model type when it sets none.
+func (p Provider) contentErrorMatchers(modelType string) []contentErrorMatcher {
+	if p.ParsedContentErrors != nil {
+		return p.ParsedContentErrors
+	}
+	return defaultContentErrors[modelType]
+}
+
+// checkContentError returns an error wrapping errContentError if the body of
+// a successful response matches any of the matchers. Bodies too large to peek
+// at are not errors. The response body is left intact.
+func checkContentError(resp *http.Response, matchers []contentErrorMatcher) error {
+	if len(matchers) == 0 || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var doc any
+	if json.Unmarshal(peekErrorBody(resp), &doc) != nil {
+		return nil
+	}
+	for _, m := range matchers {
+		if detail, ok := m.match(doc); ok {
+			if len(detail) > contentErrorDetailLimit {
+				detail = detail[:contentErrorDetailLimit] + "..."
+			}
+			return fmt.Errorf("%w: %s", errContentError, detail)
+		}
+	}
+	return nil
+}
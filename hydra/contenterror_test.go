@@ -0,0 +1,203 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestParseContentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		matchers []string
+		expected int // -1 for nil
+		wantErr  bool
+	}{
+		{name: "unset", expected: -1},
+		{name: "disabled", matchers: []string{"-"}, expected: 0},
+		{name: "matchers", matchers: []string{"error", "base_resp.status_code!=0"}, expected: 2},
+		{name: "empty path", matchers: []string{"=error"}, wantErr: true},
+		{name: "empty segment", matchers: []string{"base_resp..code"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseContentErrors(tt.matchers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.expected == -1 {
+				if parsed != nil {
+					t.Errorf("expected nil matchers, got %v", parsed)
+				}
+			} else if parsed == nil || len(parsed) != tt.expected {
+				t.Errorf("expected %d matchers, got %v", tt.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestCheckContentError(t *testing.T) {
+	tests := []struct {
+		name     string
+		matchers []string
+		status   int
+		body     string
+		expected string // Error detail, empty for none
+	}{
+		{
+			name:     "error object",
+			matchers: []string{"error"},
+			status:   http.StatusOK,
+			body:     `{"error":{"message":"overloaded"}}`,
+			expected: `{"message":"overloaded"}`,
+		},
+		{
+			name:     "null error",
+			matchers: []string{"error"},
+			status:   http.StatusOK,
+			body:     `{"error":null,"choices":[]}`,
+		},
+		{
+			name:     "value",
+			matchers: []string{"object=error"},
+			status:   http.StatusOK,
+			body:     `{"object":"error","message":"bad"}`,
+			expected: "error",
+		},
+		{
+			name:     "not equal",
+			matchers: []string{"base_resp.status_code!=0"},
+			status:   http.StatusOK,
+			body:     `{"base_resp":{"status_code":1002,"status_msg":"rate limited"}}`,
+			expected: "1002",
+		},
+		{
+			name:     "not equal passes",
+			matchers: []string{"base_resp.status_code!=0"},
+			status:   http.StatusOK,
+			body:     `{"base_resp":{"status_code":0}}`,
+		},
+		{
+			name:     "array index",
+			matchers: []string{"0.error"},
+			status:   http.StatusOK,
+			body:     `[{"error":"quota"}]`,
+			expected: "quota",
+		},
+		{
+			name:     "success",
+			matchers: []string{"error"},
+			status:   http.StatusOK,
+			body:     `{"choices":[{"message":{"content":"error"}}]}`,
+		},
+		{
+			name:     "not json",
+			matchers: []string{"error"},
+			status:   http.StatusOK,
+			body:     "error",
+		},
+		{
+			name:     "other status",
+			matchers: []string{"error"},
+			status:   http.StatusCreated,
+			body:     `{"error":"x"}`,
+		},
+		{
+			name:   "disabled",
+			status: http.StatusOK,
+			body:   `{"error":"x"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			err := checkContentError(resp, mustParseContentErrors(tt.matchers...))
+			switch {
+			case tt.expected == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.expected != "" && (!errors.Is(err, errContentError) ||
+				!strings.HasSuffix(err.Error(), ": "+tt.expected)):
+				t.Errorf("expected content error %q, got %v", tt.expected, err)
+			}
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("expected body to be left intact, got %q", body)
+			}
+		})
+	}
+}
+
+func TestTransport_RoundTrip_ContentErrorFallback(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"error":{"message":"upstream overloaded"}}`))
+	}))
+	defer failing.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	}))
+	defer healthy.Close()
+
+	models := []Model{
+		{
+			ID:       "content-failing",
+			Provider: "content-failing",
+			Model:    "m",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+		{
+			ID:       "content-healthy",
+			Provider: "content-healthy",
+			Model:    "m",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"content-failing": {URL: failing.URL, ParsedURL: mustParseURL(failing.URL)},
+		"content-healthy": {URL: healthy.URL, ParsedURL: mustParseURL(healthy.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"m"}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"id":"ok"}` {
+		t.Errorf("expected response from fallback model, got %q", body)
+	}
+	if got := modelHealth.get("content-failing"); got.ConsecutiveFailures != 2 {
+		t.Errorf("expected both content errors to be recorded, got %+v", got)
+	}
+}
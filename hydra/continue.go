@@ -0,0 +1,213 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/tidwall/sjson"
+)
+
+// AutoContinueConfig configures automatic continuation of non-streaming
+// responses cut off by the output token limit. It is disabled when
+// max_continuations is zero.
+type AutoContinueConfig struct {
+	MaxContinuations int `mapstructure:"max_continuations"` // Continuation requests per response
+	MaxOutputTokens  int `mapstructure:"max_output_tokens"` // Total output cap, 0 for none
+}
+
+// completion is the generated text and stop state of an OpenAI chat completion
+// or Anthropic message response.
+type completion struct {
+	anthropic    bool
+	textPath     string // sjson path of the text that continuations extend
+	text         string
+	truncated    bool
+	promptTokens int // OpenAI only, to recompute total_tokens
+	outputTokens int
+}
+
+// parseCompletion reads the parts of a response that continuation needs. It
+// reports false for responses that cannot be continued, such as those with
+// several choices or ending in a tool call.
+func parseCompletion(b []byte) (completion, bool) {
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content   *string         `json:"content"`
+				ToolCalls json.RawMessage `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+		Usage      struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			OutputTokens     int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if json.Unmarshal(b, &resp) != nil {
+		return completion{}, false
+	}
+
+	switch {
+	case len(resp.Choices) == 1:
+		choice := resp.Choices[0]
+		if choice.Message.Content == nil ||
+			(len(choice.Message.ToolCalls) > 0 && string(choice.Message.ToolCalls) != "null") {
+			return completion{}, false
+		}
+		return completion{
+			textPath:     "choices.0.message.content",
+			text:         *choice.Message.Content,
+			truncated:    choice.FinishReason == "length",
+			promptTokens: resp.Usage.PromptTokens,
+			outputTokens: resp.Usage.CompletionTokens,
+		}, true
+	case len(resp.Content) > 0:
+		last := len(resp.Content) - 1
+		if resp.Content[last].Type != "text" {
+			return completion{}, false
+		}
+		return completion{
+			anthropic:    true,
+			textPath:     "content." + strconv.Itoa(last) + ".text",
+			text:         resp.Content[last].Text,
+			truncated:    resp.StopReason == "max_tokens",
+			outputTokens: resp.Usage.OutputTokens,
+		}, true
+	default:
+		return completion{}, false
+	}
+}
+
+// stitchCompletion extends the response orig, parsed as c, with the text and
+// stop state of the continuation next. Output token usage is summed.
+func stitchCompletion(orig []byte, c, next completion) ([]byte, completion, error) {
+	c.text += next.text
+	c.truncated = next.truncated
+	c.outputTokens += next.outputTokens
+
+	type edit struct {
+		path  string
+		value any
+	}
+	edits := []edit{{c.textPath, c.text}}
+	if c.anthropic {
+		stop := "end_turn"
+		if next.truncated {
+			stop = "max_tokens"
+		}
+		edits = append(edits,
+			edit{"stop_reason", stop},
+			edit{"usage.output_tokens", c.outputTokens},
+		)
+	} else {
+		finish := "stop"
+		if next.truncated {
+			finish = "length"
+		}
+		edits = append(edits,
+			edit{"choices.0.finish_reason", finish},
+			edit{"usage.completion_tokens", c.outputTokens},
+			edit{"usage.total_tokens", c.promptTokens + c.outputTokens},
+		)
+	}
+
+	out := orig
+	for _, e := range edits {
+		var err error
+		if out, err = sjson.SetBytes(out, e.path, e.value); err != nil {
+			return nil, c, err
+		}
+	}
+	return out, c, nil
+}
+
+// continueTruncated issues continuation requests while a non-streaming
+// response stops at the output token limit, and replaces the response body
+// with the stitched result. Responses it cannot continue are left intact.
+func (t *RetryTransport) continueTruncated(
+	ctx context.Context,
+	req *http.Request,
+	body []byte,
+	resp *http.Response,
+	cfg AutoContinueConfig,
+) {
+	if cfg.MaxContinuations <= 0 || ctx.Value(continuationContextKey{}) != nil ||
+		resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	defer func() {
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		resp.ContentLength = int64(len(respBody))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(respBody)))
+	}()
+	if err != nil {
+		t.logger.Warn("failed to read response for continuation", "error", err)
+		return
+	}
+
+	c, ok := parseCompletion(respBody)
+	for i := 0; ok && c.truncated && i < cfg.MaxContinuations; i++ {
+		if cfg.MaxOutputTokens > 0 && c.outputTokens >= cfg.MaxOutputTokens {
+			break
+		}
+		t.logger.Info("continuing truncated response", "continuation", i+1, "chars", len(c.text))
+
+		next, err := t.sendContinuation(ctx, req, body, c.text)
+		if err != nil {
+			t.logger.Warn("continuation failed", "error", err)
+			return
+		}
+		nextCompletion, ok := parseCompletion(next)
+		if !ok || nextCompletion.anthropic != c.anthropic {
+			return
+		}
+		stitched, merged, err := stitchCompletion(respBody, c, nextCompletion)
+		if err != nil {
+			t.logger.Warn("failed to stitch continuation", "error", err)
+			return
+		}
+		respBody, c = stitched, merged
+	}
+}
+
+// sendContinuation sends the original request with the text so far as a
+// trailing assistant message, and returns the response body.
+func (t *RetryTransport) sendContinuation(
+	ctx context.Context,
+	req *http.Request,
+	body []byte,
+	text string,
+) ([]byte, error) {
+	contBody, err := continuationBody(body, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build continuation: %w", err)
+	}
+	contReq := req.Clone(context.WithValue(ctx, continuationContextKey{}, true))
+	contReq.Body = io.NopCloser(bytes.NewReader(contBody))
+	contReq.ContentLength = int64(len(contBody))
+	contReq.Header.Del("Accept-Encoding")
+
+	resp, err := t.RoundTrip(contReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("continuation failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
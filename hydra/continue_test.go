@@ -0,0 +1,89 @@
+package hydra
+
+import "testing"
+
+func TestParseCompletion(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		ok       bool
+		expected completion
+	}{
+		{
+			name: "openai truncated",
+			body: `{"choices":[{"message":{"content":"Hi"},"finish_reason":"length"}],` +
+				`"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			ok: true,
+			expected: completion{
+				textPath:     "choices.0.message.content",
+				text:         "Hi",
+				truncated:    true,
+				promptTokens: 3,
+				outputTokens: 1,
+			},
+		},
+		{
+			name: "anthropic truncated",
+			body: `{"type":"message","content":[{"type":"thinking","thinking":"..."},` +
+				`{"type":"text","text":"Hi"}],"stop_reason":"max_tokens","usage":{"output_tokens":4}}`,
+			ok: true,
+			expected: completion{
+				anthropic:    true,
+				textPath:     "content.1.text",
+				text:         "Hi",
+				truncated:    true,
+				outputTokens: 4,
+			},
+		},
+		{
+			name: "openai tool call",
+			body: `{"choices":[{"message":{"content":"","tool_calls":[{"id":"c"}]},` +
+				`"finish_reason":"length"}]}`,
+		},
+		{
+			name: "multiple choices",
+			body: `{"choices":[{"message":{"content":"a"}},{"message":{"content":"b"}}]}`,
+		},
+		{
+			name: "anthropic tool use",
+			body: `{"content":[{"type":"tool_use","id":"t"}],"stop_reason":"max_tokens"}`,
+		},
+		{
+			name: "not a completion",
+			body: `{"data":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCompletion([]byte(tt.body))
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStitchCompletion_Anthropic(t *testing.T) {
+	orig := []byte(`{"type":"message","content":[{"type":"text","text":"Once upon"}],` +
+		`"stop_reason":"max_tokens","usage":{"input_tokens":9,"output_tokens":2}}`)
+	c, _ := parseCompletion(orig)
+	next, _ := parseCompletion([]byte(`{"type":"message","content":[{"type":"text",` +
+		`"text":" a time"}],"stop_reason":"max_tokens","usage":{"output_tokens":2}}`))
+
+	got, merged, err := stitchCompletion(orig, c, next)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"type":"message","content":[{"type":"text","text":"Once upon a time"}],` +
+		`"stop_reason":"max_tokens","usage":{"input_tokens":9,"output_tokens":4}}`
+	if string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if !merged.truncated || merged.outputTokens != 4 {
+		t.Errorf("expected merged completion to stay truncated with 4 tokens, got %+v", merged)
+	}
+}
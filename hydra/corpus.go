@@ -0,0 +1,375 @@
+package hydra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// corpusMaxCapture bounds how much of a request or response body is recorded.
+const corpusMaxCapture = 10 * 1024 * 1024
+
+// CorpusConfig configures recording of prompt/response pairs for a listener.
+// Recording is disabled when no path is set.
+type CorpusConfig struct {
+	Path        string   `mapstructure:"path"`         // JSONL file records are appended to
+	SampleRate  float64  `mapstructure:"sample_rate"`  // Fraction of requests recorded, default 1
+	ExcludeKeys []string `mapstructure:"exclude_keys"` // API key names never recorded
+	Redact      []string `mapstructure:"redact"`       // Extra patterns replaced with [REDACTED]
+	MaxBytes    int64    `mapstructure:"max_bytes"`    // Rotate the file past this size, 0 for never
+	MaxFiles    int      `mapstructure:"max_files"`    // Rotated files kept, default 5
+}
+
+// corpusRecord is one line of a corpus file.
+type corpusRecord struct {
+	Time       time.Time       `json:"time"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Listener   string          `json:"listener"`
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	Provider   string          `json:"provider,omitempty"` // Provider that served the request
+	Model      string          `json:"model,omitempty"`    // Upstream model that served it
+	Duration   float64         `json:"duration_seconds"`
+	Request    json.RawMessage `json:"request"`
+	Response   json.RawMessage `json:"response"`
+	Completion string          `json:"completion,omitempty"` // Text assembled from a stream
+}
+
+// piiPatterns are replaced in recorded bodies, in order.
+var piiPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}\b`), "[API_KEY]"},
+	{regexp.MustCompile(`\b(?:\d[ -]?){13,16}\b`), "[CARD]"},
+	{regexp.MustCompile(`\+?\d{1,3}[ .-]?\(?\d{2,4}\)?[ .-]?\d{3,4}[ .-]?\d{3,4}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[IP]"},
+}
+
+// redactPII replaces emails, API keys, card and phone numbers, and IP addresses.
+func redactPII(s string) string {
+	for _, p := range piiPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// corpusRedactor returns the redaction of a listener's corpus: PII, then each
+// of its redact patterns. Patterns are checked by validation.
+func corpusRedactor(patterns []string) func(string) string {
+	extra := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		extra = append(extra, regexp.MustCompile(p))
+	}
+	return func(s string) string {
+		s = redactPII(s)
+		for _, re := range extra {
+			s = re.ReplaceAllString(s, "[REDACTED]")
+		}
+		return s
+	}
+}
+
+// redactJSON redacts the string values of a JSON document, leaving numbers and
+// keys untouched. It reports false when b is not valid JSON.
+func redactJSON(b []byte, redact func(string) string) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	out, err := json.Marshal(redactJSONValue(v, redact))
+	return out, err == nil
+}
+
+func redactJSONValue(v any, redact func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return redact(v)
+	case map[string]any:
+		for k, e := range v {
+			v[k] = redactJSONValue(e, redact)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = redactJSONValue(e, redact)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactSSE redacts the JSON payload of each data line of a server-sent event stream.
+func redactSSE(b []byte, redact func(string) string) []byte {
+	lines := bytes.Split(b, []byte("\n"))
+	for i, line := range lines {
+		payload, ok := bytes.CutPrefix(line, []byte("data: "))
+		if !ok {
+			continue
+		}
+		if redacted, ok := redactJSON(payload, redact); ok {
+			lines[i] = append([]byte("data: "), redacted...)
+		} else {
+			lines[i] = []byte(redact(string(line)))
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// newCorpusMiddleware records sampled prompt/response pairs to the listener's
+// corpus file, with the model that served them and the latency. Requests
+// authenticated with an excluded key are never recorded.
+func newCorpusMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if l.Corpus.Path == "" {
+		return nil
+	}
+	writer := &corpusWriter{
+		path:     l.Corpus.Path,
+		maxBytes: l.Corpus.MaxBytes,
+		maxFiles: l.Corpus.MaxFiles,
+	}
+	redact := corpusRedactor(l.Corpus.Redact)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(l.Corpus.ExcludeKeys, apiKeyName(r.Context())) ||
+				rand.Float64() >= l.Corpus.SampleRate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var reqBody []byte
+			if r.Body != nil {
+				var err error
+				reqBody, err = io.ReadAll(io.LimitReader(r.Body, corpusMaxCapture))
+				if err != nil {
+					writeBodyReadError(w, l, err)
+					return
+				}
+				// Larger bodies are forwarded in full, only their start is recorded
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+			}
+
+			start := time.Now()
+			cw := &captureResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			duration := time.Since(start)
+
+			if cw.status >= 400 {
+				return
+			}
+			encoding := cw.Header().Get("Content-Encoding")
+			respBody, ok := decodeCapturedBody(encoding, cw.body.Bytes())
+			if !ok {
+				return
+			}
+			record := corpusRecord{
+				Time:      time.Now().UTC(),
+				RequestID: requestID(r.Context()),
+				Listener:  l.Name,
+				Path:      r.URL.Path,
+				Status:    cw.status,
+				Duration:  duration.Seconds(),
+				Request:   corpusBody(anonymizeRequest(reqBody), redact),
+				Response:  corpusBody(respBody, redact),
+			}
+			access, _ := r.Context().Value(accessRecordContextKey{}).(*accessRecord)
+			if access != nil {
+				access.mu.Lock()
+				record.Provider, record.Model = access.provider, access.model
+				access.mu.Unlock()
+			}
+			if strings.HasPrefix(cw.Header().Get("Content-Type"), "text/event-stream") {
+				record.Completion = redact(streamCompletion(respBody))
+			}
+			if err := writer.append(record); err != nil {
+				logger.Warn("failed to write corpus record", "listener", l.Name, "error", err)
+			}
+		})
+	}
+}
+
+// anonymizeRequest removes end-user identifiers that clients attach to requests.
+func anonymizeRequest(body []byte) []byte {
+	for _, path := range []string{"user", "metadata"} {
+		if out, err := sjson.DeleteBytes(body, path); err == nil {
+			body = out
+		}
+	}
+	return body
+}
+
+// corpusBody redacts a body and embeds it as JSON, or as a JSON string when
+// the body is not JSON, such as a stream of server-sent events.
+func corpusBody(b []byte, redact func(string) string) json.RawMessage {
+	if redacted, ok := redactJSON(b, redact); ok {
+		return redacted
+	}
+	s, _ := json.Marshal(string(redactSSE(b, redact)))
+	return s
+}
+
+// streamCompletion assembles the text generated in an OpenAI, Anthropic, or
+// Gemini server-sent event stream.
+func streamCompletion(b []byte) string {
+	var text strings.Builder
+	for line := range bytes.SplitSeq(b, []byte("\n")) {
+		payload, ok := bytes.CutPrefix(bytes.TrimSuffix(line, []byte("\r")), []byte("data:"))
+		if !ok || !gjson.ValidBytes(payload) {
+			continue
+		}
+		event := gjson.ParseBytes(payload)
+		text.WriteString(event.Get("choices.0.delta.content").String())
+		if event.Get("type").String() == "content_block_delta" {
+			text.WriteString(event.Get("delta.text").String())
+		}
+		for _, part := range event.Get("candidates.0.content.parts").Array() {
+			text.WriteString(part.Get("text").String())
+		}
+	}
+	return text.String()
+}
+
+// decodeCapturedBody undoes the response content encoding.
+// It reports false for encodings that cannot be decoded.
+func decodeCapturedBody(encoding string, b []byte) ([]byte, bool) {
+	switch encoding {
+	case "", "identity":
+		return b, true
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, false
+		}
+		defer func() { _ = gz.Close() }()
+		decoded, err := io.ReadAll(io.LimitReader(gz, corpusMaxCapture))
+		return decoded, err == nil
+	default:
+		return nil, false
+	}
+}
+
+// corpusWriter appends records to a JSONL file. With maxBytes set, a file
+// that would grow past it is first rotated to path.1, shifting older files up
+// to path.<maxFiles>.
+type corpusWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int
+}
+
+func (c *corpusWriter) append(record corpusRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.rotate(int64(len(line))); err != nil {
+		return fmt.Errorf("failed to rotate corpus file: %w", err)
+	}
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open corpus file: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to append corpus record: %w", err)
+	}
+	return f.Close()
+}
+
+// rotate moves the file aside when writing n more bytes would take it past
+// maxBytes. A record larger than maxBytes still goes to a fresh file.
+func (c *corpusWriter) rotate(n int64) error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+	info, err := os.Stat(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 || info.Size()+n <= c.maxBytes {
+		return nil
+	}
+
+	rotated := func(i int) string { return c.path + "." + strconv.Itoa(i) }
+	if err := os.Remove(rotated(c.maxFiles)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := c.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(rotated(i), rotated(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(c.path, rotated(1))
+}
+
+// captureResponseWriter copies the response body while passing it through.
+type captureResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *captureResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if remaining := corpusMaxCapture - w.body.Len(); remaining > 0 {
+		w.body.Write(p[:min(len(p), remaining)])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush flushes the underlying writer so streams are not delayed.
+func (w *captureResponseWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *captureResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
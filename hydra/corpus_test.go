@@ -0,0 +1,267 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestRedactPII(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"mail jane.doe@example.com now", "mail [EMAIL] now"},
+		{"key sk-abcdefghijklmnop1234", "key [API_KEY]"},
+		{"card 4111 1111 1111 1111", "card [CARD]"},
+		{"call +1 415-555-0100", "call [PHONE]"},
+		{"host 10.0.0.12", "host [IP]"},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := redactPII(tt.in); got != tt.want {
+			t.Errorf("redactPII(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCorpusBody(t *testing.T) {
+	t.Run("json keeps numbers", func(t *testing.T) {
+		got := string(corpusBody([]byte(`{"created":1700000000,"text":"a@b.io"}`), redactPII))
+		if got != `{"created":1700000000,"text":"[EMAIL]"}` {
+			t.Errorf("unexpected body: %s", got)
+		}
+	})
+
+	t.Run("sse stream", func(t *testing.T) {
+		stream := "data: {\"delta\":\"a@b.io\"}\n\ndata: [DONE]\n\n"
+		var got string
+		if err := json.Unmarshal(corpusBody([]byte(stream), redactPII), &got); err != nil {
+			t.Fatalf("expected JSON string: %v", err)
+		}
+		if !strings.Contains(got, `data: {"delta":"[EMAIL]"}`) || !strings.Contains(got, "[DONE]") {
+			t.Errorf("unexpected stream: %q", got)
+		}
+	})
+}
+
+func TestCorpusRedactor(t *testing.T) {
+	redact := corpusRedactor([]string{`ACME-\d+`})
+	got := redact("ticket ACME-1234 from jane@example.com")
+	if got != "ticket [REDACTED] from [EMAIL]" {
+		t.Errorf("unexpected redaction: %q", got)
+	}
+}
+
+func TestStreamCompletion(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{
+			name: "openai",
+			stream: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			name: "anthropic",
+			stream: "event: content_block_delta\r\n" +
+				"data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"Hel\"}}\r\n\r\n" +
+				"event: content_block_delta\r\n" +
+				"data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"lo\"}}\r\n\r\n" +
+				"event: message_delta\r\n" +
+				"data: {\"type\":\"message_delta\",\"delta\":{\"text\":\"x\"}}\r\n\r\n",
+		},
+		{
+			name: "gemini",
+			stream: "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n" +
+				"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"lo\"}]}}]}\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamCompletion([]byte(tt.stream)); got != "Hello" {
+				t.Errorf("expected Hello, got %q", got)
+			}
+		})
+	}
+}
+
+func TestAnonymizeRequest(t *testing.T) {
+	got := string(anonymizeRequest([]byte(`{"model":"m","user":"u-1","metadata":{"user_id":"x"}}`)))
+	if got != `{"model":"m"}` {
+		t.Errorf("unexpected request: %s", got)
+	}
+}
+
+func TestCorpusMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	l := &Listener{
+		Name:   "main",
+		Corpus: CorpusConfig{Path: path, SampleRate: 1, ExcludeKeys: []string{"private"}},
+	}
+	mw := newCorpusMiddleware(l, &Config{}, log.New(io.Discard))
+	if mw == nil {
+		t.Fatal("expected corpus middleware")
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "hello") {
+			t.Errorf("expected request body to reach the handler, got %q", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"reply":"write to bob@example.com"}`))
+	}))
+
+	send := func(keyName string) {
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/v1/chat/completions",
+			strings.NewReader(`{"messages":[{"role":"user","content":"hello"}],"user":"u-1"}`),
+		)
+		if keyName != "" {
+			req = req.WithContext(context.WithValue(req.Context(), apiKeyNameContextKey{}, keyName))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), "bob@example.com") {
+			t.Errorf("expected client to get the unredacted response, got %q", rec.Body.String())
+		}
+	}
+	send("")
+	send("private")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open corpus: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []corpusRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r corpusRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid corpus line: %v", err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record (excluded key skipped), got %d", len(records))
+	}
+	r := records[0]
+	if r.Listener != "main" || r.Status != http.StatusOK || r.Path != "/v1/chat/completions" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if strings.Contains(string(r.Request), "u-1") {
+		t.Errorf("expected user identifier removed, got %s", r.Request)
+	}
+	if string(r.Response) != `{"reply":"write to [EMAIL]"}` {
+		t.Errorf("expected redacted response, got %s", r.Response)
+	}
+}
+
+func TestCorpusMiddleware_LargeBody(t *testing.T) {
+	l := &Listener{
+		Name:   "main",
+		Corpus: CorpusConfig{Path: filepath.Join(t.TempDir(), "corpus.jsonl"), SampleRate: 1},
+	}
+	mw := newCorpusMiddleware(l, &Config{}, log.New(io.Discard))
+	var got int
+	h := mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = len(body)
+	}))
+
+	// Bodies over the capture size reach the handler in full
+	body := strings.Repeat("x", corpusMaxCapture+100)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != len(body) {
+		t.Errorf("expected %d body bytes, got %d", len(body), got)
+	}
+}
+
+func TestCorpusMiddleware_Disabled(t *testing.T) {
+	if mw := newCorpusMiddleware(&Listener{}, &Config{}, log.New(io.Discard)); mw != nil {
+		t.Error("expected no middleware without a corpus path")
+	}
+}
+
+func TestCorpusMiddleware_Stream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	l := &Listener{
+		Name:   "main",
+		Corpus: CorpusConfig{Path: path, SampleRate: 1, Redact: []string{`ACME-\d+`}},
+	}
+	mw := newCorpusMiddleware(l, &Config{}, log.New(io.Discard))
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record, _ := r.Context().Value(accessRecordContextKey{}).(*accessRecord)
+		record.set(Model{Provider: "openai", Model: "gpt-4o"}, 1, 0, true, "")
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(
+			"data: {\"choices\":[{\"delta\":{\"content\":\"see ACME-\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"42\"}}]}\n\n" +
+				"data: [DONE]\n\n",
+		))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	ctx := context.WithValue(req.Context(), requestIDContextKey{}, "req-1")
+	ctx = context.WithValue(ctx, accessRecordContextKey{}, &accessRecord{})
+	h.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read corpus: %v", err)
+	}
+	var r corpusRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("invalid corpus line: %v", err)
+	}
+	if r.RequestID != "req-1" || r.Provider != "openai" || r.Model != "gpt-4o" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	// Patterns split across events are only caught in the assembled text
+	if r.Completion != "see [REDACTED]" {
+		t.Errorf("expected redacted completion, got %q", r.Completion)
+	}
+	if r.Duration <= 0 {
+		t.Errorf("expected a duration, got %v", r.Duration)
+	}
+}
+
+func TestCorpusWriter_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	writer := &corpusWriter{path: path, maxBytes: 100, maxFiles: 2}
+	record := corpusRecord{Listener: "main", Request: json.RawMessage(`{}`)}
+	for range 4 {
+		if err := writer.append(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != 1 {
+			t.Errorf("expected 1 record in %s, got %d", name, lines)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected files past max_files removed, got %v", err)
+	}
+}
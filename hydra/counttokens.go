@@ -0,0 +1,81 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isTokenCountRequest reports whether req counts the tokens of a message, as
+// in POST /v1/messages/count_tokens.
+func isTokenCountRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost &&
+		strings.HasSuffix(strings.TrimRight(req.URL.Path, "/"), "/messages/count_tokens")
+}
+
+// countTokens sends a token count request to the preferred Anthropic model of
+// a chain: healthy providers first, in the listener's strategy order, with
+// providers that asked clients to back off last. Each model is tried once, and
+// the next one only after a connection error, 429, or 5xx. Counting tokens
+// generates none, so it is kept out of usage, quotas, and model health.
+func (t *RetryTransport) countTokens(
+	ctx context.Context,
+	req *http.Request,
+	body []byte,
+	chain []Model,
+	state *transportState,
+) (*http.Response, error) {
+	var models, saturated []Model
+	quotas, now := providerQuotas.snapshot(), time.Now()
+	ordered := orderModels(state.listener.Strategy, healthyModels(chain), t.requests.Add(1)-1)
+	for _, m := range ordered {
+		if quotas[m.Provider].Saturated(now) {
+			saturated = append(saturated, m)
+		} else {
+			models = append(models, m)
+		}
+	}
+	models = append(models, saturated...)
+
+	var lastResp *http.Response
+	var lastErr error
+	for _, model := range models {
+		if model.Type != "anthropic" {
+			continue
+		}
+		resp, err := t.tryModel(ctx, req, body, model, false, isDebugEnabled(t.logger), state)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			if lastResp != nil {
+				_ = lastResp.Body.Close()
+			}
+			return resp, nil
+		}
+		t.logger.Debug(
+			"token count failed, trying next model",
+			"model",
+			model.ID,
+			"status",
+			resp.StatusCode,
+		)
+		if lastResp != nil {
+			_ = lastResp.Body.Close()
+		}
+		lastResp = resp
+	}
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errors.New("no anthropic model to count tokens")
+}
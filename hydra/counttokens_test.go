@@ -0,0 +1,93 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestIsTokenCountRequest(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{http.MethodPost, "/v1/messages/count_tokens", true},
+		{http.MethodPost, "/v1/messages/count_tokens/", true},
+		{http.MethodGet, "/v1/messages/count_tokens", false},
+		{http.MethodPost, "/v1/messages", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := isTokenCountRequest(req); got != tt.expected {
+			t.Errorf("%s %s: expected %v, got %v", tt.method, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_CountTokens(t *testing.T) {
+	var paths []string
+	upstream := func(status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"input_tokens":42}`))
+		}))
+	}
+	down, up := upstream(http.StatusServiceUnavailable), upstream(http.StatusOK)
+	defer down.Close()
+	defer up.Close()
+
+	providers := map[string]Provider{
+		"count-down": {URL: down.URL, ParsedURL: mustParseURL(down.URL)},
+		"count-up":   {URL: up.URL, ParsedURL: mustParseURL(up.URL)},
+	}
+	model := func(id, provider string) Model {
+		return Model{
+			ID:       id,
+			Provider: provider,
+			Model:    "claude-sonnet-4",
+			Type:     "anthropic",
+			Attempts: 3,
+			Timeout:  time.Second,
+		}
+	}
+	l := &Listener{
+		Name:       "count",
+		ConfigType: "anthropic",
+		ResolvedModels: []Model{
+			model("count-primary", "count-down"),
+			model("count-fallback", "count-up"),
+		},
+	}
+	transport := newListenerTransport(l, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+
+	body := `{"model":"claude","messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/v1/messages/count_tokens",
+		strings.NewReader(body),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || gjson.GetBytes(respBody, "input_tokens").Int() != 42 {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, respBody)
+	}
+	// Each model is tried once, without the retries of generation requests
+	if len(paths) != 2 || paths[1] != "/v1/messages/count_tokens" {
+		t.Errorf("unexpected upstream requests %v", paths)
+	}
+	if usage, ok := modelUsage.snapshot().Models["count-fallback"]; ok {
+		t.Errorf("expected token counts to be no usage, got %+v", usage)
+	}
+}
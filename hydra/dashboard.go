@@ -0,0 +1,331 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dashboardPanel is a time series panel of the generated Grafana dashboard.
+type dashboardPanel struct {
+	Title   string
+	Unit    string // Grafana unit, such as "reqps" or "s"
+	Queries []dashboardQuery
+}
+
+type dashboardQuery struct {
+	Expr   string
+	Legend string
+}
+
+// dashboardRows are the sections of the generated dashboard. Queries refer
+// to the metrics served on the admin /metrics endpoint.
+var dashboardRows = []struct {
+	Title  string
+	Panels []dashboardPanel
+}{
+	{"Usage", []dashboardPanel{
+		{"Tokens per second", "short", []dashboardQuery{{
+			`sum by (model, kind) (rate(hydrallm_tokens_total[$__rate_interval]))`,
+			"{{model}} {{kind}}",
+		}}},
+		{"Estimated cost per hour", "currencyUSD", []dashboardQuery{{
+			`sum by (provider) (rate(hydrallm_cost_usd_total[$__rate_interval])) * 3600`,
+			"{{provider}}",
+		}}},
+		{"Cache requests", "reqps", []dashboardQuery{{
+			`sum by (listener, result) (rate(hydrallm_cache_requests_total[$__rate_interval]))`,
+			"{{listener}} {{result}}",
+		}}},
+	}},
+	{"Reliability", []dashboardPanel{
+		{"Requests served by a fallback model", "percentunit", []dashboardQuery{{
+			`1 - sum by (listener) (rate(hydrallm_fallback_depth_bucket{le="0"}[$__rate_interval]))` +
+				` / sum by (listener) (rate(hydrallm_fallback_depth_count[$__rate_interval]))`,
+			"{{listener}}",
+		}}},
+		{"Upstream errors", "reqps", []dashboardQuery{{
+			`sum by (provider, class) (rate(hydrallm_upstream_errors_total[$__rate_interval]))`,
+			"{{provider}} {{class}}",
+		}}},
+		{"Content errors", "reqps", []dashboardQuery{{
+			`sum by (provider) (rate(hydrallm_content_errors_total[$__rate_interval]))`,
+			"{{provider}}",
+		}}},
+		{"Slimmed requests", "reqps", []dashboardQuery{{
+			`sum by (provider) (rate(hydrallm_slimmed_requests_total[$__rate_interval]))`,
+			"{{provider}}",
+		}}},
+		{"Retry budget exhausted", "reqps", []dashboardQuery{{
+			`sum by (listener) (rate(hydrallm_retry_budget_exhausted_total[$__rate_interval]))`,
+			"{{listener}}",
+		}}},
+		{"Response timeouts", "reqps", []dashboardQuery{{
+			`sum by (listener) (rate(hydrallm_response_timeouts_total[$__rate_interval]))`,
+			"{{listener}}",
+		}}},
+		{"Tool policy actions", "reqps", []dashboardQuery{{
+			`sum by (model, action) (rate(hydrallm_tool_policy_total[$__rate_interval]))`,
+			"{{model}} {{action}}",
+		}}},
+		{"Hedged requests", "reqps", []dashboardQuery{{
+			`sum by (listener, winner) (rate(hydrallm_hedged_requests_total[$__rate_interval]))`,
+			"{{listener}} {{winner}}",
+		}}},
+		{"Routing rule matches", "reqps", []dashboardQuery{{
+			`sum by (listener, rule) (rate(hydrallm_routing_rules_total[$__rate_interval]))`,
+			"{{listener}} {{rule}}",
+		}}},
+	}},
+	{"Providers", []dashboardPanel{
+		{"Provider health", "short", []dashboardQuery{{
+			`hydrallm_provider_healthy`,
+			"{{provider}}",
+		}}},
+		{"In-flight requests", "short", []dashboardQuery{{
+			`hydrallm_provider_in_flight`,
+			"{{provider}}",
+		}}},
+		{"Quota remaining", "percentunit", []dashboardQuery{{
+			`hydrallm_provider_quota_remaining / hydrallm_provider_quota_limit`,
+			"{{provider}} {{kind}}",
+		}}},
+		{"Skipped attempts", "reqps", []dashboardQuery{
+			{
+				`sum by (provider) (rate(hydrallm_rate_limit_skips_total[$__rate_interval]))`,
+				"{{provider}} rate limit",
+			},
+			{
+				`sum by (provider) (rate(hydrallm_saturation_skips_total[$__rate_interval]))`,
+				"{{provider}} saturated",
+			},
+		}},
+		{"DNS-over-HTTPS failures", "reqps", []dashboardQuery{{
+			`sum by (resolver) (rate(hydrallm_dns_resolution_failures_total[$__rate_interval]))`,
+			"{{resolver}}",
+		}}},
+		{"Models retired upstream", "short", []dashboardQuery{
+			{`hydrallm_model_missing_upstream == 1`, "{{model}} missing"},
+			{`hydrallm_model_deprecated_upstream == 1`, "{{model}} deprecated"},
+		}},
+		{"Upstream phase p95", "s", []dashboardQuery{{
+			`histogram_quantile(0.95, sum by (provider, phase, le) ` +
+				`(rate(hydrallm_upstream_phase_seconds_bucket[$__rate_interval])))`,
+			"{{provider}} {{phase}}",
+		}}},
+	}},
+	{"SLOs and experiments", []dashboardPanel{
+		{"SLO compliance", "percentunit", []dashboardQuery{{
+			`hydrallm_slo_compliance_ratio`,
+			"{{listener}} {{kind}}",
+		}}},
+		{"SLO burn rate", "short", []dashboardQuery{{
+			`hydrallm_slo_burn_rate`,
+			"{{listener}} {{kind}}",
+		}}},
+		{"Experiment latency p95", "s", []dashboardQuery{{
+			`histogram_quantile(0.95, sum by (listener, variant, le) ` +
+				`(rate(hydrallm_experiment_latency_seconds_bucket[$__rate_interval])))`,
+			"{{listener}} {{variant}}",
+		}}},
+		{"Experiment error ratio", "percentunit", []dashboardQuery{{
+			`sum by (listener, variant) ` +
+				`(rate(hydrallm_experiment_requests_total{outcome="error"}[$__rate_interval]))` +
+				` / sum by (listener, variant) ` +
+				`(rate(hydrallm_experiment_requests_total[$__rate_interval]))`,
+			"{{listener}} {{variant}}",
+		}}},
+	}},
+	{"Operations", []dashboardPanel{
+		{"Draining requests", "short", []dashboardQuery{{
+			`hydrallm_draining_requests`,
+			"draining",
+		}}},
+		{"Allowlist rejects", "reqps", []dashboardQuery{{
+			`sum by (listener) (rate(hydrallm_allowlist_rejects_total[$__rate_interval]))`,
+			"{{listener}}",
+		}}},
+		{"API key quota rejects", "reqps", []dashboardQuery{{
+			`sum by (listener, key) (rate(hydrallm_key_quota_rejects_total[$__rate_interval]))`,
+			"{{listener}} {{key}}",
+		}}},
+		{"Filter matches", "reqps", []dashboardQuery{{
+			`sum by (listener, rule, action) (rate(hydrallm_filter_matches_total[$__rate_interval]))`,
+			"{{listener}} {{rule}} {{action}}",
+		}}},
+		{"Probe requests", "reqps", []dashboardQuery{{
+			`sum by (listener) (rate(hydrallm_probe_requests_total[$__rate_interval]))`,
+			"{{listener}}",
+		}}},
+	}},
+}
+
+// alertRule is a generated Prometheus alerting rule.
+type alertRule struct {
+	Name     string
+	Expr     string
+	For      string
+	Severity string
+	Summary  string
+}
+
+// alertRules are the generated Prometheus alerting rules.
+var alertRules = []alertRule{
+	{
+		"HydraLLMProviderUnhealthy",
+		`hydrallm_provider_healthy == 0`,
+		"5m",
+		"critical",
+		"Provider {{ $labels.provider }} is failing its health checks",
+	},
+	{
+		"HydraLLMModelMissingUpstream",
+		`hydrallm_model_missing_upstream == 1`,
+		"5m",
+		"warning",
+		"Model {{ $labels.model }} is not in the catalog of provider {{ $labels.provider }}",
+	},
+	{
+		"HydraLLMSLOBurnRateHigh",
+		`hydrallm_slo_burn_rate > 2`,
+		"15m",
+		"warning",
+		"Listener {{ $labels.listener }} spends its {{ $labels.kind }} error budget " +
+			"{{ $value | humanize }}x as fast as allowed",
+	},
+	{
+		"HydraLLMFallbackShareHigh",
+		`1 - sum by (listener) (rate(hydrallm_fallback_depth_bucket{le="0"}[10m]))` +
+			` / sum by (listener) (rate(hydrallm_fallback_depth_count[10m])) > 0.2`,
+		"15m",
+		"warning",
+		"{{ $value | humanizePercentage }} of listener {{ $labels.listener }} requests " +
+			"are served by fallback models",
+	},
+	{
+		"HydraLLMRetryBudgetExhausted",
+		`sum by (listener) (rate(hydrallm_retry_budget_exhausted_total[5m])) > 0`,
+		"10m",
+		"warning",
+		"Requests of listener {{ $labels.listener }} run out of retry.total_timeout",
+	},
+	{
+		"HydraLLMProviderSaturated",
+		`sum by (provider) (rate(hydrallm_saturation_skips_total[5m]))` +
+			` + sum by (provider) (rate(hydrallm_rate_limit_skips_total[5m])) > 0`,
+		"10m",
+		"warning",
+		"Attempts on provider {{ $labels.provider }} are skipped for its rate limits",
+	},
+	{
+		"HydraLLMContentErrors",
+		`sum by (provider) (rate(hydrallm_content_errors_total[5m])) > 0.1`,
+		"10m",
+		"warning",
+		"Provider {{ $labels.provider }} returns errors in successful responses",
+	},
+	{
+		"HydraLLMQuotaLow",
+		`hydrallm_provider_quota_remaining / hydrallm_provider_quota_limit < 0.1`,
+		"5m",
+		"warning",
+		"Provider {{ $labels.provider }} has under 10% of its {{ $labels.kind }} quota left",
+	},
+}
+
+// Grafana layout: panels per row and panel size in grid units.
+const (
+	dashboardColumns     = 3
+	dashboardPanelWidth  = 8
+	dashboardPanelHeight = 8
+)
+
+// WriteGrafanaDashboard writes a Grafana dashboard of the HydraLLM metrics as
+// JSON. Its Prometheus data source is picked with a dashboard variable.
+func WriteGrafanaDashboard(w io.Writer) error {
+	datasource := map[string]string{"type": "prometheus", "uid": "${datasource}"}
+	panels := []map[string]any{}
+	id, y := 1, 0
+	for _, row := range dashboardRows {
+		panels = append(panels, map[string]any{
+			"id":        id,
+			"type":      "row",
+			"title":     row.Title,
+			"collapsed": false,
+			"gridPos":   map[string]int{"h": 1, "w": 24, "x": 0, "y": y},
+			"panels":    []any{},
+		})
+		id++
+		y++
+		for i, p := range row.Panels {
+			targets := make([]map[string]any, len(p.Queries))
+			for j, q := range p.Queries {
+				targets[j] = map[string]any{
+					"datasource":   datasource,
+					"expr":         q.Expr,
+					"legendFormat": q.Legend,
+					"refId":        string(rune('A' + j)),
+				}
+			}
+			panels = append(panels, map[string]any{
+				"id":         id,
+				"type":       "timeseries",
+				"title":      p.Title,
+				"datasource": datasource,
+				"targets":    targets,
+				"fieldConfig": map[string]any{
+					"defaults":  map[string]any{"unit": p.Unit},
+					"overrides": []any{},
+				},
+				"gridPos": map[string]int{
+					"h": dashboardPanelHeight,
+					"w": dashboardPanelWidth,
+					"x": i % dashboardColumns * dashboardPanelWidth,
+					"y": y + i/dashboardColumns*dashboardPanelHeight,
+				},
+			})
+			id++
+		}
+		y += (len(row.Panels) + dashboardColumns - 1) / dashboardColumns * dashboardPanelHeight
+	}
+
+	dashboard := map[string]any{
+		"uid":           "hydrallm",
+		"title":         "HydraLLM",
+		"tags":          []string{"hydrallm"},
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]any{
+			"list": []map[string]any{{
+				"name":  "datasource",
+				"label": "Data source",
+				"type":  "datasource",
+				"query": "prometheus",
+			}},
+		},
+		"panels": panels,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(dashboard)
+}
+
+// WritePrometheusRules writes Prometheus alerting rules on the HydraLLM
+// metrics as a rule file.
+func WritePrometheusRules(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("groups:\n  - name: hydrallm\n    rules:\n")
+	for _, r := range alertRules {
+		fmt.Fprintf(&b, "      - alert: %s\n", r.Name)
+		fmt.Fprintf(&b, "        expr: %s\n", strconv.Quote(r.Expr))
+		fmt.Fprintf(&b, "        for: %s\n", r.For)
+		fmt.Fprintf(&b, "        labels:\n          severity: %s\n", r.Severity)
+		fmt.Fprintf(&b, "        annotations:\n          summary: %s\n", strconv.Quote(r.Summary))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
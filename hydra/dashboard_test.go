@@ -0,0 +1,80 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var metricNamePattern = regexp.MustCompile(`hydrallm_[a-z_]+`)
+
+// checkMetricNames reports metrics referenced by expr that are not registered.
+func checkMetricNames(t *testing.T, expr string) {
+	t.Helper()
+	for _, name := range metricNamePattern.FindAllString(expr, -1) {
+		family := name
+		for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+			if base, ok := strings.CutSuffix(name, suffix); ok && metrics.families[base] != nil &&
+				metrics.families[base].kind == "histogram" {
+				family = base
+			}
+		}
+		if metrics.families[family] == nil {
+			t.Errorf("%s refers to unregistered metric %s", expr, name)
+		}
+	}
+}
+
+func TestWriteGrafanaDashboard(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGrafanaDashboard(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var dashboard struct {
+		Panels []struct {
+			ID      int    `json:"id"`
+			Type    string `json:"type"`
+			Targets []struct {
+				Expr string `json:"expr"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &dashboard); err != nil {
+		t.Fatalf("invalid dashboard JSON: %v", err)
+	}
+
+	ids := make(map[int]bool)
+	queries := 0
+	for _, p := range dashboard.Panels {
+		if ids[p.ID] {
+			t.Errorf("duplicate panel id %d", p.ID)
+		}
+		ids[p.ID] = true
+		for _, target := range p.Targets {
+			queries++
+			checkMetricNames(t, target.Expr)
+		}
+	}
+	if queries == 0 {
+		t.Error("expected panel queries")
+	}
+}
+
+func TestWritePrometheusRules(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePrometheusRules(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "groups:\n") {
+		t.Errorf("expected a rule file, got %q", out)
+	}
+	for _, r := range alertRules {
+		if !strings.Contains(out, "- alert: "+r.Name+"\n") {
+			t.Errorf("expected alert %s", r.Name)
+		}
+		checkMetricNames(t, r.Expr)
+	}
+}
@@ -0,0 +1,87 @@
+package hydra
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// fallbackSummaryInterval is how often the fallback depth summary is logged.
+const fallbackSummaryInterval = 5 * time.Minute
+
+// fallbackDepths counts which chain position served each request, per listener.
+var fallbackDepths = newDepthTracker()
+
+var fallbackDepthHistogram = metrics.Histogram(
+	"hydrallm_fallback_depth",
+	"Position in the model chain of the model that served each request, 0 for the first.",
+	[]float64{0, 1, 2, 3, 5, 8},
+)
+
+// depthTracker accumulates served depths between summaries.
+type depthTracker struct {
+	mu     sync.Mutex
+	counts map[string]map[int]int // listener -> depth -> requests
+}
+
+func newDepthTracker() *depthTracker {
+	return &depthTracker{counts: make(map[string]map[int]int)}
+}
+
+// record notes that a request on listener was served by the model at depth
+// in the order it was tried.
+func (d *depthTracker) record(listener string, depth int) {
+	fallbackDepthHistogram.Observe(float64(depth), "listener", listener)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts[listener] == nil {
+		d.counts[listener] = make(map[int]int)
+	}
+	d.counts[listener][depth]++
+}
+
+// summarize logs the depths recorded since the last summary and resets them.
+func (d *depthTracker) summarize(logger *log.Logger) {
+	d.mu.Lock()
+	counts := d.counts
+	d.counts = make(map[string]map[int]int)
+	d.mu.Unlock()
+
+	for _, listener := range slices.Sorted(maps.Keys(counts)) {
+		depths := counts[listener]
+		total := 0
+		for _, n := range depths {
+			total += n
+		}
+
+		keyvals := []any{
+			"listener", listener,
+			"requests", total,
+			"primary_pct", strconv.FormatFloat(100*float64(depths[0])/float64(total), 'f', 1, 64),
+		}
+		for _, depth := range slices.Sorted(maps.Keys(depths)) {
+			keyvals = append(keyvals, "depth_"+strconv.Itoa(depth), depths[depth])
+		}
+		logger.Info("fallback depth summary", keyvals...)
+	}
+}
+
+// report logs a summary every interval until ctx is done.
+func (d *depthTracker) report(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.summarize(logger)
+		}
+	}
+}
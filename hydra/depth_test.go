@@ -0,0 +1,62 @@
+package hydra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestDepthTracker_Summarize(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.New(&logs)
+	d := newDepthTracker()
+
+	for range 3 {
+		d.record("depth-test", 0)
+	}
+	d.record("depth-test", 2)
+	d.summarize(logger)
+
+	out := logs.String()
+	for _, want := range []string{
+		"fallback depth summary",
+		"listener=depth-test",
+		"requests=4",
+		"primary_pct=75.0",
+		"depth_0=3",
+		"depth_2=1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected summary to contain %q, got %q", want, out)
+		}
+	}
+
+	// Counts reset after each summary
+	logs.Reset()
+	d.summarize(logger)
+	if logs.Len() != 0 {
+		t.Errorf("expected no summary without requests, got %q", logs.String())
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `hydrallm_fallback_depth_count{listener="depth-test"} 4`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("expected metrics to contain %q", want)
+	}
+}
+
+func TestDepthTracker_PrimaryNeverServed(t *testing.T) {
+	var logs bytes.Buffer
+	d := newDepthTracker()
+	d.record("depth-fallback", 1)
+	d.summarize(log.New(&logs))
+
+	if !strings.Contains(logs.String(), "primary_pct=0.0") {
+		t.Errorf("expected primary share of 0, got %q", logs.String())
+	}
+}
@@ -0,0 +1,8 @@
+// Package hydra implements the HydraLLM proxy: config loading, the retry and
+// fallback transport, and the listener servers. The hydrallm command is a thin
+// CLI around it.
+//
+// Programs that only need retries and fallbacks can use a RetryTransport as the
+// Transport of an http.Client, or serve a listener with NewProxy. Build a Config
+// in code and call Prepare, or load one through viper with LoadConfig.
+package hydra
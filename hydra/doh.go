@@ -0,0 +1,279 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	dohTimeout  = 5 * time.Second // Bound of one DNS-over-HTTPS query
+	dohMinTTL   = 5 * time.Second // Floor of cached answer lifetimes
+	dohMaxReply = 64 * 1024       // Largest DNS message read
+)
+
+// DNS record types queried over HTTPS.
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+var dohFailuresCounter = metrics.Counter(
+	"hydrallm_dns_resolution_failures_total",
+	"Failed DNS-over-HTTPS lookups that fell back to the system resolver, by resolver and host.",
+)
+
+// dohResolver resolves host names with DNS-over-HTTPS (RFC 8484) and caches
+// the answers for their TTL.
+type dohResolver struct {
+	endpoint *url.URL
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]dohAnswer // Keyed by host name
+}
+
+type dohAnswer struct {
+	addrs   []net.IP
+	expires time.Time
+}
+
+func newDoHResolver(endpoint *url.URL) *dohResolver {
+	return &dohResolver{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: dohTimeout},
+		cache:    make(map[string]dohAnswer),
+	}
+}
+
+// lookup returns the IPv4 and IPv6 addresses of host, IPv4 first.
+func (r *dohResolver) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	type result struct {
+		addrs []net.IP
+		ttl   time.Duration
+		err   error
+	}
+	results := make([]result, 2)
+	var wg sync.WaitGroup
+	for i, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		wg.Go(func() {
+			addrs, ttl, err := r.query(ctx, host, qtype)
+			results[i] = result{addrs, ttl, err}
+		})
+	}
+	wg.Wait()
+
+	var addrs []net.IP
+	var errs []error
+	ttl := time.Duration(-1)
+	for _, res := range results {
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		addrs = append(addrs, res.addrs...)
+		if len(res.addrs) > 0 && (ttl < 0 || res.ttl < ttl) {
+			ttl = res.ttl
+		}
+	}
+	if len(addrs) == 0 {
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dohAnswer{addrs: addrs, expires: now.Add(max(ttl, dohMinTTL))}
+	r.mu.Unlock()
+	return addrs, nil
+}
+
+// query sends one DNS question and returns the addresses of its answer and
+// their lowest TTL.
+func (r *dohResolver) query(
+	ctx context.Context,
+	host string,
+	qtype uint16,
+) ([]net.IP, time.Duration, error) {
+	msg, err := encodeDNSQuery(host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		r.endpoint.String(),
+		bytes.NewReader(msg),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("dns-over-https: unexpected status %d", resp.StatusCode)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxReply))
+	if err != nil {
+		return nil, 0, err
+	}
+	return decodeDNSAnswer(reply, qtype)
+}
+
+// encodeDNSQuery returns a recursive query for one question in DNS wire
+// format. The ID is zero, as RFC 8484 recommends for HTTP caching.
+func encodeDNSQuery(host string, qtype uint16) ([]byte, error) {
+	msg := []byte{
+		0, 0, // ID
+		1, 0, // Flags: recursion desired
+		0, 1, // Questions
+		0, 0, // Answers
+		0, 0, // Authority records
+		0, 0, // Additional records
+	}
+	for label := range strings.SplitSeq(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, 1), nil // Class IN
+}
+
+// decodeDNSAnswer returns the records of type qtype in a DNS reply and their
+// lowest TTL. Other records, such as the CNAMEs leading to them, are skipped.
+func decodeDNSAnswer(msg []byte, qtype uint16) ([]net.IP, time.Duration, error) {
+	if len(msg) < 12 {
+		return nil, 0, errors.New("dns-over-https: short reply")
+	}
+	if rcode := msg[3] & 0x0f; rcode != 0 {
+		return nil, 0, fmt.Errorf("dns-over-https: response code %d", rcode)
+	}
+	questions := binary.BigEndian.Uint16(msg[4:])
+	answers := binary.BigEndian.Uint16(msg[6:])
+
+	off := 12
+	var err error
+	for range questions {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		off += 4 // Type and class
+	}
+
+	var addrs []net.IP
+	var ttl time.Duration
+	for range answers {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		if off+10 > len(msg) {
+			return nil, 0, errors.New("dns-over-https: truncated record")
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rttl := time.Duration(binary.BigEndian.Uint32(msg[off+4:])) * time.Second
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, 0, errors.New("dns-over-https: truncated record")
+		}
+		data := msg[off : off+length]
+		off += length
+
+		if rtype != qtype || (rtype == dnsTypeA && length != 4) ||
+			(rtype == dnsTypeAAAA && length != 16) {
+			continue
+		}
+		if len(addrs) == 0 || rttl < ttl {
+			ttl = rttl
+		}
+		addrs = append(addrs, net.IP(bytes.Clone(data)))
+	}
+	return addrs, ttl, nil
+}
+
+// skipDNSName returns the offset after the possibly compressed name at off.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1, nil
+		case n&0xc0 == 0xc0:
+			return off + 2, nil // Pointer to a name elsewhere
+		default:
+			off += 1 + n
+		}
+	}
+	return 0, errors.New("dns-over-https: truncated name")
+}
+
+// dohDialer returns a dial function that resolves host names with r and
+// connects to the first reachable address. Hosts that fail to resolve are
+// dialed with the system resolver instead.
+func dohDialer(
+	r *dohResolver,
+	logger *log.Logger,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	resolver := r.endpoint.Host
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := r.lookup(ctx, host)
+		if err != nil {
+			dohFailuresCounter.Inc("resolver", resolver, "host", host)
+			logger.Warn(
+				"dns-over-https lookup failed, using system resolver",
+				"resolver",
+				resolver,
+				"host",
+				host,
+				"error",
+				err,
+			)
+			return dialer.DialContext(ctx, network, addr)
+		}
+		var errs []error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
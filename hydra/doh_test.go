@@ -0,0 +1,174 @@
+package hydra
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// dnsReply returns a reply to query answering with a CNAME to the queried
+// name, as resolvers do for aliased hosts, and then addrs with ttl.
+func dnsReply(query []byte, rcode byte, ttl uint32, addrs ...net.IP) []byte {
+	reply := append([]byte(nil), query...)
+	reply[2] |= 0x80 // Response
+	reply[3] = rcode
+	binary.BigEndian.PutUint16(reply[6:], uint16(len(addrs)+1))
+
+	record := func(rtype uint16, data []byte) {
+		reply = append(reply, 0xc0, 12) // Pointer to the question name
+		reply = binary.BigEndian.AppendUint16(reply, rtype)
+		reply = binary.BigEndian.AppendUint16(reply, 1)
+		reply = binary.BigEndian.AppendUint32(reply, ttl)
+		reply = binary.BigEndian.AppendUint16(reply, uint16(len(data)))
+		reply = append(reply, data...)
+	}
+	record(5, []byte{0xc0, 12}) // CNAME
+	for _, ip := range addrs {
+		if v4 := ip.To4(); v4 != nil {
+			record(dnsTypeA, v4)
+		} else {
+			record(dnsTypeAAAA, ip.To16())
+		}
+	}
+	return reply
+}
+
+func TestDecodeDNSAnswer(t *testing.T) {
+	query, err := encodeDNSQuery("api.example.com", dnsTypeA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reply := dnsReply(query, 0, 60, net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"))
+
+	addrs, ttl, err := decodeDNSAnswer(reply, dnsTypeA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(addrs) != 2 || !addrs[0].Equal(net.ParseIP("192.0.2.1")) || ttl != time.Minute {
+		t.Errorf("unexpected answer %v with TTL %v", addrs, ttl)
+	}
+
+	if _, _, err := decodeDNSAnswer(dnsReply(query, 3, 60), dnsTypeA); err == nil {
+		t.Error("expected error for NXDOMAIN")
+	}
+	if _, _, err := decodeDNSAnswer(reply[:len(reply)-2], dnsTypeA); err == nil {
+		t.Error("expected error for a truncated reply")
+	}
+	if _, err := encodeDNSQuery("bad..host", dnsTypeA); err == nil {
+		t.Error("expected error for an empty label")
+	}
+}
+
+// newTestDoHServer answers A queries with ipv4 and AAAA queries with nothing,
+// counting the queries it receives.
+func newTestDoHServer(t *testing.T, ipv4 net.IP, queries *atomic.Int32) *dohResolver {
+	t.Helper()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		query, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/dns-message" || len(query) < 16 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		if binary.BigEndian.Uint16(query[len(query)-4:]) == dnsTypeA {
+			_, _ = w.Write(dnsReply(query, 0, 300, ipv4))
+			return
+		}
+		_, _ = w.Write(dnsReply(query, 0, 300))
+	}))
+	t.Cleanup(ts.Close)
+
+	endpoint, err := url.Parse(ts.URL + "/dns-query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := newDoHResolver(endpoint)
+	r.client = ts.Client()
+	return r
+}
+
+func TestDoHResolver_Lookup(t *testing.T) {
+	var queries atomic.Int32
+	r := newTestDoHServer(t, net.ParseIP("192.0.2.7"), &queries)
+
+	for range 2 {
+		addrs, err := r.lookup(context.Background(), "api.example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("192.0.2.7")) {
+			t.Errorf("unexpected addresses %v", addrs)
+		}
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("expected one A and one AAAA query before caching, got %d", n)
+	}
+}
+
+func TestDoHDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	t.Run("resolved", func(t *testing.T) {
+		var queries atomic.Int32
+		r := newTestDoHServer(t, net.ParseIP("127.0.0.1"), &queries)
+		dial := dohDialer(r, log.New(io.Discard))
+
+		// The name only exists at the DoH resolver
+		conn, err := dial(context.Background(), "tcp", "upstream.invalid:"+port)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = conn.Close()
+	})
+
+	t.Run("falls back to the system resolver", func(t *testing.T) {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+		endpoint, _ := url.Parse(ts.URL)
+		r := newDoHResolver(endpoint)
+		r.client = ts.Client()
+		dial := dohDialer(r, log.New(io.Discard))
+
+		conn, err := dial(context.Background(), "tcp", "localhost:"+port)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = conn.Close()
+		got := metrics.value(
+			"hydrallm_dns_resolution_failures_total",
+			"resolver",
+			endpoint.Host,
+			"host",
+			"localhost",
+		)
+		if got != 1 {
+			t.Errorf("expected 1 resolution failure, got %v", got)
+		}
+	})
+}
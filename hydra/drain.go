@@ -0,0 +1,278 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	drainCheckInterval = time.Second     // How often the drain cutoff is enforced
+	drainLogInterval   = 5 * time.Second // How often draining progress is reported
+)
+
+// activeRequests tracks in-flight client requests across all listeners.
+var activeRequests = newRequestTracker()
+
+// listenerDrains holds the servers of each listener so the admin API can
+// drain listeners individually.
+var listenerDrains = newListenerDrainer()
+
+var errListenerNotFound = errors.New("listener not found")
+
+var (
+	drainingRequestsGauge = metrics.Gauge(
+		"hydrallm_draining_requests",
+		"Requests still in flight during graceful shutdown.",
+	)
+	drainingOldestGauge = metrics.Gauge(
+		"hydrallm_draining_oldest_seconds",
+		"Age of the oldest request still in flight during graceful shutdown.",
+	)
+	drainCutoffCounter = metrics.Counter(
+		"hydrallm_drain_cutoff_total",
+		"Requests cancelled during shutdown for exceeding the drain request timeout.",
+	)
+)
+
+type requestTracker struct {
+	mu       sync.Mutex
+	nextID   uint64
+	requests map[uint64]*trackedRequest
+}
+
+type trackedRequest struct {
+	listener string
+	start    time.Time
+	cancel   context.CancelFunc
+}
+
+func newRequestTracker() *requestTracker {
+	return &requestTracker{requests: make(map[uint64]*trackedRequest)}
+}
+
+// wrap registers every request served by h for the duration of the handler.
+// Tracked requests can be cancelled individually while draining.
+func (t *requestTracker) wrap(listener string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		t.mu.Lock()
+		id := t.nextID
+		t.nextID++
+		t.requests[id] = &trackedRequest{listener: listener, start: time.Now(), cancel: cancel}
+		t.mu.Unlock()
+
+		defer func() {
+			t.mu.Lock()
+			delete(t.requests, id)
+			t.mu.Unlock()
+		}()
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ages returns the ages of all in-flight requests, oldest first.
+func (t *requestTracker) ages(now time.Time) []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ages := make([]time.Duration, 0, len(t.requests))
+	for _, r := range t.requests {
+		ages = append(ages, now.Sub(r.start))
+	}
+	slices.SortFunc(ages, func(a, b time.Duration) int { return int(b - a) })
+	return ages
+}
+
+// count returns the number of in-flight requests of a listener.
+func (t *requestTracker) count(listener string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, r := range t.requests {
+		if r.listener == listener {
+			n++
+		}
+	}
+	return n
+}
+
+// cutoff cancels requests older than maxAge and returns how many were cancelled.
+func (t *requestTracker) cutoff(now time.Time, maxAge time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for id, r := range t.requests {
+		if now.Sub(r.start) <= maxAge {
+			continue
+		}
+		r.cancel()
+		delete(t.requests, id)
+		n++
+	}
+	return n
+}
+
+// drain reports the requests still in flight every logInterval until ctx is
+// done or nothing is left. When maxAge is positive, requests older than maxAge
+// are cancelled so one long stream cannot hold up shutdown until the global
+// timeout. The cutoff is checked every checkInterval.
+func (t *requestTracker) drain(
+	ctx context.Context,
+	checkInterval, logInterval, maxAge time.Duration,
+	logger *log.Logger,
+) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	var lastLog time.Time
+	for {
+		now := time.Now()
+		if maxAge > 0 {
+			if n := t.cutoff(now, maxAge); n > 0 {
+				drainCutoffCounter.Add(float64(n))
+				logger.Warn("cancelled draining requests", "count", n, "max_age", maxAge)
+			}
+		}
+
+		ages := t.ages(now)
+		drainingRequestsGauge.Set(float64(len(ages)))
+		if len(ages) == 0 {
+			drainingOldestGauge.Set(0)
+			return
+		}
+		drainingOldestGauge.Set(ages[0].Seconds())
+
+		if now.Sub(lastLog) >= logInterval {
+			lastLog = now
+			rounded := make([]time.Duration, len(ages))
+			for i, age := range ages {
+				rounded[i] = age.Round(time.Second)
+			}
+			logger.Info("draining requests", "count", len(ages), "ages", rounded)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListenerDrainStatus is the drain state of a listener.
+type ListenerDrainStatus struct {
+	Draining bool       `json:"draining"`
+	Since    *time.Time `json:"since,omitempty"`
+	InFlight int        `json:"in_flight"`
+}
+
+type listenerDrainer struct {
+	mu       sync.Mutex
+	servers  map[string][]*http.Server // Keyed by listener name
+	draining map[string]time.Time      // Start of each listener's drain
+}
+
+func newListenerDrainer() *listenerDrainer {
+	return &listenerDrainer{
+		servers:  make(map[string][]*http.Server),
+		draining: make(map[string]time.Time),
+	}
+}
+
+// track replaces the drainable servers with servers, keyed by listener name.
+func (d *listenerDrainer) track(servers map[string][]*http.Server) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.draining = make(map[string]time.Time)
+}
+
+// drain stops the servers of a listener from accepting connections while
+// their in-flight requests, streams included, run to completion. It returns
+// false when the listener is already draining.
+func (d *listenerDrainer) drain(listener string, logger *log.Logger) (bool, error) {
+	d.mu.Lock()
+	servers, ok := d.servers[listener]
+	if !ok {
+		d.mu.Unlock()
+		return false, errListenerNotFound
+	}
+	if _, ok := d.draining[listener]; ok {
+		d.mu.Unlock()
+		return false, nil
+	}
+	d.draining[listener] = time.Now()
+	d.mu.Unlock()
+
+	logger.Info(
+		"draining listener",
+		"listener",
+		listener,
+		"in_flight",
+		activeRequests.count(listener),
+	)
+	go func() {
+		var wg sync.WaitGroup
+		for _, s := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Bounded by server.shutdown_timeout once the process shuts down
+				if err := s.Shutdown(context.Background()); err != nil {
+					logger.Error("listener drain error", "address", s.Addr, "error", err)
+				}
+			}()
+		}
+		wg.Wait()
+		logger.Info("listener drained", "listener", listener)
+	}()
+	return true, nil
+}
+
+// status returns the drain state of every listener.
+func (d *listenerDrainer) status() map[string]ListenerDrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := make(map[string]ListenerDrainStatus, len(d.servers))
+	for name := range d.servers {
+		s := ListenerDrainStatus{InFlight: activeRequests.count(name)}
+		if since, ok := d.draining[name]; ok {
+			s.Draining = true
+			s.Since = &since
+		}
+		status[name] = s
+	}
+	return status
+}
+
+// drainingListeners returns the names of the draining listeners, sorted.
+func (d *listenerDrainer) drainingListeners() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.draining))
+	for name := range d.draining {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// listeners returns the names of all drainable listeners, sorted.
+func (d *listenerDrainer) listeners() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.servers))
+	for name := range d.servers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,170 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestRequestTracker_Wrap(t *testing.T) {
+	tracker := newRequestTracker()
+
+	var during int
+	h := tracker.wrap("main", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		during = len(tracker.ages(time.Now()))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if during != 1 {
+		t.Errorf("expected 1 tracked request while serving, got %d", during)
+	}
+	if n := len(tracker.ages(time.Now())); n != 0 {
+		t.Errorf("expected no tracked requests after serving, got %d", n)
+	}
+}
+
+func TestRequestTracker_DrainCutoff(t *testing.T) {
+	tracker := newRequestTracker()
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	h := tracker.wrap("main", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		tracker.drain(ctx, 5*time.Millisecond, time.Second, 20*time.Millisecond, log.New(io.Discard))
+		close(done)
+	}()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected request to be cancelled by the drain cutoff")
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected drain to return once no requests are left")
+	}
+
+	if got := metrics.value("hydrallm_draining_requests"); got != 0 {
+		t.Errorf("expected draining gauge 0, got %v", got)
+	}
+	if got := metrics.value("hydrallm_drain_cutoff_total"); got < 1 {
+		t.Errorf("expected cutoff counter to be incremented, got %v", got)
+	}
+}
+
+func TestRequestTracker_DrainWithoutCutoff(t *testing.T) {
+	tracker := newRequestTracker()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := tracker.wrap("main", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	}))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	// Without a cutoff, drain only returns when the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	tracker.drain(ctx, 5*time.Millisecond, time.Second, 0, log.New(io.Discard))
+
+	if n := len(tracker.ages(time.Now())); n != 1 {
+		t.Errorf("expected request to keep running, got %d tracked", n)
+	}
+	close(release)
+}
+
+func TestListenerDrainer_Drain(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{
+		Handler: activeRequests.wrap("drain-test", http.HandlerFunc(
+			func(w http.ResponseWriter, _ *http.Request) {
+				close(started)
+				<-release
+				_, _ = w.Write([]byte("done"))
+			},
+		)),
+		ReadHeaderTimeout: time.Second,
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ln) }()
+
+	drainer := newListenerDrainer()
+	drainer.track(map[string][]*http.Server{"drain-test": {server}})
+
+	answered := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			answered <- err.Error()
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		answered <- string(body)
+	}()
+	<-started
+
+	if ok, err := drainer.drain("drain-test", log.New(io.Discard)); !ok || err != nil {
+		t.Fatalf("expected drain to start, got %v, %v", ok, err)
+	}
+	if ok, _ := drainer.drain("drain-test", log.New(io.Discard)); ok {
+		t.Error("expected second drain to be a no-op")
+	}
+	_, err = drainer.drain("missing", log.New(io.Discard))
+	if !errors.Is(err, errListenerNotFound) {
+		t.Errorf("expected errListenerNotFound, got %v", err)
+	}
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Fatalf("expected ErrServerClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected server to stop accepting connections")
+	}
+	if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		_ = conn.Close()
+		t.Error("expected new connections to be refused")
+	}
+
+	status := drainer.status()["drain-test"]
+	if !status.Draining || status.Since == nil || status.InFlight != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	close(release)
+	select {
+	case body := <-answered:
+		if body != "done" {
+			t.Errorf("expected in-flight request to complete, got %q", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected in-flight request to complete")
+	}
+}
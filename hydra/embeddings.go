@@ -0,0 +1,141 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var embeddingBatchesCounter = metrics.Counter(
+	"hydrallm_embedding_batches_total",
+	"Upstream requests of embeddings requests split by embedding_batch_size, by provider.",
+)
+
+// isEmbeddingRequest reports whether req creates embeddings.
+func isEmbeddingRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost &&
+		strings.HasSuffix(strings.TrimRight(req.URL.Path, "/"), "/embeddings")
+}
+
+// embeddingChain returns the chain of an embeddings request: the route of its
+// requested model, or else the listener's embedding models.
+func (s *transportState) embeddingChain(body []byte) []Model {
+	if chain, ok := s.routes[requestedModel(body)]; ok {
+		return chain
+	}
+	return s.embeddings
+}
+
+// embeddingBatches splits the input array of an embeddings request body into
+// bodies of at most size inputs each. It returns nil when the body needs no
+// split, including an input that is a single array of tokens.
+func embeddingBatches(body []byte, size int) ([][]byte, error) {
+	input := gjson.GetBytes(body, "input")
+	if size <= 0 || !input.IsArray() {
+		return nil, nil
+	}
+	items := input.Array()
+	if len(items) <= size || items[0].Type == gjson.Number {
+		return nil, nil
+	}
+
+	batches := make([][]byte, 0, (len(items)+size-1)/size)
+	for start := 0; start < len(items); start += size {
+		raw := make([]string, 0, size)
+		for _, item := range items[start:min(start+size, len(items))] {
+			raw = append(raw, item.Raw)
+		}
+		batch, err := sjson.SetRawBytes(body, "input", []byte("["+strings.Join(raw, ",")+"]"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to split embeddings input: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// mergeEmbeddings combines the response bodies of the batches of a split
+// request, each of size inputs but the last. Embedding indexes are offset by
+// the inputs of the batches before, and token usage is summed.
+func mergeEmbeddings(bodies [][]byte, size int) ([]byte, error) {
+	var data []string
+	var promptTokens, totalTokens int64
+	for i, body := range bodies {
+		if !gjson.ValidBytes(body) {
+			return nil, fmt.Errorf("invalid embeddings response of batch %d", i+1)
+		}
+		for _, item := range gjson.GetBytes(body, "data").Array() {
+			raw, err := sjson.Set(item.Raw, "index", item.Get("index").Int()+int64(i*size))
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge embeddings: %w", err)
+			}
+			data = append(data, raw)
+		}
+		promptTokens += gjson.GetBytes(body, "usage.prompt_tokens").Int()
+		totalTokens += gjson.GetBytes(body, "usage.total_tokens").Int()
+	}
+
+	merged, err := sjson.SetRawBytes(bodies[0], "data", []byte("["+strings.Join(data, ",")+"]"))
+	if err == nil && gjson.GetBytes(merged, "usage").Exists() {
+		merged, err = sjson.SetBytes(merged, "usage.prompt_tokens", promptTokens)
+		if err == nil {
+			merged, err = sjson.SetBytes(merged, "usage.total_tokens", totalTokens)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge embeddings: %w", err)
+	}
+	return merged, nil
+}
+
+// tryEmbeddingBatches sends the batches of a split embeddings request to model
+// one after another and merges their results. The first batch that fails
+// fails the attempt with its response or error.
+func (t *RetryTransport) tryEmbeddingBatches(
+	ctx context.Context,
+	originalReq *http.Request,
+	batches [][]byte,
+	size int,
+	model Model,
+	debugEnabled bool,
+	state *transportState,
+) (*http.Response, error) {
+	// Encoded responses could not be merged
+	req := originalReq.Clone(ctx)
+	req.Header.Del("Accept-Encoding")
+
+	bodies := make([][]byte, 0, len(batches))
+	var last *http.Response
+	for _, batch := range batches {
+		embeddingBatchesCounter.Inc("provider", model.Provider)
+		resp, err := t.tryModel(ctx, req, batch, model, false, debugEnabled, state)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 300 {
+			return resp, nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embeddings response: %w", err)
+		}
+		bodies = append(bodies, body)
+		last = resp
+	}
+
+	merged, err := mergeEmbeddings(bodies, size)
+	if err != nil {
+		return nil, err
+	}
+	last.Body = io.NopCloser(bytes.NewReader(merged))
+	last.ContentLength = int64(len(merged))
+	last.Header.Del("Content-Length")
+	return last, nil
+}
@@ -0,0 +1,157 @@
+package hydra
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestEmbeddingBatches(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"input":["a","b","c","d","e"]}`, []string{`["a","b"]`, `["c","d"]`, `["e"]`}},
+		{`{"input":[[1,2],[3],[4]]}`, []string{`[[1,2],[3]]`, `[[4]]`}},
+		{`{"input":["a","b"]}`, nil},
+		{`{"input":"a"}`, nil},
+		{`{"input":[1,2,3,4,5]}`, nil}, // One input given as tokens
+	}
+	for _, tt := range tests {
+		batches, err := embeddingBatches([]byte(tt.body), 2)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.body, err)
+		}
+		if len(batches) != len(tt.want) {
+			t.Fatalf("%s: expected %d batches, got %d", tt.body, len(tt.want), len(batches))
+		}
+		for i, batch := range batches {
+			if got := gjson.GetBytes(batch, "input").Raw; got != tt.want[i] {
+				t.Errorf("%s: batch %d: expected %s, got %s", tt.body, i, tt.want[i], got)
+			}
+		}
+	}
+}
+
+func TestMergeEmbeddings(t *testing.T) {
+	merged, err := mergeEmbeddings([][]byte{
+		[]byte(`{"object":"list","data":[{"index":0,"embedding":[0.1]},{"index":1,"embedding":[0.2]}],` +
+			`"model":"m","usage":{"prompt_tokens":4,"total_tokens":4}}`),
+		[]byte(`{"object":"list","data":[{"index":0,"embedding":[0.3]}],` +
+			`"model":"m","usage":{"prompt_tokens":2,"total_tokens":2}}`),
+	}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(merged, "data.#.index").Raw; got != "[0,1,2]" {
+		t.Errorf("expected offset indexes, got %s", got)
+	}
+	if got := gjson.GetBytes(merged, "data.2.embedding").Raw; got != "[0.3]" {
+		t.Errorf("expected the last batch's embedding last, got %s", got)
+	}
+	if gjson.GetBytes(merged, "usage.prompt_tokens").Int() != 6 ||
+		gjson.GetBytes(merged, "usage.total_tokens").Int() != 6 {
+		t.Errorf("expected summed usage, got %s", gjson.GetBytes(merged, "usage").Raw)
+	}
+
+	if _, err := mergeEmbeddings([][]byte{[]byte(`{`)}, 2); err == nil {
+		t.Error("expected error for an invalid batch response")
+	}
+}
+
+func TestTransport_RoundTrip_Embeddings(t *testing.T) {
+	var models []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		models = append(models, gjson.GetBytes(body, "model").String())
+		if !strings.HasSuffix(r.URL.Path, "/embeddings") {
+			_, _ = w.Write([]byte(`{"choices":[]}`))
+			return
+		}
+		inputs := gjson.GetBytes(body, "input").Array()
+		if len(inputs) > 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"too many inputs"}}`))
+			return
+		}
+		data := make([]map[string]any, len(inputs))
+		for i, input := range inputs {
+			data[i] = map[string]any{"index": i, "embedding": []string{input.String()}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data":  data,
+			"usage": map[string]int{"prompt_tokens": len(inputs), "total_tokens": len(inputs)},
+		})
+	}))
+	defer upstream.Close()
+
+	l := &Listener{
+		Name:       "embeddings",
+		ConfigType: "openai",
+		ResolvedModels: []Model{{
+			ID:       "chat",
+			Provider: "p",
+			Model:    "gpt-4o",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  5 * time.Second,
+		}},
+		ResolvedEmbeddings: []Model{{
+			ID:       "embed",
+			Provider: "p",
+			Model:    "text-embedding-3-small",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  5 * time.Second,
+		}},
+	}
+	providers := map[string]Provider{
+		"p": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL), EmbeddingBatchSize: 2},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: 5 * time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(
+		http.MethodPost,
+		"/v1/embeddings",
+		strings.NewReader(`{"model":"embed","input":["a","b","c","d","e"]}`),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if got := gjson.GetBytes(body, "data.#.embedding.0").Raw; got != `["a","b","c","d","e"]` {
+		t.Errorf("expected the embeddings of every input in order, got %s", got)
+	}
+	if got := gjson.GetBytes(body, "data.#.index").Raw; got != "[0,1,2,3,4]" {
+		t.Errorf("expected merged indexes, got %s", got)
+	}
+	if len(models) != 3 || models[0] != "text-embedding-3-small" {
+		t.Errorf("expected three batches to the embedding model, got %v", models)
+	}
+
+	// Other requests keep using the listener's models
+	resp, err = transport.RoundTrip(httptest.NewRequest(
+		http.MethodPost,
+		"/v1/chat/completions",
+		strings.NewReader(`{"model":"chat","messages":[]}`),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if last := models[len(models)-1]; last != "gpt-4o" {
+		t.Errorf("expected a chat request to use the chat model, got %q", last)
+	}
+}
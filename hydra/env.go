@@ -0,0 +1,155 @@
+package hydra
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// expandEnv interpolates ${VAR} and ${VAR:-default} references in s. A
+// default applies when the variable is unset or empty, and $${ stands for a
+// literal ${. References to unset variables without a default are kept as
+// written and returned in unset.
+func expandEnv(s string) (expanded string, unset []string) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			break
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		b.WriteString(s[:i])
+		switch value, ok := os.LookupEnv(name); {
+		case !isEnvName(name):
+			b.WriteString(s[i : i+end+1])
+		case hasDefault && value == "":
+			b.WriteString(def)
+		case ok:
+			b.WriteString(value)
+		default:
+			b.WriteString(s[i : i+end+1])
+			unset = append(unset, name)
+		}
+		s = s[i+end+1:]
+	}
+	b.WriteString(s)
+	return b.String(), unset
+}
+
+// isEnvName reports whether s is a valid environment variable name.
+func isEnvName(s string) bool {
+	for i, c := range s {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') &&
+			(i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// expandConfigEnv interpolates environment variables in every string of the
+// config, including list items and map values, as read from the file. With
+// strict set, a reference to an unset variable is an error; otherwise it is
+// kept as written, with a warning. The strings as written are kept for /config.
+func expandConfigEnv(cfg *Config, strict bool, positions *configPositions) error {
+	var errs []error
+	report := func(path, written, expanded string, unset []string) {
+		if expanded != written && expanded != "" {
+			if cfg.envWritten == nil {
+				cfg.envWritten = make(map[string]string)
+			}
+			cfg.envWritten[expanded] = written
+		}
+		for _, name := range unset {
+			err := fmt.Errorf("environment variable %s is not set", name)
+			if !strict {
+				logger.Warn("config references an unset environment variable",
+					"key", path, "variable", name)
+				continue
+			}
+			ce := &ConfigError{Path: path, Err: err}
+			if positions != nil {
+				ce.File = positions.file
+				if key, line := positions.find(strings.Split(path, ".")); line > 0 {
+					ce.File, ce.Line = positions.fileOf(key), line
+				}
+			}
+			errs = append(errs, ce)
+		}
+	}
+	expandEnvValue(reflect.ValueOf(cfg).Elem(), "", report)
+	return errors.Join(errs...)
+}
+
+// expandEnvValue expands the strings in v, which must be settable, calling
+// report with the config path, written and expanded forms, and unset variables
+// of each string referencing environment variables.
+func expandEnvValue(
+	v reflect.Value,
+	path string,
+	report func(path, written, expanded string, unset []string),
+) {
+	join := func(key string) string {
+		return strings.TrimPrefix(path+"."+key, ".")
+	}
+	switch v.Kind() {
+	case reflect.String:
+		written := v.String()
+		expanded, unset := expandEnv(written)
+		v.SetString(expanded)
+		if expanded != written || len(unset) > 0 {
+			report(path, written, expanded, unset)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+			if !f.IsExported() || name == "-" || name == "" {
+				continue
+			}
+			expandEnvValue(v.Field(i), join(name), report)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			expandEnvValue(v.Index(i), join(strconv.Itoa(i)), report)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values are not addressable, so each is expanded in a copy
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			expandEnvValue(elem, join(fmt.Sprint(iter.Key().Interface())), report)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Pointer {
+			expandEnvValue(v.Elem(), path, report)
+			return
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		expandEnvValue(elem, path, report)
+		v.Set(elem)
+	}
+}
@@ -0,0 +1,122 @@
+package hydra
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("HYDRA_TEST_HOST", "proxy.internal")
+	t.Setenv("HYDRA_TEST_EMPTY", "")
+
+	tests := []struct {
+		in    string
+		want  string
+		unset []string
+	}{
+		{"no references", "no references", nil},
+		{"http://${HYDRA_TEST_HOST}:8080", "http://proxy.internal:8080", nil},
+		{"${HYDRA_TEST_MISSING:-eu-west-1}", "eu-west-1", nil},
+		{"${HYDRA_TEST_EMPTY:-fallback}", "fallback", nil},
+		{"[${HYDRA_TEST_EMPTY}]", "[]", nil},
+		{"${HYDRA_TEST_HOST:-unused}", "proxy.internal", nil},
+		{"a-${HYDRA_TEST_MISSING}-b", "a-${HYDRA_TEST_MISSING}-b", []string{"HYDRA_TEST_MISSING"}},
+		{"$${HYDRA_TEST_HOST}", "${HYDRA_TEST_HOST}", nil},
+		{"${not a name}", "${not a name}", nil},
+		{"${HYDRA_TEST_HOST", "${HYDRA_TEST_HOST", nil},
+		{"$HYDRA_TEST_HOST", "$HYDRA_TEST_HOST", nil},
+	}
+	for _, tt := range tests {
+		got, unset := expandEnv(tt.in)
+		if got != tt.want || !slices.Equal(unset, tt.unset) {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q, %v", tt.in, got, unset, tt.want, tt.unset)
+		}
+	}
+}
+
+func TestExpandConfigEnv(t *testing.T) {
+	t.Setenv("HYDRA_TEST_REGION", "eu-central-1")
+	cfg := &Config{
+		Providers: map[string]Provider{
+			"bedrock": {AWSRegion: "${HYDRA_TEST_REGION}", URL: "https://${HYDRA_TEST_MISSING}"},
+		},
+		Models: map[string]Model{
+			"claude": {Model: "${HYDRA_TEST_MODEL:-claude-sonnet}"},
+		},
+		Listeners: []Listener{{
+			Host:   "${HYDRA_TEST_BIND:-127.0.0.1}",
+			Models: []string{"${HYDRA_TEST_REGION}"},
+		}},
+		Routes: []RoutingRule{{
+			Set: []BodyOverride{{Path: "metadata.region", Value: "${HYDRA_TEST_REGION}"}},
+		}},
+	}
+	if err := expandConfigEnv(cfg, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Providers["bedrock"].AWSRegion != "eu-central-1" ||
+		cfg.Models["claude"].Model != "claude-sonnet" ||
+		cfg.Listeners[0].Host != "127.0.0.1" ||
+		cfg.Listeners[0].Models[0] != "eu-central-1" ||
+		cfg.Routes[0].Set[0].Value != "eu-central-1" {
+		t.Errorf("expected every string expanded, got %+v", cfg)
+	}
+	if cfg.Providers["bedrock"].URL != "https://${HYDRA_TEST_MISSING}" {
+		t.Errorf("expected the unset reference kept, got %q", cfg.Providers["bedrock"].URL)
+	}
+
+	err := expandConfigEnv(cfg, true, nil)
+	if err == nil || !strings.Contains(err.Error(),
+		"providers.bedrock.url: environment variable HYDRA_TEST_MISSING is not set") {
+		t.Errorf("expected the unset variable rejected, got %v", err)
+	}
+}
+
+func TestLoadConfig_StrictEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := `strict_env = true
+
+[providers.openai]
+url = "https://api.openai.com/v1"
+api_key = "${HYDRA_TEST_OPENAI_KEY}"
+
+[models.gpt]
+provider = "openai"
+model = "gpt-5"
+type = "openai"
+
+[[listeners]]
+name = "main"
+port = 8080
+models = ["gpt"]
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig()
+	want := path + ":5: providers.openai.api_key: " +
+		"environment variable HYDRA_TEST_OPENAI_KEY is not set"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+
+	t.Setenv("HYDRA_TEST_OPENAI_KEY", "sk-test")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Providers["openai"].APIKey != "sk-test" {
+		t.Errorf("expected the key from the environment, got %q", cfg.Providers["openai"].APIKey)
+	}
+}
@@ -0,0 +1,123 @@
+package hydra
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// failoverEventCapacity is the number of recent failover events kept.
+const failoverEventCapacity = 1000
+
+// Failover event kinds.
+const (
+	EventFallback  = "fallback"  // A request moved on from a failed or skipped model
+	EventSaturated = "saturated" // A provider asked clients to back off
+	EventEvicted   = "evicted"   // A provider failed its health checks
+	EventRecovered = "recovered" // An evicted provider passed a health check
+)
+
+// failoverEvents holds the recent failover events of all listeners.
+var failoverEvents = newEventLog(failoverEventCapacity)
+
+// FailoverEvent is a provider or model being skipped, as served on the admin
+// events endpoint.
+type FailoverEvent struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Listener  string    `json:"listener,omitempty"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model,omitempty"`
+	Cause     string    `json:"cause,omitempty"`
+	SkippedMS int64     `json:"skipped_ms,omitempty"` // How long the provider is or was skipped
+}
+
+// eventLog is a ring buffer of the most recent failover events.
+type eventLog struct {
+	mu     sync.Mutex
+	events []FailoverEvent
+	next   int // Index of the oldest event once full
+}
+
+func newEventLog(capacity int) *eventLog {
+	return &eventLog{events: make([]FailoverEvent, 0, capacity)}
+}
+
+// add records an event, dropping the oldest once the log is full.
+func (l *eventLog) add(e FailoverEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+}
+
+// snapshot returns the events, oldest first.
+func (l *eventLog) snapshot() []FailoverEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]FailoverEvent, 0, len(l.events))
+	out = append(out, l.events[l.next:]...)
+	return append(out, l.events[:l.next]...)
+}
+
+// cause describes why an attempt failed: its error class, status, or error.
+func (f attemptFailure) cause() string {
+	switch {
+	case f.Class != "":
+		return f.Class
+	case f.Status != 0:
+		return "status " + strconv.Itoa(f.Status)
+	default:
+		return f.Error
+	}
+}
+
+// handleEvents serves the recent failover events, oldest first. The provider,
+// kind, and since query parameters filter them, and limit keeps the newest.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since: " + s})
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+	limit := 0
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit: " + s})
+			return
+		}
+		limit = n
+	}
+
+	events := []FailoverEvent{}
+	for _, e := range failoverEvents.snapshot() {
+		if provider := q.Get("provider"); provider != "" && e.Provider != provider {
+			continue
+		}
+		if kind := q.Get("kind"); kind != "" && e.Kind != kind {
+			continue
+		}
+		if e.Time.Before(since) {
+			continue
+		}
+		events = append(events, e)
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events})
+}
@@ -0,0 +1,138 @@
+package hydra
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestEventLog(t *testing.T) {
+	l := newEventLog(3)
+	for _, p := range []string{"a", "b", "c", "d", "e"} {
+		l.add(FailoverEvent{Kind: EventFallback, Provider: p})
+	}
+	var providers []string
+	for _, e := range l.snapshot() {
+		providers = append(providers, e.Provider)
+		if e.Time.IsZero() {
+			t.Error("expected events to be timestamped")
+		}
+	}
+	if !slices.Equal(providers, []string{"c", "d", "e"}) {
+		t.Errorf("expected the newest events oldest first, got %v", providers)
+	}
+}
+
+func TestAdminHandler_Events(t *testing.T) {
+	now := time.Now()
+	failoverEvents.add(FailoverEvent{
+		Time:     now.Add(-2 * time.Hour),
+		Kind:     EventEvicted,
+		Provider: "events-admin",
+	})
+	failoverEvents.add(FailoverEvent{
+		Time:      now,
+		Kind:      EventSaturated,
+		Provider:  "events-admin",
+		SkippedMS: 30000,
+	})
+	failoverEvents.add(FailoverEvent{Time: now, Kind: EventFallback, Provider: "events-other"})
+
+	tests := []struct {
+		query    string
+		status   int
+		expected []string
+	}{
+		{"?provider=events-admin", http.StatusOK, []string{EventEvicted, EventSaturated}},
+		{"?provider=events-admin&since=1h", http.StatusOK, []string{EventSaturated}},
+		{"?provider=events-admin&limit=1", http.StatusOK, []string{EventSaturated}},
+		{"?provider=events-admin&kind=evicted", http.StatusOK, []string{EventEvicted}},
+		{"?since=soon", http.StatusBadRequest, nil},
+		{"?limit=-1", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/events"+tt.query, nil)
+		newAdminHandler(testAdminConfig).ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.query, tt.status, rec.Code)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Events []FailoverEvent `json:"events"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		var kinds []string
+		for _, e := range body.Events {
+			kinds = append(kinds, e.Kind)
+		}
+		if !slices.Equal(kinds, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.expected, kinds)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_FallbackEvent(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	model := func(id, provider string) Model {
+		return Model{
+			ID:       id,
+			Provider: provider,
+			Model:    "gpt-5",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	l := &Listener{
+		Name:       "events",
+		ConfigType: "openai",
+		ResolvedModels: []Model{
+			model("events-primary", "events-failing"),
+			model("events-backup", "events-healthy"),
+		},
+	}
+	providers := map[string]Provider{
+		"events-failing": {URL: failing.URL, ParsedURL: mustParseURL(failing.URL)},
+		"events-healthy": {URL: healthy.URL, ParsedURL: mustParseURL(healthy.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	var found []FailoverEvent
+	for _, e := range failoverEvents.snapshot() {
+		if e.Listener == "events" {
+			found = append(found, e)
+		}
+	}
+	if len(found) != 1 || found[0].Kind != EventFallback || found[0].Model != "events-primary" ||
+		found[0].Provider != "events-failing" || found[0].Cause == "" {
+		t.Errorf("expected one fallback event from the primary, got %+v", found)
+	}
+}
@@ -0,0 +1,92 @@
+package hydra
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Experiment variants. The control chain is the listener's models.
+const (
+	variantControl   = "control"
+	variantCandidate = "candidate"
+)
+
+var (
+	experimentRequestsCounter = metrics.Counter(
+		"hydrallm_experiment_requests_total",
+		"Requests in a listener experiment, by listener, variant, and outcome.",
+	)
+	experimentLatencyHistogram = metrics.Histogram(
+		"hydrallm_experiment_latency_seconds",
+		"Time until the response headers of requests in an experiment, by listener and variant.",
+		[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	)
+	experimentAttemptsHistogram = metrics.Histogram(
+		"hydrallm_experiment_attempts",
+		"Upstream attempts of requests in an experiment, by listener and variant.",
+		[]float64{1, 2, 3, 5, 8, 13},
+	)
+)
+
+// ExperimentConfig splits the requests served by a listener's models between
+// them (the control) and a candidate chain, to compare the two on real traffic.
+type ExperimentConfig struct {
+	Models  []string `mapstructure:"models"`  // Candidate chain model IDs
+	Percent int      `mapstructure:"percent"` // Share of requests for the candidate, 0-100
+}
+
+// experimentVariantContextKey holds the experiment variant of a request.
+type experimentVariantContextKey struct{}
+
+// experimentVariant returns the experiment variant serving a request, or
+// empty if it is not part of an experiment.
+func experimentVariant(ctx context.Context) string {
+	variant, _ := ctx.Value(experimentVariantContextKey{}).(string)
+	return variant
+}
+
+// experimentChain returns the chain of an experiment variant. An empty
+// variant draws one, sending percent of requests to the candidate.
+func (s *transportState) experimentChain(variant string) ([]Model, string) {
+	if variant == "" {
+		variant = drawVariant(s.listener.Experiment)
+	}
+	if variant == variantCandidate {
+		return s.experiment, variant
+	}
+	return s.models, variant
+}
+
+// drawVariant picks the variant of a request, sending percent of requests to
+// the candidate.
+func drawVariant(e ExperimentConfig) string {
+	if rand.IntN(100) < e.Percent {
+		return variantCandidate
+	}
+	return variantControl
+}
+
+// observeExperiment records the outcome of a request in an experiment.
+// Continuations are part of the request they continue and are not recorded.
+func observeExperiment(
+	ctx context.Context,
+	listener string,
+	resp *http.Response,
+	err error,
+	attempts int,
+	latency time.Duration,
+) {
+	variant := experimentVariant(ctx)
+	if variant == "" || ctx.Value(continuationContextKey{}) != nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil || resp.StatusCode >= 400 {
+		outcome = "error"
+	}
+	experimentRequestsCounter.Inc("listener", listener, "variant", variant, "outcome", outcome)
+	experimentLatencyHistogram.Observe(latency.Seconds(), "listener", listener, "variant", variant)
+	experimentAttemptsHistogram.Observe(float64(attempts), "listener", listener, "variant", variant)
+}
@@ -0,0 +1,126 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestChainFor_Experiment(t *testing.T) {
+	state := &transportState{
+		listener:   &Listener{Experiment: ExperimentConfig{Percent: 100}},
+		models:     []Model{{ID: "control"}},
+		routes:     map[string][]Model{"gpt-4o": {{ID: "routed"}}},
+		experiment: []Model{{ID: "candidate"}},
+	}
+
+	tests := []struct {
+		name     string
+		percent  int
+		body     string
+		variant  string
+		expected []string
+		expVar   string
+	}{
+		{"all to candidate", 100, `{}`, "", []string{"candidate"}, variantCandidate},
+		{"all to control", 0, `{}`, "", []string{"control"}, variantControl},
+		{"variant kept", 100, `{}`, variantControl, []string{"control"}, variantControl},
+		{"routes are not split", 100, `{"model":"gpt-4o"}`, "", []string{"routed"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.listener.Experiment.Percent = tt.percent
+			chain, variant := state.chainFor([]byte(tt.body), tt.variant)
+			if got := modelIDs(chain); !slices.Equal(got, tt.expected) || variant != tt.expVar {
+				t.Errorf("expected %v (%q), got %v (%q)", tt.expected, tt.expVar, got, variant)
+			}
+		})
+	}
+}
+
+func TestExperimentChain_Split(t *testing.T) {
+	state := &transportState{
+		listener:   &Listener{Experiment: ExperimentConfig{Percent: 25}},
+		models:     []Model{{ID: "control"}},
+		experiment: []Model{{ID: "candidate"}},
+	}
+
+	const n = 4000
+	candidates := 0
+	for range n {
+		if _, variant := state.experimentChain(""); variant == variantCandidate {
+			candidates++
+		}
+	}
+	if candidates < n/5 || candidates > n*3/10 {
+		t.Errorf("expected about 25%% of requests on the candidate, got %d of %d", candidates, n)
+	}
+}
+
+func TestTransport_RoundTrip_Experiment(t *testing.T) {
+	var served []string
+	server := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			served = append(served, name)
+			_, _ = w.Write([]byte(`{"usage":{"prompt_tokens":3,"completion_tokens":4}}`))
+		}))
+	}
+	control := server("control")
+	defer control.Close()
+	candidate := server("candidate")
+	defer candidate.Close()
+
+	model := func(id string) Model {
+		return Model{ID: id, Provider: id, Type: "openai", Attempts: 1, Timeout: time.Second}
+	}
+	listener := &Listener{
+		Name:               "experiment-main",
+		ResolvedModels:     []Model{model("ab-control")},
+		Experiment:         ExperimentConfig{Percent: 100},
+		ResolvedExperiment: []Model{model("ab-candidate")},
+	}
+	providers := map[string]Provider{
+		"ab-control":   {URL: control.URL, ParsedURL: mustParseURL(control.URL)},
+		"ab-candidate": {URL: candidate.URL, ParsedURL: mustParseURL(candidate.URL)},
+	}
+	transport := newListenerTransport(
+		listener,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	record := &accessRecord{}
+	ctx := context.WithValue(context.Background(), accessRecordContextKey{}, record)
+	req, _ := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"m"}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if !slices.Equal(served, []string{"candidate"}) {
+		t.Errorf("expected the candidate to serve the request, got %v", served)
+	}
+	if record.variant != variantCandidate {
+		t.Errorf("expected access record variant %q, got %q", variantCandidate, record.variant)
+	}
+	usage := modelUsage.snapshot().Experiments["experiment-main"][variantCandidate]
+	if usage.Requests != 1 || usage.TotalTokens != 7 {
+		t.Errorf("expected candidate usage to be recorded, got %+v", usage)
+	}
+}
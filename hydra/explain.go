@@ -0,0 +1,168 @@
+package hydra
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// explainMaskedHeaders are request headers whose values an explanation masks.
+var explainMaskedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+}
+
+// Explanation describes how a listener would serve a request, without
+// sending anything upstream.
+type Explanation struct {
+	Listener string
+	Rule     string   // Matching [[routes]] rule, if any
+	Rejected int      // Status the matching rule rejects the request with
+	Variant  string   // Experiment variant drawn for the request
+	Refused  []string // Tools no model of the chain may be sent
+	Attempts []ExplainedAttempt
+}
+
+// ExplainedAttempt is the upstream request made for one model of the chain.
+type ExplainedAttempt struct {
+	Model    string // Model ID
+	Provider string
+	Attempts int // Tries per cycle
+	Method   string
+	URL      string
+	Auth     string      // How credentials are added
+	Header   http.Header // Credentials masked
+	Body     []byte
+	Err      error // Why the request cannot be built
+}
+
+// Explain works out the models a request would try, in order, and the
+// upstream request made for each. Listener middleware is not applied, and
+// models are ordered as by a fresh process: with every model healthy and the
+// first round robin turn.
+func (t *RetryTransport) Explain(req *http.Request) (*Explanation, error) {
+	state := t.state.Load()
+	e := &Explanation{Listener: state.listener.Name}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		_ = req.Body.Close()
+	}
+
+	rule := state.listener.matchRule(req, body)
+	if rule != nil {
+		e.Rule = rule.Name
+		if rule.Reject.Status != 0 {
+			e.Rejected = rule.Reject.Status
+			return e, nil
+		}
+		var err error
+		if body, err = rule.apply(req, body); err != nil {
+			return nil, err
+		}
+	}
+
+	var chain []Model
+	if state.listener.Dispatch == dispatchPassthrough {
+		chain = state.passthroughChain(passthroughName(req, body))
+	} else if isEmbeddingRequest(req) && len(state.embeddings) > 0 {
+		chain = state.embeddingChain(body)
+	} else {
+		chain, e.Variant = state.chainFor(body, "")
+	}
+	if rule != nil && len(rule.chain) > 0 {
+		chain, e.Variant = rule.chain, ""
+	}
+	models := orderModels(state.listener.Strategy, chain, 0)
+	models, refused := toolPermittedModels(models, body)
+	if len(models) == 0 {
+		e.Refused = refused
+	}
+
+	isStreaming := isStreamingRequest(req, body)
+	for _, model := range models {
+		e.Attempts = append(e.Attempts, t.explainAttempt(req, body, model, isStreaming, state))
+	}
+	return e, nil
+}
+
+// explainAttempt builds the request of an attempt at model the way tryModel
+// does, describing its credentials instead of adding them.
+func (t *RetryTransport) explainAttempt(
+	req *http.Request,
+	body []byte,
+	model Model,
+	isStreaming bool,
+	state *transportState,
+) ExplainedAttempt {
+	a := ExplainedAttempt{Model: model.ID, Provider: model.Provider, Attempts: model.Attempts}
+	provider, ok := state.providers[model.Provider]
+	if !ok {
+		a.Err = fmt.Errorf("provider %q not found", model.Provider)
+		return a
+	}
+	newReq, newBody, err := t.attemptRequest(
+		req.Context(),
+		req,
+		body,
+		model,
+		provider,
+		isStreaming,
+		state,
+	)
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	setAPIVersion(newReq, model.Type, provider)
+	if model.Type == "anthropic" {
+		setAnthropicHeaders(newReq, model, provider)
+	}
+
+	a.Method, a.URL, a.Body = newReq.Method, newReq.URL.String(), newBody
+	a.Auth = explainAuth(model.Type, provider)
+	a.Header = newReq.Header
+	if newReq.Host != newReq.URL.Host {
+		a.Header.Set("Host", newReq.Host)
+	}
+	for _, name := range explainMaskedHeaders {
+		if a.Header.Get(name) != "" {
+			a.Header.Set(name, "xxxxx")
+		}
+	}
+	return a
+}
+
+// explainAuth describes the credentials setAuthHeaders adds for a model type.
+func explainAuth(modelType string, provider Provider) string {
+	var auth string
+	switch apiKey := provider.GetAPIKey(); {
+	case provider.Auth == authAmbient:
+		auth = "ambient cloud credentials"
+	case modelType == "bedrock":
+		auth = "AWS SigV4 signature"
+	case modelType == "gemini" && provider.GetGoogleCredentialsFile() != "":
+		auth = "Google OAuth token"
+	case apiKey == "-":
+		auth = "none, client credentials removed"
+	case apiKey == "":
+		auth = "client credentials forwarded"
+	case modelType == "anthropic":
+		auth = "api_key as x-api-key"
+	case modelType == "gemini":
+		auth = "api_key as x-goog-api-key"
+	default:
+		auth = "api_key as Authorization: Bearer"
+	}
+	if provider.Signing.Key != "" {
+		auth += ", HMAC signed"
+	}
+	return auth
+}
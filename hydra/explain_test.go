@@ -0,0 +1,92 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestRetryTransport_Explain(t *testing.T) {
+	providers := map[string]Provider{
+		"openai": {
+			URL:        "https://api.openai.com",
+			ParsedURL:  mustParseURL("https://api.openai.com"),
+			APIKey:     "sk-secret",
+			HostHeader: "llm.internal",
+		},
+		"anthropic": {
+			URL:       "https://api.anthropic.com",
+			ParsedURL: mustParseURL("https://api.anthropic.com"),
+			APIKey:    "-",
+		},
+	}
+	l := &Listener{
+		Name:       "main",
+		ConfigType: "openai",
+		Strategy:   strategyPriority,
+		ResolvedModels: []Model{
+			{
+				ID:       "gpt",
+				Provider: "openai",
+				Model:    "gpt-4o",
+				Type:     "openai",
+				Attempts: 2,
+				Timeout:  time.Second,
+				Params:   []ModelParam{{Path: "temperature", Value: 0.2, Mode: paramModeForce}},
+			},
+			{
+				ID:       "claude",
+				Provider: "anthropic",
+				Model:    "claude-sonnet",
+				Type:     "anthropic",
+				Attempts: 1,
+				Timeout:  time.Second,
+			},
+		},
+	}
+	transport := newListenerTransport(l, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://localhost/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"alias","messages":[{"role":"user","content":"hi"}]}`)),
+	)
+	req.Header.Set("Authorization", "Bearer client-key")
+	e, err := transport.Explain(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(e.Attempts) != 2 {
+		t.Fatalf("expected two attempts, got %+v", e.Attempts)
+	}
+
+	gpt := e.Attempts[0]
+	if gpt.Model != "gpt" || gpt.Attempts != 2 ||
+		gpt.URL != "https://api.openai.com/v1/chat/completions" {
+		t.Errorf("unexpected first attempt: %+v", gpt)
+	}
+	if gjson.GetBytes(gpt.Body, "model").String() != "gpt-4o" ||
+		gjson.GetBytes(gpt.Body, "temperature").Float() != 0.2 {
+		t.Errorf("unexpected rewritten body %s", gpt.Body)
+	}
+	if gpt.Auth != "api_key as Authorization: Bearer" ||
+		gpt.Header.Get("Authorization") != "xxxxx" || gpt.Header.Get("Host") != "llm.internal" {
+		t.Errorf("unexpected auth %q and headers %v", gpt.Auth, gpt.Header)
+	}
+
+	// The anthropic model gets the request translated
+	claude := e.Attempts[1]
+	if claude.URL != "https://api.anthropic.com/v1/messages" ||
+		gjson.GetBytes(claude.Body, "model").String() != "claude-sonnet" ||
+		claude.Header.Get("anthropic-version") != defaultAnthropicVersion ||
+		claude.Auth != "none, client credentials removed" {
+		t.Errorf("unexpected second attempt: %+v %s", claude, claude.Body)
+	}
+}
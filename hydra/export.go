@@ -0,0 +1,131 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Usage export formats.
+const (
+	UsageFormatCSV     = "csv"
+	UsageFormatParquet = "parquet"
+)
+
+// usageColumns are the columns of exported usage, named as in the usage log.
+var usageColumns = []string{
+	"time",
+	"request_id",
+	"listener",
+	"variant",
+	"model_id",
+	"provider",
+	"model",
+	"input_tokens",
+	"output_tokens",
+	"total_tokens",
+	"cost_usd",
+}
+
+// ExportUsage writes the entries of a usage log read from r to w in format,
+// keeping those logged at or after from and before to. A zero from or to
+// leaves that end of the range open. It returns the number of entries written.
+func ExportUsage(r io.Reader, w io.Writer, format string, from, to time.Time) (int, error) {
+	if format != UsageFormatCSV && format != UsageFormatParquet {
+		return 0, fmt.Errorf("unsupported format %q, must be csv or parquet", format)
+	}
+	entries, err := readUsageLog(r, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if format == UsageFormatParquet {
+		return len(entries), writeUsageParquet(w, entries)
+	}
+	return len(entries), writeUsageCSV(w, entries)
+}
+
+// readUsageLog returns the entries of a usage log within [from, to).
+func readUsageLog(r io.Reader, from, to time.Time) ([]usageEntry, error) {
+	var entries []usageEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e usageEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("usage log line %d: %w", lineNo, err)
+		}
+		if (!from.IsZero() && e.Time.Before(from)) || (!to.IsZero() && !e.Time.Before(to)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	return entries, nil
+}
+
+func writeUsageCSV(w io.Writer, entries []usageEntry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(usageColumns)
+	for _, e := range entries {
+		_ = cw.Write([]string{
+			e.Time.UTC().Format(time.RFC3339Nano),
+			e.RequestID,
+			e.Listener,
+			e.Variant,
+			e.ModelID,
+			e.Provider,
+			e.Model,
+			strconv.Itoa(e.InputTokens),
+			strconv.Itoa(e.OutputTokens),
+			strconv.Itoa(e.TotalTokens),
+			strconv.FormatFloat(e.CostUSD, 'f', -1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeUsageParquet(w io.Writer, entries []usageEntry) error {
+	columns := make([]*parquetColumn, len(usageColumns))
+	for i, name := range usageColumns {
+		switch {
+		case i == 0:
+			columns[i] = newParquetColumn(name, parquetInt64, parquetTimeMicros)
+		case i < 7:
+			columns[i] = newParquetColumn(name, parquetByteArray, parquetUTF8)
+		case i < 10:
+			columns[i] = newParquetColumn(name, parquetInt64, -1)
+		default:
+			columns[i] = newParquetColumn(name, parquetDouble, -1)
+		}
+	}
+	for _, e := range entries {
+		columns[0].appendTime(e.Time)
+		for i, s := range []string{
+			e.RequestID,
+			e.Listener,
+			e.Variant,
+			e.ModelID,
+			e.Provider,
+			e.Model,
+		} {
+			columns[1+i].appendString(s)
+		}
+		columns[7].appendInt64(int64(e.InputTokens))
+		columns[8].appendInt64(int64(e.OutputTokens))
+		columns[9].appendInt64(int64(e.TotalTokens))
+		columns[10].appendFloat64(e.CostUSD)
+	}
+	return writeParquet(w, columns, len(entries))
+}
@@ -0,0 +1,271 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUsageLog = `{"time":"2026-08-31T23:59:59Z","model_id":"old","provider":"p","model":"m",` +
+	`"input_tokens":1,"output_tokens":1,"total_tokens":2,"cost_usd":0.5}
+{"time":"2026-09-03T10:00:00Z","request_id":"r1","listener":"main","model_id":"gpt",` +
+	`"provider":"openai","model":"gpt-5","input_tokens":10,"output_tokens":5,` +
+	`"total_tokens":15,"cost_usd":0.25}
+
+{"time":"2026-10-01T00:00:00Z","model_id":"new","provider":"p","model":"m",` +
+	`"input_tokens":1,"output_tokens":1,"total_tokens":2,"cost_usd":0.5}
+`
+
+func TestExportUsage_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	n, err := ExportUsage(strings.NewReader(testUsageLog), &buf, UsageFormatCSV, from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "time,request_id,listener,variant,model_id,provider,model," +
+		"input_tokens,output_tokens,total_tokens,cost_usd\n" +
+		"2026-09-03T10:00:00Z,r1,main,,gpt,openai,gpt-5,10,5,15,0.25\n"
+	if n != 1 || buf.String() != want {
+		t.Errorf("got %d entries:\n%s\nwant:\n%s", n, buf.String(), want)
+	}
+}
+
+func TestExportUsage_Parquet(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := ExportUsage(
+		strings.NewReader(testUsageLog),
+		&buf,
+		UsageFormatParquet,
+		time.Time{},
+		time.Time{},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 entries, got %d", n)
+	}
+
+	names, rows, columns := decodeParquet(t, buf.Bytes())
+	if !slices.Equal(names, usageColumns) || rows != 3 {
+		t.Fatalf("expected %d rows of %v, got %d rows of %v", n, usageColumns, rows, names)
+	}
+	entry := time.Date(2026, 9, 3, 10, 0, 0, 0, time.UTC).UnixMicro()
+	want := []any{
+		entry, "r1", "main", "", "gpt", "openai", "gpt-5",
+		int64(10), int64(5), int64(15), 0.25,
+	}
+	for i, column := range columns {
+		if len(column) != 3 || column[1] != want[i] {
+			t.Errorf("column %s: expected %v in row 2, got %v", names[i], want[i], column)
+		}
+	}
+}
+
+func TestExportUsage_ParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	var zero time.Time
+	_, err := ExportUsage(strings.NewReader(""), &buf, UsageFormatParquet, zero, zero)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names, rows, _ := decodeParquet(t, buf.Bytes())
+	if len(names) != len(usageColumns) || rows != 0 {
+		t.Errorf("expected an empty file with the usage schema, got %d rows of %v", rows, names)
+	}
+}
+
+// decodeParquet reads back a Parquet file as the Parquet format specifies,
+// independently of the writer: the schema's column names, the row count, and
+// the PLAIN values of each column.
+func decodeParquet(t *testing.T, data []byte) ([]string, int64, [][]any) {
+	t.Helper()
+	magic := []byte(parquetMagic)
+	if !bytes.HasPrefix(data, magic) || !bytes.HasSuffix(data, magic) {
+		t.Fatal("expected Parquet magic at both ends")
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer <= 0 || footer > len(data)-12 {
+		t.Fatalf("invalid footer length %d", footer)
+	}
+	r := &thriftReader{data: data[len(data)-8-footer : len(data)-8]}
+	meta := r.structure()
+	if r.err != nil || r.pos != footer {
+		t.Fatalf("invalid file metadata: %v, read %d of %d bytes", r.err, r.pos, footer)
+	}
+
+	// FileMetaData: 2 schema, 3 num_rows, 4 row_groups
+	schema := meta[2].([]any)
+	if root := schema[0].(map[int16]any); root[5] != int64(len(schema)-1) {
+		t.Fatalf("expected %d root children, got %v", len(schema)-1, root[5])
+	}
+	var names []string
+	var kinds []int64
+	for _, elem := range schema[1:] {
+		e := elem.(map[int16]any)
+		names = append(names, e[4].(string))
+		kinds = append(kinds, e[1].(int64))
+	}
+	rows := meta[3].(int64)
+
+	columns := make([][]any, len(names))
+	for _, group := range meta[4].([]any) {
+		// RowGroup: 1 columns; ColumnChunk: 3 meta_data; ColumnMetaData:
+		// 3 path_in_schema, 4 codec, 5 num_values, 9 data_page_offset
+		for i, chunk := range group.(map[int16]any)[1].([]any) {
+			cm := chunk.(map[int16]any)[3].(map[int16]any)
+			if path := cm[3].([]any); len(path) != 1 || path[0] != names[i] {
+				t.Fatalf("column %d: expected path %q, got %v", i, names[i], path)
+			}
+			if cm[4] != int64(parquetCodecNone) || cm[5] != rows {
+				t.Fatalf("column %s: expected %d uncompressed values, got %v", names[i], rows, cm)
+			}
+			// PageHeader: 1 type, 3 compressed_page_size, 5 data_page_header
+			page := &thriftReader{data: data[cm[9].(int64):]}
+			header := page.structure()
+			if page.err != nil || header[1] != int64(parquetDataPage) {
+				t.Fatalf("column %s: invalid page header %v: %v", names[i], header, page.err)
+			}
+			values := page.data[page.pos : page.pos+int(header[3].(int64))]
+			columns[i] = decodePlain(t, kinds[i], values)
+		}
+	}
+	return names, rows, columns
+}
+
+// decodePlain decodes PLAIN encoded values of a physical type.
+func decodePlain(t *testing.T, kind int64, b []byte) []any {
+	t.Helper()
+	var values []any
+	for len(b) > 0 {
+		switch kind {
+		case parquetInt64:
+			values = append(values, int64(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case parquetDouble:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case parquetByteArray:
+			n := binary.LittleEndian.Uint32(b)
+			values = append(values, string(b[4:4+n]))
+			b = b[4+n:]
+		default:
+			t.Fatalf("unexpected physical type %d", kind)
+		}
+	}
+	return values
+}
+
+// thriftReader decodes the Thrift compact protocol into maps of field IDs to
+// values: int64 for integers, string for binary, []any for lists.
+type thriftReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+	return fields
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		if r.pos+n > len(r.data) {
+			r.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		r.pos += n
+		return string(r.data[r.pos-n : r.pos])
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, 0, n)
+		for range n {
+			list = append(list, r.value(header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.err = fmt.Errorf("unsupported thrift type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func TestExportUsage_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	var zero time.Time
+	if _, err := ExportUsage(strings.NewReader(""), &buf, "xlsx", zero, zero); err == nil {
+		t.Error("expected error for an unsupported format")
+	}
+	_, err := ExportUsage(strings.NewReader("{}\nnot json\n"), &buf, UsageFormatCSV, zero, zero)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error for line 2, got %v", err)
+	}
+}
+
+func TestThriftWriter_LongFieldDelta(t *testing.T) {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, 1)
+	w.i32(20, -1)
+	w.end()
+	want := []byte{0x15, 0x02, 0x05, 0x28, 0x01, 0x00}
+	if !bytes.Equal(w.buf.Bytes(), want) {
+		t.Errorf("got % x, want % x", w.buf.Bytes(), want)
+	}
+}
@@ -0,0 +1,186 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Listener error_detail modes, applied when every attempt of a request fails.
+const (
+	errorDetailOff      = "off"      // Last upstream response, or a proxy error
+	errorDetailSummary  = "summary"  // Error in the listener's format with the last outcome
+	errorDetailAttempts = "attempts" // Also the provider, model, outcome, and time of each attempt
+)
+
+func isSupportedErrorDetail(mode string) bool {
+	switch mode {
+	case errorDetailOff, errorDetailSummary, errorDetailAttempts:
+		return true
+	default:
+		return false
+	}
+}
+
+// attemptFailure is the outcome of a failed attempt.
+type attemptFailure struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Status    int    `json:"status,omitempty"` // Upstream status, 0 without a response
+	Class     string `json:"class,omitempty"`  // Error class of an error response
+	Error     string `json:"error,omitempty"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+func newAttemptFailure(
+	model Model,
+	status int,
+	class string,
+	err error,
+	elapsed time.Duration,
+) attemptFailure {
+	f := attemptFailure{
+		Provider:  model.Provider,
+		Model:     model.Model,
+		Status:    status,
+		Class:     class,
+		ElapsedMS: elapsed.Milliseconds(),
+	}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+// Attempt is the outcome of one upstream attempt of a request, as reported
+// to the observer registered with WithAttemptObserver. Attempts skipped for a
+// provider's rate limits are reported with zero latency.
+type Attempt struct {
+	ModelID  string
+	Provider string
+	Model    string
+	Status   int    // Upstream status, 0 without a response
+	Class    string // Error class of an error response, such as "rate_limited"
+	Err      error
+	Latency  time.Duration
+	Answered bool // The response of this attempt was returned to the client
+}
+
+type attemptObserverContextKey struct{}
+
+// WithAttemptObserver returns a context whose requests report each of their
+// upstream attempts to observe, in order.
+func WithAttemptObserver(ctx context.Context, observe func(Attempt)) context.Context {
+	return context.WithValue(ctx, attemptObserverContextKey{}, observe)
+}
+
+// observeAttempt reports an attempt to the observer of ctx, if any.
+func observeAttempt(
+	ctx context.Context,
+	model Model,
+	status int,
+	class string,
+	err error,
+	elapsed time.Duration,
+	answered bool,
+) {
+	observe, ok := ctx.Value(attemptObserverContextKey{}).(func(Attempt))
+	if !ok {
+		return
+	}
+	observe(Attempt{
+		ModelID:  model.ID,
+		Provider: model.Provider,
+		Model:    model.Model,
+		Status:   status,
+		Class:    class,
+		Err:      err,
+		Latency:  elapsed,
+		Answered: answered,
+	})
+}
+
+// failedAttemptsResponse answers a request whose attempts all failed with one
+// error in the API format of the listener. Its status is that of the last
+// upstream response, else 429 when providers were skipped for their limits,
+// else 502. The attempts are listed in attempts mode.
+func failedAttemptsResponse(
+	req *http.Request,
+	l *Listener,
+	failures []attemptFailure,
+	lastErr error,
+) *http.Response {
+	status := http.StatusBadGateway
+	if errors.Is(lastErr, errProviderRateLimited) || errors.Is(lastErr, errProviderSaturated) {
+		status = http.StatusTooManyRequests
+	}
+	last := failures[len(failures)-1]
+	outcome := last.Error
+	if last.Status != 0 {
+		status = last.Status
+		outcome = fmt.Sprintf("status %d", last.Status)
+		if last.Class != "" {
+			outcome += " (" + last.Class + ")"
+		}
+		if last.Error != "" {
+			outcome += ": " + last.Error
+		}
+	}
+	message := fmt.Sprintf(
+		"all %d attempts failed, last %s %s: %s",
+		len(failures),
+		last.Provider,
+		last.Model,
+		outcome,
+	)
+
+	var detail map[string]any
+	var body any
+	switch l.ConfigType {
+	case "anthropic":
+		detail = map[string]any{"type": "api_error", "message": message}
+		body = map[string]any{"type": "error", "error": detail}
+	case "gemini":
+		detail = map[string]any{"code": status, "message": message, "status": "UNAVAILABLE"}
+		body = map[string]any{"error": detail}
+	case "bedrock":
+		detail = map[string]any{"message": message}
+		body = detail
+	default:
+		detail = map[string]any{
+			"message": message,
+			"type":    "upstream_error",
+			"code":    "all_attempts_failed",
+		}
+		body = map[string]any{"error": detail}
+	}
+	if l.ErrorDetail == errorDetailAttempts {
+		detail["attempts"] = failures
+	}
+	data, _ := json.Marshal(body)
+	return jsonResponse(req, status, data)
+}
+
+// jsonResponse returns a response to req with a JSON body.
+func jsonResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":   {"application/json"},
+			"Content-Length": {strconv.Itoa(len(body))},
+		},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
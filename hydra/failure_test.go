@@ -0,0 +1,141 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestFailedAttemptsResponse(t *testing.T) {
+	failures := []attemptFailure{
+		{Provider: "p1", Model: "m1", Error: "connection refused", ElapsedMS: 3},
+		{
+			Provider:  "p2",
+			Model:     "m2",
+			Status:    http.StatusServiceUnavailable,
+			Class:     errorClassOverloaded,
+			ElapsedMS: 40,
+		},
+	}
+	message := "all 2 attempts failed, last p2 m2: status 503 (overloaded)"
+	tests := []struct {
+		listenerType string
+		messagePath  string
+		attemptsPath string
+	}{
+		{"openai", "error.message", "error.attempts"},
+		{"anthropic", "error.message", "error.attempts"},
+		{"gemini", "error.message", "error.attempts"},
+		{"bedrock", "message", "attempts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.listenerType, func(t *testing.T) {
+			for _, mode := range []string{errorDetailSummary, errorDetailAttempts} {
+				l := &Listener{ConfigType: tt.listenerType, ErrorDetail: mode}
+				resp := failedAttemptsResponse(nil, l, failures, nil)
+				body, _ := io.ReadAll(resp.Body)
+				if resp.StatusCode != http.StatusServiceUnavailable {
+					t.Errorf("%s: expected the last status, got %d", mode, resp.StatusCode)
+				}
+				if got := gjson.GetBytes(body, tt.messagePath).String(); got != message {
+					t.Errorf("%s: expected message %q, got %q", mode, message, got)
+				}
+				attempts := gjson.GetBytes(body, tt.attemptsPath)
+				if mode == errorDetailSummary && attempts.Exists() {
+					t.Errorf("summary: expected no attempts, got %s", attempts.Raw)
+				}
+				if mode == errorDetailAttempts &&
+					(len(attempts.Array()) != 2 || attempts.Get("0.error").String() != "connection refused") {
+					t.Errorf("attempts: unexpected attempts %s", attempts.Raw)
+				}
+			}
+		})
+	}
+
+	t.Run("without response", func(t *testing.T) {
+		l := &Listener{ConfigType: "openai", ErrorDetail: errorDetailSummary}
+		resp := failedAttemptsResponse(nil, l, failures[:1], errors.New("connection refused"))
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("expected 502, got %d", resp.StatusCode)
+		}
+		resp = failedAttemptsResponse(nil, l, failures[:1], errProviderSaturated)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("expected 429 for saturated providers, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestTransport_RoundTrip_ErrorDetail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	model := func(id, provider string) Model {
+		return Model{
+			ID:       id,
+			Provider: provider,
+			Model:    "upstream-" + id,
+			Type:     "anthropic",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	l := &Listener{
+		Name:           "error-detail",
+		ConfigType:     "anthropic",
+		ErrorDetail:    errorDetailAttempts,
+		ResolvedModels: []Model{model("ed1", "error-detail-down"), model("ed2", "error-detail-mock")},
+	}
+	providers := map[string]Provider{
+		"error-detail-down": {URL: "http://127.0.0.1:1", ParsedURL: mustParseURL("http://127.0.0.1:1")},
+		"error-detail-mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond, DefaultTimeout: time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		"http://original/v1/messages",
+		bytes.NewReader([]byte(`{"model":"claude"}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got struct {
+		Type  string `json:"type"`
+		Error struct {
+			Message  string           `json:"message"`
+			Attempts []attemptFailure `json:"attempts"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != http.StatusInternalServerError || got.Type != "error" {
+		t.Fatalf("expected anthropic error with status 500, got %d %+v", resp.StatusCode, got)
+	}
+	if len(got.Error.Attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %+v", got.Error.Attempts)
+	}
+	first, second := got.Error.Attempts[0], got.Error.Attempts[1]
+	if first.Provider != "error-detail-down" || first.Status != 0 || first.Error == "" {
+		t.Errorf("expected connection failure first, got %+v", first)
+	}
+	if second.Model != "upstream-ed2" || second.Status != http.StatusInternalServerError {
+		t.Errorf("expected 500 from the second model, got %+v", second)
+	}
+	if !strings.HasPrefix(got.Error.Message, "all 2 attempts failed") {
+		t.Errorf("unexpected message %q", got.Error.Message)
+	}
+}
@@ -0,0 +1,320 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+)
+
+// Filter rule actions.
+const (
+	filterActionReject = "reject" // Answer 400 without contacting a provider
+	filterActionLog    = "log"    // Log and count the match, then forward the request
+)
+
+func isSupportedFilterAction(action string) bool {
+	return action == filterActionReject || action == filterActionLog
+}
+
+var filterMatchesCounter = metrics.Counter(
+	"hydrallm_filter_matches_total",
+	"Requests matching a listener filter rule, by listener, rule, and action.",
+)
+
+// FilterConfig holds request filtering rules that stop abusive or malformed
+// prompt requests before they cost upstream tokens. A zero limit disables
+// its rule.
+type FilterConfig struct {
+	MaxMessages      FilterLimit      `mapstructure:"max_messages"`       // Messages in a request
+	MaxMessageLength FilterLimit      `mapstructure:"max_message_length"` // Characters of one message
+	MaxTools         FilterLimit      `mapstructure:"max_tools"`          // Tool definitions
+	BlockedPatterns  []BlockedPattern `mapstructure:"blocked_patterns"`   // Matched on the raw body
+}
+
+// FilterLimit is a limit rule and the action taken on requests exceeding it.
+type FilterLimit struct {
+	Limit  int    `mapstructure:"limit"`
+	Action string `mapstructure:"action"` // reject or log
+}
+
+// BlockedPattern is a regular expression rule on the raw request body.
+type BlockedPattern struct {
+	Pattern string `mapstructure:"pattern"`
+	Action  string `mapstructure:"action"` // reject or log
+}
+
+// active reports whether any filter rule is set.
+func (f FilterConfig) active() bool {
+	return f.MaxMessages.Limit > 0 || f.MaxMessageLength.Limit > 0 || f.MaxTools.Limit > 0 ||
+		len(f.BlockedPatterns) > 0
+}
+
+// applyDefaults sets the default action of rules without one.
+func (f *FilterConfig) applyDefaults() {
+	for _, action := range []*string{
+		&f.MaxMessages.Action,
+		&f.MaxMessageLength.Action,
+		&f.MaxTools.Action,
+	} {
+		if *action == "" {
+			*action = filterActionReject
+		}
+	}
+	for i := range f.BlockedPatterns {
+		if f.BlockedPatterns[i].Action == "" {
+			f.BlockedPatterns[i].Action = filterActionReject
+		}
+	}
+}
+
+// validate checks the limits, actions, and patterns of the rules.
+func (f FilterConfig) validate() error {
+	for _, rule := range []struct {
+		name  string
+		limit FilterLimit
+	}{
+		{"max_messages", f.MaxMessages},
+		{"max_message_length", f.MaxMessageLength},
+		{"max_tools", f.MaxTools},
+	} {
+		if rule.limit.Limit < 0 {
+			return fmt.Errorf("filter %s must not be negative", rule.name)
+		}
+		if rule.limit.Action != "" && !isSupportedFilterAction(rule.limit.Action) {
+			return fmt.Errorf(
+				"filter %s: unsupported action %q (supported: reject, log)",
+				rule.name,
+				rule.limit.Action,
+			)
+		}
+	}
+	for _, p := range f.BlockedPatterns {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("filter blocked pattern %q: %w", p.Pattern, err)
+		}
+		if p.Action != "" && !isSupportedFilterAction(p.Action) {
+			return fmt.Errorf(
+				"filter blocked pattern %q: unsupported action %q (supported: reject, log)",
+				p.Pattern,
+				p.Action,
+			)
+		}
+	}
+	return nil
+}
+
+// filterMatch is a rule a request broke.
+type filterMatch struct {
+	rule   string
+	action string
+	reason string
+}
+
+// compiledFilter is a listener's filter with its patterns compiled.
+type compiledFilter struct {
+	FilterConfig
+	patterns []*regexp.Regexp
+}
+
+func compileFilter(f FilterConfig) (*compiledFilter, error) {
+	c := &compiledFilter{FilterConfig: f}
+	for _, p := range f.BlockedPatterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("filter blocked pattern %q: %w", p.Pattern, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c, nil
+}
+
+// check returns the rules a request body breaks, in rule order.
+func (c *compiledFilter) check(body []byte) []filterMatch {
+	var matches []filterMatch
+	shape := measureRequest(body)
+	for _, rule := range []struct {
+		name  string
+		limit FilterLimit
+		value int
+		unit  string
+	}{
+		{"max_messages", c.MaxMessages, shape.Messages, "messages"},
+		{"max_message_length", c.MaxMessageLength, shape.LongestMessage, "characters in a message"},
+		{"max_tools", c.MaxTools, shape.Tools, "tool definitions"},
+	} {
+		if rule.limit.Limit > 0 && rule.value > rule.limit.Limit {
+			matches = append(matches, filterMatch{
+				rule:   rule.name,
+				action: rule.limit.Action,
+				reason: fmt.Sprintf(
+					"%d %s exceed the limit of %d",
+					rule.value,
+					rule.unit,
+					rule.limit.Limit,
+				),
+			})
+		}
+	}
+	for i, re := range c.patterns {
+		if re.Match(body) {
+			matches = append(matches, filterMatch{
+				rule:   "blocked_patterns",
+				action: c.BlockedPatterns[i].Action,
+				reason: "request contains blocked content",
+			})
+		}
+	}
+	return matches
+}
+
+// requestShape is the size of a prompt request as seen by the filter rules.
+type requestShape struct {
+	Messages       int
+	LongestMessage int // Characters of text in the longest message
+	Tools          int
+}
+
+// measureRequest counts the messages and tool definitions of an OpenAI,
+// Responses, Anthropic, Gemini, or Bedrock Converse request body. Bodies that
+// are not JSON measure zero.
+func measureRequest(body []byte) requestShape {
+	var req struct {
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Contents []struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"contents"`
+		Input json.RawMessage `json:"input"`
+		Tools []struct {
+			FunctionDeclarations []json.RawMessage `json:"functionDeclarations"`
+		} `json:"tools"`
+		ToolConfig struct {
+			Tools []json.RawMessage `json:"tools"`
+		} `json:"toolConfig"`
+	}
+	var shape requestShape
+	if json.Unmarshal(body, &req) != nil {
+		return shape
+	}
+
+	message := func(text string) {
+		shape.Messages++
+		shape.LongestMessage = max(shape.LongestMessage, utf8.RuneCountInString(text))
+	}
+	for _, msg := range req.Messages {
+		message(promptText(msg.Content))
+	}
+	for _, content := range req.Contents {
+		var n int
+		for _, part := range content.Parts {
+			n += utf8.RuneCountInString(part.Text)
+		}
+		shape.Messages++
+		shape.LongestMessage = max(shape.LongestMessage, n)
+	}
+	var input string
+	var items []struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if json.Unmarshal(req.Input, &input) == nil {
+		message(input)
+	} else if json.Unmarshal(req.Input, &items) == nil {
+		for _, item := range items {
+			message(promptText(item.Content))
+		}
+	}
+
+	// Gemini groups function declarations into tools
+	for _, tool := range req.Tools {
+		shape.Tools += max(1, len(tool.FunctionDeclarations))
+	}
+	shape.Tools += len(req.ToolConfig.Tools)
+	return shape
+}
+
+// newFilterMiddleware applies the listener's filter rules to POST requests.
+// Requests breaking a reject rule are answered with 400 before they reach a
+// provider; matches of log rules are only logged and counted. The whole body
+// is checked, so bodies over the listener's max_body_size get 413.
+func newFilterMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if !l.Filter.active() {
+		return nil
+	}
+	filter, err := compileFilter(l.Filter)
+	if err != nil {
+		// Rejected by config validation
+		logger.Error("invalid filter, requests are not filtered", "listener", l.Name, "error", err)
+		return nil
+	}
+	limit := l.maxBodySize()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+			if err != nil {
+				writeBodyReadError(w, l, err)
+				return
+			}
+			if int64(len(body)) > limit {
+				writeBodyTooLarge(w, limit)
+				return
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{bytes.NewReader(body), r.Body}
+
+			for _, m := range filter.check(body) {
+				filterMatchesCounter.Inc("listener", l.Name, "rule", m.rule, "action", m.action)
+				logger.Warn(
+					"request matched filter rule",
+					"listener",
+					l.Name,
+					"rule",
+					m.rule,
+					"action",
+					m.action,
+					"reason",
+					m.reason,
+				)
+				if m.action == filterActionReject {
+					writeFilterRejection(w, m)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeFilterRejection answers a request rejected by a filter rule with a
+// JSON error.
+func writeFilterRejection(w http.ResponseWriter, m filterMatch) {
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]string{
+			"type":    "invalid_request_error",
+			"code":    "filtered_" + m.rule,
+			"message": m.reason,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,164 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestMeasureRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected requestShape
+	}{
+		{
+			"openai",
+			`{"messages":[{"role":"system","content":"be brief"},` +
+				`{"role":"user","content":"héllo"}],` +
+				`"tools":[{"type":"function"},{"type":"function"}]}`,
+			requestShape{Messages: 2, LongestMessage: 8, Tools: 2},
+		},
+		{
+			"anthropic parts",
+			`{"messages":[{"role":"user","content":` +
+				`[{"type":"text","text":"abc"},{"type":"text","text":"de"}]}]}`,
+			requestShape{Messages: 1, LongestMessage: 6},
+		},
+		{
+			"gemini",
+			`{"contents":[{"parts":[{"text":"ab"},{"text":"cd"}]}],` +
+				`"tools":[{"functionDeclarations":[{"name":"a"},{"name":"b"},{"name":"c"}]}]}`,
+			requestShape{Messages: 1, LongestMessage: 4, Tools: 3},
+		},
+		{
+			"bedrock converse",
+			`{"messages":[{"role":"user","content":[{"text":"hi"}]}],"toolConfig":{"tools":[{}]}}`,
+			requestShape{Messages: 1, LongestMessage: 2, Tools: 1},
+		},
+		{
+			"responses string input",
+			`{"input":"hello"}`,
+			requestShape{Messages: 1, LongestMessage: 5},
+		},
+		{
+			"responses items",
+			`{"input":[{"role":"user","content":"a"},{"role":"user","content":"bcd"}]}`,
+			requestShape{Messages: 2, LongestMessage: 3},
+		},
+		{"not json", `messages`, requestShape{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := measureRequest([]byte(tt.body)); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterMiddleware(t *testing.T) {
+	if newFilterMiddleware(&Listener{}, nil, log.New(io.Discard)) != nil {
+		t.Fatal("expected no middleware without filter rules")
+	}
+
+	l := &Listener{
+		Name: "filter-l1",
+		Filter: FilterConfig{
+			MaxMessages:      FilterLimit{Limit: 2},
+			MaxMessageLength: FilterLimit{Limit: 5, Action: filterActionLog},
+			BlockedPatterns:  []BlockedPattern{{Pattern: `\\u0000`}},
+		},
+	}
+	l.Filter.applyDefaults()
+	var forwarded string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := newFilterMiddleware(l, nil, log.New(io.Discard))(next)
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		expected int
+	}{
+		{"within limits", "POST", `{"messages":[{"content":"hi"}]}`, http.StatusNoContent},
+		{
+			"too many messages",
+			"POST",
+			`{"messages":[{"content":"a"},{"content":"b"},{"content":"c"}]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"log action forwards",
+			"POST",
+			`{"messages":[{"content":"too long"}]}`,
+			http.StatusNoContent,
+		},
+		{"blocked pattern", "POST", `{"messages":[{"content":"a\u0000"}]}`, http.StatusBadRequest},
+		{"GET is not filtered", "GET", `{"messages":[{},{},{}]}`, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded = ""
+			body := strings.NewReader(tt.body)
+			req := httptest.NewRequest(tt.method, "/v1/chat/completions", body)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %d, got %d: %s", tt.expected, rec.Code, rec.Body)
+			}
+			if rec.Code == http.StatusNoContent && forwarded != tt.body {
+				t.Errorf("expected the full body upstream, got %q", forwarded)
+			}
+			if rec.Code == http.StatusBadRequest &&
+				!strings.Contains(rec.Body.String(), `"code":"filtered_`) {
+				t.Errorf("expected a filter error, got %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestFilterMiddleware_LargeBody(t *testing.T) {
+	l := &Listener{
+		Name:        "filter-large",
+		MaxBodySize: 2 * corpusMaxCapture,
+		Filter:      FilterConfig{BlockedPatterns: []BlockedPattern{{Pattern: "forbidden"}}},
+	}
+	l.Filter.applyDefaults()
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := newFilterMiddleware(l, nil, log.New(io.Discard))(next)
+
+	padding := strings.Repeat("a", corpusMaxCapture)
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{
+			"pattern past the padding",
+			`{"messages":[{"content":"` + padding + ` forbidden"}]}`,
+			http.StatusBadRequest,
+		},
+		{"over max_body_size", padding + padding + "x", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
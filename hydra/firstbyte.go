@@ -0,0 +1,54 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// errFirstByteTimeout cancels an attempt whose response did not start within
+// the model's first_byte_timeout.
+var errFirstByteTimeout = errors.New("first byte timeout reached")
+
+// withFirstByteTimeout returns req with a context that is canceled once
+// timeout passes, and end, which takes the outcome of sending it. In time, end
+// stops the timer and releases the context once the response body is closed,
+// so a response that has started is never cut. Late, it discards the response
+// for an error the attempt fails with.
+func withFirstByteTimeout(
+	req *http.Request,
+	timeout time.Duration,
+) (*http.Request, func(*http.Response, error) (*http.Response, error)) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(timeout, func() { cancel(errFirstByteTimeout) })
+	end := func(resp *http.Response, err error) (*http.Response, error) {
+		if !timer.Stop() {
+			cancel(nil)
+			if resp != nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+			return nil, fmt.Errorf("%w: no response within %s", errFirstByteTimeout, timeout)
+		}
+		if err != nil {
+			cancel(nil)
+			return nil, err
+		}
+		resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+		return resp, nil
+	}
+	return req.WithContext(ctx), end
+}
+
+// firstEventTimeout is how long a stream may still take to its first event
+// once elapsed of the attempt has passed: what is left of the model's
+// first_byte_timeout, or else its timeout.
+func (m Model) firstEventTimeout(elapsed time.Duration) time.Duration {
+	if m.FirstByteTimeout <= 0 {
+		return m.Timeout
+	}
+	return max(m.FirstByteTimeout-elapsed, time.Millisecond)
+}
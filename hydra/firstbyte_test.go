@@ -0,0 +1,103 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestTransport_RoundTrip_FirstByteTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: late\n\n"))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: start\n\n"))
+		if strings.Contains(string(body), `"stream":true`) {
+			// The stream outlasts the first byte timeout
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("data: done\n\n"))
+	}))
+	defer fast.Close()
+
+	l := &Listener{
+		Name:       "first-byte-timeout",
+		ConfigType: "openai",
+		ResolvedModels: []Model{
+			{
+				ID:               "slow",
+				Provider:         "slow",
+				Model:            "gpt-5",
+				Type:             "openai",
+				Attempts:         1,
+				Timeout:          5 * time.Second,
+				FirstByteTimeout: 50 * time.Millisecond,
+			},
+			{
+				ID:               "fast",
+				Provider:         "fast",
+				Model:            "gpt-5-mini",
+				Type:             "openai",
+				Attempts:         1,
+				Timeout:          5 * time.Second,
+				FirstByteTimeout: 50 * time.Millisecond,
+			},
+		},
+	}
+	providers := map[string]Provider{
+		"slow": {URL: slow.URL, ParsedURL: mustParseURL(slow.URL)},
+		"fast": {URL: fast.URL, ParsedURL: mustParseURL(fast.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: 5 * time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	for _, body := range []string{`{}`, `{"stream":true}`} {
+		start := time.Now()
+		resp, err := transport.RoundTrip(
+			httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)),
+		)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", body, err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK ||
+			string(got) != "data: start\n\ndata: done\n\n" {
+			t.Errorf("%s: expected the fast model's whole response, got %d %q (%v)",
+				body, resp.StatusCode, got, err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("%s: expected a fallback near the first byte timeout, took %s", body, elapsed)
+		}
+	}
+}
+
+func TestModel_FirstEventTimeout(t *testing.T) {
+	m := Model{Timeout: time.Minute}
+	if got := m.firstEventTimeout(time.Second); got != time.Minute {
+		t.Errorf("expected the model timeout without first_byte_timeout, got %s", got)
+	}
+	m.FirstByteTimeout = 5 * time.Second
+	if got := m.firstEventTimeout(2 * time.Second); got != 3*time.Second {
+		t.Errorf("expected the rest of first_byte_timeout, got %s", got)
+	}
+	if got := m.firstEventTimeout(10 * time.Second); got <= 0 {
+		t.Errorf("expected a positive timeout once first_byte_timeout passed, got %s", got)
+	}
+}
@@ -0,0 +1,539 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// geminiModelSegment matches the model of a generateContent style path, in both
+// the Gemini API and Vertex AI publisher layouts.
+var geminiModelSegment = regexp.MustCompile(`/models/[^/:]+:`)
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords the Gemini function
+// declaration schema rejects.
+var geminiUnsupportedSchemaKeys = []string{"$schema", "additionalProperties"}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` // AUTO, ANY, or NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiResponse struct {
+	ResponseID     string            `json:"responseId"`
+	ModelVersion   string            `json:"modelVersion"`
+	Candidates     []geminiCandidate `json:"candidates"`
+	UsageMetadata  *geminiUsage      `json:"usageMetadata"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	Error json.RawMessage `json:"error"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// openAI converts Gemini usage, counting thinking tokens as completion tokens.
+func (u *geminiUsage) openAI() *openAIUsage {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	return &openAIUsage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: completion,
+		TotalTokens:      cmp.Or(u.TotalTokenCount, u.PromptTokenCount+completion),
+	}
+}
+
+type geminiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// geminiModelPath replaces the model of a native Gemini request path.
+func geminiModelPath(path, model string) string {
+	return geminiModelSegment.ReplaceAllLiteralString(path, "/models/"+model+":")
+}
+
+// translateGeminiRequest converts an OpenAI chat completions body to a Gemini
+// generateContent body.
+func translateGeminiRequest(body []byte) ([]byte, error) {
+	var in openAIChatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, fmt.Errorf("failed to decode chat completions request: %w", err)
+	}
+
+	out := geminiRequest{Contents: []geminiContent{}}
+	config := geminiGenerationConfig{
+		MaxOutputTokens: cmp.Or(in.MaxCompletionTokens, in.MaxTokens),
+		Temperature:     in.Temperature,
+		TopP:            in.TopP,
+	}
+	stop, err := decodeStop(in.Stop)
+	if err != nil {
+		return nil, err
+	}
+	config.StopSequences = stop
+	if config.MaxOutputTokens > 0 || config.Temperature != nil || config.TopP != nil ||
+		len(stop) > 0 {
+		out.GenerationConfig = &config
+	}
+
+	// Function responses are matched to their calls by name, not ID
+	toolNames := make(map[string]string)
+	var system []geminiPart
+	for _, msg := range in.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			text, err := contentText(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			if text != "" {
+				system = append(system, geminiPart{Text: text})
+			}
+		case "tool":
+			text, err := contentText(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			response := json.RawMessage(text)
+			if !json.Valid(response) || !strings.HasPrefix(strings.TrimSpace(text), "{") {
+				response, _ = json.Marshal(map[string]string{"content": text})
+			}
+			out.Contents = appendGeminiParts(out.Contents, "user", geminiPart{
+				FunctionResponse: &geminiFunctionResponse{
+					Name:     toolNames[msg.ToolCallID],
+					Response: response,
+				},
+			})
+		case "user", "assistant":
+			blocks, err := contentBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			parts := make([]geminiPart, 0, len(blocks)+len(msg.ToolCalls))
+			for _, b := range blocks {
+				parts = append(parts, geminiContentPart(b))
+			}
+			for _, call := range msg.ToolCalls {
+				args := json.RawMessage(call.Function.Arguments)
+				if len(bytes.TrimSpace(args)) == 0 {
+					args = json.RawMessage("{}")
+				}
+				if !json.Valid(args) {
+					return nil, fmt.Errorf("tool call %q: arguments are not valid JSON", call.ID)
+				}
+				toolNames[call.ID] = call.Function.Name
+				parts = append(parts, geminiPart{
+					FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args},
+				})
+			}
+			role := "user"
+			if msg.Role == "assistant" {
+				role = "model"
+			}
+			out.Contents = appendGeminiParts(out.Contents, role, parts...)
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", msg.Role)
+		}
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(in.Tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(in.Tools))
+		for _, tool := range in.Tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  geminiSchema(tool.Function.Parameters),
+			})
+		}
+		out.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+
+	choice, err := decodeToolChoice(in.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+	if choice != nil {
+		cfg := geminiFunctionCallingConfig{Mode: "AUTO"}
+		switch choice.Type {
+		case "none":
+			cfg.Mode = "NONE"
+		case "any":
+			cfg.Mode = "ANY"
+		case "tool":
+			cfg.Mode = "ANY"
+			cfg.AllowedFunctionNames = []string{choice.Name}
+		}
+		out.ToolConfig = &geminiToolConfig{FunctionCallingConfig: cfg}
+	}
+
+	return json.Marshal(out)
+}
+
+// appendGeminiParts appends parts to the conversation, merging consecutive
+// turns of the same role so parallel function responses share one turn.
+func appendGeminiParts(contents []geminiContent, role string, parts ...geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiContentPart converts a text or image block to a Gemini part.
+func geminiContentPart(b anthropicBlock) geminiPart {
+	if b.Source == nil {
+		return geminiPart{Text: b.Text}
+	}
+	if b.Source.Type == "base64" {
+		return geminiPart{InlineData: &geminiBlob{MimeType: b.Source.MediaType, Data: b.Source.Data}}
+	}
+	return geminiPart{FileData: &geminiFileData{FileURI: b.Source.URL}}
+}
+
+// geminiSchema removes JSON Schema keywords that Gemini rejects from tool
+// parameters. Schemas that are not JSON objects are passed through.
+func geminiSchema(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var schema any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(stripSchemaKeys(schema))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func stripSchemaKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(v, key)
+		}
+		for k, e := range v {
+			if k == "properties" {
+				// Property names are not keywords
+				if props, ok := e.(map[string]any); ok {
+					for name, prop := range props {
+						props[name] = stripSchemaKeys(prop)
+					}
+				}
+				continue
+			}
+			v[k] = stripSchemaKeys(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = stripSchemaKeys(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// geminiFinishReason maps a Gemini finish reason to an OpenAI finish reason.
+func geminiFinishReason(reason string, toolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if toolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiToolCallID returns the call's ID, or a generated one for API versions
+// that do not assign IDs.
+func geminiToolCallID(call *geminiFunctionCall, index int) string {
+	return cmp.Or(call.ID, "call_"+strconv.Itoa(index))
+}
+
+// translateGeminiResponse converts a complete generateContent response body.
+// It returns nil if the body is not a generateContent response.
+func translateGeminiResponse(body []byte, model Model) []byte {
+	var in geminiResponse
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil
+	}
+	if len(in.Candidates) == 0 && in.PromptFeedback == nil {
+		return nil
+	}
+
+	msg := &openAIResponseMessage{Role: "assistant"}
+	var text strings.Builder
+	reason := "content_filter" // A blocked prompt has no candidates
+	if len(in.Candidates) > 0 {
+		candidate := in.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				args := cmp.Or(string(part.FunctionCall.Args), "{}")
+				msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{
+					ID:       geminiToolCallID(part.FunctionCall, len(msg.ToolCalls)),
+					Type:     "function",
+					Function: openAIFunctionCall{Name: part.FunctionCall.Name, Arguments: args},
+				})
+			case !part.Thought:
+				text.WriteString(part.Text)
+			}
+		}
+		reason = geminiFinishReason(candidate.FinishReason, len(msg.ToolCalls) > 0)
+	}
+	if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+		content := text.String()
+		msg.Content = &content
+	}
+
+	out := openAIChatResponse{
+		ID:      in.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   cmp.Or(in.ModelVersion, model.Model),
+		Choices: []openAIChoice{{Message: msg, FinishReason: &reason}},
+	}
+	if in.UsageMetadata != nil {
+		out.Usage = in.UsageMetadata.openAI()
+	}
+	translated, err := json.Marshal(out)
+	if err != nil {
+		return nil
+	}
+	return translated
+}
+
+// translateGeminiError converts a Google API error body to the OpenAI error format.
+// It returns nil if the body is not a Google API error.
+func translateGeminiError(body []byte) []byte {
+	var in geminiError
+	if err := json.Unmarshal(body, &in); err != nil || in.Error.Message == "" {
+		return nil
+	}
+	translated, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": in.Error.Message,
+			"type":    in.Error.Status,
+			"code":    nil,
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	return translated
+}
+
+// translateGeminiStream converts a Gemini SSE stream (alt=sse) to OpenAI chat
+// completion chunks. Gemini has no final event, so the finish chunk and
+// [DONE] are written when the stream ends after a finish reason.
+func translateGeminiStream(r io.Reader, w io.Writer, model Model, includeUsage bool) error {
+	var (
+		id        string
+		modelName = model.Model
+		created   = time.Now().Unix()
+		started   bool
+		toolCalls int
+		finish    string
+		usage     *geminiUsage
+	)
+
+	writeChunk := func(delta *openAIDelta, reason *string, u *openAIUsage) error {
+		chunk := openAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   modelName,
+			Choices: []openAIChoice{},
+			Usage:   u,
+		}
+		if delta != nil {
+			chunk.Choices = append(chunk.Choices, openAIChoice{Delta: delta, FinishReason: reason})
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var ev geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &ev); err != nil {
+			continue
+		}
+		if len(ev.Error) > 0 && string(ev.Error) != "null" {
+			if _, err := fmt.Fprintf(w, "data: {\"error\":%s}\n\n", ev.Error); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !started {
+			started = true
+			id = ev.ResponseID
+			modelName = cmp.Or(ev.ModelVersion, modelName)
+			empty := ""
+			if err := writeChunk(&openAIDelta{Role: "assistant", Content: &empty}, nil, nil); err != nil {
+				return err
+			}
+		}
+		if ev.UsageMetadata != nil {
+			usage = ev.UsageMetadata
+		}
+		if len(ev.Candidates) == 0 {
+			if ev.PromptFeedback != nil && ev.PromptFeedback.BlockReason != "" {
+				finish = "content_filter"
+			}
+			continue
+		}
+
+		candidate := ev.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			var err error
+			switch {
+			case part.FunctionCall != nil:
+				idx := toolCalls
+				toolCalls++
+				err = writeChunk(&openAIDelta{ToolCalls: []openAIToolCall{{
+					Index: &idx,
+					ID:    geminiToolCallID(part.FunctionCall, idx),
+					Type:  "function",
+					Function: openAIFunctionCall{
+						Name:      part.FunctionCall.Name,
+						Arguments: cmp.Or(string(part.FunctionCall.Args), "{}"),
+					},
+				}}}, nil, nil)
+			case !part.Thought && part.Text != "":
+				text := part.Text
+				err = writeChunk(&openAIDelta{Content: &text}, nil, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if candidate.FinishReason != "" {
+			finish = geminiFinishReason(candidate.FinishReason, toolCalls > 0)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if finish == "" {
+		// Leave an interrupted stream incomplete for stream repair
+		return nil
+	}
+
+	if err := writeChunk(&openAIDelta{}, &finish, nil); err != nil {
+		return err
+	}
+	if includeUsage && usage != nil {
+		if err := writeChunk(nil, nil, usage.openAI()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "data: [DONE]\n\n")
+	return err
+}
@@ -0,0 +1,229 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestTranslateGeminiRequest(t *testing.T) {
+	body := `{
+		"model": "placeholder",
+		"max_tokens": 256,
+		"stop": "END",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function",
+				 "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"}
+		],
+		"tools": [{"type": "function", "function": {
+			"name": "lookup",
+			"parameters": {"type": "object", "additionalProperties": false,
+				"properties": {"additionalProperties": {"type": "string"}}}
+		}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}}
+	}`
+
+	out, err := translateGeminiRequest([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got geminiRequest
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("invalid output JSON: %v", err)
+	}
+
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("unexpected system instruction: %+v", got.SystemInstruction)
+	}
+	if got.GenerationConfig == nil || got.GenerationConfig.MaxOutputTokens != 256 ||
+		len(got.GenerationConfig.StopSequences) != 1 {
+		t.Errorf("unexpected generation config: %+v", got.GenerationConfig)
+	}
+	if len(got.Contents) != 3 {
+		t.Fatalf("expected 3 turns, got %d", len(got.Contents))
+	}
+	user := got.Contents[0]
+	if user.Role != "user" || len(user.Parts) != 2 || user.Parts[1].InlineData == nil ||
+		user.Parts[1].InlineData.MimeType != "image/png" {
+		t.Errorf("unexpected user turn: %+v", user)
+	}
+	call := got.Contents[1]
+	if call.Role != "model" || call.Parts[0].FunctionCall == nil ||
+		string(call.Parts[0].FunctionCall.Args) != `{"q":"cat"}` {
+		t.Errorf("unexpected model turn: %+v", call)
+	}
+	result := got.Contents[2].Parts[0].FunctionResponse
+	if result == nil || result.Name != "lookup" || string(result.Response) != `{"content":"a cat"}` {
+		t.Errorf("unexpected function response: %+v", result)
+	}
+
+	params := string(got.Tools[0].FunctionDeclarations[0].Parameters)
+	if params != `{"properties":{"additionalProperties":{"type":"string"}},"type":"object"}` {
+		t.Errorf("expected unsupported keywords removed, got %s", params)
+	}
+	cfg := got.ToolConfig.FunctionCallingConfig
+	if cfg.Mode != "ANY" || len(cfg.AllowedFunctionNames) != 1 {
+		t.Errorf("unexpected tool config: %+v", cfg)
+	}
+}
+
+func TestTranslateGeminiResponse(t *testing.T) {
+	body := `{"responseId":"r1","modelVersion":"gemini-2.5-flash","candidates":[{"content":
+		{"role":"model","parts":[{"text":"thinking","thought":true},{"text":"Hi"},
+		{"functionCall":{"name":"lookup","args":{"q":"cat"}}}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`
+
+	var out openAIChatResponse
+	if err := json.Unmarshal(translateGeminiResponse([]byte(body), Model{}), &out); err != nil {
+		t.Fatalf("invalid translated response: %v", err)
+	}
+	msg := out.Choices[0].Message
+	if out.ID != "r1" || out.Model != "gemini-2.5-flash" || *msg.Content != "Hi" {
+		t.Errorf("unexpected response: %+v", out)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "call_0" ||
+		msg.ToolCalls[0].Function.Arguments != `{"q":"cat"}` {
+		t.Errorf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	if *out.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("expected finish_reason tool_calls, got %s", *out.Choices[0].FinishReason)
+	}
+	if out.Usage == nil || out.Usage.TotalTokens != 6 {
+		t.Errorf("unexpected usage: %+v", out.Usage)
+	}
+
+	if translateGeminiResponse([]byte(`{"data":[]}`), Model{}) != nil {
+		t.Error("expected nil for a body that is not a generateContent response")
+	}
+}
+
+func TestTranslateGeminiError(t *testing.T) {
+	body := `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`
+	want := `{"error":{"code":null,"message":"Quota exceeded","type":"RESOURCE_EXHAUSTED"}}`
+	if got := string(translateGeminiError([]byte(body))); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+const geminiStreamFixture = `data: {"candidates":[{"content":{"role":"model",` +
+	`"parts":[{"text":"Hel"}]}}],"responseId":"r1"}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},` +
+	`"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":3,` +
+	`"candidatesTokenCount":2,"totalTokenCount":5}}
+
+`
+
+func TestTranslateGeminiStream(t *testing.T) {
+	var out bytes.Buffer
+	err := translateGeminiStream(strings.NewReader(geminiStreamFixture), &out, Model{}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		`"role":"assistant"`,
+		`"content":"Hel"`,
+		`"content":"lo"`,
+		`"finish_reason":"length"`,
+		`"total_tokens":5`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in stream, got:\n%s", want, got)
+		}
+	}
+	if !strings.HasSuffix(got, "data: [DONE]\n\n") {
+		t.Errorf("expected [DONE] terminator, got:\n%s", got)
+	}
+
+	// A stream cut off before a finish reason is left without a terminator
+	out.Reset()
+	first, _, _ := strings.Cut(geminiStreamFixture, "\n\n")
+	_ = translateGeminiStream(strings.NewReader(first+"\n\n"), &out, Model{}, false)
+	if strings.Contains(out.String(), "[DONE]") {
+		t.Errorf("expected no terminator for an interrupted stream, got:\n%s", out.String())
+	}
+}
+
+func TestGeminiModelPath(t *testing.T) {
+	got := geminiModelPath("/v1beta/models/gemini-pro:streamGenerateContent", "gemini-2.5-flash")
+	if got != "/v1beta/models/gemini-2.5-flash:streamGenerateContent" {
+		t.Errorf("unexpected path %s", got)
+	}
+}
+
+func TestTransport_RoundTrip_TranslatesToGemini(t *testing.T) {
+	var gotPath, gotQuery, gotKey string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		gotKey = r.Header.Get("x-goog-api-key")
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(geminiStreamFixture))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "google",
+			Model:    "gemini-2.5-flash",
+			Type:     "gemini",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"google": {
+			URL:       ts.URL + "/v1beta",
+			APIKey:    "g-key",
+			ParsedURL: mustParseURL(ts.URL + "/v1beta"),
+		},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"stream":true,"messages":[{"role":"user","content":"hello"}]}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if gotPath != "/v1beta/models/gemini-2.5-flash:streamGenerateContent" || gotQuery != "alt=sse" {
+		t.Errorf("unexpected upstream URL %s?%s", gotPath, gotQuery)
+	}
+	if gotKey != "g-key" {
+		t.Errorf("expected provider API key, got %q", gotKey)
+	}
+	if !strings.Contains(string(body), `"content":"Hel"`) ||
+		!strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("unexpected translated stream:\n%s", body)
+	}
+}
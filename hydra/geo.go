@@ -0,0 +1,157 @@
+package hydra
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// GeoConfig names regions of client addresses, which [[routes]] rules match
+// with their regions condition. A region lists networks in CIDR notation and
+// ISO country codes; country codes are looked up in a MaxMind DB such as
+// GeoLite2 Country.
+type GeoConfig struct {
+	Database       string              `mapstructure:"database"`         // MaxMind DB file
+	ClientIPHeader string              `mapstructure:"client_ip_header"` // Set by a trusted proxy
+	Regions        map[string][]string `mapstructure:"regions"`          // Networks and countries
+
+	db      *mmdbReader           `mapstructure:"-"`
+	regions map[string]*geoRegion `mapstructure:"-"`
+}
+
+// geoRegion is a parsed region.
+type geoRegion struct {
+	prefixes  []netip.Prefix
+	countries []string // Upper case ISO codes
+}
+
+// resolve parses the regions and opens the database.
+func (g *GeoConfig) resolve() error {
+	g.regions = make(map[string]*geoRegion, len(g.Regions))
+	needsDB := false
+	for name, entries := range g.Regions {
+		region := &geoRegion{}
+		for _, entry := range entries {
+			if prefix, err := netip.ParsePrefix(entry); err == nil {
+				region.prefixes = append(region.prefixes, prefix.Masked())
+			} else if addr, err := netip.ParseAddr(entry); err == nil {
+				region.prefixes = append(region.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			} else if len(entry) == 2 && isASCIILetters(entry) {
+				region.countries = append(region.countries, strings.ToUpper(entry))
+			} else {
+				return fmt.Errorf(
+					"geo: region %q: %q is neither a network nor a country code",
+					name,
+					entry,
+				)
+			}
+		}
+		needsDB = needsDB || len(region.countries) > 0
+		g.regions[strings.ToLower(name)] = region
+	}
+
+	if g.Database == "" {
+		if needsDB {
+			return fmt.Errorf("geo: country codes in regions require a database")
+		}
+		return nil
+	}
+	db, err := openMMDB(g.Database)
+	if err != nil {
+		return fmt.Errorf("geo: %w", err)
+	}
+	g.db = db
+	return nil
+}
+
+func isASCIILetters(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// clientHeadersContextKey holds the headers of a request as the client sent
+// them, before the proxy removed its forwarding headers.
+type clientHeadersContextKey struct{}
+
+// withClientHeaders keeps the headers the client sent in ctx.
+func withClientHeaders(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, clientHeadersContextKey{}, h)
+}
+
+// clientIP returns the address of the client of req: the last address in the
+// client IP header, which the trusted proxy in front added, or else the peer
+// address of the connection.
+func (g *GeoConfig) clientIP(req *http.Request) netip.Addr {
+	if g.ClientIPHeader != "" {
+		h, ok := req.Context().Value(clientHeadersContextKey{}).(http.Header)
+		if !ok {
+			h = req.Header
+		}
+		values := strings.Split(strings.Join(h.Values(g.ClientIPHeader), ","), ",")
+		if addr, err := netip.ParseAddr(strings.TrimSpace(values[len(values)-1])); err == nil {
+			return addr.Unmap()
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
+
+// clientGeo is the location of a request's client, found on first use.
+type clientGeo struct {
+	geo     *GeoConfig
+	req     *http.Request
+	addr    netip.Addr
+	country string
+	found   bool
+}
+
+// locate finds the client's address and, with a database, its country.
+func (c *clientGeo) locate() {
+	if c.found {
+		return
+	}
+	c.found = true
+	c.addr = c.geo.clientIP(c.req)
+	if c.geo.db != nil && c.addr.IsValid() {
+		// An address the database cannot resolve is in no country
+		c.country, _ = c.geo.db.country(c.addr)
+	}
+}
+
+// in reports whether the client is in any of the named regions.
+func (c *clientGeo) in(regions []string) bool {
+	if c.geo == nil {
+		return false
+	}
+	c.locate()
+	if !c.addr.IsValid() {
+		return false
+	}
+	for _, name := range regions {
+		region := c.geo.regions[strings.ToLower(name)]
+		if region == nil {
+			continue
+		}
+		if slices.ContainsFunc(region.prefixes, func(p netip.Prefix) bool {
+			return p.Contains(c.addr)
+		}) {
+			return true
+		}
+		if c.country != "" && slices.Contains(region.countries, c.country) {
+			return true
+		}
+	}
+	return false
+}
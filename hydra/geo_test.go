@@ -0,0 +1,168 @@
+package hydra
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestGeoConfig_Resolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		geo     GeoConfig
+		wantErr string
+	}{
+		{
+			"networks",
+			GeoConfig{Regions: map[string][]string{"eu": {"203.0.113.0/24", "2001:db8::1"}}},
+			"",
+		},
+		{
+			"countries without database",
+			GeoConfig{Regions: map[string][]string{"eu": {"DE"}}},
+			"require a database",
+		},
+		{
+			"invalid entry",
+			GeoConfig{Regions: map[string][]string{"eu": {"europe"}}},
+			"neither a network nor a country code",
+		},
+		{"missing database", GeoConfig{Database: "missing.mmdb"}, "failed to read geo database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.geo.resolve()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestClientGeo_In(t *testing.T) {
+	geo := &GeoConfig{
+		Database: writeTestMMDB(t, map[string]string{
+			"198.51.100.0/24": "DE",
+			"192.0.2.0/24":    "US",
+		}),
+		Regions: map[string][]string{"eu": {"203.0.113.0/24", "de", "FR"}},
+	}
+	if err := geo.resolve(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		header string // Client IP header in effect
+		remote string
+		xff    string
+		want   bool
+	}{
+		{"network", "", "203.0.113.7:40000", "", true},
+		{"country", "", "198.51.100.7:40000", "", true},
+		{"other country", "", "192.0.2.1:40000", "", false},
+		{"unknown address", "", "10.0.0.1:40000", "", false},
+		{"header ignored", "", "192.0.2.1:40000", "198.51.100.7", false},
+		{"header", "X-Forwarded-For", "10.0.0.1:40000", "198.51.100.7", true},
+		{"last address", "X-Forwarded-For", "10.0.0.1:40000", "198.51.100.7, 192.0.2.1", false},
+		{"invalid header", "X-Forwarded-For", "203.0.113.7:40000", "unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geo.ClientIPHeader = tt.header
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			client := &clientGeo{geo: geo, req: req}
+			if got := client.in([]string{"EU"}); got != tt.want {
+				t.Errorf("in(EU) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_RegionRule(t *testing.T) {
+	var got string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		got = body.Model
+		if r.Header.Get("X-Forwarded-For") != "" {
+			t.Error("expected the client address not to be forwarded upstream")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	model := func(id string) Model {
+		return Model{
+			ID:       id,
+			Provider: "mock",
+			Model:    "upstream-" + id,
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	cfg := &Config{
+		Providers: map[string]Provider{
+			"mock": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+		},
+		Geo: GeoConfig{
+			ClientIPHeader: "X-Forwarded-For",
+			Regions:        map[string][]string{"eu": {"203.0.113.0/24"}},
+		},
+	}
+	if err := cfg.Geo.resolve(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rule, err := compileRule(
+		RoutingRule{Name: "eu", Regions: []string{"eu"}, Models: []string{"eu"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule.chain, rule.geo = []Model{model("eu")}, &cfg.Geo
+	l := &Listener{
+		Name:           "geo-main",
+		ResolvedModels: []Model{model("global")},
+		ResolvedRules:  []resolvedRule{rule},
+	}
+	srv := httptest.NewServer(NewProxy(l, cfg, log.New(io.Discard)))
+	defer srv.Close()
+
+	send := func(forwardedFor string) {
+		t.Helper()
+		req, _ := http.NewRequest(
+			http.MethodPost,
+			srv.URL+"/v1/chat/completions",
+			strings.NewReader(`{"model":"gpt-4o"}`),
+		)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+	send("203.0.113.9")
+	if got != "upstream-eu" {
+		t.Errorf("expected EU traffic on the EU chain, got %q", got)
+	}
+	send("192.0.2.1")
+	if got != "upstream-global" {
+		t.Errorf("expected other traffic on the global chain, got %q", got)
+	}
+}
@@ -0,0 +1,188 @@
+package hydra
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURI   = "https://oauth2.googleapis.com/token"
+	googleCloudScope = "https://www.googleapis.com/auth/cloud-platform"
+	// googleTokenRefreshMargin renews access tokens this long before they expire.
+	googleTokenRefreshMargin = time.Minute
+)
+
+// googleTokens caches token sources by service account file, so tokens are
+// reused across requests and reloads.
+var googleTokens = struct {
+	mu      sync.Mutex
+	sources map[string]*googleTokenSource
+}{sources: make(map[string]*googleTokenSource)}
+
+// googleServiceAccount holds the fields of a service account key file used to
+// obtain access tokens.
+type googleServiceAccount struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleTokenSource exchanges a signed service account JWT for OAuth access
+// tokens and caches them until shortly before they expire.
+type googleTokenSource struct {
+	email    string
+	key      *rsa.PrivateKey
+	tokenURI string
+	client   *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// loadGoogleServiceAccount reads and parses a service account key file.
+func loadGoogleServiceAccount(path string) (*googleTokenSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read google credentials: %w", err)
+	}
+	var account googleServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse google credentials: %w", err)
+	}
+	if account.Type != "service_account" || account.ClientEmail == "" {
+		return nil, errors.New("google credentials must be a service account key file")
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("google credentials: private_key is not PEM encoded")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("google credentials: private_key is not an RSA key")
+		}
+		key = rsaKey
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("google credentials: invalid private_key: %w", err)
+	}
+
+	tokenURI := account.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURI
+	}
+	return &googleTokenSource{
+		email:    account.ClientEmail,
+		key:      key,
+		tokenURI: tokenURI,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// googleTokenSourceFor returns the cached token source for a service account file.
+func googleTokenSourceFor(path string) (*googleTokenSource, error) {
+	googleTokens.mu.Lock()
+	defer googleTokens.mu.Unlock()
+	if s, ok := googleTokens.sources[path]; ok {
+		return s, nil
+	}
+	s, err := loadGoogleServiceAccount(path)
+	if err != nil {
+		return nil, err
+	}
+	googleTokens.sources[path] = s
+	return s, nil
+}
+
+// Token returns a valid access token, fetching a new one when needed.
+func (s *googleTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Add(googleTokenRefreshMargin).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	assertion, err := s.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		s.tokenURI,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch google access token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read google token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google token request failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", errors.New("google token response has no access_token")
+	}
+	s.token = token.AccessToken
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// assertion returns a signed JWT requesting the cloud-platform scope.
+func (s *googleTokenSource) assertion(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   s.email,
+		"scope": googleCloudScope,
+		"aud":   s.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign google token request: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,81 @@
+package hydra
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// writeServiceAccount writes a service account key file using tokenURI.
+func writeServiceAccount(t *testing.T, tokenURI string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "proxy@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	path := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write service account: %v", err)
+	}
+	return path
+}
+
+func TestGoogleTokenSource(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_ = r.ParseForm()
+		assertion := r.PostForm.Get("assertion")
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" ||
+			strings.Count(assertion, ".") != 2 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.token","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	source, err := loadGoogleServiceAccount(writeServiceAccount(t, ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range 2 {
+		token, err := source.Token(t.Context())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token != "ya29.token" {
+			t.Errorf("expected ya29.token, got %q", token)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected the token to be cached, got %d token requests", got)
+	}
+}
+
+func TestLoadGoogleServiceAccount_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user.json")
+	_ = os.WriteFile(path, []byte(`{"type":"authorized_user"}`), 0o600)
+	if _, err := loadGoogleServiceAccount(path); err == nil {
+		t.Error("expected error for a non service account file")
+	}
+}
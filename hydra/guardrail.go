@@ -0,0 +1,184 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a request is shed.
+const (
+	shedMemory      = "memory"      // server.max_buffered_bytes reached
+	shedConnections = "connections" // server.max_upstream_conns reached
+)
+
+var (
+	bufferedBytesGauge = metrics.Gauge(
+		"hydrallm_buffered_request_bytes",
+		"Bytes of request bodies buffered for requests in flight.",
+	)
+	bufferedBytesLimitGauge = metrics.Gauge(
+		"hydrallm_buffered_request_bytes_limit",
+		"The server's max_buffered_bytes, 0 for no limit.",
+	)
+	upstreamConnsGauge = metrics.Gauge(
+		"hydrallm_upstream_connections",
+		"Open connections to upstream providers.",
+	)
+	upstreamConnsLimitGauge = metrics.Gauge(
+		"hydrallm_upstream_connections_limit",
+		"The server's max_upstream_conns, 0 for no limit.",
+	)
+	shedRequestsCounter = metrics.Counter(
+		"hydrallm_shed_requests_total",
+		"Requests answered with 503 because a server budget was used up, by listener and reason.",
+	)
+)
+
+// bufferedBytes and upstreamConns are the process-wide budgets of
+// server.max_buffered_bytes and server.max_upstream_conns.
+var (
+	bufferedBytes = &budget{gauge: bufferedBytesGauge, limitGauge: bufferedBytesLimitGauge}
+	upstreamConns = &budget{gauge: upstreamConnsGauge, limitGauge: upstreamConnsLimitGauge}
+)
+
+// budget tracks the use of a resource against a limit, 0 for none.
+type budget struct {
+	limit      atomic.Int64
+	used       atomic.Int64
+	gauge      Gauge
+	limitGauge Gauge
+}
+
+func (b *budget) setLimit(limit int64) {
+	b.limit.Store(limit)
+	b.limitGauge.Set(float64(limit))
+}
+
+// reserve takes n from the budget, unless that would exceed the limit.
+func (b *budget) reserve(n int64) bool {
+	used := b.used.Add(n)
+	if limit := b.limit.Load(); limit > 0 && used > limit {
+		b.used.Add(-n)
+		return false
+	}
+	b.gauge.Set(float64(used))
+	return true
+}
+
+// release returns n to the budget.
+func (b *budget) release(n int64) {
+	b.gauge.Set(float64(b.used.Add(-n)))
+}
+
+// fits reports whether n more would stay within the limit.
+func (b *budget) fits(n int64) bool {
+	limit := b.limit.Load()
+	return limit == 0 || b.used.Load()+n <= limit
+}
+
+// setGuardrails applies the server's budgets.
+func setGuardrails(s ServerConfig) {
+	bufferedBytes.setLimit(s.MaxBufferedBytes)
+	upstreamConns.setLimit(int64(s.MaxUpstreamConns))
+}
+
+// reserveBody takes a request body of n bytes from the buffered bytes budget.
+// The returned function gives it back once, so it can be called both on
+// error and when the response body is closed.
+func reserveBody(n int64) (func(), bool) {
+	b := bufferedBytes
+	if !b.reserve(n) {
+		return nil, false
+	}
+	var once sync.Once
+	return func() { once.Do(func() { b.release(n) }) }, true
+}
+
+// countingDial wraps dial, or the default dialer when nil, so every open
+// upstream connection counts against the connection budget until it closes.
+func countingDial(
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		// Connections are counted, never refused: requests are shed before they start
+		b := upstreamConns
+		b.gauge.Set(float64(b.used.Add(1)))
+		return &countedConn{Conn: conn, budget: b}, nil
+	}
+}
+
+// countedConn gives its connection back to the budget when closed.
+type countedConn struct {
+	net.Conn
+	budget *budget
+	once   sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.budget.release(1) })
+	return c.Conn.Close()
+}
+
+// upstreamConnsAvailable reports whether a new request may open upstream
+// connections. Once the budget is used up, idle connections are closed to
+// make room before the request is shed.
+func (t *RetryTransport) upstreamConnsAvailable() bool {
+	if upstreamConns.fits(1) {
+		return true
+	}
+	t.client.CloseIdleConnections()
+	t.proxied.Range(func(_, c any) bool {
+		c.(*http.Client).CloseIdleConnections()
+		return true
+	})
+	return upstreamConns.fits(1)
+}
+
+// shedResponse is the 503 error of a request shed because a server budget
+// was used up, in the listener's API format.
+func shedResponse(req *http.Request, l *Listener, reason string) *http.Response {
+	message := "server is out of memory budget for request bodies, retry later"
+	if reason == shedConnections {
+		message = "server is out of upstream connections, retry later"
+	}
+	var body any
+	switch l.ConfigType {
+	case "anthropic":
+		body = map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": "overloaded_error", "message": message},
+		}
+	case "gemini":
+		body = map[string]any{
+			"error": map[string]any{
+				"code":    http.StatusServiceUnavailable,
+				"message": message,
+				"status":  "UNAVAILABLE",
+			},
+		}
+	default:
+		body = map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    "server_error",
+				"code":    "overloaded",
+			},
+		}
+	}
+	data, _ := json.Marshal(body)
+	resp := jsonResponse(req, http.StatusServiceUnavailable, data)
+	resp.Header.Set("Retry-After", "1")
+	return resp
+}
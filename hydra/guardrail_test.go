@@ -0,0 +1,157 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func newGuardrailTransport(t *testing.T, name string, handler http.HandlerFunc) *RetryTransport {
+	t.Helper()
+	upstream := httptest.NewServer(handler)
+	t.Cleanup(upstream.Close)
+	l := &Listener{
+		Name:       name,
+		ConfigType: "anthropic",
+		ResolvedModels: []Model{{
+			ID:       "main",
+			Provider: "main",
+			Model:    "claude",
+			Type:     "anthropic",
+			Attempts: 1,
+			Timeout:  5 * time.Second,
+		}},
+	}
+	providers := map[string]Provider{
+		"main": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: 5 * time.Second}
+	return newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+}
+
+// useBudgets gives a test budgets of its own, apart from the requests and
+// connections other tests left open.
+func useBudgets(t *testing.T, s ServerConfig) {
+	t.Helper()
+	prevBytes, prevConns := bufferedBytes, upstreamConns
+	bufferedBytes = &budget{gauge: bufferedBytesGauge, limitGauge: bufferedBytesLimitGauge}
+	upstreamConns = &budget{gauge: upstreamConnsGauge, limitGauge: upstreamConnsLimitGauge}
+	setGuardrails(s)
+	t.Cleanup(func() {
+		bufferedBytes, upstreamConns = prevBytes, prevConns
+		setGuardrails(ServerConfig{})
+	})
+}
+
+func TestTransport_RoundTrip_MaxBufferedBytes(t *testing.T) {
+	useBudgets(t, ServerConfig{MaxBufferedBytes: 64})
+	handler := func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte(`{"ok":true}`)) }
+	transport := newGuardrailTransport(t, "guardrail-memory", handler)
+	shedBefore := metrics.value(
+		"hydrallm_shed_requests_total", "listener", "guardrail-memory", "reason", shedMemory,
+	)
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(
+		http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude"}`),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 within the budget, got %d", resp.StatusCode)
+	}
+	if got := bufferedBytes.used.Load(); got != int64(len(`{"model":"claude"}`)) {
+		t.Errorf("expected the body held until the response is closed, got %d bytes", got)
+	}
+	_ = resp.Body.Close()
+	if got := bufferedBytes.used.Load(); got != 0 {
+		t.Errorf("expected the body released, got %d bytes", got)
+	}
+
+	large := `{"model":"` + strings.Repeat("x", 64) + `"}`
+	resp, err = transport.RoundTrip(
+		httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(large)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusServiceUnavailable ||
+		gjson.GetBytes(body, "error.type").String() != "overloaded_error" ||
+		resp.Header.Get("Retry-After") == "" {
+		t.Errorf("expected a 503 overloaded_error, got %d: %s", resp.StatusCode, body)
+	}
+	got := metrics.value(
+		"hydrallm_shed_requests_total", "listener", "guardrail-memory", "reason", shedMemory,
+	)
+	if got-shedBefore != 1 {
+		t.Errorf("expected 1 shed request, got %v", got-shedBefore)
+	}
+}
+
+func TestTransport_RoundTrip_MaxUpstreamConns(t *testing.T) {
+	useBudgets(t, ServerConfig{MaxUpstreamConns: 1})
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: start\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+	}
+	transport := newGuardrailTransport(t, "guardrail-conns", handler)
+	// waitFor polls until the transport puts a finished connection back
+	waitFor := func(done func() bool) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			if done() {
+				return true
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return false
+	}
+	send := func() *http.Response {
+		t.Helper()
+		resp, err := transport.RoundTrip(httptest.NewRequest(
+			http.MethodPost, "/v1/messages", strings.NewReader(`{"stream":true}`),
+		))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	streaming := send()
+	if streaming.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 within the budget, got %d", streaming.StatusCode)
+	}
+	shed := send()
+	_ = shed.Body.Close()
+	if shed.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the connection is in use, got %d", shed.StatusCode)
+	}
+
+	// An idle connection makes room for the next request
+	_, _ = io.ReadAll(streaming.Body)
+	_ = streaming.Body.Close()
+	if !waitFor(transport.upstreamConnsAvailable) {
+		t.Fatal("expected the idle connection closed to make room")
+	}
+	resp := send()
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 once the connection is idle, got %d", resp.StatusCode)
+	}
+	released := waitFor(func() bool {
+		transport.client.CloseIdleConnections()
+		return upstreamConns.used.Load() == 0
+	})
+	if !released {
+		t.Errorf("expected closed connections released, got %d", upstreamConns.used.Load())
+	}
+}
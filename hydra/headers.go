@@ -0,0 +1,66 @@
+package hydra
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// alwaysForwardedHeaders describe the body and the accepted response, or carry
+// the request ID, so a forward list never drops them.
+var alwaysForwardedHeaders = []string{"Content-Type", "Accept", requestIDHeader}
+
+// HeaderPolicy decides which client headers reach an upstream and adds static
+// ones. A listener's policy applies first, then the provider's.
+type HeaderPolicy struct {
+	Strip   []string          `mapstructure:"strip"`   // Client headers never forwarded
+	Forward []string          `mapstructure:"forward"` // Only these client headers, when set
+	Set     map[string]string `mapstructure:"set"`     // Added to every request, $ENV expanded
+}
+
+// enabled reports whether the policy changes anything.
+func (p HeaderPolicy) enabled() bool {
+	return len(p.Strip) > 0 || len(p.Forward) > 0 || len(p.Set) > 0
+}
+
+// validate rejects header names that cannot be sent.
+func (p HeaderPolicy) validate() error {
+	names := slices.Concat(p.Strip, p.Forward)
+	for name := range p.Set {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	return nil
+}
+
+// applyHeaderPolicies filters the client headers of an upstream request and
+// adds the static ones. Credentials configured for the provider are set
+// afterwards, so stripping Authorization only drops the client's.
+func applyHeaderPolicies(h http.Header, policies ...HeaderPolicy) {
+	for _, p := range policies {
+		for _, name := range p.Strip {
+			h.Del(name)
+		}
+		if len(p.Forward) > 0 {
+			keep := make(map[string]bool, len(p.Forward)+len(alwaysForwardedHeaders))
+			for _, name := range slices.Concat(p.Forward, alwaysForwardedHeaders) {
+				keep[http.CanonicalHeaderKey(name)] = true
+			}
+			for name := range h {
+				if !keep[http.CanonicalHeaderKey(name)] {
+					delete(h, name)
+				}
+			}
+		}
+	}
+	for _, p := range policies {
+		for name, value := range p.Set {
+			h.Set(name, resolveEnvOrValue(value))
+		}
+	}
+}
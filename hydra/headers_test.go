@@ -0,0 +1,151 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestApplyHeaderPolicies(t *testing.T) {
+	t.Setenv("HYDRALLM_TEST_TITLE", "HydraLLM")
+	client := func() http.Header {
+		return http.Header{
+			"Authorization":       {"Bearer client"},
+			"Cookie":              {"session=1"},
+			"Content-Type":        {"application/json"},
+			"Openai-Organization": {"org-1"},
+			"User-Agent":          {"sdk/1.0"},
+			"X-Request-Id":        {"req-1"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		policies []HeaderPolicy
+		present  []string
+		absent   []string
+	}{
+		{
+			"no policy forwards all",
+			nil,
+			[]string{"Authorization", "Cookie", "User-Agent"},
+			nil,
+		},
+		{
+			"strip",
+			[]HeaderPolicy{{Strip: []string{"authorization", "Cookie"}}},
+			[]string{"User-Agent", "OpenAI-Organization"},
+			[]string{"Authorization", "Cookie"},
+		},
+		{
+			"forward only listed",
+			[]HeaderPolicy{{Forward: []string{"OpenAI-Organization"}}},
+			[]string{"OpenAI-Organization", "Content-Type", "X-Request-ID"},
+			[]string{"Authorization", "Cookie", "User-Agent"},
+		},
+		{
+			"provider strips after listener forwards",
+			[]HeaderPolicy{
+				{Forward: []string{"OpenAI-Organization", "User-Agent"}},
+				{Strip: []string{"OpenAI-Organization"}},
+			},
+			[]string{"User-Agent"},
+			[]string{"OpenAI-Organization", "Cookie"},
+		},
+	}
+	for _, tt := range tests {
+		h := client()
+		applyHeaderPolicies(h, tt.policies...)
+		for _, name := range tt.present {
+			if h.Get(name) == "" {
+				t.Errorf("%s: expected %s forwarded", tt.name, name)
+			}
+		}
+		for _, name := range tt.absent {
+			if h.Get(name) != "" {
+				t.Errorf("%s: expected %s dropped", tt.name, name)
+			}
+		}
+	}
+
+	h := client()
+	applyHeaderPolicies(h,
+		HeaderPolicy{Set: map[string]string{"x-title": "listener", "http-referer": "https://a"}},
+		HeaderPolicy{Set: map[string]string{"X-Title": "$HYDRALLM_TEST_TITLE"}},
+	)
+	if h.Get("X-Title") != "HydraLLM" || h.Get("HTTP-Referer") != "https://a" {
+		t.Errorf("expected static headers, provider last, got %v", h)
+	}
+}
+
+func TestTransport_RoundTrip_HeaderPolicies(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	l := &Listener{
+		Name:       "headers",
+		ConfigType: "openai",
+		Headers:    HeaderPolicy{Strip: []string{"Authorization", "Cookie"}},
+		ResolvedModels: []Model{{
+			ID:       "headers-model",
+			Provider: "headers",
+			Model:    "gpt-5",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}},
+	}
+	providers := map[string]Provider{
+		"headers": {
+			URL:       upstream.URL,
+			ParsedURL: mustParseURL(upstream.URL),
+			Headers:   HeaderPolicy{Set: map[string]string{"X-Title": "HydraLLM"}},
+		},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer client")
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("User-Agent", "sdk/1.0")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if got.Get("Authorization") != "" || got.Get("Cookie") != "" {
+		t.Errorf("expected client credentials stripped, got %v", got)
+	}
+	if got.Get("User-Agent") != "sdk/1.0" || got.Get("X-Title") != "HydraLLM" {
+		t.Errorf("expected forwarded and static headers, got %v", got)
+	}
+
+	// A provider key is still sent when the client's is stripped
+	providers["headers"] = Provider{
+		URL:       upstream.URL,
+		APIKey:    "provider-key",
+		ParsedURL: mustParseURL(upstream.URL),
+	}
+	transport = newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer client")
+	resp, err = transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if got.Get("Authorization") != "Bearer provider-key" {
+		t.Errorf("expected the provider key, got %q", got.Get("Authorization"))
+	}
+}
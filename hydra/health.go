@@ -0,0 +1,111 @@
+package hydra
+
+import (
+	"sync"
+	"time"
+)
+
+// latencySmoothing is the weight of the newest sample in the latency and error
+// rate averages.
+const latencySmoothing = 0.2
+
+// modelHealth records the outcome of upstream attempts.
+var modelHealth = newHealthTracker()
+
+// ModelHealth is the recent upstream behavior of one configured model.
+type ModelHealth struct {
+	Attempts            int64      `json:"attempts"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	LastStatus          int        `json:"last_status,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LatencyMS           float64    `json:"latency_ms"` // Moving average of successful attempts
+	ErrorRate           float64    `json:"error_rate"` // Moving average of failed attempts
+}
+
+type healthTracker struct {
+	mu     sync.RWMutex
+	models map[string]ModelHealth // Keyed by model ID
+	path   string                 // State file, empty when not persisted
+	dirty  bool                   // Changed since the last save
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{models: make(map[string]ModelHealth)}
+}
+
+// recordSuccess records an attempt that got a non-retryable response.
+func (h *healthTracker) recordSuccess(modelID string, status int, latency time.Duration) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m := h.models[modelID]
+	m.ErrorRate = smoothed(m.ErrorRate, 0, m.Attempts)
+	m.Attempts++
+	m.ConsecutiveFailures = 0
+	m.LastStatus = status
+	m.LastSuccessAt = &now
+	ms := float64(latency) / float64(time.Millisecond)
+	if m.LatencyMS == 0 {
+		m.LatencyMS = ms
+	} else {
+		m.LatencyMS += latencySmoothing * (ms - m.LatencyMS)
+	}
+	h.models[modelID] = m
+	h.dirty = true
+}
+
+// recordFailure records an attempt that failed or got a retryable response.
+// status is zero when no response was received.
+func (h *healthTracker) recordFailure(modelID string, status int, errMsg string) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m := h.models[modelID]
+	m.ErrorRate = smoothed(m.ErrorRate, 1, m.Attempts)
+	m.Attempts++
+	m.Failures++
+	m.ConsecutiveFailures++
+	m.LastError = errMsg
+	m.LastErrorAt = &now
+	if status != 0 {
+		m.LastStatus = status
+	}
+	h.models[modelID] = m
+	h.dirty = true
+}
+
+// smoothed adds sample to a moving average of attempts earlier samples.
+func smoothed(average, sample float64, attempts int64) float64 {
+	if attempts == 0 {
+		return sample
+	}
+	return average + latencySmoothing*(sample-average)
+}
+
+// get returns the recorded health of a model.
+func (h *healthTracker) get(modelID string) ModelHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.models[modelID]
+}
+
+// healthState summarizes a model's health for status output.
+// A model is failing after consecutive failures and saturated while its
+// provider asked clients to back off.
+func healthState(m ModelHealth, quota ProviderQuota, now time.Time) string {
+	switch {
+	case quota.Saturated(now):
+		return "saturated"
+	case m.ConsecutiveFailures > 0:
+		return "failing"
+	case m.Attempts == 0:
+		return "unknown"
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,60 @@
+package hydra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthTracker(t *testing.T) {
+	h := newHealthTracker()
+
+	h.recordFailure("m1", 0, "connection refused")
+	h.recordFailure("m1", 503, "Service Unavailable")
+	got := h.get("m1")
+	if got.Attempts != 2 || got.Failures != 2 || got.ConsecutiveFailures != 2 {
+		t.Errorf("unexpected counts after failures: %+v", got)
+	}
+	if got.LastStatus != 503 || got.LastError != "Service Unavailable" || got.LastErrorAt == nil {
+		t.Errorf("unexpected last error: %+v", got)
+	}
+
+	h.recordSuccess("m1", 200, 100*time.Millisecond)
+	h.recordSuccess("m1", 200, 200*time.Millisecond)
+	got = h.get("m1")
+	if got.ConsecutiveFailures != 0 || got.Failures != 2 || got.Attempts != 4 {
+		t.Errorf("unexpected counts after success: %+v", got)
+	}
+	// 100ms + 0.2 * (200ms - 100ms)
+	if got.LatencyMS != 120 {
+		t.Errorf("expected latency 120ms, got %v", got.LatencyMS)
+	}
+}
+
+func TestHealthState(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		health ModelHealth
+		quota  ProviderQuota
+		want   string
+	}{
+		{"no attempts", ModelHealth{}, ProviderQuota{}, "unknown"},
+		{"healthy", ModelHealth{Attempts: 3}, ProviderQuota{}, "ok"},
+		{"failing", ModelHealth{Attempts: 3, ConsecutiveFailures: 1}, ProviderQuota{}, "failing"},
+		{
+			"saturated",
+			ModelHealth{Attempts: 3},
+			ProviderQuota{SaturatedUntil: &later},
+			"saturated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthState(tt.health, tt.quota, now); got != tt.want {
+				t.Errorf("healthState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package hydra
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	healthCheckTick             = time.Second     // How often due checks are started
+	defaultHealthCheckTimeout   = 5 * time.Second // Per probe
+	defaultHealthCheckThreshold = 2               // Failed probes before eviction
+)
+
+// providerChecks holds the results of background provider health checks.
+var providerChecks = newHealthCheckTracker()
+
+var providerHealthyGauge = metrics.Gauge(
+	"hydrallm_provider_healthy",
+	"Whether the provider passes its health check (1) or is evicted (0).",
+)
+
+// HealthCheckConfig configures periodic probes of a provider. Checks are
+// disabled unless an interval is set.
+type HealthCheckConfig struct {
+	Path             string        `mapstructure:"path"`              // Default: model list
+	Interval         time.Duration `mapstructure:"interval"`          // Time between probes
+	Timeout          time.Duration `mapstructure:"timeout"`           // Per probe, default 5s
+	FailureThreshold int           `mapstructure:"failure_threshold"` // Default 2
+}
+
+// ProviderCheckState is the health check state of a provider.
+type ProviderCheckState struct {
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastCheckAt         time.Time  `json:"last_check_at"`
+	LastResult          string     `json:"last_result"`
+	EvictedAt           *time.Time `json:"evicted_at,omitempty"`
+}
+
+type healthCheckTracker struct {
+	mu     sync.RWMutex
+	states map[string]ProviderCheckState
+}
+
+func newHealthCheckTracker() *healthCheckTracker {
+	return &healthCheckTracker{states: make(map[string]ProviderCheckState)}
+}
+
+// record applies a probe result. A provider is evicted after threshold
+// consecutive failures and included again after its first passing probe.
+// It reports whether the provider's health changed.
+func (h *healthCheckTracker) record(provider string, check ProviderCheck, threshold int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state, seen := h.states[provider]
+	wasHealthy := !seen || state.Healthy
+	state.LastCheckAt = time.Now()
+	state.LastResult = check.Detail
+	if check.OK {
+		state.ConsecutiveFailures = 0
+		state.Healthy = true
+	} else {
+		state.ConsecutiveFailures++
+		state.Healthy = state.ConsecutiveFailures < threshold
+	}
+	if wasHealthy && !state.Healthy {
+		evictedAt := state.LastCheckAt
+		state.EvictedAt = &evictedAt
+	} else if state.Healthy {
+		state.EvictedAt = nil
+	}
+	h.states[provider] = state
+
+	healthy := 0.0
+	if state.Healthy {
+		healthy = 1
+	}
+	providerHealthyGauge.Set(healthy, "provider", provider)
+	return wasHealthy != state.Healthy
+}
+
+// healthy reports whether a provider may receive requests. Providers without
+// checks are always healthy.
+func (h *healthCheckTracker) healthy(provider string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	state, ok := h.states[provider]
+	return !ok || state.Healthy
+}
+
+// forget drops the state of providers whose checks were removed.
+func (h *healthCheckTracker) forget(keep func(provider string) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for provider := range h.states {
+		if !keep(provider) {
+			delete(h.states, provider)
+			providerHealthyGauge.Set(1, "provider", provider)
+		}
+	}
+}
+
+// snapshot returns a copy of the current check state by provider.
+func (h *healthCheckTracker) snapshot() map[string]ProviderCheckState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return maps.Clone(h.states)
+}
+
+// healthyModels removes the models of evicted providers from a chain. When
+// every model is evicted the chain is kept whole, so requests still try them.
+func healthyModels(models []Model) []Model {
+	healthy := make([]Model, 0, len(models))
+	for _, m := range models {
+		if providerChecks.healthy(m.Provider) {
+			healthy = append(healthy, m)
+		}
+	}
+	if len(healthy) == 0 {
+		return models
+	}
+	return healthy
+}
+
+// runHealthChecks probes every provider with a health_check interval until
+// ctx is done. The config is read on every tick, so reloads take effect.
+func runHealthChecks(ctx context.Context, config func() *Config, logger *log.Logger) {
+	cfg := config()
+	transport := NewRetryTransport(nil, cfg.Providers, cfg.Retry, cfg.Log, logger)
+	next := make(map[string]time.Time)
+	var running sync.Map // Providers with a probe in flight
+
+	ticker := time.NewTicker(healthCheckTick)
+	defer ticker.Stop()
+	for {
+		cfg = config()
+		types := providerTypes(cfg)
+		providerChecks.forget(func(name string) bool {
+			return cfg.Providers[name].HealthCheck.Interval > 0
+		})
+
+		now := time.Now()
+		for name, p := range cfg.Providers {
+			hc := p.HealthCheck
+			if hc.Interval <= 0 || now.Before(next[name]) {
+				continue
+			}
+			if _, busy := running.LoadOrStore(name, true); busy {
+				continue
+			}
+			next[name] = now.Add(hc.Interval)
+
+			go func() {
+				defer running.Delete(name)
+				probeCtx, cancel := context.WithTimeout(
+					ctx,
+					cmp.Or(hc.Timeout, defaultHealthCheckTimeout),
+				)
+				check := transport.probeProvider(probeCtx, name, p, types[name], hc.Path)
+				cancel()
+				if ctx.Err() != nil {
+					return
+				}
+
+				threshold := cmp.Or(hc.FailureThreshold, defaultHealthCheckThreshold)
+				evictedAt := providerChecks.snapshot()[name].EvictedAt
+				if !providerChecks.record(name, check, threshold) {
+					logger.Debug("provider health check", "provider", name, "result", check.Detail)
+				} else if providerChecks.healthy(name) {
+					logger.Info("provider recovered, including its models", "provider", name)
+					event := FailoverEvent{
+						Kind:     EventRecovered,
+						Provider: name,
+						Cause:    check.Detail,
+					}
+					if evictedAt != nil {
+						event.SkippedMS = time.Since(*evictedAt).Milliseconds()
+					}
+					failoverEvents.add(event)
+				} else {
+					failoverEvents.add(FailoverEvent{
+						Kind:     EventEvicted,
+						Provider: name,
+						Cause:    check.Detail,
+					})
+					logger.Warn(
+						"provider failed health checks, evicting its models",
+						"provider",
+						name,
+						"result",
+						check.Detail,
+					)
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
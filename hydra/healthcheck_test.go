@@ -0,0 +1,101 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestHealthCheckTrackerRecord(t *testing.T) {
+	h := newHealthCheckTracker()
+	fail, pass := ProviderCheck{Detail: "server error"}, ProviderCheck{OK: true}
+
+	steps := []struct {
+		check   ProviderCheck
+		healthy bool
+		changed bool
+	}{
+		{fail, true, false},
+		{fail, false, true},
+		{fail, false, false},
+		{pass, true, true},
+	}
+	for i, s := range steps {
+		changed := h.record("p1", s.check, 2)
+		if changed != s.changed || h.healthy("p1") != s.healthy {
+			t.Errorf("step %d: expected healthy=%v changed=%v, got healthy=%v changed=%v",
+				i, s.healthy, s.changed, h.healthy("p1"), changed)
+		}
+		if evicted := h.snapshot()["p1"].EvictedAt != nil; evicted == s.healthy {
+			t.Errorf("step %d: expected evicted_at set only while evicted", i)
+		}
+	}
+	if !h.healthy("unchecked") {
+		t.Error("expected providers without checks to be healthy")
+	}
+}
+
+func TestHealthyModels(t *testing.T) {
+	providerChecks.record("evicted-test", ProviderCheck{}, 1)
+	defer providerChecks.forget(func(name string) bool { return name != "evicted-test" })
+
+	chain := []Model{{ID: "a", Provider: "evicted-test"}, {ID: "b", Provider: "fine-test"}}
+	if got := modelIDs(healthyModels(chain)); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("expected evicted model removed, got %v", got)
+	}
+	// A chain of only evicted models is kept
+	if got := healthyModels(chain[:1]); len(got) != 1 {
+		t.Errorf("expected the whole chain kept, got %v", modelIDs(got))
+	}
+}
+
+func TestRunHealthChecks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	cfg := &Config{
+		Providers: map[string]Provider{
+			"health-run-test": {
+				URL:       ts.URL,
+				ParsedURL: mustParseURL(ts.URL),
+				HealthCheck: HealthCheckConfig{
+					Path:             "/healthz",
+					Interval:         time.Hour,
+					FailureThreshold: 1,
+				},
+			},
+		},
+	}
+	defer providerChecks.forget(func(name string) bool { return name != "health-run-test" })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runHealthChecks(ctx, func() *Config { return cfg }, log.New(io.Discard))
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for providerChecks.healthy("health-run-test") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	state, ok := providerChecks.snapshot()["health-run-test"]
+	if !ok || state.Healthy || state.ConsecutiveFailures != 1 {
+		t.Errorf("expected the provider evicted after one failed probe, got %+v", state)
+	}
+}
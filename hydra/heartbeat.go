@@ -0,0 +1,115 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Listener stream_heartbeats modes, applied to the keep-alive events of streams.
+const (
+	streamHeartbeatsPass = "pass" // Forward heartbeats as they arrive
+	streamHeartbeatsDrop = "drop" // Remove heartbeats from the stream
+)
+
+func isSupportedStreamHeartbeats(mode string) bool {
+	switch mode {
+	case streamHeartbeatsPass, streamHeartbeatsDrop:
+		return true
+	default:
+		return false
+	}
+}
+
+// sseFields returns the field lines of an event, leaving out comments.
+func sseFields(block []byte) [][]byte {
+	var fields [][]byte
+	for line := range bytes.SplitSeq(block, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) > 0 && line[0] != ':' {
+			fields = append(fields, line)
+		}
+	}
+	return fields
+}
+
+// isHeartbeat reports whether the fields of an event only keep the stream
+// alive: a comment-only event, or an Anthropic ping.
+func isHeartbeat(fields [][]byte) bool {
+	if len(fields) == 0 {
+		return true
+	}
+	var data []byte
+	for _, line := range fields {
+		name, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(name) {
+		case "event":
+			if string(value) != "ping" {
+				return false
+			}
+		case "data":
+			data = append(data, value...)
+		}
+	}
+	return len(data) == 0 || gjson.GetBytes(data, "type").String() == "ping"
+}
+
+// dropHeartbeats removes the heartbeats of a successful event stream response
+// when the listener drops them. Continuations are filtered by the stream they
+// continue.
+func dropHeartbeats(ctx context.Context, resp *http.Response, mode string) {
+	if mode != streamHeartbeatsDrop || ctx.Value(continuationContextKey{}) != nil ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	resp.Body = &heartbeatFilter{src: resp.Body, chunk: make([]byte, 4096)}
+}
+
+// heartbeatFilter forwards a server-sent event stream without its heartbeats.
+type heartbeatFilter struct {
+	src     io.ReadCloser
+	raw     bytes.Buffer // Upstream bytes not yet forming a complete event
+	pending bytes.Buffer // Bytes ready for the client
+	chunk   []byte
+	err     error
+}
+
+func (f *heartbeatFilter) Read(p []byte) (int, error) {
+	for f.pending.Len() == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		n, err := f.src.Read(f.chunk)
+		f.raw.Write(f.chunk[:n])
+		for {
+			b := f.raw.Bytes()
+			end, sep := bytes.Index(b, []byte("\n\n")), 2
+			if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 && (end < 0 || i < end) {
+				end, sep = i, 4
+			}
+			if end < 0 {
+				break
+			}
+			if !isHeartbeat(sseFields(b[:end])) {
+				f.pending.Write(b[:end+sep])
+			}
+			f.raw.Next(end + sep)
+		}
+		if err != nil {
+			// A trailing partial event is forwarded as the upstream sent it
+			f.pending.Write(f.raw.Bytes())
+			f.raw.Reset()
+			f.err = err
+		}
+	}
+	return f.pending.Read(p)
+}
+
+func (f *heartbeatFilter) Close() error {
+	return f.src.Close()
+}
@@ -0,0 +1,59 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestIsHeartbeat(t *testing.T) {
+	tests := []struct {
+		event    string
+		expected bool
+	}{
+		{": keep-alive", true},
+		{": OPENROUTER PROCESSING", true},
+		{"event: ping\ndata: {\"type\": \"ping\"}", true},
+		{"data: {\"type\":\"ping\"}", true},
+		{"event: ping", true},
+		{"event: message_start\ndata: {\"type\":\"message_start\"}", false},
+		{"data: {\"choices\":[]}", false},
+		{"data: [DONE]", false},
+	}
+	for _, tt := range tests {
+		if got := isHeartbeat(sseFields([]byte(tt.event))); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.event, tt.expected, got)
+		}
+	}
+}
+
+func TestDropHeartbeats(t *testing.T) {
+	stream := ": keep-alive\n\nevent: ping\r\ndata: {\"type\": \"ping\"}\r\n\r\n" +
+		"event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n" +
+		"data: [DONE]\n\ndata: {\"partial\""
+	expected := "event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+		"data: [DONE]\n\ndata: {\"partial\""
+
+	for _, mode := range []string{streamHeartbeatsPass, streamHeartbeatsDrop} {
+		resp := &http.Response{
+			Header: http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:   io.NopCloser(iotest.OneByteReader(strings.NewReader(stream))),
+		}
+		dropHeartbeats(context.Background(), resp, mode)
+		got, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		want := stream
+		if mode == streamHeartbeatsDrop {
+			want = expected
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected %q, got %q", mode, want, got)
+		}
+	}
+}
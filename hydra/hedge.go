@@ -0,0 +1,152 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+var hedgedRequestsCounter = metrics.Counter(
+	"hydrallm_hedged_requests_total",
+	"Attempts raced against the next model, by listener and winner (primary, hedge, or none).",
+)
+
+// hedgeResult is the outcome of one request in a hedged race.
+type hedgeResult struct {
+	idx  int
+	resp *http.Response
+	err  error
+}
+
+// usable reports whether a raced response can be returned as it is: it
+// succeeded, or failed in a way another model would not fix.
+func (r hedgeResult) usable(model Model) bool {
+	return r.err == nil &&
+		(r.resp.StatusCode < 400 || classifyResponse(model.Type, r.resp).Action == actionAbort)
+}
+
+// discard closes the response of a request that lost the race.
+func (r hedgeResult) discard() {
+	if r.resp != nil {
+		_, _ = io.Copy(io.Discard, r.resp.Body)
+		_ = r.resp.Body.Close()
+	}
+}
+
+// cancelOnClose cancels the context of a winning request once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// tryHedged sends a non-streaming request to primary and, if no response
+// arrives within delay and the hedge's provider has a free slot, to hedge as
+// well. The first usable response wins and
+// the other request is canceled. When neither is usable the primary's outcome
+// is returned, so the retry loop handles it as a plain attempt. The model that
+// served the returned response is returned with it.
+func (t *RetryTransport) tryHedged(
+	ctx context.Context,
+	req *http.Request,
+	body []byte,
+	primary Model,
+	hedge Model,
+	delay time.Duration,
+	debugEnabled bool,
+	state *transportState,
+) (Model, *http.Response, error) {
+	models := [2]Model{primary, hedge}
+	var cancels [2]context.CancelFunc
+	results := make(chan hedgeResult, len(models))
+	start := func(i int, release func()) {
+		raceCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func() {
+			resp, err := t.tryModel(raceCtx, req, body, models[i], false, debugEnabled, state)
+			if err != nil {
+				release()
+			} else {
+				resp.Body = releaseOnClose{ReadCloser: resp.Body, release: release}
+			}
+			results <- hedgeResult{idx: i, resp: resp, err: err}
+		}()
+	}
+	finish := func(r hedgeResult) (Model, *http.Response, error) {
+		if r.err != nil {
+			cancels[r.idx]()
+			return models[r.idx], nil, r.err
+		}
+		r.resp.Body = cancelOnClose{ReadCloser: r.resp.Body, cancel: cancels[r.idx]}
+		return models[r.idx], r.resp, nil
+	}
+
+	start(0, func() {})
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return finish(r)
+	case <-timer.C:
+	}
+
+	// The hedge takes a slot of its provider's max_concurrency like a batch
+	// request: it is not sent rather than queued when the provider is full
+	listener := state.listener.Name
+	limit := state.providers[hedge.Provider].RateLimit
+	release, err := providerSlots.acquire(ctx, hedge.Provider, limit, priorityBatch)
+	if err != nil {
+		saturationSkipsCounter.Inc("provider", hedge.Provider, "priority", priorityBatch)
+		return finish(<-results)
+	}
+	t.logger.Debug(
+		"hedging request",
+		"provider",
+		primary.Provider,
+		"model",
+		primary.Model,
+		"hedge_provider",
+		hedge.Provider,
+		"hedge_model",
+		hedge.Model,
+	)
+	start(1, release)
+
+	first := <-results
+	if first.usable(models[first.idx]) {
+		loser := 1 - first.idx
+		cancels[loser]()
+		go func() { (<-results).discard() }()
+		hedgedRequestsCounter.Inc("listener", listener, "winner", hedgeWinner(first.idx))
+		return finish(first)
+	}
+
+	second := <-results
+	if second.usable(models[second.idx]) {
+		first.discard()
+		cancels[first.idx]()
+		hedgedRequestsCounter.Inc("listener", listener, "winner", hedgeWinner(second.idx))
+		return finish(second)
+	}
+
+	hedgedRequestsCounter.Inc("listener", listener, "winner", "none")
+	if first.idx != 0 {
+		first, second = second, first
+	}
+	second.discard()
+	cancels[second.idx]()
+	return finish(first)
+}
+
+func hedgeWinner(idx int) string {
+	if idx == 0 {
+		return "primary"
+	}
+	return "hedge"
+}
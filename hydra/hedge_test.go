@@ -0,0 +1,193 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// hedgeServer answers after delay with status, or gives up when the request
+// is canceled, which it records.
+func hedgeServer(
+	delay time.Duration,
+	status int,
+	requests, canceled *atomic.Int32,
+) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// Client disconnects are only noticed once the body has been read
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-time.After(delay):
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"id":"` + http.StatusText(status) + `"}`))
+		case <-r.Context().Done():
+			canceled.Add(1)
+		}
+	}))
+}
+
+func newHedgeTransport(primary, hedge *httptest.Server, delay time.Duration) *RetryTransport {
+	model := func(id string) Model {
+		return Model{ID: id, Provider: id, Type: "openai", Attempts: 1, Timeout: 5 * time.Second}
+	}
+	listener := &Listener{
+		Name:           "hedge-main",
+		ResolvedModels: []Model{model("hedge-primary"), model("hedge-secondary")},
+		HedgeDelay:     delay,
+	}
+	providers := map[string]Provider{
+		"hedge-primary":   {URL: primary.URL, ParsedURL: mustParseURL(primary.URL)},
+		"hedge-secondary": {URL: hedge.URL, ParsedURL: mustParseURL(hedge.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	return newListenerTransport(listener, providers, retry, LogConfig{}, log.New(io.Discard))
+}
+
+func hedgeRequest(t *testing.T, transport *RetryTransport) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"m"}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	return resp, string(body)
+}
+
+func TestTransport_RoundTrip_HedgeWins(t *testing.T) {
+	var primaryReqs, primaryCanceled, hedgeReqs, hedgeCanceled atomic.Int32
+	primary := hedgeServer(5*time.Second, http.StatusOK, &primaryReqs, &primaryCanceled)
+	defer primary.Close()
+	hedge := hedgeServer(0, http.StatusCreated, &hedgeReqs, &hedgeCanceled)
+	defer hedge.Close()
+
+	start := time.Now()
+	resp, body := hedgeRequest(t, newHedgeTransport(primary, hedge, 50*time.Millisecond))
+	if resp.StatusCode != http.StatusCreated || body != `{"id":"Created"}` {
+		t.Errorf("expected the hedge response, got %d %s", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the hedge to answer quickly, took %s", elapsed)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for primaryCanceled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if primaryCanceled.Load() != 1 {
+		t.Error("expected the primary request to be canceled")
+	}
+}
+
+func TestTransport_RoundTrip_HedgeNotNeeded(t *testing.T) {
+	var primaryReqs, primaryCanceled, hedgeReqs, hedgeCanceled atomic.Int32
+	primary := hedgeServer(0, http.StatusOK, &primaryReqs, &primaryCanceled)
+	defer primary.Close()
+	hedge := hedgeServer(0, http.StatusCreated, &hedgeReqs, &hedgeCanceled)
+	defer hedge.Close()
+
+	resp, _ := hedgeRequest(t, newHedgeTransport(primary, hedge, time.Second))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the primary response, got %d", resp.StatusCode)
+	}
+	if hedgeReqs.Load() != 0 {
+		t.Errorf("expected no hedge request, got %d", hedgeReqs.Load())
+	}
+}
+
+func TestTransport_RoundTrip_HedgeBothFail(t *testing.T) {
+	var primaryReqs, primaryCanceled, hedgeReqs, hedgeCanceled atomic.Int32
+	primary := hedgeServer(100*time.Millisecond, http.StatusBadGateway, &primaryReqs, &primaryCanceled)
+	defer primary.Close()
+	hedge := hedgeServer(0, http.StatusServiceUnavailable, &hedgeReqs, &hedgeCanceled)
+	defer hedge.Close()
+
+	resp, _ := hedgeRequest(t, newHedgeTransport(primary, hedge, 10*time.Millisecond))
+	// The race returns the primary's failure, then the loop falls back to the
+	// second model, whose failure is the last response
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the last failure, got %d", resp.StatusCode)
+	}
+	if primaryReqs.Load() != 1 || hedgeReqs.Load() != 2 {
+		t.Errorf(
+			"expected 1 primary and 2 hedge model requests, got %d and %d",
+			primaryReqs.Load(),
+			hedgeReqs.Load(),
+		)
+	}
+}
+
+func TestTransport_RoundTrip_HedgeProviderFull(t *testing.T) {
+	var primaryReqs, primaryCanceled, hedgeReqs, hedgeCanceled atomic.Int32
+	primary := hedgeServer(50*time.Millisecond, http.StatusOK, &primaryReqs, &primaryCanceled)
+	defer primary.Close()
+	hedge := hedgeServer(0, http.StatusCreated, &hedgeReqs, &hedgeCanceled)
+	defer hedge.Close()
+
+	limit := RateLimit{MaxConcurrency: 1}
+	model := func(id string) Model {
+		return Model{ID: id, Provider: id, Type: "openai", Attempts: 1, Timeout: 5 * time.Second}
+	}
+	listener := &Listener{
+		Name:           "hedge-full",
+		ResolvedModels: []Model{model("hedge-full-primary"), model("hedge-full-secondary")},
+		HedgeDelay:     10 * time.Millisecond,
+	}
+	providers := map[string]Provider{
+		"hedge-full-primary": {URL: primary.URL, ParsedURL: mustParseURL(primary.URL)},
+		"hedge-full-secondary": {
+			URL:       hedge.URL,
+			ParsedURL: mustParseURL(hedge.URL),
+			RateLimit: limit,
+		},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	transport := newListenerTransport(listener, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	// With the hedge's provider full, the primary is awaited without a hedge
+	release, err := providerSlots.acquire(
+		context.Background(),
+		"hedge-full-secondary",
+		limit,
+		priorityInteractive,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, _ := hedgeRequest(t, transport)
+	release()
+	if resp.StatusCode != http.StatusOK || hedgeReqs.Load() != 0 {
+		t.Errorf("expected the primary without a hedge, got %d after %d hedge requests",
+			resp.StatusCode, hedgeReqs.Load())
+	}
+
+	// A hedge that ran frees its slot
+	resp, _ = hedgeRequest(t, transport)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected the hedge to win, got %d", resp.StatusCode)
+	}
+	release, err = providerSlots.acquire(
+		context.Background(),
+		"hedge-full-secondary",
+		limit,
+		priorityBatch,
+	)
+	if err != nil {
+		t.Fatalf("expected the hedge's slot to be free, got %v", err)
+	}
+	release()
+}
@@ -0,0 +1,293 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// keyQuotaSaveInterval is how often per-key usage is written to the state file.
+const keyQuotaSaveInterval = 10 * time.Second
+
+// keyQuotas tracks the daily usage of API keys with a quota.
+var keyQuotas = newKeyQuotaTracker()
+
+var keyQuotaRejectsCounter = metrics.Counter(
+	"hydrallm_key_quota_rejects_total",
+	"Requests rejected for an exhausted API key quota, by listener, key, and kind.",
+)
+
+// KeyQuota limits the daily use of an API key. Days start at midnight UTC.
+// Zero disables a limit.
+type KeyQuota struct {
+	RequestsPerDay int     `mapstructure:"requests_per_day"`
+	TokensPerDay   int     `mapstructure:"tokens_per_day"`
+	USDPerDay      float64 `mapstructure:"usd_per_day"` // Estimated from model prices
+}
+
+// enabled reports whether any limit is set.
+func (q KeyQuota) enabled() bool {
+	return q.RequestsPerDay > 0 || q.TokensPerDay > 0 || q.USDPerDay > 0
+}
+
+// keyUsage is the usage of an API key on one day.
+type keyUsage struct {
+	Day      string  `json:"day"` // UTC date
+	Requests int64   `json:"requests"`
+	Tokens   int64   `json:"tokens"`
+	CostUSD  float64 `json:"cost_usd"`
+}
+
+type keyQuotaTracker struct {
+	mu    sync.Mutex
+	keys  map[string]keyUsage // Keyed by listener and key name
+	path  string              // State file, empty when not persisted
+	dirty bool                // Changed since the last save
+}
+
+func newKeyQuotaTracker() *keyQuotaTracker {
+	return &keyQuotaTracker{keys: make(map[string]keyUsage)}
+}
+
+// hasKeyQuotas reports whether any API key of cfg has a quota.
+func hasKeyQuotas(cfg *Config) bool {
+	for _, l := range cfg.Listeners {
+		for _, k := range l.ResolvedAPIKeys {
+			if k.Quota.enabled() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func keyQuotaID(listener, key string) string {
+	return listener + "/" + key
+}
+
+// open loads the usage saved in the state file at path, which need not exist,
+// and saves to it from then on.
+func (t *keyQuotaTracker) open(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read quota state: %w", err)
+	}
+	keys := make(map[string]keyUsage)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return fmt.Errorf("failed to parse quota state %s: %w", path, err)
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keys = keys
+	t.path = path
+	return nil
+}
+
+// save writes the tracked usage to the state file if it changed. The file is
+// replaced atomically.
+func (t *keyQuotaTracker) save() error {
+	t.mu.Lock()
+	if t.path == "" || !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(t.keys, "", "  ")
+	path := t.path
+	t.dirty = false
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".quota-*")
+	if err != nil {
+		return fmt.Errorf("failed to save quota state: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save quota state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save quota state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save quota state: %w", err)
+	}
+	return nil
+}
+
+// persist saves the tracked usage every interval until done is closed, and
+// once more before returning.
+func (t *keyQuotaTracker) persist(
+	done <-chan struct{},
+	interval time.Duration,
+	logger *log.Logger,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			if err := t.save(); err != nil {
+				logger.Warn("failed to save quota state", "error", err)
+			}
+			return
+		}
+		if err := t.save(); err != nil {
+			logger.Warn("failed to save quota state", "error", err)
+		}
+	}
+}
+
+// today returns the usage of a key on the day of now, starting a new day
+// when the recorded one has passed. Callers hold t.mu.
+func (t *keyQuotaTracker) today(id string, now time.Time) keyUsage {
+	day := now.UTC().Format(time.DateOnly)
+	u := t.keys[id]
+	if u.Day != day {
+		u = keyUsage{Day: day}
+	}
+	return u
+}
+
+// allow counts a request of a key against its quota. It returns the exhausted
+// limit, empty when the request is allowed, and the key's usage that day.
+func (t *keyQuotaTracker) allow(
+	listener, key string,
+	quota KeyQuota,
+	now time.Time,
+) (string, keyUsage) {
+	id := keyQuotaID(listener, key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.today(id, now)
+	switch {
+	case quota.RequestsPerDay > 0 && u.Requests >= int64(quota.RequestsPerDay):
+		return "requests", u
+	case quota.TokensPerDay > 0 && u.Tokens >= int64(quota.TokensPerDay):
+		return "tokens", u
+	case quota.USDPerDay > 0 && u.CostUSD >= quota.USDPerDay:
+		return "usd", u
+	}
+	u.Requests++
+	t.keys[id] = u
+	t.dirty = true
+	return "", u
+}
+
+// consume adds the tokens and cost of a response to a key's usage. Keys
+// without a quota are not tracked.
+func (t *keyQuotaTracker) consume(listener, key string, tokens int, cost float64, now time.Time) {
+	id := keyQuotaID(listener, key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.keys[id]; !ok {
+		return
+	}
+	u := t.today(id, now)
+	u.Tokens += int64(tokens)
+	u.CostUSD += cost
+	t.keys[id] = u
+	t.dirty = true
+}
+
+// newKeyQuotaMiddleware answers requests of API keys that used up a daily
+// quota with 429. It runs after auth, which identifies the key.
+func newKeyQuotaMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	quotas := make(map[string]KeyQuota)
+	for _, k := range l.ResolvedAPIKeys {
+		if k.Quota.enabled() {
+			quotas[k.Name] = k.Quota
+		}
+	}
+	if len(quotas) == 0 {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := apiKeyName(r.Context())
+			quota, ok := quotas[key]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			kind, usage := keyQuotas.allow(l.Name, key, quota, now)
+			if kind == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			keyQuotaRejectsCounter.Inc("listener", l.Name, "key", key, "kind", kind)
+			logger.Warn(
+				"api key quota exceeded",
+				"listener",
+				l.Name,
+				"key",
+				key,
+				"kind",
+				kind,
+			)
+			writeKeyQuotaRejection(w, key, kind, quota, usage, now)
+		})
+	}
+}
+
+// writeKeyQuotaRejection answers with 429 and a body naming the exhausted
+// limit and when it resets.
+func writeKeyQuotaRejection(
+	w http.ResponseWriter,
+	key, kind string,
+	quota KeyQuota,
+	usage keyUsage,
+	now time.Time,
+) {
+	var used string
+	switch kind {
+	case "requests":
+		used = fmt.Sprintf("%d of %d requests", usage.Requests, quota.RequestsPerDay)
+	case "tokens":
+		used = fmt.Sprintf("%d of %d tokens", usage.Tokens, quota.TokensPerDay)
+	default:
+		used = fmt.Sprintf("$%.2f of $%.2f", usage.CostUSD, quota.USDPerDay)
+	}
+	y, m, d := now.UTC().Date()
+	reset := time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"type": "quota_exceeded",
+			"code": "key_quota_exceeded",
+			"message": fmt.Sprintf(
+				"API key %q used %s allowed per day; the quota resets at %s",
+				key,
+				used,
+				reset.Format(time.RFC3339),
+			),
+			"limit":    kind,
+			"reset_at": reset.Format(time.RFC3339),
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(reset.Sub(now).Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = w.Write(body)
+}
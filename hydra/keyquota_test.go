@@ -0,0 +1,147 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestKeyQuotaTracker_Allow(t *testing.T) {
+	day := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		quota    KeyQuota
+		tokens   int
+		cost     float64
+		expected string
+	}{
+		{"under all limits", KeyQuota{RequestsPerDay: 5, TokensPerDay: 100}, 50, 0, ""},
+		{"requests used up", KeyQuota{RequestsPerDay: 1}, 0, 0, "requests"},
+		{"tokens used up", KeyQuota{TokensPerDay: 100}, 100, 0, "tokens"},
+		{"spend used up", KeyQuota{USDPerDay: 0.5}, 10, 0.75, "usd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newKeyQuotaTracker()
+			if kind, _ := tracker.allow("l1", "k1", tt.quota, day); kind != "" {
+				t.Fatalf("expected the first request to be allowed, got %q", kind)
+			}
+			tracker.consume("l1", "k1", tt.tokens, tt.cost, day)
+			if kind, _ := tracker.allow("l1", "k1", tt.quota, day); kind != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, kind)
+			}
+			if kind, _ := tracker.allow("l1", "k1", tt.quota, day.Add(2*time.Hour)); kind != "" {
+				t.Errorf("expected the quota to reset the next day, got %q", kind)
+			}
+		})
+	}
+}
+
+func TestKeyQuotaTracker_ConsumeUntracked(t *testing.T) {
+	tracker := newKeyQuotaTracker()
+	tracker.consume("l1", "no-quota", 100, 1, time.Now())
+	if len(tracker.keys) != 0 {
+		t.Errorf("expected keys without a quota to be ignored, got %v", tracker.keys)
+	}
+}
+
+func TestKeyQuotaTracker_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	now := time.Now()
+	quota := KeyQuota{RequestsPerDay: 2}
+
+	tracker := newKeyQuotaTracker()
+	if err := tracker.open(path); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	tracker.allow("l1", "k1", quota, now)
+	tracker.consume("l1", "k1", 42, 0.01, now)
+	if err := tracker.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	restarted := newKeyQuotaTracker()
+	if err := restarted.open(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if u := restarted.keys["l1/k1"]; u.Requests != 1 || u.Tokens != 42 {
+		t.Errorf("expected saved usage after restart, got %+v", u)
+	}
+	restarted.allow("l1", "k1", quota, now)
+	if kind, _ := restarted.allow("l1", "k1", quota, now); kind != "requests" {
+		t.Errorf("expected the restored quota to be used up, got %q", kind)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newKeyQuotaTracker().open(path); err == nil {
+		t.Error("expected an error for a corrupt state file")
+	}
+}
+
+func TestKeyQuotaMiddleware(t *testing.T) {
+	if newKeyQuotaMiddleware(&Listener{}, nil, log.New(io.Discard)) != nil {
+		t.Fatal("expected no middleware without quotas")
+	}
+
+	l := &Listener{
+		Name: "quota-mw",
+		ResolvedAPIKeys: []APIKey{
+			{Name: "limited", Key: "a", Quota: KeyQuota{RequestsPerDay: 1}},
+			{Name: "free", Key: "b"},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := newKeyQuotaMiddleware(l, nil, log.New(io.Discard))(next)
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req = req.WithContext(context.WithValue(req.Context(), apiKeyNameContextKey{}, key))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("limited"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the first request through, got %d", rec.Code)
+	}
+	rec := send("limited")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the quota is used up, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After until the quota resets")
+	}
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Limit   string `json:"limit"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a JSON body: %v", err)
+	}
+	if body.Error.Code != "key_quota_exceeded" || body.Error.Limit != "requests" ||
+		!strings.Contains(body.Error.Message, "1 of 1 requests") {
+		t.Errorf("unexpected error body: %s", rec.Body)
+	}
+
+	for range 3 {
+		if rec := send("free"); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected keys without a quota through, got %d", rec.Code)
+		}
+	}
+}
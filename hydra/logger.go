@@ -0,0 +1,77 @@
+package hydra
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Listener log_attempts modes, controlling which upstream responses are logged at info level.
+const (
+	logAttemptsAll      = "all"      // Every attempt
+	logAttemptsFailures = "failures" // Failed attempts only
+	logAttemptsFinal    = "final"    // Only the response returned to the client
+)
+
+var logger = log.NewWithOptions(os.Stderr, log.Options{
+	ReportCaller:    true,
+	ReportTimestamp: true,
+	TimeFormat:      time.Kitchen,
+})
+
+// Logger returns the logger HydraLLM writes to. LoadConfig sets its level and
+// format.
+func Logger() *log.Logger {
+	return logger
+}
+
+// parseLogLevel converts string level to log.Level.
+func parseLogLevel(level string) log.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return log.DebugLevel
+	case "warn":
+		return log.WarnLevel
+	case "error":
+		return log.ErrorLevel
+	default:
+		return log.InfoLevel
+	}
+}
+
+// parseLogFormat converts a log format name to a log.Formatter.
+func parseLogFormat(format string) log.Formatter {
+	if format == logFormatJSON {
+		return log.JSONFormatter
+	}
+	return log.TextFormatter
+}
+
+// isDebugEnabled checks if debug logging is enabled.
+func isDebugEnabled(l *log.Logger) bool {
+	return l.GetLevel() <= log.DebugLevel
+}
+
+func isSupportedLogAttempts(mode string) bool {
+	switch mode {
+	case logAttemptsAll, logAttemptsFailures, logAttemptsFinal:
+		return true
+	default:
+		return false
+	}
+}
+
+// logsAttempt reports whether an attempt is logged at info level in mode.
+// An empty mode logs every attempt.
+func logsAttempt(mode string, failed, final bool) bool {
+	switch mode {
+	case logAttemptsFailures:
+		return failed
+	case logAttemptsFinal:
+		return final
+	default:
+		return true
+	}
+}
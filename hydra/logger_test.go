@@ -1,4 +1,4 @@
-package main
+package hydra
 
 import (
 	"io"
@@ -53,3 +53,33 @@ func TestIsDebugEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestLogsAttempt(t *testing.T) {
+	tests := []struct {
+		mode     string
+		failed   bool
+		final    bool
+		expected bool
+	}{
+		{"", false, false, true},
+		{logAttemptsAll, false, false, true},
+		{logAttemptsFailures, true, false, true},
+		{logAttemptsFailures, false, true, false},
+		{logAttemptsFinal, true, false, false},
+		{logAttemptsFinal, true, true, true},
+		{logAttemptsFinal, false, true, true},
+	}
+
+	for _, tt := range tests {
+		if got := logsAttempt(tt.mode, tt.failed, tt.final); got != tt.expected {
+			t.Errorf(
+				"logsAttempt(%q, %v, %v) = %v; want %v",
+				tt.mode,
+				tt.failed,
+				tt.final,
+				got,
+				tt.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package hydra
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Response headers naming the attempt that answered a request.
+const (
+	headerServedProvider = "X-Hydrallm-Provider"
+	headerServedModel    = "X-Hydrallm-Model"
+	headerAttempts       = "X-Hydrallm-Attempts"
+	headerCycle          = "X-Hydrallm-Cycle"
+)
+
+// setMetadataHeaders names the provider and model of the attempt that
+// answered, the attempts made, and the cycle of the answer, when the listener
+// exposes them. They reveal the upstream topology, so they are off by default.
+func setMetadataHeaders(
+	resp *http.Response,
+	state *transportState,
+	model Model,
+	attempts int,
+	cycle int,
+) {
+	if state.listener == nil || !state.listener.ExposeMetadata {
+		return
+	}
+	resp.Header.Set(headerServedProvider, model.Provider)
+	resp.Header.Set(headerServedModel, model.ID)
+	resp.Header.Set(headerAttempts, strconv.Itoa(attempts))
+	resp.Header.Set(headerCycle, strconv.Itoa(cycle))
+}
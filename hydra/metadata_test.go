@@ -0,0 +1,74 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestTransport_RoundTrip_MetadataHeaders(t *testing.T) {
+	backupStatus := http.StatusOK
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(backupStatus)
+	}))
+	defer backup.Close()
+
+	model := func(id, provider string) Model {
+		return Model{
+			ID:       id,
+			Provider: provider,
+			Model:    "gpt-5",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	providers := map[string]Provider{
+		"failing": {URL: failing.URL, ParsedURL: mustParseURL(failing.URL)},
+		"backup":  {URL: backup.URL, ParsedURL: mustParseURL(backup.URL)},
+	}
+	roundTrip := func(expose bool) http.Header {
+		t.Helper()
+		l := &Listener{
+			Name:           "metadata",
+			ConfigType:     "openai",
+			ExposeMetadata: expose,
+			ResolvedModels: []Model{model("primary", "failing"), model("secondary", "backup")},
+		}
+		retry := RetryConfig{MaxCycles: 2, DefaultTimeout: time.Second}
+		transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+		resp, err := transport.RoundTrip(
+			httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.Header
+	}
+
+	h := roundTrip(true)
+	if h.Get(headerServedProvider) != "backup" || h.Get(headerServedModel) != "secondary" ||
+		h.Get(headerAttempts) != "2" || h.Get(headerCycle) != "1" {
+		t.Errorf("unexpected metadata headers: %v", h)
+	}
+	if h := roundTrip(false); h.Get(headerServedProvider) != "" {
+		t.Errorf("expected no metadata headers unless exposed, got %v", h)
+	}
+
+	// A failed request names its last attempt
+	backupStatus = http.StatusServiceUnavailable
+	h = roundTrip(true)
+	if h.Get(headerServedModel) != "secondary" || h.Get(headerAttempts) != "4" ||
+		h.Get(headerCycle) != "2" {
+		t.Errorf("unexpected metadata headers of a failed request: %v", h)
+	}
+}
@@ -0,0 +1,228 @@
+package hydra
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metrics is the process-wide registry exposed on the admin /metrics endpoint.
+var metrics = newMetricsRegistry()
+
+// metricsRegistry is a minimal Prometheus-compatible metrics registry.
+// Labels are passed as alternating key/value pairs, like logger fields.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string // counter, gauge, histogram
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels string // Rendered label set, e.g. `{provider="openai"}`
+	value  float64
+	counts []uint64 // Histogram bucket counts, parallel to buckets
+	sum    float64
+	count  uint64
+}
+
+// Counter is a monotonically increasing metric.
+type Counter struct {
+	r *metricsRegistry
+	f *metricFamily
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	r *metricsRegistry
+	f *metricFamily
+}
+
+// Histogram samples observations into cumulative buckets.
+type Histogram struct {
+	r *metricsRegistry
+	f *metricFamily
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+// family returns the named family, creating it on first use.
+func (r *metricsRegistry) family(name, help, kind string, buckets []float64) *metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &metricFamily{
+			name:    name,
+			help:    help,
+			kind:    kind,
+			buckets: buckets,
+			series:  make(map[string]*metricSeries),
+		}
+		r.families[name] = f
+	}
+	return f
+}
+
+// Counter returns the named counter.
+func (r *metricsRegistry) Counter(name, help string) Counter {
+	return Counter{r, r.family(name, help, "counter", nil)}
+}
+
+// Gauge returns the named gauge.
+func (r *metricsRegistry) Gauge(name, help string) Gauge {
+	return Gauge{r, r.family(name, help, "gauge", nil)}
+}
+
+// Histogram returns the named histogram with the given upper bucket bounds.
+func (r *metricsRegistry) Histogram(name, help string, buckets []float64) Histogram {
+	return Histogram{r, r.family(name, help, "histogram", buckets)}
+}
+
+// Add increments the counter by v.
+func (c Counter) Add(v float64, labels ...string) {
+	c.r.update(c.f, labels, func(s *metricSeries) { s.value += v })
+}
+
+// Inc increments the counter by one.
+func (c Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Set sets the gauge to v.
+func (g Gauge) Set(v float64, labels ...string) {
+	g.r.update(g.f, labels, func(s *metricSeries) { s.value = v })
+}
+
+// Add adds v to the gauge.
+func (g Gauge) Add(v float64, labels ...string) {
+	g.r.update(g.f, labels, func(s *metricSeries) { s.value += v })
+}
+
+// Observe records a single observation.
+func (h Histogram) Observe(v float64, labels ...string) {
+	h.r.update(h.f, labels, func(s *metricSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, bound := range h.f.buckets {
+			if v <= bound {
+				s.counts[i]++
+			}
+		}
+		s.sum += v
+		s.count++
+	})
+}
+
+// update applies fn to the series of f identified by labels.
+func (r *metricsRegistry) update(f *metricFamily, labels []string, fn func(*metricSeries)) {
+	key := renderLabels(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: key}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// value returns the current value of a counter or gauge series, for tests and status output.
+func (r *metricsRegistry) value(name string, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		return 0
+	}
+	if s, ok := f.series[renderLabels(labels)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *metricsRegistry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		if len(f.series) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, s.labels, formatFloat(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				le := withLabel(s.labels, "le", formatFloat(bound))
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, le, s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, withLabel(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, s.labels, formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, s.labels, s.count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// renderLabels renders alternating key/value pairs as a Prometheus label set.
+func renderLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends a label to a rendered label set.
+func withLabel(labels, key, value string) string {
+	pair := key + "=" + strconv.Quote(value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
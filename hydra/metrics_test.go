@@ -0,0 +1,87 @@
+package hydra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRegistry_CounterAndGauge(t *testing.T) {
+	r := newMetricsRegistry()
+	c := r.Counter("test_requests_total", "Test requests.")
+	c.Inc("listener", "main")
+	c.Add(2, "listener", "main")
+	c.Inc("listener", "other")
+
+	g := r.Gauge("test_in_flight", "Test in-flight requests.")
+	g.Set(5)
+	g.Add(-2)
+
+	if got := r.value("test_requests_total", "listener", "main"); got != 3 {
+		t.Errorf("expected counter 3, got %v", got)
+	}
+	if got := r.value("test_in_flight"); got != 3 {
+		t.Errorf("expected gauge 3, got %v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{listener="main"} 3`,
+		`test_requests_total{listener="other"} 1`,
+		"# TYPE test_in_flight gauge",
+		"test_in_flight 3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsRegistry_Histogram(t *testing.T) {
+	r := newMetricsRegistry()
+	h := r.Histogram("test_depth", "Test depth.", []float64{1, 2, 5})
+	for _, v := range []float64{1, 2, 3, 10} {
+		h.Observe(v, "listener", "main")
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`test_depth_bucket{listener="main",le="1"} 1`,
+		`test_depth_bucket{listener="main",le="2"} 2`,
+		`test_depth_bucket{listener="main",le="5"} 3`,
+		`test_depth_bucket{listener="main",le="+Inf"} 4`,
+		`test_depth_sum{listener="main"} 16`,
+		`test_depth_count{listener="main"} 4`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderLabels(t *testing.T) {
+	tests := []struct {
+		labels []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"a"}, ""},
+		{[]string{"a", "1"}, `{a="1"}`},
+		{[]string{"a", "1", "b", `q"x`}, `{a="1",b="q\"x"}`},
+	}
+
+	for _, tt := range tests {
+		if got := renderLabels(tt.labels); got != tt.want {
+			t.Errorf("renderLabels(%v) = %s, want %s", tt.labels, got, tt.want)
+		}
+	}
+}
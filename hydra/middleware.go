@@ -0,0 +1,126 @@
+package hydra
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/charmbracelet/log"
+)
+
+// middlewareFactory builds a middleware stage for a listener.
+// It returns nil when the stage has nothing to do for that listener.
+type middlewareFactory func(
+	l *Listener,
+	cfg *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler
+
+// middlewareRegistry maps middleware names to their factories.
+var middlewareRegistry = map[string]middlewareFactory{
+	"recover":    newRecoverMiddleware,
+	"allowlist":  newAllowlistMiddleware,
+	"probe":      newProbeMiddleware,
+	"auth":       newAuthMiddleware,
+	"filter":     newFilterMiddleware,
+	"quota":      newKeyQuotaMiddleware,
+	"corpus":     newCorpusMiddleware,
+	"transcript": newTranscriptMiddleware,
+	"broadcast":  newBroadcastMiddleware,
+	"cache":      newCacheMiddleware,
+	"gzip":       newGzipMiddleware,
+}
+
+// defaultMiddlewareOrder is the pipeline used when no order is configured.
+var defaultMiddlewareOrder = []string{
+	"recover",
+	"allowlist",
+	"probe",
+	"auth",
+	"filter",
+	"quota",
+	"corpus",
+	"transcript",
+	"broadcast",
+	"cache",
+}
+
+// resolveMiddleware returns the ordered middleware pipeline for a listener.
+// The listener's own list takes priority over the global list, which takes
+// priority over the built-in default order. Disabled stages are removed.
+func resolveMiddleware(global []string, l *Listener) ([]string, error) {
+	order := defaultMiddlewareOrder
+	if len(global) > 0 {
+		order = global
+	}
+	if len(l.Middleware) > 0 {
+		order = l.Middleware
+	}
+
+	for _, name := range l.DisableMiddleware {
+		if _, ok := middlewareRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown middleware %q in disable_middleware", name)
+		}
+	}
+
+	resolved := make([]string, 0, len(order))
+	seen := make(map[string]struct{}, len(order))
+	for _, name := range order {
+		if _, ok := middlewareRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown middleware %q", name)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("duplicate middleware %q", name)
+		}
+		seen[name] = struct{}{}
+		if slices.Contains(l.DisableMiddleware, name) {
+			continue
+		}
+		resolved = append(resolved, name)
+	}
+	return resolved, nil
+}
+
+// wrapMiddleware wraps h with the listener's resolved middleware pipeline.
+// The first stage in the pipeline is the outermost handler.
+func wrapMiddleware(h http.Handler, l *Listener, cfg *Config, logger *log.Logger) http.Handler {
+	for _, name := range slices.Backward(l.ResolvedMiddleware) {
+		mw := middlewareRegistry[name](l, cfg, logger)
+		if mw == nil {
+			continue
+		}
+		h = mw(h)
+	}
+	return h
+}
+
+// newRecoverMiddleware converts handler panics into 500 responses.
+func newRecoverMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					// Let net/http handle its own abort sentinel
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					logger.Error(
+						"handler panic",
+						"listener",
+						l.Name,
+						"path",
+						r.URL.Path,
+						"panic",
+						rec,
+					)
+					http.Error(w, "internal server error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestResolveMiddleware(t *testing.T) {
+	middlewareRegistry["test_a"] = func(
+		*Listener,
+		*Config,
+		*log.Logger,
+	) func(http.Handler) http.Handler {
+		return nil
+	}
+	t.Cleanup(func() { delete(middlewareRegistry, "test_a") })
+
+	tests := []struct {
+		name     string
+		global   []string
+		listener Listener
+		want     []string
+		wantErr  bool
+	}{
+		{"default order", nil, Listener{}, defaultMiddlewareOrder, false},
+		{
+			"global order",
+			[]string{"test_a", "recover"},
+			Listener{},
+			[]string{"test_a", "recover"},
+			false,
+		},
+		{
+			"listener overrides global",
+			[]string{"test_a", "recover"},
+			Listener{Middleware: []string{"recover"}},
+			[]string{"recover"},
+			false,
+		},
+		{
+			"disable removes stage",
+			[]string{"test_a", "recover"},
+			Listener{DisableMiddleware: []string{"recover"}},
+			[]string{"test_a"},
+			false,
+		},
+		{"unknown middleware", []string{"nope"}, Listener{}, nil, true},
+		{
+			"unknown disabled middleware",
+			nil,
+			Listener{DisableMiddleware: []string{"nope"}},
+			nil,
+			true,
+		},
+		{"duplicate middleware", []string{"recover", "recover"}, Listener{}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveMiddleware(tt.global, &tt.listener)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapMiddleware_Order(t *testing.T) {
+	var calls []string
+	stage := func(name string) middlewareFactory {
+		return func(*Listener, *Config, *log.Logger) func(http.Handler) http.Handler {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls = append(calls, name)
+					next.ServeHTTP(w, r)
+				})
+			}
+		}
+	}
+	middlewareRegistry["test_first"] = stage("first")
+	middlewareRegistry["test_second"] = stage("second")
+	t.Cleanup(func() {
+		delete(middlewareRegistry, "test_first")
+		delete(middlewareRegistry, "test_second")
+	})
+
+	l := &Listener{ResolvedMiddleware: []string{"test_first", "test_second"}}
+	h := wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), l, &Config{}, log.New(io.Discard))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	want := []string{"first", "second", "handler"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("got call order %v, want %v", calls, want)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	mw := newRecoverMiddleware(&Listener{Name: "test"}, &Config{}, log.New(io.Discard))
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+}
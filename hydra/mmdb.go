@@ -0,0 +1,289 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// mmdbMetadataMarker starts the metadata section at the end of a MaxMind DB.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbDataSeparator is the size of the zeros between search tree and data.
+const mmdbDataSeparator = 16
+
+// mmdbReader looks up addresses in a MaxMind DB file, such as GeoLite2
+// Country, held in memory. It implements only what country lookups need of
+// the format: https://maxmind.github.io/MaxMind-DB/
+type mmdbReader struct {
+	tree       []byte // Search tree
+	data       []byte // Data section
+	nodeCount  uint
+	recordSize uint // Bits per record, 24, 28, or 32
+	ipv4Start  uint // Node of the IPv4 subtree, past 96 zero bits
+	ipVersion  uint
+}
+
+// openMMDB reads the MaxMind DB file at path.
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geo database: %w", err)
+	}
+	db, err := parseMMDB(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geo database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func parseMMDB(buf []byte) (*mmdbReader, error) {
+	start := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if start < 0 {
+		return nil, errors.New("metadata not found")
+	}
+	meta := buf[start+len(mmdbMetadataMarker):]
+	value, _, err := mmdbDecode(meta, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+	db := &mmdbReader{
+		nodeCount:  mmdbUint(m["node_count"]),
+		recordSize: mmdbUint(m["record_size"]),
+		ipVersion:  mmdbUint(m["ip_version"]),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+mmdbDataSeparator > uint(start) {
+		return nil, errors.New("search tree exceeds the file")
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+mmdbDataSeparator : start]
+
+	if db.ipVersion == 6 {
+		for range 96 {
+			if db.ipv4Start >= db.nodeCount {
+				break
+			}
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *mmdbReader) record(node uint, bit byte) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[uint(bit)*4:]))
+	}
+}
+
+// lookup returns the data of the network containing addr, or nil.
+func (db *mmdbReader) lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4():
+		ip, node = addr.AsSlice(), db.ipv4Start
+	case db.ipVersion == 6:
+		ip = addr.AsSlice()
+	default:
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, ip[i/8]>>(7-i%8)&1)
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+	offset := node - db.nodeCount - mmdbDataSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, errors.New("data pointer exceeds the data section")
+	}
+	value, _, err := mmdbDecode(db.data, offset)
+	return value, err
+}
+
+// country returns the ISO code of the country of addr, or of the country it
+// is registered in, or empty when unknown.
+func (db *mmdbReader) country(addr netip.Addr) (string, error) {
+	value, err := db.lookup(addr)
+	if err != nil {
+		return "", err
+	}
+	m, _ := value.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		c, _ := m[key].(map[string]any)
+		if code, _ := c["iso_code"].(string); code != "" {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+// MaxMind DB data types.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+var errMMDBTruncated = errors.New("truncated data")
+
+// mmdbDecode decodes the value at offset of a data section, and returns the
+// offset after it.
+func mmdbDecode(data []byte, offset uint) (any, uint, error) {
+	if offset >= uint(len(data)) {
+		return nil, 0, errMMDBTruncated
+	}
+	ctrl := data[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+	if typ == mmdbPointer {
+		n := uint(ctrl>>3&0x3) + 1
+		if offset+n > uint(len(data)) {
+			return nil, 0, errMMDBTruncated
+		}
+		b := data[offset : offset+n]
+		var ptr uint
+		switch n {
+		case 1:
+			ptr = uint(ctrl&0x7)<<8 | uint(b[0])
+		case 2:
+			ptr = 2048 + (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1]))
+		case 3:
+			ptr = 526336 + (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		default:
+			ptr = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := mmdbDecode(data, ptr)
+		return value, offset + n, err
+	}
+	if typ == mmdbExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, errMMDBTruncated
+		}
+		typ = 7 + uint(data[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(data)) {
+			return nil, 0, errMMDBTruncated
+		}
+		var extra uint
+		for _, b := range data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for range size {
+			key, next, err := mmdbDecode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if m[k], offset, err = mmdbDecode(data, next); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for range size {
+			value, next, err := mmdbDecode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, value), next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, errMMDBTruncated
+	}
+	b := data[offset : offset+size]
+	offset += size
+	switch typ {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if typ == mmdbInt32 {
+			return int64(int32(v)), offset, nil
+		}
+		return v, offset, nil
+	case mmdbBytes, mmdbUint128:
+		return b, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
+
+// mmdbUint returns an unsigned metadata value, or 0.
+func mmdbUint(v any) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
@@ -0,0 +1,161 @@
+package hydra
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encodeMMDBString, encodeMMDBMap, and encodeMMDBUint16 encode data section
+// values for test databases.
+func encodeMMDBString(s string) []byte {
+	return append([]byte{mmdbString<<5 | byte(len(s))}, s...)
+}
+
+func encodeMMDBMap(pairs ...[]byte) []byte {
+	b := []byte{mmdbMap<<5 | byte(len(pairs)/2)}
+	for _, p := range pairs {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func encodeMMDBUint16(v int) []byte {
+	return []byte{mmdbUint16<<5 | 2, byte(v >> 8), byte(v)}
+}
+
+// buildTestMMDB returns an IPv6 MaxMind DB with records of recordSize bits,
+// mapping networks to country codes. IPv4 networks are placed in the IPv4
+// subtree, as MaxMind databases do.
+func buildTestMMDB(t *testing.T, recordSize int, networks map[string]string) []byte {
+	t.Helper()
+	const empty = -1
+	var data []byte
+	offsets := make(map[string]int)
+	nodes := [][2]int{{empty, empty}}
+	// Records pointing at data are stored as -2 - offset until encoded
+	for network, country := range networks {
+		if _, ok := offsets[country]; !ok {
+			offsets[country] = len(data)
+			data = append(data, encodeMMDBMap(
+				encodeMMDBString("country"),
+				encodeMMDBMap(encodeMMDBString("iso_code"), encodeMMDBString(country)),
+			)...)
+		}
+		prefix := netip.MustParsePrefix(network)
+		ip, bits := prefix.Addr().As16(), prefix.Bits()
+		if prefix.Addr().Is4() {
+			ip = [16]byte{}
+			copy(ip[12:], prefix.Addr().AsSlice())
+			bits += 96
+		}
+		node := 0
+		for i := range bits {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				nodes[node][bit] = -2 - offsets[country]
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	count := len(nodes)
+	value := func(r int) uint32 {
+		switch {
+		case r == empty:
+			return uint32(count)
+		case r < empty:
+			return uint32(count + mmdbDataSeparator + (-2 - r))
+		}
+		return uint32(r)
+	}
+	var db []byte
+	for _, n := range nodes {
+		l, r := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			db = append(db, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			db = append(db, byte(l>>16), byte(l>>8), byte(l), byte(l>>24<<4|r>>24&0x0f),
+				byte(r>>16), byte(r>>8), byte(r))
+		default:
+			db = append(db, byte(l>>24), byte(l>>16), byte(l>>8), byte(l),
+				byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	db = append(db, make([]byte, mmdbDataSeparator)...)
+	db = append(db, data...)
+	db = append(db, mmdbMetadataMarker...)
+	return append(db, encodeMMDBMap(
+		encodeMMDBString("node_count"), encodeMMDBUint16(count),
+		encodeMMDBString("record_size"), encodeMMDBUint16(recordSize),
+		encodeMMDBString("ip_version"), encodeMMDBUint16(6),
+	)...)
+}
+
+// writeTestMMDB writes a test database to a temporary file.
+func writeTestMMDB(t *testing.T, networks map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, buildTestMMDB(t, 24, networks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMMDBReader_Country(t *testing.T) {
+	networks := map[string]string{
+		"198.51.100.0/24": "DE",
+		"192.0.2.0/24":    "US",
+		"2001:db8::/32":   "FR",
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"198.51.100.7", "DE"},
+		{"::ffff:198.51.100.7", "DE"},
+		{"192.0.2.1", "US"},
+		{"2001:db8::1", "FR"},
+		{"203.0.113.1", ""},
+		{"2001:db9::1", ""},
+	}
+	for _, size := range []int{24, 28, 32} {
+		db, err := parseMMDB(buildTestMMDB(t, size, networks))
+		if err != nil {
+			t.Fatalf("record size %d: unexpected error: %v", size, err)
+		}
+		for _, tt := range tests {
+			got, err := db.country(netip.MustParseAddr(tt.addr))
+			if err != nil || got != tt.want {
+				t.Errorf(
+					"record size %d: country(%s) = %q, %v, want %q",
+					size, tt.addr, got, err, tt.want,
+				)
+			}
+		}
+	}
+}
+
+func TestMMDBDecode_Pointer(t *testing.T) {
+	data := append(encodeMMDBString("DE"), mmdbPointer<<5, 0)
+	value, next, err := mmdbDecode(data, 3)
+	if err != nil || value != "DE" || next != 5 {
+		t.Errorf("expected the pointed string, got %v at %d (%v)", value, next, err)
+	}
+}
+
+func TestParseMMDB_Invalid(t *testing.T) {
+	if _, err := parseMMDB([]byte("not a database")); err == nil {
+		t.Error("expected error without metadata")
+	}
+	if _, err := openMMDB(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
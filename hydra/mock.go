@@ -0,0 +1,390 @@
+package hydra
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/viper"
+)
+
+// mockReply is the completion text of mock responses without a scenario content.
+const mockReply = "This is a mock response."
+
+// MockScenario scripts how the mock server answers matching requests. A
+// request matches when it meets every condition the scenario sets; the first
+// matching scenario with uses left applies.
+type MockScenario struct {
+	Name  string `mapstructure:"name"`
+	Path  string `mapstructure:"path"`  // Regular expression on the URL path
+	Model string `mapstructure:"model"` // Regular expression on the requested model
+	Times int    `mapstructure:"times"` // Matching requests it applies to, 0 for all
+
+	Status     int           `mapstructure:"status"`      // Error status, 0 answers normally
+	Body       string        `mapstructure:"body"`        // Error body, default per API
+	RetryAfter string        `mapstructure:"retry_after"` // Retry-After of errors
+	Delay      time.Duration `mapstructure:"delay"`       // Wait before answering
+	Content    string        `mapstructure:"content"`     // Completion text
+	StreamCut  int           `mapstructure:"stream_cut"`  // Drop streams after N events
+}
+
+// mockScenario is a scenario with its conditions compiled and its uses counted.
+type mockScenario struct {
+	MockScenario
+	path  *regexp.Regexp
+	model *regexp.Regexp
+	used  int
+}
+
+// LoadMockScenarios reads the [[scenarios]] of a TOML, YAML, or JSON file.
+func LoadMockScenarios(path string) ([]MockScenario, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read scenarios: %w", err)
+	}
+	return unmarshalMockScenarios(v)
+}
+
+func unmarshalMockScenarios(v *viper.Viper) ([]MockScenario, error) {
+	var scenarios []MockScenario
+	if err := v.UnmarshalKey("scenarios", &scenarios); err != nil {
+		return nil, fmt.Errorf("failed to parse scenarios: %w", err)
+	}
+	return scenarios, nil
+}
+
+func compileMockScenarios(scenarios []MockScenario) ([]*mockScenario, error) {
+	compiled := make([]*mockScenario, 0, len(scenarios))
+	for i, s := range scenarios {
+		s.Name = cmp.Or(s.Name, fmt.Sprintf("scenarios[%d]", i))
+		c := &mockScenario{MockScenario: s}
+		var err error
+		if s.Path != "" {
+			if c.path, err = regexp.Compile(s.Path); err != nil {
+				return nil, fmt.Errorf("scenario %q: invalid path: %w", s.Name, err)
+			}
+		}
+		if s.Model != "" {
+			if c.model, err = regexp.Compile(s.Model); err != nil {
+				return nil, fmt.Errorf("scenario %q: invalid model: %w", s.Name, err)
+			}
+		}
+		if s.Status != 0 && (s.Status < 400 || s.Status > 599) {
+			return nil, fmt.Errorf(
+				"scenario %q: status must be 4xx or 5xx, got %d",
+				s.Name,
+				s.Status,
+			)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// MockServer emulates the OpenAI chat completions and Anthropic messages APIs,
+// streaming included, for testing clients and proxies. Scenarios script
+// failures, delays, and truncated streams; they can be replaced at runtime
+// with PUT /_mock/scenarios.
+type MockServer struct {
+	mu        sync.Mutex
+	scenarios []*mockScenario
+	logger    *log.Logger
+}
+
+// NewMockServer returns a mock server answering with the given scenarios.
+func NewMockServer(scenarios []MockScenario, logger *log.Logger) (*MockServer, error) {
+	compiled, err := compileMockScenarios(scenarios)
+	if err != nil {
+		return nil, err
+	}
+	return &MockServer{scenarios: compiled, logger: logger}, nil
+}
+
+// match returns the scenario applying to a request and uses it, or nil.
+func (m *MockServer) match(path, model string) *MockScenario {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.scenarios {
+		if (s.path != nil && !s.path.MatchString(path)) ||
+			(s.model != nil && !s.model.MatchString(model)) ||
+			(s.Times > 0 && s.used >= s.Times) {
+			continue
+		}
+		s.used++
+		scenario := s.MockScenario
+		return &scenario
+	}
+	return nil
+}
+
+func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_mock/scenarios" {
+		m.serveScenarios(w, r)
+		return
+	}
+
+	var req struct {
+		Model         string `json:"model"`
+		Stream        bool   `json:"stream"`
+		StreamOptions struct {
+			IncludeUsage bool `json:"include_usage"`
+		} `json:"stream_options"`
+	}
+	var size int
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(io.LimitReader(r.Body, corpusMaxCapture))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if json.Unmarshal(body, &req) != nil {
+			writeMockError(w, r.URL.Path, http.StatusBadRequest, "", "request body is not JSON")
+			return
+		}
+		size = len(body)
+	}
+
+	scenario := m.match(r.URL.Path, req.Model)
+	if scenario == nil {
+		scenario = &MockScenario{}
+	}
+	m.logger.Debug(
+		"mock request",
+		"path",
+		r.URL.Path,
+		"model",
+		req.Model,
+		"scenario",
+		scenario.Name,
+	)
+	if scenario.Delay > 0 {
+		select {
+		case <-time.After(scenario.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if scenario.Status != 0 {
+		if scenario.RetryAfter != "" {
+			w.Header().Set("Retry-After", scenario.RetryAfter)
+		}
+		message := "mock scenario " + scenario.Name
+		writeMockError(w, r.URL.Path, scenario.Status, scenario.Body, message)
+		return
+	}
+
+	usage := tokenUsage{Input: max(1, size/4)}
+	content := cmp.Or(scenario.Content, mockReply)
+	usage.Output = len(strings.Fields(content))
+	model := cmp.Or(req.Model, "mock-model")
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/models"):
+		writeJSON(w, http.StatusOK, map[string]any{
+			"object": "list",
+			"data":   []map[string]string{{"id": "mock-model", "object": "model"}},
+		})
+	case strings.HasSuffix(r.URL.Path, "/chat/completions") && req.Stream:
+		events := openAIMockEvents(model, content, usage, req.StreamOptions.IncludeUsage)
+		writeMockSSE(w, scenario.StreamCut, events)
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		writeJSON(w, http.StatusOK, openAIMockCompletion(model, content, usage))
+	case strings.HasSuffix(r.URL.Path, "/messages") && req.Stream:
+		writeMockSSE(w, scenario.StreamCut, anthropicMockEvents(model, content, usage))
+	case strings.HasSuffix(r.URL.Path, "/messages"):
+		writeJSON(w, http.StatusOK, anthropicMockMessage(model, content, usage))
+	default:
+		writeMockError(w, r.URL.Path, http.StatusNotFound, "", "unknown mock endpoint")
+	}
+}
+
+// serveScenarios replaces the scenarios with those of a JSON document in the
+// scenario file format, such as {"scenarios": [{"status": 503, "times": 2}]}.
+// Use counts start over.
+func (m *MockServer) serveScenarios(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	v := viper.New()
+	v.SetConfigType("json")
+	if err := v.ReadConfig(io.LimitReader(r.Body, corpusMaxCapture)); err != nil {
+		http.Error(w, "invalid scenarios: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	scenarios, err := unmarshalMockScenarios(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	compiled, err := compileMockScenarios(scenarios)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.scenarios = compiled
+	m.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMockError writes body, or an error in the format of the API at path.
+func writeMockError(w http.ResponseWriter, path string, status int, body, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body == "" {
+		var data []byte
+		if strings.HasSuffix(path, "/messages") {
+			data, _ = json.Marshal(map[string]any{
+				"type":  "error",
+				"error": map[string]string{"type": "api_error", "message": message},
+			})
+		} else {
+			data, _ = json.Marshal(map[string]any{
+				"error": map[string]any{"type": "server_error", "message": message, "code": status},
+			})
+		}
+		body = string(data)
+	}
+	_, _ = w.Write([]byte(body))
+}
+
+// mockEvent is a server-sent event; an empty name writes only data.
+type mockEvent struct {
+	name string
+	data any
+}
+
+// writeMockSSE streams events, closing the connection without finishing the
+// stream after cut events when cut is positive.
+func writeMockSSE(w http.ResponseWriter, cut int, events []mockEvent) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for i, ev := range events {
+		if cut > 0 && i == cut {
+			// Abort the response so the client sees a broken stream
+			panic(http.ErrAbortHandler)
+		}
+		data, ok := ev.data.(string)
+		if !ok {
+			encoded, _ := json.Marshal(ev.data)
+			data = string(encoded)
+		}
+		if ev.name != "" {
+			_, _ = fmt.Fprintf(w, "event: %s\n", ev.name)
+		}
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// mockWords splits content into stream deltas of one word each.
+func mockWords(content string) []string {
+	return strings.SplitAfter(content, " ")
+}
+
+func openAIMockUsage(usage tokenUsage) map[string]int {
+	return map[string]int{
+		"prompt_tokens":     usage.Input,
+		"completion_tokens": usage.Output,
+		"total_tokens":      usage.total(),
+	}
+}
+
+func openAIMockCompletion(model, content string, usage tokenUsage) map[string]any {
+	return map[string]any{
+		"id":      "chatcmpl-mock",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+		"usage": openAIMockUsage(usage),
+	}
+}
+
+func openAIMockEvents(model, content string, usage tokenUsage, includeUsage bool) []mockEvent {
+	chunk := func(delta map[string]string, finish any) mockEvent {
+		return mockEvent{data: map[string]any{
+			"id":      "chatcmpl-mock",
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}}
+	}
+	events := []mockEvent{chunk(map[string]string{"role": "assistant", "content": ""}, nil)}
+	for _, word := range mockWords(content) {
+		events = append(events, chunk(map[string]string{"content": word}, nil))
+	}
+	events = append(events, chunk(map[string]string{}, "stop"))
+	if includeUsage {
+		events = append(events, mockEvent{data: map[string]any{
+			"id":      "chatcmpl-mock",
+			"object":  "chat.completion.chunk",
+			"model":   model,
+			"choices": []any{},
+			"usage":   openAIMockUsage(usage),
+		}})
+	}
+	return append(events, mockEvent{data: "[DONE]"})
+}
+
+func anthropicMockMessage(model, content string, usage tokenUsage) map[string]any {
+	return map[string]any{
+		"id":            "msg_mock",
+		"type":          "message",
+		"role":          "assistant",
+		"model":         model,
+		"content":       []map[string]string{{"type": "text", "text": content}},
+		"stop_reason":   "end_turn",
+		"stop_sequence": nil,
+		"usage":         map[string]int{"input_tokens": usage.Input, "output_tokens": usage.Output},
+	}
+}
+
+func anthropicMockEvents(model, content string, usage tokenUsage) []mockEvent {
+	message := anthropicMockMessage(model, "", usage)
+	message["content"] = []any{}
+	message["stop_reason"] = nil
+	message["usage"] = map[string]int{"input_tokens": usage.Input, "output_tokens": 1}
+	events := []mockEvent{
+		{"message_start", map[string]any{"type": "message_start", "message": message}},
+		{"content_block_start", map[string]any{
+			"type":          "content_block_start",
+			"index":         0,
+			"content_block": map[string]string{"type": "text", "text": ""},
+		}},
+	}
+	for _, word := range mockWords(content) {
+		events = append(events, mockEvent{"content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]string{"type": "text_delta", "text": word},
+		}})
+	}
+	return append(events,
+		mockEvent{"content_block_stop", map[string]any{"type": "content_block_stop", "index": 0}},
+		mockEvent{"message_delta", map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": "end_turn", "stop_sequence": nil},
+			"usage": map[string]int{"output_tokens": usage.Output},
+		}},
+		mockEvent{"message_stop", map[string]string{"type": "message_stop"}},
+	)
+}
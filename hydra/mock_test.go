@@ -0,0 +1,233 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func newTestMockServer(t *testing.T, scenarios ...MockScenario) *httptest.Server {
+	t.Helper()
+	mock, err := NewMockServer(scenarios, log.New(io.Discard))
+	if err != nil {
+		t.Fatalf("NewMockServer: %v", err)
+	}
+	ts := httptest.NewServer(mock)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func postMock(t *testing.T, url, body string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	return resp, data
+}
+
+func TestMockServer_Responses(t *testing.T) {
+	ts := newTestMockServer(t)
+
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		check func(t *testing.T, body []byte)
+	}{
+		{
+			"openai",
+			"/v1/chat/completions",
+			`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`,
+			func(t *testing.T, body []byte) {
+				got := gjson.GetBytes(body, "choices.0.message.content").String()
+				if got != mockReply {
+					t.Errorf("unexpected content %q", got)
+				}
+				if gjson.GetBytes(body, "usage.total_tokens").Int() == 0 {
+					t.Error("expected usage")
+				}
+			},
+		},
+		{
+			"openai stream",
+			"/v1/chat/completions",
+			`{"model":"gpt-4o","stream":true,"stream_options":{"include_usage":true}}`,
+			func(t *testing.T, body []byte) {
+				if !bytes.HasSuffix(body, []byte("data: [DONE]\n\n")) ||
+					!bytes.Contains(body, []byte(`"completion_tokens"`)) {
+					t.Errorf("unexpected stream:\n%s", body)
+				}
+			},
+		},
+		{
+			"anthropic",
+			"/v1/messages",
+			`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`,
+			func(t *testing.T, body []byte) {
+				if got := gjson.GetBytes(body, "content.0.text").String(); got != mockReply {
+					t.Errorf("unexpected content %q", got)
+				}
+			},
+		},
+		{
+			"anthropic stream",
+			"/v1/messages",
+			`{"model":"claude","stream":true}`,
+			func(t *testing.T, body []byte) {
+				events := []string{"message_start", "content_block_delta", "message_stop"}
+				for _, event := range events {
+					if !bytes.Contains(body, []byte("event: "+event+"\n")) {
+						t.Errorf("expected %s event in:\n%s", event, body)
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := postMock(t, ts.URL+tt.path, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestMockServer_Scenarios(t *testing.T) {
+	ts := newTestMockServer(t,
+		MockScenario{Name: "flaky", Model: "^flaky$", Status: 503, Times: 2, RetryAfter: "1"},
+		MockScenario{Name: "cut", Model: "^cut$", StreamCut: 2},
+		MockScenario{Name: "custom", Path: "/messages$", Content: "scripted"},
+	)
+
+	for range 2 {
+		resp, body := postMock(t, ts.URL+"/v1/chat/completions", `{"model":"flaky"}`)
+		if resp.StatusCode != http.StatusServiceUnavailable ||
+			resp.Header.Get("Retry-After") != "1" {
+			t.Fatalf("expected scripted 503, got %d: %s", resp.StatusCode, body)
+		}
+	}
+	resp, _ := postMock(t, ts.URL+"/v1/chat/completions", `{"model":"flaky"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected success once the scenario is used up, got %d", resp.StatusCode)
+	}
+
+	_, body := postMock(t, ts.URL+"/v1/messages", `{"model":"claude"}`)
+	if got := gjson.GetBytes(body, "content.0.text").String(); got != "scripted" {
+		t.Errorf("expected scripted content, got %q", got)
+	}
+
+	resp, err := http.Post(
+		ts.URL+"/v1/chat/completions",
+		"application/json",
+		strings.NewReader(`{"model":"cut","stream":true}`),
+	)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if data, err := io.ReadAll(resp.Body); err == nil || bytes.Contains(data, []byte("[DONE]")) {
+		t.Errorf("expected a broken stream, got err %v:\n%s", err, data)
+	}
+}
+
+func TestMockServer_PutScenarios(t *testing.T) {
+	ts := newTestMockServer(t)
+	req, _ := http.NewRequest(
+		http.MethodPut,
+		ts.URL+"/_mock/scenarios",
+		strings.NewReader(`{"scenarios":[{"status":429,"delay":"10ms"}]}`),
+	)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+
+	start := time.Now()
+	resp, body := postMock(t, ts.URL+"/v1/chat/completions", `{"model":"any"}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 from the new scenario, got %d: %s", resp.StatusCode, body)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("expected the scenario delay")
+	}
+}
+
+func TestLoadMockScenarios(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenarios.toml")
+	data := "[[scenarios]]\nname = \"slow\"\ndelay = \"2s\"\nstatus = 500\ntimes = 1\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenarios, err := LoadMockScenarios(path)
+	if err != nil {
+		t.Fatalf("LoadMockScenarios: %v", err)
+	}
+	want := MockScenario{Name: "slow", Delay: 2 * time.Second, Status: 500, Times: 1}
+	if len(scenarios) != 1 || scenarios[0] != want {
+		t.Errorf("expected %+v, got %+v", want, scenarios)
+	}
+
+	if _, err := NewMockServer([]MockScenario{{Status: 200}}, log.New(io.Discard)); err == nil {
+		t.Error("expected an error for a non-error status")
+	}
+}
+
+// TestMockServer_RetryTransport runs the retry transport against the mock
+// server: the first model fails twice and the request falls back.
+func TestMockServer_RetryTransport(t *testing.T) {
+	ts := newTestMockServer(t, MockScenario{Model: "^primary$", Status: 500})
+
+	transport := NewRetryTransport(
+		[]Model{
+			{
+				ID: "mock-primary", Provider: "mockserver", Model: "primary", Type: "openai",
+				Attempts: 2, Timeout: time.Second,
+			},
+			{
+				ID: "mock-fallback", Provider: "mockserver", Model: "fallback", Type: "openai",
+				Attempts: 1, Timeout: time.Second,
+			},
+		},
+		map[string]Provider{"mockserver": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)}},
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		strings.NewReader(`{"model":"x","messages":[]}`),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || gjson.GetBytes(body, "model").String() != "fallback" {
+		t.Errorf("expected the fallback model to answer, got %d: %s", resp.StatusCode, body)
+	}
+}
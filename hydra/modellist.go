@@ -0,0 +1,145 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/sjson"
+)
+
+// Listener model_list modes, deciding how model list requests are answered.
+const (
+	modelListUpstream = "upstream" // Forward to the first model's provider
+	modelListLocal    = "local"    // Answer with the listener's models
+	modelListMerged   = "merged"   // Upstream list with the listener's models added
+)
+
+func isSupportedModelList(mode string) bool {
+	switch mode {
+	case modelListUpstream, modelListLocal, modelListMerged:
+		return true
+	default:
+		return false
+	}
+}
+
+// localModelNames returns the model names a listener offers clients: the
+// upstream names a passthrough listener serves, or else the IDs of its models
+// followed by its route names.
+func (s *transportState) localModelNames() []string {
+	if s.listener.Dispatch == dispatchPassthrough {
+		return s.passthroughNames()
+	}
+	var names []string
+	for _, m := range s.models {
+		if !slices.Contains(names, m.ID) {
+			names = append(names, m.ID)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.routes)) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// localModelList answers a model list request with the listener's model
+// names, in the listener's API format.
+func localModelList(req *http.Request, s *transportState) *http.Response {
+	names := s.localModelNames()
+	var body any
+	switch s.listener.ConfigType {
+	case "anthropic":
+		data := make([]map[string]string, 0, len(names))
+		for _, name := range names {
+			data = append(data, map[string]string{
+				"type":         "model",
+				"id":           name,
+				"display_name": name,
+				"created_at":   time.Unix(0, 0).UTC().Format(time.RFC3339),
+			})
+		}
+		list := map[string]any{"data": data, "has_more": false}
+		if len(names) > 0 {
+			list["first_id"], list["last_id"] = names[0], names[len(names)-1]
+		}
+		body = list
+	case "gemini":
+		data := make([]map[string]string, 0, len(names))
+		for _, name := range names {
+			data = append(data, map[string]string{"name": "models/" + name})
+		}
+		body = map[string]any{"models": data}
+	default:
+		data := make([]map[string]any, 0, len(names))
+		for _, name := range names {
+			data = append(data, openAIModelEntry(name))
+		}
+		body = map[string]any{"object": "list", "data": data}
+	}
+	data, _ := json.Marshal(body)
+	return jsonResponse(req, http.StatusOK, data)
+}
+
+// openAIModelEntry returns the OpenAI model object of a local model name.
+func openAIModelEntry(name string) map[string]any {
+	return map[string]any{"id": name, "object": "model", "created": 0, "owned_by": "hydrallm"}
+}
+
+// mergeModelList adds the listener's model names missing from an OpenAI model
+// list response ahead of the upstream entries. Responses that are not a model
+// list are left intact.
+func mergeModelList(resp *http.Response, s *transportState) {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	defer func() {
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		resp.ContentLength = int64(len(respBody))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(respBody)))
+	}()
+	if err != nil {
+		return
+	}
+
+	var list struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(respBody, &list) != nil || list.Data == nil {
+		return
+	}
+	upstream := make(map[string]bool, len(list.Data))
+	for _, entry := range list.Data {
+		var m struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(entry, &m)
+		upstream[m.ID] = true
+	}
+	var data []any
+	for _, name := range s.localModelNames() {
+		if !upstream[name] {
+			data = append(data, openAIModelEntry(name))
+		}
+	}
+	for _, entry := range list.Data {
+		data = append(data, entry)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if out, err := sjson.SetRawBytes(respBody, "data", raw); err == nil {
+		respBody = out
+	}
+}
@@ -0,0 +1,119 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestLocalModelNames(t *testing.T) {
+	state := &transportState{
+		listener: &Listener{},
+		models:   []Model{{ID: "primary", Model: "gpt-5"}, {ID: "backup", Model: "gpt-5"}},
+		routes: map[string][]Model{
+			"gpt-4o-mini": {{ID: "mini"}},
+			"gpt-4o":      {{ID: "4o"}},
+		},
+	}
+	expected := []string{"primary", "backup", "gpt-4o", "gpt-4o-mini"}
+	if got := state.localModelNames(); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	state.listener.Dispatch = dispatchPassthrough
+	if got := state.localModelNames(); !slices.Equal(got, []string{"gpt-5"}) {
+		t.Errorf("expected passthrough names, got %v", got)
+	}
+}
+
+func TestLocalModelList(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	tests := []struct {
+		configType string
+		path       string
+	}{
+		{"openai", "data.#.id"},
+		{"anthropic", "data.#.id"},
+		{"gemini", "models.#.name"},
+	}
+	for _, tt := range tests {
+		state := &transportState{
+			listener: &Listener{ConfigType: tt.configType},
+			models:   []Model{{ID: "m1"}, {ID: "m2"}},
+		}
+		resp := localModelList(req, state)
+		body, _ := io.ReadAll(resp.Body)
+		if got := gjson.GetBytes(body, tt.path).Array(); len(got) != 2 {
+			t.Errorf("%s: expected 2 models, got %s", tt.configType, body)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_ModelList(t *testing.T) {
+	var calls int
+	status := http.StatusOK
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"gpt-5"},{"id":"primary"}]}`))
+	}))
+	defer upstream.Close()
+
+	providers := map[string]Provider{
+		"openai": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+	}
+	model := func(id string) Model {
+		return Model{
+			ID:       id,
+			Provider: "openai",
+			Model:    "gpt-5",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	newTransport := func(mode string) *RetryTransport {
+		l := &Listener{
+			Name:           "models",
+			ConfigType:     "openai",
+			ModelList:      mode,
+			ResolvedModels: []Model{model("primary"), model("backup")},
+		}
+		return newListenerTransport(l, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+	}
+	list := func(transport *RetryTransport) string {
+		t.Helper()
+		resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+		}
+		return gjson.GetBytes(body, "data.#.id").String()
+	}
+
+	if got := list(newTransport(modelListLocal)); got != `["primary","backup"]` || calls != 0 {
+		t.Errorf("expected local list without upstream calls, got %s after %d calls", got, calls)
+	}
+	if got := list(newTransport(modelListMerged)); got != `["backup","gpt-5","primary"]` {
+		t.Errorf("expected merged list, got %s", got)
+	}
+	if got := list(newTransport(modelListUpstream)); got != `["gpt-5","primary"]` {
+		t.Errorf("expected upstream list, got %s", got)
+	}
+
+	// A failing upstream still leaves the listener's models
+	status = http.StatusInternalServerError
+	if got := list(newTransport(modelListMerged)); got != `["primary","backup"]` {
+		t.Errorf("expected local list on upstream failure, got %s", got)
+	}
+}
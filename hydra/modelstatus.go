@@ -0,0 +1,138 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/sjson"
+)
+
+// Listener unavailable_models modes, applied to model list responses.
+const (
+	unavailableModelsOff      = "off"      // Forward the list as-is
+	unavailableModelsOmit     = "omit"     // Drop models whose providers are cooling down
+	unavailableModelsAnnotate = "annotate" // Add a hydrallm_status object to them
+)
+
+func isSupportedUnavailableModels(mode string) bool {
+	switch mode {
+	case unavailableModelsOff, unavailableModelsOmit, unavailableModelsAnnotate:
+		return true
+	default:
+		return false
+	}
+}
+
+// modelAvailability is the hydrallm_status object of an annotated model.
+type modelAvailability struct {
+	State       string    `json:"state"` // Always saturated
+	AvailableAt time.Time `json:"available_at"`
+}
+
+// unavailableModels returns the upstream model names of a listener whose
+// providers all asked clients to back off, with the time the earliest of them
+// becomes available again. A name served by any provider in good standing is
+// left out.
+func (s *transportState) unavailableModels(
+	quotas map[string]ProviderQuota,
+	now time.Time,
+) map[string]modelAvailability {
+	chains := [][]Model{s.models, s.experiment}
+	for _, chain := range s.routes {
+		chains = append(chains, chain)
+	}
+	for _, r := range s.promptRoutes {
+		chains = append(chains, r.chain)
+	}
+
+	unavailable := make(map[string]modelAvailability)
+	available := make(map[string]bool)
+	for _, chain := range chains {
+		for _, m := range chain {
+			quota := quotas[m.Provider]
+			if !quota.Saturated(now) {
+				available[m.Model] = true
+				continue
+			}
+			a, ok := unavailable[m.Model]
+			if !ok || quota.SaturatedUntil.Before(a.AvailableAt) {
+				unavailable[m.Model] = modelAvailability{
+					State:       "saturated",
+					AvailableAt: *quota.SaturatedUntil,
+				}
+			}
+		}
+	}
+	for name := range available {
+		delete(unavailable, name)
+	}
+	return unavailable
+}
+
+// isModelListRequest reports whether req lists models, as in GET /v1/models.
+func isModelListRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/models")
+}
+
+// markUnavailableModels omits or annotates the models of a model list response
+// whose providers are cooling down, as set by the listener's
+// unavailable_models. Responses that are not a model list are left intact.
+func markUnavailableModels(resp *http.Response, state *transportState, mode string) {
+	if mode == "" || mode == unavailableModelsOff || resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	unavailable := state.unavailableModels(providerQuotas.snapshot(), time.Now())
+	if len(unavailable) == 0 {
+		return
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	defer func() {
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		resp.ContentLength = int64(len(respBody))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(respBody)))
+	}()
+	if err != nil {
+		return
+	}
+
+	var list struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(respBody, &list) != nil || list.Data == nil {
+		return
+	}
+	data := make([]json.RawMessage, 0, len(list.Data))
+	for _, entry := range list.Data {
+		var m struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(entry, &m)
+		a, ok := unavailable[m.ID]
+		switch {
+		case !ok:
+			data = append(data, entry)
+		case mode == unavailableModelsAnnotate:
+			annotated, err := sjson.SetBytes(entry, "hydrallm_status", a)
+			if err != nil {
+				annotated = entry
+			}
+			data = append(data, annotated)
+		}
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if out, err := sjson.SetRawBytes(respBody, "data", raw); err == nil {
+		respBody = out
+	}
+}
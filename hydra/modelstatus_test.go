@@ -0,0 +1,77 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnavailableModels(t *testing.T) {
+	now := time.Now()
+	soon, later := now.Add(time.Minute), now.Add(time.Hour)
+	quotas := map[string]ProviderQuota{
+		"hot":  {SaturatedUntil: &later},
+		"warm": {SaturatedUntil: &soon},
+		"past": {SaturatedUntil: &now},
+	}
+	state := &transportState{
+		models: []Model{
+			{Provider: "hot", Model: "gpt-4o"},
+			{Provider: "hot", Model: "shared"},
+			{Provider: "ok", Model: "shared"},
+			{Provider: "past", Model: "recovered"},
+		},
+		routes: map[string][]Model{"small": {{Provider: "warm", Model: "gpt-4o"}}},
+	}
+
+	got := state.unavailableModels(quotas, now)
+	if len(got) != 1 {
+		t.Fatalf("expected only gpt-4o to be unavailable, got %+v", got)
+	}
+	if a := got["gpt-4o"]; a.State != "saturated" || !a.AvailableAt.Equal(soon) {
+		t.Errorf("expected earliest availability, got %+v", a)
+	}
+}
+
+func TestMarkUnavailableModels(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	providerQuotas.saturate("model-status-test", until)
+	state := &transportState{
+		models: []Model{{Provider: "model-status-test", Model: "gpt-4o"}},
+	}
+	body := `{"object":"list","data":[{"id":"gpt-4o","object":"model"},` +
+		`{"id":"gpt-4o-mini","object":"model"}]}`
+
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{unavailableModelsOff, body},
+		{
+			unavailableModelsOmit,
+			`{"object":"list","data":[{"id":"gpt-4o-mini","object":"model"}]}`,
+		},
+		{
+			unavailableModelsAnnotate,
+			`{"object":"list","data":[{"id":"gpt-4o","object":"model","hydrallm_status":` +
+				`{"state":"saturated","available_at":"` + until.Format(time.RFC3339Nano) + `"}},` +
+				`{"id":"gpt-4o-mini","object":"model"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}
+			markUnavailableModels(resp, state, tt.mode)
+			got, _ := io.ReadAll(resp.Body)
+			if string(got) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
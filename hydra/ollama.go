@@ -0,0 +1,358 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ollamaRequest is an Ollama /api/chat request body.
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"` // Ollama streams unless told not to
+	Tools     []openAITool    `json:"tools,omitempty"`
+	Options   *ollamaOptions  `json:"options,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"` // Base64, without a data URL prefix
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // An object, not a string
+	} `json:"function"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// ollamaResponse is a complete /api/chat response, or one line of a stream.
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// usage converts the token counts of a final response.
+func (r *ollamaResponse) usage() *openAIUsage {
+	return &openAIUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// translateOllamaRequest converts an OpenAI chat completions body to an Ollama
+// /api/chat body, with the model's keep_alive and num_ctx.
+func translateOllamaRequest(body []byte, model Model) ([]byte, error) {
+	var in openAIChatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, fmt.Errorf("failed to decode chat completions request: %w", err)
+	}
+
+	out := ollamaRequest{
+		Model:     model.Model,
+		Messages:  []ollamaMessage{},
+		Stream:    in.Stream,
+		KeepAlive: model.KeepAlive,
+	}
+	options := ollamaOptions{
+		Temperature: in.Temperature,
+		TopP:        in.TopP,
+		NumPredict:  cmp.Or(in.MaxCompletionTokens, in.MaxTokens),
+		NumCtx:      model.NumCtx,
+	}
+	stop, err := decodeStop(in.Stop)
+	if err != nil {
+		return nil, err
+	}
+	options.Stop = stop
+	if options.Temperature != nil || options.TopP != nil || options.NumPredict > 0 ||
+		options.NumCtx > 0 || len(stop) > 0 {
+		out.Options = &options
+	}
+
+	// Tool results name their function, not the call's ID
+	toolNames := make(map[string]string)
+	for _, msg := range in.Messages {
+		switch msg.Role {
+		case "system", "developer", "tool":
+			text, err := contentText(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			role := msg.Role
+			if role == "developer" {
+				role = "system"
+			}
+			out.Messages = append(out.Messages, ollamaMessage{
+				Role:     role,
+				Content:  text,
+				ToolName: toolNames[msg.ToolCallID],
+			})
+		case "user", "assistant":
+			blocks, err := contentBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			m := ollamaMessage{Role: msg.Role}
+			var texts []string
+			for _, b := range blocks {
+				if b.Type == "text" {
+					texts = append(texts, b.Text)
+					continue
+				}
+				if b.Source.Type != "base64" {
+					return nil, errors.New("ollama models only accept images as data URLs")
+				}
+				m.Images = append(m.Images, b.Source.Data)
+			}
+			m.Content = strings.Join(texts, "\n")
+			for _, call := range msg.ToolCalls {
+				args := json.RawMessage(call.Function.Arguments)
+				if len(bytes.TrimSpace(args)) == 0 {
+					args = json.RawMessage("{}")
+				}
+				if !json.Valid(args) {
+					return nil, fmt.Errorf("tool call %q: arguments are not valid JSON", call.ID)
+				}
+				toolNames[call.ID] = call.Function.Name
+				var tc ollamaToolCall
+				tc.Function.Name, tc.Function.Arguments = call.Function.Name, args
+				m.ToolCalls = append(m.ToolCalls, tc)
+			}
+			out.Messages = append(out.Messages, m)
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", msg.Role)
+		}
+	}
+
+	// Ollama has no tool_choice; none is honored by leaving the tools out
+	choice, err := decodeToolChoice(in.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+	if choice == nil || choice.Type != "none" {
+		out.Tools = in.Tools
+	}
+
+	return json.Marshal(out)
+}
+
+// withOllamaOptions adds a model's keep_alive and num_ctx to a native Ollama
+// request body, unless the client set them.
+func withOllamaOptions(body []byte, model Model) ([]byte, error) {
+	if !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() {
+		return body, nil
+	}
+	var err error
+	if model.KeepAlive != "" && !gjson.GetBytes(body, "keep_alive").Exists() {
+		if body, err = sjson.SetBytes(body, "keep_alive", model.KeepAlive); err != nil {
+			return nil, err
+		}
+	}
+	if model.NumCtx > 0 && !gjson.GetBytes(body, "options.num_ctx").Exists() {
+		if body, err = sjson.SetBytes(body, "options.num_ctx", model.NumCtx); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// ollamaFinishReason maps an Ollama done reason to an OpenAI finish reason.
+func ollamaFinishReason(reason string, toolCalls bool) string {
+	if reason == "length" {
+		return "length"
+	}
+	if toolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// ollamaToolCalls converts the tool calls of a message, numbering them from
+// first since Ollama assigns no IDs.
+func ollamaToolCalls(calls []ollamaToolCall, first int, indexed bool) []openAIToolCall {
+	out := make([]openAIToolCall, 0, len(calls))
+	for i, call := range calls {
+		idx := first + i
+		tc := openAIToolCall{
+			ID:   "call_" + strconv.Itoa(idx),
+			Type: "function",
+			Function: openAIFunctionCall{
+				Name:      call.Function.Name,
+				Arguments: cmp.Or(string(call.Function.Arguments), "{}"),
+			},
+		}
+		if indexed {
+			tc.Index = &idx
+		}
+		out = append(out, tc)
+	}
+	return out
+}
+
+// translateOllamaResponse converts a complete /api/chat response body.
+// It returns nil if the body is not a chat response.
+func translateOllamaResponse(body []byte, model Model) []byte {
+	var in ollamaResponse
+	if err := json.Unmarshal(body, &in); err != nil || !in.Done {
+		return nil
+	}
+
+	msg := &openAIResponseMessage{
+		Role:      "assistant",
+		ToolCalls: ollamaToolCalls(in.Message.ToolCalls, 0, false),
+	}
+	if in.Message.Content != "" || len(msg.ToolCalls) == 0 {
+		content := in.Message.Content
+		msg.Content = &content
+	}
+
+	reason := ollamaFinishReason(in.DoneReason, len(msg.ToolCalls) > 0)
+	out := openAIChatResponse{
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   cmp.Or(in.Model, model.Model),
+		Choices: []openAIChoice{{Message: msg, FinishReason: &reason}},
+		Usage:   in.usage(),
+	}
+	translated, err := json.Marshal(out)
+	if err != nil {
+		return nil
+	}
+	return translated
+}
+
+// translateOllamaError converts an Ollama error body to the OpenAI error format.
+// It returns nil if the body is not an Ollama error.
+func translateOllamaError(body []byte) []byte {
+	var in ollamaResponse
+	if err := json.Unmarshal(body, &in); err != nil || in.Error == "" {
+		return nil
+	}
+	translated, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": in.Error,
+			"type":    "api_error",
+			"code":    nil,
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	return translated
+}
+
+// translateOllamaStream converts an Ollama NDJSON stream to OpenAI chat
+// completion chunks. The finish chunk and [DONE] are written for the final
+// line, so a stream cut off before it is left incomplete for stream repair.
+func translateOllamaStream(r io.Reader, w io.Writer, model Model, includeUsage bool) error {
+	var (
+		modelName = model.Model
+		created   = time.Now().Unix()
+		started   bool
+		toolCalls int
+	)
+
+	writeChunk := func(delta *openAIDelta, reason *string, u *openAIUsage) error {
+		chunk := openAIChatResponse{
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   modelName,
+			Choices: []openAIChoice{},
+			Usage:   u,
+		}
+		if delta != nil {
+			chunk.Choices = append(chunk.Choices, openAIChoice{Delta: delta, FinishReason: reason})
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var line ollamaResponse
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		if line.Error != "" {
+			data, _ := json.Marshal(map[string]string{"message": line.Error})
+			if _, err := fmt.Fprintf(w, "data: {\"error\":%s}\n\n", data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !started {
+			started = true
+			modelName = cmp.Or(line.Model, modelName)
+			empty := ""
+			err := writeChunk(&openAIDelta{Role: "assistant", Content: &empty}, nil, nil)
+			if err != nil {
+				return err
+			}
+		}
+		if text := line.Message.Content; text != "" {
+			if err := writeChunk(&openAIDelta{Content: &text}, nil, nil); err != nil {
+				return err
+			}
+		}
+		if len(line.Message.ToolCalls) > 0 {
+			calls := ollamaToolCalls(line.Message.ToolCalls, toolCalls, true)
+			toolCalls += len(calls)
+			if err := writeChunk(&openAIDelta{ToolCalls: calls}, nil, nil); err != nil {
+				return err
+			}
+		}
+		if !line.Done {
+			continue
+		}
+
+		reason := ollamaFinishReason(line.DoneReason, toolCalls > 0)
+		if err := writeChunk(&openAIDelta{}, &reason, nil); err != nil {
+			return err
+		}
+		if includeUsage {
+			if err := writeChunk(nil, nil, line.usage()); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "data: [DONE]\n\n")
+		return err
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,244 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestTranslateOllamaRequest(t *testing.T) {
+	body := `{
+		"model": "placeholder",
+		"max_tokens": 256,
+		"stop": "END",
+		"messages": [
+			{"role": "developer", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function",
+				 "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup"}}]
+	}`
+	model := Model{Model: "qwen3:8b", Type: "ollama", KeepAlive: "30m", NumCtx: 32768}
+
+	out, err := translateOllamaRequest([]byte(body), model)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got ollamaRequest
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("invalid output JSON: %v", err)
+	}
+
+	if got.Model != "qwen3:8b" || got.KeepAlive != "30m" || len(got.Tools) != 1 {
+		t.Errorf("unexpected request: %s", out)
+	}
+	if !gjson.GetBytes(out, "stream").Exists() || got.Stream {
+		t.Errorf("expected stream set to false, got %s", out)
+	}
+	if got.Options == nil || got.Options.NumPredict != 256 || got.Options.NumCtx != 32768 ||
+		len(got.Options.Stop) != 1 {
+		t.Errorf("unexpected options: %+v", got.Options)
+	}
+	if len(got.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(got.Messages))
+	}
+	if got.Messages[0].Role != "system" {
+		t.Errorf("expected developer message as system, got %+v", got.Messages[0])
+	}
+	user := got.Messages[1]
+	if user.Content != "What is in this image?" || len(user.Images) != 1 ||
+		user.Images[0] != "AAAA" {
+		t.Errorf("unexpected user message: %+v", user)
+	}
+	call := got.Messages[2].ToolCalls
+	if len(call) != 1 || string(call[0].Function.Arguments) != `{"q":"cat"}` {
+		t.Errorf("expected arguments as an object, got %+v", call)
+	}
+	if result := got.Messages[3]; result.ToolName != "lookup" || result.Content != "a cat" {
+		t.Errorf("unexpected tool result: %+v", result)
+	}
+
+	out, err = translateOllamaRequest(
+		[]byte(`{"tool_choice":"none","tools":[{"type":"function","function":{"name":"f"}}],`+
+			`"messages":[{"role":"user","content":"hi"}]}`),
+		Model{Model: "qwen3:8b"},
+	)
+	if err != nil || gjson.GetBytes(out, "tools").Exists() ||
+		gjson.GetBytes(out, "options").Exists() {
+		t.Errorf("expected no tools and no options, got %s (%v)", out, err)
+	}
+
+	_, err = translateOllamaRequest([]byte(`{"messages":[{"role":"user","content":[`+
+		`{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}]}`), model)
+	if err == nil {
+		t.Error("expected an error for an image URL")
+	}
+}
+
+func TestWithOllamaOptions(t *testing.T) {
+	model := Model{KeepAlive: "10m", NumCtx: 8192}
+	out, err := withOllamaOptions([]byte(`{"model":"m","keep_alive":"0"}`), model)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := gjson.GetBytes(out, "keep_alive").String(); got != "0" {
+		t.Errorf("expected the client's keep_alive kept, got %q", got)
+	}
+	if got := gjson.GetBytes(out, "options.num_ctx").Int(); got != 8192 {
+		t.Errorf("expected num_ctx 8192, got %d", got)
+	}
+	if out, _ := withOllamaOptions(nil, model); len(out) != 0 {
+		t.Errorf("expected an empty body left alone, got %s", out)
+	}
+}
+
+func TestTranslateOllamaResponse(t *testing.T) {
+	body := `{"model":"qwen3:8b","message":{"role":"assistant","content":"",` +
+		`"tool_calls":[{"function":{"name":"lookup","arguments":{"q":"cat"}}}]},` +
+		`"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":2}`
+
+	var out openAIChatResponse
+	if err := json.Unmarshal(translateOllamaResponse([]byte(body), Model{}), &out); err != nil {
+		t.Fatalf("invalid translated response: %v", err)
+	}
+	msg := out.Choices[0].Message
+	if out.Model != "qwen3:8b" || msg.Content != nil {
+		t.Errorf("unexpected response: %+v", out)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "call_0" ||
+		msg.ToolCalls[0].Function.Arguments != `{"q":"cat"}` {
+		t.Errorf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	if *out.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("expected finish_reason tool_calls, got %s", *out.Choices[0].FinishReason)
+	}
+	if out.Usage == nil || out.Usage.TotalTokens != 6 {
+		t.Errorf("unexpected usage: %+v", out.Usage)
+	}
+
+	if translateOllamaResponse([]byte(`{"models":[]}`), Model{}) != nil {
+		t.Error("expected nil for a body that is not a chat response")
+	}
+}
+
+func TestTranslateOllamaError(t *testing.T) {
+	body := `{"error":"model \"qwen3:8b\" not found, try pulling it first"}`
+	want := `{"error":{"code":null,"message":"model \"qwen3:8b\" not found, try pulling it first",` +
+		`"type":"api_error"}}`
+	if got := string(translateOllamaError([]byte(body))); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+const ollamaStreamFixture = `{"model":"qwen3:8b","message":{"role":"assistant","content":"Hel"},"done":false}
+{"model":"qwen3:8b","message":{"role":"assistant","content":"lo"},"done":false}
+{"model":"qwen3:8b","message":{"role":"assistant","content":""},"done":true,` +
+	`"done_reason":"length","prompt_eval_count":3,"eval_count":2}
+`
+
+func TestTranslateOllamaStream(t *testing.T) {
+	var out bytes.Buffer
+	err := translateOllamaStream(strings.NewReader(ollamaStreamFixture), &out, Model{}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		`"role":"assistant"`,
+		`"content":"Hel"`,
+		`"content":"lo"`,
+		`"finish_reason":"length"`,
+		`"total_tokens":5`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in stream, got:\n%s", want, got)
+		}
+	}
+	if !strings.HasSuffix(got, "data: [DONE]\n\n") {
+		t.Errorf("expected [DONE] terminator, got:\n%s", got)
+	}
+
+	// A stream cut off before its final line is left without a terminator
+	out.Reset()
+	first, _, _ := strings.Cut(ollamaStreamFixture, "\n")
+	_ = translateOllamaStream(strings.NewReader(first+"\n"), &out, Model{}, false)
+	if strings.Contains(out.String(), "[DONE]") {
+		t.Errorf("expected no terminator for an interrupted stream, got:\n%s", out.String())
+	}
+}
+
+func TestTransport_RoundTrip_TranslatesToOllama(t *testing.T) {
+	var gotPath string
+	var gotBody []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte(ollamaStreamFixture))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:        "m1",
+			Provider:  "ollama",
+			Model:     "qwen3:8b",
+			Type:      "ollama",
+			Attempts:  1,
+			Timeout:   time.Second,
+			KeepAlive: "30m",
+		},
+	}
+	providers := map[string]Provider{
+		"ollama": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"stream":true,"messages":[{"role":"user","content":"hello"}]}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if gotPath != "/api/chat" {
+		t.Errorf("unexpected upstream path %s", gotPath)
+	}
+	if gjson.GetBytes(gotBody, "keep_alive").String() != "30m" ||
+		!gjson.GetBytes(gotBody, "stream").Bool() {
+		t.Errorf("unexpected upstream body %s", gotBody)
+	}
+	if resp.Header.Get("Content-Type") != "text/event-stream" ||
+		!strings.Contains(string(body), `"content":"Hel"`) ||
+		!strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("unexpected translated stream:\n%s", body)
+	}
+}
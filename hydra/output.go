@@ -0,0 +1,357 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// outputPaths are the generation endpoints whose requests get a model's stop
+// sequences and whose responses get its output rules.
+var outputPaths = []string{
+	"/chat/completions",
+	"/completions",
+	"/messages",
+	":generateContent",
+	":streamGenerateContent",
+}
+
+func isOutputPath(path string) bool {
+	path = strings.TrimRight(path, "/")
+	return slices.ContainsFunc(outputPaths, func(suffix string) bool {
+		return strings.HasSuffix(path, suffix)
+	})
+}
+
+// OutputConfig normalizes the text a model generates, so fallback models that
+// open with a preamble or a role prefix answer like the others.
+type OutputConfig struct {
+	TrimPrefixes []string        `mapstructure:"trim_prefixes"` // Removed from the start of the text
+	TrimSpace    bool            `mapstructure:"trim_space"`    // Leading and trailing whitespace
+	Replace      []OutputReplace `mapstructure:"replace"`       // Applied in order
+}
+
+// OutputReplace replaces the matches of a regular expression. With may refer
+// to submatches as $1 or ${name}.
+type OutputReplace struct {
+	Pattern string `mapstructure:"pattern"`
+	With    string `mapstructure:"with"`
+
+	Parsed *regexp.Regexp `mapstructure:"-"`
+}
+
+// enabled reports whether any rule is set.
+func (c OutputConfig) enabled() bool {
+	return len(c.TrimPrefixes) > 0 || c.TrimSpace || len(c.Replace) > 0
+}
+
+// trimLeading removes leading whitespace and prefixes from text, repeatedly.
+// Unless final, it reports false while text may still grow into a prefix, or
+// is only whitespace to be trimmed, so the caller holds it back.
+func (c OutputConfig) trimLeading(text string, final bool) (string, bool) {
+	for {
+		if c.TrimSpace {
+			text = strings.TrimLeftFunc(text, unicode.IsSpace)
+			if text == "" && !final {
+				return "", false
+			}
+		}
+		stripped := false
+		for _, prefix := range c.TrimPrefixes {
+			if strings.HasPrefix(text, prefix) {
+				text, stripped = text[len(prefix):], true
+				break
+			}
+			if !final && strings.HasPrefix(prefix, text) {
+				return "", false
+			}
+		}
+		if !stripped {
+			return text, true
+		}
+	}
+}
+
+func (c OutputConfig) replace(text string) string {
+	for _, r := range c.Replace {
+		text = r.Parsed.ReplaceAllString(text, r.With)
+	}
+	return text
+}
+
+// shape applies all rules to a complete text.
+func (c OutputConfig) shape(text string) string {
+	text, _ = c.trimLeading(text, true)
+	text = c.replace(text)
+	if c.TrimSpace {
+		text = strings.TrimRightFunc(text, unicode.IsSpace)
+	}
+	return text
+}
+
+// outputShaper applies the rules to a text arriving in deltas. The start of
+// the text is held until its prefixes are settled, and trailing whitespace
+// until more text follows it. Replacements apply to each delta on its own.
+type outputShaper struct {
+	c       OutputConfig
+	started bool
+	head    string // Start of the text, held while it may be a prefix
+	space   string // Trailing whitespace, held while trim_space is set
+}
+
+// push returns the text to forward for a delta.
+func (s *outputShaper) push(delta string) string {
+	if !s.started {
+		s.head += delta
+		text, settled := s.c.trimLeading(s.head, false)
+		if !settled {
+			return ""
+		}
+		s.started, s.head, delta = true, "", text
+	}
+	delta = s.c.replace(delta)
+	if s.c.TrimSpace {
+		delta = s.space + delta
+		trimmed := strings.TrimRightFunc(delta, unicode.IsSpace)
+		s.space, delta = delta[len(trimmed):], trimmed
+	}
+	return delta
+}
+
+// flush returns the text still held at the end of the text.
+func (s *outputShaper) flush() string {
+	s.space = ""
+	if s.started {
+		return ""
+	}
+	s.started = true
+	text := s.c.shape(s.head)
+	s.head = ""
+	return text
+}
+
+// withStopSequences adds a model's stop sequences to a request body, after
+// those the client sent. Bodies translated to another format carry them in
+// the OpenAI stop field.
+func withStopSequences(body []byte, model Model, translate bool) ([]byte, error) {
+	field := "stop"
+	switch {
+	case translate:
+	case model.Type == "anthropic":
+		field = "stop_sequences"
+	case model.Type == "gemini":
+		field = "generationConfig.stopSequences"
+	}
+	stop, err := decodeStop(json.RawMessage(gjson.GetBytes(body, field).Raw))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range model.Stop {
+		if !slices.Contains(stop, s) {
+			stop = append(stop, s)
+		}
+	}
+	return sjson.SetBytes(body, field, stop)
+}
+
+// shapeOutput applies a model's output rules to the text of a successful
+// OpenAI or Anthropic response. Other responses are left intact.
+func shapeOutput(resp *http.Response, c OutputConfig, isStreaming bool) {
+	if !c.enabled() || resp.StatusCode >= 300 || resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	if isStreaming {
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			resp.Body = newOutputStream(resp.Body, c)
+		}
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	defer func() {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}()
+	if err != nil {
+		return
+	}
+	var paths []string
+	gjson.GetBytes(body, "choices").ForEach(func(i, choice gjson.Result) bool {
+		for _, field := range []string{"message.content", "text"} {
+			if choice.Get(field).Type == gjson.String {
+				paths = append(paths, "choices."+i.String()+"."+field)
+			}
+		}
+		return true
+	})
+	gjson.GetBytes(body, "content").ForEach(func(i, block gjson.Result) bool {
+		if block.Get("type").String() == "text" {
+			paths = append(paths, "content."+i.String()+".text")
+		}
+		return true
+	})
+	for _, path := range paths {
+		text := c.shape(gjson.GetBytes(body, path).String())
+		if out, err := sjson.SetBytes(body, path, text); err == nil {
+			body = out
+		}
+	}
+}
+
+// outputStream applies output rules to the text deltas of an OpenAI or
+// Anthropic server-sent event stream, with one shaper per choice or content
+// block.
+type outputStream struct {
+	src io.ReadCloser
+	c   OutputConfig
+
+	raw     bytes.Buffer // Upstream bytes not yet forming a complete event
+	pending bytes.Buffer // Bytes ready for the client
+	chunk   []byte
+	done    bool
+
+	shapers map[int64]*outputShaper
+}
+
+func newOutputStream(src io.ReadCloser, c OutputConfig) *outputStream {
+	return &outputStream{
+		src:     src,
+		c:       c,
+		chunk:   make([]byte, 4096),
+		shapers: make(map[int64]*outputShaper),
+	}
+}
+
+func (s *outputStream) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		n, err := s.src.Read(s.chunk)
+		s.raw.Write(s.chunk[:n])
+		s.forwardEvents()
+		if err != nil {
+			s.pending.Write(s.raw.Bytes())
+			s.raw.Reset()
+			s.done = true
+		}
+	}
+	return s.pending.Read(p)
+}
+
+func (s *outputStream) Close() error {
+	s.done = true
+	return s.src.Close()
+}
+
+// forwardEvents rewrites every complete event in raw into pending.
+func (s *outputStream) forwardEvents() {
+	for {
+		b := s.raw.Bytes()
+		end, sep := bytes.Index(b, []byte("\n\n")), 2
+		if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 && (end < 0 || i < end) {
+			end, sep = i, 4
+		}
+		if end < 0 {
+			return
+		}
+		s.rewrite(b[:end], b[:end+sep])
+		s.raw.Next(end + sep)
+	}
+}
+
+func (s *outputStream) shaper(index int64) *outputShaper {
+	sh, ok := s.shapers[index]
+	if !ok {
+		sh = &outputShaper{c: s.c}
+		s.shapers[index] = sh
+	}
+	return sh
+}
+
+// rewrite writes an event to pending with its text deltas shaped. Events
+// without JSON data are forwarded as-is.
+func (s *outputStream) rewrite(event, full []byte) {
+	var fields [][]byte
+	var data []byte
+	for line := range bytes.SplitSeq(event, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(payload, []byte(" "))...)
+		} else {
+			fields = append(fields, line)
+		}
+	}
+	if !gjson.ValidBytes(data) || !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		s.pending.Write(full)
+		return
+	}
+
+	out := data
+	set := func(path, value string) {
+		if b, err := sjson.SetBytes(out, path, value); err == nil {
+			out = b
+		}
+	}
+	switch gjson.GetBytes(data, "type").String() {
+	case "content_block_delta":
+		if gjson.GetBytes(data, "delta.type").String() == "text_delta" {
+			index := gjson.GetBytes(data, "index").Int()
+			set("delta.text", s.shaper(index).push(gjson.GetBytes(data, "delta.text").String()))
+		}
+	case "content_block_stop":
+		index := gjson.GetBytes(data, "index").Int()
+		if sh, ok := s.shapers[index]; ok {
+			if rest := sh.flush(); rest != "" {
+				delta, _ := json.Marshal(map[string]any{
+					"type":  "content_block_delta",
+					"index": index,
+					"delta": map[string]string{"type": "text_delta", "text": rest},
+				})
+				s.pending.WriteString("event: content_block_delta\ndata: ")
+				s.pending.Write(delta)
+				s.pending.WriteString("\n\n")
+			}
+			delete(s.shapers, index)
+		}
+	case "":
+		gjson.GetBytes(data, "choices").ForEach(func(i, choice gjson.Result) bool {
+			index := choice.Get("index").Int()
+			content := choice.Get("delta.content")
+			finished := choice.Get("finish_reason").Exists() &&
+				choice.Get("finish_reason").Type != gjson.Null
+			if content.Type != gjson.String && !finished {
+				return true
+			}
+			sh := s.shaper(index)
+			text := sh.push(content.String())
+			if finished {
+				text += sh.flush()
+				delete(s.shapers, index)
+			}
+			if content.Type == gjson.String || text != "" {
+				set("choices."+i.String()+".delta.content", text)
+			}
+			return true
+		})
+	}
+
+	for _, f := range fields {
+		s.pending.Write(f)
+		s.pending.WriteString("\n")
+	}
+	s.pending.WriteString("data: ")
+	s.pending.Write(out)
+	s.pending.WriteString("\n\n")
+}
@@ -0,0 +1,205 @@
+package hydra
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func testOutputConfig() OutputConfig {
+	return OutputConfig{
+		TrimPrefixes: []string{"Assistant:", "Sure! "},
+		TrimSpace:    true,
+		Replace: []OutputReplace{
+			{Pattern: `</?answer>`, With: "", Parsed: regexp.MustCompile(`</?answer>`)},
+		},
+	}
+}
+
+func TestOutputConfig_Shape(t *testing.T) {
+	c := testOutputConfig()
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"Hello", "Hello"},
+		{"  Assistant: Hello  \n", "Hello"},
+		{"Sure! Assistant:<answer>42</answer>", "42"},
+		{"Assistance", "Assistance"},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := c.shape(tt.in); got != tt.expected {
+			t.Errorf("shape(%q) = %q, want %q", tt.in, got, tt.expected)
+		}
+	}
+}
+
+func TestOutputShaper(t *testing.T) {
+	tests := []struct {
+		name     string
+		deltas   []string
+		expected string
+	}{
+		{"split prefix", []string{"\n Assi", "stant:", " Hello", " world", "  \n"}, "Hello world"},
+		{"no prefix", []string{"Ass", "ert this"}, "Assert this"},
+		{"inner whitespace", []string{"a ", " ", "b"}, "a  b"},
+		{"held to the end", []string{"Assist"}, "Assist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &outputShaper{c: testOutputConfig()}
+			var out strings.Builder
+			for _, d := range tt.deltas {
+				out.WriteString(s.push(d))
+			}
+			out.WriteString(s.flush())
+			if out.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestWithStopSequences(t *testing.T) {
+	tests := []struct {
+		name      string
+		modelType string
+		translate bool
+		body      string
+		path      string
+		expected  string
+	}{
+		{"openai", "openai", false, `{"stop":"END"}`, "stop", `["END","\n\nUser:"]`},
+		{"translated", "anthropic", true, `{}`, "stop", `["\n\nUser:"]`},
+		{"anthropic", "anthropic", false, `{}`, "stop_sequences", `["\n\nUser:"]`},
+		{
+			"gemini",
+			"gemini",
+			false,
+			`{"generationConfig":{"stopSequences":["\n\nUser:"]}}`,
+			"generationConfig.stopSequences",
+			`["\n\nUser:"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := Model{Type: tt.modelType, Stop: []string{"\n\nUser:"}}
+			out, err := withStopSequences([]byte(tt.body), model, tt.translate)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := gjson.GetBytes(out, tt.path).Raw; got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestShapeOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+	}{
+		{
+			"openai",
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"Assistant: Hi "}}]}`,
+			"choices.0.message.content",
+		},
+		{
+			"anthropic",
+			`{"content":[{"type":"text","text":"Sure! Hi"},{"type":"tool_use","id":"t"}]}`,
+			"content.0.text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			shapeOutput(resp, testOutputConfig(), false)
+			body, _ := io.ReadAll(resp.Body)
+			if got := gjson.GetBytes(body, tt.path).String(); got != "Hi" {
+				t.Errorf("expected Hi, got %s", body)
+			}
+		})
+	}
+}
+
+// streamText joins the text deltas of an OpenAI or Anthropic event stream.
+func streamText(t *testing.T, r io.Reader) string {
+	t.Helper()
+	var text strings.Builder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		text.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+		text.WriteString(gjson.Get(data, "delta.text").String())
+	}
+	return text.String()
+}
+
+func TestOutputStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{
+			"openai",
+			`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{"content":" Assis"}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{"content":"tant: Hel"}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{"content":"lo "}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			"anthropic",
+			"event: content_block_start\n" +
+				`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` +
+				"\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Sure"}}` +
+				"\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"! Hello"}}` +
+				"\n\n" +
+				"event: content_block_stop\n" +
+				`data: {"type":"content_block_stop","index":0}` + "\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newOutputStream(io.NopCloser(strings.NewReader(tt.stream)), testOutputConfig())
+			if got := streamText(t, s); got != "Hello" {
+				t.Errorf("expected Hello, got %q", got)
+			}
+		})
+	}
+
+	// Text held back at the end of a block is sent before the block stops
+	stream := "event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Sure"}}` +
+		"\n\n" +
+		"event: content_block_stop\n" +
+		`data: {"type":"content_block_stop","index":0}` + "\n\n"
+	src := io.NopCloser(strings.NewReader(stream))
+	out, _ := io.ReadAll(newOutputStream(src, testOutputConfig()))
+	if got := streamText(t, strings.NewReader(string(out))); got != "Sure" {
+		t.Errorf("expected held text to be flushed, got %q", got)
+	}
+	if strings.LastIndex(string(out), "content_block_stop") < strings.LastIndex(string(out), `"Sure"`) {
+		t.Errorf("expected flushed text before the block stops:\n%s", out)
+	}
+}
@@ -0,0 +1,165 @@
+package hydra
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPacingMaxLag bounds how long pacing holds an event back.
+const defaultPacingMaxLag = time.Second
+
+// StreamPacingConfig spreads bursts of server-sent events over time, so
+// clients render a steady token rate instead of janky bursts.
+type StreamPacingConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // Spacing of events from a burst, 0 disables
+	MaxLag   time.Duration `mapstructure:"max_lag"`  // Longest an event is held, default 1s
+}
+
+// enabled reports whether streams are paced.
+func (c StreamPacingConfig) enabled() bool {
+	return c.Interval > 0
+}
+
+// paceStream paces a successful event stream response as set by the listener.
+// Continuations are paced by the stream they continue.
+func paceStream(ctx context.Context, resp *http.Response, c StreamPacingConfig) {
+	if !c.enabled() || ctx.Value(continuationContextKey{}) != nil ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	resp.Body = newPacedStream(resp.Body, c.Interval, cmp.Or(c.MaxLag, defaultPacingMaxLag))
+}
+
+// pacedEvent is an upstream event, or the trailing bytes and error ending the
+// stream, with the time it arrived.
+type pacedEvent struct {
+	data []byte
+	at   time.Time
+	err  error
+}
+
+// pacedStream forwards a server-sent event stream event by event, releasing
+// each at least interval after the previous one, but never later than maxLag
+// after it arrived. Events arriving spaced out pass through undelayed.
+type pacedStream struct {
+	src      io.ReadCloser
+	interval time.Duration
+	maxLag   time.Duration
+
+	events    chan pacedEvent
+	done      chan struct{}
+	closeOnce sync.Once
+
+	pending  bytes.Buffer
+	err      error
+	released time.Time // Release time of the previous event
+}
+
+func newPacedStream(src io.ReadCloser, interval, maxLag time.Duration) *pacedStream {
+	s := &pacedStream{
+		src:      src,
+		interval: interval,
+		maxLag:   maxLag,
+		events:   make(chan pacedEvent, 256),
+		done:     make(chan struct{}),
+	}
+	go s.readEvents()
+	return s
+}
+
+// readEvents splits the upstream stream into events as they arrive.
+func (s *pacedStream) readEvents() {
+	defer close(s.events)
+	var raw bytes.Buffer
+	chunk := make([]byte, 4096)
+	for {
+		n, err := s.src.Read(chunk)
+		raw.Write(chunk[:n])
+		now := time.Now()
+		for {
+			b := raw.Bytes()
+			end, sep := bytes.Index(b, []byte("\n\n")), 2
+			if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 && (end < 0 || i < end) {
+				end, sep = i, 4
+			}
+			if end < 0 {
+				break
+			}
+			if !s.send(pacedEvent{data: bytes.Clone(b[:end+sep]), at: now}) {
+				return
+			}
+			raw.Next(end + sep)
+		}
+		if err != nil {
+			s.send(pacedEvent{data: bytes.Clone(raw.Bytes()), at: now, err: err})
+			return
+		}
+	}
+}
+
+func (s *pacedStream) send(ev pacedEvent) bool {
+	select {
+	case s.events <- ev:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *pacedStream) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		var ev pacedEvent
+		var ok bool
+		select {
+		case ev, ok = <-s.events:
+		case <-s.done:
+			return 0, io.ErrClosedPipe
+		}
+		if !ok {
+			return 0, io.ErrClosedPipe
+		}
+
+		// Heartbeats pass undelayed and leave the spacing of events as it is
+		if isHeartbeat(sseFields(bytes.TrimSpace(ev.data))) && ev.err == nil {
+			s.pending.Write(ev.data)
+			continue
+		}
+
+		release := ev.at
+		if next := s.released.Add(s.interval); !s.released.IsZero() && next.After(ev.at) {
+			release = next
+			if latest := ev.at.Add(s.maxLag); release.After(latest) {
+				release = latest
+			}
+		}
+		if wait := time.Until(release); wait > 0 && len(ev.data) > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-s.done:
+				timer.Stop()
+				return 0, io.ErrClosedPipe
+			}
+		}
+		if len(ev.data) > 0 {
+			s.released = release
+		}
+		s.pending.Write(ev.data)
+		s.err = ev.err
+	}
+	return s.pending.Read(p)
+}
+
+func (s *pacedStream) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return s.src.Close()
+}
@@ -0,0 +1,125 @@
+package hydra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readPacedEvents reads a paced stream to the end and returns its events with
+// the times they were read, assuming each Read returns one event.
+func readPacedEvents(t *testing.T, s io.Reader) ([]string, []time.Time) {
+	t.Helper()
+	var events []string
+	var times []time.Time
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.Read(buf)
+		if n > 0 {
+			events = append(events, string(buf[:n]))
+			times = append(times, time.Now())
+		}
+		if err == io.EOF {
+			return events, times
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestPacedStream(t *testing.T) {
+	burst := strings.Repeat("data: {\"choices\":[]}\n\n", 5) + "data: [DONE]\n\n"
+
+	t.Run("burst is spread", func(t *testing.T) {
+		start := time.Now()
+		src := io.NopCloser(strings.NewReader(burst))
+		s := newPacedStream(src, 20*time.Millisecond, time.Second)
+		defer func() { _ = s.Close() }()
+
+		events, times := readPacedEvents(t, s)
+		if strings.Join(events, "") != burst || len(events) != 6 {
+			t.Fatalf("expected 6 events in order, got %q", events)
+		}
+		for i := 1; i < len(times); i++ {
+			if gap := times[i].Sub(times[i-1]); gap < 15*time.Millisecond {
+				t.Errorf("event %d: expected a paced gap, got %s", i, gap)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Errorf("expected the burst spread over ~100ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("max lag bounds the delay", func(t *testing.T) {
+		start := time.Now()
+		s := newPacedStream(
+			io.NopCloser(strings.NewReader(burst)),
+			time.Second,
+			30*time.Millisecond,
+		)
+		defer func() { _ = s.Close() }()
+
+		events, _ := readPacedEvents(t, s)
+		if len(events) != 6 {
+			t.Fatalf("expected 6 events, got %q", events)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected events within max lag, took %s", elapsed)
+		}
+	})
+
+	t.Run("partial trailing event", func(t *testing.T) {
+		src := "data: one\n\ndata: tw"
+		s := newPacedStream(io.NopCloser(strings.NewReader(src)), time.Millisecond, time.Second)
+		events, _ := readPacedEvents(t, s)
+		if strings.Join(events, "") != src {
+			t.Errorf("expected %q, got %q", src, events)
+		}
+	})
+
+	t.Run("close unblocks", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer func() { _ = pw.Close() }()
+		s := newPacedStream(pr, time.Millisecond, time.Second)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = s.Close()
+		}()
+		if _, err := s.Read(make([]byte, 64)); err == nil {
+			t.Error("expected error after close")
+		}
+	})
+}
+
+func TestPaceStream(t *testing.T) {
+	pacing := StreamPacingConfig{Interval: 10 * time.Millisecond}
+	newResp := func(contentType string) *http.Response {
+		return &http.Response{
+			Header: http.Header{"Content-Type": {contentType}},
+			Body:   io.NopCloser(strings.NewReader("data: {}\n\n")),
+		}
+	}
+
+	resp := newResp("text/event-stream")
+	paceStream(context.Background(), resp, pacing)
+	if _, ok := resp.Body.(*pacedStream); !ok {
+		t.Error("expected event stream to be paced")
+	}
+	_ = resp.Body.Close()
+
+	resp = newResp("application/json")
+	paceStream(context.Background(), resp, pacing)
+	if _, ok := resp.Body.(*pacedStream); ok {
+		t.Error("expected JSON response not to be paced")
+	}
+
+	resp = newResp("text/event-stream")
+	paceStream(context.Background(), resp, StreamPacingConfig{})
+	if _, ok := resp.Body.(*pacedStream); ok {
+		t.Error("expected stream not to be paced when disabled")
+	}
+}
@@ -0,0 +1,77 @@
+package hydra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Model parameter modes.
+const (
+	paramModeDefault = "default" // Set only when the request leaves the field unset
+	paramModeForce   = "force"   // Replace the value of the request
+)
+
+// ModelParam sets a field of the request bodies a model is sent, in the
+// model's own API format. Config table keys are lowercased when the config is
+// read, so object values with camelCase keys are given as JSON.
+type ModelParam struct {
+	Path  string `mapstructure:"path"`  // Field path, such as temperature or generationConfig.topP
+	Value any    `mapstructure:"value"` // TOML value
+	JSON  string `mapstructure:"json"`  // Raw JSON value, instead of value
+	Mode  string `mapstructure:"mode"`  // default or force, default default
+}
+
+func isSupportedParamMode(mode string) bool {
+	return mode == paramModeDefault || mode == paramModeForce
+}
+
+// validate checks a param and fills in its default mode.
+func (p *ModelParam) validate() error {
+	if p.Path == "" {
+		return errors.New("param path is required")
+	}
+	if (p.Value == nil) == (p.JSON == "") {
+		return fmt.Errorf("param %q: exactly one of value and json is required", p.Path)
+	}
+	if p.JSON != "" && !json.Valid([]byte(p.JSON)) {
+		return fmt.Errorf("param %q: invalid json %q", p.Path, p.JSON)
+	}
+	if p.Mode == "" {
+		p.Mode = paramModeDefault
+	}
+	if !isSupportedParamMode(p.Mode) {
+		return fmt.Errorf(
+			"param %q: unsupported mode %q (supported: default, force)",
+			p.Path,
+			p.Mode,
+		)
+	}
+	return nil
+}
+
+// withModelParams applies a model's params to an upstream request body.
+// Bodies that are not JSON objects are returned unchanged.
+func withModelParams(body []byte, params []ModelParam) ([]byte, error) {
+	if !gjson.ValidBytes(body) || !gjson.ParseBytes(body).IsObject() {
+		return body, nil
+	}
+	for _, p := range params {
+		if p.Mode != paramModeForce && gjson.GetBytes(body, p.Path).Exists() {
+			continue
+		}
+		var err error
+		if p.JSON != "" {
+			body, err = sjson.SetRawBytes(body, p.Path, []byte(p.JSON))
+		} else {
+			body, err = sjson.SetBytes(body, p.Path, p.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("param %q: %w", p.Path, err)
+		}
+	}
+	return body, nil
+}
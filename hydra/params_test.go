@@ -0,0 +1,148 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestWithModelParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []ModelParam
+		body   string
+		want   string
+	}{
+		{
+			name:   "default fills an unset field",
+			params: []ModelParam{{Path: "temperature", Value: 0.2, Mode: paramModeDefault}},
+			body:   `{"model":"m"}`,
+			want:   `{"model":"m","temperature":0.2}`,
+		},
+		{
+			name:   "default keeps the request value",
+			params: []ModelParam{{Path: "temperature", Value: 0.2, Mode: paramModeDefault}},
+			body:   `{"temperature":1}`,
+			want:   `{"temperature":1}`,
+		},
+		{
+			name:   "force replaces the request value",
+			params: []ModelParam{{Path: "max_tokens", Value: int64(1024), Mode: paramModeForce}},
+			body:   `{"max_tokens":64000}`,
+			want:   `{"max_tokens":1024}`,
+		},
+		{
+			name: "nested path and raw json",
+			params: []ModelParam{
+				{Path: "generationConfig.topP", Value: 0.9, Mode: paramModeDefault},
+				{
+					Path: "safetySettings", JSON: `[{"category":"HARM_CATEGORY_HATE_SPEECH"}]`,
+					Mode: paramModeForce,
+				},
+			},
+			body: `{"contents":[]}`,
+			want: `{"contents":[],"generationConfig":{"topP":0.9},` +
+				`"safetySettings":[{"category":"HARM_CATEGORY_HATE_SPEECH"}]}`,
+		},
+		{
+			name:   "non-object body unchanged",
+			params: []ModelParam{{Path: "temperature", Value: 0.2, Mode: paramModeForce}},
+			body:   `prompt=hello`,
+			want:   `prompt=hello`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withModelParams([]byte(tt.body), tt.params)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestModelParam_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		param ModelParam
+		valid bool
+	}{
+		{"value", ModelParam{Path: "temperature", Value: 0.2}, true},
+		{"json", ModelParam{Path: "extra", JSON: `{"topK":40}`, Mode: "force"}, true},
+		{"no path", ModelParam{Value: 0.2}, false},
+		{"no value", ModelParam{Path: "temperature"}, false},
+		{"value and json", ModelParam{Path: "temperature", Value: 0.2, JSON: "0.2"}, false},
+		{"invalid json", ModelParam{Path: "extra", JSON: `{topK:40}`}, false},
+		{"unknown mode", ModelParam{Path: "temperature", Value: 0.2, Mode: "merge"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.param.validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+		if err == nil && tt.param.Mode == "" {
+			t.Errorf("%s: expected the default mode set", tt.name)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_ModelParams(t *testing.T) {
+	var got []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	models := []Model{{
+		ID:       "m1",
+		Provider: "p",
+		Model:    "gpt-4o",
+		Type:     "openai",
+		Attempts: 1,
+		Timeout:  time.Second,
+		Params: []ModelParam{
+			{Path: "temperature", Value: 0.2, Mode: paramModeDefault},
+			{Path: "model", Value: "forced", Mode: paramModeDefault},
+			{Path: "reasoning_effort", Value: "low", Mode: paramModeForce},
+		},
+	}}
+	providers := map[string]Provider{
+		"p": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"alias","reasoning_effort":"high","messages":[]}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Params apply to the upstream body, after the model name is set
+	if gjson.GetBytes(got, "temperature").Float() != 0.2 ||
+		gjson.GetBytes(got, "model").String() != "gpt-4o" ||
+		gjson.GetBytes(got, "reasoning_effort").String() != "low" {
+		t.Errorf("unexpected upstream body %s", got)
+	}
+}
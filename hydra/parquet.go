@@ -0,0 +1,230 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// parquetMagic opens and closes every Parquet file.
+const parquetMagic = "PAR1"
+
+// Parquet physical types, converted types, and enums of the file metadata.
+const (
+	parquetInt64      = 2
+	parquetDouble     = 5
+	parquetByteArray  = 6
+	parquetUTF8       = 0
+	parquetTimeMicros = 10
+	parquetRequired   = 0
+	parquetPlain      = 0
+	parquetRLE        = 3
+	parquetDataPage   = 0
+	parquetCodecNone  = 0
+)
+
+// parquetColumn is a required column of a Parquet file, holding its values
+// in PLAIN encoding.
+type parquetColumn struct {
+	name      string
+	kind      int32 // Physical type
+	converted int32 // Converted type, -1 for none
+	values    bytes.Buffer
+}
+
+func newParquetColumn(name string, kind, converted int32) *parquetColumn {
+	return &parquetColumn{name: name, kind: kind, converted: converted}
+}
+
+func (c *parquetColumn) appendString(s string) {
+	_ = binary.Write(&c.values, binary.LittleEndian, uint32(len(s)))
+	c.values.WriteString(s)
+}
+
+func (c *parquetColumn) appendInt64(v int64) {
+	_ = binary.Write(&c.values, binary.LittleEndian, v)
+}
+
+func (c *parquetColumn) appendFloat64(v float64) {
+	_ = binary.Write(&c.values, binary.LittleEndian, math.Float64bits(v))
+}
+
+func (c *parquetColumn) appendTime(t time.Time) {
+	c.appendInt64(t.UnixMicro())
+}
+
+// writeParquet writes rows of columns as an uncompressed Parquet file with a
+// single row group and one data page per column.
+func writeParquet(w io.Writer, columns []*parquetColumn, rows int) error {
+	var out bytes.Buffer
+	out.WriteString(parquetMagic)
+
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1) // version
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.beginElem()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, c := range columns {
+		meta.beginElem()
+		meta.i32(1, c.kind)
+		meta.i32(3, parquetRequired)
+		meta.str(4, c.name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(rows))
+
+	if rows == 0 {
+		meta.list(4, thriftStruct, 0)
+	} else {
+		var chunks thriftWriter
+		var groupSize int64
+		for _, c := range columns {
+			var page thriftWriter
+			page.begin()
+			page.i32(1, parquetDataPage)
+			page.i32(2, int32(c.values.Len()))
+			page.i32(3, int32(c.values.Len()))
+			page.beginStruct(5) // data_page_header
+			page.i32(1, int32(rows))
+			page.i32(2, parquetPlain)
+			page.i32(3, parquetRLE)
+			page.i32(4, parquetRLE)
+			page.end()
+			page.end()
+
+			offset := int64(out.Len())
+			size := int64(page.buf.Len() + c.values.Len())
+			out.Write(page.buf.Bytes())
+			out.Write(c.values.Bytes())
+			groupSize += size
+
+			chunks.beginElem()
+			chunks.i64(2, offset)
+			chunks.beginStruct(3) // meta_data
+			chunks.i32(1, c.kind)
+			chunks.list(2, thriftI32, 1)
+			chunks.varint(zigzag(parquetPlain))
+			chunks.list(3, thriftBinary, 1)
+			chunks.binary(c.name)
+			chunks.i32(4, parquetCodecNone)
+			chunks.i64(5, int64(rows))
+			chunks.i64(6, size)
+			chunks.i64(7, size)
+			chunks.i64(9, offset)
+			chunks.end()
+			chunks.end()
+		}
+
+		meta.list(4, thriftStruct, 1)
+		meta.beginElem()
+		meta.list(1, thriftStruct, len(columns))
+		meta.buf.Write(chunks.buf.Bytes())
+		meta.i64(2, groupSize)
+		meta.i64(3, int64(rows))
+		meta.end()
+	}
+	meta.str(6, "hydrallm")
+	meta.end()
+
+	out.Write(meta.buf.Bytes())
+	_ = binary.Write(&out, binary.LittleEndian, uint32(meta.buf.Len()))
+	out.WriteString(parquetMagic)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Thrift compact protocol of the Parquet metadata.
+// Structs are opened with begin, beginStruct, or beginElem and closed with
+// end; fields must be written in ascending order within a struct.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // Last field ID of each open struct
+}
+
+// begin opens a top-level struct.
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+// beginStruct opens a struct-valued field.
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.last = append(t.last, 0)
+}
+
+// beginElem opens a struct element of a list.
+func (t *thriftWriter) beginElem() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+// list starts a list field of n elements, which are written next.
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.varint(uint64(n))
+}
+
+func (t *thriftWriter) binary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,112 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Listener dispatch modes, deciding how a request picks its models.
+const (
+	dispatchChain       = "chain"       // Listener models, whatever the request names
+	dispatchPassthrough = "passthrough" // Listener models serving the requested name
+)
+
+func isSupportedDispatch(dispatch string) bool {
+	switch dispatch {
+	case dispatchChain, dispatchPassthrough:
+		return true
+	default:
+		return false
+	}
+}
+
+// passthroughName returns the model name a request asks for: the body model
+// field, or the model segment of a native Gemini path.
+func passthroughName(req *http.Request, body []byte) string {
+	if name := requestedModel(body); name != "" {
+		return name
+	}
+	if m := geminiModelSegment.FindString(req.URL.Path); m != "" {
+		return strings.TrimSuffix(strings.TrimPrefix(m, "/models/"), ":")
+	}
+	return ""
+}
+
+// passthroughChain returns the models serving a requested name on a
+// passthrough listener: its route chain if it has one, else the listener
+// models whose upstream model or ID is the name, in configured order. Names
+// matching a deny_models pattern are served by none.
+func (s *transportState) passthroughChain(name string) []Model {
+	if name == "" || deniedModel(s.listener.DenyModels, name) {
+		return nil
+	}
+	if chain, ok := s.routes[name]; ok {
+		return chain
+	}
+	var chain []Model
+	for _, m := range s.models {
+		if m.Model == name || m.ID == name {
+			chain = append(chain, m)
+		}
+	}
+	return chain
+}
+
+// deniedModel reports whether a requested name matches one of the patterns.
+func deniedModel(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool {
+		ok, _ := path.Match(p, name)
+		return ok
+	})
+}
+
+// passthroughNames returns the upstream model names a passthrough listener
+// serves, in configured order and without duplicates.
+func (s *transportState) passthroughNames() []string {
+	var names []string
+	for _, m := range s.models {
+		if !slices.Contains(names, m.Model) && !deniedModel(s.listener.DenyModels, m.Model) {
+			names = append(names, m.Model)
+		}
+	}
+	return names
+}
+
+// modelNotFoundResponse answers a passthrough request for a name the listener
+// does not serve with a 404 in the listener's API format.
+func modelNotFoundResponse(req *http.Request, l *Listener, name string) *http.Response {
+	message := fmt.Sprintf("model %q is not available on this listener", name)
+	if name == "" {
+		message = "request does not name a model"
+	}
+	var body any
+	switch l.ConfigType {
+	case "anthropic":
+		body = map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": "not_found_error", "message": message},
+		}
+	case "gemini":
+		body = map[string]any{
+			"error": map[string]any{
+				"code":    http.StatusNotFound,
+				"message": message,
+				"status":  "NOT_FOUND",
+			},
+		}
+	default:
+		body = map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    "invalid_request_error",
+				"code":    "model_not_found",
+			},
+		}
+	}
+	data, _ := json.Marshal(body)
+	return jsonResponse(req, http.StatusNotFound, data)
+}
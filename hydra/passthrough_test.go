@@ -0,0 +1,165 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestPassthroughChain(t *testing.T) {
+	state := &transportState{
+		listener: &Listener{DenyModels: []string{"*-preview"}},
+		models: []Model{
+			{ID: "gpt_openai", Model: "gpt-5"},
+			{ID: "claude", Model: "claude-sonnet-4"},
+			{ID: "gpt_azure", Model: "gpt-5"},
+			{ID: "gpt_preview", Model: "gpt-5-preview"},
+		},
+		routes: map[string][]Model{"fast": {{ID: "routed"}}},
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"gpt-5", []string{"gpt_openai", "gpt_azure"}},
+		{"claude", []string{"claude"}},
+		{"fast", []string{"routed"}},
+		{"gpt-5-preview", nil},
+		{"unknown", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := modelIDs(state.passthroughChain(tt.name)); !slices.Equal(got, tt.expected) {
+			t.Errorf("passthroughChain(%q) = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+	if got := state.passthroughNames(); !slices.Equal(got, []string{"gpt-5", "claude-sonnet-4"}) {
+		t.Errorf("unexpected names %v", got)
+	}
+}
+
+func TestPassthroughName(t *testing.T) {
+	path := "/v1beta/models/gemini-2.5-pro:generateContent"
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if got := passthroughName(req, []byte(`{}`)); got != "gemini-2.5-pro" {
+		t.Errorf("expected model from path, got %q", got)
+	}
+	if got := passthroughName(req, []byte(`{"model":"gpt-5"}`)); got != "gpt-5" {
+		t.Errorf("expected model from body, got %q", got)
+	}
+}
+
+func TestTransport_RoundTrip_Passthrough(t *testing.T) {
+	var got []string
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			got = append(got, name+":"+gjson.GetBytes(body, "model").String())
+			_, _ = w.Write([]byte(`{"choices":[]}`))
+		}))
+	}
+	openai, other := upstream("openai"), upstream("other")
+	defer openai.Close()
+	defer other.Close()
+
+	providers := map[string]Provider{
+		"openai": {URL: openai.URL, ParsedURL: mustParseURL(openai.URL)},
+		"other":  {URL: other.URL, ParsedURL: mustParseURL(other.URL)},
+	}
+	model := func(id, provider, name string) Model {
+		return Model{
+			ID:       id,
+			Provider: provider,
+			Model:    name,
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	l := &Listener{
+		Name:       "passthrough",
+		ConfigType: "openai",
+		Dispatch:   dispatchPassthrough,
+		DenyModels: []string{"secret-*"},
+		ResolvedModels: []Model{
+			model("gpt", "openai", "gpt-5"),
+			model("llama", "other", "llama-4"),
+			model("secret", "other", "secret-model"),
+		},
+	}
+	transport := newListenerTransport(l, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"model":"llama-4"}`, http.StatusOK},
+		{`{"model":"gpt-5"}`, http.StatusOK},
+		{`{"model":"gpt-4o"}`, http.StatusNotFound},
+		{`{"model":"secret-model"}`, http.StatusNotFound},
+		{`{"messages":[]}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		body := strings.NewReader(tt.body)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", body)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.body, tt.status, resp.StatusCode)
+		}
+		if tt.status == http.StatusNotFound &&
+			gjson.GetBytes(respBody, "error.code").String() != "model_not_found" {
+			t.Errorf("%s: expected model_not_found error, got %s", tt.body, respBody)
+		}
+	}
+	if !slices.Equal(got, []string{"other:llama-4", "openai:gpt-5"}) {
+		t.Errorf("unexpected upstream requests %v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	ids := gjson.GetBytes(body, "data.#.id").String()
+	if resp.StatusCode != http.StatusOK || ids != `["gpt-5","llama-4"]` {
+		t.Errorf("unexpected model list %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestModelNotFoundResponse(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	tests := []struct {
+		configType string
+		path       string
+		expected   string
+	}{
+		{"openai", "error.code", "model_not_found"},
+		{"anthropic", "error.type", "not_found_error"},
+		{"gemini", "error.status", "NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		resp := modelNotFoundResponse(req, &Listener{ConfigType: tt.configType}, "missing")
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", tt.configType, resp.StatusCode)
+		}
+		if got := gjson.GetBytes(body, tt.path).String(); got != tt.expected {
+			t.Errorf("%s: expected %s %q, got %s", tt.configType, tt.path, tt.expected, body)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package hydra
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ListenerPlan is the order in which a listener tries its models.
+type ListenerPlan struct {
+	Listener string
+	Address  string
+	Strategy string // Strategies other than priority reorder models per request
+	Dispatch string
+	Chains   []ChainPlan
+}
+
+// ChainPlan lists every attempt of one model chain in the order they are made.
+type ChainPlan struct {
+	Name      string // "default", or the requested model of a route
+	Steps     []PlanStep
+	WorstCase time.Duration // Every attempt timing out, bounded by retry total_timeout
+}
+
+// PlanStep is one upstream attempt of a chain.
+type PlanStep struct {
+	Cycle    int
+	Model    string // Model ID
+	Provider string
+	URL      string // Provider URL with credentials and query values masked
+	Attempt  int    // Attempt of the model within the cycle
+	Timeout  time.Duration
+	Wait     time.Duration // Pause after the attempt fails, 0 after the last
+}
+
+// RoutingPlan resolves the attempt plan of every listener in cfg, with the
+// default chain first and routes in requested model order.
+func RoutingPlan(cfg *Config) []ListenerPlan {
+	plans := make([]ListenerPlan, 0, len(cfg.Listeners))
+	for _, l := range cfg.Listeners {
+		plan := ListenerPlan{
+			Listener: l.Name,
+			Address:  strings.Join(l.Addresses(), ", "),
+			Strategy: l.Strategy,
+			Dispatch: l.Dispatch,
+		}
+		retry := cfg.ListenerRetry(&l)
+		plan.Chains = append(plan.Chains, chainPlan("default", l.ResolvedModels, cfg, retry))
+		if len(l.ResolvedEmbeddings) > 0 {
+			plan.Chains = append(
+				plan.Chains,
+				chainPlan("embeddings", l.ResolvedEmbeddings, cfg, retry),
+			)
+		}
+		names := make([]string, 0, len(l.ResolvedRoutes))
+		for name := range l.ResolvedRoutes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			plan.Chains = append(plan.Chains, chainPlan(name, l.ResolvedRoutes[name], cfg, retry))
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// chainPlan follows the retry loop of RetryTransport.RoundTrip: every cycle
+// tries each model for its attempts, waiting the model's interval after each
+// failure except the very last.
+func chainPlan(name string, models []Model, cfg *Config, retry RetryConfig) ChainPlan {
+	chain := ChainPlan{Name: name}
+	maxCycles := max(retry.MaxCycles, 1)
+	for cycle := range maxCycles {
+		for modelIdx, model := range models {
+			provider := cfg.Providers[model.Provider]
+			interval := model.GetInterval(provider, retry.DefaultInterval)
+			for attempt := range model.Attempts {
+				step := PlanStep{
+					Cycle:    cycle + 1,
+					Model:    model.ID,
+					Provider: model.Provider,
+					URL:      maskURL(provider.ParsedURL),
+					Attempt:  attempt + 1,
+					Timeout:  model.Timeout,
+				}
+				last := cycle == maxCycles-1 && modelIdx == len(models)-1 &&
+					attempt == model.Attempts-1
+				if !last {
+					step.Wait = interval
+					if retry.ExponentialBackoff {
+						step.Wait = interval * time.Duration(len(chain.Steps)+1)
+					}
+				}
+				chain.Steps = append(chain.Steps, step)
+				chain.WorstCase += step.Timeout + step.Wait
+			}
+		}
+	}
+	if budget := retry.TotalTimeout; budget > 0 {
+		chain.WorstCase = min(chain.WorstCase, budget)
+	}
+	return chain
+}
+
+// maskURL renders u with its password and query values replaced, since
+// providers may carry credentials in either.
+func maskURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	masked := *u
+	if query := masked.Query(); len(query) > 0 {
+		for key := range query {
+			query.Set(key, "xxxxx")
+		}
+		masked.RawQuery = query.Encode()
+	}
+	return masked.Redacted()
+}
@@ -0,0 +1,163 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request priorities. Interactive requests wait for a saturated provider;
+// batch requests fall back instead.
+const (
+	priorityInteractive = "interactive"
+	priorityBatch       = "batch"
+)
+
+// priorityHeader overrides the priority of a single request.
+const priorityHeader = "X-Priority"
+
+// errProviderSaturated is returned when a provider has no free request slot.
+var errProviderSaturated = errors.New("provider concurrency limit reached")
+
+// providerSlots enforces the max_concurrency limits of providers.
+var providerSlots = newSlotLimiter()
+
+var (
+	saturationSkipsCounter = metrics.Counter(
+		"hydrallm_saturation_skips_total",
+		"Attempts skipped because the provider's max_concurrency was reached, by provider and priority.",
+	)
+	providerInFlightGauge = metrics.Gauge(
+		"hydrallm_provider_in_flight",
+		"Requests in flight to providers with max_concurrency, by provider.",
+	)
+)
+
+func isSupportedPriority(priority string) bool {
+	return priority == priorityInteractive || priority == priorityBatch
+}
+
+// requestPriority returns the priority of a request: its X-Priority header if
+// valid, else the listener's priority.
+func requestPriority(req *http.Request, listener *Listener) string {
+	if p := strings.ToLower(req.Header.Get(priorityHeader)); isSupportedPriority(p) {
+		return p
+	}
+	if listener.Priority == "" {
+		return priorityInteractive
+	}
+	return listener.Priority
+}
+
+// slotState is the in-flight count and the interactive requests waiting for a
+// slot of one provider, in arrival order.
+type slotState struct {
+	inFlight int
+	waiters  []chan struct{}
+}
+
+type slotLimiter struct {
+	mu    sync.Mutex
+	slots map[string]*slotState
+}
+
+func newSlotLimiter() *slotLimiter {
+	return &slotLimiter{slots: make(map[string]*slotState)}
+}
+
+// acquire takes a request slot of the provider and returns the function that
+// frees it. A slot is free when fewer than max_concurrency requests are in
+// flight and no interactive request is waiting. Interactive requests wait up
+// to the limit's max_wait for one; batch requests never wait. Without a free
+// slot errProviderSaturated is returned.
+func (l *slotLimiter) acquire(
+	ctx context.Context,
+	provider string,
+	limit RateLimit,
+	priority string,
+) (func(), error) {
+	if limit.MaxConcurrency <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	s, ok := l.slots[provider]
+	if !ok {
+		s = &slotState{}
+		l.slots[provider] = s
+	}
+	if s.inFlight < limit.MaxConcurrency && len(s.waiters) == 0 {
+		s.inFlight++
+		providerInFlightGauge.Set(float64(s.inFlight), "provider", provider)
+		l.mu.Unlock()
+		return l.releaser(provider), nil
+	}
+	if priority == priorityBatch || limit.MaxWait <= 0 {
+		l.mu.Unlock()
+		return nil, errProviderSaturated
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(limit.MaxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return l.releaser(provider), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = errProviderSaturated
+	}
+
+	l.mu.Lock()
+	if i := slices.Index(s.waiters, ready); i >= 0 {
+		s.waiters = slices.Delete(s.waiters, i, i+1)
+		l.mu.Unlock()
+		return nil, err
+	}
+	l.mu.Unlock()
+	// A slot was handed over while giving up
+	release := l.releaser(provider)
+	if ctx.Err() != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// releaser returns the function freeing a slot of the provider, which hands
+// it to the first waiting request if any. Calls after the first do nothing.
+func (l *slotLimiter) releaser(provider string) func() {
+	return sync.OnceFunc(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		s := l.slots[provider]
+		if len(s.waiters) > 0 {
+			close(s.waiters[0])
+			s.waiters = s.waiters[1:]
+			return
+		}
+		s.inFlight--
+		providerInFlightGauge.Set(float64(s.inFlight), "provider", provider)
+	})
+}
+
+// releaseOnClose frees a provider slot once a response body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
@@ -0,0 +1,173 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestSlotLimiter_Acquire(t *testing.T) {
+	l := newSlotLimiter()
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "p", RateLimit{}, priorityBatch)
+	if err != nil {
+		t.Fatalf("expected no limit, got %v", err)
+	}
+	release()
+
+	limit := RateLimit{MaxConcurrency: 1, MaxWait: time.Second}
+	release, err = l.acquire(ctx, "p", limit, priorityBatch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := l.acquire(ctx, "p", limit, priorityBatch); !errors.Is(err, errProviderSaturated) {
+		t.Errorf("expected batch request to skip a saturated provider, got %v", err)
+	}
+
+	// An interactive request waits for the slot
+	acquired := make(chan func())
+	go func() {
+		waiter, err := l.acquire(ctx, "p", limit, priorityInteractive)
+		if err != nil {
+			t.Errorf("expected interactive request to get the slot, got %v", err)
+			waiter = func() {}
+		}
+		acquired <- waiter
+	}()
+	for {
+		l.mu.Lock()
+		waiting := len(l.slots["p"].waiters)
+		l.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Freed slots go to waiting interactive requests before new batch ones
+	release()
+	release() // Releasing twice frees one slot
+	waiter := <-acquired
+	if _, err := l.acquire(ctx, "p", limit, priorityBatch); !errors.Is(err, errProviderSaturated) {
+		t.Errorf("expected the slot to be handed to the waiter, got %v", err)
+	}
+	waiter()
+	release, err = l.acquire(ctx, "p", limit, priorityBatch)
+	if err != nil {
+		t.Fatalf("expected a free slot, got %v", err)
+	}
+
+	// Interactive requests give up after max_wait
+	short := RateLimit{MaxConcurrency: 1, MaxWait: 10 * time.Millisecond}
+	_, err = l.acquire(ctx, "p", short, priorityInteractive)
+	if !errors.Is(err, errProviderSaturated) {
+		t.Errorf("expected interactive request to time out, got %v", err)
+	}
+	release()
+	if got := len(l.slots["p"].waiters); got != 0 || l.slots["p"].inFlight != 0 {
+		t.Errorf("expected no waiters or requests in flight, got %d and %d", got, l.slots["p"].inFlight)
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	tests := []struct {
+		listener string
+		header   string
+		expected string
+	}{
+		{"", "", priorityInteractive},
+		{priorityBatch, "", priorityBatch},
+		{priorityBatch, "Interactive", priorityInteractive},
+		{priorityInteractive, "batch", priorityBatch},
+		{priorityBatch, "urgent", priorityBatch},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "http://original/v1/chat/completions", nil)
+		if tt.header != "" {
+			req.Header.Set(priorityHeader, tt.header)
+		}
+		if got := requestPriority(req, &Listener{Priority: tt.listener}); got != tt.expected {
+			t.Errorf("listener %q, header %q: got %q, want %q", tt.listener, tt.header, got, tt.expected)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_BatchFallsBackWhenSaturated(t *testing.T) {
+	block := make(chan struct{})
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(priorityHeader) != "" {
+			t.Errorf("expected %s to be stripped upstream", priorityHeader)
+		}
+		<-block
+		_, _ = w.Write([]byte(`{"id":"busy"}`))
+	}))
+	defer busy.Close()
+	defer close(block)
+	spare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"spare"}`))
+	}))
+	defer spare.Close()
+
+	model := func(id string) Model {
+		return Model{ID: id, Provider: id, Type: "openai", Attempts: 1, Timeout: 5 * time.Second}
+	}
+	listener := &Listener{
+		Name:           "priority-main",
+		ResolvedModels: []Model{model("priority-busy"), model("priority-spare")},
+	}
+	providers := map[string]Provider{
+		"priority-busy": {
+			URL:       busy.URL,
+			ParsedURL: mustParseURL(busy.URL),
+			RateLimit: RateLimit{MaxConcurrency: 1, MaxWait: time.Second},
+		},
+		"priority-spare": {URL: spare.URL, ParsedURL: mustParseURL(spare.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	transport := newListenerTransport(listener, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	send := func(priority string) (string, error) {
+		req, _ := http.NewRequest(
+			http.MethodPost,
+			"http://original/v1/chat/completions",
+			bytes.NewReader([]byte(`{"model":"m"}`)),
+		)
+		req.Header.Set(priorityHeader, priority)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// Occupy the only slot of the busy provider
+	go func() { _, _ = send(priorityInteractive) }()
+	for {
+		providerSlots.mu.Lock()
+		s := providerSlots.slots["priority-busy"]
+		occupied := s != nil && s.inFlight == 1
+		providerSlots.mu.Unlock()
+		if occupied {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	body, err := send(priorityBatch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body != `{"id":"spare"}` {
+		t.Errorf("expected batch request to fall back, got %s", body)
+	}
+}
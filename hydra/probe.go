@@ -0,0 +1,68 @@
+package hydra
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// postOnlyPaths are the endpoint suffixes that only accept POST requests.
+var postOnlyPaths = []string{
+	"/chat/completions",
+	"/completions",
+	"/embeddings",
+	"/messages",
+	"/count_tokens",
+	"/responses",
+	"/invoke",
+	"/invoke-with-response-stream",
+	"/converse",
+	"/converse-stream",
+	":generateContent",
+	":streamGenerateContent",
+}
+
+var probeRequestsCounter = metrics.Counter(
+	"hydrallm_probe_requests_total",
+	"HEAD and GET requests on POST-only paths answered locally, by listener.",
+)
+
+func isPostOnlyPath(path string) bool {
+	path = strings.TrimRight(path, "/")
+	for _, suffix := range postOnlyPaths {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newProbeMiddleware answers HEAD and GET requests on POST-only paths, such as
+// those sent by uptime checkers, with the listener's probe_status instead of
+// sending them through the retry chain.
+func newProbeMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	status := l.ProbeStatus
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+				!isPostOnlyPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			probeRequestsCounter.Inc("listener", l.Name)
+			logger.Debug("answering probe", "listener", l.Name, "method", r.Method, "path", r.URL.Path)
+			if status == http.StatusOK {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(status), status)
+		})
+	}
+}
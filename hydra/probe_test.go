@@ -0,0 +1,50 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestProbeMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		method    string
+		path      string
+		expected  int
+		forwarded bool
+	}{
+		{"get completions", 405, http.MethodGet, "/v1/chat/completions", 405, false},
+		{"head messages", 405, http.MethodHead, "/v1/messages/", 405, false},
+		{"gemini", 405, http.MethodGet, "/v1beta/models/gemini:generateContent", 405, false},
+		{"ok status", 200, http.MethodHead, "/v1/chat/completions", 200, false},
+		{"post forwarded", 405, http.MethodPost, "/v1/chat/completions", 204, true},
+		{"model list forwarded", 405, http.MethodGet, "/v1/models", 204, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				forwarded = true
+				w.WriteHeader(http.StatusNoContent)
+			})
+			l := &Listener{Name: "l1", ProbeStatus: tt.status}
+			h := newProbeMiddleware(l, nil, log.New(io.Discard))(next)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.expected || forwarded != tt.forwarded {
+				t.Errorf("expected %d (forwarded %v), got %d (forwarded %v)",
+					tt.expected, tt.forwarded, rec.Code, forwarded)
+			}
+			if rec.Code == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "POST" {
+				t.Errorf("expected Allow: POST, got %q", rec.Header().Get("Allow"))
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package hydra
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Prompt classes assigned by profilePrompt.
+const (
+	promptClassCode  = "code"  // The latest user turn is mostly source code
+	promptClassProse = "prose" // Everything else
+)
+
+// codeLineRatio is the share of non-blank lines that must look like code for
+// a prompt without code fences to be classed as code.
+const codeLineRatio = 0.4
+
+// codeLinePrefixes start lines that are likely source code.
+var codeLinePrefixes = []string{
+	"func ", "def ", "class ", "import ", "from ", "package ", "#include", "return ",
+	"const ", "let ", "var ", "public ", "private ", "fn ", "if (", "for (", "while (",
+	"//", "/*", "#!", "SELECT ", "select ",
+}
+
+// promptScripts maps writing systems to the language detected for prompts
+// mostly written in them. Han without kana is taken as Chinese.
+var promptScripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// latinStopwords are common words that tell languages written in the Latin
+// script apart.
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "what", "how", "this", "with", "you"},
+	"es": {"el", "los", "las", "es", "del", "que", "por", "para", "con", "una", "cómo"},
+	"fr": {"le", "les", "est", "des", "du", "que", "pour", "avec", "une", "je", "vous"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "eine", "ich", "wie"},
+	"pt": {"os", "as", "é", "do", "da", "que", "para", "com", "uma", "não", "como"},
+	"it": {"il", "gli", "è", "di", "che", "per", "con", "una", "sono", "non", "come"},
+}
+
+// promptLanguages lists the language codes profilePrompt can detect.
+var promptLanguages = []string{
+	"ar", "de", "el", "en", "es", "fr", "he", "hi", "it", "ja", "ko", "pt", "ru", "th", "zh",
+}
+
+// promptProfile holds the characteristics of a prompt used for routing.
+type promptProfile struct {
+	Class    string // code or prose
+	Chars    int    // Characters of system and message text
+	Language string // Language code of the latest user turn, empty if unknown
+}
+
+// profilePrompt classifies the prompt of an OpenAI, Anthropic, or Gemini
+// request body with cheap heuristics. The class comes from the latest user
+// turn; the length covers the whole conversation.
+func profilePrompt(body []byte) promptProfile {
+	var req struct {
+		System   json.RawMessage `json:"system"`
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Contents []struct {
+			Role  string `json:"role"`
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"contents"`
+	}
+	profile := promptProfile{Class: promptClassProse}
+	if json.Unmarshal(body, &req) != nil {
+		return profile
+	}
+
+	var last string
+	profile.Chars = utf8.RuneCountInString(promptText(req.System))
+	for _, msg := range req.Messages {
+		text := promptText(msg.Content)
+		profile.Chars += utf8.RuneCountInString(text)
+		if msg.Role == "user" {
+			last = text
+		}
+	}
+	for _, content := range req.Contents {
+		var text strings.Builder
+		for _, part := range content.Parts {
+			text.WriteString(part.Text)
+		}
+		profile.Chars += utf8.RuneCountInString(text.String())
+		if content.Role == "user" || content.Role == "" {
+			last = text.String()
+		}
+	}
+
+	if looksLikeCode(last) {
+		profile.Class = promptClassCode
+	}
+	profile.Language = detectLanguage(last)
+	return profile
+}
+
+// promptText returns the text of message content given as a string or as a
+// list of parts with text fields.
+func promptText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// detectLanguage guesses the language of text from the writing system most of
+// its letters use and, for the Latin script, from common words. Text without
+// letters, or Latin text without any known words, is reported as unknown.
+func detectLanguage(text string) string {
+	var latin int
+	counts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range promptScripts {
+			if unicode.Is(s.table, r) {
+				counts[s.language]++
+				break
+			}
+		}
+	}
+	// Kana marks Han text as Japanese
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		delete(counts, "zh")
+	}
+
+	best, bestCount := "", latin
+	for _, lang := range promptLanguages {
+		if counts[lang] > bestCount {
+			best, bestCount = lang, counts[lang]
+		}
+	}
+	if bestCount == 0 || best != "" {
+		return best
+	}
+
+	scores := make(map[string]int)
+	for word := range strings.FieldsFuncSeq(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for lang, words := range latinStopwords {
+			if slices.Contains(words, word) {
+				scores[lang]++
+			}
+		}
+	}
+	// English wins ties
+	best, bestCount = "", scores["en"]
+	if bestCount > 0 {
+		best = "en"
+	}
+	for _, lang := range promptLanguages {
+		if scores[lang] > bestCount {
+			best, bestCount = lang, scores[lang]
+		}
+	}
+	return best
+}
+
+// looksLikeCode reports whether text contains a fenced code block, or is made
+// up largely of lines that look like source code.
+func looksLikeCode(text string) bool {
+	if strings.Contains(text, "```") {
+		return true
+	}
+	var lines, code int
+	for line := range strings.SplitSeq(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+		if isCodeLine(line) {
+			code++
+		}
+	}
+	return lines >= 3 && float64(code) >= codeLineRatio*float64(lines)
+}
+
+// isCodeLine reports whether a trimmed, non-blank line looks like source code.
+func isCodeLine(line string) bool {
+	if strings.ContainsRune(";{}", rune(line[len(line)-1])) {
+		return true
+	}
+	for _, prefix := range codeLinePrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package hydra
+
+import "testing"
+
+func TestProfilePrompt(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected promptProfile
+	}{
+		{
+			name: "openai prose",
+			body: `{"messages":[{"role":"system","content":"Be brief."},` +
+				`{"role":"user","content":"What is this?"}]}`,
+			expected: promptProfile{Class: promptClassProse, Chars: 22, Language: "en"},
+		},
+		{
+			name: "anthropic code parts",
+			body: `{"system":"sys","messages":[{"role":"user","content":[` +
+				`{"type":"text","text":"package main\nimport \"fmt\"\nfunc main() {\n}"}]}]}`,
+			expected: promptProfile{Class: promptClassCode, Chars: 44},
+		},
+		{
+			name:     "gemini",
+			body:     `{"contents":[{"role":"user","parts":[{"text":"Fix this: ` + "```x```" + `"}]}]}`,
+			expected: promptProfile{Class: promptClassCode, Chars: 17, Language: "en"},
+		},
+		{
+			name: "only the latest user turn is classed",
+			body: `{"messages":[{"role":"user","content":"a;\nb;\nc;"},` +
+				`{"role":"user","content":"これは何ですか"}]}`,
+			expected: promptProfile{Class: promptClassProse, Chars: 15, Language: "ja"},
+		},
+		{
+			name:     "not json",
+			body:     `not json`,
+			expected: promptProfile{Class: promptClassProse},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := profilePrompt([]byte(tt.body)); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLooksLikeCode(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected bool
+	}{
+		{"def add(a, b):\n    return a + b\n\nprint(add(1, 2))", true},
+		{"SELECT id\nFROM users\nWHERE active = 1;", true},
+		{"const x = 1;\nconst y = 2;\nconsole.log(x + y);", true},
+		{"Dear team,\nthe release is ready.\nThanks!", false},
+		{"Short line;", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeCode(tt.text); got != tt.expected {
+			t.Errorf("looksLikeCode(%q) = %v, want %v", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"How do I reverse a list in Python?", "en"},
+		{"¿Cómo puedo invertir una lista en Python?", "es"},
+		{"Comment inverser une liste avec Python ?", "fr"},
+		{"Ciao, come posso invertire una lista?", "it"},
+		{"Wie kann ich eine Liste umkehren?", "de"},
+		{"如何在 Python 中反转列表？", "zh"},
+		{"Pythonでリストを逆順にする方法は？", "ja"},
+		{"파이썬에서 리스트를 뒤집는 방법은?", "ko"},
+		{"Как перевернуть список в Python?", "ru"},
+		{"12345 + 678", ""},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.expected {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
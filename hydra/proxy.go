@@ -0,0 +1,61 @@
+package hydra
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/charmbracelet/log"
+)
+
+// NewProxy returns a reverse proxy serving a listener of cfg through a
+// RetryTransport of its model chain.
+func NewProxy(listener *Listener, cfg *Config, logger *log.Logger) *httputil.ReverseProxy {
+	transport := newListenerTransport(
+		listener,
+		cfg.Providers,
+		cfg.ListenerRetry(listener),
+		cfg.Log,
+		logger,
+	)
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(req *httputil.ProxyRequest) {
+			logger.Debug(
+				"incoming request",
+				"method",
+				req.In.Method,
+				"path",
+				req.In.URL.Path,
+				"host",
+				req.In.Host,
+				"key",
+				apiKeyName(req.In.Context()),
+				"request_id",
+				requestID(req.In.Context()),
+			)
+			// Rules may locate the client by a forwarding header the proxy removes
+			req.Out = req.Out.WithContext(withClientHeaders(req.Out.Context(), req.In.Header))
+		},
+		Transport:     transport,
+		FlushInterval: -1, // Flush immediately for streaming
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error(
+				"proxy error",
+				"error",
+				err,
+				"path",
+				r.URL.Path,
+				"method",
+				r.Method,
+				"request_id",
+				requestID(r.Context()),
+			)
+			status := http.StatusBadGateway
+			if errors.Is(err, errProviderRateLimited) || errors.Is(err, errProviderSaturated) {
+				status = http.StatusTooManyRequests
+			}
+			http.Error(w, "proxy error: "+err.Error(), status)
+		},
+	}
+}
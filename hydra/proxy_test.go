@@ -1,4 +1,4 @@
-package main
+package hydra
 
 import (
 	"io"
@@ -33,7 +33,7 @@ func TestNewProxy(t *testing.T) {
 		t.Fatalf("config validation failed: %v", err)
 	}
 
-	proxy := newProxy(&cfg.Listeners[0], cfg, logger)
+	proxy := NewProxy(&cfg.Listeners[0], cfg, logger)
 
 	if proxy == nil {
 		t.Fatal("expected proxy, got nil")
@@ -58,7 +58,7 @@ func TestNewProxy_Transport(t *testing.T) {
 		t.Fatalf("config validation failed: %v", err)
 	}
 
-	proxy := newProxy(&cfg.Listeners[0], cfg, log.New(io.Discard))
+	proxy := NewProxy(&cfg.Listeners[0], cfg, log.New(io.Discard))
 
 	if proxy.Transport == nil {
 		t.Fatal("expected transport, got nil")
@@ -83,7 +83,7 @@ func TestNewProxy_FlushInterval(t *testing.T) {
 		t.Fatalf("config validation failed: %v", err)
 	}
 
-	proxy := newProxy(&cfg.Listeners[0], cfg, log.New(io.Discard))
+	proxy := NewProxy(&cfg.Listeners[0], cfg, log.New(io.Discard))
 
 	if proxy.FlushInterval != -1 {
 		t.Errorf("expected FlushInterval -1, got %d", proxy.FlushInterval)
@@ -108,7 +108,7 @@ func TestNewProxy_ErrorHandler(t *testing.T) {
 		t.Fatalf("config validation failed: %v", err)
 	}
 
-	proxy := newProxy(&cfg.Listeners[0], cfg, log.New(io.Discard))
+	proxy := NewProxy(&cfg.Listeners[0], cfg, log.New(io.Discard))
 
 	if proxy.ErrorHandler == nil {
 		t.Fatal("expected error handler, got nil")
@@ -125,7 +125,7 @@ func TestNewProxy_ErrorHandler(t *testing.T) {
 
 // Ensure the transport allows HTTP/2 for server providers
 func TestRetryTransport_HTTP2(t *testing.T) {
-	trans := newRetryTransport(
+	trans := NewRetryTransport(
 		[]Model{},
 		map[string]Provider{},
 		RetryConfig{},
@@ -0,0 +1,195 @@
+package hydra
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// providerQuotas collects the rate-limit state reported by upstream providers.
+var providerQuotas = newQuotaTracker()
+
+var (
+	quotaRemainingGauge = metrics.Gauge(
+		"hydrallm_provider_quota_remaining",
+		"Remaining provider quota as reported by rate-limit headers.",
+	)
+	quotaLimitGauge = metrics.Gauge(
+		"hydrallm_provider_quota_limit",
+		"Provider quota limit as reported by rate-limit headers.",
+	)
+)
+
+// ProviderQuota is the most recent rate-limit state reported by a provider.
+type ProviderQuota struct {
+	Requests       *QuotaWindow `json:"requests,omitempty"`
+	Tokens         *QuotaWindow `json:"tokens,omitempty"`
+	SaturatedUntil *time.Time   `json:"saturated_until,omitempty"` // Set from Retry-After
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Saturated reports whether the provider asked clients to back off until after now.
+func (p ProviderQuota) Saturated(now time.Time) bool {
+	return p.SaturatedUntil != nil && now.Before(*p.SaturatedUntil)
+}
+
+// QuotaWindow is the limit and remaining amount of one rate-limit window.
+type QuotaWindow struct {
+	Limit     int64  `json:"limit"`
+	Remaining int64  `json:"remaining"`
+	Reset     string `json:"reset,omitempty"` // Reset value as reported by the provider
+}
+
+// quotaHeaderSchemes build rate-limit header names for each provider naming scheme.
+// OpenAI uses x-ratelimit-remaining-requests, Anthropic uses
+// anthropic-ratelimit-requests-remaining.
+var quotaHeaderSchemes = []func(kind, field string) string{
+	func(kind, field string) string { return "x-ratelimit-" + field + "-" + kind },
+	func(kind, field string) string { return "anthropic-ratelimit-" + kind + "-" + field },
+}
+
+type quotaTracker struct {
+	mu     sync.RWMutex
+	quotas map[string]ProviderQuota
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{quotas: make(map[string]ProviderQuota)}
+}
+
+// observe records rate-limit headers from a provider response.
+// Responses without rate-limit headers leave the previous state untouched.
+func (q *quotaTracker) observe(provider string, h http.Header) {
+	requests := parseQuotaWindow(h, "requests")
+	tokens := parseQuotaWindow(h, "tokens")
+	if requests == nil && tokens == nil {
+		return
+	}
+
+	q.mu.Lock()
+	quota := q.quotas[provider]
+	if requests != nil {
+		quota.Requests = requests
+	}
+	if tokens != nil {
+		quota.Tokens = tokens
+	}
+	quota.UpdatedAt = time.Now()
+	q.quotas[provider] = quota
+	q.mu.Unlock()
+
+	for kind, w := range map[string]*QuotaWindow{"requests": requests, "tokens": tokens} {
+		if w == nil {
+			continue
+		}
+		quotaRemainingGauge.Set(float64(w.Remaining), "provider", provider, "kind", kind)
+		quotaLimitGauge.Set(float64(w.Limit), "provider", provider, "kind", kind)
+	}
+}
+
+// saturate marks a provider as saturated until the given time, as requested
+// by a Retry-After header. An earlier deadline never shortens a later one.
+func (q *quotaTracker) saturate(provider string, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	quota := q.quotas[provider]
+	if quota.SaturatedUntil != nil && quota.SaturatedUntil.After(until) {
+		return
+	}
+	quota.SaturatedUntil = &until
+	quota.UpdatedAt = time.Now()
+	q.quotas[provider] = quota
+}
+
+// snapshot returns a copy of the current quota state by provider.
+func (q *quotaTracker) snapshot() map[string]ProviderQuota {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return maps.Clone(q.quotas)
+}
+
+// parseQuotaWindow reads one rate-limit window from response headers.
+// It returns nil when the provider did not report a remaining value.
+func parseQuotaWindow(h http.Header, kind string) *QuotaWindow {
+	for _, name := range quotaHeaderSchemes {
+		remaining, err := strconv.ParseInt(h.Get(name(kind, "remaining")), 10, 64)
+		if err != nil {
+			continue
+		}
+		limit, _ := strconv.ParseInt(h.Get(name(kind, "limit")), 10, 64)
+		return &QuotaWindow{
+			Limit:     limit,
+			Remaining: remaining,
+			Reset:     h.Get(name(kind, "reset")),
+		}
+	}
+	return nil
+}
+
+// aggregate sums the latest quota windows of the given providers.
+// Each provider is counted once; providers without data are skipped.
+func (q *quotaTracker) aggregate(providers []string) (requests, tokens *QuotaWindow) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	add := func(total, w *QuotaWindow) *QuotaWindow {
+		if w == nil {
+			return total
+		}
+		if total == nil {
+			total = &QuotaWindow{}
+		}
+		total.Limit += w.Limit
+		total.Remaining += w.Remaining
+		return total
+	}
+
+	seen := make(map[string]struct{}, len(providers))
+	for _, p := range providers {
+		if _, dup := seen[p]; dup {
+			continue
+		}
+		seen[p] = struct{}{}
+		quota, ok := q.quotas[p]
+		if !ok {
+			continue
+		}
+		requests = add(requests, quota.Requests)
+		tokens = add(tokens, quota.Tokens)
+	}
+	return requests, tokens
+}
+
+// setRateLimitHeaders replaces upstream rate-limit headers with totals across
+// the listener's model chain, when the listener enables it. Header names follow
+// the listener's API type so client SDKs recognize them.
+func setRateLimitHeaders(resp *http.Response, state *transportState) {
+	if state.listener == nil || !state.listener.RateLimitHeaders {
+		return
+	}
+
+	providers := make([]string, 0, len(state.models))
+	for _, m := range state.models {
+		providers = append(providers, m.Provider)
+	}
+	requests, tokens := providerQuotas.aggregate(providers)
+
+	name := quotaHeaderSchemes[0]
+	if state.listener.ConfigType == "anthropic" {
+		name = quotaHeaderSchemes[1]
+	}
+
+	for kind, w := range map[string]*QuotaWindow{"requests": requests, "tokens": tokens} {
+		for _, scheme := range quotaHeaderSchemes {
+			resp.Header.Del(scheme(kind, "limit"))
+			resp.Header.Del(scheme(kind, "remaining"))
+		}
+		if w == nil {
+			continue
+		}
+		resp.Header.Set(name(kind, "limit"), strconv.FormatInt(w.Limit, 10))
+		resp.Header.Set(name(kind, "remaining"), strconv.FormatInt(w.Remaining, 10))
+	}
+}
@@ -0,0 +1,175 @@
+package hydra
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseQuotaWindow(t *testing.T) {
+	t.Run("openai headers", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("x-ratelimit-limit-requests", "500")
+		h.Set("x-ratelimit-remaining-requests", "499")
+		h.Set("x-ratelimit-reset-requests", "120ms")
+
+		w := parseQuotaWindow(h, "requests")
+		if w == nil {
+			t.Fatal("expected quota window")
+		}
+		if w.Limit != 500 || w.Remaining != 499 || w.Reset != "120ms" {
+			t.Errorf("unexpected window: %+v", w)
+		}
+	})
+
+	t.Run("anthropic headers", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("anthropic-ratelimit-tokens-limit", "80000")
+		h.Set("anthropic-ratelimit-tokens-remaining", "79000")
+		h.Set("anthropic-ratelimit-tokens-reset", "2026-01-01T00:00:00Z")
+
+		w := parseQuotaWindow(h, "tokens")
+		if w == nil {
+			t.Fatal("expected quota window")
+		}
+		if w.Limit != 80000 || w.Remaining != 79000 {
+			t.Errorf("unexpected window: %+v", w)
+		}
+	})
+
+	t.Run("no headers", func(t *testing.T) {
+		if w := parseQuotaWindow(http.Header{}, "requests"); w != nil {
+			t.Errorf("expected nil, got %+v", w)
+		}
+	})
+}
+
+func TestQuotaTracker_Observe(t *testing.T) {
+	q := newQuotaTracker()
+
+	h := http.Header{}
+	h.Set("x-ratelimit-limit-requests", "10")
+	h.Set("x-ratelimit-remaining-requests", "9")
+	q.observe("openai", h)
+
+	// Responses without headers keep the previous state
+	q.observe("openai", http.Header{})
+
+	h = http.Header{}
+	h.Set("x-ratelimit-limit-tokens", "1000")
+	h.Set("x-ratelimit-remaining-tokens", "900")
+	q.observe("openai", h)
+
+	got, ok := q.snapshot()["openai"]
+	if !ok {
+		t.Fatal("expected quota for openai")
+	}
+	if got.Requests == nil || got.Requests.Remaining != 9 {
+		t.Errorf("expected requests remaining 9, got %+v", got.Requests)
+	}
+	if got.Tokens == nil || got.Tokens.Remaining != 900 {
+		t.Errorf("expected tokens remaining 900, got %+v", got.Tokens)
+	}
+	if got.UpdatedAt.IsZero() {
+		t.Error("expected updated_at to be set")
+	}
+
+	if v := metrics.value(
+		"hydrallm_provider_quota_remaining",
+		"provider", "openai", "kind", "tokens",
+	); v != 900 {
+		t.Errorf("expected remaining gauge 900, got %v", v)
+	}
+}
+
+func TestQuotaTracker_Aggregate(t *testing.T) {
+	q := newQuotaTracker()
+
+	h := http.Header{}
+	h.Set("x-ratelimit-limit-requests", "100")
+	h.Set("x-ratelimit-remaining-requests", "40")
+	q.observe("aggregate-a", h)
+
+	h = http.Header{}
+	h.Set("anthropic-ratelimit-requests-limit", "50")
+	h.Set("anthropic-ratelimit-requests-remaining", "10")
+	h.Set("anthropic-ratelimit-tokens-limit", "8000")
+	h.Set("anthropic-ratelimit-tokens-remaining", "7000")
+	q.observe("aggregate-b", h)
+
+	// Duplicate and unknown providers must not change the totals
+	requests, tokens := q.aggregate([]string{"aggregate-a", "aggregate-b", "aggregate-a", "unknown"})
+	if requests == nil || requests.Limit != 150 || requests.Remaining != 50 {
+		t.Errorf("unexpected requests total: %+v", requests)
+	}
+	if tokens == nil || tokens.Limit != 8000 || tokens.Remaining != 7000 {
+		t.Errorf("unexpected tokens total: %+v", tokens)
+	}
+
+	requests, tokens = q.aggregate([]string{"unknown"})
+	if requests != nil || tokens != nil {
+		t.Errorf("expected no totals, got %+v %+v", requests, tokens)
+	}
+}
+
+func TestSetRateLimitHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("x-ratelimit-limit-requests", "100")
+	h.Set("x-ratelimit-remaining-requests", "40")
+	providerQuotas.observe("ratelimit-a", h)
+
+	h = http.Header{}
+	h.Set("x-ratelimit-limit-requests", "20")
+	h.Set("x-ratelimit-remaining-requests", "5")
+	providerQuotas.observe("ratelimit-b", h)
+
+	models := []Model{{Provider: "ratelimit-a"}, {Provider: "ratelimit-b"}}
+
+	t.Run("disabled", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("x-ratelimit-remaining-requests", "40")
+		state := &transportState{listener: &Listener{ConfigType: "openai"}, models: models}
+
+		setRateLimitHeaders(resp, state)
+		if got := resp.Header.Get("x-ratelimit-remaining-requests"); got != "40" {
+			t.Errorf("expected upstream header untouched, got %q", got)
+		}
+	})
+
+	t.Run("openai listener", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("x-ratelimit-remaining-requests", "40")
+		resp.Header.Set("x-ratelimit-remaining-tokens", "900")
+		state := &transportState{
+			listener: &Listener{ConfigType: "openai", RateLimitHeaders: true},
+			models:   models,
+		}
+
+		setRateLimitHeaders(resp, state)
+		if got := resp.Header.Get("x-ratelimit-limit-requests"); got != "120" {
+			t.Errorf("expected limit 120, got %q", got)
+		}
+		if got := resp.Header.Get("x-ratelimit-remaining-requests"); got != "45" {
+			t.Errorf("expected remaining 45, got %q", got)
+		}
+		// Token headers from a single upstream are dropped when no totals exist
+		if got := resp.Header.Get("x-ratelimit-remaining-tokens"); got != "" {
+			t.Errorf("expected token header removed, got %q", got)
+		}
+	})
+
+	t.Run("anthropic listener", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		state := &transportState{
+			listener: &Listener{ConfigType: "anthropic", RateLimitHeaders: true},
+			models:   models,
+		}
+
+		setRateLimitHeaders(resp, state)
+		if got := resp.Header.Get("anthropic-ratelimit-requests-remaining"); got != "45" {
+			t.Errorf("expected remaining 45, got %q", got)
+		}
+		if got := resp.Header.Get("x-ratelimit-remaining-requests"); got != "" {
+			t.Errorf("expected no openai header, got %q", got)
+		}
+	})
+}
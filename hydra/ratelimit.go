@@ -0,0 +1,247 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// usageLineTail bounds how much of a single line the usage scanner keeps.
+// Usage objects sit at the end of a response, so the tail is enough.
+const usageLineTail = 64 * 1024
+
+// errProviderRateLimited is returned when a provider's local rate limit would
+// delay a request longer than its max_wait.
+var errProviderRateLimited = errors.New("provider rate limit reached")
+
+// providerLimits enforces the configured request and token rates of providers.
+var providerLimits = newRateLimiter()
+
+var rateLimitSkipsCounter = metrics.Counter(
+	"hydrallm_rate_limit_skips_total",
+	"Attempts skipped because the provider's configured rate limit was reached.",
+)
+
+// RateLimit caps the rate at which requests are sent to a provider.
+// Zero values disable the corresponding limit.
+type RateLimit struct {
+	RequestsPerMinute int           `mapstructure:"requests_per_minute"`
+	TokensPerMinute   int           `mapstructure:"tokens_per_minute"` // From response usage
+	MaxWait           time.Duration `mapstructure:"max_wait"`          // Wait instead of skipping
+	MaxConcurrency    int           `mapstructure:"max_concurrency"`   // Requests in flight
+}
+
+// enabled reports whether any limit is set.
+func (r RateLimit) enabled() bool {
+	return r.RequestsPerMinute > 0 || r.TokensPerMinute > 0
+}
+
+// tokenBucket refills continuously up to capacity. Tokens may go negative
+// when usage is only known after the fact.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued since the last refill, as per-minute rate.
+func (b *tokenBucket) refill(perMinute int, now time.Time) {
+	capacity := float64(perMinute)
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens += now.Sub(b.last).Minutes() * capacity
+	}
+	b.tokens = min(b.tokens, capacity)
+	b.last = now
+}
+
+// until returns how long until the bucket holds at least need tokens.
+func (b *tokenBucket) until(perMinute int, need float64) time.Duration {
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / float64(perMinute) * float64(time.Minute))
+}
+
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests map[string]*tokenBucket
+	tokens   map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		requests: make(map[string]*tokenBucket),
+		tokens:   make(map[string]*tokenBucket),
+	}
+}
+
+func bucketFor(buckets map[string]*tokenBucket, provider string) *tokenBucket {
+	b, ok := buckets[provider]
+	if !ok {
+		b = &tokenBucket{}
+		buckets[provider] = b
+	}
+	return b
+}
+
+// take sends a request through the provider's limits. It returns zero when the
+// request may be sent now, or how long until it could be.
+func (r *rateLimiter) take(provider string, limit RateLimit, now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var wait time.Duration
+	if limit.RequestsPerMinute > 0 {
+		b := bucketFor(r.requests, provider)
+		b.refill(limit.RequestsPerMinute, now)
+		wait = b.until(limit.RequestsPerMinute, 1)
+	}
+	if limit.TokensPerMinute > 0 {
+		// Token use is unknown up front, so only a depleted bucket blocks
+		b := bucketFor(r.tokens, provider)
+		b.refill(limit.TokensPerMinute, now)
+		wait = max(wait, b.until(limit.TokensPerMinute, 1))
+	}
+	if wait == 0 && limit.RequestsPerMinute > 0 {
+		r.requests[provider].tokens--
+	}
+	return wait
+}
+
+// consume charges tokens used by a completed request to the provider.
+func (r *rateLimiter) consume(provider string, limit RateLimit, tokens int, now time.Time) {
+	if limit.TokensPerMinute <= 0 || tokens <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := bucketFor(r.tokens, provider)
+	b.refill(limit.TokensPerMinute, now)
+	b.tokens -= float64(tokens)
+}
+
+// acquire waits until the provider's limits admit a request. It returns
+// errProviderRateLimited without waiting when that would take longer than
+// the limit's max_wait.
+func (r *rateLimiter) acquire(ctx context.Context, provider string, limit RateLimit) error {
+	if !limit.enabled() {
+		return nil
+	}
+	deadline := time.Now().Add(limit.MaxWait)
+	for {
+		now := time.Now()
+		wait := r.take(provider, limit, now)
+		if wait == 0 {
+			return nil
+		}
+		if now.Add(wait).After(deadline) {
+			return errProviderRateLimited
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// usageTokenPattern matches token counts in OpenAI, Anthropic, Gemini,
+// Bedrock, and Ollama usage objects.
+var usageTokenPattern = regexp.MustCompile(
+	`"(prompt_tokens|input_tokens|promptTokenCount|inputTokens|prompt_eval_count|` +
+		`completion_tokens|output_tokens|candidatesTokenCount|outputTokens|eval_count|` +
+		`total_tokens|totalTokenCount|totalTokens)"\s*:\s*(\d+)`,
+)
+
+// tokenUsage is the token use reported by a response.
+type tokenUsage struct {
+	Input  int
+	Output int
+	Total  int // As reported, zero if not
+}
+
+// observe reads the usage objects in one line. Streams report usage more than
+// once, cumulatively or split across events, so the largest count of each
+// kind is kept.
+func (u *tokenUsage) observe(line []byte) {
+	for _, m := range usageTokenPattern.FindAllSubmatch(line, -1) {
+		n, _ := strconv.Atoi(string(m[2]))
+		switch string(m[1]) {
+		case "prompt_tokens", "input_tokens", "promptTokenCount", "inputTokens",
+			"prompt_eval_count":
+			u.Input = max(u.Input, n)
+		case "completion_tokens", "output_tokens", "candidatesTokenCount", "outputTokens",
+			"eval_count":
+			u.Output = max(u.Output, n)
+		default:
+			u.Total = max(u.Total, n)
+		}
+	}
+}
+
+// total returns the reported total, or input plus output tokens.
+func (u tokenUsage) total() int {
+	if u.Total > 0 {
+		return u.Total
+	}
+	return u.Input + u.Output
+}
+
+// usageReader passes a response body through while reading the token use its
+// usage objects report, line by line, so streamed usage is counted too.
+// report is called once with the usage when the body ends or is closed.
+type usageReader struct {
+	io.ReadCloser
+	line     []byte
+	usage    tokenUsage
+	report   func(usage tokenUsage)
+	reported bool
+}
+
+func newUsageReader(body io.ReadCloser, report func(usage tokenUsage)) *usageReader {
+	return &usageReader{ReadCloser: body, report: report}
+}
+
+func (u *usageReader) Read(p []byte) (int, error) {
+	n, err := u.ReadCloser.Read(p)
+	data := p[:n]
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		u.line = append(u.line, data[:i]...)
+		u.usage.observe(u.line)
+		u.line = u.line[:0]
+		data = data[i+1:]
+	}
+	u.line = append(u.line, data...)
+	if len(u.line) > usageLineTail {
+		u.line = append(u.line[:0], u.line[len(u.line)-usageLineTail:]...)
+	}
+	if err != nil {
+		u.finish()
+	}
+	return n, err
+}
+
+func (u *usageReader) Close() error {
+	u.finish()
+	return u.ReadCloser.Close()
+}
+
+func (u *usageReader) finish() {
+	if u.reported {
+		return
+	}
+	u.reported = true
+	u.usage.observe(u.line)
+	u.line = nil
+	u.report(u.usage)
+}
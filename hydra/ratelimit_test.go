@@ -0,0 +1,132 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Requests(t *testing.T) {
+	r := newRateLimiter()
+	limit := RateLimit{RequestsPerMinute: 2}
+	now := time.Now()
+
+	for i := range 2 {
+		if wait := r.take("p", limit, now); wait != 0 {
+			t.Fatalf("request %d: expected no wait, got %v", i+1, wait)
+		}
+	}
+	if wait := r.take("p", limit, now); wait != 30*time.Second {
+		t.Errorf("expected 30s until the next request, got %v", wait)
+	}
+	if wait := r.take("p", limit, now.Add(30*time.Second)); wait != 0 {
+		t.Errorf("expected a request to be admitted after refill, got wait %v", wait)
+	}
+	if wait := r.take("other", limit, now); wait != 0 {
+		t.Errorf("expected providers to be limited independently, got wait %v", wait)
+	}
+}
+
+func TestRateLimiter_Tokens(t *testing.T) {
+	r := newRateLimiter()
+	limit := RateLimit{TokensPerMinute: 600}
+	now := time.Now()
+
+	if wait := r.take("p", limit, now); wait != 0 {
+		t.Fatalf("expected no wait, got %v", wait)
+	}
+	// Usage beyond the budget puts the bucket in debt
+	r.consume("p", limit, 700, now)
+	wait := r.take("p", limit, now)
+	if wait < 10*time.Second || wait > 11*time.Second {
+		t.Errorf("expected about 10s to repay 101 tokens at 10/s, got %v", wait)
+	}
+}
+
+func TestRateLimiter_Acquire(t *testing.T) {
+	r := newRateLimiter()
+	ctx := context.Background()
+
+	if err := r.acquire(ctx, "p", RateLimit{}); err != nil {
+		t.Fatalf("expected no limit, got %v", err)
+	}
+
+	limit := RateLimit{RequestsPerMinute: 1}
+	if err := r.acquire(ctx, "p", limit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.acquire(ctx, "p", limit); !errors.Is(err, errProviderRateLimited) {
+		t.Errorf("expected errProviderRateLimited, got %v", err)
+	}
+
+	// 6000/min admits a request every 10ms, within max_wait
+	limit = RateLimit{RequestsPerMinute: 6000, MaxWait: time.Second}
+	r.requests["fast"] = &tokenBucket{tokens: 0, last: time.Now()}
+	start := time.Now()
+	if err := r.acquire(ctx, "fast", limit); err != nil {
+		t.Fatalf("expected to wait for the limit, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("expected acquire to wait, took %v", elapsed)
+	}
+}
+
+func TestUsageReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{
+			name:     "openai",
+			body:     `{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+			expected: 15,
+		},
+		{
+			name:     "anthropic",
+			body:     `{"content":[],"usage":{"input_tokens":10,"output_tokens":7}}`,
+			expected: 17,
+		},
+		{
+			name: "openai stream",
+			body: "data: {\"choices\":[],\"usage\":null}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"total_tokens\":42}}\n\ndata: [DONE]\n\n",
+			expected: 42,
+		},
+		{
+			name: "anthropic stream",
+			body: "event: message_start\ndata: {\"message\":{\"usage\":{\"input_tokens\":12," +
+				"\"output_tokens\":1}}}\n\nevent: message_delta\ndata: {\"usage\":" +
+				"{\"output_tokens\":30}}\n\n",
+			expected: 42,
+		},
+		{
+			name:     "no usage",
+			body:     `{"data":[]}`,
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reported := -1
+			u := newUsageReader(io.NopCloser(strings.NewReader(tt.body)), func(usage tokenUsage) {
+				if reported != -1 {
+					t.Error("expected usage to be reported once")
+				}
+				reported = usage.total()
+			})
+			out, _ := io.ReadAll(u)
+			_ = u.Close()
+			if string(out) != tt.body {
+				t.Errorf("expected body to pass through unchanged, got %q", out)
+			}
+			if reported != tt.expected {
+				t.Errorf("expected %d tokens, got %d", tt.expected, reported)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package hydra
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisIdleConns is the number of idle connections kept per Redis client.
+const redisIdleConns = 4
+
+// errRedisNil is returned for a nil reply, such as GET on a missing key.
+var errRedisNil = errors.New("redis: nil reply")
+
+// redisClient is a minimal Redis client speaking RESP over TCP, sufficient
+// for the cache's GET and SET commands.
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newRedisClient parses a redis://[user:password@]host[:port][/db] URL.
+func newRedisClient(rawURL string, timeout time.Duration) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid redis url: unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("invalid redis url: host is required")
+	}
+
+	c := &redisClient{
+		addr:    u.Host,
+		timeout: timeout,
+		idle:    make(chan *redisConn, redisIdleConns),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis url: database %q is not a number", db)
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply. Bulk string replies are returned
+// as []byte, simple strings as string, and integers as int64.
+func (c *redisClient) do(args ...string) (any, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(c.timeout, args...)
+	if err != nil && !errors.Is(err, errRedisNil) && !isRedisError(err) {
+		// The connection state is unknown after an I/O error
+		_ = conn.Close()
+		return nil, err
+	}
+
+	select {
+	case c.idle <- conn:
+	default:
+		_ = conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one.
+func (c *redisClient) conn() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	nc, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.do(c.timeout, args...); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (any, error) {
+	if timeout > 0 {
+		_ = c.SetDeadline(time.Now().Add(timeout))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readRedisReply(c.r)
+}
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func isRedisError(err error) bool {
+	var re redisError
+	return errors.As(err, &re)
+}
+
+// readRedisReply reads one RESP reply. Arrays are not needed by the cache and
+// are rejected.
+func readRedisReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply %q", line)
+	}
+}
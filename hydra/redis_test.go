@@ -0,0 +1,149 @@
+package hydra
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves GET, SET, AUTH, and SELECT from memory, recording commands.
+type fakeRedis struct {
+	mu       sync.Mutex
+	data     map[string]string
+	commands [][]string
+}
+
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	f := &fakeRedis{data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			header, _ := r.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(r, arg); err != nil {
+				return
+			}
+			args[i] = string(arg[:size])
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, args)
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if v, ok := f.data[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			f.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "AUTH", "SELECT":
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		_, _ = conn.Write([]byte(reply))
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	f, addr := startFakeRedis(t)
+	client, err := newRedisClient("redis://:secret@"+addr+"/2", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := &redisCache{client: client}
+
+	if _, found, err := c.Get("k"); err != nil || found {
+		t.Fatalf("expected miss, got found=%v err=%v", found, err)
+	}
+	if err := c.Set("k", []byte("value\r\nwith newline"), 90*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v, found, err := c.Get("k")
+	if err != nil || !found || string(v) != "value\r\nwith newline" {
+		t.Fatalf("expected stored value, got %q found=%v err=%v", v, found, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	want := []string{"AUTH secret", "SELECT 2", "GET hydrallm:cache:k"}
+	for i, w := range want {
+		if got := strings.Join(f.commands[i], " "); got != w {
+			t.Errorf("command %d: expected %q, got %q", i, w, got)
+		}
+	}
+	if got := strings.Join(f.commands[3], " "); !strings.HasSuffix(got, "PX 90000") {
+		t.Errorf("expected SET with PX 90000, got %q", got)
+	}
+	// The connection is reused, so AUTH and SELECT are sent once
+	if len(f.commands) != 5 {
+		t.Errorf("expected 5 commands on one connection, got %d", len(f.commands))
+	}
+}
+
+func TestNewRedisClient(t *testing.T) {
+	c, err := newRedisClient("redis://cache.internal", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.addr != "cache.internal:6379" {
+		t.Errorf("expected default port, got %s", c.addr)
+	}
+
+	for _, raw := range []string{"http://localhost", "redis://", "redis://localhost/db"} {
+		if _, err := newRedisClient(raw, time.Second); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestRedisCache_Unavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	client, _ := newRedisClient("redis://"+addr, 100*time.Millisecond)
+	if _, _, err := (&redisCache{client: client}).Get("k"); err == nil {
+		t.Error("expected error when redis is unreachable")
+	}
+}
@@ -0,0 +1,287 @@
+package hydra
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// reloadConfig re-reads the config file and applies it to the running transports.
+// On any read or validation error the running configuration is kept.
+func reloadConfig(current *Config, transports map[string]*RetryTransport) (*Config, error) {
+	if err := ReadConfig(); err != nil {
+		return current, fmt.Errorf("failed to read config: %w", err)
+	}
+	next, err := LoadConfig()
+	if err != nil {
+		return current, err
+	}
+	applyReload(current, next, transports, logger)
+	return next, nil
+}
+
+// upstreamRequests counts the upstream attempts in flight per provider and
+// model, so reloads can report when removed ones have drained.
+var upstreamRequests = newInFlightTracker()
+
+type inFlightTracker struct {
+	mu     sync.Mutex
+	counts map[string]int             // Keyed by "provider:<name>" or "model:<id>"
+	idle   map[string][]chan struct{} // Closed once the count drops to zero
+}
+
+func newInFlightTracker() *inFlightTracker {
+	return &inFlightTracker{
+		counts: make(map[string]int),
+		idle:   make(map[string][]chan struct{}),
+	}
+}
+
+// start counts an attempt on a model and returns the function that ends it.
+func (t *inFlightTracker) start(model Model) func() {
+	keys := []string{"provider:" + model.Provider, "model:" + model.ID}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		t.counts[key]++
+	}
+	return sync.OnceFunc(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for _, key := range keys {
+			if t.counts[key]--; t.counts[key] > 0 {
+				continue
+			}
+			delete(t.counts, key)
+			for _, ch := range t.idle[key] {
+				close(ch)
+			}
+			delete(t.idle, key)
+		}
+	})
+}
+
+// count returns the attempts in flight on a provider or model key.
+func (t *inFlightTracker) count(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.counts[key]
+}
+
+// drained returns a channel closed once no attempts are in flight on a key.
+func (t *inFlightTracker) drained(key string) <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch := make(chan struct{})
+	if t.counts[key] == 0 {
+		close(ch)
+	} else {
+		t.idle[key] = append(t.idle[key], ch)
+	}
+	return ch
+}
+
+// reloadDiff lists the names of the entities a reload adds, removes, or changes.
+type reloadDiff struct {
+	Added, Removed, Changed []string
+}
+
+func (d reloadDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffEntities compares two tables of entities by name.
+func diffEntities[V any](prev, next map[string]V, equal func(a, b V) bool) reloadDiff {
+	var d reloadDiff
+	for _, name := range slices.Sorted(maps.Keys(next)) {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, name)
+		case !equal(old, next[name]):
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(prev)) {
+		if _, ok := next[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	return d
+}
+
+// sameProvider compares the configured settings of two providers.
+func sameProvider(a, b Provider) bool {
+	a.ParsedURL, a.ParsedProxyURL, a.ParsedContentErrors = nil, nil, nil
+	b.ParsedURL, b.ParsedProxyURL, b.ParsedContentErrors = nil, nil, nil
+	a.ParsedDNSOverHTTPS, b.ParsedDNSOverHTTPS = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// sameModel compares the configured settings of two models.
+func sameModel(a, b Model) bool {
+	a.ParsedTemplate, b.ParsedTemplate = nil, nil
+	patterns := func(rs []OutputReplace) []OutputReplace {
+		rs = slices.Clone(rs)
+		for i := range rs {
+			rs[i].Parsed = nil
+		}
+		return rs
+	}
+	a.Output.Replace, b.Output.Replace = patterns(a.Output.Replace), patterns(b.Output.Replace)
+	return reflect.DeepEqual(a, b)
+}
+
+// sameListener compares the configured settings of two listeners. Resolved
+// chains are left out; changes of the models they refer to are reported as
+// model changes.
+func sameListener(a, b Listener) bool {
+	unresolved := func(l Listener) Listener {
+		l.ResolvedModels, l.ResolvedRoutes, l.ResolvedPromptRoutes = nil, nil, nil
+		l.ResolvedRules, l.ResolvedExperiment, l.ResolvedEmbeddings = nil, nil, nil
+		l.ResolvedMiddleware, l.ResolvedAPIKeys = nil, nil
+		return l
+	}
+	return reflect.DeepEqual(unresolved(a), unresolved(b))
+}
+
+// logReloadSummary logs the providers, models, and listeners a reload adds,
+// removes, or changes.
+func logReloadSummary(current, next *Config, logger *log.Logger) {
+	listeners := func(cfg *Config) map[string]Listener {
+		m := make(map[string]Listener, len(cfg.Listeners))
+		for _, l := range cfg.Listeners {
+			m[l.Name] = l
+		}
+		return m
+	}
+	diffs := []struct {
+		kind string
+		diff reloadDiff
+	}{
+		{"providers", diffEntities(current.Providers, next.Providers, sameProvider)},
+		{"models", diffEntities(current.Models, next.Models, sameModel)},
+		{"listeners", diffEntities(listeners(current), listeners(next), sameListener)},
+	}
+
+	var keyvals []any
+	for _, d := range diffs {
+		for _, change := range []struct {
+			verb  string
+			names []string
+		}{
+			{"added", d.diff.Added},
+			{"removed", d.diff.Removed},
+			{"changed", d.diff.Changed},
+		} {
+			if len(change.names) > 0 {
+				keyvals = append(keyvals, d.kind+"_"+change.verb, change.names)
+			}
+		}
+	}
+	if len(keyvals) == 0 {
+		logger.Info("reload summary: no changes")
+		return
+	}
+	logger.Info("reload summary", keyvals...)
+
+	drainRemoved(diffs[0].diff.Removed, "provider", logger)
+	drainRemoved(diffs[1].diff.Removed, "model", logger)
+}
+
+// drainRemoved reports removed providers or models that still have attempts
+// in flight, and logs once each has drained. Those attempts finish with the
+// config they started with; new requests no longer select them.
+func drainRemoved(names []string, kind string, logger *log.Logger) {
+	for _, name := range names {
+		key := kind + ":" + name
+		n := upstreamRequests.count(key)
+		if n == 0 {
+			continue
+		}
+		logger.Info(
+			"draining removed "+kind,
+			kind,
+			name,
+			"in_flight",
+			n,
+		)
+		go func() {
+			<-upstreamRequests.drained(key)
+			logger.Info("removed "+kind+" drained", kind, name)
+		}()
+	}
+}
+
+// applyReload swaps the model and provider tables of running listeners.
+// Changes that need new sockets or handlers (added or removed listeners,
+// addresses, timeouts, middleware and their settings, api keys) only take
+// effect after a restart.
+func applyReload(
+	current, next *Config,
+	transports map[string]*RetryTransport,
+	logger *log.Logger,
+) {
+	logReloadSummary(current, next, logger)
+	setGuardrails(next.Server)
+
+	for i := range next.Listeners {
+		l := &next.Listeners[i]
+		transport, ok := transports[l.Name]
+		if !ok {
+			logger.Warn("new listener requires restart", "listener", l.Name)
+			continue
+		}
+
+		if prev := FindListener(current, l.Name); prev != nil && !sameServing(prev, l) {
+			logger.Warn(
+				"listener address, timeout, middleware setting, or api key changes require restart",
+				"listener",
+				l.Name,
+			)
+		}
+
+		transport.Reload(l, next.Providers, next.ListenerRetry(l))
+		logger.Info("reloaded listener", "listener", l.Name, "models", len(l.ResolvedModels))
+	}
+
+	for name := range transports {
+		if FindListener(next, name) == nil {
+			logger.Warn("removed listener keeps serving until restart", "listener", name)
+		}
+	}
+}
+
+// FindListener returns the listener with the given name, or nil.
+func FindListener(cfg *Config, name string) *Listener {
+	for i := range cfg.Listeners {
+		if cfg.Listeners[i].Name == name {
+			return &cfg.Listeners[i]
+		}
+	}
+	return nil
+}
+
+// sameServing reports whether two listeners share the settings fixed at server
+// start: their sockets, and everything the middleware chain is built from.
+func sameServing(a, b *Listener) bool {
+	return slices.Equal(a.Addresses(), b.Addresses()) &&
+		a.ReadTimeout == b.ReadTimeout &&
+		a.WriteTimeout == b.WriteTimeout &&
+		a.MaxBodySize == b.MaxBodySize &&
+		a.ProbeStatus == b.ProbeStatus &&
+		slices.Equal(a.ResolvedMiddleware, b.ResolvedMiddleware) &&
+		reflect.DeepEqual(a.Allowlist, b.Allowlist) &&
+		reflect.DeepEqual(a.Filter, b.Filter) &&
+		reflect.DeepEqual(a.Corpus, b.Corpus) &&
+		a.Transcripts == b.Transcripts &&
+		a.Broadcast == b.Broadcast &&
+		a.Cache == b.Cache &&
+		slices.EqualFunc(a.ResolvedAPIKeys, b.ResolvedAPIKeys, func(x, y APIKey) bool {
+			return x.Name == y.Name && x.Key == y.Key && x.Quota == y.Quota
+		})
+}
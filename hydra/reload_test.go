@@ -0,0 +1,341 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestApplyReload_SwapsModels(t *testing.T) {
+	var gotModel string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte("model-b")) {
+			gotModel = "model-b"
+		} else {
+			gotModel = "model-a"
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	newConfig := func(model string) *Config {
+		cfg := &Config{
+			Retry: RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second},
+			Providers: map[string]Provider{
+				"mock": {URL: ts.URL},
+			},
+			Models: map[string]Model{
+				"m1": {Provider: "mock", Model: model, Type: "openai"},
+			},
+			Listeners: []Listener{
+				{Name: "main", Port: 8080, Models: []string{"m1"}},
+			},
+		}
+		applyDefaults(cfg)
+		if err := cfg.validate(); err != nil {
+			t.Fatalf("config validation failed: %v", err)
+		}
+		return cfg
+	}
+
+	current := newConfig("model-a")
+	logger := log.New(io.Discard)
+	transport := NewRetryTransport(
+		current.Listeners[0].ResolvedModels,
+		current.Providers,
+		current.Retry,
+		current.Log,
+		logger,
+	)
+	transports := map[string]*RetryTransport{"main": transport}
+
+	send := func() {
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original/v1/chat/completions",
+			bytes.NewReader([]byte(`{"model":"x"}`)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	send()
+	if gotModel != "model-a" {
+		t.Fatalf("expected model-a before reload, got %s", gotModel)
+	}
+
+	applyReload(current, newConfig("model-b"), transports, logger)
+
+	send()
+	if gotModel != "model-b" {
+		t.Errorf("expected model-b after reload, got %s", gotModel)
+	}
+}
+
+func TestSameServing(t *testing.T) {
+	base := Listener{Host: "127.0.0.1", Port: 8080, ReadTimeout: time.Minute}
+
+	tests := []struct {
+		name   string
+		modify func(*Listener)
+		want   bool
+	}{
+		{"identical", func(*Listener) {}, true},
+		{"models change only", func(l *Listener) { l.Models = []string{"other"} }, true},
+		{"port change", func(l *Listener) { l.Port = 9090 }, false},
+		{"bind added", func(l *Listener) { l.Binds = []Bind{{Host: "::1", Port: 8080}} }, false},
+		{"timeout change", func(l *Listener) { l.ReadTimeout = time.Second }, false},
+		{
+			"middleware change",
+			func(l *Listener) { l.ResolvedMiddleware = []string{"recover"} },
+			false,
+		},
+		{
+			"filter rule change",
+			func(l *Listener) { l.Filter.MaxMessages = FilterLimit{Limit: 10} },
+			false,
+		},
+		{"allowlist change", func(l *Listener) { l.Allowlist.Paths = []string{"/v1/"} }, false},
+		{"cache change", func(l *Listener) { l.Cache.TTL = time.Minute }, false},
+		{"corpus change", func(l *Listener) { l.Corpus.Path = "corpus.jsonl" }, false},
+		{"transcript change", func(l *Listener) { l.Transcripts.Dir = "transcripts" }, false},
+		{"broadcast change", func(l *Listener) { l.Broadcast.Enabled = true }, false},
+		{
+			"api key quota change",
+			func(l *Listener) {
+				l.ResolvedAPIKeys = []APIKey{{Name: "a", Quota: KeyQuota{RequestsPerDay: 1}}}
+			},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.modify(&other)
+			if got := sameServing(&base, &other); got != tt.want {
+				t.Errorf("sameServing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindListener(t *testing.T) {
+	cfg := &Config{Listeners: []Listener{{Name: "a"}, {Name: "b"}}}
+	if l := FindListener(cfg, "b"); l == nil || l.Name != "b" {
+		t.Errorf("expected listener b, got %v", l)
+	}
+	if l := FindListener(cfg, "missing"); l != nil {
+		t.Errorf("expected nil, got %v", l)
+	}
+}
+
+func TestDiffEntities(t *testing.T) {
+	prev := map[string]Model{
+		"kept":    {Provider: "p", Model: "a"},
+		"changed": {Provider: "p", Model: "b"},
+		"removed": {Provider: "p", Model: "c"},
+	}
+	next := map[string]Model{
+		"kept":    {Provider: "p", Model: "a"},
+		"changed": {Provider: "p", Model: "b2"},
+		"added":   {Provider: "p", Model: "d"},
+	}
+
+	d := diffEntities(prev, next, sameModel)
+	if !slices.Equal(d.Added, []string{"added"}) {
+		t.Errorf("Added = %v, want [added]", d.Added)
+	}
+	if !slices.Equal(d.Removed, []string{"removed"}) {
+		t.Errorf("Removed = %v, want [removed]", d.Removed)
+	}
+	if !slices.Equal(d.Changed, []string{"changed"}) {
+		t.Errorf("Changed = %v, want [changed]", d.Changed)
+	}
+	if d := diffEntities(prev, prev, sameModel); !d.empty() {
+		t.Errorf("expected no changes, got %+v", d)
+	}
+}
+
+func TestSameListener_IgnoresResolved(t *testing.T) {
+	a := Listener{Name: "main", Models: []string{"m1"}}
+	b := a
+	b.ResolvedModels = []Model{{ID: "m1"}}
+	if !sameListener(a, b) {
+		t.Error("expected resolved chains to be ignored")
+	}
+	b.Models = []string{"m2"}
+	if sameListener(a, b) {
+		t.Error("expected a models change to be reported")
+	}
+}
+
+func TestInFlightTracker_Drained(t *testing.T) {
+	tracker := newInFlightTracker()
+	model := Model{ID: "drain-model", Provider: "drain-provider"}
+
+	finish := tracker.start(model)
+	second := tracker.start(model)
+	if n := tracker.count("provider:drain-provider"); n != 2 {
+		t.Fatalf("expected 2 in flight, got %d", n)
+	}
+
+	drained := tracker.drained("model:drain-model")
+	finish()
+	finish() // Ending an attempt twice counts once
+	select {
+	case <-drained:
+		t.Fatal("drained with an attempt in flight")
+	default:
+	}
+
+	second()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("expected drained once all attempts ended")
+	}
+	if n := tracker.count("model:drain-model"); n != 0 {
+		t.Errorf("expected 0 in flight, got %d", n)
+	}
+	select {
+	case <-tracker.drained("model:idle"):
+	default:
+		t.Error("expected an idle key to be drained")
+	}
+}
+
+func TestApplyReload_DrainsRemovedModel(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	newConfig := func(models ...string) *Config {
+		cfg := &Config{
+			Retry:     RetryConfig{MaxCycles: 1, DefaultTimeout: 5 * time.Second},
+			Providers: map[string]Provider{"reload-drain": {URL: ts.URL}},
+			Models:    map[string]Model{},
+			Listeners: []Listener{{Name: "main", Port: 8080, Models: models}},
+		}
+		for _, id := range models {
+			cfg.Models[id] = Model{Provider: "reload-drain", Model: id, Type: "openai"}
+		}
+		applyDefaults(cfg)
+		if err := cfg.validate(); err != nil {
+			t.Fatalf("config validation failed: %v", err)
+		}
+		return cfg
+	}
+
+	current := newConfig("reload-old")
+	transport := NewRetryTransport(
+		current.Listeners[0].ResolvedModels,
+		current.Providers,
+		current.Retry,
+		current.Log,
+		log.New(io.Discard),
+	)
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"x"}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var logs bytes.Buffer
+	applyReload(
+		current,
+		newConfig("reload-new"),
+		map[string]*RetryTransport{"main": transport},
+		log.New(&logs),
+	)
+	out := logs.String()
+	for _, want := range []string{
+		"models_added=[reload-new]",
+		"models_removed=[reload-old]",
+		"draining removed model",
+		"in_flight=1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in reload log:\n%s", want, out)
+		}
+	}
+
+	drained := upstreamRequests.drained("model:reload-old")
+	_ = resp.Body.Close()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("expected the removed model to drain once its response was closed")
+	}
+}
+
+func TestTransport_RoundTrip_ReloadMidRequest(t *testing.T) {
+	var transport *RetryTransport
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// A reload removing the provider lands between two attempts
+			next := &Listener{Name: "next"}
+			transport.Reload(next, map[string]Provider{}, RetryConfig{MaxCycles: 1})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	models := []Model{{
+		ID:       "reloaded",
+		Provider: "reloaded",
+		Model:    "m",
+		Type:     "openai",
+		Attempts: 2,
+		Timeout:  time.Second,
+	}}
+	providers := map[string]Provider{
+		"reloaded": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	transport = NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"x"}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected the retry to use the tables the request started with, got %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("expected the second attempt to succeed, got %d after %d calls",
+			resp.StatusCode, calls)
+	}
+}
@@ -0,0 +1,232 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/tidwall/sjson"
+)
+
+// Listener stream_repair modes, applied to streams that end without a final event.
+const (
+	streamRepairOff      = "off"      // Forward the stream as-is
+	streamRepairError    = "error"    // Append a synthetic error event
+	streamRepairContinue = "continue" // Re-request with the partial output, then error
+)
+
+// streamInterruptedMessage is the message of synthetic error events.
+const streamInterruptedMessage = "upstream stream ended before completion"
+
+// continuationContextKey marks the context of a request continuing an
+// interrupted stream or truncated response.
+type continuationContextKey struct{}
+
+func isSupportedStreamRepair(mode string) bool {
+	switch mode {
+	case streamRepairOff, streamRepairError, streamRepairContinue:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamChunk holds the fields of an OpenAI or Anthropic stream event used to
+// track progress.
+type streamChunk struct {
+	Type    string `json:"type"` // Anthropic event type
+	Choices []struct {
+		Delta struct {
+			Content   string          `json:"content"`
+			ToolCalls json.RawMessage `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Delta struct {
+		Type       string  `json:"type"`
+		Text       string  `json:"text"`
+		StopReason *string `json:"stop_reason"`
+	} `json:"delta"`
+	ContentBlock struct {
+		Type string `json:"type"`
+	} `json:"content_block"`
+	Error json.RawMessage `json:"error"`
+}
+
+// streamRepairer forwards a server-sent event stream event by event and repairs
+// it when the upstream ends it before a final event. In continue mode the
+// generated text is sent back through resume, and the continuation's events
+// are spliced into the stream. Streams that produced tool calls are not
+// continued, since partial tool input cannot be resumed.
+type streamRepairer struct {
+	src    io.ReadCloser
+	mode   string
+	resume func(partial string) (io.ReadCloser, error)
+
+	raw     bytes.Buffer // Upstream bytes not yet forming a complete event
+	pending bytes.Buffer // Bytes ready for the client
+	chunk   []byte
+	done    bool
+
+	complete  bool // A final event was seen
+	anthropic bool
+	toolUse   bool
+	resumed   bool // src is a continuation
+	text      strings.Builder
+}
+
+func newStreamRepairer(
+	src io.ReadCloser,
+	mode string,
+	resume func(partial string) (io.ReadCloser, error),
+) *streamRepairer {
+	return &streamRepairer{src: src, mode: mode, resume: resume, chunk: make([]byte, 4096)}
+}
+
+func (s *streamRepairer) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		n, err := s.src.Read(s.chunk)
+		s.raw.Write(s.chunk[:n])
+		s.forwardEvents()
+		if err != nil {
+			s.finish()
+		}
+	}
+	return s.pending.Read(p)
+}
+
+func (s *streamRepairer) Close() error {
+	s.done = true
+	return s.src.Close()
+}
+
+// forwardEvents moves every complete event from raw to pending.
+func (s *streamRepairer) forwardEvents() {
+	for {
+		b := s.raw.Bytes()
+		end, sep := bytes.Index(b, []byte("\n\n")), 2
+		if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 && (end < 0 || i < end) {
+			end, sep = i, 4
+		}
+		if end < 0 {
+			return
+		}
+		event := b[:end+sep]
+		if s.observe(event[:end]) {
+			s.pending.Write(event)
+		}
+		s.raw.Next(end + sep)
+	}
+}
+
+// observe records the progress an event reports and whether it is forwarded.
+// A continuation's opening events are dropped, as the client already has them.
+func (s *streamRepairer) observe(event []byte) bool {
+	var data []byte
+	for line := range bytes.SplitSeq(event, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(payload, []byte(" "))...)
+		}
+	}
+	if string(data) == "[DONE]" {
+		s.complete = true
+		return true
+	}
+
+	var chunk streamChunk
+	if json.Unmarshal(data, &chunk) != nil {
+		return true
+	}
+	if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+		s.complete = true
+		return true
+	}
+
+	if chunk.Type != "" {
+		s.anthropic = true
+		switch chunk.Type {
+		case "message_start":
+			return !s.resumed
+		case "content_block_start":
+			if chunk.ContentBlock.Type != "text" {
+				s.toolUse = true
+			}
+			return !s.resumed
+		case "content_block_delta":
+			if chunk.Delta.Type == "text_delta" {
+				s.text.WriteString(chunk.Delta.Text)
+			} else {
+				s.toolUse = true
+			}
+		case "message_delta":
+			s.complete = s.complete || chunk.Delta.StopReason != nil
+		case "message_stop", "error":
+			s.complete = true
+		}
+		return true
+	}
+
+	for _, choice := range chunk.Choices {
+		s.text.WriteString(choice.Delta.Content)
+		if len(choice.Delta.ToolCalls) > 0 && string(choice.Delta.ToolCalls) != "null" {
+			s.toolUse = true
+		}
+		if choice.FinishReason != nil {
+			s.complete = true
+		}
+	}
+	return true
+}
+
+// finish handles the end of the current upstream stream.
+func (s *streamRepairer) finish() {
+	_ = s.src.Close()
+	if s.complete {
+		s.pending.Write(s.raw.Bytes())
+		s.raw.Reset()
+		s.done = true
+		return
+	}
+
+	// A trailing partial event would only confuse the client
+	s.raw.Reset()
+	if s.mode == streamRepairContinue && !s.resumed && !s.toolUse && s.resume != nil {
+		if body, err := s.resume(s.text.String()); err == nil {
+			s.src = body
+			s.resumed = true
+			return
+		}
+	}
+	s.pending.Write(interruptedEvent(s.anthropic))
+	s.done = true
+}
+
+// interruptedEvent returns a synthetic error event in the stream's format.
+func interruptedEvent(anthropic bool) []byte {
+	if anthropic {
+		return []byte(`event: error` + "\n" +
+			`data: {"type":"error","error":{"type":"api_error","message":"` +
+			streamInterruptedMessage + `"}}` + "\n\n")
+	}
+	return []byte(`data: {"error":{"type":"stream_interrupted","message":"` +
+		streamInterruptedMessage + `"}}` + "\n\n")
+}
+
+// continuationBody appends the partial output as a trailing assistant message,
+// which the model continues from. Trailing whitespace is trimmed, as Anthropic
+// rejects assistant prefills ending in whitespace.
+func continuationBody(body []byte, partial string) ([]byte, error) {
+	partial = strings.TrimRight(partial, " \t\r\n")
+	if partial == "" {
+		return body, nil
+	}
+	return sjson.SetBytes(body, "messages.-1", map[string]string{
+		"role":    "assistant",
+		"content": partial,
+	})
+}
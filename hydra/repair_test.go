@@ -0,0 +1,137 @@
+package hydra
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// sse formats a server-sent event, omitting the event line when name is empty.
+func sse(name, data string) string {
+	if name == "" {
+		return "data: " + data + "\n\n"
+	}
+	return "event: " + name + "\ndata: " + data + "\n\n"
+}
+
+var (
+	openAIChunk = sse("", `{"choices":[{"delta":{"content":"Hello"},"finish_reason":null}]}`)
+	openAIStop  = sse("", `{"choices":[{"delta":{},"finish_reason":"stop"}]}`) + sse("", "[DONE]")
+
+	anthropicStart = sse("message_start", `{"type":"message_start"}`) +
+		sse(
+			"content_block_start",
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		)
+	anthropicStop = sse("content_block_stop", `{"type":"content_block_stop","index":0}`) +
+		sse("message_stop", `{"type":"message_stop"}`)
+)
+
+func anthropicText(text string) string {
+	return sse(
+		"content_block_delta",
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"`+text+`"}}`,
+	)
+}
+
+func readRepaired(t *testing.T, r *streamRepairer) string {
+	t.Helper()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(out)
+}
+
+func TestStreamRepairer_CompleteStream(t *testing.T) {
+	stream := openAIChunk + openAIStop
+	r := newStreamRepairer(io.NopCloser(strings.NewReader(stream)), streamRepairError, nil)
+	if got := readRepaired(t, r); got != stream {
+		t.Errorf("expected complete stream to pass through unchanged, got %q", got)
+	}
+}
+
+func TestStreamRepairer_ErrorEvent(t *testing.T) {
+	t.Run("openai", func(t *testing.T) {
+		// The trailing partial event is dropped
+		stream := openAIChunk + `data: {"choices":[{"del`
+		r := newStreamRepairer(io.NopCloser(strings.NewReader(stream)), streamRepairError, nil)
+		got := readRepaired(t, r)
+		want := openAIChunk + string(interruptedEvent(false))
+		if got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		stream := anthropicStart + anthropicText("Hi")
+		r := newStreamRepairer(io.NopCloser(strings.NewReader(stream)), streamRepairError, nil)
+		got := readRepaired(t, r)
+		if got != stream+string(interruptedEvent(true)) {
+			t.Errorf("expected anthropic error event, got %q", got)
+		}
+	})
+}
+
+func TestStreamRepairer_Continue(t *testing.T) {
+	t.Run("anthropic", func(t *testing.T) {
+		var partial string
+		resume := func(p string) (io.ReadCloser, error) {
+			partial = p
+			continuation := anthropicStart + anthropicText(" a time") + anthropicStop
+			return io.NopCloser(strings.NewReader(continuation)), nil
+		}
+		first := anthropicStart + anthropicText("Once upon ")
+		r := newStreamRepairer(io.NopCloser(strings.NewReader(first)), streamRepairContinue, resume)
+		got := readRepaired(t, r)
+
+		if partial != "Once upon " {
+			t.Errorf("expected partial text %q, got %q", "Once upon ", partial)
+		}
+		// The continuation's opening events are dropped
+		if want := first + anthropicText(" a time") + anthropicStop; got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("failed continuation falls back to error event", func(t *testing.T) {
+		resume := func(string) (io.ReadCloser, error) { return nil, errors.New("unavailable") }
+		src := io.NopCloser(strings.NewReader(openAIChunk))
+		got := readRepaired(t, newStreamRepairer(src, streamRepairContinue, resume))
+		if got != openAIChunk+string(interruptedEvent(false)) {
+			t.Errorf("unexpected stream %q", got)
+		}
+	})
+
+	t.Run("tool calls are not continued", func(t *testing.T) {
+		stream := sse("", `{"choices":[{"delta":{"tool_calls":[{"index":0}]},"finish_reason":null}]}`)
+		resumed := false
+		resume := func(string) (io.ReadCloser, error) {
+			resumed = true
+			return io.NopCloser(strings.NewReader(openAIStop)), nil
+		}
+		src := io.NopCloser(strings.NewReader(stream))
+		readRepaired(t, newStreamRepairer(src, streamRepairContinue, resume))
+		if resumed {
+			t.Error("expected a stream with tool calls not to be continued")
+		}
+	})
+}
+
+func TestContinuationBody(t *testing.T) {
+	body := []byte(`{"model":"m","messages":[{"role":"user","content":"Tell a story"}]}`)
+	got, err := continuationBody(body, "Once upon \n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"model":"m","messages":[{"role":"user","content":"Tell a story"},` +
+		`{"content":"Once upon","role":"assistant"}]}`
+	if string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	if got, _ := continuationBody(body, "  "); string(got) != string(body) {
+		t.Errorf("expected body unchanged without partial output, got %s", got)
+	}
+}
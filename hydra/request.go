@@ -1,4 +1,4 @@
-package main
+package hydra
 
 import (
 	"compress/gzip"
@@ -15,11 +15,23 @@ func setModel(body []byte, model string) ([]byte, error) {
 	return sjson.SetBytes(body, "model", model)
 }
 
+// requestedModel returns the model field of a JSON request body, if any.
+func requestedModel(body []byte) string {
+	var reqBody struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		return ""
+	}
+	return reqBody.Model
+}
+
 // isStreamingRequest checks if the request is a streaming request.
 func isStreamingRequest(req *http.Request, body []byte) bool {
 	// Check URL path for streaming endpoints
 	path := req.URL.Path
-	if strings.Contains(path, "-stream") || strings.Contains(path, "/stream") {
+	if strings.Contains(path, "-stream") || strings.Contains(path, "/stream") ||
+		strings.Contains(path, ":streamGenerateContent") {
 		return true
 	}
 
@@ -1,4 +1,4 @@
-package main
+package hydra
 
 import (
 	"bytes"
@@ -64,6 +64,24 @@ func TestSetModel(t *testing.T) {
 	}
 }
 
+func TestRequestedModel(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"model":"gpt-4o","messages":[]}`, "gpt-4o"},
+		{`{"messages":[]}`, ""},
+		{`{"model":42}`, ""},
+		{`not json`, ""},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := requestedModel([]byte(tt.body)); got != tt.expected {
+			t.Errorf("requestedModel(%q) = %q, want %q", tt.body, got, tt.expected)
+		}
+	}
+}
+
 func TestIsStreamingRequest(t *testing.T) {
 	tests := []struct {
 		name   string
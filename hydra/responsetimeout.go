@@ -0,0 +1,102 @@
+package hydra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// errResponseTimeout cancels the attempts of a request whose listener
+// response_timeout ran out.
+var errResponseTimeout = errors.New("listener response timeout reached")
+
+var responseTimeoutsCounter = metrics.Counter(
+	"hydrallm_response_timeouts_total",
+	"Requests answered with 504 because the listener's response_timeout ran out, by listener.",
+)
+
+// withResponseTimeout returns a context that is canceled once timeout passes,
+// unless stop is called first. stop reports whether it came in time, and the
+// returned cancel releases the context. Unlike a deadline, a stopped timeout
+// leaves a response body that is still streaming alone.
+func withResponseTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+) (context.Context, func() bool, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(timeout, func() { cancel(errResponseTimeout) })
+	return ctx, timer.Stop, func() { cancel(nil) }
+}
+
+// endResponseTimeout returns the outcome of a request with a response_timeout.
+// In time, the context is released once the response body is closed. Late,
+// any response is discarded for a 504 error in the listener's API format.
+func (t *RetryTransport) endResponseTimeout(
+	req *http.Request,
+	l *Listener,
+	stop func() bool,
+	cancel context.CancelFunc,
+	resp *http.Response,
+	err error,
+) (*http.Response, error) {
+	if stop() {
+		if err != nil {
+			cancel()
+			return resp, err
+		}
+		resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+	cancel()
+	if resp != nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	t.logger.Info(
+		"response timeout reached",
+		"listener",
+		l.Name,
+		"response_timeout",
+		l.ResponseTimeout,
+		"request_id",
+		requestID(req.Context()),
+	)
+	responseTimeoutsCounter.Inc("listener", l.Name)
+	return responseTimeoutResponse(req, l), nil
+}
+
+// responseTimeoutResponse is the 504 error of a request that ran out of its
+// listener's response_timeout.
+func responseTimeoutResponse(req *http.Request, l *Listener) *http.Response {
+	message := fmt.Sprintf("no response within the response timeout of %s", l.ResponseTimeout)
+	var body any
+	switch l.ConfigType {
+	case "anthropic":
+		body = map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": "timeout_error", "message": message},
+		}
+	case "gemini":
+		body = map[string]any{
+			"error": map[string]any{
+				"code":    http.StatusGatewayTimeout,
+				"message": message,
+				"status":  "DEADLINE_EXCEEDED",
+			},
+		}
+	default:
+		body = map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    "timeout_error",
+				"code":    "response_timeout",
+			},
+		}
+	}
+	data, _ := json.Marshal(body)
+	return jsonResponse(req, http.StatusGatewayTimeout, data)
+}
@@ -0,0 +1,107 @@
+package hydra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestTransport_RoundTrip_ResponseTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") == "" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("data: start\n\n"))
+			w.(http.Flusher).Flush()
+			// The body outlasts the response timeout
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write([]byte("data: done\n\n"))
+			return
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	l := &Listener{
+		Name:            "response-timeout",
+		ConfigType:      "openai",
+		ResponseTimeout: 50 * time.Millisecond,
+		ResolvedModels: []Model{{
+			ID:       "slow",
+			Provider: "slow",
+			Model:    "gpt-5",
+			Type:     "openai",
+			Attempts: 3,
+			Timeout:  5 * time.Second,
+		}},
+	}
+	providers := map[string]Provider{
+		"slow": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 3, DefaultTimeout: 5 * time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(
+		httptest.NewRequest(http.MethodPost, "/v1/chat/completions?slow=1", nil),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusGatewayTimeout ||
+		gjson.GetBytes(body, "error.code").String() != "response_timeout" {
+		t.Errorf("expected a 504 response_timeout error, got %d: %s", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected an answer near the response timeout, took %s", elapsed)
+	}
+	if got := metrics.value("hydrallm_response_timeouts_total", "listener", l.Name); got < 1 {
+		t.Errorf("expected 1 counted timeout, got %v", got)
+	}
+
+	// A response that started in time streams past the timeout
+	resp, err = transport.RoundTrip(
+		httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"stream":true}`)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK ||
+		string(body) != "data: start\n\ndata: done\n\n" {
+		t.Errorf("expected the whole stream, got %d %q (%v)", resp.StatusCode, body, err)
+	}
+}
+
+func TestResponseTimeoutResponse(t *testing.T) {
+	tests := []struct {
+		configType string
+		path       string
+		expected   string
+	}{
+		{"openai", "error.code", "response_timeout"},
+		{"anthropic", "error.type", "timeout_error"},
+		{"gemini", "error.status", "DEADLINE_EXCEEDED"},
+	}
+	for _, tt := range tests {
+		l := &Listener{ConfigType: tt.configType, ResponseTimeout: time.Second}
+		resp := responseTimeoutResponse(httptest.NewRequest(http.MethodPost, "/", nil), l)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusGatewayTimeout ||
+			gjson.GetBytes(body, tt.path).String() != tt.expected {
+			t.Errorf("%s: unexpected response %d: %s", tt.configType, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package hydra
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+)
+
+// Routing strategies decide the order in which a request tries a listener's
+// models. Every strategy still falls back through the whole chain.
+const (
+	strategyPriority     = "priority"      // Configured order
+	strategyRoundRobin   = "round_robin"   // Rotate the first model per request
+	strategyWeighted     = "weighted"      // Random order biased by model weight
+	strategyLeastLatency = "least_latency" // Fastest recent latency first
+	strategyBandit       = "bandit"        // Best scored model, with exploration
+	strategyAdaptive     = "adaptive"      // Best recent latency and error rate first
+)
+
+// Route sends requests for a client-facing model name to its own model chain.
+// Requests for names without a route use the listener's models.
+type Route struct {
+	Model  string   `mapstructure:"model"`  // Model name requested by clients
+	Models []string `mapstructure:"models"` // Model IDs
+}
+
+// PromptRoute sends prompts with matching characteristics to their own chain
+// before the listener's models. Unset conditions match every prompt.
+type PromptRoute struct {
+	Name     string   `mapstructure:"name"`      // Shown in logs
+	Class    string   `mapstructure:"class"`     // code or prose
+	MinChars int      `mapstructure:"min_chars"` // Shortest matching prompt
+	MaxChars int      `mapstructure:"max_chars"` // Longest matching prompt, 0 for no limit
+	Models   []string `mapstructure:"models"`    // Model IDs tried first
+
+	Languages        []string `mapstructure:"languages"`         // Matching language codes
+	ExcludeLanguages []string `mapstructure:"exclude_languages"` // Language codes never matched
+}
+
+// matches reports whether a prompt meets all of the route's conditions.
+// Routes with language conditions never match prompts of unknown language.
+func (r PromptRoute) matches(p promptProfile) bool {
+	if len(r.Languages) > 0 || len(r.ExcludeLanguages) > 0 {
+		if p.Language == "" ||
+			(len(r.Languages) > 0 && !slices.Contains(r.Languages, p.Language)) ||
+			slices.Contains(r.ExcludeLanguages, p.Language) {
+			return false
+		}
+	}
+	return (r.Class == "" || r.Class == p.Class) &&
+		p.Chars >= r.MinChars &&
+		(r.MaxChars == 0 || p.Chars <= r.MaxChars)
+}
+
+// resolvedPromptRoute is a prompt route with its full chain: the route's
+// models followed by the listener's other models as fallbacks.
+type resolvedPromptRoute struct {
+	PromptRoute
+	chain []Model
+}
+
+// chainFor returns the model chain serving a request. A route for the model
+// the client asked for wins, then the first prompt route matching the prompt.
+// Other requests go to the listener's models, or to the chain of an
+// experiment variant, which is returned too: variant if set, as for
+// continuations, or a new draw.
+func (s *transportState) chainFor(body []byte, variant string) ([]Model, string) {
+	if len(s.routes) > 0 {
+		if chain, ok := s.routes[requestedModel(body)]; ok {
+			return chain, ""
+		}
+	}
+	if len(s.promptRoutes) > 0 {
+		profile := profilePrompt(body)
+		for _, r := range s.promptRoutes {
+			if r.matches(profile) {
+				return r.chain, ""
+			}
+		}
+	}
+	if len(s.experiment) > 0 {
+		return s.experimentChain(variant)
+	}
+	return s.models, ""
+}
+
+func isSupportedStrategy(strategy string) bool {
+	switch strategy {
+	case strategyPriority, strategyRoundRobin, strategyWeighted, strategyLeastLatency,
+		strategyBandit, strategyAdaptive:
+		return true
+	default:
+		return false
+	}
+}
+
+// orderModels returns the models in the order a request should try them.
+// seq is a per-transport request counter used by round robin.
+func orderModels(strategy string, models []Model, seq uint64) []Model {
+	if len(models) < 2 {
+		return models
+	}
+
+	switch strategy {
+	case strategyRoundRobin:
+		start := int(seq % uint64(len(models)))
+		return append(slices.Clone(models[start:]), models[:start]...)
+	case strategyWeighted:
+		return weightedOrder(models)
+	case strategyLeastLatency:
+		ordered := slices.Clone(models)
+		latency := make(map[string]float64, len(models))
+		for _, m := range models {
+			latency[m.ID] = modelHealth.get(m.ID).LatencyMS
+		}
+		// Models without measurements sort first so they get measured
+		slices.SortStableFunc(ordered, func(a, b Model) int {
+			return cmp.Compare(latency[a.ID], latency[b.ID])
+		})
+		return ordered
+	case strategyAdaptive:
+		return adaptiveOrder(models)
+	default:
+		return models
+	}
+}
+
+// weightedOrder draws models without replacement, each with a probability
+// proportional to its weight.
+func weightedOrder(models []Model) []Model {
+	remaining := slices.Clone(models)
+	ordered := make([]Model, 0, len(models))
+	for len(remaining) > 0 {
+		total := 0
+		for _, m := range remaining {
+			total += m.Weight
+		}
+		pick := rand.IntN(total)
+		for i, m := range remaining {
+			if pick < m.Weight {
+				ordered = append(ordered, m)
+				remaining = slices.Delete(remaining, i, i+1)
+				break
+			}
+			pick -= m.Weight
+		}
+	}
+	return ordered
+}
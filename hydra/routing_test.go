@@ -0,0 +1,158 @@
+package hydra
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func modelIDs(models []Model) []string {
+	ids := make([]string, len(models))
+	for i, m := range models {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestOrderModelsPriority(t *testing.T) {
+	models := []Model{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	for _, strategy := range []string{"", strategyPriority} {
+		got := modelIDs(orderModels(strategy, models, 5))
+		if !slices.Equal(got, []string{"a", "b", "c"}) {
+			t.Errorf("strategy %q: expected configured order, got %v", strategy, got)
+		}
+	}
+}
+
+func TestOrderModelsRoundRobin(t *testing.T) {
+	models := []Model{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	want := [][]string{
+		{"a", "b", "c"},
+		{"b", "c", "a"},
+		{"c", "a", "b"},
+		{"a", "b", "c"},
+	}
+	for seq, w := range want {
+		got := modelIDs(orderModels(strategyRoundRobin, models, uint64(seq)))
+		if !slices.Equal(got, w) {
+			t.Errorf("seq %d: expected %v, got %v", seq, w, got)
+		}
+	}
+	if models[0].ID != "a" {
+		t.Error("round robin must not modify the configured models")
+	}
+}
+
+func TestOrderModelsWeighted(t *testing.T) {
+	models := []Model{{ID: "heavy", Weight: 9}, {ID: "light", Weight: 1}}
+	first := map[string]int{}
+	for range 2000 {
+		ordered := orderModels(strategyWeighted, models, 0)
+		if len(ordered) != 2 || ordered[0].ID == ordered[1].ID {
+			t.Fatalf("expected each model exactly once, got %v", modelIDs(ordered))
+		}
+		first[ordered[0].ID]++
+	}
+	// Expect about 1800 of 2000; allow generous slack for randomness
+	if first["heavy"] < 1600 || first["heavy"] > 1950 {
+		t.Errorf("expected heavy model first about 90%% of the time, got %v", first)
+	}
+}
+
+func TestOrderModelsLeastLatency(t *testing.T) {
+	modelHealth = newHealthTracker()
+	t.Cleanup(func() { modelHealth = newHealthTracker() })
+
+	modelHealth.recordSuccess("slow", 200, 300*time.Millisecond)
+	modelHealth.recordSuccess("fast", 200, 50*time.Millisecond)
+	models := []Model{{ID: "slow"}, {ID: "fast"}, {ID: "new"}}
+
+	got := modelIDs(orderModels(strategyLeastLatency, models, 0))
+	if !slices.Equal(got, []string{"new", "fast", "slow"}) {
+		t.Errorf("expected [new fast slow], got %v", got)
+	}
+}
+
+func TestChainFor(t *testing.T) {
+	state := &transportState{
+		models: []Model{{ID: "default"}},
+		routes: map[string][]Model{
+			"gpt-4o":      {{ID: "a1"}, {ID: "a2"}},
+			"gpt-4o-mini": {{ID: "b1"}},
+		},
+	}
+
+	tests := []struct {
+		body     string
+		expected []string
+	}{
+		{`{"model":"gpt-4o"}`, []string{"a1", "a2"}},
+		{`{"model":"gpt-4o-mini"}`, []string{"b1"}},
+		{`{"model":"unknown"}`, []string{"default"}},
+		{`{"messages":[]}`, []string{"default"}},
+	}
+	for _, tt := range tests {
+		chain, _ := state.chainFor([]byte(tt.body), "")
+		if got := modelIDs(chain); !slices.Equal(got, tt.expected) {
+			t.Errorf("chainFor(%s) = %v, want %v", tt.body, got, tt.expected)
+		}
+	}
+}
+
+func TestChainFor_PromptRoutes(t *testing.T) {
+	state := &transportState{
+		models: []Model{{ID: "default"}},
+		routes: map[string][]Model{"gpt-4o": {{ID: "a1"}}},
+		promptRoutes: []resolvedPromptRoute{
+			{PromptRoute: PromptRoute{Class: promptClassCode}, chain: []Model{{ID: "coder"}}},
+			{PromptRoute: PromptRoute{MinChars: 20}, chain: []Model{{ID: "long"}}},
+		},
+	}
+
+	code := "```go\\nfunc main() {}\\n```"
+	tests := []struct {
+		body     string
+		expected []string
+	}{
+		{`{"messages":[{"role":"user","content":"` + code + `"}]}`, []string{"coder"}},
+		{`{"messages":[{"role":"user","content":"Tell me a long story, please"}]}`, []string{"long"}},
+		{`{"messages":[{"role":"user","content":"Hi"}]}`, []string{"default"}},
+		// A route for the requested model takes precedence
+		{`{"model":"gpt-4o","messages":[{"role":"user","content":"` + code + `"}]}`, []string{"a1"}},
+	}
+	for _, tt := range tests {
+		chain, _ := state.chainFor([]byte(tt.body), "")
+		if got := modelIDs(chain); !slices.Equal(got, tt.expected) {
+			t.Errorf("chainFor(%s) = %v, want %v", tt.body, got, tt.expected)
+		}
+	}
+}
+
+func TestPromptRouteMatches(t *testing.T) {
+	profile := promptProfile{Class: promptClassProse, Chars: 100, Language: "ja"}
+	tests := []struct {
+		route    PromptRoute
+		expected bool
+	}{
+		{PromptRoute{}, true},
+		{PromptRoute{Class: promptClassProse, MinChars: 50, MaxChars: 100}, true},
+		{PromptRoute{Class: promptClassCode}, false},
+		{PromptRoute{MinChars: 101}, false},
+		{PromptRoute{MaxChars: 99}, false},
+		{PromptRoute{Languages: []string{"zh", "ja"}}, true},
+		{PromptRoute{Languages: []string{"ko"}}, false},
+		{PromptRoute{ExcludeLanguages: []string{"en"}}, true},
+		{PromptRoute{ExcludeLanguages: []string{"ja"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.route.matches(profile); got != tt.expected {
+			t.Errorf("%+v.matches() = %v, want %v", tt.route, got, tt.expected)
+		}
+	}
+
+	// Language conditions never match prompts of unknown language
+	unknown := promptProfile{Class: promptClassProse}
+	if (PromptRoute{ExcludeLanguages: []string{"en"}}).matches(unknown) {
+		t.Error("expected no match for a prompt of unknown language")
+	}
+}
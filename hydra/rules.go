@@ -0,0 +1,218 @@
+package hydra
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/tidwall/sjson"
+)
+
+var rulesCounter = metrics.Counter(
+	"hydrallm_routing_rules_total",
+	"Requests matched by a [[routes]] rule, by listener and rule.",
+)
+
+// RoutingRule is a [[routes]] entry. A request matches when it meets every
+// condition the rule sets; the first matching rule of a listener applies its
+// actions: rejecting the request, or selecting a chain, overriding body
+// values, and setting upstream headers.
+type RoutingRule struct {
+	Name      string   `mapstructure:"name"`      // Shown in logs and metrics
+	Listeners []string `mapstructure:"listeners"` // Listener names, all when empty
+
+	Path    string            `mapstructure:"path"`     // Regular expression on the URL path
+	Model   string            `mapstructure:"model"`    // Regular expression on the requested model
+	Headers map[string]string `mapstructure:"headers"`  // Header name to regular expression
+	KeyTags []string          `mapstructure:"key_tags"` // Tags of the client's API key, any of
+	Body    []string          `mapstructure:"body"`     // JSON matchers, as in content_errors
+	Regions []string          `mapstructure:"regions"`  // [geo] regions of the client, any of
+
+	Reject     RejectAction      `mapstructure:"reject"`      // Answer without an upstream
+	Models     []string          `mapstructure:"models"`      // Chain replacing the listener's
+	Set        []BodyOverride    `mapstructure:"set"`         // Values set in the request body
+	SetHeaders map[string]string `mapstructure:"set_headers"` // Headers sent upstream
+}
+
+// RejectAction answers matching requests with an error. Unset status
+// disables it.
+type RejectAction struct {
+	Status  int    `mapstructure:"status"`
+	Message string `mapstructure:"message"`
+}
+
+// BodyOverride sets the JSON value at a path of the request body.
+type BodyOverride struct {
+	Path  string `mapstructure:"path"`  // sjson path, such as "temperature"
+	Value any    `mapstructure:"value"` // Any TOML value
+}
+
+// resolvedRule is a routing rule with its conditions compiled and its chain
+// resolved against a listener.
+type resolvedRule struct {
+	RoutingRule
+	path    *regexp.Regexp
+	model   *regexp.Regexp
+	headers map[string]*regexp.Regexp
+	body    []contentErrorMatcher
+	chain   []Model
+	geo     *GeoConfig
+}
+
+// resolveRules returns the rules applying to a listener, in order.
+func (c *Config) resolveRules(l *Listener) ([]resolvedRule, error) {
+	var rules []resolvedRule
+	for i, r := range c.Routes {
+		if len(r.Listeners) > 0 && !slices.Contains(r.Listeners, l.Name) {
+			continue
+		}
+		r.Name = cmp.Or(r.Name, fmt.Sprintf("routes[%d]", i))
+		rule, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", r.Name, err)
+		}
+		rule.geo = &c.Geo
+		if len(r.Models) > 0 {
+			if rule.chain, err = c.resolveChain(r.Models, l.ConfigType); err != nil {
+				return nil, fmt.Errorf("listener %q: route %q: %w", l.Name, r.Name, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// compileRule compiles the conditions of a rule and checks its actions.
+func compileRule(r RoutingRule) (resolvedRule, error) {
+	rule := resolvedRule{RoutingRule: r}
+	var err error
+	if r.Path != "" {
+		if rule.path, err = regexp.Compile(r.Path); err != nil {
+			return rule, fmt.Errorf("invalid path: %w", err)
+		}
+	}
+	if r.Model != "" {
+		if rule.model, err = regexp.Compile(r.Model); err != nil {
+			return rule, fmt.Errorf("invalid model: %w", err)
+		}
+	}
+	if len(r.Headers) > 0 {
+		rule.headers = make(map[string]*regexp.Regexp, len(r.Headers))
+		for name, pattern := range r.Headers {
+			if rule.headers[name], err = regexp.Compile(pattern); err != nil {
+				return rule, fmt.Errorf("invalid header %q: %w", name, err)
+			}
+		}
+	}
+	if rule.body, err = parseContentErrors(r.Body); err != nil {
+		return rule, err
+	}
+
+	if r.Reject.Status != 0 {
+		if r.Reject.Status < 400 || r.Reject.Status > 599 {
+			return rule, fmt.Errorf("reject status must be 4xx or 5xx, got %d", r.Reject.Status)
+		}
+		if len(r.Models) > 0 || len(r.Set) > 0 || len(r.SetHeaders) > 0 {
+			return rule, fmt.Errorf("reject cannot be combined with other actions")
+		}
+	} else if len(r.Models) == 0 && len(r.Set) == 0 && len(r.SetHeaders) == 0 {
+		return rule, fmt.Errorf("must set an action: reject, models, set, or set_headers")
+	}
+	for _, o := range r.Set {
+		if o.Path == "" {
+			return rule, fmt.Errorf("set path is required")
+		}
+	}
+	return rule, nil
+}
+
+// matches reports whether a request meets all of the rule's conditions.
+// keyTags are the tags of the API key that authenticated it, and client its
+// location, nil when unknown.
+func (r *resolvedRule) matches(
+	req *http.Request,
+	body []byte,
+	keyTags []string,
+	client *clientGeo,
+) bool {
+	if r.path != nil && !r.path.MatchString(req.URL.Path) {
+		return false
+	}
+	if r.model != nil && !r.model.MatchString(requestedModel(body)) {
+		return false
+	}
+	for name, pattern := range r.headers {
+		if !pattern.MatchString(req.Header.Get(name)) {
+			return false
+		}
+	}
+	if len(r.KeyTags) > 0 &&
+		!slices.ContainsFunc(r.KeyTags, func(tag string) bool { return slices.Contains(keyTags, tag) }) {
+		return false
+	}
+	if len(r.Regions) > 0 && (client == nil || !client.in(r.Regions)) {
+		return false
+	}
+	if len(r.body) > 0 {
+		var doc any
+		if json.Unmarshal(body, &doc) != nil {
+			return false
+		}
+		for _, m := range r.body {
+			if _, ok := m.match(doc); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// apply sets the rule's body overrides and upstream headers on a request.
+func (r *resolvedRule) apply(req *http.Request, body []byte) ([]byte, error) {
+	for _, o := range r.Set {
+		var err error
+		if body, err = sjson.SetBytes(body, o.Path, o.Value); err != nil {
+			return nil, fmt.Errorf("route %q: failed to set %s: %w", r.Name, o.Path, err)
+		}
+	}
+	for name, value := range r.SetHeaders {
+		req.Header.Set(name, resolveEnvOrValue(value))
+	}
+	return body, nil
+}
+
+// matchRule returns the first rule of the listener matching a request, or nil.
+func (l *Listener) matchRule(req *http.Request, body []byte) *resolvedRule {
+	if len(l.ResolvedRules) == 0 {
+		return nil
+	}
+	var keyTags []string
+	if name := apiKeyName(req.Context()); name != "" {
+		for _, k := range l.ResolvedAPIKeys {
+			if k.Name == name {
+				keyTags = k.Tags
+				break
+			}
+		}
+	}
+	// Rules of a listener share the [geo] config
+	client := &clientGeo{geo: l.ResolvedRules[0].geo, req: req}
+	for i := range l.ResolvedRules {
+		if r := &l.ResolvedRules[i]; r.matches(req, body, keyTags, client) {
+			return r
+		}
+	}
+	return nil
+}
+
+// rejectResponse answers a request rejected by a rule with a JSON error.
+func rejectResponse(req *http.Request, rule *resolvedRule) *http.Response {
+	message := cmp.Or(rule.Reject.Message, http.StatusText(rule.Reject.Status))
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]string{"type": "rejected", "message": message},
+	})
+	return jsonResponse(req, rule.Reject.Status, body)
+}
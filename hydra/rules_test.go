@@ -0,0 +1,200 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestRoutingRuleMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RoutingRule
+		path    string
+		header  string
+		body    string
+		keyTags []string
+		want    bool
+	}{
+		{"no conditions", RoutingRule{}, "/v1/chat/completions", "", `{}`, nil, true},
+		{"path", RoutingRule{Path: "^/v1/embeddings$"}, "/v1/chat/completions", "", `{}`, nil, false},
+		{"model", RoutingRule{Model: "^gpt-4o"}, "/", "", `{"model":"gpt-4o-mini"}`, nil, true},
+		{"model mismatch", RoutingRule{Model: "^claude"}, "/", "", `{"model":"gpt-4o"}`, nil, false},
+		{
+			"header",
+			RoutingRule{Headers: map[string]string{"x-team": "^search$"}},
+			"/",
+			"search",
+			`{}`,
+			nil,
+			true,
+		},
+		{
+			"missing header",
+			RoutingRule{Headers: map[string]string{"x-team": "^search$"}},
+			"/",
+			"",
+			`{}`,
+			nil,
+			false,
+		},
+		{
+			"key tag",
+			RoutingRule{KeyTags: []string{"ci", "batch"}},
+			"/",
+			"",
+			`{}`,
+			[]string{"batch"},
+			true,
+		},
+		{"no key tag", RoutingRule{KeyTags: []string{"batch"}}, "/", "", `{}`, nil, false},
+		{
+			"body",
+			RoutingRule{Body: []string{"stream", "metadata.tier=free"}},
+			"/",
+			"",
+			`{"stream":true,"metadata":{"tier":"free"}}`,
+			nil,
+			true,
+		},
+		{
+			"body mismatch",
+			RoutingRule{Body: []string{"stream", "metadata.tier=free"}},
+			"/",
+			"",
+			`{"stream":false,"metadata":{"tier":"free"}}`,
+			nil,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Set = []BodyOverride{{Path: "x", Value: 1}}
+			rule, err := compileRule(tt.rule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			req, _ := http.NewRequest(http.MethodPost, "http://original"+tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Team", tt.header)
+			}
+			if got := rule.matches(req, []byte(tt.body), tt.keyTags, nil); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRule_Invalid(t *testing.T) {
+	tests := map[string]RoutingRule{
+		"no action":      {Path: "/"},
+		"bad path":       {Path: "(", Models: []string{"m1"}},
+		"bad header":     {Headers: map[string]string{"x": "["}, Models: []string{"m1"}},
+		"bad body":       {Body: []string{"a..b"}, Models: []string{"m1"}},
+		"reject status":  {Reject: RejectAction{Status: 200}},
+		"reject and set": {Reject: RejectAction{Status: 403}, Set: []BodyOverride{{Path: "a"}}},
+		"empty set path": {Set: []BodyOverride{{Value: 1}}},
+	}
+	for name, rule := range tests {
+		if _, err := compileRule(rule); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_RoutingRules(t *testing.T) {
+	var got struct {
+		Model       string  `json:"model"`
+		Temperature float64 `json:"temperature"`
+	}
+	var gotHeader string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		gotHeader = r.Header.Get("X-Tenant")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	model := func(id string) Model {
+		return Model{
+			ID:       id,
+			Provider: "mock",
+			Model:    "upstream-" + id,
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}
+	}
+	batch, err := compileRule(RoutingRule{
+		Name:       "batch",
+		KeyTags:    []string{"batch"},
+		Set:        []BodyOverride{{Path: "temperature", Value: 0.2}},
+		SetHeaders: map[string]string{"X-Tenant": "offline"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch.chain = []Model{model("cheap")}
+	blocked, err := compileRule(RoutingRule{
+		Name:   "no-embeddings",
+		Path:   "/embeddings$",
+		Reject: RejectAction{Status: http.StatusForbidden, Message: "embeddings are disabled"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Listener{
+		Name:            "rules-main",
+		ResolvedModels:  []Model{model("default")},
+		ResolvedRules:   []resolvedRule{blocked, batch},
+		ResolvedAPIKeys: []APIKey{{Name: "etl", Key: "k", Tags: []string{"batch"}}},
+	}
+	providers := map[string]Provider{"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)}}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	send := func(path, key string) *http.Response {
+		ctx := context.Background()
+		if key != "" {
+			ctx = context.WithValue(ctx, apiKeyNameContextKey{}, key)
+		}
+		req, _ := http.NewRequestWithContext(
+			ctx,
+			http.MethodPost,
+			"http://original"+path,
+			bytes.NewReader([]byte(`{"model":"gpt-4o","temperature":1}`)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	resp := send("/v1/embeddings", "etl")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden ||
+		!strings.Contains(string(body), "embeddings are disabled") {
+		t.Errorf("expected rejection, got %d %s", resp.StatusCode, body)
+	}
+
+	_ = send("/v1/chat/completions", "etl").Body.Close()
+	if got.Model != "upstream-cheap" || got.Temperature != 0.2 || gotHeader != "offline" {
+		t.Errorf("expected batch rule applied, got %+v with header %q", got, gotHeader)
+	}
+
+	_ = send("/v1/chat/completions", "").Body.Close()
+	if got.Model != "upstream-default" || got.Temperature != 1 || gotHeader != "" {
+		t.Errorf("expected no rule applied, got %+v with header %q", got, gotHeader)
+	}
+}
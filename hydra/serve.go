@@ -0,0 +1,238 @@
+package hydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Serve runs the listeners and admin API of cfg until ctx is done or a server
+// fails to start, then shuts them down gracefully. Every value received on
+// reload, which may be nil, re-reads the config and applies it to the running
+// listeners.
+func Serve(ctx context.Context, cfg *Config, reload <-chan os.Signal) error {
+	logger.Info("starting hydrallm", "listeners", len(cfg.Listeners))
+
+	if cfg.StateDir != "" {
+		if err := os.MkdirAll(cfg.StateDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+	}
+	access, err := openAccessLog(cfg.Log.AccessLog)
+	if err != nil {
+		return err
+	}
+	if err := modelUsage.openUsageLog(cfg.Log.UsageLog); err != nil {
+		return err
+	}
+	setGuardrails(cfg.Server)
+	stateDone := make(chan struct{})
+	quotasSaved := make(chan struct{})
+	if hasKeyQuotas(cfg) {
+		if err := keyQuotas.open(cfg.Server.QuotaState); err != nil {
+			return err
+		}
+		go func() {
+			defer close(quotasSaved)
+			keyQuotas.persist(stateDone, keyQuotaSaveInterval, logger)
+		}()
+	} else {
+		close(quotasSaved)
+	}
+	statsSaved := make(chan struct{})
+	if hasAdaptiveRouting(cfg) {
+		if err := modelHealth.open(cfg.Server.ModelStats); err != nil {
+			return err
+		}
+		go func() {
+			defer close(statsSaved)
+			modelHealth.persist(stateDone, modelStatsSaveInterval, logger)
+		}()
+	} else {
+		close(statsSaved)
+	}
+
+	// The admin API reads the config in effect, which changes on reload
+	var current atomic.Pointer[Config]
+	current.Store(cfg)
+
+	// Create servers for each listener
+	servers := make([]*http.Server, 0, len(cfg.Listeners))
+	listenerServers := make(map[string][]*http.Server, len(cfg.Listeners))
+	transports := make(map[string]*RetryTransport, len(cfg.Listeners))
+	for i := range cfg.Listeners {
+		l := &cfg.Listeners[i]
+
+		logger.Info(
+			"configured listener",
+			"name",
+			l.Name,
+			"host",
+			l.Host,
+			"port",
+			l.Port,
+			"binds",
+			len(l.Binds),
+			"models",
+			len(l.Models),
+		)
+		for _, m := range l.ResolvedModels {
+			logger.Info(
+				"configured model",
+				"listener",
+				l.Name,
+				"provider",
+				m.Provider,
+				"model",
+				m.Model,
+				"type",
+				m.Type,
+				"attempts",
+				m.Attempts,
+			)
+		}
+		for _, r := range l.Routes {
+			logger.Info("configured route", "listener", l.Name, "model", r.Model, "models", r.Models)
+		}
+		for _, r := range l.ResolvedPromptRoutes {
+			logger.Info(
+				"configured prompt route",
+				"listener",
+				l.Name,
+				"route",
+				r.Name,
+				"class",
+				r.Class,
+				"languages",
+				r.Languages,
+				"models",
+				r.Models,
+			)
+		}
+		if len(l.Experiment.Models) > 0 {
+			logger.Info(
+				"configured experiment",
+				"listener",
+				l.Name,
+				"candidate",
+				l.Experiment.Models,
+				"percent",
+				l.Experiment.Percent,
+			)
+		}
+
+		// All bind addresses of a listener share one proxy and transport
+		proxy := NewProxy(l, cfg, logger)
+		if transport, ok := proxy.Transport.(*RetryTransport); ok {
+			transports[l.Name] = transport
+		}
+		handler := activeRequests.wrap(
+			l.Name,
+			access.wrap(l.Name, limitBody(l, wrapMiddleware(proxy, l, cfg, logger))),
+		)
+
+		for _, addr := range l.Addresses() {
+			server := &http.Server{
+				Addr:              addr,
+				Handler:           handler,
+				ReadHeaderTimeout: 30 * time.Second,
+				ReadTimeout:       l.ReadTimeout,
+				WriteTimeout:      l.WriteTimeout,
+			}
+			servers = append(servers, server)
+			listenerServers[l.Name] = append(listenerServers[l.Name], server)
+		}
+	}
+	listenerDrains.track(listenerServers)
+
+	if cfg.Admin.Port != 0 {
+		servers = append(servers, &http.Server{
+			Addr:              cfg.Admin.Address(),
+			Handler:           newAdminHandler(current.Load),
+			ReadHeaderTimeout: 30 * time.Second,
+		})
+	}
+
+	// Start all servers
+	var wg sync.WaitGroup
+	failed := make(chan error, len(servers))
+	for _, server := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				failed <- fmt.Errorf("failed to start server %s: %w", s.Addr, err)
+			}
+		}(server)
+		logger.Info("hydrallm listening", "address", server.Addr)
+	}
+	serverReady.Store(true)
+
+	reportCtx, stopReports := context.WithCancel(ctx)
+	defer stopReports()
+	go fallbackDepths.report(reportCtx, fallbackSummaryInterval, logger)
+	go listenerSLOs.report(reportCtx, sloSummaryInterval, logger)
+	go runHealthChecks(reportCtx, current.Load, logger)
+	go runCatalogChecks(reportCtx, current.Load, logger)
+
+	var serveErr error
+wait:
+	for {
+		select {
+		case serveErr = <-failed:
+			break wait
+		case <-reload:
+			logger.Info("reloading config")
+			if cfg, err = reloadConfig(cfg, transports); err != nil {
+				logger.Error("config reload failed, keeping current config", "error", err)
+			}
+			current.Store(cfg)
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	serverReady.Store(false)
+	logger.Info("shutting down servers...")
+
+	// Graceful shutdown with timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Report and cut off draining requests while servers shut down
+	drainCtx, stopDrain := context.WithCancel(shutdownCtx)
+	go activeRequests.drain(
+		drainCtx,
+		drainCheckInterval,
+		drainLogInterval,
+		cfg.Server.DrainRequestTimeout,
+		logger,
+	)
+
+	var shutdownWg sync.WaitGroup
+	for _, server := range servers {
+		shutdownWg.Add(1)
+		go func(s *http.Server) {
+			defer shutdownWg.Done()
+			// Servers of drained listeners already closed their sockets
+			err := s.Shutdown(shutdownCtx)
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				logger.Error("server shutdown error", "address", s.Addr, "error", err)
+			}
+		}(server)
+	}
+	shutdownWg.Wait()
+	stopDrain()
+
+	wg.Wait()
+	close(stateDone)
+	<-quotasSaved
+	<-statsSaved
+	logger.Info("all servers stopped")
+	return serveErr
+}
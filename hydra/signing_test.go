@@ -0,0 +1,116 @@
+package hydra
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestSignHMACRequest(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	payload := "1767225600\nPOST\n/v1/chat/completions?beta=1\n{\"model\":\"m\"}"
+	mac := func(h func() hash.Hash) []byte {
+		m := hmac.New(h, []byte("secret"))
+		m.Write([]byte(payload))
+		return m.Sum(nil)
+	}
+
+	tests := []struct {
+		name      string
+		cfg       SigningConfig
+		header    string
+		timestamp string
+		expected  string
+	}{
+		{
+			name:      "defaults",
+			cfg:       SigningConfig{Key: "secret"},
+			header:    "X-Signature",
+			timestamp: "X-Signature-Timestamp",
+			expected:  hex.EncodeToString(mac(sha256.New)),
+		},
+		{
+			name: "sha512 base64 custom headers",
+			cfg: SigningConfig{
+				Key:             "secret",
+				Algorithm:       "sha512",
+				Encoding:        "base64",
+				Header:          "X-Gateway-Signature",
+				TimestampHeader: "X-Gateway-Time",
+			},
+			header:    "X-Gateway-Signature",
+			timestamp: "X-Gateway-Time",
+			expected:  base64.StdEncoding.EncodeToString(mac(sha512.New)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(
+				"POST",
+				"http://gateway/v1/chat/completions?beta=1",
+				strings.NewReader(`{"model":"m"}`),
+			)
+			if err := signHMACRequest(req, tt.cfg, now); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := req.Header.Get(tt.header); got != tt.expected {
+				t.Errorf("expected signature %q, got %q", tt.expected, got)
+			}
+			if got := req.Header.Get(tt.timestamp); got != "1767225600" {
+				t.Errorf("expected timestamp header, got %q", got)
+			}
+			if body, _ := io.ReadAll(req.Body); string(body) != `{"model":"m"}` {
+				t.Errorf("expected body to be restored, got %q", body)
+			}
+		})
+	}
+}
+
+func TestSetAuthHeaders_Signing(t *testing.T) {
+	t.Setenv("TEST_SIGNING_KEY", "from-env")
+	transport := NewRetryTransport(nil, nil, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+	provider := Provider{Signing: SigningConfig{Key: "$TEST_SIGNING_KEY"}}
+
+	req, _ := http.NewRequest("GET", "http://gateway/v1/models", nil)
+	if err := transport.setAuthHeaders(req, "openai", provider); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("expected no bearer token, got %q", req.Header.Get("Authorization"))
+	}
+
+	ts := req.Header.Get("X-Signature-Timestamp")
+	m := hmac.New(sha256.New, []byte("from-env"))
+	m.Write([]byte(ts + "\nGET\n/v1/models\n"))
+	if got := req.Header.Get("X-Signature"); got != hex.EncodeToString(m.Sum(nil)) {
+		t.Errorf("unexpected signature %q", got)
+	}
+}
+
+func TestSigningConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg     SigningConfig
+		wantErr bool
+	}{
+		{SigningConfig{}, false},
+		{SigningConfig{Key: "k", Algorithm: "sha512", Encoding: "base64"}, false},
+		{SigningConfig{Key: "k", Algorithm: "md5"}, true},
+		{SigningConfig{Key: "k", Encoding: "base32"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) error = %v, want error %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package hydra
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// slimmedImage replaces the images removed by strip_images.
+const slimmedImage = "[image omitted]"
+
+var (
+	slimTrailingSpace = regexp.MustCompile(`[ \t]+\n`)
+	slimInnerSpace    = regexp.MustCompile(`(\S)[ \t]{2,}`)
+	slimBlankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+var slimmedRequestsCounter = metrics.Counter(
+	"hydrallm_slimmed_requests_total",
+	"Requests resent with a slimmed body after an upstream rejected them as too large.",
+)
+
+// SlimBodyConfig configures how a request body rejected by an upstream as too
+// large (413 or 431) is made smaller before it is sent once more. It is
+// disabled unless a strategy is set.
+type SlimBodyConfig struct {
+	KeepMessages      int  `mapstructure:"keep_messages"`      // Newest messages kept, 0 keeps all
+	StripImages       bool `mapstructure:"strip_images"`       // Replace images with a note
+	CompactWhitespace bool `mapstructure:"compact_whitespace"` // Collapse runs of spaces and blank lines
+}
+
+// enabled reports whether any strategy is set.
+func (c SlimBodyConfig) enabled() bool {
+	return c.KeepMessages > 0 || c.StripImages || c.CompactWhitespace
+}
+
+// isTooLargeStatus reports whether an upstream rejected a request for its size.
+func isTooLargeStatus(status int) bool {
+	return status == http.StatusRequestEntityTooLarge ||
+		status == http.StatusRequestHeaderFieldsTooLarge
+}
+
+// slim applies the strategies to an OpenAI, Anthropic, or Gemini request
+// body. It reports false when the body is left as it was.
+func (c SlimBodyConfig) slim(body []byte) ([]byte, bool) {
+	field := "messages"
+	if !gjson.GetBytes(body, field).IsArray() {
+		field = "contents"
+	}
+	messages := gjson.GetBytes(body, field)
+	if !messages.IsArray() {
+		return body, false
+	}
+
+	var kept []json.RawMessage
+	for _, m := range keptMessages(messages.Array(), c.KeepMessages) {
+		raw := []byte(m.Raw)
+		if c.StripImages {
+			raw = stripImages(raw)
+		}
+		if c.CompactWhitespace {
+			raw = compactText(raw)
+		}
+		kept = append(kept, raw)
+	}
+	out, err := sjson.SetBytes(body, field, kept)
+	if err != nil || len(out) >= len(body) {
+		return body, false
+	}
+	return out, true
+}
+
+// keptMessages returns system messages and the newest n others. The kept
+// conversation starts at a user turn that answers no tool call, so it stays
+// valid without the dropped turns.
+func keptMessages(messages []gjson.Result, n int) []gjson.Result {
+	if n <= 0 {
+		return messages
+	}
+	var system, rest []gjson.Result
+	for _, m := range messages {
+		switch m.Get("role").String() {
+		case "system", "developer":
+			system = append(system, m)
+		default:
+			rest = append(rest, m)
+		}
+	}
+	if len(rest) <= n {
+		return messages
+	}
+	start := len(rest) - n
+	for start < len(rest) && !isConversationStart(rest[start]) {
+		start++
+	}
+	if start == len(rest) {
+		return messages
+	}
+	return append(system, rest[start:]...)
+}
+
+// isConversationStart reports whether a message is a user turn that carries
+// no tool result.
+func isConversationStart(m gjson.Result) bool {
+	if m.Get("role").String() != "user" {
+		return false
+	}
+	toolResult := false
+	for _, field := range []string{"content", "parts"} {
+		m.Get(field).ForEach(func(_, part gjson.Result) bool {
+			if part.Get("type").String() == "tool_result" || part.Get("functionResponse").Exists() {
+				toolResult = true
+			}
+			return !toolResult
+		})
+	}
+	return !toolResult
+}
+
+// stripImages replaces the image parts of a message with a text note.
+func stripImages(raw []byte) []byte {
+	for _, field := range []string{"content", "parts"} {
+		parts := gjson.GetBytes(raw, field)
+		if !parts.IsArray() {
+			continue
+		}
+		parts.ForEach(func(i, part gjson.Result) bool {
+			path := field + "." + i.String()
+			switch {
+			case part.Get("type").String() == "image",
+				part.Get("type").String() == "image_url",
+				part.Get("type").String() == "input_image":
+				raw, _ = sjson.SetBytes(raw, path, map[string]string{
+					"type": "text",
+					"text": slimmedImage,
+				})
+			case strings.HasPrefix(part.Get("inlineData.mimeType").String(), "image/"),
+				strings.HasPrefix(part.Get("inline_data.mime_type").String(), "image/"):
+				raw, _ = sjson.SetBytes(raw, path, map[string]string{"text": slimmedImage})
+			}
+			return true
+		})
+	}
+	return raw
+}
+
+// compactText collapses trailing spaces, runs of spaces inside lines, and runs
+// of blank lines in the text of a message. Indentation is kept.
+func compactText(raw []byte) []byte {
+	compact := func(s string) string {
+		s = slimTrailingSpace.ReplaceAllString(s, "\n")
+		s = slimInnerSpace.ReplaceAllString(s, "$1 ")
+		return slimBlankLines.ReplaceAllString(s, "\n\n")
+	}
+	set := func(path string, text gjson.Result) {
+		if text.Type == gjson.String {
+			raw, _ = sjson.SetBytes(raw, path, compact(text.String()))
+		}
+	}
+	set("content", gjson.GetBytes(raw, "content"))
+	for _, field := range []string{"content", "parts"} {
+		gjson.GetBytes(raw, field).ForEach(func(i, part gjson.Result) bool {
+			set(field+"."+i.String()+".text", part.Get("text"))
+			return true
+		})
+	}
+	return raw
+}
@@ -0,0 +1,131 @@
+package hydra
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestSlimBodyConfig_Slim(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   SlimBodyConfig
+		body     string
+		path     string
+		expected string
+	}{
+		{
+			"keep newest messages",
+			SlimBodyConfig{KeepMessages: 2},
+			`{"messages":[{"role":"system","content":"Be brief."},` +
+				`{"role":"user","content":"one"},{"role":"assistant","content":"1"},` +
+				`{"role":"user","content":"two"},{"role":"assistant","content":"2"},` +
+				`{"role":"user","content":"three"}]}`,
+			"messages.#.content",
+			`["Be brief.","three"]`,
+		},
+		{
+			"start after tool results",
+			SlimBodyConfig{KeepMessages: 3},
+			`{"messages":[{"role":"user","content":"one"},` +
+				`{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]},` +
+				`{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1"}]},` +
+				`{"role":"assistant","content":"done"},{"role":"user","content":"two"}]}`,
+			"messages.#.role",
+			`["user"]`,
+		},
+		{
+			"strip anthropic images",
+			SlimBodyConfig{StripImages: true},
+			`{"messages":[{"role":"user","content":[{"type":"text","text":"What is this?"},` +
+				`{"type":"image","source":{"type":"base64","data":"` + strings.Repeat("A", 64) + `"}}]}]}`,
+			"messages.0.content.1.text",
+			slimmedImage,
+		},
+		{
+			"strip gemini images",
+			SlimBodyConfig{StripImages: true},
+			`{"contents":[{"role":"user","parts":[{"inlineData":{"mimeType":"image/png","data":"` +
+				strings.Repeat("A", 64) + `"}}]}]}`,
+			"contents.0.parts.0.text",
+			slimmedImage,
+		},
+		{
+			"compact whitespace",
+			SlimBodyConfig{CompactWhitespace: true},
+			`{"messages":[{"role":"user","content":"a    b  \n\n\n\n    c"}]}`,
+			"messages.0.content",
+			"a b\n\n    c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, ok := tt.config.slim([]byte(tt.body))
+			if !ok {
+				t.Fatal("expected the body to be slimmed")
+			}
+			got := gjson.GetBytes(out, tt.path)
+			if got.Raw != tt.expected && got.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got.Raw)
+			}
+		})
+	}
+
+	body := []byte(`{"messages":[{"role":"user","content":"hi"}]}`)
+	if _, ok := (SlimBodyConfig{KeepMessages: 5, CompactWhitespace: true}).slim(body); ok {
+		t.Error("expected a body that cannot shrink to be left as it was")
+	}
+}
+
+func TestTransport_RoundTrip_SlimBody(t *testing.T) {
+	var sizes []int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sizes = append(sizes, len(b))
+		if len(b) > 200 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	l := &Listener{
+		Name:       "slim",
+		ConfigType: "openai",
+		SlimBody:   SlimBodyConfig{KeepMessages: 1},
+		ResolvedModels: []Model{{
+			ID:       "slim-model",
+			Provider: "slim",
+			Model:    "gpt-5",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		}},
+	}
+	providers := map[string]Provider{
+		"slim": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	body := `{"model":"gpt-5","messages":[{"role":"user","content":"` + strings.Repeat("x", 300) +
+		`"},{"role":"assistant","content":"ok"},{"role":"user","content":"short"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(sizes) != 2 || sizes[1] >= sizes[0] {
+		t.Errorf("expected a slimmed retry to succeed, got %d after bodies of %v",
+			resp.StatusCode, sizes)
+	}
+}
@@ -0,0 +1,218 @@
+package hydra
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// sloSummaryInterval is how often the SLO compliance summary is logged.
+const sloSummaryInterval = 5 * time.Minute
+
+// SLO kinds: total latency of non-streaming requests and time to first event
+// of streaming ones.
+const (
+	sloKindLatency = "latency"
+	sloKindTTFT    = "ttft"
+)
+
+// listenerSLOs tracks requests against the latency objectives of listeners.
+var listenerSLOs = newSLOTracker()
+
+var (
+	sloRequestsCounter = metrics.Counter(
+		"hydrallm_slo_requests_total",
+		"Requests measured against a listener latency SLO, by listener, kind, and outcome.",
+	)
+	sloComplianceGauge = metrics.Gauge(
+		"hydrallm_slo_compliance_ratio",
+		"Share of requests in the SLO window that met the target, by listener and kind.",
+	)
+	sloBurnRateGauge = metrics.Gauge(
+		"hydrallm_slo_burn_rate",
+		"Error budget burn rate over the SLO window, by listener and kind.",
+	)
+)
+
+// SLOConfig sets latency objectives of a listener. A request meets its target
+// when it is answered within it; objective is the share of requests that must.
+type SLOConfig struct {
+	Latency   time.Duration `mapstructure:"latency"`   // Non-streaming response target
+	TTFT      time.Duration `mapstructure:"ttft"`      // Streaming first-event target
+	Objective float64       `mapstructure:"objective"` // Default 0.95
+	Window    time.Duration `mapstructure:"window"`    // Burn rate window, default 1h
+}
+
+// enabled reports whether any target is set.
+func (c SLOConfig) enabled() bool {
+	return c.Latency > 0 || c.TTFT > 0
+}
+
+// target returns the SLO kind and target of a request, or zero if the
+// listener sets none for it.
+func (c SLOConfig) target(streaming bool) (string, time.Duration) {
+	if streaming {
+		return sloKindTTFT, c.TTFT
+	}
+	return sloKindLatency, c.Latency
+}
+
+// sloBucket counts requests of one minute.
+type sloBucket struct {
+	met, missed int
+}
+
+// sloSeries is the recent history of one listener and kind.
+type sloSeries struct {
+	objective float64
+	window    time.Duration
+	buckets   map[int64]sloBucket // Unix minute -> counts
+}
+
+// totals prunes buckets older than the window and sums the rest.
+func (s *sloSeries) totals(now time.Time) (met, missed int) {
+	oldest := now.Add(-s.window).Truncate(time.Minute).Unix()
+	for minute, b := range s.buckets {
+		if minute < oldest {
+			delete(s.buckets, minute)
+			continue
+		}
+		met += b.met
+		missed += b.missed
+	}
+	return met, missed
+}
+
+// burnRate returns how fast the error budget is spent: the share of missed
+// requests relative to the share the objective allows.
+func (s *sloSeries) burnRate(met, missed int) float64 {
+	if met+missed == 0 || s.objective >= 1 {
+		return 0
+	}
+	return float64(missed) / float64(met+missed) / (1 - s.objective)
+}
+
+type sloKey struct {
+	listener, kind string
+}
+
+type sloTracker struct {
+	mu     sync.Mutex
+	series map[sloKey]*sloSeries
+}
+
+func newSLOTracker() *sloTracker {
+	return &sloTracker{series: make(map[sloKey]*sloSeries)}
+}
+
+// record measures a request on listener that was answered after latency.
+// Failed requests and continuations are not measured.
+func (t *sloTracker) record(
+	ctx context.Context,
+	listener string,
+	cfg SLOConfig,
+	streaming bool,
+	resp *http.Response,
+	err error,
+	latency time.Duration,
+	now time.Time,
+) {
+	kind, target := cfg.target(streaming)
+	if target <= 0 || err != nil || resp.StatusCode >= 400 ||
+		ctx.Value(continuationContextKey{}) != nil {
+		return
+	}
+	met := latency <= target
+	outcome := "met"
+	if !met {
+		outcome = "missed"
+	}
+	sloRequestsCounter.Inc("listener", listener, "kind", kind, "outcome", outcome)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := sloKey{listener, kind}
+	s := t.series[key]
+	if s == nil {
+		s = &sloSeries{buckets: make(map[int64]sloBucket)}
+		t.series[key] = s
+	}
+	// Follow config reloads
+	s.objective, s.window = cfg.Objective, cfg.Window
+
+	minute := now.Truncate(time.Minute).Unix()
+	b := s.buckets[minute]
+	if met {
+		b.met++
+	} else {
+		b.missed++
+	}
+	s.buckets[minute] = b
+
+	metCount, missedCount := s.totals(now)
+	sloComplianceGauge.Set(
+		float64(metCount)/float64(metCount+missedCount),
+		"listener",
+		listener,
+		"kind",
+		kind,
+	)
+	sloBurnRateGauge.Set(s.burnRate(metCount, missedCount), "listener", listener, "kind", kind)
+}
+
+// summarize logs the compliance of every listener and kind over its window.
+func (t *sloTracker) summarize(logger *log.Logger, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := slices.SortedFunc(maps.Keys(t.series), func(a, b sloKey) int {
+		return cmp.Or(strings.Compare(a.listener, b.listener), strings.Compare(a.kind, b.kind))
+	})
+	for _, key := range keys {
+		s := t.series[key]
+		met, missed := s.totals(now)
+		if met+missed == 0 {
+			continue
+		}
+		compliance := float64(met) / float64(met+missed)
+		burnRate := s.burnRate(met, missed)
+		sloComplianceGauge.Set(compliance, "listener", key.listener, "kind", key.kind)
+		sloBurnRateGauge.Set(burnRate, "listener", key.listener, "kind", key.kind)
+
+		summary := logger.Info
+		if compliance < s.objective {
+			summary = logger.Warn
+		}
+		summary(
+			"slo summary",
+			"listener", key.listener,
+			"kind", key.kind,
+			"window", s.window,
+			"requests", met+missed,
+			"compliance_pct", strconv.FormatFloat(100*compliance, 'f', 1, 64),
+			"objective_pct", strconv.FormatFloat(100*s.objective, 'f', 1, 64),
+			"burn_rate", strconv.FormatFloat(burnRate, 'f', 2, 64),
+		)
+	}
+}
+
+// report logs a summary every interval until ctx is done.
+func (t *sloTracker) report(ctx context.Context, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.summarize(logger, now)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestSLOTracker_Record(t *testing.T) {
+	cfg := SLOConfig{
+		Latency:   time.Second,
+		TTFT:      500 * time.Millisecond,
+		Objective: 0.9,
+		Window:    time.Hour,
+	}
+	ok := &http.Response{StatusCode: http.StatusOK}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	s := newSLOTracker()
+
+	for range 8 {
+		s.record(ctx, "slo-test", cfg, false, ok, nil, 800*time.Millisecond, now)
+	}
+	s.record(ctx, "slo-test", cfg, false, ok, nil, 2*time.Second, now)
+	s.record(ctx, "slo-test", cfg, false, ok, nil, 3*time.Second, now)
+	s.record(ctx, "slo-test", cfg, true, ok, nil, 200*time.Millisecond, now)
+
+	// Failures and continuations are not measured
+	s.record(ctx, "slo-test", cfg, false, nil, errors.New("upstream"), time.Minute, now)
+	s.record(ctx, "slo-test", cfg, false, &http.Response{StatusCode: 502}, nil, time.Minute, now)
+	continuation := context.WithValue(ctx, continuationContextKey{}, true)
+	s.record(continuation, "slo-test", cfg, false, ok, nil, time.Minute, now)
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"met", []string{"listener", "slo-test", "kind", "latency", "outcome", "met"}, 8},
+		{"missed", []string{"listener", "slo-test", "kind", "latency", "outcome", "missed"}, 2},
+		{"ttft", []string{"listener", "slo-test", "kind", "ttft", "outcome", "met"}, 1},
+	}
+	for _, tt := range tests {
+		if got := metrics.value("hydrallm_slo_requests_total", tt.labels...); got != tt.want {
+			t.Errorf("%s requests = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	labels := []string{"listener", "slo-test", "kind", "latency"}
+	if got := metrics.value("hydrallm_slo_compliance_ratio", labels...); got != 0.8 {
+		t.Errorf("compliance = %v, want 0.8", got)
+	}
+	// 20% missed against a 10% budget
+	if got := metrics.value("hydrallm_slo_burn_rate", labels...); got < 1.99 || got > 2.01 {
+		t.Errorf("burn rate = %v, want 2", got)
+	}
+}
+
+func TestSLOTracker_Summarize(t *testing.T) {
+	cfg := SLOConfig{Latency: time.Second, Objective: 0.95, Window: 10 * time.Minute}
+	ok := &http.Response{StatusCode: http.StatusOK}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	s := newSLOTracker()
+
+	s.record(ctx, "slo-summary", cfg, false, ok, nil, 5*time.Second, start)
+	for range 3 {
+		s.record(ctx, "slo-summary", cfg, false, ok, nil, time.Millisecond, start.Add(5*time.Minute))
+	}
+
+	var logs bytes.Buffer
+	logger := log.New(&logs)
+	s.summarize(logger, start.Add(5*time.Minute))
+	out := logs.String()
+	for _, want := range []string{
+		"WARN",
+		"slo summary",
+		"listener=slo-summary",
+		"kind=latency",
+		"requests=4",
+		"compliance_pct=75.0",
+		"objective_pct=95.0",
+		"burn_rate=5.00",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected summary to contain %q, got %q", want, out)
+		}
+	}
+
+	// The slow request falls out of the window
+	logs.Reset()
+	s.summarize(logger, start.Add(12*time.Minute))
+	out = logs.String()
+	for _, want := range []string{"INFO", "requests=3", "compliance_pct=100.0", "burn_rate=0.00"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected summary to contain %q, got %q", want, out)
+		}
+	}
+
+	logs.Reset()
+	s.summarize(logger, start.Add(time.Hour))
+	if logs.Len() != 0 {
+		t.Errorf("expected no summary once the window is empty, got %q", logs.String())
+	}
+}
@@ -0,0 +1,127 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// errStreamNoEvent is returned when a stream ends or stalls before its first event.
+var errStreamNoEvent = errors.New("stream ended before first event")
+
+// awaitFirstEvent buffers a streaming response until its first server-sent
+// event, or until limit bytes arrived without one. It fails when the stream
+// dies, stalls past timeout, or opens with an error event, so the caller can
+// fall back before anything has been forwarded to the client. On success the
+// buffered bytes are replayed ahead of the rest of the stream. Streams other
+// than server-sent events, such as Bedrock event streams and Ollama NDJSON,
+// have no event boundaries to wait for and are left untouched.
+func awaitFirstEvent(resp *http.Response, limit int, timeout time.Duration) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil
+	}
+
+	var timedOut atomic.Bool
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			_ = resp.Body.Close()
+		})
+		defer timer.Stop()
+	}
+
+	var (
+		buf     bytes.Buffer
+		readErr error
+	)
+	chunk := make([]byte, 4096)
+	for {
+		event, found := firstSSEEvent(buf.Bytes())
+		if found {
+			if msg, isErr := sseErrorEvent(event); isErr {
+				_ = resp.Body.Close()
+				return fmt.Errorf("stream opened with error event: %s", msg)
+			}
+			break
+		}
+		if limit > 0 && buf.Len() >= limit {
+			break
+		}
+
+		// A read may return the final bytes together with an error,
+		// so the error only counts once the buffer has been checked
+		if readErr != nil {
+			_ = resp.Body.Close()
+			if timedOut.Load() {
+				return fmt.Errorf("%w: no event within %s", errStreamNoEvent, timeout)
+			}
+			if errors.Is(readErr, io.EOF) {
+				return errStreamNoEvent
+			}
+			return fmt.Errorf("%w: %w", errStreamNoEvent, readErr)
+		}
+
+		var n int
+		n, readErr = resp.Body.Read(chunk)
+		buf.Write(chunk[:n])
+	}
+
+	if timedOut.Load() {
+		return fmt.Errorf("%w: no event within %s", errStreamNoEvent, timeout)
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf.Bytes()), resp.Body), resp.Body}
+	return nil
+}
+
+// firstSSEEvent returns the field lines of the first complete event in b.
+// Heartbeats, such as comment-only keep-alives and Anthropic pings, are
+// skipped, so they neither count as the first event nor end its timeout.
+func firstSSEEvent(b []byte) ([][]byte, bool) {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	for {
+		block, rest, complete := bytes.Cut(b, []byte("\n\n"))
+		if !complete {
+			return nil, false
+		}
+		if fields := sseFields(block); !isHeartbeat(fields) {
+			return fields, true
+		}
+		b = rest
+	}
+}
+
+// sseErrorEvent reports whether an event signals an upstream error, either as
+// an Anthropic "event: error" or as a data payload with an error object.
+func sseErrorEvent(fields [][]byte) (string, bool) {
+	isErr := false
+	var data []byte
+	for _, line := range fields {
+		name, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(name) {
+		case "event":
+			isErr = isErr || string(value) == "error"
+		case "data":
+			data = append(data, value...)
+		}
+	}
+
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &payload) == nil && len(payload.Error) > 0 &&
+		string(payload.Error) != "null" {
+		return string(payload.Error), true
+	}
+	return string(data), isErr
+}
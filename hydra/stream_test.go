@@ -0,0 +1,181 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestAwaitFirstEvent(t *testing.T) {
+	sse := http.Header{"Content-Type": {"text/event-stream"}}
+	newResp := func(body string) *http.Response {
+		return &http.Response{Header: sse, Body: io.NopCloser(strings.NewReader(body))}
+	}
+
+	t.Run("replays buffered event", func(t *testing.T) {
+		stream := ": ping\n\ndata: {\"id\":1}\n\ndata: [DONE]\n\n"
+		resp := newResp(stream)
+		if err := awaitFirstEvent(resp, 1024, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if string(got) != stream {
+			t.Errorf("expected full stream replayed, got %q", got)
+		}
+	})
+
+	t.Run("empty stream", func(t *testing.T) {
+		err := awaitFirstEvent(newResp(""), 1024, 0)
+		if !errors.Is(err, errStreamNoEvent) {
+			t.Errorf("expected errStreamNoEvent, got %v", err)
+		}
+	})
+
+	t.Run("openai error payload", func(t *testing.T) {
+		err := awaitFirstEvent(newResp("data: {\"error\":{\"message\":\"overloaded\"}}\n\n"), 1024, 0)
+		if err == nil || !strings.Contains(err.Error(), "overloaded") {
+			t.Errorf("expected error event, got %v", err)
+		}
+	})
+
+	t.Run("anthropic error event", func(t *testing.T) {
+		stream := "event: error\r\ndata: {\"type\":\"error\"}\r\n\r\n"
+		if err := awaitFirstEvent(newResp(stream), 1024, 0); err == nil {
+			t.Error("expected error event")
+		}
+	})
+
+	t.Run("ping is not an event", func(t *testing.T) {
+		stream := "event: ping\ndata: {\"type\": \"ping\"}\n\n"
+		if err := awaitFirstEvent(newResp(stream), 1024, 0); !errors.Is(err, errStreamNoEvent) {
+			t.Errorf("expected errStreamNoEvent, got %v", err)
+		}
+	})
+
+	t.Run("limit reached without event", func(t *testing.T) {
+		resp := newResp(strings.Repeat("x", 64))
+		if err := awaitFirstEvent(resp, 16, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if len(got) != 64 {
+			t.Errorf("expected 64 bytes replayed, got %d", len(got))
+		}
+	})
+
+	t.Run("stalled stream", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer func() { _ = pw.Close() }()
+		err := awaitFirstEvent(&http.Response{Header: sse, Body: pr}, 1024, 20*time.Millisecond)
+		if !errors.Is(err, errStreamNoEvent) {
+			t.Errorf("expected errStreamNoEvent, got %v", err)
+		}
+	})
+
+	// Streams without server-sent event boundaries pass through untouched
+	for contentType, stream := range map[string]string{
+		"application/vnd.amazon.eventstream": "\x00\x00\x00\x55\x00\x00\x00\x4b:event-type",
+		"application/x-ndjson":               "{\"message\":{\"content\":\"hi\"},\"done\":true}\n",
+	} {
+		t.Run(contentType, func(t *testing.T) {
+			resp := &http.Response{
+				Header: http.Header{"Content-Type": {contentType}},
+				Body:   io.NopCloser(strings.NewReader(stream)),
+			}
+			if err := awaitFirstEvent(resp, 1024, 0); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, _ := io.ReadAll(resp.Body)
+			if string(got) != stream {
+				t.Errorf("expected the stream untouched, got %q", got)
+			}
+		})
+	}
+}
+
+func TestTransport_RoundTrip_NonSSEStream(t *testing.T) {
+	stream := "{\"message\":{\"content\":\"hi\"},\"done\":true}\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte(stream))
+	}))
+	defer upstream.Close()
+
+	models := []Model{{ID: "ndjson", Provider: "ndjson", Model: "m", Type: "openai", Attempts: 1}}
+	providers := map[string]Provider{
+		"ndjson": {URL: upstream.URL, ParsedURL: mustParseURL(upstream.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond, StreamBufferBytes: 1024}
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/api/chat",
+		bytes.NewReader([]byte(`{"stream":true}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != stream {
+		t.Errorf("expected the short stream forwarded, got %q", body)
+	}
+}
+
+func TestTransport_RoundTrip_StreamFallback(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		// Connection ends before any event is sent
+	}))
+	defer broken.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"ok\"}\n\ndata: [DONE]\n\n"))
+	}))
+	defer healthy.Close()
+
+	models := []Model{
+		{ID: "broken", Provider: "broken", Model: "m", Type: "openai", Attempts: 1},
+		{ID: "healthy", Provider: "healthy", Model: "m", Type: "openai", Attempts: 1},
+	}
+	providers := map[string]Provider{
+		"broken":  {URL: broken.URL, ParsedURL: mustParseURL(broken.URL)},
+		"healthy": {URL: healthy.URL, ParsedURL: mustParseURL(healthy.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond, StreamBufferBytes: 1024}
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"stream":true}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"id":"ok"`) {
+		t.Errorf("expected stream from fallback model, got %q", body)
+	}
+	if got := modelHealth.get("broken"); got.ConsecutiveFailures != 1 {
+		t.Errorf("expected broken model failure to be recorded, got %+v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateData is the data passed to a template model's body template.
+type templateData struct {
+	Request any    // Decoded inbound JSON body
+	Model   string // Configured upstream model name
+}
+
+// templateFuncs are the helper functions available to body templates.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+	"join": func(sep string, v []any) string {
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, sep)
+	},
+	"default": func(fallback, v any) any {
+		if v == nil {
+			return fallback
+		}
+		return v
+	},
+}
+
+// parseBodyTemplate parses a template model's body template.
+func parseBodyTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// renderTemplateBody renders the outbound body of a template model from the inbound JSON body.
+// Numbers are kept as written, so large integers such as seeds render exactly.
+func renderTemplateBody(tmpl *template.Template, body []byte, model string) ([]byte, error) {
+	if tmpl == nil {
+		return nil, errors.New("template model has no parsed template")
+	}
+
+	data := templateData{Model: model}
+	if len(bytes.TrimSpace(body)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&data.Request); err != nil {
+			return nil, fmt.Errorf("failed to decode request body: %w", err)
+		}
+		if dec.More() {
+			return nil, errors.New("failed to decode request body: unexpected data after JSON")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
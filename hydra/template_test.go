@@ -0,0 +1,86 @@
+package hydra
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderTemplateBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			"model and field access",
+			`{"engine":{{ json .Model }},"text":{{ json .Request.prompt }}}`,
+			`{"model":"placeholder","prompt":"hi"}`,
+			`{"engine":"internal-v2","text":"hi"}`,
+			false,
+		},
+		{
+			"nested values are encoded as JSON",
+			`{"history":{{ json .Request.messages }}}`,
+			`{"messages":[{"role":"user","content":"hi"}]}`,
+			`{"history":[{"content":"hi","role":"user"}]}`,
+			false,
+		},
+		{
+			"default for missing field",
+			`{"max":{{ default 256 .Request.max_tokens }}}`,
+			`{}`,
+			`{"max":256}`,
+			false,
+		},
+		{
+			"join list values",
+			`{"stop":"{{ join "," .Request.stop }}"}`,
+			`{"stop":["a","b"]}`,
+			`{"stop":"a,b"}`,
+			false,
+		},
+		{
+			"large integers render exactly",
+			`{"max":{{ .Request.max_tokens }},"seed":{{ json .Request.seed }}}`,
+			`{"max_tokens":1000000,"seed":9007199254740993}`,
+			`{"max":1000000,"seed":9007199254740993}`,
+			false,
+		},
+		{"empty body", `{"engine":{{ json .Model }}}`, ``, `{"engine":"internal-v2"}`, false},
+		{"invalid JSON body", `{}`, `{invalid`, "", true},
+		{"trailing data", `{}`, `{} {}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseBodyTemplate("test", tt.tmpl)
+			if err != nil {
+				t.Fatalf("failed to parse template: %v", err)
+			}
+			got, err := renderTemplateBody(tmpl, []byte(tt.body), "internal-v2")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !json.Valid(got) {
+				t.Fatalf("rendered body is not valid JSON: %s", got)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateBody_NilTemplate(t *testing.T) {
+	if _, err := renderTemplateBody(nil, []byte(`{}`), "m"); err == nil {
+		t.Error("expected error for nil template")
+	}
+}
@@ -0,0 +1,229 @@
+package hydra
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Model tool policy modes.
+const (
+	toolPolicyStrip  = "strip"  // Remove disallowed tools from the request
+	toolPolicyReject = "reject" // Skip the model for requests with disallowed tools
+)
+
+// toolArrays are the paths of tool declarations in OpenAI, Anthropic, Gemini,
+// and Bedrock Converse request bodies.
+var toolArrays = []string{"tools", "toolConfig.tools"}
+
+var toolPolicyCounter = metrics.Counter(
+	"hydrallm_tool_policy_total",
+	"Attempts with tools stripped and models skipped for request tools, by model and action.",
+)
+
+// ToolPolicy restricts the tools a model is sent. Without allow or deny
+// lists, every tool is disallowed.
+type ToolPolicy struct {
+	Mode  string   `mapstructure:"mode"`  // strip or reject, empty for no policy
+	Allow []string `mapstructure:"allow"` // Only these tool names, when set
+	Deny  []string `mapstructure:"deny"`  // Never these tool names
+}
+
+func isSupportedToolPolicy(mode string) bool {
+	switch mode {
+	case "", toolPolicyStrip, toolPolicyReject:
+		return true
+	default:
+		return false
+	}
+}
+
+// permits reports whether the policy lets a tool through.
+func (p ToolPolicy) permits(name string) bool {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return false
+	}
+	if len(p.Allow) > 0 && !slices.Contains(p.Allow, name) {
+		return false
+	}
+	return !slices.Contains(p.Deny, name)
+}
+
+// filter removes the tools the policy disallows from a request body and
+// returns the names removed. A tool_choice naming a removed tool is dropped,
+// and so is all tool configuration once no tool is left.
+func (p ToolPolicy) filter(body []byte) ([]byte, []string, error) {
+	var removed []string
+	for _, path := range toolArrays {
+		tools := gjson.GetBytes(body, path)
+		if !tools.IsArray() {
+			continue
+		}
+		before := len(removed)
+		kept := []json.RawMessage{}
+		for _, tool := range tools.Array() {
+			// A Gemini tool declares several functions
+			if decls := tool.Get("functionDeclarations"); decls.IsArray() {
+				var keptDecls []json.RawMessage
+				for _, decl := range decls.Array() {
+					if name := decl.Get("name").String(); p.permits(name) {
+						keptDecls = append(keptDecls, json.RawMessage(decl.Raw))
+					} else {
+						removed = append(removed, name)
+					}
+				}
+				if len(keptDecls) == 0 {
+					continue
+				}
+				raw, _ := json.Marshal(keptDecls)
+				out, err := sjson.SetRawBytes([]byte(tool.Raw), "functionDeclarations", raw)
+				if err != nil {
+					return nil, nil, err
+				}
+				kept = append(kept, out)
+				continue
+			}
+			if name := toolName(tool); p.permits(name) {
+				kept = append(kept, json.RawMessage(tool.Raw))
+			} else {
+				removed = append(removed, name)
+			}
+		}
+		if len(removed) == before {
+			continue
+		}
+
+		var err error
+		if len(kept) == 0 {
+			body, err = withoutTools(body, path)
+		} else {
+			raw, _ := json.Marshal(kept)
+			body, err = sjson.SetRawBytes(body, path, raw)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A forced tool that was removed cannot be called
+	choice := gjson.GetBytes(body, "tool_choice")
+	name := cmp.Or(choice.Get("function.name").String(), choice.Get("name").String())
+	if name != "" && slices.Contains(removed, name) {
+		var err error
+		if body, err = sjson.DeleteBytes(body, "tool_choice"); err != nil {
+			return nil, nil, err
+		}
+	}
+	return body, removed, nil
+}
+
+// withoutTools deletes the tool array at path and the settings that only
+// apply to tools.
+func withoutTools(body []byte, path string) ([]byte, error) {
+	fields := []string{"toolConfig"} // Bedrock tools, or Gemini function calling
+	if path == "tools" {
+		fields = []string{"tools", "tool_choice", "parallel_tool_calls"}
+		if !gjson.GetBytes(body, "toolConfig.tools").Exists() {
+			fields = append(fields, "toolConfig")
+		}
+	}
+	var err error
+	for _, field := range fields {
+		if body, err = sjson.DeleteBytes(body, field); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// toolName names a tool declaration: its function name, its name, or for
+// built-in tools its type or, in Gemini, its only key.
+func toolName(tool gjson.Result) string {
+	name := cmp.Or(
+		tool.Get("function.name").String(),
+		tool.Get("name").String(),
+		tool.Get("toolSpec.name").String(),
+		tool.Get("type").String(),
+	)
+	if name == "" {
+		tool.ForEach(func(key, _ gjson.Result) bool {
+			name = key.String()
+			return false
+		})
+	}
+	return name
+}
+
+// refusedTools returns the tools of a request body the model's policy
+// rejects, or nil when the model takes the request.
+func refusedTools(model Model, body []byte) []string {
+	if model.Tools.Mode != toolPolicyReject {
+		return nil
+	}
+	_, removed, err := model.Tools.filter(body)
+	if err != nil {
+		return nil
+	}
+	return removed
+}
+
+// toolPermittedModels leaves out the models whose tool policy rejects the
+// tools of a request body. It also returns the tools refused by the first
+// model left out.
+func toolPermittedModels(models []Model, body []byte) ([]Model, []string) {
+	var refused []string
+	permitted := slices.DeleteFunc(slices.Clone(models), func(m Model) bool {
+		tools := refusedTools(m, body)
+		if len(tools) == 0 {
+			return false
+		}
+		if refused == nil {
+			refused = tools
+		}
+		toolPolicyCounter.Inc("model", m.ID, "action", "rejected")
+		return true
+	})
+	return permitted, refused
+}
+
+// toolsRejectedResponse answers a request no model may serve with its tools,
+// in the error format of the listener.
+func toolsRejectedResponse(req *http.Request, l *Listener, tools []string) *http.Response {
+	slices.Sort(tools)
+	message := fmt.Sprintf(
+		"tools not allowed for the requested model: %s",
+		strings.Join(slices.Compact(tools), ", "),
+	)
+	var body any
+	switch l.ConfigType {
+	case "anthropic":
+		body = map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": "invalid_request_error", "message": message},
+		}
+	case "gemini":
+		body = map[string]any{
+			"error": map[string]any{
+				"code":    http.StatusBadRequest,
+				"message": message,
+				"status":  "INVALID_ARGUMENT",
+			},
+		}
+	default:
+		body = map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    "invalid_request_error",
+				"code":    "tools_not_allowed",
+			},
+		}
+	}
+	data, _ := json.Marshal(body)
+	return jsonResponse(req, http.StatusBadRequest, data)
+}
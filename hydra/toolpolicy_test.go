@@ -0,0 +1,198 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestToolPolicy_Filter(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ToolPolicy
+		body    string
+		removed []string
+		check   func(t *testing.T, out []byte)
+	}{
+		{
+			name:   "openai allow list",
+			policy: ToolPolicy{Mode: toolPolicyStrip, Allow: []string{"lookup"}},
+			body: `{"tools":[{"type":"function","function":{"name":"lookup"}},` +
+				`{"type":"function","function":{"name":"shell"}}],` +
+				`"tool_choice":{"type":"function","function":{"name":"shell"}}}`,
+			removed: []string{"shell"},
+			check: func(t *testing.T, out []byte) {
+				if gjson.GetBytes(out, "tools.#").Int() != 1 ||
+					gjson.GetBytes(out, "tools.0.function.name").String() != "lookup" {
+					t.Errorf("expected only lookup kept, got %s", out)
+				}
+				if gjson.GetBytes(out, "tool_choice").Exists() {
+					t.Errorf("expected tool_choice of a removed tool dropped, got %s", out)
+				}
+			},
+		},
+		{
+			name:   "anthropic deny list",
+			policy: ToolPolicy{Mode: toolPolicyStrip, Deny: []string{"web_search"}},
+			body: `{"tools":[{"name":"lookup","input_schema":{}},` +
+				`{"type":"web_search_20250305","name":"web_search"}]}`,
+			removed: []string{"web_search"},
+			check: func(t *testing.T, out []byte) {
+				if gjson.GetBytes(out, "tools.#").Int() != 1 {
+					t.Errorf("expected one tool kept, got %s", out)
+				}
+			},
+		},
+		{
+			name:   "no lists remove every tool",
+			policy: ToolPolicy{Mode: toolPolicyStrip},
+			body: `{"messages":[],"tools":[{"type":"function","function":{"name":"lookup"}}],` +
+				`"tool_choice":"auto","parallel_tool_calls":false}`,
+			removed: []string{"lookup"},
+			check: func(t *testing.T, out []byte) {
+				if string(out) != `{"messages":[]}` {
+					t.Errorf("expected all tool fields removed, got %s", out)
+				}
+			},
+		},
+		{
+			name:   "gemini declarations",
+			policy: ToolPolicy{Mode: toolPolicyStrip, Deny: []string{"shell", "googleSearch"}},
+			body: `{"tools":[{"functionDeclarations":[{"name":"lookup"},{"name":"shell"}]},` +
+				`{"googleSearch":{}}]}`,
+			removed: []string{"shell", "googleSearch"},
+			check: func(t *testing.T, out []byte) {
+				want := `[{"functionDeclarations":[{"name":"lookup"}]}]`
+				if got := gjson.GetBytes(out, "tools").Raw; got != want {
+					t.Errorf("expected %s, got %s", want, got)
+				}
+			},
+		},
+		{
+			name:   "bedrock converse",
+			policy: ToolPolicy{Mode: toolPolicyStrip},
+			body: `{"messages":[],"toolConfig":{"tools":[{"toolSpec":{"name":"lookup"}}],` +
+				`"toolChoice":{"auto":{}}}}`,
+			removed: []string{"lookup"},
+			check: func(t *testing.T, out []byte) {
+				if string(out) != `{"messages":[]}` {
+					t.Errorf("expected toolConfig removed, got %s", out)
+				}
+			},
+		},
+		{
+			name:   "permitted tools untouched",
+			policy: ToolPolicy{Mode: toolPolicyStrip, Allow: []string{"lookup"}},
+			body:   `{"tools":[{"type":"function","function":{"name":"lookup"}}]}`,
+			check: func(t *testing.T, out []byte) {
+				if string(out) != `{"tools":[{"type":"function","function":{"name":"lookup"}}]}` {
+					t.Errorf("expected body unchanged, got %s", out)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, removed, err := tt.policy.filter([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(removed, tt.removed) {
+				t.Errorf("expected removed %v, got %v", tt.removed, removed)
+			}
+			tt.check(t, out)
+		})
+	}
+}
+
+func TestTransport_RoundTrip_ToolPolicy(t *testing.T) {
+	var served []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		model := gjson.GetBytes(body, "model").String()
+		served = append(served, model)
+		if model == "plain" && gjson.GetBytes(body, "tools").Exists() {
+			t.Errorf("expected tools stripped for the plain model, got %s", body)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	providers := map[string]Provider{
+		"p": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	model := func(id string, policy ToolPolicy) Model {
+		return Model{
+			ID:       id,
+			Provider: "p",
+			Model:    id,
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+			Tools:    policy,
+		}
+	}
+	send := func(models []Model, body string) *http.Response {
+		t.Helper()
+		transport := NewRetryTransport(
+			models,
+			providers,
+			RetryConfig{MaxCycles: 1},
+			LogConfig{},
+			log.New(io.Discard),
+		)
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original/v1/chat/completions",
+			bytes.NewReader([]byte(body)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+	withTools := `{"tools":[{"type":"function","function":{"name":"shell"}}],"messages":[]}`
+
+	// A rejecting model is skipped for the next in the chain
+	resp := send([]Model{
+		model("guarded", ToolPolicy{Mode: toolPolicyReject, Deny: []string{"shell"}}),
+		model("plain", ToolPolicy{Mode: toolPolicyStrip}),
+	}, withTools)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !slices.Equal(served, []string{"plain"}) {
+		t.Errorf("expected the plain model to serve, got %d %v", resp.StatusCode, served)
+	}
+
+	// Without a model left the client gets a 400 naming the tools
+	served = nil
+	resp = send([]Model{
+		model("guarded", ToolPolicy{Mode: toolPolicyReject, Deny: []string{"shell"}}),
+	}, withTools)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || len(served) != 0 ||
+		gjson.GetBytes(body, "error.code").String() != "tools_not_allowed" ||
+		gjson.GetBytes(body, "error.message").String() !=
+			"tools not allowed for the requested model: shell" {
+		t.Errorf("unexpected rejection: %d %s", resp.StatusCode, body)
+	}
+
+	// Requests without the tools are served
+	resp = send([]Model{
+		model("guarded", ToolPolicy{Mode: toolPolicyReject, Deny: []string{"shell"}}),
+	}, `{"messages":[]}`)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected a request without tools served, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,131 @@
+package hydra
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+var upstreamPhaseHistogram = metrics.Histogram(
+	"hydrallm_upstream_phase_seconds",
+	"Duration of upstream connection phases per attempt.",
+	[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+)
+
+// attemptTimings records the connection phases of one upstream attempt.
+// Phases that did not happen, such as DNS and TLS on a reused connection,
+// stay zero.
+type attemptTimings struct {
+	mu sync.Mutex
+
+	start     time.Time
+	dnsStart  time.Time
+	dns       time.Duration
+	connStart time.Time
+	connect   time.Duration
+	tlsStart  time.Time
+	tls       time.Duration
+	reused    bool
+	ttfb      time.Duration
+}
+
+// withAttemptTrace returns a context that records connection timings into the
+// returned attemptTimings.
+func withAttemptTrace(ctx context.Context) (context.Context, *attemptTimings) {
+	t := &attemptTimings{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(_, _ string) {
+			t.mu.Lock()
+			t.connStart = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			t.mu.Lock()
+			t.connect = time.Since(t.connStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tls = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.ttfb = time.Since(t.start)
+			t.mu.Unlock()
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// phases returns the recorded phase durations keyed by phase name.
+// Phases that did not happen are omitted.
+func (t *attemptTimings) phases() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := make(map[string]time.Duration, 4)
+	for name, d := range map[string]time.Duration{
+		"dns":     t.dns,
+		"connect": t.connect,
+		"tls":     t.tls,
+		"ttfb":    t.ttfb,
+	} {
+		if d > 0 {
+			phases[name] = d
+		}
+	}
+	return phases
+}
+
+// recordTimings exports the attempt's phase durations and logs them at debug level.
+func (t *RetryTransport) recordTimings(model Model, timings *attemptTimings) {
+	phases := timings.phases()
+	for name, d := range phases {
+		upstreamPhaseHistogram.Observe(d.Seconds(), "provider", model.Provider, "phase", name)
+	}
+
+	timings.mu.Lock()
+	reused := timings.reused
+	timings.mu.Unlock()
+
+	t.logger.Debug(
+		"attempt timings",
+		"provider",
+		model.Provider,
+		"model",
+		model.Model,
+		"reused_conn",
+		reused,
+		"dns",
+		phases["dns"],
+		"connect",
+		phases["connect"],
+		"tls",
+		phases["tls"],
+		"ttfb",
+		phases["ttfb"],
+	)
+}
@@ -0,0 +1,75 @@
+package hydra
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestWithAttemptTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	ctx, timings := withAttemptTrace(t.Context())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	phases := timings.phases()
+	if _, ok := phases["connect"]; !ok {
+		t.Errorf("expected connect phase, got %v", phases)
+	}
+	if _, ok := phases["ttfb"]; !ok {
+		t.Errorf("expected ttfb phase, got %v", phases)
+	}
+	// Plain HTTP never performs a TLS handshake
+	if _, ok := phases["tls"]; ok {
+		t.Errorf("expected no tls phase, got %v", phases)
+	}
+}
+
+func TestRecordTimings(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.New(&logs)
+	logger.SetLevel(log.DebugLevel)
+	transport := &RetryTransport{logger: logger}
+
+	timings := &attemptTimings{connect: 3 * time.Millisecond, ttfb: 50 * time.Millisecond}
+	transport.recordTimings(Model{Provider: "trace-test", Model: "m"}, timings)
+
+	if !strings.Contains(logs.String(), "attempt timings") {
+		t.Errorf("expected debug timings log, got %q", logs.String())
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`hydrallm_upstream_phase_seconds_count{provider="trace-test",phase="connect"} 1`,
+		`hydrallm_upstream_phase_seconds_count{provider="trace-test",phase="ttfb"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+	if strings.Contains(out, `provider="trace-test",phase="dns"`) {
+		t.Error("expected no dns series for a phase that did not happen")
+	}
+}
@@ -0,0 +1,328 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// transcriptMaxLine bounds the size of a single stored turn when reading.
+const transcriptMaxLine = 2*corpusMaxCapture + 64*1024
+
+// conversationIDPattern restricts conversation IDs to safe file names.
+var conversationIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// errTranscriptNotFound is returned for conversations without a transcript.
+var errTranscriptNotFound = errors.New("transcript not found")
+
+// transcriptMu serializes transcript file access across listeners sharing a dir.
+var transcriptMu sync.Mutex
+
+// TranscriptConfig configures storage of full conversations for a listener.
+// Storage is disabled when no dir is set.
+type TranscriptConfig struct {
+	Dir    string `mapstructure:"dir"`    // Directory of per-conversation JSONL files
+	Header string `mapstructure:"header"` // Header carrying the conversation ID
+}
+
+// transcriptTurn is one request/response exchange of a conversation.
+type transcriptTurn struct {
+	Time     time.Time       `json:"time"`
+	Listener string          `json:"listener"`
+	APIKey   string          `json:"api_key,omitempty"` // Name of the client key
+	Path     string          `json:"path"`
+	Model    string          `json:"model,omitempty"` // Requested model
+	Status   int             `json:"status"`
+	Duration float64         `json:"duration_seconds"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Transcript is a stored conversation.
+type Transcript struct {
+	ID    string           `json:"id"`
+	Turns []transcriptTurn `json:"turns"`
+}
+
+// TranscriptSummary describes a stored conversation without its turns.
+type TranscriptSummary struct {
+	ID      string    `json:"id"`
+	Turns   int       `json:"turns"`
+	Updated time.Time `json:"updated"`
+}
+
+// isValidConversationID reports whether id can name a transcript.
+func isValidConversationID(id string) bool {
+	return conversationIDPattern.MatchString(id) && strings.Trim(id, ".") != ""
+}
+
+// transcriptBody embeds a body as JSON, or as a JSON string when it is not
+// JSON, such as a stream of server-sent events. Unlike corpus records,
+// transcripts are stored unredacted.
+func transcriptBody(b []byte) json.RawMessage {
+	if json.Valid(b) {
+		return bytes.Clone(b)
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+// newTranscriptMiddleware appends each exchange that carries a conversation ID
+// to the conversation's transcript in the listener's transcript dir.
+func newTranscriptMiddleware(
+	l *Listener,
+	_ *Config,
+	logger *log.Logger,
+) func(http.Handler) http.Handler {
+	if l.Transcripts.Dir == "" {
+		return nil
+	}
+	store := transcriptStore{dir: l.Transcripts.Dir}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(l.Transcripts.Header)
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !isValidConversationID(id) {
+				logger.Debug("ignoring invalid conversation ID", "listener", l.Name, "id", id)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var reqBody []byte
+			if r.Body != nil {
+				var err error
+				reqBody, err = io.ReadAll(io.LimitReader(r.Body, corpusMaxCapture))
+				if err != nil {
+					writeBodyReadError(w, l, err)
+					return
+				}
+				// Larger bodies are forwarded in full, only their start is recorded
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+			}
+
+			start := time.Now()
+			cw := &captureResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+
+			respBody, ok := decodeCapturedBody(cw.Header().Get("Content-Encoding"), cw.body.Bytes())
+			if !ok {
+				respBody = nil
+			}
+			turn := transcriptTurn{
+				Time:     start.UTC(),
+				Listener: l.Name,
+				APIKey:   apiKeyName(r.Context()),
+				Path:     r.URL.Path,
+				Model:    requestedModel(reqBody),
+				Status:   cw.status,
+				Duration: time.Since(start).Seconds(),
+				Request:  transcriptBody(reqBody),
+				Response: transcriptBody(respBody),
+			}
+			if err := store.append(id, turn); err != nil {
+				logger.Warn("failed to write transcript", "listener", l.Name, "error", err)
+			}
+		})
+	}
+}
+
+// transcriptStore keeps one JSONL file of turns per conversation in a directory.
+type transcriptStore struct {
+	dir string
+}
+
+func (s transcriptStore) path(id string) string {
+	return filepath.Join(s.dir, id+".jsonl")
+}
+
+func (s transcriptStore) append(id string, turn transcriptTurn) error {
+	line, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create transcript dir: %w", err)
+	}
+	f, err := os.OpenFile(s.path(id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open transcript: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to append transcript turn: %w", err)
+	}
+	return f.Close()
+}
+
+// get reads a conversation's turns in the order they were recorded.
+func (s transcriptStore) get(id string) (Transcript, error) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Transcript{}, errTranscriptNotFound
+	}
+	if err != nil {
+		return Transcript{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	t := Transcript{ID: id, Turns: []transcriptTurn{}}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), transcriptMaxLine)
+	for scanner.Scan() {
+		var turn transcriptTurn
+		if err := json.Unmarshal(scanner.Bytes(), &turn); err != nil {
+			return Transcript{}, fmt.Errorf("invalid transcript %q: %w", id, err)
+		}
+		t.Turns = append(t.Turns, turn)
+	}
+	return t, scanner.Err()
+}
+
+// list summarizes the stored conversations, most recently updated first.
+func (s transcriptStore) list() ([]TranscriptSummary, error) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []TranscriptSummary
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || e.IsDir() || !isValidConversationID(id) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(s.path(id))
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, TranscriptSummary{
+			ID:      id,
+			Turns:   bytes.Count(b, []byte("\n")),
+			Updated: info.ModTime().UTC(),
+		})
+	}
+	slices.SortFunc(summaries, func(a, b TranscriptSummary) int {
+		return b.Updated.Compare(a.Updated)
+	})
+	return summaries, nil
+}
+
+// delete removes a conversation's transcript.
+func (s transcriptStore) delete(id string) error {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return errTranscriptNotFound
+	}
+	return err
+}
+
+// transcriptStoreFor returns the transcript store of the named listener.
+func transcriptStoreFor(cfg *Config, listener string) (transcriptStore, bool) {
+	for _, l := range cfg.Listeners {
+		if l.Name == listener && l.Transcripts.Dir != "" {
+			return transcriptStore{dir: l.Transcripts.Dir}, true
+		}
+	}
+	return transcriptStore{}, false
+}
+
+// handleTranscripts serves the admin transcript API for the listener named in
+// the path: listing conversations, and reading or deleting one.
+func handleTranscripts(config func() *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store, ok := transcriptStoreFor(config(), r.PathValue("listener"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{
+				"error": "listener has no transcripts configured",
+			})
+			return
+		}
+
+		id := r.PathValue("id")
+		if id == "" {
+			summaries, err := store.list()
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"conversations": summaries})
+			return
+		}
+		if !isValidConversationID(id) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid conversation ID"})
+			return
+		}
+
+		var (
+			transcript Transcript
+			err        error
+		)
+		if r.Method == http.MethodDelete {
+			err = store.delete(id)
+		} else {
+			transcript, err = store.get(id)
+		}
+		switch {
+		case errors.Is(err, errTranscriptNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeJSON(w, http.StatusOK, transcript)
+		}
+	}
+}
+
+// validateTranscripts checks a listener's transcript settings.
+func validateTranscripts(l *Listener) error {
+	if l.Transcripts.Dir == "" {
+		return nil
+	}
+	if info, err := os.Stat(l.Transcripts.Dir); err == nil && !info.IsDir() {
+		return fmt.Errorf("transcripts: dir %q is not a directory", l.Transcripts.Dir)
+	}
+	if !slices.Contains(l.ResolvedMiddleware, "transcript") {
+		return errors.New("transcripts are configured but the transcript middleware is not enabled")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package hydra
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestIsValidConversationID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"run-42":                 true,
+		"a.b_c":                  true,
+		"":                       false,
+		"..":                     false,
+		"../etc/passwd":          false,
+		"with space":             false,
+		strings.Repeat("x", 129): false,
+	} {
+		if got := isValidConversationID(id); got != want {
+			t.Errorf("isValidConversationID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestTranscriptMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	l := &Listener{
+		Name:        "main",
+		Transcripts: TranscriptConfig{Dir: dir, Header: "X-Conversation-ID"},
+	}
+	mw := newTranscriptMiddleware(l, &Config{}, log.New(io.Discard))
+	if mw == nil {
+		t.Fatal("expected transcript middleware")
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+
+	send := func(id, content string) {
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/v1/chat/completions",
+			strings.NewReader(`{"model":"gpt","messages":[{"role":"user","content":"`+content+`"}]}`),
+		)
+		if id != "" {
+			req.Header.Set("X-Conversation-ID", id)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send("run-1", "first")
+	send("run-1", "bob@example.com")
+	send("run-2", "other")
+	send("", "untracked")
+	send("../escape", "invalid")
+
+	store := transcriptStore{dir: dir}
+	transcript, err := store.get("run-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transcript.Turns) != 2 {
+		t.Fatalf("expected 2 turns, got %d", len(transcript.Turns))
+	}
+	turn := transcript.Turns[1]
+	if turn.Listener != "main" || turn.Model != "gpt" || turn.Status != http.StatusOK {
+		t.Errorf("unexpected turn: %+v", turn)
+	}
+	// Transcripts are stored unredacted
+	if !strings.Contains(string(turn.Response), "bob@example.com") {
+		t.Errorf("expected the full response, got %s", turn.Response)
+	}
+
+	summaries, err := store.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 conversations, got %+v", summaries)
+	}
+}
+
+func TestTranscriptMiddleware_Disabled(t *testing.T) {
+	if newTranscriptMiddleware(&Listener{}, &Config{}, log.New(io.Discard)) != nil {
+		t.Error("expected no middleware without a transcript dir")
+	}
+}
+
+func TestAdminHandler_Transcripts(t *testing.T) {
+	dir := t.TempDir()
+	store := transcriptStore{dir: dir}
+	turn := transcriptTurn{Listener: "main", Status: 200, Request: json.RawMessage(`{}`)}
+	if err := store.append("run-1", turn); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := testAdminConfig()
+	cfg.Listeners[0].Transcripts = TranscriptConfig{Dir: dir}
+	handler := newAdminHandler(func() *Config { return cfg })
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve("GET", "/transcripts/main")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id": "run-1"`) {
+		t.Errorf("expected conversation list, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve("GET", "/transcripts/main/run-1")
+	var transcript Transcript
+	if err := json.Unmarshal(rec.Body.Bytes(), &transcript); err != nil {
+		t.Fatalf("invalid transcript response: %v", err)
+	}
+	if transcript.ID != "run-1" || len(transcript.Turns) != 1 {
+		t.Errorf("unexpected transcript: %+v", transcript)
+	}
+
+	if rec := serve("GET", "/transcripts/other"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a listener without transcripts, got %d", rec.Code)
+	}
+	if rec := serve("DELETE", "/transcripts/main/run-1"); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204 on delete, got %d", rec.Code)
+	}
+	if rec := serve("GET", "/transcripts/main/run-1"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,749 @@
+package hydra
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTranslatedMaxTokens is used when an OpenAI request omits max_tokens,
+	// which the Anthropic messages API requires.
+	defaultTranslatedMaxTokens = 4096
+	bedrockAnthropicVersion    = "bedrock-2023-05-31"
+)
+
+// openAIChatRequest is the subset of an OpenAI chat completions request that
+// can be expressed in the Anthropic messages API.
+type openAIChatRequest struct {
+	Messages            []openAIMessage `json:"messages"`
+	MaxTokens           int             `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	Stop                json.RawMessage `json:"stop,omitempty"`
+	Stream              bool            `json:"stream,omitempty"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+	Tools      []openAITool    `json:"tools,omitempty"`
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+	User       string          `json:"user,omitempty"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type openAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int                    `json:"index"`
+	Message      *openAIResponseMessage `json:"message,omitempty"`
+	Delta        *openAIDelta           `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+type openAIResponseMessage struct {
+	Role      string           `json:"role"`
+	Content   *string          `json:"content"`
+	ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIDelta struct {
+	Role      string           `json:"role,omitempty"`
+	Content   *string          `json:"content,omitempty"`
+	ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type anthropicRequest struct {
+	Model            string               `json:"model,omitempty"`
+	AnthropicVersion string               `json:"anthropic_version,omitempty"`
+	System           string               `json:"system,omitempty"`
+	Messages         []anthropicMessage   `json:"messages"`
+	MaxTokens        int                  `json:"max_tokens"`
+	Temperature      *float64             `json:"temperature,omitempty"`
+	TopP             *float64             `json:"top_p,omitempty"`
+	StopSequences    []string             `json:"stop_sequences,omitempty"`
+	Stream           bool                 `json:"stream,omitempty"`
+	Tools            []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice       *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Metadata         *anthropicMetadata   `json:"metadata,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// isTranslatedType reports whether chat completions requests for models of
+// modelType are translated from the OpenAI format.
+func isTranslatedType(modelType string) bool {
+	switch modelType {
+	case "anthropic", "bedrock", "gemini", "ollama":
+		return true
+	default:
+		return false
+	}
+}
+
+// needsTranslation reports whether a request on path must be translated
+// from the OpenAI chat completions format for a model of modelType.
+func needsTranslation(path, modelType string) bool {
+	return isTranslatedType(modelType) &&
+		strings.HasSuffix(strings.TrimRight(path, "/"), "/chat/completions")
+}
+
+// canTranslate reports whether a listener of listenerType can serve models of modelType.
+func canTranslate(listenerType, modelType string) bool {
+	return listenerType == "openai" && isTranslatedType(modelType)
+}
+
+// translatedPath returns the upstream path for a translated chat completions request.
+// Bedrock, Gemini, and Ollama models are invoked directly under the provider
+// base path.
+func translatedPath(path string, model Model, basePath string, isStreaming bool) string {
+	switch model.Type {
+	case "ollama":
+		return strings.TrimRight(basePath, "/") + "/api/chat"
+	case "bedrock":
+		return bedrockInvokePath(strings.TrimRight(basePath, "/"), model.Model, isStreaming)
+	case "gemini":
+		method := ":generateContent"
+		if isStreaming {
+			method = ":streamGenerateContent"
+		}
+		return strings.TrimRight(basePath, "/") + "/models/" + model.Model + method
+	}
+	return strings.TrimSuffix(strings.TrimRight(path, "/"), "/chat/completions") + "/messages"
+}
+
+// streamIncludesUsage reports whether an OpenAI streaming request asks for a usage chunk.
+func streamIncludesUsage(body []byte) bool {
+	var req openAIChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return false
+	}
+	return req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+}
+
+// prepareTranslatedHeaders adapts client headers of a translated request.
+// A bearer token sent to the OpenAI listener is forwarded as an Anthropic or
+// Gemini API key, and Accept-Encoding is dropped so the response arrives decoded
+// for translation.
+func prepareTranslatedHeaders(req *http.Request, modelType string) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if ok && modelType == "anthropic" && req.Header.Get("x-api-key") == "" {
+		req.Header.Set("x-api-key", token)
+	}
+	if ok && modelType == "gemini" && req.Header.Get("x-goog-api-key") == "" {
+		req.Header.Set("x-goog-api-key", token)
+	}
+	req.Header.Del("Authorization")
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set("Content-Type", "application/json")
+}
+
+// translateChatRequest converts an OpenAI chat completions body to an Anthropic
+// messages body, a Gemini generateContent body for Gemini models, or an
+// Ollama chat body for Ollama models.
+func translateChatRequest(body []byte, model Model) ([]byte, error) {
+	switch model.Type {
+	case "gemini":
+		return translateGeminiRequest(body)
+	case "ollama":
+		return translateOllamaRequest(body, model)
+	}
+
+	var in openAIChatRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, fmt.Errorf("failed to decode chat completions request: %w", err)
+	}
+
+	out := anthropicRequest{
+		MaxTokens:   in.MaxTokens,
+		Temperature: in.Temperature,
+		TopP:        in.TopP,
+		Stream:      in.Stream,
+	}
+	if model.Type == "bedrock" {
+		out.AnthropicVersion = bedrockAnthropicVersion
+	} else {
+		out.Model = model.Model
+	}
+	if in.MaxCompletionTokens > 0 {
+		out.MaxTokens = in.MaxCompletionTokens
+	}
+	if out.MaxTokens == 0 {
+		out.MaxTokens = defaultTranslatedMaxTokens
+	}
+	if in.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: in.User}
+	}
+
+	stop, err := decodeStop(in.Stop)
+	if err != nil {
+		return nil, err
+	}
+	out.StopSequences = stop
+
+	var system []string
+	for _, msg := range in.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			text, err := contentText(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			system = append(system, text)
+		case "tool":
+			text, err := contentText(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = appendAnthropicBlocks(out.Messages, "user", anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   text,
+			})
+		case "user", "assistant":
+			blocks, err := contentBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if len(bytes.TrimSpace(input)) == 0 {
+					input = json.RawMessage("{}")
+				}
+				if !json.Valid(input) {
+					return nil, fmt.Errorf("tool call %q: arguments are not valid JSON", call.ID)
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+			out.Messages = appendAnthropicBlocks(out.Messages, msg.Role, blocks...)
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", msg.Role)
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range in.Tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	if out.ToolChoice, err = decodeToolChoice(in.ToolChoice); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(out)
+}
+
+// appendAnthropicBlocks appends blocks to the conversation, merging consecutive
+// turns of the same role since the messages API expects alternating roles.
+func appendAnthropicBlocks(
+	msgs []anthropicMessage,
+	role string,
+	blocks ...anthropicBlock,
+) []anthropicMessage {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		msgs[n-1].Content = append(msgs[n-1].Content, blocks...)
+		return msgs
+	}
+	return append(msgs, anthropicMessage{Role: role, Content: blocks})
+}
+
+// contentBlocks converts OpenAI message content (a string or a list of parts) to Anthropic blocks.
+func contentBlocks(raw json.RawMessage) ([]anthropicBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if text == "" {
+			return nil, nil
+		}
+		return []anthropicBlock{{Type: "text", Text: text}}, nil
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, errors.New("message content must be a string or a list of parts")
+	}
+
+	blocks := make([]anthropicBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				return nil, errors.New("image_url part is missing url")
+			}
+			blocks = append(blocks, anthropicBlock{
+				Type:   "image",
+				Source: imageSource(part.ImageURL.URL),
+			})
+		default:
+			return nil, fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// contentText flattens OpenAI message content to plain text.
+func contentText(raw json.RawMessage) (string, error) {
+	blocks, err := contentBlocks(raw)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if b.Type == "text" {
+			texts = append(texts, b.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// imageSource converts an OpenAI image URL, which may be a data URL, to an Anthropic image source.
+func imageSource(u string) *anthropicImageSource {
+	if rest, ok := strings.CutPrefix(u, "data:"); ok {
+		if meta, data, ok := strings.Cut(rest, ","); ok {
+			mediaType, _, _ := strings.Cut(meta, ";")
+			return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &anthropicImageSource{Type: "url", URL: u}
+}
+
+// decodeStop converts the OpenAI stop field (a string or a list) to stop sequences.
+func decodeStop(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.New("stop must be a string or a list of strings")
+	}
+	return list, nil
+}
+
+// decodeToolChoice converts the OpenAI tool_choice field to its Anthropic equivalent.
+func decodeToolChoice(raw json.RawMessage) (*anthropicToolChoice, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case "auto":
+			return &anthropicToolChoice{Type: "auto"}, nil
+		case "none":
+			return &anthropicToolChoice{Type: "none"}, nil
+		case "required":
+			return &anthropicToolChoice{Type: "any"}, nil
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice %q", mode)
+		}
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return nil, errors.New("tool_choice must be a string or name a function")
+	}
+	return &anthropicToolChoice{Type: "tool", Name: named.Function.Name}, nil
+}
+
+// finishReason maps an Anthropic stop reason to an OpenAI finish reason.
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+// translateChatResponse converts an Anthropic messages, Gemini generateContent,
+// or Ollama chat response to the OpenAI chat completions format. Streaming
+// bodies are converted as they arrive.
+func translateChatResponse(resp *http.Response, model Model, isStreaming, includeUsage bool) {
+	translateStream, translateMessage, translateError := translateAnthropicStream,
+		translateAnthropicMessage, translateAnthropicError
+	switch model.Type {
+	case "gemini":
+		translateStream, translateMessage, translateError = translateGeminiStream,
+			translateGeminiResponse, translateGeminiError
+	case "ollama":
+		translateStream, translateMessage, translateError = translateOllamaStream,
+			translateOllamaResponse, translateOllamaError
+	}
+
+	if isStreaming && resp.StatusCode < 400 {
+		upstream := resp.Body
+		pr, pw := io.Pipe()
+		go func() {
+			defer func() { _ = upstream.Close() }()
+			pw.CloseWithError(translateStream(upstream, pw, model, includeUsage))
+		}()
+		resp.Body = pr
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(nil))
+		return
+	}
+
+	var translated []byte
+	if resp.StatusCode >= 400 {
+		translated = translateError(body)
+	} else {
+		translated = translateMessage(body, model)
+	}
+	if translated == nil {
+		translated = body
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(translated))
+	resp.ContentLength = int64(len(translated))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(translated)))
+	resp.Header.Set("Content-Type", "application/json")
+}
+
+// translateAnthropicMessage converts a complete messages response body.
+// It returns nil if the body is not a messages response.
+func translateAnthropicMessage(body []byte, model Model) []byte {
+	var in anthropicResponse
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil
+	}
+
+	msg := &openAIResponseMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range in.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			input := string(block.Input)
+			if input == "" {
+				input = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: input},
+			})
+		}
+	}
+	if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+		content := text.String()
+		msg.Content = &content
+	}
+
+	reason := finishReason(in.StopReason)
+	out := openAIChatResponse{
+		ID:      in.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   cmp.Or(in.Model, model.Model),
+		Choices: []openAIChoice{{Message: msg, FinishReason: &reason}},
+		Usage: &openAIUsage{
+			PromptTokens:     in.Usage.InputTokens,
+			CompletionTokens: in.Usage.OutputTokens,
+			TotalTokens:      in.Usage.InputTokens + in.Usage.OutputTokens,
+		},
+	}
+	translated, err := json.Marshal(out)
+	if err != nil {
+		return nil
+	}
+	return translated
+}
+
+// translateAnthropicError converts an Anthropic error body to the OpenAI error format.
+// It returns nil if the body is not an Anthropic error.
+func translateAnthropicError(body []byte) []byte {
+	var in anthropicError
+	if err := json.Unmarshal(body, &in); err != nil || in.Error.Message == "" {
+		return nil
+	}
+	translated, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": in.Error.Message,
+			"type":    in.Error.Type,
+			"code":    nil,
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	return translated
+}
+
+// anthropicStreamEvent is the union of the Anthropic streaming event payloads.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage  `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+// translateAnthropicStream converts an Anthropic SSE stream to OpenAI chat completion chunks.
+func translateAnthropicStream(r io.Reader, w io.Writer, model Model, includeUsage bool) error {
+	var (
+		id        string
+		modelName = model.Model
+		created   = time.Now().Unix()
+		usage     anthropicUsage
+		stop      = "stop"
+		toolIndex = map[int]int{} // content block index -> tool call index
+	)
+
+	writeChunk := func(delta *openAIDelta, reason *string, u *openAIUsage) error {
+		chunk := openAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   modelName,
+			Choices: []openAIChoice{},
+			Usage:   u,
+		}
+		if delta != nil {
+			chunk.Choices = append(chunk.Choices, openAIChoice{Delta: delta, FinishReason: reason})
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var ev anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &ev); err != nil {
+			continue
+		}
+
+		var err error
+		switch ev.Type {
+		case "message_start":
+			id = ev.Message.ID
+			modelName = cmp.Or(ev.Message.Model, modelName)
+			usage.InputTokens = ev.Message.Usage.InputTokens
+			empty := ""
+			err = writeChunk(&openAIDelta{Role: "assistant", Content: &empty}, nil, nil)
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				idx := len(toolIndex)
+				toolIndex[ev.Index] = idx
+				err = writeChunk(&openAIDelta{ToolCalls: []openAIToolCall{{
+					Index:    &idx,
+					ID:       ev.ContentBlock.ID,
+					Type:     "function",
+					Function: openAIFunctionCall{Name: ev.ContentBlock.Name},
+				}}}, nil, nil)
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				text := ev.Delta.Text
+				err = writeChunk(&openAIDelta{Content: &text}, nil, nil)
+			case "input_json_delta":
+				idx := toolIndex[ev.Index]
+				err = writeChunk(&openAIDelta{ToolCalls: []openAIToolCall{{
+					Index:    &idx,
+					Function: openAIFunctionCall{Arguments: ev.Delta.PartialJSON},
+				}}}, nil, nil)
+			}
+		case "message_delta":
+			if ev.Delta.StopReason != "" {
+				stop = finishReason(ev.Delta.StopReason)
+			}
+			usage.OutputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			if err = writeChunk(&openAIDelta{}, &stop, nil); err != nil {
+				return err
+			}
+			if includeUsage {
+				err = writeChunk(nil, nil, &openAIUsage{
+					PromptTokens:     usage.InputTokens,
+					CompletionTokens: usage.OutputTokens,
+					TotalTokens:      usage.InputTokens + usage.OutputTokens,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			_, err = io.WriteString(w, "data: [DONE]\n\n")
+		case "error":
+			_, err = fmt.Fprintf(w, "data: {\"error\":%s}\n\n", ev.Error)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
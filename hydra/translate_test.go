@@ -0,0 +1,494 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func TestNeedsTranslation(t *testing.T) {
+	tests := []struct {
+		path      string
+		modelType string
+		want      bool
+	}{
+		{"/v1/chat/completions", "anthropic", true},
+		{"/v1/chat/completions/", "bedrock", true},
+		{"/v1/chat/completions", "gemini", true},
+		{"/v1/chat/completions", "openai", false},
+		{"/v1/messages", "anthropic", false},
+		{"/v1/embeddings", "anthropic", false},
+	}
+
+	for _, tt := range tests {
+		if got := needsTranslation(tt.path, tt.modelType); got != tt.want {
+			t.Errorf("needsTranslation(%q, %q) = %v, want %v", tt.path, tt.modelType, got, tt.want)
+		}
+	}
+}
+
+func TestTranslatedPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		model       Model
+		basePath    string
+		isStreaming bool
+		want        string
+	}{
+		{
+			"anthropic keeps prefix",
+			"/v1/v1/chat/completions",
+			Model{Type: "anthropic"},
+			"/v1",
+			false,
+			"/v1/v1/messages",
+		},
+		{
+			"bedrock invokes model",
+			"/v1/chat/completions",
+			Model{Type: "bedrock", Model: "anthropic.claude-v1:0"},
+			"",
+			false,
+			"/model/anthropic.claude-v1:0/invoke",
+		},
+		{
+			"bedrock streams model",
+			"/v1/chat/completions",
+			Model{Type: "bedrock", Model: "anthropic.claude-v1:0"},
+			"/",
+			true,
+			"/model/anthropic.claude-v1:0/invoke-with-response-stream",
+		},
+		{
+			"gemini generates content",
+			"/v1/chat/completions",
+			Model{Type: "gemini", Model: "gemini-2.5-flash"},
+			"/v1beta/",
+			false,
+			"/v1beta/models/gemini-2.5-flash:generateContent",
+		},
+		{
+			"gemini streams content",
+			"/v1/chat/completions",
+			Model{Type: "gemini", Model: "gemini-2.5-flash"},
+			"/v1/projects/p/locations/us-central1/publishers/google",
+			true,
+			"/v1/projects/p/locations/us-central1/publishers/google/models/gemini-2.5-flash:" +
+				"streamGenerateContent",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translatedPath(tt.path, tt.model, tt.basePath, tt.isStreaming); got != tt.want {
+				t.Errorf("translatedPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateChatRequest(t *testing.T) {
+	body := `{
+		"model": "placeholder",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function",
+				 "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"}
+		],
+		"max_completion_tokens": 100,
+		"temperature": 0.5,
+		"stop": "END",
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"user": "u-1"
+	}`
+
+	got, err := translateChatRequest([]byte(body), Model{Model: "claude-3", Type: "anthropic"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out anthropicRequest
+	if err := json.Unmarshal(got, &out); err != nil {
+		t.Fatalf("invalid output JSON: %v", err)
+	}
+
+	if out.Model != "claude-3" {
+		t.Errorf("expected model claude-3, got %q", out.Model)
+	}
+	if out.System != "Be brief." {
+		t.Errorf("expected system prompt, got %q", out.System)
+	}
+	if out.MaxTokens != 100 {
+		t.Errorf("expected max_tokens 100, got %d", out.MaxTokens)
+	}
+	if out.Temperature == nil || *out.Temperature != 0.5 {
+		t.Errorf("expected temperature 0.5, got %v", out.Temperature)
+	}
+	if len(out.StopSequences) != 1 || out.StopSequences[0] != "END" {
+		t.Errorf("expected stop sequences [END], got %v", out.StopSequences)
+	}
+	if out.ToolChoice == nil || out.ToolChoice.Type != "any" {
+		t.Errorf("expected tool_choice any, got %v", out.ToolChoice)
+	}
+	if len(out.Tools) != 1 || out.Tools[0].Name != "lookup" {
+		t.Errorf("expected lookup tool, got %v", out.Tools)
+	}
+	if out.Metadata == nil || out.Metadata.UserID != "u-1" {
+		t.Errorf("expected metadata user_id u-1, got %v", out.Metadata)
+	}
+
+	if len(out.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(out.Messages))
+	}
+	user := out.Messages[0]
+	if user.Role != "user" || len(user.Content) != 2 || user.Content[1].Type != "image" {
+		t.Errorf("unexpected user message: %+v", user)
+	}
+	if src := user.Content[1].Source; src == nil || src.Type != "base64" ||
+		src.MediaType != "image/png" {
+		t.Errorf("unexpected image source: %+v", src)
+	}
+	assistant := out.Messages[1]
+	if assistant.Role != "assistant" || assistant.Content[0].Type != "tool_use" ||
+		assistant.Content[0].Name != "lookup" {
+		t.Errorf("unexpected assistant message: %+v", assistant)
+	}
+	result := out.Messages[2]
+	if result.Role != "user" || result.Content[0].Type != "tool_result" ||
+		result.Content[0].ToolUseID != "call_1" {
+		t.Errorf("unexpected tool result message: %+v", result)
+	}
+}
+
+func TestTranslateChatRequest_Bedrock(t *testing.T) {
+	body := `{"model":"x","messages":[{"role":"user","content":"hi"}]}`
+	model := Model{Model: "anthropic.claude", Type: "bedrock"}
+	got, err := translateChatRequest([]byte(body), model)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out map[string]any
+	_ = json.Unmarshal(got, &out)
+	if _, ok := out["model"]; ok {
+		t.Error("expected no model field for bedrock")
+	}
+	if out["anthropic_version"] != bedrockAnthropicVersion {
+		t.Errorf(
+			"expected anthropic_version %q, got %v",
+			bedrockAnthropicVersion,
+			out["anthropic_version"],
+		)
+	}
+	if out["max_tokens"] != float64(defaultTranslatedMaxTokens) {
+		t.Errorf("expected default max_tokens, got %v", out["max_tokens"])
+	}
+}
+
+func TestTranslateChatRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", `{`},
+		{"unknown role", `{"messages":[{"role":"critic","content":"x"}]}`},
+		{"bad stop", `{"messages":[],"stop":1}`},
+		{"bad tool choice", `{"messages":[],"tool_choice":"sometimes"}`},
+		{
+			"bad tool arguments",
+			`{"messages":[{"role":"assistant","tool_calls":[{"id":"1","function":{"name":"f","arguments":"{"}}]}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := translateChatRequest([]byte(tt.body), Model{Type: "anthropic"})
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTranslateAnthropicMessage(t *testing.T) {
+	body := `{
+		"id": "msg_1",
+		"model": "claude-3",
+		"content": [
+			{"type": "text", "text": "Looking it up."},
+			{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {"q": "cat"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "output_tokens": 5}
+	}`
+
+	got := translateAnthropicMessage([]byte(body), Model{Model: "claude-3"})
+	var out openAIChatResponse
+	if err := json.Unmarshal(got, &out); err != nil {
+		t.Fatalf("invalid output JSON: %v", err)
+	}
+
+	if out.Object != "chat.completion" || out.ID != "msg_1" {
+		t.Errorf("unexpected envelope: %+v", out)
+	}
+	choice := out.Choices[0]
+	if *choice.FinishReason != "tool_calls" {
+		t.Errorf("expected finish_reason tool_calls, got %s", *choice.FinishReason)
+	}
+	if choice.Message.Content == nil || *choice.Message.Content != "Looking it up." {
+		t.Errorf("unexpected content: %v", choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 ||
+		choice.Message.ToolCalls[0].Function.Arguments != `{"q": "cat"}` {
+		t.Errorf("unexpected tool calls: %+v", choice.Message.ToolCalls)
+	}
+	if out.Usage.TotalTokens != 15 {
+		t.Errorf("expected total tokens 15, got %d", out.Usage.TotalTokens)
+	}
+}
+
+func TestTranslateAnthropicError(t *testing.T) {
+	got := translateAnthropicError(
+		[]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+	)
+	if !strings.Contains(string(got), `"message":"Overloaded"`) {
+		t.Errorf("unexpected translated error: %s", got)
+	}
+	if translateAnthropicError([]byte("not json")) != nil {
+		t.Error("expected nil for non-JSON body")
+	}
+}
+
+const anthropicStreamFixture = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3","usage":{"input_tokens":7}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func TestTranslateAnthropicStream(t *testing.T) {
+	var out bytes.Buffer
+	err := translateAnthropicStream(
+		strings.NewReader(anthropicStreamFixture),
+		&out,
+		Model{Model: "claude-3"},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var chunks []openAIChatResponse
+	done := false
+	for line := range strings.SplitSeq(out.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if !done {
+		t.Error("expected [DONE] terminator")
+	}
+
+	var text strings.Builder
+	var finish string
+	var toolName, toolArgs string
+	for _, c := range chunks {
+		if c.Object != "chat.completion.chunk" || c.ID != "msg_1" {
+			t.Errorf("unexpected chunk envelope: %+v", c)
+		}
+		for _, choice := range c.Choices {
+			if choice.Delta.Content != nil {
+				text.WriteString(*choice.Delta.Content)
+			}
+			for _, call := range choice.Delta.ToolCalls {
+				toolName += call.Function.Name
+				toolArgs += call.Function.Arguments
+			}
+			if choice.FinishReason != nil {
+				finish = *choice.FinishReason
+			}
+		}
+	}
+
+	if text.String() != "Hello" {
+		t.Errorf("expected text Hello, got %q", text.String())
+	}
+	if toolName != "lookup" || toolArgs != `{"q":` {
+		t.Errorf("unexpected tool call stream: name %q args %q", toolName, toolArgs)
+	}
+	if finish != "stop" {
+		t.Errorf("expected finish_reason stop, got %q", finish)
+	}
+	last := chunks[len(chunks)-1]
+	if last.Usage == nil || last.Usage.TotalTokens != 10 {
+		t.Errorf("expected usage chunk with 10 total tokens, got %+v", last.Usage)
+	}
+}
+
+func TestTransport_RoundTrip_TranslatesToAnthropic(t *testing.T) {
+	var gotPath, gotKey string
+	var gotBody anthropicRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-api-key")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","model":"claude-3",` +
+			`"content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn",` +
+			`"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "anthropic",
+			Model:    "claude-3",
+			Type:     "anthropic",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"anthropic": {URL: ts.URL, APIKey: "sk-ant", ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"model":"x","messages":[{"role":"user","content":"hello"}]}`)),
+	)
+	req.Header.Set("Authorization", "Bearer client-token")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if gotPath != "/v1/messages" {
+		t.Errorf("expected upstream path /v1/messages, got %s", gotPath)
+	}
+	if gotKey != "sk-ant" {
+		t.Errorf("expected provider API key, got %q", gotKey)
+	}
+	if gotBody.Model != "claude-3" || len(gotBody.Messages) != 1 {
+		t.Errorf("unexpected upstream body: %+v", gotBody)
+	}
+
+	var out openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if out.Object != "chat.completion" || *out.Choices[0].Message.Content != "hi" {
+		t.Errorf("unexpected translated response: %+v", out)
+	}
+}
+
+func TestTransport_RoundTrip_TranslatesStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(anthropicStreamFixture))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "anthropic",
+			Model:    "claude-3",
+			Type:     "anthropic",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"anthropic": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	transport := NewRetryTransport(
+		models,
+		providers,
+		RetryConfig{MaxCycles: 1},
+		LogConfig{},
+		log.New(io.Discard),
+	)
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"stream":true,"messages":[{"role":"user","content":"hello"}]}`)),
+	)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if !strings.Contains(string(body), `"content":"Hel"`) {
+		t.Errorf("expected translated text delta, got %s", body)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("expected [DONE] terminator, got %s", body)
+	}
+}
@@ -0,0 +1,1370 @@
+package hydra
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/charmbracelet/log"
+)
+
+var versionPrefixRegex = regexp.MustCompile(`^/v\d+`)
+
+var retryBudgetCounter = metrics.Counter(
+	"hydrallm_retry_budget_exhausted_total",
+	"Requests that ran out of retry.total_timeout before an attempt succeeded.",
+)
+
+// RetryTransport implements http.RoundTripper with retry and fallback logic.
+type RetryTransport struct {
+	state     atomic.Pointer[transportState]
+	requests  atomic.Uint64 // Request counter for round robin routing
+	logConfig LogConfig
+	logger    *log.Logger
+	client    *http.Client
+	proxied   sync.Map // Proxy and resolver URLs -> *http.Client of providers using them
+}
+
+// transportState holds the routing tables of a RetryTransport.
+// It is replaced as a whole on config reload, so a request keeps
+// using the snapshot it started with.
+type transportState struct {
+	listener     *Listener
+	models       []Model
+	routes       map[string][]Model
+	embeddings   []Model // Chain of embeddings requests, if separate
+	promptRoutes []resolvedPromptRoute
+	experiment   []Model // Candidate chain of the listener's experiment
+	providers    map[string]Provider
+	retry        RetryConfig
+}
+
+// NewRetryTransport creates a transport with retry and model fallback capabilities
+// for a bare model chain.
+func NewRetryTransport(
+	models []Model,
+	providers map[string]Provider,
+	retry RetryConfig,
+	logConfig LogConfig,
+	logger *log.Logger,
+) *RetryTransport {
+	return newListenerTransport(
+		&Listener{ResolvedModels: models},
+		providers,
+		retry,
+		logConfig,
+		logger,
+	)
+}
+
+// newListenerTransport creates a retry transport serving a listener's model chain.
+func newListenerTransport(
+	listener *Listener,
+	providers map[string]Provider,
+	retry RetryConfig,
+	logConfig LogConfig,
+	logger *log.Logger,
+) *RetryTransport {
+	t := &RetryTransport{
+		logConfig: logConfig,
+		logger:    logger,
+		client:    &http.Client{Transport: newUpstreamTransport(http.ProxyFromEnvironment, nil)},
+	}
+	t.Reload(listener, providers, retry)
+	return t
+}
+
+// newUpstreamTransport returns the HTTP transport for upstream requests,
+// connecting through proxy with dial, or the default dialer when nil.
+func newUpstreamTransport(
+	proxy func(*http.Request) (*url.URL, error),
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) *http.Transport {
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           countingDial(dial),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// clientFor returns the client reaching a provider: the shared client, or
+// one per distinct proxy_url, dns_over_https resolver, and host_header so each
+// keeps its own connection pool.
+func (t *RetryTransport) clientFor(provider Provider) *http.Client {
+	if provider.ParsedProxyURL == nil && provider.ParsedDNSOverHTTPS == nil &&
+		provider.HostHeader == "" {
+		return t.client
+	}
+	var key string
+	if provider.ParsedProxyURL != nil {
+		key = provider.ParsedProxyURL.String()
+	}
+	if provider.ParsedDNSOverHTTPS != nil {
+		key += " " + provider.ParsedDNSOverHTTPS.String()
+	}
+	if provider.HostHeader != "" {
+		key += " host=" + provider.HostHeader
+	}
+	if c, ok := t.proxied.Load(key); ok {
+		return c.(*http.Client)
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if provider.ParsedProxyURL != nil {
+		proxy = http.ProxyURL(provider.ParsedProxyURL)
+	}
+	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	if provider.ParsedDNSOverHTTPS != nil {
+		dial = dohDialer(newDoHResolver(provider.ParsedDNSOverHTTPS), t.logger)
+	}
+	transport := newUpstreamTransport(proxy, dial)
+	if provider.HostHeader != "" {
+		// Send the overriding name in SNI and verify the certificate against it
+		host := (&url.URL{Host: provider.HostHeader}).Hostname()
+		transport.TLSClientConfig = &tls.Config{ServerName: host}
+	}
+	c, _ := t.proxied.LoadOrStore(key, &http.Client{Transport: transport})
+	return c.(*http.Client)
+}
+
+// Reload atomically replaces the listener settings and the model and provider tables.
+// In-flight requests finish with the tables they started with.
+func (t *RetryTransport) Reload(
+	listener *Listener,
+	providers map[string]Provider,
+	retry RetryConfig,
+) {
+	t.state.Store(&transportState{
+		listener:     listener,
+		models:       listener.ResolvedModels,
+		routes:       listener.ResolvedRoutes,
+		embeddings:   listener.ResolvedEmbeddings,
+		promptRoutes: listener.ResolvedPromptRoutes,
+		experiment:   listener.ResolvedExperiment,
+		providers:    providers,
+		retry:        retry,
+	})
+}
+
+// RoundTrip implements http.RoundTripper with retry logic.
+func (t *RetryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	ctx := req.Context()
+
+	state := t.state.Load()
+
+	// The response timeout bounds the time until the response, not its body
+	if timeout := state.listener.ResponseTimeout; timeout > 0 {
+		var stop func() bool
+		var cancel context.CancelFunc
+		ctx, stop, cancel = withResponseTimeout(ctx, timeout)
+		defer func() {
+			resp, err = t.endResponseTimeout(req, state.listener, stop, cancel, resp, err)
+		}()
+	}
+
+	if !t.upstreamConnsAvailable() {
+		shedRequestsCounter.Inc("listener", state.listener.Name, "reason", shedConnections)
+		return shedResponse(req, state.listener, shedConnections), nil
+	}
+
+	// Read and buffer body with limit to prevent memory exhaustion. Bodies over
+	// the limit are rejected rather than truncated into invalid JSON.
+	var body []byte
+	if req.Body != nil {
+		if req.ContentLength > 0 && !bufferedBytes.fits(req.ContentLength) {
+			_ = req.Body.Close()
+			shedRequestsCounter.Inc("listener", state.listener.Name, "reason", shedMemory)
+			return shedResponse(req, state.listener, shedMemory), nil
+		}
+		limit := state.listener.maxBodySize()
+		body, err = io.ReadAll(io.LimitReader(req.Body, limit+1))
+		_ = req.Body.Close()
+		if isBodyTooLarge(err) || int64(len(body)) > limit {
+			status := http.StatusRequestEntityTooLarge
+			return jsonResponse(req, status, bodyTooLargeError(limit)), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		// The body stays buffered until the response body is closed
+		release, ok := reserveBody(int64(len(body)))
+		if !ok {
+			shedRequestsCounter.Inc("listener", state.listener.Name, "reason", shedMemory)
+			return shedResponse(req, state.listener, shedMemory), nil
+		}
+		defer func() {
+			if err != nil || resp == nil {
+				release()
+				return
+			}
+			resp.Body = releaseOnClose{ReadCloser: resp.Body, release: release}
+		}()
+	}
+
+	rule := state.listener.matchRule(req, body)
+	if rule != nil {
+		rulesCounter.Inc("listener", state.listener.Name, "rule", rule.Name)
+		if rule.Reject.Status != 0 {
+			t.logger.Info(
+				"request rejected by route",
+				"route",
+				rule.Name,
+				"status",
+				rule.Reject.Status,
+				"request_id",
+				requestID(ctx),
+			)
+			return rejectResponse(req, rule), nil
+		}
+		if body, err = rule.apply(req, body); err != nil {
+			return nil, err
+		}
+		t.logger.Debug("request matched route", "route", rule.Name, "request_id", requestID(ctx))
+	}
+	passthrough := state.listener.Dispatch == dispatchPassthrough
+	if isModelListRequest(req) {
+		switch {
+		case passthrough || state.listener.ModelList == modelListLocal:
+			return localModelList(req, state), nil
+		case state.listener.ModelList == modelListMerged:
+			// The listener's models are listed even when the upstream fails
+			defer func() {
+				if err == nil && resp.StatusCode == http.StatusOK {
+					mergeModelList(resp, state)
+					return
+				}
+				if resp != nil {
+					_ = resp.Body.Close()
+				}
+				resp, err = localModelList(req, state), nil
+			}()
+		}
+	}
+	var chain []Model
+	var variant, name string
+	if passthrough {
+		name = passthroughName(req, body)
+		chain = state.passthroughChain(name)
+	} else if isEmbeddingRequest(req) && len(state.embeddings) > 0 {
+		chain = state.embeddingChain(body)
+	} else {
+		chain, variant = state.chainFor(body, experimentVariant(ctx))
+	}
+	if rule != nil && len(rule.chain) > 0 {
+		chain, variant = rule.chain, ""
+	}
+	if passthrough && len(chain) == 0 {
+		t.logger.Info(
+			"requested model not served",
+			"listener",
+			state.listener.Name,
+			"model",
+			name,
+			"request_id",
+			requestID(ctx),
+		)
+		return modelNotFoundResponse(req, state.listener, name), nil
+	}
+	if isTokenCountRequest(req) {
+		return t.countTokens(ctx, req, body, chain, state)
+	}
+	models := orderModels(state.listener.Strategy, healthyModels(chain), t.requests.Add(1)-1)
+	if state.listener.Strategy == strategyBandit {
+		var decision banditDecision
+		models, decision = banditOrder(state.listener.Bandit, models)
+		t.logger.Info(
+			"bandit decision",
+			"listener",
+			state.listener.Name,
+			"model",
+			decision.Model,
+			"reason",
+			decision.Reason,
+			"score",
+			decision.Score,
+			"request_id",
+			requestID(ctx),
+		)
+	}
+	models, refused := toolPermittedModels(models, body)
+	if len(models) == 0 && len(refused) > 0 {
+		t.logger.Info(
+			"request tools rejected by model policy",
+			"listener",
+			state.listener.Name,
+			"tools",
+			refused,
+			"request_id",
+			requestID(ctx),
+		)
+		return toolsRejectedResponse(req, state.listener, refused), nil
+	}
+	isStreaming := isStreamingRequest(req, body)
+	debugEnabled := isDebugEnabled(t.logger)
+	maxCycles := max(state.retry.MaxCycles, 1)
+	exponentialBackoff := state.retry.ExponentialBackoff
+	logAttempts := state.listener.LogAttempts
+	priority := requestPriority(req, state.listener)
+
+	var lastErr error
+	var lastResp *http.Response
+	var lastModel Model
+	var lastCycle int
+	var lastUpstream time.Duration
+	var failures []attemptFailure
+	fail := func(model Model, status int, class string, err error, elapsed time.Duration) {
+		failures = append(failures, newAttemptFailure(model, status, class, err, elapsed))
+		observeAttempt(ctx, model, status, class, err, elapsed, false)
+	}
+	totalAttempts := 0
+
+	// The retry budget bounds attempts and the waits between them
+	var deadline time.Time
+	waitCtx := ctx
+	if budget := state.retry.TotalTimeout; budget > 0 {
+		deadline = time.Now().Add(budget)
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	if variant != "" {
+		ctx = context.WithValue(ctx, experimentVariantContextKey{}, variant)
+		start := time.Now()
+		defer func() {
+			observeExperiment(ctx, state.listener.Name, resp, err, totalAttempts, time.Since(start))
+		}()
+	}
+
+	if slo := state.listener.SLO; slo.enabled() {
+		start := time.Now()
+		defer func() {
+			now := time.Now()
+			listenerSLOs.record(
+				ctx,
+				state.listener.Name,
+				slo,
+				isStreaming,
+				resp,
+				err,
+				now.Sub(start),
+				now,
+			)
+		}()
+	}
+
+retries:
+	for cycle := range maxCycles {
+		for modelIdx, model := range models {
+			provider := state.providers[model.Provider]
+			interval := model.GetInterval(provider, state.retry.DefaultInterval)
+
+			for attempt := range model.Attempts {
+				if err = ctx.Err(); err != nil {
+					return nil, err
+				}
+				if !deadline.IsZero() {
+					remaining := time.Until(deadline)
+					if remaining <= 0 {
+						lastErr = t.exhaustBudget(ctx, state, totalAttempts, lastErr)
+						break retries
+					}
+					model.Timeout = min(model.Timeout, remaining)
+				}
+
+				// Skip a provider whose configured rate limit is reached
+				if err = providerLimits.acquire(ctx, model.Provider, provider.RateLimit); err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					t.logger.Info(
+						"provider rate limit reached, skipping model",
+						"provider",
+						model.Provider,
+						"model",
+						model.Model,
+					)
+					rateLimitSkipsCounter.Inc("provider", model.Provider)
+					lastErr = err
+					fail(model, 0, "", err, 0)
+					break
+				}
+
+				// Skip a saturated provider; batch requests do not wait for a slot
+				var release func()
+				if release, err = providerSlots.acquire(
+					ctx,
+					model.Provider,
+					provider.RateLimit,
+					priority,
+				); err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					t.logger.Info(
+						"provider saturated, skipping model",
+						"provider",
+						model.Provider,
+						"model",
+						model.Model,
+						"priority",
+						priority,
+					)
+					saturationSkipsCounter.Inc("provider", model.Provider, "priority", priority)
+					lastErr = err
+					fail(model, 0, "", err, 0)
+					break
+				}
+
+				// Count the attempt until its response body is closed, so a reload
+				// removing the model can report when it has drained
+				free, finish := release, upstreamRequests.start(model)
+				release = func() {
+					free()
+					finish()
+				}
+
+				totalAttempts++
+				t.logger.Debug(
+					"trying model",
+					"provider",
+					model.Provider,
+					"model",
+					model.Model,
+					"cycle",
+					cycle+1,
+					"attempt",
+					attempt+1,
+					"total_attempts",
+					totalAttempts,
+				)
+				attemptStart := time.Now()
+				depth := modelIdx
+				if delay := state.listener.HedgeDelay; delay > 0 && !isStreaming && attempt == 0 &&
+					modelIdx+1 < len(models) {
+					hedge := models[modelIdx+1]
+					model, resp, err = t.tryHedged(
+						ctx,
+						req,
+						body,
+						model,
+						hedge,
+						delay,
+						debugEnabled,
+						state,
+					)
+					if model.ID == hedge.ID {
+						depth++
+					}
+				} else {
+					resp, err = t.tryModel(ctx, req, body, model, isStreaming, debugEnabled, state)
+				}
+
+				// Send a body rejected as too large once more, slimmed
+				if slim := state.listener.SlimBody; err == nil && slim.enabled() &&
+					isTooLargeStatus(resp.StatusCode) {
+					if slimmed, ok := slim.slim(body); ok {
+						t.logger.Info(
+							"request too large, retrying with a slimmed body",
+							"provider",
+							model.Provider,
+							"model",
+							model.Model,
+							"bytes",
+							len(body),
+							"slimmed_bytes",
+							len(slimmed),
+						)
+						slimmedRequestsCounter.Inc("provider", model.Provider)
+						_, _ = io.Copy(io.Discard, resp.Body)
+						_ = resp.Body.Close()
+						body = slimmed
+						totalAttempts++
+						resp, err = t.tryModel(ctx, req, body, model, isStreaming, debugEnabled, state)
+					}
+				}
+
+				// Send a response failing the model's assertions once more, with a
+				// corrective system message
+				var assertErr error
+				if err == nil && !isStreaming && model.Assert.enabled() &&
+					isOutputPath(req.URL.Path) {
+					var failed []string
+					failed, assertErr = t.checkAssertions(model, resp, false)
+					if errors.Is(assertErr, errAssertionFailed) &&
+						model.Assert.OnFailure != assertFallback {
+						nudge := model.Assert.nudge(failed)
+						if nudged, nerr := withNudge(req.URL.Path, body, nudge); nerr == nil {
+							_ = resp.Body.Close()
+							totalAttempts++
+							resp, err = t.tryModel(
+								ctx,
+								req,
+								nudged,
+								model,
+								isStreaming,
+								debugEnabled,
+								state,
+							)
+							if err == nil {
+								_, assertErr = t.checkAssertions(model, resp, true)
+							}
+						}
+					}
+				}
+				if err != nil {
+					release()
+					t.logger.Debug("model request failed", "provider", model.Provider, "error", err)
+					lastErr = err
+					fail(model, 0, "", err, time.Since(attemptStart))
+					if ctx.Err() == nil {
+						modelHealth.recordFailure(model.ID, 0, err.Error())
+					}
+
+					// Wait before next attempt
+					if t.shouldWait(
+						cycle,
+						modelIdx,
+						attempt,
+						len(models),
+						model.Attempts,
+						maxCycles,
+					) {
+						t.wait(waitCtx, interval, totalAttempts, exponentialBackoff, 0)
+					}
+					continue
+				}
+
+				resp.Body = releaseOnClose{ReadCloser: resp.Body, release: release}
+
+				failure := upstreamFailure{Action: actionAbort}
+				if resp.StatusCode >= 400 {
+					failure = classifyResponse(model.Type, resp)
+					upstreamErrorsCounter.Inc(
+						"provider",
+						model.Provider,
+						"class",
+						failure.Class,
+						"action",
+						failure.Action.String(),
+					)
+				}
+				action := failure.Action
+				if action != actionAbort {
+					t.logResponse(logAttempts, model, resp, isStreaming, false)
+					modelHealth.recordFailure(model.ID, resp.StatusCode, http.StatusText(resp.StatusCode))
+					retryAfter := t.handleRetryableResponse(resp, model.Provider, failure)
+					lastResp = resp
+					lastModel, lastCycle = model, cycle+1
+					lastUpstream = time.Since(attemptStart)
+					fail(model, resp.StatusCode, failure.Class, nil, lastUpstream)
+
+					// Remaining attempts of this model are skipped on fallback
+					lastAttempt := attempt
+					if action == actionFallback {
+						lastAttempt = model.Attempts - 1
+						t.logger.Info(
+							"falling back to next model",
+							"provider",
+							model.Provider,
+							"model",
+							model.Model,
+							"status",
+							resp.StatusCode,
+						)
+					}
+
+					// Retry-After only delays another attempt at the provider that sent it
+					if nextProvider(models, modelIdx, lastAttempt) != model.Provider {
+						retryAfter = 0
+					}
+
+					// Wait before next attempt
+					if t.shouldWait(
+						cycle,
+						modelIdx,
+						lastAttempt,
+						len(models),
+						model.Attempts,
+						maxCycles,
+					) {
+						t.wait(
+							waitCtx,
+							interval,
+							totalAttempts,
+							exponentialBackoff,
+							min(retryAfter, state.retry.MaxRetryAfter),
+						)
+					}
+					if action == actionFallback {
+						break
+					}
+					continue
+				}
+
+				// Fall back if a stream dies before anything reaches the client,
+				// or a response reports an error in its body
+				if resp.StatusCode < 300 {
+					if isStreaming {
+						err = awaitFirstEvent(
+							resp,
+							state.retry.StreamBufferBytes,
+							model.firstEventTimeout(time.Since(attemptStart)),
+						)
+					} else if err = checkContentError(
+						resp,
+						provider.contentErrorMatchers(model.Type),
+					); err != nil {
+						_ = resp.Body.Close()
+						contentErrorsCounter.Inc("provider", model.Provider)
+					} else if err = assertErr; err != nil {
+						_ = resp.Body.Close()
+					}
+					if err != nil {
+						// A model failing assertions answered; it is not unhealthy
+						failedAssertions := errors.Is(err, errAssertionFailed)
+						if !failedAssertions {
+							t.logBodyFailure(logAttempts, model, err)
+							modelHealth.recordFailure(model.ID, 0, err.Error())
+						}
+						lastErr = err
+						fail(model, resp.StatusCode, "", err, time.Since(attemptStart))
+
+						// Remaining attempts of this model are skipped on failed assertions
+						lastAttempt := attempt
+						if failedAssertions {
+							lastAttempt = model.Attempts - 1
+						}
+
+						// Wait before next attempt
+						if t.shouldWait(
+							cycle,
+							modelIdx,
+							lastAttempt,
+							len(models),
+							model.Attempts,
+							maxCycles,
+						) {
+							t.wait(waitCtx, interval, totalAttempts, exponentialBackoff, 0)
+						}
+						if failedAssertions {
+							break
+						}
+						continue
+					}
+				}
+
+				t.logResponse(logAttempts, model, resp, isStreaming, true)
+				modelHealth.recordSuccess(model.ID, resp.StatusCode, time.Since(attemptStart))
+				observeAttempt(ctx, model, resp.StatusCode, "", nil, time.Since(attemptStart), true)
+				if state.listener.Name != "" {
+					fallbackDepths.record(state.listener.Name, depth)
+				}
+				if isStreaming && resp.StatusCode < 300 {
+					dropHeartbeats(ctx, resp, state.listener.StreamHeartbeats)
+					t.repairStream(ctx, req, body, resp, state.listener.StreamRepair)
+					paceStream(ctx, resp, state.listener.StreamPacing)
+				}
+				if !isStreaming {
+					t.continueTruncated(ctx, req, body, resp, state.listener.AutoContinue)
+				}
+				if resp.StatusCode >= 400 {
+					t.handleErrorResponse(resp, model)
+				}
+				if isModelListRequest(req) {
+					markUnavailableModels(resp, state, state.listener.UnavailableModels)
+				}
+
+				setRateLimitHeaders(resp, state)
+				setMetadataHeaders(resp, state, model, totalAttempts, cycle+1)
+				recordAccess(ctx, model, totalAttempts, time.Since(attemptStart), isStreaming)
+				return resp, nil
+			}
+
+			// Every attempt of the model failed or was skipped
+			if n := len(failures); n > 0 && (modelIdx+1 < len(models) || cycle+1 < maxCycles) {
+				failoverEvents.add(FailoverEvent{
+					Kind:     EventFallback,
+					Listener: state.listener.Name,
+					Provider: model.Provider,
+					Model:    model.ID,
+					Cause:    failures[n-1].cause(),
+				})
+			}
+		}
+	}
+
+	if lastResp != nil && logAttempts == logAttemptsFinal {
+		t.logResponse(logAttempts, lastModel, lastResp, isStreaming, true)
+	}
+	if mode := state.listener.ErrorDetail; mode != "" && mode != errorDetailOff &&
+		len(failures) > 0 {
+		resp = failedAttemptsResponse(req, state.listener, failures, lastErr)
+		setRateLimitHeaders(resp, state)
+		recordAccess(ctx, lastModel, totalAttempts, lastUpstream, isStreaming)
+		return resp, nil
+	}
+	if lastResp != nil {
+		setRateLimitHeaders(lastResp, state)
+		setMetadataHeaders(lastResp, state, lastModel, totalAttempts, lastCycle)
+		recordAccess(ctx, lastModel, totalAttempts, lastUpstream, isStreaming)
+		return lastResp, nil
+	}
+	recordAccess(ctx, Model{}, totalAttempts, 0, isStreaming)
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errors.New("all attempts exhausted")
+}
+
+// exhaustBudget logs and counts a request running out of retry budget, and
+// returns the error to report when no upstream response is kept.
+func (t *RetryTransport) exhaustBudget(
+	ctx context.Context,
+	state *transportState,
+	attempts int,
+	lastErr error,
+) error {
+	t.logger.Info(
+		"retry budget exhausted",
+		"listener",
+		state.listener.Name,
+		"total_timeout",
+		state.retry.TotalTimeout,
+		"attempts",
+		attempts,
+		"request_id",
+		requestID(ctx),
+	)
+	retryBudgetCounter.Inc("listener", state.listener.Name)
+	err := fmt.Errorf(
+		"retry budget of %s exhausted after %d attempts",
+		state.retry.TotalTimeout,
+		attempts,
+	)
+	if lastErr != nil {
+		return fmt.Errorf("%w: %w", err, lastErr)
+	}
+	return err
+}
+
+// logResponse logs an upstream response at info level if the listener's
+// log_attempts mode includes it.
+func (t *RetryTransport) logResponse(
+	mode string,
+	model Model,
+	resp *http.Response,
+	isStreaming bool,
+	final bool,
+) {
+	if !logsAttempt(mode, resp.StatusCode >= 400, final) {
+		return
+	}
+	t.logger.Info(
+		"response",
+		"provider",
+		model.Provider,
+		"model",
+		model.Model,
+		"status",
+		resp.StatusCode,
+		"streaming",
+		isStreaming,
+	)
+}
+
+// logBodyFailure logs a stream that failed before its first event, or a
+// response whose body reported an error.
+func (t *RetryTransport) logBodyFailure(mode string, model Model, err error) {
+	if !logsAttempt(mode, true, false) {
+		return
+	}
+	msg := "stream failed before first event"
+	if errors.Is(err, errContentError) {
+		msg = "response body reported an error"
+	}
+	t.logger.Info(
+		msg,
+		"provider",
+		model.Provider,
+		"model",
+		model.Model,
+		"error",
+		err,
+	)
+}
+
+// repairStream wraps a server-sent event stream so that an early end is
+// reported to the client or continued, as set by the listener's stream_repair.
+func (t *RetryTransport) repairStream(
+	ctx context.Context,
+	req *http.Request,
+	body []byte,
+	resp *http.Response,
+	mode string,
+) {
+	// A continuation is repaired by the stream it continues
+	if mode == "" || mode == streamRepairOff || ctx.Value(continuationContextKey{}) != nil ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+
+	resume := func(partial string) (io.ReadCloser, error) {
+		contBody, err := continuationBody(body, partial)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build continuation: %w", err)
+		}
+		t.logger.Info("continuing interrupted stream", "path", req.URL.Path, "chars", len(partial))
+
+		contReq := req.Clone(context.WithValue(ctx, continuationContextKey{}, true))
+		contReq.Body = io.NopCloser(bytes.NewReader(contBody))
+		contReq.ContentLength = int64(len(contBody))
+		contResp, err := t.RoundTrip(contReq)
+		if err != nil {
+			return nil, err
+		}
+		if contResp.StatusCode != http.StatusOK {
+			_ = contResp.Body.Close()
+			return nil, fmt.Errorf("continuation failed with status %d", contResp.StatusCode)
+		}
+		return contResp.Body, nil
+	}
+	resp.Body = newStreamRepairer(resp.Body, mode, resume)
+}
+
+// shouldWait determines if we should wait before the next attempt.
+func (t *RetryTransport) shouldWait(
+	cycle, modelIdx, attempt, numModels, modelAttempts, maxCycles int,
+) bool {
+	// Don't wait if this is the last attempt of the last model in the last cycle
+	if cycle == maxCycles-1 && modelIdx == numModels-1 && attempt == modelAttempts-1 {
+		return false
+	}
+	return true
+}
+
+// nextProvider returns the provider of the attempt after the given attempt of
+// models[modelIdx]: the same model while it has attempts left, then the next
+// model, wrapping around to the first for the next cycle.
+func nextProvider(models []Model, modelIdx, attempt int) string {
+	if attempt+1 < models[modelIdx].Attempts {
+		return models[modelIdx].Provider
+	}
+	return models[(modelIdx+1)%len(models)].Provider
+}
+
+// wait pauses execution with optional exponential backoff.
+// A positive retryAfter, as requested by the upstream, replaces the computed duration.
+func (t *RetryTransport) wait(
+	ctx context.Context,
+	interval time.Duration,
+	totalAttempts int,
+	exponentialBackoff bool,
+	retryAfter time.Duration,
+) {
+	waitDuration := interval
+	if exponentialBackoff {
+		waitDuration = interval * time.Duration(totalAttempts)
+	}
+	if retryAfter > 0 {
+		waitDuration = retryAfter
+	}
+
+	t.logger.Debug(
+		"waiting before retry",
+		"duration",
+		waitDuration,
+		"exponential",
+		exponentialBackoff,
+		"retry_after",
+		retryAfter > 0,
+	)
+	select {
+	case <-ctx.Done():
+	case <-time.After(waitDuration):
+	}
+}
+
+// tryModel attempts to send a request through a specific model provider.
+func (t *RetryTransport) tryModel(
+	ctx context.Context,
+	originalReq *http.Request,
+	body []byte,
+	model Model,
+	isStreaming bool,
+	debugEnabled bool,
+	state *transportState,
+) (*http.Response, error) {
+	provider, ok := state.providers[model.Provider]
+	if !ok {
+		return nil, fmt.Errorf("provider %q not found", model.Provider)
+	}
+	if size := provider.EmbeddingBatchSize; size > 0 && isEmbeddingRequest(originalReq) {
+		batches, err := embeddingBatches(body, size)
+		if err != nil {
+			return nil, err
+		}
+		if len(batches) > 1 {
+			return t.tryEmbeddingBatches(
+				ctx,
+				originalReq,
+				batches,
+				size,
+				model,
+				debugEnabled,
+				state,
+			)
+		}
+	}
+
+	translate := needsTranslation(originalReq.URL.Path, model.Type)
+	newReq, newBody, err := t.attemptRequest(
+		ctx,
+		originalReq,
+		body,
+		model,
+		provider,
+		isStreaming,
+		state,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if debugEnabled {
+		t.logger.Debug("request body", "body", formatBodyForLog(newBody))
+		t.logger.Debug("request url", "url", newReq.URL.String())
+	}
+
+	// Set authorization headers
+	if err := t.setAuthHeaders(newReq, model.Type, provider); err != nil {
+		return nil, err
+	}
+	if model.Type == "anthropic" {
+		setAnthropicHeaders(newReq, model, provider)
+	}
+
+	// Set context with timeout (skip for streaming to avoid mid-stream cancellation)
+	if !isStreaming {
+		reqCtx, cancel := context.WithTimeout(ctx, model.Timeout)
+		defer cancel()
+		newReq = newReq.WithContext(reqCtx)
+	}
+	// The first byte timeout bounds the time until the response, not its body
+	var endFirstByte func(*http.Response, error) (*http.Response, error)
+	if model.FirstByteTimeout > 0 {
+		newReq, endFirstByte = withFirstByteTimeout(newReq, model.FirstByteTimeout)
+	}
+
+	traceCtx, timings := withAttemptTrace(newReq.Context())
+	newReq = newReq.WithContext(traceCtx)
+
+	resp, err := t.clientFor(provider).Do(newReq)
+	t.recordTimings(model, timings)
+	if endFirstByte != nil {
+		resp, err = endFirstByte(resp, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	providerQuotas.observe(model.Provider, resp.Header)
+	if translate && model.Type == "bedrock" && isStreaming && resp.StatusCode < 400 {
+		resp.Body = newBedrockStreamBody(resp.Body)
+	}
+	source := usageSource{
+		RequestID: requestID(ctx),
+		Listener:  state.listener.Name,
+		Variant:   experimentVariant(ctx),
+	}
+	if isTokenCountRequest(originalReq) {
+		// The input_tokens of a count are no usage
+		return resp, nil
+	}
+	resp.Body = newUsageReader(resp.Body, func(usage tokenUsage) {
+		if provider.RateLimit.TokensPerMinute > 0 {
+			providerLimits.consume(model.Provider, provider.RateLimit, usage.total(), time.Now())
+		}
+		modelUsage.record(model, usage, source)
+		if key := apiKeyName(ctx); key != "" {
+			keyQuotas.consume(
+				source.Listener,
+				key,
+				usage.total(),
+				model.Price.cost(usage),
+				time.Now(),
+			)
+		}
+	})
+	if translate {
+		translateChatResponse(resp, model, isStreaming, isStreaming && streamIncludesUsage(body))
+	}
+	if isOutputPath(originalReq.URL.Path) {
+		shapeOutput(resp, model.Output, isStreaming)
+	}
+	return resp, nil
+}
+
+// attemptRequest builds the upstream request of an attempt at a model: the
+// body rewritten for the model, the target URL, and the headers after header
+// policies. Credentials are not set yet.
+func (t *RetryTransport) attemptRequest(
+	ctx context.Context,
+	originalReq *http.Request,
+	body []byte,
+	model Model,
+	provider Provider,
+	isStreaming bool,
+	state *transportState,
+) (*http.Request, []byte, error) {
+	translate := needsTranslation(originalReq.URL.Path, model.Type)
+	if model.Tools.Mode == toolPolicyStrip {
+		var removed []string
+		var err error
+		if body, removed, err = model.Tools.filter(body); err != nil {
+			return nil, nil, fmt.Errorf("failed to strip tools: %w", err)
+		}
+		if len(removed) > 0 {
+			toolPolicyCounter.Inc("model", model.ID, "action", "stripped")
+		}
+	}
+	if len(model.Stop) > 0 && isOutputPath(originalReq.URL.Path) {
+		var err error
+		if body, err = withStopSequences(body, model, translate); err != nil {
+			return nil, nil, fmt.Errorf("failed to add stop sequences: %w", err)
+		}
+	}
+
+	// Modify body with model override
+	var newBody []byte
+	var err error
+	if translate {
+		newBody, err = translateChatRequest(body, model)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to translate request: %w", err)
+		}
+	} else if model.Type == "template" {
+		newBody, err = renderTemplateBody(model.ParsedTemplate, body, model.Model)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if model.Type == "gemini" || model.Type == "bedrock" {
+		// Native Gemini and Bedrock requests name the model in the path
+		newBody = body
+	} else {
+		newBody, err = setModel(body, model.Model)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set model: %w", err)
+		}
+		if model.Type == "ollama" {
+			if newBody, err = withOllamaOptions(newBody, model); err != nil {
+				return nil, nil, fmt.Errorf("failed to set ollama options: %w", err)
+			}
+		}
+	}
+
+	if len(model.Params) > 0 && !isTokenCountRequest(originalReq) {
+		if newBody, err = withModelParams(newBody, model.Params); err != nil {
+			return nil, nil, fmt.Errorf("failed to set model params: %w", err)
+		}
+	}
+
+	// Clone request
+	newReq := originalReq.Clone(ctx)
+	newReq.Body = io.NopCloser(bytes.NewReader(newBody))
+	newReq.ContentLength = int64(len(newBody))
+	newReq.RequestURI = "" // Must be empty for client requests
+	newReq.Header.Del(priorityHeader)
+	applyHeaderPolicies(newReq.Header, state.listener.Headers, provider.Headers)
+
+	// Build target URL
+	t.buildTargetURL(newReq, originalReq, provider)
+	if translate {
+		newReq.URL.Path = translatedPath(
+			newReq.URL.Path,
+			model,
+			provider.ParsedURL.Path,
+			isStreaming,
+		)
+		newReq.URL.RawPath = ""
+		prepareTranslatedHeaders(newReq, model.Type)
+		if model.Type == "gemini" && isStreaming {
+			newReq.URL.RawQuery = "alt=sse"
+		}
+	} else if model.Type == "gemini" {
+		newReq.URL.Path = geminiModelPath(newReq.URL.Path, model.Model)
+		newReq.URL.RawPath = ""
+	} else if model.Type == "bedrock" {
+		newReq.URL.Path = bedrockModelPath(newReq.URL.Path, model.Model)
+		newReq.URL.RawPath = ""
+	}
+	return newReq, newBody, nil
+}
+
+// buildTargetURL constructs the target URL for the upstream request.
+func (t *RetryTransport) buildTargetURL(
+	newReq *http.Request,
+	originalReq *http.Request,
+	provider Provider,
+) {
+	targetURL := provider.ParsedURL
+	reqPath := originalReq.URL.Path
+
+	if provider.StripVersionPrefix {
+		reqPath = versionPrefixRegex.ReplaceAllString(reqPath, "")
+	}
+
+	// Normalize paths to avoid double slashes
+	// Remove all trailing slashes from the base path
+	basePath := strings.TrimRight(targetURL.Path, "/")
+
+	urlCopy := *originalReq.URL
+	newReq.URL = &urlCopy
+	newReq.URL.Scheme = targetURL.Scheme
+	newReq.URL.Host = targetURL.Host
+	newReq.URL.Path = basePath + reqPath
+	newReq.Host = cmp.Or(provider.HostHeader, targetURL.Host)
+}
+
+// setAuthHeaders configures authorization headers based on provider type.
+func (t *RetryTransport) setAuthHeaders(
+	req *http.Request,
+	modelType string,
+	provider Provider,
+) error {
+	// Before signing, since HMAC signatures cover the query
+	setAPIVersion(req, modelType, provider)
+
+	if provider.Auth == authAmbient {
+		if err := setAmbientAuth(req, modelType, provider); err != nil {
+			return err
+		}
+	} else if err := t.setKeyAuth(req, modelType, provider); err != nil {
+		return err
+	}
+
+	// Internal gateways may authenticate signed requests instead of keys
+	if provider.Signing.Key != "" {
+		return signHMACRequest(req, provider.Signing, time.Now())
+	}
+	return nil
+}
+
+// setKeyAuth sets the configured API key or credentials of the model type.
+func (t *RetryTransport) setKeyAuth(req *http.Request, modelType string, provider Provider) error {
+	apiKey := provider.GetAPIKey()
+
+	switch modelType {
+	case "anthropic":
+		if apiKey == "-" {
+			req.Header.Del("x-api-key")
+		} else if apiKey != "" {
+			req.Header.Set("x-api-key", apiKey)
+		}
+		req.Header.Set("anthropic-version", provider.anthropicVersion())
+	case "bedrock":
+		t.signAWSRequest(req, provider)
+	case "gemini":
+		if path := provider.GetGoogleCredentialsFile(); path != "" {
+			source, err := googleTokenSourceFor(path)
+			if err != nil {
+				return err
+			}
+			token, err := source.Token(req.Context())
+			if err != nil {
+				return err
+			}
+			req.Header.Del("x-goog-api-key")
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if apiKey == "-" {
+			req.Header.Del("x-goog-api-key")
+		} else if apiKey != "" {
+			req.Header.Set("x-goog-api-key", apiKey)
+		}
+	default: // openai, ollama, template
+		if apiKey == "-" {
+			req.Header.Del("Authorization")
+		} else if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+	}
+	return nil
+}
+
+// handleRetryableResponse logs and closes a retryable response.
+// It returns the delay requested by the Retry-After header of a rate limit or
+// overload error, else by its error message, or zero, and marks the provider
+// saturated for that long. A provider reporting an exhausted quota is marked
+// saturated for at least quotaExhaustedCooldown.
+func (t *RetryTransport) handleRetryableResponse(
+	resp *http.Response,
+	provider string,
+	failure upstreamFailure,
+) time.Duration {
+	now := time.Now()
+	retryAfter := failure.RetryAfter
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusServiceUnavailable ||
+		failure.Class == errorClassRateLimited || failure.Class == errorClassOverloaded {
+		if d := parseRetryAfter(resp.Header.Get("Retry-After"), now); d > 0 {
+			retryAfter = d
+		}
+	}
+	cooldown := retryAfter
+	if failure.Class == errorClassQuotaExhausted {
+		cooldown = max(cooldown, quotaExhaustedCooldown)
+	}
+	if cooldown > 0 {
+		providerQuotas.saturate(provider, now.Add(cooldown))
+		failoverEvents.add(FailoverEvent{
+			Time:      now,
+			Kind:      EventSaturated,
+			Provider:  provider,
+			Cause:     cmp.Or(failure.Class, "status "+strconv.Itoa(resp.StatusCode)),
+			SkippedMS: cooldown.Milliseconds(),
+		})
+	}
+
+	if t.logConfig.IncludeErrorBody {
+		errBody, err := readErrorBody(resp)
+		if err != nil {
+			t.logger.Warn("failed to read error body", "error", err)
+		}
+		_ = resp.Body.Close()
+		t.logger.Info(
+			"retryable status",
+			"provider",
+			provider,
+			"status",
+			resp.StatusCode,
+			"class",
+			failure.Class,
+			"error",
+			string(errBody),
+		)
+	} else {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		t.logger.Info(
+			"retryable status",
+			"provider",
+			provider,
+			"status",
+			resp.StatusCode,
+			"class",
+			failure.Class,
+		)
+		_ = resp.Body.Close()
+	}
+	return retryAfter
+}
+
+// handleErrorResponse logs error response details.
+func (t *RetryTransport) handleErrorResponse(resp *http.Response, model Model) {
+	if t.logConfig.IncludeErrorBody {
+		errBody, err := readErrorBody(resp)
+		if err != nil {
+			t.logger.Warn("failed to read error body", "error", err)
+		}
+		_ = resp.Body.Close()
+		t.logger.Info(
+			"error status",
+			"provider",
+			model.Provider,
+			"model",
+			model.Model,
+			"status",
+			resp.StatusCode,
+			"error",
+			string(errBody),
+		)
+		resp.Body = io.NopCloser(bytes.NewReader(errBody))
+	} else {
+		t.logger.Info(
+			"error status",
+			"provider",
+			model.Provider,
+			"model",
+			model.Model,
+			"status",
+			resp.StatusCode,
+		)
+	}
+}
+
+// parseRetryAfter parses a Retry-After value given either as delay seconds or
+// as an HTTP date. It returns zero for missing, invalid, or past values.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// isRetryable returns true if the status code indicates a retryable error.
+func isRetryable(statusCode int) bool {
+	return statusCode >= 500 || statusCode == 429
+}
+
+// signAWSRequest signs the request with AWS SigV4 for Bedrock, using the
+// provider's static keys or the AWS default credential chain. Without any
+// credentials the request is sent unsigned.
+func (t *RetryTransport) signAWSRequest(req *http.Request, provider Provider) {
+	creds, region, err := awsCredentials.retrieve(req.Context(), provider)
+	if err != nil {
+		t.logger.Warn("sending bedrock request unsigned", "error", err)
+		return
+	}
+	if err := signBedrockRequest(req, creds, region); err != nil {
+		t.logger.Warn("failed to sign AWS request", "error", err)
+	}
+}
+
+// signBedrockRequest signs the request with AWS SigV4 for Bedrock. The body is
+// read for signing and restored.
+func signBedrockRequest(req *http.Request, creds aws.Credentials, region string) error {
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Read body for signing
+	var bodyBytes []byte
+	if req.Body != nil {
+		var err error
+		bodyBytes, err = io.ReadAll(req.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	}
+
+	hash := sha256.Sum256(bodyBytes)
+	payloadHash := hex.EncodeToString(hash[:])
+	return v4.NewSigner().
+		SignHTTP(req.Context(), creds, req, payloadHash, "bedrock", region, time.Now())
+}
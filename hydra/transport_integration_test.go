@@ -0,0 +1,1105 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+func mustParseURL(raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestTransport_RoundTrip_Success(t *testing.T) {
+	var requestCount int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{"test":1}`)),
+	)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	if atomic.LoadInt32(&requestCount) != 1 {
+		t.Errorf("expected 1 request, got %d", requestCount)
+	}
+}
+
+func TestTransport_RoundTrip_Retry(t *testing.T) {
+	var requestCount int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("rate limited"))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{"test":1}`)),
+	)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 Too Many Requests, got %d", resp.StatusCode)
+	}
+
+	// Since 429 is retryable and MaxCycles=1, Attempts=2, it should attempt 2 times
+	if atomic.LoadInt32(&requestCount) != 2 {
+		t.Errorf("expected 2 requests, got %d", requestCount)
+	}
+}
+
+func TestTransport_RoundTrip_MultiCycle(t *testing.T) {
+	var requestCount int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       2,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{}`)),
+	)
+
+	_, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// MaxCycles=2, Attempts=2, so total attempts = 2 * 2 = 4
+	if atomic.LoadInt32(&requestCount) != 4 {
+		t.Errorf("expected 4 requests, got %d", requestCount)
+	}
+}
+
+func TestTransport_RoundTrip_Fallback(t *testing.T) {
+	var requestCount1 int32
+	var requestCount2 int32
+
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount1, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts1.Close()
+
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount2, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts2.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock1",
+			Model:    "test-model-1",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+		{
+			ID:       "m2",
+			Provider: "mock2",
+			Model:    "test-model-2",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock1": {URL: ts1.URL, ParsedURL: mustParseURL(ts1.URL)},
+		"mock2": {URL: ts2.URL, ParsedURL: mustParseURL(ts2.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "http://original/path", nil)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	if atomic.LoadInt32(&requestCount1) != 1 {
+		t.Errorf("expected 1 request to ts1, got %d", requestCount1)
+	}
+	if atomic.LoadInt32(&requestCount2) != 1 {
+		t.Errorf("expected 1 request to ts2, got %d", requestCount2)
+	}
+}
+
+func TestTransport_RoundTrip_Cancellation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "POST", "http://original/path", nil)
+
+	// Cancel after a short delay to simulate real cancellation scenario
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := transport.RoundTrip(req)
+	if err == nil {
+		t.Fatalf("expected error due to context cancellation")
+	}
+}
+
+func TestTransport_RoundTrip_Timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  50 * time.Millisecond,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "http://original/path", nil)
+
+	start := time.Now()
+	_, err := transport.RoundTrip(req)
+	duration := time.Since(start)
+
+	if err == nil {
+		t.Fatalf("expected error due to timeout")
+	}
+	if duration > 100*time.Millisecond {
+		t.Errorf("request took too long: %v, expected timeout around 50ms", duration)
+	}
+}
+
+func TestTransport_RoundTrip_EmptyBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	// Request with nil body
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "http://original/path", nil)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", resp.StatusCode)
+	}
+}
+
+func TestTransport_RoundTrip_AllAttemptsExhausted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{}`)),
+	)
+
+	// 500 is retryable, so all attempts will be exhausted and return the last 500 response
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", resp.StatusCode)
+	}
+}
+
+func TestTransport_RoundTrip_ConnectionError(t *testing.T) {
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		// Invalid port that won't connect
+		"mock": {URL: "http://127.0.0.1:1", ParsedURL: mustParseURL("http://127.0.0.1:1")},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{}`)),
+	)
+
+	_, err := transport.RoundTrip(req)
+	if err == nil {
+		t.Fatalf("expected connection error")
+	}
+}
+
+func TestTransport_RoundTrip_RetryAfterCapped(t *testing.T) {
+	var requestCount int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requestCount, 1) == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "retry-after-mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"retry-after-mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+		MaxRetryAfter:   50 * time.Millisecond,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{"test":1}`)),
+	)
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	// The 30s Retry-After is capped by max_retry_after
+	if elapsed < 45*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("expected wait capped at 50ms, took %v", elapsed)
+	}
+}
+
+func TestTransport_RoundTrip_RetryAfterFallback(t *testing.T) {
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "retry-after-limited",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+		{
+			ID:       "m2",
+			Provider: "retry-after-healthy",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"retry-after-limited": {URL: limited.URL, ParsedURL: mustParseURL(limited.URL)},
+		"retry-after-healthy": {URL: healthy.URL, ParsedURL: mustParseURL(healthy.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       1,
+		DefaultInterval: time.Millisecond,
+		DefaultTimeout:  time.Second,
+		MaxRetryAfter:   time.Minute,
+	}
+
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{"test":1}`)),
+	)
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", resp.StatusCode)
+	}
+
+	// The 30s Retry-After of the first provider does not delay the second
+	if elapsed > 5*time.Second {
+		t.Errorf("expected the fallback without the Retry-After wait, took %v", elapsed)
+	}
+}
+
+func TestTransport_RoundTrip_TotalTimeout(t *testing.T) {
+	var requestCount int32
+	var hang atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		_, _ = io.ReadAll(r.Body)
+		if hang.Load() {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "budget-mock",
+			Model:    "test-model",
+			Type:     "openai",
+			Attempts: 3,
+			Timeout:  5 * time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"budget-mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{
+		MaxCycles:       10,
+		DefaultInterval: 40 * time.Millisecond,
+		DefaultTimeout:  time.Second,
+		TotalTimeout:    100 * time.Millisecond,
+	}
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	send := func() (*http.Response, time.Duration, error) {
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original/path",
+			bytes.NewReader([]byte(`{"test":1}`)),
+		)
+		start := time.Now()
+		resp, err := transport.RoundTrip(req)
+		return resp, time.Since(start), err
+	}
+
+	// Failing responses stop being retried once the budget is spent
+	resp, elapsed, err := send()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected the last 500 response, got %d", resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(&requestCount); n < 2 || n > 4 {
+		t.Errorf("expected 2 to 4 attempts within the budget, got %d", n)
+	}
+	if elapsed > time.Second {
+		t.Errorf("expected the budget to bound the request, took %v", elapsed)
+	}
+
+	// A hanging attempt is cut off at the end of the budget
+	hang.Store(true)
+	_, elapsed, err = send()
+	if err == nil || !strings.Contains(err.Error(), "retry budget of 100ms exhausted") {
+		t.Errorf("expected retry budget error, got %v", err)
+	}
+	if elapsed > time.Second {
+		t.Errorf("expected the budget to cut off the attempt, took %v", elapsed)
+	}
+}
+
+func TestTransport_RoundTrip_RoundRobin(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.Model)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{ID: "m1", Provider: "mock", Model: "first", Type: "openai", Attempts: 1, Timeout: time.Second},
+		{ID: "m2", Provider: "mock", Model: "second", Type: "openai", Attempts: 1, Timeout: time.Second},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	l := &Listener{Strategy: strategyRoundRobin, ResolvedModels: models}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	for range 3 {
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original/path",
+			bytes.NewReader([]byte(`{"model":"client"}`)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if want := []string{"first", "second", "first"}; !slices.Equal(seen, want) {
+		t.Errorf("expected upstream models %v, got %v", want, seen)
+	}
+}
+
+func TestTransport_RoundTrip_Routes(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		seen = append(seen, body.Model)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	large := Model{
+		ID:       "large",
+		Provider: "mock",
+		Model:    "upstream-large",
+		Type:     "openai",
+		Attempts: 1,
+		Timeout:  time.Second,
+	}
+	small := large
+	small.ID, small.Model = "small", "upstream-small"
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultTimeout: time.Second}
+	l := &Listener{
+		ResolvedModels: []Model{large},
+		ResolvedRoutes: map[string][]Model{"gpt-4o-mini": {small}},
+	}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	for _, requested := range []string{"gpt-4o", "gpt-4o-mini"} {
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original/path",
+			bytes.NewReader([]byte(`{"model":"`+requested+`"}`)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if want := []string{"upstream-large", "upstream-small"}; !slices.Equal(seen, want) {
+		t.Errorf("expected upstream models %v, got %v", want, seen)
+	}
+}
+
+func TestTransport_RoundTrip_LogAttempts(t *testing.T) {
+	tests := []struct {
+		mode      string
+		responses int
+	}{
+		{logAttemptsAll, 3},
+		{logAttemptsFailures, 2},
+		{logAttemptsFinal, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var requestCount int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requestCount, 1) < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+
+			models := []Model{
+				{
+					ID:       "m1",
+					Provider: "mock",
+					Model:    "m",
+					Type:     "openai",
+					Attempts: 3,
+					Timeout:  time.Second,
+				},
+			}
+			providers := map[string]Provider{
+				"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+			}
+			retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+			var logs bytes.Buffer
+			l := &Listener{LogAttempts: tt.mode, ResolvedModels: models}
+			transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(&logs))
+
+			req, _ := http.NewRequestWithContext(
+				context.Background(),
+				"POST",
+				"http://original/path",
+				bytes.NewReader([]byte(`{}`)),
+			)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if got := strings.Count(logs.String(), "response"); got != tt.responses {
+				t.Errorf("expected %d response lines, got %d:\n%s", tt.responses, got, logs.String())
+			}
+		})
+	}
+}
+
+func TestTransport_RoundTrip_LogAttemptsFinalExhausted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "m",
+			Type:     "openai",
+			Attempts: 3,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	var logs bytes.Buffer
+	l := &Listener{LogAttempts: logAttemptsFinal, ResolvedModels: models}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(&logs))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if got := strings.Count(logs.String(), "response"); got != 1 {
+		t.Errorf("expected 1 response line, got %d:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "status=503") {
+		t.Errorf("expected final status to be logged:\n%s", logs.String())
+	}
+}
+
+func TestTransport_RoundTrip_FallbackOnInsufficientQuota(t *testing.T) {
+	var exhaustedCount, backupCount int32
+
+	exhausted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&exhaustedCount, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"type":"insufficient_quota","code":"insufficient_quota"}}`))
+	}))
+	defer exhausted.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupCount, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "exhausted",
+			Model:    "a",
+			Type:     "openai",
+			Attempts: 3,
+			Timeout:  time.Second,
+		},
+		{
+			ID:       "m2",
+			Provider: "backup",
+			Model:    "b",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"exhausted": {URL: exhausted.URL, ParsedURL: mustParseURL(exhausted.URL)},
+		"backup":    {URL: backup.URL, ParsedURL: mustParseURL(backup.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/path",
+		bytes.NewReader([]byte(`{}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 OK, got %d", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(&exhaustedCount); got != 1 {
+		t.Errorf("expected the exhausted model to be tried once, got %d", got)
+	}
+	if got := atomic.LoadInt32(&backupCount); got != 1 {
+		t.Errorf("expected the backup model to be tried once, got %d", got)
+	}
+}
+
+func TestTransport_RoundTrip_StreamRepairContinue(t *testing.T) {
+	var requestCount int32
+	var continuation []byte
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if atomic.AddInt32(&requestCount, 1) == 1 {
+			// Ends without a finish reason
+			_, _ = w.Write([]byte(`data: {"choices":[{"delta":{"content":"Hel"}}]}` + "\n\n"))
+			return
+		}
+		continuation, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`data: {"choices":[{"delta":{"content":"lo"}}]}` + "\n\n"))
+		_, _ = w.Write([]byte(`data: {"choices":[{"delta":{},"finish_reason":"stop"}]}` + "\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "m",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	l := &Listener{StreamRepair: streamRepairContinue, ResolvedModels: models}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if got := atomic.LoadInt32(&requestCount); got != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", got)
+	}
+	if !strings.Contains(string(continuation), `{"content":"Hel","role":"assistant"}`) {
+		t.Errorf("expected continuation to carry the partial output, got %s", continuation)
+	}
+	if !strings.Contains(string(out), `"lo"`) || !strings.HasSuffix(string(out), "data: [DONE]\n\n") {
+		t.Errorf("expected continued stream, got %q", out)
+	}
+}
+
+func TestTransport_RoundTrip_RateLimitSkipsProvider(t *testing.T) {
+	var limitedCount, backupCount int32
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&limitedCount, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer limited.Close()
+
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupCount, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backup.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "ratelimit-test",
+			Model:    "a",
+			Type:     "openai",
+			Attempts: 2,
+			Timeout:  time.Second,
+		},
+		{
+			ID:       "m2",
+			Provider: "backup",
+			Model:    "b",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"ratelimit-test": {
+			URL:       limited.URL,
+			ParsedURL: mustParseURL(limited.URL),
+			RateLimit: RateLimit{RequestsPerMinute: 1},
+		},
+		"backup": {URL: backup.URL, ParsedURL: mustParseURL(backup.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	transport := NewRetryTransport(models, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	for range 2 {
+		req, _ := http.NewRequestWithContext(
+			context.Background(),
+			"POST",
+			"http://original/path",
+			bytes.NewReader([]byte(`{}`)),
+		)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if got := atomic.LoadInt32(&limitedCount); got != 1 {
+		t.Errorf("expected the limited provider to receive 1 request, got %d", got)
+	}
+	if got := atomic.LoadInt32(&backupCount); got != 1 {
+		t.Errorf("expected the second request to go to the backup, got %d", got)
+	}
+}
+
+func TestTransport_RoundTrip_AutoContinue(t *testing.T) {
+	var requestCount int32
+	var continuation []byte
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&requestCount, 1) == 1 {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hel"},` +
+				`"finish_reason":"length"}],"usage":{"prompt_tokens":5,"completion_tokens":2}}`))
+			return
+		}
+		continuation, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"lo"},` +
+			`"finish_reason":"stop"}],"usage":{"prompt_tokens":7,"completion_tokens":1}}`))
+	}))
+	defer ts.Close()
+
+	models := []Model{
+		{
+			ID:       "m1",
+			Provider: "mock",
+			Model:    "m",
+			Type:     "openai",
+			Attempts: 1,
+			Timeout:  time.Second,
+		},
+	}
+	providers := map[string]Provider{
+		"mock": {URL: ts.URL, ParsedURL: mustParseURL(ts.URL)},
+	}
+	retry := RetryConfig{MaxCycles: 1, DefaultInterval: time.Millisecond}
+	l := &Listener{
+		AutoContinue:   AutoContinueConfig{MaxContinuations: 2},
+		ResolvedModels: models,
+	}
+	transport := newListenerTransport(l, providers, retry, LogConfig{}, log.New(io.Discard))
+
+	req, _ := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		"http://original/v1/chat/completions",
+		bytes.NewReader([]byte(`{"messages":[{"role":"user","content":"hi"}]}`)),
+	)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if got := atomic.LoadInt32(&requestCount); got != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", got)
+	}
+	if !strings.Contains(string(continuation), `{"content":"Hel","role":"assistant"}`) {
+		t.Errorf("expected continuation to carry the partial output, got %s", continuation)
+	}
+	want := `{"choices":[{"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],` +
+		`"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`
+	if string(out) != want {
+		t.Errorf("expected %s, got %s", want, out)
+	}
+	if resp.ContentLength != int64(len(out)) {
+		t.Errorf("expected content length %d, got %d", len(out), resp.ContentLength)
+	}
+}
@@ -1,11 +1,13 @@
-package main
+package hydra
 
 import (
 	"bytes"
 	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -199,6 +201,7 @@ func TestSetAuthHeaders(t *testing.T) {
 	})
 
 	t.Run("bedrock without creds skips signing", func(t *testing.T) {
+		isolateAWS(t)
 		req, _ := http.NewRequest("POST", "/", nil)
 		provider := Provider{AWSAccessKeyID: ""}
 		transport.setAuthHeaders(req, "bedrock", provider)
@@ -207,6 +210,26 @@ func TestSetAuthHeaders(t *testing.T) {
 		}
 	})
 
+	t.Run("gemini with key", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/", nil)
+		req.Header.Set("x-goog-api-key", "client-key")
+		provider := Provider{APIKey: "gemini-key"}
+		if err := transport.setAuthHeaders(req, "gemini", provider); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if req.Header.Get("x-goog-api-key") != "gemini-key" {
+			t.Errorf("unexpected x-goog-api-key header for gemini")
+		}
+	})
+
+	t.Run("gemini with invalid credentials file", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/", nil)
+		provider := Provider{GoogleCredentialsFile: "/nonexistent/sa.json"}
+		if err := transport.setAuthHeaders(req, "gemini", provider); err == nil {
+			t.Error("expected error for unreadable credentials")
+		}
+	})
+
 	t.Run("unknown type defaults to openai behavior", func(t *testing.T) {
 		req, _ := http.NewRequest("POST", "/", nil)
 		provider := Provider{APIKey: "test-key"}
@@ -226,7 +249,7 @@ func TestWaitExitsOnContext(t *testing.T) {
 	cancel()
 
 	start := time.Now()
-	transport.wait(ctx, 10*time.Second, 1, false)
+	transport.wait(ctx, 10*time.Second, 1, false, 0)
 	duration := time.Since(start)
 
 	if duration > 100*time.Millisecond {
@@ -241,7 +264,7 @@ func TestWaitExponential(t *testing.T) {
 
 	ctx := context.Background()
 	start := time.Now()
-	transport.wait(ctx, 10*time.Millisecond, 2, true)
+	transport.wait(ctx, 10*time.Millisecond, 2, true, 0)
 	duration := time.Since(start)
 
 	// With exponential backoff: interval * totalAttempts = 10ms * 2 = 20ms
@@ -260,7 +283,7 @@ func TestWaitNonExponential(t *testing.T) {
 	ctx := context.Background()
 	interval := 10 * time.Millisecond
 	start := time.Now()
-	transport.wait(ctx, interval, 5, false)
+	transport.wait(ctx, interval, 5, false, 0)
 	duration := time.Since(start)
 
 	// Without exponential backoff, should wait exactly interval (totalAttempts is ignored)
@@ -275,6 +298,117 @@ func TestWaitNonExponential(t *testing.T) {
 	}
 }
 
+func TestWaitRetryAfter(t *testing.T) {
+	transport := &RetryTransport{
+		logger: log.New(io.Discard),
+	}
+
+	start := time.Now()
+	transport.wait(context.Background(), time.Second, 3, true, 10*time.Millisecond)
+	duration := time.Since(start)
+
+	// Retry-After replaces the 3s exponential backoff
+	if duration < 8*time.Millisecond || duration > 500*time.Millisecond {
+		t.Errorf("expected wait around 10ms, got %v", duration)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "7", 7 * time.Second},
+		{"negative seconds", "-3", 0},
+		{"http date", "Thu, 01 Jan 2026 00:00:30 GMT", 30 * time.Second},
+		{"past http date", "Wed, 31 Dec 2025 23:59:00 GMT", 0},
+		{"invalid", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRetryableResponse_RetryAfter(t *testing.T) {
+	transport := &RetryTransport{logger: log.New(io.Discard)}
+
+	resp := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": []string{"5"}},
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}
+	overloaded := upstreamFailure{Action: actionRetry, Class: errorClassOverloaded}
+	got := transport.handleRetryableResponse(resp, "retry-after-test", overloaded)
+	if got != 5*time.Second {
+		t.Errorf("expected 5s retry after, got %v", got)
+	}
+	if !providerQuotas.snapshot()["retry-after-test"].Saturated(time.Now()) {
+		t.Error("expected provider to be marked saturated")
+	}
+
+	// Retry-After is only honored on 429, 503, and rate limit or overload errors
+	resp = &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header:     http.Header{"Retry-After": []string{"5"}},
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}
+	serverError := upstreamFailure{Action: actionRetry, Class: errorClassServer}
+	if got := transport.handleRetryableResponse(resp, "retry-after-502", serverError); got != 0 {
+		t.Errorf("expected no retry after for 502, got %v", got)
+	}
+}
+
+func TestHandleRetryableResponse_ErrorClass(t *testing.T) {
+	transport := &RetryTransport{logger: log.New(io.Discard)}
+	newResp := func(status int, header http.Header) *http.Response {
+		return &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader(nil)),
+		}
+	}
+
+	// Bedrock throttles with 400, so the class decides whether Retry-After applies
+	resp := newResp(http.StatusBadRequest, http.Header{"Retry-After": []string{"3"}})
+	throttled := upstreamFailure{Action: actionRetry, Class: errorClassRateLimited}
+	got := transport.handleRetryableResponse(resp, "class-throttled", throttled)
+	if got != 3*time.Second {
+		t.Errorf("expected 3s retry after, got %v", got)
+	}
+
+	// The hint of the error message applies without a Retry-After header
+	hinted := upstreamFailure{
+		Action:     actionRetry,
+		Class:      errorClassRateLimited,
+		RetryAfter: 1500 * time.Millisecond,
+	}
+	resp = newResp(http.StatusTooManyRequests, http.Header{})
+	got = transport.handleRetryableResponse(resp, "class-hinted", hinted)
+	if got != hinted.RetryAfter {
+		t.Errorf("expected the message hint, got %v", got)
+	}
+
+	// An exhausted quota skips the provider without waiting
+	exhausted := upstreamFailure{Action: actionFallback, Class: errorClassQuotaExhausted}
+	resp = newResp(http.StatusTooManyRequests, http.Header{})
+	if got := transport.handleRetryableResponse(resp, "class-quota", exhausted); got != 0 {
+		t.Errorf("expected no wait for an exhausted quota, got %v", got)
+	}
+	q := providerQuotas.snapshot()["class-quota"]
+	if !q.Saturated(time.Now().Add(quotaExhaustedCooldown - time.Minute)) {
+		t.Errorf("expected provider to cool down for %s, got %+v", quotaExhaustedCooldown, q)
+	}
+}
+
 func TestHandleRetryableResponse(t *testing.T) {
 	t.Run("include error body", func(t *testing.T) {
 		logOutput := &bytes.Buffer{}
@@ -287,7 +421,7 @@ func TestHandleRetryableResponse(t *testing.T) {
 			Body:       io.NopCloser(bytes.NewReader([]byte("rate limited error"))),
 		}
 
-		transport.handleRetryableResponse(resp, "test-provider")
+		transport.handleRetryableResponse(resp, "test-provider", upstreamFailure{})
 		if !bytes.Contains(logOutput.Bytes(), []byte("rate limited error")) {
 			t.Errorf("expected error body in log, got: %s", logOutput.String())
 		}
@@ -304,7 +438,7 @@ func TestHandleRetryableResponse(t *testing.T) {
 			Body:       io.NopCloser(bytes.NewReader([]byte("rate limited error 2"))),
 		}
 
-		transport.handleRetryableResponse(resp, "test-provider")
+		transport.handleRetryableResponse(resp, "test-provider", upstreamFailure{})
 		if bytes.Contains(logOutput.Bytes(), []byte("rate limited error 2")) {
 			t.Errorf("did not expect error body in log")
 		}
@@ -654,7 +788,7 @@ func TestTryModelProviderNotFound(t *testing.T) {
 	providers := map[string]Provider{
 		"existing": {URL: "http://localhost"},
 	}
-	transport := newRetryTransport(
+	transport := NewRetryTransport(
 		[]Model{},
 		providers,
 		RetryConfig{},
@@ -676,8 +810,103 @@ func TestTryModelProviderNotFound(t *testing.T) {
 		model,
 		false,
 		false,
+		transport.state.Load(),
 	)
 	if err == nil {
 		t.Error("expected error for nonexistent provider")
 	}
 }
+
+func TestTryModelProxyURL(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute upstream URL
+		proxied.Store(r.URL.String())
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer proxy.Close()
+
+	providers := map[string]Provider{
+		"direct": {
+			URL:       "http://upstream.invalid/v1",
+			ParsedURL: mustParseURL("http://upstream.invalid/v1"),
+		},
+		"proxied": {
+			URL:            "http://upstream.invalid/v1",
+			ParsedURL:      mustParseURL("http://upstream.invalid/v1"),
+			ProxyURL:       proxy.URL,
+			ParsedProxyURL: mustParseURL(proxy.URL),
+		},
+	}
+	transport := NewRetryTransport(nil, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+	if transport.clientFor(providers["direct"]) != transport.client {
+		t.Error("expected providers without a proxy to share the default client")
+	}
+	if transport.clientFor(providers["proxied"]) != transport.clientFor(providers["proxied"]) {
+		t.Error("expected one client per proxy")
+	}
+
+	req, _ := http.NewRequest("POST", "http://localhost/chat/completions", nil)
+	model := Model{Provider: "proxied", Model: "m", Type: "openai", Timeout: time.Second}
+	resp, err := transport.tryModel(
+		context.Background(),
+		req,
+		[]byte(`{}`),
+		model,
+		false,
+		false,
+		transport.state.Load(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if got, _ := proxied.Load().(string); got != "http://upstream.invalid/v1/chat/completions" {
+		t.Errorf("expected the request to go through the proxy, got %q", got)
+	}
+}
+
+func TestTryModelHostHeader(t *testing.T) {
+	var gotHost atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost.Store(r.Host)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	providers := map[string]Provider{
+		"gateway": {
+			URL:        ts.URL,
+			ParsedURL:  mustParseURL(ts.URL),
+			HostHeader: "api.example.com:8443",
+		},
+	}
+	transport := NewRetryTransport(nil, providers, RetryConfig{}, LogConfig{}, log.New(io.Discard))
+	client := transport.clientFor(providers["gateway"])
+	if client == transport.client {
+		t.Fatal("expected a separate client for a provider with host_header")
+	}
+	tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+	if tlsConfig == nil || tlsConfig.ServerName != "api.example.com" {
+		t.Errorf("expected SNI api.example.com, got %+v", tlsConfig)
+	}
+
+	req, _ := http.NewRequest("POST", "http://localhost/chat/completions", nil)
+	model := Model{Provider: "gateway", Model: "m", Type: "openai", Timeout: time.Second}
+	resp, err := transport.tryModel(
+		context.Background(),
+		req,
+		[]byte(`{}`),
+		model,
+		false,
+		false,
+		transport.state.Load(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if got, _ := gotHost.Load().(string); got != "api.example.com:8443" {
+		t.Errorf("expected Host api.example.com:8443, got %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+package hydra
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// liveWindow is the number of seconds of traffic shown on the admin UI.
+const liveWindow = 60
+
+// liveErrorCapacity is the number of recent failed requests kept.
+const liveErrorCapacity = 20
+
+// liveStreamInterval is how often the admin UI stream sends a snapshot.
+const liveStreamInterval = time.Second
+
+//go:embed ui.html
+var uiPage []byte
+
+// liveRequests holds the recent traffic of all listeners for the admin UI.
+var liveRequests = &liveStats{}
+
+// LiveRequest is a completed request, kept while recent if it failed.
+type LiveRequest struct {
+	Time     time.Time `json:"time"`
+	Listener string    `json:"listener"`
+	Path     string    `json:"path"`
+	Status   int       `json:"status"`
+	Provider string    `json:"provider,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Attempts int       `json:"attempts"`
+}
+
+// LiveSnapshot is the state shown on the admin UI. Counts cover the last
+// liveWindow seconds.
+type LiveSnapshot struct {
+	Time         time.Time                 `json:"time"`
+	Throughput   []int                     `json:"throughput"` // Requests per second, oldest first
+	Requests     int                       `json:"requests"`
+	Errors       int                       `json:"errors"`    // Answered with a 4xx or 5xx status
+	Retries      int                       `json:"retries"`   // Attempts after the first
+	Fallbacks    int                       `json:"fallbacks"` // Requests moved on from a model
+	Providers    map[string]ProviderStatus `json:"providers"`
+	RecentErrors []LiveRequest             `json:"recent_errors"` // Newest first
+	Events       []FailoverEvent           `json:"events"`        // Newest first
+}
+
+// liveBucket counts the requests completed in one second.
+type liveBucket struct {
+	second   int64
+	requests int
+	errors   int
+	retries  int
+}
+
+// liveStats keeps per-second request counts for the last liveWindow seconds
+// and the most recent failed requests.
+type liveStats struct {
+	mu      sync.Mutex
+	buckets [liveWindow]liveBucket // Indexed by Unix second
+	errors  []LiveRequest          // Oldest first
+}
+
+// record counts a completed request.
+func (s *liveStats) record(e LiveRequest) {
+	sec := e.Time.Unix()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := &s.buckets[sec%liveWindow]
+	if b.second != sec {
+		*b = liveBucket{second: sec}
+	}
+	b.requests++
+	b.retries += max(e.Attempts-1, 0)
+	if e.Status < http.StatusBadRequest {
+		return
+	}
+	b.errors++
+	if len(s.errors) == liveErrorCapacity {
+		s.errors = slices.Delete(s.errors, 0, 1)
+	}
+	s.errors = append(s.errors, e)
+}
+
+// snapshot fills the traffic fields of a snapshot taken at now.
+func (s *liveStats) snapshot(now time.Time, out *LiveSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out.Throughput = make([]int, liveWindow)
+	first := now.Unix() - liveWindow + 1
+	for _, b := range s.buckets {
+		if b.second < first || b.second > now.Unix() {
+			continue
+		}
+		out.Throughput[b.second-first] = b.requests
+		out.Requests += b.requests
+		out.Errors += b.errors
+		out.Retries += b.retries
+	}
+	out.RecentErrors = make([]LiveRequest, 0, len(s.errors))
+	for _, e := range slices.Backward(s.errors) {
+		out.RecentErrors = append(out.RecentErrors, e)
+	}
+}
+
+// liveSnapshot combines the recent traffic with provider health and the
+// newest failover events.
+func liveSnapshot(cfg *Config, now time.Time) LiveSnapshot {
+	snap := LiveSnapshot{Time: now, Providers: providerStatus(cfg), Events: []FailoverEvent{}}
+	liveRequests.snapshot(now, &snap)
+
+	events := failoverEvents.snapshot()
+	since := now.Add(-liveWindow * time.Second)
+	for _, e := range slices.Backward(events) {
+		if e.Kind == EventFallback && e.Time.After(since) {
+			snap.Fallbacks++
+		}
+		if len(snap.Events) < liveErrorCapacity {
+			snap.Events = append(snap.Events, e)
+		}
+	}
+	return snap
+}
+
+// handleUI serves the admin UI page.
+func handleUI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(uiPage)
+}
+
+// handleUISnapshot serves the current state shown on the admin UI.
+func handleUISnapshot(config func() *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, liveSnapshot(config(), time.Now()))
+	}
+}
+
+// handleUIStream sends a snapshot as a server-sent event right away and then
+// every liveStreamInterval until the client disconnects or shutdown begins.
+func handleUIStream(config func() *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		rc := http.NewResponseController(w)
+
+		ticker := time.NewTicker(liveStreamInterval)
+		defer ticker.Stop()
+		for {
+			data, err := json.Marshal(liveSnapshot(config(), time.Now()))
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+			// Shutdown waits for open requests, so streams end once it begins
+			if !serverReady.Load() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package hydra
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveStats(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	var s liveStats
+	s.record(LiveRequest{Time: now.Add(-2 * liveWindow * time.Second), Status: 200})
+	s.record(LiveRequest{Time: now.Add(-time.Second), Status: 200, Attempts: 3})
+	s.record(LiveRequest{Time: now, Status: 200, Attempts: 1})
+	s.record(LiveRequest{Time: now, Path: "/v1/messages", Status: 502, Attempts: 2})
+
+	var snap LiveSnapshot
+	s.snapshot(now, &snap)
+	if snap.Requests != 3 || snap.Errors != 1 || snap.Retries != 3 {
+		t.Errorf("unexpected counts: %+v", snap)
+	}
+	if len(snap.Throughput) != liveWindow || snap.Throughput[liveWindow-1] != 2 ||
+		snap.Throughput[liveWindow-2] != 1 {
+		t.Errorf("unexpected throughput: %v", snap.Throughput)
+	}
+	if len(snap.RecentErrors) != 1 || snap.RecentErrors[0].Path != "/v1/messages" {
+		t.Errorf("unexpected recent errors: %+v", snap.RecentErrors)
+	}
+
+	for i := range liveErrorCapacity + 5 {
+		s.record(LiveRequest{Time: now, Status: 500, Attempts: i})
+	}
+	s.snapshot(now, &snap)
+	if len(snap.RecentErrors) != liveErrorCapacity ||
+		snap.RecentErrors[0].Attempts != liveErrorCapacity+4 {
+		t.Errorf("expected the newest errors first, got %+v", snap.RecentErrors)
+	}
+}
+
+func TestAdminHandler_UI(t *testing.T) {
+	handler := newAdminHandler(testAdminConfig)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/ui", nil))
+	contentType := rec.Header().Get("Content-Type")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(contentType, "text/html") ||
+		!strings.Contains(rec.Body.String(), "ui/stream") {
+		t.Errorf("unexpected page: %d %s", rec.Code, contentType)
+	}
+
+	failoverEvents.add(FailoverEvent{Kind: EventFallback, Provider: "admin-openai"})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/ui/snapshot", nil))
+	var snap LiveSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("invalid snapshot: %v", err)
+	}
+	if _, ok := snap.Providers["admin-openai"]; !ok || snap.Fallbacks < 1 || len(snap.Events) == 0 {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestAdminHandler_UIStream(t *testing.T) {
+	ts := httptest.NewServer(newAdminHandler(testAdminConfig))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/ui/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	// The first snapshot is sent without waiting for the interval
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+	var snap LiveSnapshot
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &snap); err != nil {
+		t.Fatalf("invalid event %q: %v", line, err)
+	}
+	if len(snap.Throughput) != liveWindow {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+}
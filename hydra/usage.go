@@ -0,0 +1,216 @@
+package hydra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// modelUsage accumulates the token use and estimated cost of every model.
+var modelUsage = newUsageTracker()
+
+var (
+	tokensCounter = metrics.Counter(
+		"hydrallm_tokens_total",
+		"Tokens reported by upstream usage objects, by provider, model, and kind.",
+	)
+	costCounter = metrics.Counter(
+		"hydrallm_cost_usd_total",
+		"Estimated cost in USD from model prices, by provider and model.",
+	)
+)
+
+// ModelPrice is the price of a model in USD per 1000 tokens.
+type ModelPrice struct {
+	InputPer1K  float64 `mapstructure:"input_per_1k"`
+	OutputPer1K float64 `mapstructure:"output_per_1k"`
+}
+
+// cost returns the estimated cost of the given usage.
+func (p ModelPrice) cost(usage tokenUsage) float64 {
+	return (float64(usage.Input)*p.InputPer1K + float64(usage.Output)*p.OutputPer1K) / 1000
+}
+
+// UsageTotals are accumulated token counts and estimated cost.
+type UsageTotals struct {
+	Requests     int64   `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	TotalTokens  int64   `json:"total_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+func (t *UsageTotals) add(o UsageTotals) {
+	t.Requests += o.Requests
+	t.InputTokens += o.InputTokens
+	t.OutputTokens += o.OutputTokens
+	t.TotalTokens += o.TotalTokens
+	t.CostUSD += o.CostUSD
+}
+
+// ModelUsage is the accumulated usage of a configured model.
+type ModelUsage struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	UsageTotals
+}
+
+// usageSource identifies the request a response belongs to.
+type usageSource struct {
+	RequestID string
+	Listener  string
+	Variant   string // Experiment variant, empty outside experiments
+}
+
+// usageReport is the accumulated usage served by the admin API.
+type usageReport struct {
+	Total       UsageTotals                       `json:"total"`
+	Providers   map[string]UsageTotals            `json:"providers"`
+	Models      map[string]ModelUsage             `json:"models"`
+	Experiments map[string]map[string]UsageTotals `json:"experiments"` // Listener -> variant
+}
+
+// usageEntry is one line of the usage log.
+type usageEntry struct {
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Listener     string    `json:"listener,omitempty"`
+	Variant      string    `json:"variant,omitempty"`
+	ModelID      string    `json:"model_id"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	TotalTokens  int       `json:"total_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+}
+
+type usageTracker struct {
+	mu          sync.Mutex
+	models      map[string]ModelUsage
+	experiments map[string]map[string]UsageTotals // Listener -> variant
+	w           io.Writer                         // Usage log, nil when disabled
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		models:      make(map[string]ModelUsage),
+		experiments: make(map[string]map[string]UsageTotals),
+	}
+}
+
+// openUsageLog sends a JSON line per recorded response to the file at path,
+// appending to it. An empty path disables the usage log and "-" writes to
+// standard output.
+func (u *usageTracker) openUsageLog(path string) error {
+	var w io.Writer
+	switch path {
+	case "":
+	case "-":
+		w = os.Stdout
+	default:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open usage log: %w", err)
+		}
+		w = f
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.w = w
+	return nil
+}
+
+// record adds the usage of one response from model. Responses without usage
+// are not counted.
+func (u *usageTracker) record(model Model, usage tokenUsage, source usageSource) {
+	if usage.total() == 0 {
+		return
+	}
+	cost := model.Price.cost(usage)
+	for kind, n := range map[string]int{"input": usage.Input, "output": usage.Output} {
+		tokensCounter.Add(float64(n), "provider", model.Provider, "model", model.ID, "kind", kind)
+	}
+	if cost > 0 {
+		costCounter.Add(cost, "provider", model.Provider, "model", model.ID)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	totals := UsageTotals{
+		Requests:     1,
+		InputTokens:  int64(usage.Input),
+		OutputTokens: int64(usage.Output),
+		TotalTokens:  int64(usage.total()),
+		CostUSD:      cost,
+	}
+	m := u.models[model.ID]
+	m.Provider = model.Provider
+	m.Model = model.Model
+	m.add(totals)
+	u.models[model.ID] = m
+	if source.Variant != "" {
+		if u.experiments[source.Listener] == nil {
+			u.experiments[source.Listener] = make(map[string]UsageTotals)
+		}
+		v := u.experiments[source.Listener][source.Variant]
+		v.add(totals)
+		u.experiments[source.Listener][source.Variant] = v
+	}
+
+	if u.w == nil {
+		return
+	}
+	line, err := json.Marshal(usageEntry{
+		Time:         time.Now().UTC(),
+		RequestID:    source.RequestID,
+		Listener:     source.Listener,
+		Variant:      source.Variant,
+		ModelID:      model.ID,
+		Provider:     model.Provider,
+		Model:        model.Model,
+		InputTokens:  usage.Input,
+		OutputTokens: usage.Output,
+		TotalTokens:  usage.total(),
+		CostUSD:      cost,
+	})
+	if err != nil {
+		return
+	}
+	if _, err := u.w.Write(append(line, '\n')); err != nil {
+		logger.Warn("failed to write usage log", "error", err)
+	}
+}
+
+// snapshot returns the accumulated usage overall, by provider, by model ID,
+// and by experiment variant.
+func (u *usageTracker) snapshot() usageReport {
+	u.mu.Lock()
+	report := usageReport{
+		Providers:   make(map[string]UsageTotals),
+		Models:      maps.Clone(u.models),
+		Experiments: make(map[string]map[string]UsageTotals, len(u.experiments)),
+	}
+	for listener, variants := range u.experiments {
+		report.Experiments[listener] = maps.Clone(variants)
+	}
+	u.mu.Unlock()
+
+	for _, m := range report.Models {
+		p := report.Providers[m.Provider]
+		p.add(m.UsageTotals)
+		report.Providers[m.Provider] = p
+		report.Total.add(m.UsageTotals)
+	}
+	return report
+}
+
+// handleUsage serves the accumulated usage as JSON.
+func handleUsage(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, modelUsage.snapshot())
+}
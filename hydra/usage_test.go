@@ -0,0 +1,152 @@
+package hydra
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenUsage_Observe(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected tokenUsage
+	}{
+		{
+			name:     "openai",
+			lines:    []string{`{"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`},
+			expected: tokenUsage{Input: 10, Output: 5, Total: 15},
+		},
+		{
+			name: "anthropic stream",
+			lines: []string{
+				`data: {"message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+				`data: {"usage":{"output_tokens":30}}`,
+			},
+			expected: tokenUsage{Input: 12, Output: 30},
+		},
+		{
+			name: "gemini stream",
+			lines: []string{
+				`data: {"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":2}}`,
+				`data: {"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":9,` +
+					`"totalTokenCount":17}}`,
+			},
+			expected: tokenUsage{Input: 8, Output: 9, Total: 17},
+		},
+		{
+			name:     "bedrock",
+			lines:    []string{`{"usage":{"inputTokens":3,"outputTokens":4,"totalTokens":7}}`},
+			expected: tokenUsage{Input: 3, Output: 4, Total: 7},
+		},
+		{
+			name:  "no usage",
+			lines: []string{`{"choices":[]}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var usage tokenUsage
+			for _, line := range tt.lines {
+				usage.observe([]byte(line))
+			}
+			if usage != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, usage)
+			}
+		})
+	}
+}
+
+func TestUsageTracker(t *testing.T) {
+	u := newUsageTracker()
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	if err := u.openUsageLog(path); err != nil {
+		t.Fatal(err)
+	}
+
+	priced := Model{
+		ID:       "usage-gpt",
+		Provider: "usage-openai",
+		Model:    "gpt-5",
+		Price:    ModelPrice{InputPer1K: 0.002, OutputPer1K: 0.01},
+	}
+	free := Model{ID: "usage-local", Provider: "usage-openai", Model: "llama"}
+	experiment := usageSource{RequestID: "req-1", Listener: "main", Variant: variantCandidate}
+	u.record(priced, tokenUsage{Input: 1000, Output: 500}, experiment)
+	u.record(priced, tokenUsage{Input: 500, Output: 500, Total: 1000}, usageSource{})
+	u.record(free, tokenUsage{Input: 10, Output: 20}, usageSource{})
+	u.record(free, tokenUsage{}, usageSource{})
+
+	report := u.snapshot()
+	models, providers := report.Models, report.Providers
+	m := models["usage-gpt"]
+	if m.Requests != 2 || m.InputTokens != 1500 || m.OutputTokens != 1000 ||
+		m.TotalTokens != 2500 || m.Model != "gpt-5" {
+		t.Errorf("unexpected model usage: %+v", m)
+	}
+	if math.Abs(m.CostUSD-0.013) > 1e-9 {
+		t.Errorf("expected cost 0.013, got %v", m.CostUSD)
+	}
+	if models["usage-local"].Requests != 1 || models["usage-local"].CostUSD != 0 {
+		t.Errorf("unexpected free model usage: %+v", models["usage-local"])
+	}
+	p := providers["usage-openai"]
+	if p.Requests != 3 || p.TotalTokens != 2530 {
+		t.Errorf("unexpected provider usage: %+v", p)
+	}
+	if report.Total != p {
+		t.Errorf("expected total %+v, got %+v", p, report.Total)
+	}
+	if v := report.Experiments["main"][variantCandidate]; v.Requests != 1 || v.TotalTokens != 1500 {
+		t.Errorf("unexpected experiment usage: %+v", report.Experiments)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 usage log lines, got %d", len(lines))
+	}
+	var entry usageEntry
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatalf("invalid usage log line: %v", err)
+	}
+	if entry.RequestID != "req-1" || entry.Variant != variantCandidate ||
+		entry.ModelID != "usage-gpt" || entry.TotalTokens != 1500 {
+		t.Errorf("unexpected usage log entry: %+v", entry)
+	}
+}
+
+func TestAdminHandler_Usage(t *testing.T) {
+	modelUsage.record(
+		Model{ID: "admin-usage", Provider: "admin-usage-provider", Model: "gpt-5"},
+		tokenUsage{Input: 4, Output: 6},
+		usageSource{},
+	)
+
+	rec := httptest.NewRecorder()
+	newAdminHandler(testAdminConfig).ServeHTTP(rec, httptest.NewRequest("GET", "/usage", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Providers map[string]UsageTotals `json:"providers"`
+		Models    map[string]ModelUsage  `json:"models"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body.Models["admin-usage"].TotalTokens != 10 ||
+		body.Providers["admin-usage-provider"].Requests != 1 {
+		t.Errorf("unexpected usage: %+v", body)
+	}
+}
@@ -3,14 +3,16 @@ package main
 import (
 	"errors"
 	"os"
-	"path/filepath"
 
+	"github.com/fang2hou/hydrallm/hydra"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
 
+var logger = hydra.Logger()
+
 func main() {
 	cmd := &cobra.Command{
 		Use:   "hydrallm",
@@ -20,14 +22,29 @@ func main() {
 
 	cobra.OnInitialize(initConfig)
 	cmd.PersistentFlags().
-		StringVarP(&cfgFile, "config", "c", "", "config file (default is ~/.config/hydrallm/config.toml)")
+		StringVarP(&cfgFile, "config", "c", "", "config file or directory (default is ~/.config/hydrallm/config.toml)")
 	cmd.PersistentFlags().StringP("log-level", "l", "", "log level (debug, info, warn, error)")
+	cmd.PersistentFlags().StringVar(
+		&profile,
+		"profile",
+		os.Getenv("HYDRALLM_PROFILE"),
+		"config profile, read from ~/.config/hydrallm/profiles/<profile>.toml",
+	)
 
 	_ = viper.BindPFlag("log.level", cmd.PersistentFlags().Lookup("log-level"))
 
 	cmd.AddCommand(newVersionCmd())
 	cmd.AddCommand(newServeCmd())
 	cmd.AddCommand(newEditCmd())
+	cmd.AddCommand(newCacheCmd())
+	cmd.AddCommand(newEvalCmd())
+	cmd.AddCommand(newValidateCmd())
+	cmd.AddCommand(newEventsCmd())
+	cmd.AddCommand(newUsageCmd())
+	cmd.AddCommand(newMonitoringCmd())
+	cmd.AddCommand(newMockServerCmd())
+	cmd.AddCommand(newTestCmd())
+	cmd.AddCommand(newExplainCmd())
 
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
@@ -35,19 +52,31 @@ func main() {
 }
 
 func initConfig() {
-	if cfgFile != "" {
+	if profile != "" {
+		if !profileNamePattern.MatchString(profile) {
+			logger.Fatalf("invalid profile %q: use letters, digits, '-' and '_'", profile)
+		}
+		// Each profile keeps its logs and data apart unless its config says otherwise
+		viper.SetDefault("state_dir", profileStateDir(profile))
+	}
+
+	switch {
+	case cfgFile != "":
 		viper.SetConfigFile(cfgFile)
-	} else {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			logger.Fatalf("failed to get home directory: %v", err)
+	case profile != "":
+		// A profile without a config file yet reads as empty, like the default
+		path := profileConfigPath(profile)
+		if _, err := os.Stat(path); err != nil {
+			return
 		}
-		viper.AddConfigPath(filepath.Join(home, ".config", "hydrallm"))
+		viper.SetConfigFile(path)
+	default:
+		viper.AddConfigPath(configDir())
 		viper.SetConfigType("toml")
 		viper.SetConfigName("config")
 	}
 
-	if err := viper.ReadInConfig(); err != nil {
+	if err := hydra.ReadConfig(); err != nil {
 		if _, ok := errors.AsType[viper.ConfigFileNotFoundError](err); !ok {
 			logger.Fatalf("failed to read config: %v", err)
 		}
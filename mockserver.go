@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+// mockServerOptions holds the flags of the mockserver command.
+type mockServerOptions struct {
+	host      string
+	port      int
+	scenarios string
+}
+
+func newMockServerCmd() *cobra.Command {
+	var opts mockServerOptions
+	cmd := &cobra.Command{
+		Use:   "mockserver",
+		Short: "Run a mock OpenAI and Anthropic API for integration tests",
+		Run: func(_ *cobra.Command, _ []string) {
+			runMockServer(opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.host, "host", "127.0.0.1", "address to listen on")
+	cmd.Flags().IntVarP(&opts.port, "port", "p", 8089, "port to listen on")
+	cmd.Flags().StringVarP(&opts.scenarios, "scenarios", "s", "", "file of [[scenarios]]")
+	return cmd
+}
+
+func runMockServer(opts mockServerOptions) {
+	var scenarios []hydra.MockScenario
+	if opts.scenarios != "" {
+		var err error
+		if scenarios, err = hydra.LoadMockScenarios(opts.scenarios); err != nil {
+			logger.Fatalf("failed to load scenarios: %v", err)
+		}
+	}
+	mock, err := hydra.NewMockServer(scenarios, logger)
+	if err != nil {
+		logger.Fatalf("invalid scenarios: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              net.JoinHostPort(opts.host, strconv.Itoa(opts.port)),
+		Handler:           mock,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	logger.Info("mock server listening", "address", server.Addr, "scenarios", len(scenarios))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatalf("mock server failed: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestNewMockServerCmd(t *testing.T) {
+	cmd := newMockServerCmd()
+	if cmd.Run == nil {
+		t.Fatal("expected Run function")
+	}
+	for _, name := range []string{"host", "port", "scenarios"} {
+		if cmd.Flags().Lookup(name) == nil {
+			t.Errorf("expected --%s flag", name)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+func newMonitoringCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "monitoring",
+		Short: "Generate monitoring configuration for the exported metrics",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "dashboard",
+		Short: "Print a Grafana dashboard as JSON",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := hydra.WriteGrafanaDashboard(os.Stdout); err != nil {
+				logger.Fatalf("failed to write dashboard: %v", err)
+			}
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "alerts",
+		Short: "Print Prometheus alerting rules",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := hydra.WritePrometheusRules(os.Stdout); err != nil {
+				logger.Fatalf("failed to write alert rules: %v", err)
+			}
+		},
+	})
+	return cmd
+}
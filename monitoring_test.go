@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestNewMonitoringCmd(t *testing.T) {
+	cmd := newMonitoringCmd()
+	for _, name := range []string{"dashboard", "alerts"} {
+		sub, _, err := cmd.Find([]string{name})
+		if err != nil || sub.Name() != name {
+			t.Fatalf("expected %s subcommand: %v", name, err)
+		}
+		if sub.Run == nil {
+			t.Errorf("expected Run function for %s", name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+var profile string
+
+// profileNamePattern restricts profile names to safe file names.
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// profilePortStep separates the default ports of successive profiles.
+const profilePortStep = 10
+
+var templatePortPattern = regexp.MustCompile(`(?m)^(#?\s*port\s*=\s*)(\d+)`)
+
+// configDir returns the directory of the default config and of profiles.
+func configDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		logger.Fatalf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(home, ".config", "hydrallm")
+}
+
+// profileStateDir returns the default state_dir of a profile, under
+// $XDG_STATE_HOME or ~/.local/state.
+func profileStateDir(name string) string {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			logger.Fatalf("failed to get home directory: %v", err)
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "hydrallm", name)
+}
+
+// profileTemplate returns the default config for a new profile: the template
+// with every listener port moved past those of the profiles already created,
+// so profiles started from it do not collide.
+func profileTemplate(template string) string {
+	existing, _ := filepath.Glob(filepath.Join(configDir(), "profiles", "*.toml"))
+	offset := (len(existing) + 1) * profilePortStep
+	return templatePortPattern.ReplaceAllStringFunc(template, func(line string) string {
+		m := templatePortPattern.FindStringSubmatch(line)
+		port, _ := strconv.Atoi(m[2])
+		return m[1] + strconv.Itoa(port+offset)
+	})
+}
+
+// profileConfigPath returns the config file of a profile.
+func profileConfigPath(name string) string {
+	return filepath.Join(configDir(), "profiles", name+".toml")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileStateDir(t *testing.T) {
+	t.Setenv("HOME", "/dummy/home")
+	t.Setenv("XDG_STATE_HOME", "")
+	if got, want := profileStateDir("work"), "/dummy/home/.local/state/hydrallm/work"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	t.Setenv("XDG_STATE_HOME", "/state")
+	if got, want := profileStateDir("work"), "/state/hydrallm/work"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestProfileTemplate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	template := "[[listeners]]\nport = 8080\n\n# [[listeners]]\n# port = 8081\n"
+
+	got := profileTemplate(template)
+	if !strings.Contains(got, "\nport = 8090\n") || !strings.Contains(got, "# port = 8091\n") {
+		t.Errorf("expected ports moved by one step, got:\n%s", got)
+	}
+
+	profiles := filepath.Join(home, ".config", "hydrallm", "profiles")
+	if err := os.MkdirAll(profiles, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(profiles, "work.toml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := profileTemplate(template); !strings.Contains(got, "\nport = 8100\n") {
+		t.Errorf("expected the second profile two steps up, got:\n%s", got)
+	}
+}
+
+func TestProfileNamePattern(t *testing.T) {
+	for name, want := range map[string]bool{
+		"work":       true,
+		"personal_2": true,
+		"../etc":     false,
+		"a/b":        false,
+	} {
+		if got := profileNamePattern.MatchString(name); got != want {
+			t.Errorf("profile %q: expected valid %v, got %v", name, want, got)
+		}
+	}
+}
@@ -1,114 +1,90 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
-	"time"
+	"text/tabwriter"
 
+	"github.com/fang2hou/hydrallm/hydra"
 	"github.com/spf13/cobra"
 )
 
 func newServeCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the proxy server",
 		Run:   runServe,
 	}
+	cmd.Flags().Bool("dry-run", false, "print the routing plan of each listener and exit")
+	return cmd
 }
 
-func runServe(_ *cobra.Command, _ []string) {
-	cfg, err := loadConfig()
+func runServe(cmd *cobra.Command, _ []string) {
+	cfg, err := hydra.LoadConfig()
 	if err != nil {
 		logger.Fatalf("failed to load config: %v", err)
 	}
 
-	logger.Info("starting hydrallm", "listeners", len(cfg.Listeners))
-
-	// Create servers for each listener
-	servers := make([]*http.Server, 0, len(cfg.Listeners))
-	for i := range cfg.Listeners {
-		l := &cfg.Listeners[i]
-
-		logger.Info(
-			"configured listener",
-			"name",
-			l.Name,
-			"host",
-			l.Host,
-			"port",
-			l.Port,
-			"models",
-			len(l.Models),
-		)
-		for _, m := range l.ResolvedModels {
-			logger.Info(
-				"configured model",
-				"listener",
-				l.Name,
-				"provider",
-				m.Provider,
-				"model",
-				m.Model,
-				"type",
-				m.Type,
-				"attempts",
-				m.Attempts,
-			)
-		}
-
-		proxy := newProxy(l, cfg, logger)
-
-		server := &http.Server{
-			Addr:              fmt.Sprintf("%s:%d", l.Host, l.Port),
-			Handler:           proxy,
-			ReadHeaderTimeout: 30 * time.Second,
-			ReadTimeout:       l.ReadTimeout,
-			WriteTimeout:      l.WriteTimeout,
+	// The root command serves too but has no --dry-run flag
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		if err := writeRoutingPlan(os.Stdout, hydra.RoutingPlan(cfg)); err != nil {
+			logger.Fatalf("failed to write plan: %v", err)
 		}
-		servers = append(servers, server)
+		return
 	}
 
-	// Start all servers
-	var wg sync.WaitGroup
-	for _, server := range servers {
-		wg.Add(1)
-		go func(s *http.Server) {
-			defer wg.Done()
-			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				logger.Fatalf("failed to start server %s: %v", s.Addr, err)
-			}
-		}(server)
-		logger.Info("hydrallm listening", "address", server.Addr)
-	}
+	// Reload config on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
 
 	// Wait for shutdown signal
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	<-ctx.Done()
-	logger.Info("shutting down servers...")
-
-	// Graceful shutdown with timeout
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if err := hydra.Serve(ctx, cfg, reload); err != nil {
+		logger.Fatalf("failed to start: %v", err)
+	}
+}
 
-	var shutdownWg sync.WaitGroup
-	for _, server := range servers {
-		shutdownWg.Add(1)
-		go func(s *http.Server) {
-			defer shutdownWg.Done()
-			if err := s.Shutdown(shutdownCtx); err != nil {
-				logger.Error("server shutdown error", "address", s.Addr, "error", err)
+// writeRoutingPlan prints the attempts of every listener chain in order,
+// with the worst-case latency of each chain.
+func writeRoutingPlan(w io.Writer, plans []hydra.ListenerPlan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, p := range plans {
+		if i > 0 {
+			_, _ = fmt.Fprintln(tw)
+		}
+		_, _ = fmt.Fprintf(
+			tw,
+			"listener %s on %s (strategy %s, dispatch %s)\n",
+			p.Listener,
+			p.Address,
+			p.Strategy,
+			p.Dispatch,
+		)
+		for _, c := range p.Chains {
+			_, _ = fmt.Fprintf(tw, "\n  chain %s, worst case %s\n", c.Name, c.WorstCase)
+			_, _ = fmt.Fprintln(tw, "  CYCLE\tMODEL\tPROVIDER\tURL\tATTEMPT\tTIMEOUT\tWAIT")
+			for _, s := range c.Steps {
+				_, _ = fmt.Fprintf(
+					tw,
+					"  %d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+					s.Cycle,
+					s.Model,
+					s.Provider,
+					cmp.Or(s.URL, "-"),
+					s.Attempt,
+					s.Timeout,
+					s.Wait,
+				)
 			}
-		}(server)
+		}
 	}
-	shutdownWg.Wait()
-
-	wg.Wait()
-	logger.Info("all servers stopped")
+	return tw.Flush()
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
 )
 
 func TestNewServeCmd(t *testing.T) {
@@ -18,4 +23,37 @@ func TestNewServeCmd(t *testing.T) {
 	if cmd.Run == nil {
 		t.Error("expected Run function")
 	}
+	if cmd.Flags().Lookup("dry-run") == nil {
+		t.Error("expected --dry-run flag")
+	}
+}
+
+func TestWriteRoutingPlan(t *testing.T) {
+	plans := []hydra.ListenerPlan{{
+		Listener: "openai",
+		Address:  "127.0.0.1:8080",
+		Strategy: "priority",
+		Dispatch: "chain",
+		Chains: []hydra.ChainPlan{{
+			Name:      "default",
+			WorstCase: 31 * time.Second,
+			Steps: []hydra.PlanStep{
+				{
+					Cycle: 1, Model: "a", Provider: "p", URL: "https://api.example.com", Attempt: 1,
+					Timeout: 10 * time.Second, Wait: time.Second,
+				},
+				{Cycle: 1, Model: "b", Provider: "local", Attempt: 1, Timeout: 20 * time.Second},
+			},
+		}},
+	}}
+
+	var out bytes.Buffer
+	if err := writeRoutingPlan(&out, plans); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"listener openai on 127.0.0.1:8080", "worst case 31s", "-  "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in plan:\n%s", want, out.String())
+		}
+	}
 }
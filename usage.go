@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+// usageExportOptions holds the flags of the usage export command.
+type usageExportOptions struct {
+	file   string
+	output string
+	format string
+	from   string
+	to     string
+}
+
+func newUsageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Work with recorded token usage",
+	}
+	cmd.AddCommand(newUsageExportCmd())
+	return cmd
+}
+
+func newUsageExportCmd() *cobra.Command {
+	var opts usageExportOptions
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the usage log as CSV or Parquet",
+		Run: func(_ *cobra.Command, _ []string) {
+			runUsageExport(opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.file, "file", "f", "", "usage log (default is log.usage_log)")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "-", "output file, - for stdout")
+	cmd.Flags().StringVar(&opts.format, "format", hydra.UsageFormatCSV, "csv or parquet")
+	cmd.Flags().StringVar(&opts.from, "from", "", "first date or RFC 3339 time to include")
+	cmd.Flags().StringVar(&opts.to, "to", "", "date or RFC 3339 time to stop before")
+	return cmd
+}
+
+func runUsageExport(opts usageExportOptions) {
+	from, err := parseExportTime(opts.from)
+	if err != nil {
+		logger.Fatalf("invalid --from: %v", err)
+	}
+	to, err := parseExportTime(opts.to)
+	if err != nil {
+		logger.Fatalf("invalid --to: %v", err)
+	}
+
+	path := opts.file
+	if path == "" {
+		cfg, err := hydra.LoadConfig()
+		if err != nil {
+			logger.Fatalf("failed to load config: %v", err)
+		}
+		path = cfg.Log.UsageLog
+	}
+	if path == "" || path == "-" {
+		logger.Fatal("--file is required when log.usage_log is not a file")
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		logger.Fatalf("failed to open usage log: %v", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	var out io.Writer = os.Stdout
+	if opts.output != "-" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			logger.Fatalf("failed to create output: %v", err)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	n, err := hydra.ExportUsage(in, out, opts.format, from, to)
+	if err != nil {
+		logger.Fatalf("usage export failed: %v", err)
+	}
+	logger.Info("usage exported", "entries", n, "format", opts.format)
+}
+
+// parseExportTime parses a date, taken as midnight UTC, or an RFC 3339 time.
+// An empty value is the zero time.
+func parseExportTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
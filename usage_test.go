@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewUsageCmd(t *testing.T) {
+	cmd := newUsageCmd()
+	export, _, err := cmd.Find([]string{"export"})
+	if err != nil {
+		t.Fatalf("expected export subcommand: %v", err)
+	}
+	for _, name := range []string{"file", "output", "format", "from", "to"} {
+		if export.Flags().Lookup(name) == nil {
+			t.Errorf("expected --%s flag", name)
+		}
+	}
+}
+
+func TestParseExportTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-09-01", time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2026-09-01T09:00:00+09:00", time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), false},
+		{"September", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseExportTime(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseExportTime(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// validateOptions holds the flags of the validate command.
+type validateOptions struct {
+	live    bool
+	strict  bool
+	timeout time.Duration
+}
+
+func newValidateCmd() *cobra.Command {
+	var opts validateOptions
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the config and optionally check provider connectivity",
+		Run: func(_ *cobra.Command, _ []string) {
+			runValidate(opts)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.live, "live", false, "probe each provider's model list endpoint")
+	cmd.Flags().BoolVar(
+		&opts.strict,
+		"strict",
+		false,
+		"reject keys that match no option and unset environment variables",
+	)
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout per provider probe")
+	return cmd
+}
+
+func runValidate(opts validateOptions) {
+	if opts.strict {
+		viper.Set("strict", true)
+		viper.Set("strict_env", true)
+	}
+	cfg, err := hydra.LoadConfig()
+	if err != nil {
+		logger.Fatalf("invalid config: %v", err)
+	}
+	fmt.Printf(
+		"config is valid: %d listeners, %d providers, %d models\n",
+		len(cfg.Listeners),
+		len(cfg.Providers),
+		len(cfg.Models),
+	)
+	if !opts.live {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	checks := hydra.CheckProviders(ctx, cfg, opts.timeout)
+	if err := writeValidateReport(os.Stdout, checks); err != nil {
+		logger.Fatalf("failed to write report: %v", err)
+	}
+	if slices.ContainsFunc(checks, func(c hydra.ProviderCheck) bool { return !c.OK }) {
+		os.Exit(1)
+	}
+}
+
+// writeValidateReport prints one line per provider check.
+func writeValidateReport(w io.Writer, checks []hydra.ProviderCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PROVIDER\tTYPE\tRESULT\tDETAIL")
+	for _, c := range checks {
+		result := "ok"
+		if !c.OK {
+			result = "FAIL"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Provider, c.Type, result, c.Detail)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fang2hou/hydrallm/hydra"
+)
+
+func TestNewValidateCmd(t *testing.T) {
+	cmd := newValidateCmd()
+	if cmd.Use != "validate" {
+		t.Errorf("expected Use 'validate', got %q", cmd.Use)
+	}
+	if cmd.Flags().Lookup("live") == nil {
+		t.Error("expected --live flag")
+	}
+	if cmd.Flags().Lookup("strict") == nil {
+		t.Error("expected --strict flag")
+	}
+}
+
+func TestWriteValidateReport(t *testing.T) {
+	checks := []hydra.ProviderCheck{
+		{Provider: "anthropic", Type: "anthropic", OK: true, Detail: "200 OK in 12ms"},
+		{Provider: "bad_key", Type: "openai", Detail: "credentials rejected (401 Unauthorized)"},
+	}
+
+	var out bytes.Buffer
+	if err := writeValidateReport(&out, checks); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "credentials rejected") ||
+		!strings.Contains(out.String(), "FAIL") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/fang2hou/hydrallm/hydra"
+	"github.com/spf13/cobra"
+)
+
+// warmOptions holds the flags of the cache warm command.
+type warmOptions struct {
+	file        string
+	listener    string
+	path        string
+	concurrency int
+}
+
+// warmStats summarizes a cache warm run.
+type warmStats struct {
+	Sent   int
+	Failed int
+}
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the response cache",
+	}
+	cmd.AddCommand(newCacheWarmCmd())
+	return cmd
+}
+
+func newCacheWarmCmd() *cobra.Command {
+	var opts warmOptions
+	cmd := &cobra.Command{
+		Use:   "warm",
+		Short: "Replay prompts through a running listener to pre-populate the cache",
+		Run: func(_ *cobra.Command, _ []string) {
+			runCacheWarm(opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.file, "file", "f", "", "JSONL file with one request body per line")
+	cmd.Flags().StringVar(&opts.listener, "listener", "", "listener name (default is the first)")
+	cmd.Flags().StringVar(&opts.path, "path", "", "request path (default depends on listener type)")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 1, "number of requests in flight")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func runCacheWarm(opts warmOptions) {
+	cfg, err := hydra.LoadConfig()
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+
+	l, err := selectListener(cfg, opts.listener)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	path := opts.path
+	if path == "" {
+		path = l.DefaultPath()
+	}
+	if path == "" {
+		logger.Fatalf("listener %q: --path is required for %s listeners", l.Name, l.ConfigType)
+	}
+
+	f, err := os.Open(opts.file)
+	if err != nil {
+		logger.Fatalf("failed to open prompts file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	target := l.LocalURL() + path
+	logger.Info("warming cache", "listener", l.Name, "target", target)
+
+	// Authenticate as the listener's first client key when it requires one
+	client := http.DefaultClient
+	if len(l.ResolvedAPIKeys) > 0 {
+		client = &http.Client{Transport: bearerTransport{
+			key:  l.ResolvedAPIKeys[0].Key,
+			next: http.DefaultTransport,
+		}}
+	}
+
+	stats, err := warmCache(ctx, client, target, f, opts.concurrency)
+	if err != nil {
+		logger.Fatalf("cache warm failed: %v", err)
+	}
+	logger.Info("cache warm finished", "sent", stats.Sent, "failed", stats.Failed)
+}
+
+// selectListener returns the listener with the given name,
+// or the first listener when name is empty.
+func selectListener(cfg *hydra.Config, name string) (*hydra.Listener, error) {
+	if name == "" {
+		return &cfg.Listeners[0], nil
+	}
+	if l := hydra.FindListener(cfg, name); l != nil {
+		return l, nil
+	}
+	return nil, fmt.Errorf("listener %q not found", name)
+}
+
+// warmCache posts each non-empty line of r as a JSON request body to target.
+// Responses are read to completion so streamed responses are fully cached.
+// On an invalid line it stops sending and waits for the requests in flight.
+func warmCache(
+	ctx context.Context,
+	client *http.Client,
+	target string,
+	r io.Reader,
+	concurrency int,
+) (warmStats, error) {
+	var (
+		stats warmStats
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+	)
+	sem := make(chan struct{}, max(concurrency, 1))
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			wg.Wait()
+			return stats, fmt.Errorf("line %d: invalid JSON", lineNo)
+		}
+		body := bytes.Clone(line)
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return stats, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := sendWarmRequest(ctx, client, target, body)
+			mu.Lock()
+			defer mu.Unlock()
+			stats.Sent++
+			if err != nil {
+				stats.Failed++
+				logger.Warn("warm request failed", "line", lineNo, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read prompts: %w", err)
+	}
+	return stats, nil
+}
+
+// sendWarmRequest posts a single request body and drains the response.
+func sendWarmRequest(ctx context.Context, client *http.Client, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// bearerTransport adds a Bearer token to every request.
+type bearerTransport struct {
+	key  string
+	next http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.key)
+	return t.next.RoundTrip(req)
+}
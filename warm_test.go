@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fang2hou/hydrallm/hydra"
+)
+
+func TestNewCacheCmd(t *testing.T) {
+	cmd := newCacheCmd()
+	if cmd.Use != "cache" {
+		t.Errorf("expected Use 'cache', got %q", cmd.Use)
+	}
+
+	warm, _, err := cmd.Find([]string{"warm"})
+	if err != nil {
+		t.Fatalf("expected warm subcommand: %v", err)
+	}
+	if warm.Run == nil {
+		t.Error("expected Run function")
+	}
+	if warm.Flags().Lookup("file") == nil {
+		t.Error("expected --file flag")
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	input := strings.Join([]string{
+		`{"messages":[{"role":"user","content":"a"}]}`,
+		``,
+		`{"messages":[{"role":"user","content":"fail"}]}`,
+		`{"messages":[{"role":"user","content":"b"}]}`,
+	}, "\n")
+
+	stats, err := warmCache(context.Background(), ts.Client(), ts.URL, strings.NewReader(input), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Sent != 3 {
+		t.Errorf("expected 3 sent, got %d", stats.Sent)
+	}
+	if stats.Failed != 1 {
+		t.Errorf("expected 1 failed, got %d", stats.Failed)
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected 3 upstream requests, got %d", requests)
+	}
+}
+
+func TestWarmCache_InvalidJSON(t *testing.T) {
+	_, err := warmCache(
+		context.Background(),
+		http.DefaultClient,
+		"http://127.0.0.1:0",
+		strings.NewReader("{not json"),
+		1,
+	)
+	if err == nil {
+		t.Error("expected error for invalid JSON line")
+	}
+}
+
+func TestWarmCache_InvalidJSONAfterValid(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	input := strings.Join([]string{
+		`{"messages":[{"role":"user","content":"a"}]}`,
+		`{"messages":[{"role":"user","content":"b"}]}`,
+		`{not json`,
+		`{"messages":[{"role":"user","content":"c"}]}`,
+	}, "\n")
+
+	stats, err := warmCache(context.Background(), ts.Client(), ts.URL, strings.NewReader(input), 2)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected an error for line 3, got %v", err)
+	}
+	// Requests in flight finish before warmCache returns
+	if stats.Sent != 2 || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("expected 2 sent and 2 upstream requests, got %d and %d", stats.Sent, requests)
+	}
+}
+
+func TestSelectListener(t *testing.T) {
+	cfg := &hydra.Config{Listeners: []hydra.Listener{{Name: "a"}, {Name: "b"}}}
+
+	if l, err := selectListener(cfg, ""); err != nil || l.Name != "a" {
+		t.Errorf("expected first listener, got %v (err %v)", l, err)
+	}
+	if l, err := selectListener(cfg, "b"); err != nil || l.Name != "b" {
+		t.Errorf("expected listener b, got %v (err %v)", l, err)
+	}
+	if _, err := selectListener(cfg, "missing"); err == nil {
+		t.Error("expected error for missing listener")
+	}
+}